@@ -2,12 +2,95 @@ import { api } from '@shared/api'
 import { IResponse } from '@shared/types'
 
 import { AUTH_URL } from '../constants'
-import { TAuth, TVerifyEmail, TResendCode } from '../types'
+import {
+	TAuth,
+	TVerifyEmail,
+	TResendCode,
+	TForgotPassword,
+	TResetPassword,
+	TChangePassword,
+	TChangeEmail,
+	TDeleteAccount,
+	TExportFormat,
+	TLoginResponse,
+	TLogin2FA,
+	TTOTPSetup,
+	TTOTPConfirm,
+	TTOTPDisable,
+	TRecoveryCodes,
+	TWebAuthnRegistrationOptions,
+	TWebAuthnLoginOptions,
+	TWebAuthnRegisterFinish,
+	TWebAuthnLoginFinish,
+	TWebAuthnMFAFinish,
+	TWebAuthnCredential,
+} from '../types'
 
-export const loginApi = (data: TAuth): Promise<IResponse<{ access_token: string }>> => {
+export const loginApi = (data: TAuth): Promise<IResponse<TLoginResponse>> => {
 	return api.post(AUTH_URL.LOGIN, data)
 }
 
+export const login2FAApi = (data: TLogin2FA): Promise<IResponse<{ access_token: string }>> => {
+	return api.post(AUTH_URL.LOGIN_2FA, data)
+}
+
+export const totpSetupApi = (): Promise<IResponse<TTOTPSetup>> => {
+	return api.post(AUTH_URL.TOTP_SETUP)
+}
+
+export const totpConfirmApi = (data: TTOTPConfirm): Promise<IResponse<TRecoveryCodes>> => {
+	return api.post(AUTH_URL.TOTP_CONFIRM, data)
+}
+
+export const totpDisableApi = (data: TTOTPDisable): Promise<IResponse<null>> => {
+	return api.post(AUTH_URL.TOTP_DISABLE, data)
+}
+
+export const webAuthnLoginBeginApi = (
+	email?: string,
+): Promise<IResponse<TWebAuthnLoginOptions>> => {
+	return api.post(AUTH_URL.LOGIN_WEBAUTHN_BEGIN, { email: email || '' })
+}
+
+export const webAuthnLoginFinishApi = (
+	data: TWebAuthnLoginFinish,
+): Promise<IResponse<{ access_token: string }>> => {
+	return api.post(AUTH_URL.LOGIN_WEBAUTHN_FINISH, data)
+}
+
+export const webAuthnMFABeginApi = (
+	mfaToken: string,
+): Promise<IResponse<TWebAuthnLoginOptions>> => {
+	return api.post(AUTH_URL.LOGIN_2FA_WEBAUTHN_BEGIN, { mfa_token: mfaToken })
+}
+
+export const webAuthnMFAFinishApi = (
+	data: TWebAuthnMFAFinish,
+): Promise<IResponse<{ access_token: string }>> => {
+	return api.post(AUTH_URL.LOGIN_2FA_WEBAUTHN_FINISH, data)
+}
+
+export const webAuthnRegisterBeginApi = (): Promise<IResponse<TWebAuthnRegistrationOptions>> => {
+	return api.post(AUTH_URL.WEBAUTHN_REGISTER_BEGIN)
+}
+
+export const webAuthnRegisterFinishApi = (
+	data: TWebAuthnRegisterFinish,
+): Promise<IResponse<TWebAuthnCredential>> => {
+	return api.post(AUTH_URL.WEBAUTHN_REGISTER_FINISH, data)
+}
+
+export const webAuthnCredentialsApi = (): Promise<IResponse<TWebAuthnCredential[]>> => {
+	return api.get(AUTH_URL.WEBAUTHN_CREDENTIALS)
+}
+
+export const webAuthnDeleteCredentialApi = (
+	id: string,
+	password: string,
+): Promise<IResponse<null>> => {
+	return api.delete(`${AUTH_URL.WEBAUTHN_CREDENTIALS}/${id}`, { data: { password } })
+}
+
 export const registrationApi = (
 	data: TAuth,
 ): Promise<IResponse<{ message: string }>> => {
@@ -37,3 +120,43 @@ export const logoutApi = (): Promise<IResponse<null>> => {
 export const logoutAllApi = (): Promise<IResponse<null>> => {
 	return api.get(AUTH_URL.LOGOUT_ALL)
 }
+
+export const forgotPasswordApi = (
+	data: TForgotPassword,
+): Promise<IResponse<{ message: string }>> => {
+	return api.post(AUTH_URL.PASSWORD_FORGOT, data)
+}
+
+export const resetPasswordApi = (data: TResetPassword): Promise<IResponse<null>> => {
+	return api.post(AUTH_URL.PASSWORD_RESET, data)
+}
+
+// Остальные сессии завершаются, текущая получает новую пару токенов
+export const changePasswordApi = (
+	data: TChangePassword,
+): Promise<IResponse<{ access_token: string }>> => {
+	return api.put(AUTH_URL.PASSWORD, data)
+}
+
+export const changeEmailApi = (data: TChangeEmail): Promise<IResponse<{ message: string }>> => {
+	return api.put(AUTH_URL.EMAIL, data)
+}
+
+export const confirmEmailChangeApi = (code: string): Promise<IResponse<null>> => {
+	return api.post(AUTH_URL.EMAIL_CONFIRM, { code })
+}
+
+export const exportAccountApi = (format: TExportFormat): Promise<IResponse<Blob>> => {
+	return api.get(AUTH_URL.ACCOUNT_EXPORT, { params: { format }, responseType: 'blob' })
+}
+
+// Код подтверждения удаления уходит на email пользователя
+export const requestAccountDeletionApi = (
+	password: string,
+): Promise<IResponse<{ message: string }>> => {
+	return api.post(AUTH_URL.ACCOUNT_DELETE_CODE, { password })
+}
+
+export const deleteAccountApi = (data: TDeleteAccount): Promise<IResponse<null>> => {
+	return api.delete(AUTH_URL.ACCOUNT, { data })
+}
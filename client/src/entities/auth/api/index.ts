@@ -1,9 +1,29 @@
 export {
 	loginApi,
+	login2FAApi,
+	totpSetupApi,
+	totpConfirmApi,
+	totpDisableApi,
+	webAuthnLoginBeginApi,
+	webAuthnLoginFinishApi,
+	webAuthnMFABeginApi,
+	webAuthnMFAFinishApi,
+	webAuthnRegisterBeginApi,
+	webAuthnRegisterFinishApi,
+	webAuthnCredentialsApi,
+	webAuthnDeleteCredentialApi,
 	refreshApi,
 	registrationApi,
 	verifyEmailApi,
 	resendCodeApi,
+	forgotPasswordApi,
+	resetPasswordApi,
+	changePasswordApi,
+	changeEmailApi,
+	confirmEmailChangeApi,
+	exportAccountApi,
+	requestAccountDeletionApi,
+	deleteAccountApi,
 	logoutApi,
 	logoutAllApi,
 } from './auth.api'
@@ -2,9 +2,28 @@ import { BASE_APP_URL, REFRESH } from '@shared/constants'
 
 export const AUTH_URL = {
 	LOGIN: BASE_APP_URL + `/v1/user/login`,
+	LOGIN_2FA: BASE_APP_URL + `/v1/user/login/2fa`,
+	TOTP_SETUP: BASE_APP_URL + `/v1/user/2fa/totp/setup`,
+	TOTP_CONFIRM: BASE_APP_URL + `/v1/user/2fa/totp/confirm`,
+	TOTP_DISABLE: BASE_APP_URL + `/v1/user/2fa/totp/disable`,
+	LOGIN_WEBAUTHN_BEGIN: BASE_APP_URL + `/v1/user/login/webauthn/begin`,
+	LOGIN_WEBAUTHN_FINISH: BASE_APP_URL + `/v1/user/login/webauthn/finish`,
+	LOGIN_2FA_WEBAUTHN_BEGIN: BASE_APP_URL + `/v1/user/login/2fa/webauthn/begin`,
+	LOGIN_2FA_WEBAUTHN_FINISH: BASE_APP_URL + `/v1/user/login/2fa/webauthn/finish`,
+	WEBAUTHN_REGISTER_BEGIN: BASE_APP_URL + `/v1/user/webauthn/register/begin`,
+	WEBAUTHN_REGISTER_FINISH: BASE_APP_URL + `/v1/user/webauthn/register/finish`,
+	WEBAUTHN_CREDENTIALS: BASE_APP_URL + `/v1/user/webauthn/credentials`,
 	REGISTRATION: BASE_APP_URL + `/v1/user/register`,
 	VERIFY_EMAIL: BASE_APP_URL + `/v1/user/verify-email`,
 	RESEND_CODE: BASE_APP_URL + `/v1/user/resend-code`,
+	PASSWORD_FORGOT: BASE_APP_URL + `/v1/user/password/forgot`,
+	PASSWORD_RESET: BASE_APP_URL + `/v1/user/password/reset`,
+	PASSWORD: BASE_APP_URL + `/v1/user/password`,
+	EMAIL: BASE_APP_URL + `/v1/user/email`,
+	EMAIL_CONFIRM: BASE_APP_URL + `/v1/user/email/confirm`,
+	ACCOUNT: BASE_APP_URL + `/v1/user`,
+	ACCOUNT_DELETE_CODE: BASE_APP_URL + `/v1/user/delete/code`,
+	ACCOUNT_EXPORT: BASE_APP_URL + `/v1/user/export`,
 	LOGOUT: BASE_APP_URL + `/v1/user/logout`,
 	LOGOUT_ALL: BASE_APP_URL + `/v1/user/logout-all`,
 	REFRESH: REFRESH,
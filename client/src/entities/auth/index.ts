@@ -1 +1,2 @@
-export { type TAuth } from './types'
+export { type TAuth, type TResetPassword } from './types'
+export { isWebAuthnSupported } from './utils'
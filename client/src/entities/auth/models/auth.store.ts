@@ -5,25 +5,42 @@ import { TStoreLogic } from '@shared/store'
 import { getAccessToken, removeTokens } from '@shared/tokens'
 
 import {
+	forgotPasswordApi,
+	login2FAApi,
 	loginApi,
 	logoutAllApi,
 	logoutApi,
 	refreshApi,
 	registrationApi,
 	resendCodeApi,
+	resetPasswordApi,
 	verifyEmailApi,
+	webAuthnLoginBeginApi,
+	webAuthnLoginFinishApi,
+	webAuthnMFABeginApi,
+	webAuthnMFAFinishApi,
 } from '../api'
-import { TAuth, TResendCode, TVerifyEmail } from '../types'
+import { TAuth, TForgotPassword, TResendCode, TResetPassword, TVerifyEmail } from '../types'
+import { getWebAuthnAssertion } from '../utils'
 
 export class AuthStore {
 	auth = false
 	awaitingEmailVerification = false
 	verificationEmail = ''
+	awaitingMFA = false
+	mfaToken = ''
+	mfaMethods: string[] = []
+	awaitingPasswordReset = false
+	passwordResetEmail = ''
 
 	isLoginLoading = false
+	isLogin2FALoading = false
+	isWebAuthnLoading = false
 	isRegistrationLoading = false
 	isVerifyEmailLoading = false
 	isResendCodeLoading = false
+	isForgotPasswordLoading = false
+	isResetPasswordLoading = false
 	isCheckLoading = false
 	isLogoutLoading = false
 
@@ -38,9 +55,18 @@ export class AuthStore {
 		try {
 			this.isLoginLoading = true
 
-			await loginApi(data)
+			const response = await loginApi(data)
 
 			runInAction(() => {
+				// С включенным вторым фактором вход завершается кодом через login2FA
+				if (response.data?.mfa_required) {
+					this.awaitingMFA = true
+					this.mfaToken = response.data.mfa_token || ''
+					this.mfaMethods = response.data.methods || []
+					this.auth = false
+					return
+				}
+
 				this.auth = true
 			})
 		} catch (_) {
@@ -54,6 +80,89 @@ export class AuthStore {
 		}
 	}
 
+	login2FA = async (code: string) => {
+		try {
+			this.isLogin2FALoading = true
+
+			await login2FAApi({ mfa_token: this.mfaToken, code })
+
+			runInAction(() => {
+				this.auth = true
+				this.awaitingMFA = false
+				this.mfaToken = ''
+				this.mfaMethods = []
+			})
+		} catch (_) {
+			runInAction(() => {
+				this.auth = false
+			})
+			throw _
+		} finally {
+			runInAction(() => {
+				this.isLogin2FALoading = false
+			})
+		}
+	}
+
+	// Вход по passkey без пароля. Без email браузер предложит сохраненные ключи сайта
+	loginWebAuthn = async (email?: string) => {
+		try {
+			this.isWebAuthnLoading = true
+
+			const { data } = await webAuthnLoginBeginApi(email)
+			const credential = await getWebAuthnAssertion(data.options)
+			await webAuthnLoginFinishApi({ session_id: data.session_id, credential })
+
+			runInAction(() => {
+				this.auth = true
+			})
+		} catch (_) {
+			runInAction(() => {
+				this.auth = false
+			})
+		} finally {
+			runInAction(() => {
+				this.isWebAuthnLoading = false
+			})
+		}
+	}
+
+	// Второй шаг входа ключом WebAuthn вместо кода
+	login2FAWebAuthn = async () => {
+		try {
+			this.isWebAuthnLoading = true
+
+			const { data } = await webAuthnMFABeginApi(this.mfaToken)
+			const credential = await getWebAuthnAssertion(data.options)
+			await webAuthnMFAFinishApi({
+				mfa_token: this.mfaToken,
+				session_id: data.session_id,
+				credential,
+			})
+
+			runInAction(() => {
+				this.auth = true
+				this.awaitingMFA = false
+				this.mfaToken = ''
+				this.mfaMethods = []
+			})
+		} catch (_) {
+			runInAction(() => {
+				this.auth = false
+			})
+		} finally {
+			runInAction(() => {
+				this.isWebAuthnLoading = false
+			})
+		}
+	}
+
+	cancelMFA = () => {
+		this.awaitingMFA = false
+		this.mfaToken = ''
+		this.mfaMethods = []
+	}
+
 	registration = async (data: TAuth) => {
 		try {
 			this.isRegistrationLoading = true
@@ -114,6 +223,47 @@ export class AuthStore {
 		}
 	}
 
+	// Сервер отвечает одинаково для любого email, поэтому форма кода открывается всегда
+	forgotPassword = async (data: TForgotPassword) => {
+		try {
+			this.isForgotPasswordLoading = true
+
+			await forgotPasswordApi(data)
+
+			runInAction(() => {
+				this.awaitingPasswordReset = true
+				this.passwordResetEmail = data.email
+			})
+		} finally {
+			runInAction(() => {
+				this.isForgotPasswordLoading = false
+			})
+		}
+	}
+
+	// После сброса все сессии завершены, входить нужно с новым паролем
+	resetPassword = async (data: TResetPassword) => {
+		try {
+			this.isResetPasswordLoading = true
+
+			await resetPasswordApi(data)
+
+			runInAction(() => {
+				this.awaitingPasswordReset = false
+				this.passwordResetEmail = ''
+			})
+		} finally {
+			runInAction(() => {
+				this.isResetPasswordLoading = false
+			})
+		}
+	}
+
+	cancelPasswordReset = () => {
+		this.awaitingPasswordReset = false
+		this.passwordResetEmail = ''
+	}
+
 	refresh = async () => {
 		try {
 			if (this.isCheckLoading) return
@@ -198,11 +348,20 @@ export class AuthStore {
 		this.auth = false
 		this.awaitingEmailVerification = false
 		this.verificationEmail = ''
+		this.awaitingMFA = false
+		this.mfaToken = ''
+		this.mfaMethods = []
+		this.awaitingPasswordReset = false
+		this.passwordResetEmail = ''
 
 		this.isLoginLoading = false
+		this.isLogin2FALoading = false
+		this.isWebAuthnLoading = false
 		this.isRegistrationLoading = false
 		this.isVerifyEmailLoading = false
 		this.isResendCodeLoading = false
+		this.isForgotPasswordLoading = false
+		this.isResetPasswordLoading = false
 		this.isCheckLoading = false
 		this.isLogoutLoading = false
 
@@ -10,4 +10,145 @@ export type TVerifyEmail = {
 
 export type TResendCode = {
 	email: string
-}
\ No newline at end of file
+}
+
+export type TForgotPassword = {
+	email: string
+}
+
+export type TResetPassword = {
+	email: string
+	code: string
+	password: string
+}
+
+export type TChangePassword = {
+	current_password: string
+	new_password: string
+}
+
+export type TChangeEmail = {
+	email: string
+	password: string
+}
+
+export type TDeleteAccount = {
+	password: string
+	code: string
+}
+
+// json - один документ, zip - архив с бинарными данными секретов отдельными файлами
+export type TExportFormat = 'json' | 'zip'
+
+export type TLoginResponse = {
+	access_token?: string
+	mfa_required?: boolean
+	mfa_token?: string
+	methods?: string[]
+}
+
+export type TLogin2FA = {
+	mfa_token: string
+	code: string
+}
+
+export type TTOTPSetup = {
+	secret: string
+	otpauth_uri: string
+}
+
+export type TTOTPConfirm = {
+	code: string
+}
+
+export type TTOTPDisable = {
+	password: string
+	code: string
+}
+
+export type TRecoveryCodes = {
+	recovery_codes: string[]
+}
+
+export type TWebAuthnCredentialDescriptor = {
+	type: 'public-key'
+	id: string
+	transports?: string[]
+}
+
+export type TWebAuthnCreationOptions = {
+	rp: { id: string; name: string }
+	user: { id: string; name: string; displayName: string }
+	challenge: string
+	pubKeyCredParams: { type: 'public-key'; alg: number }[]
+	timeout: number
+	excludeCredentials: TWebAuthnCredentialDescriptor[]
+	authenticatorSelection: {
+		residentKey: ResidentKeyRequirement
+		userVerification: UserVerificationRequirement
+	}
+	attestation: AttestationConveyancePreference
+}
+
+export type TWebAuthnRequestOptions = {
+	challenge: string
+	timeout: number
+	rpId: string
+	allowCredentials: TWebAuthnCredentialDescriptor[]
+	userVerification: UserVerificationRequirement
+}
+
+export type TWebAuthnRegistrationOptions = {
+	session_id: string
+	options: TWebAuthnCreationOptions
+}
+
+export type TWebAuthnLoginOptions = {
+	session_id: string
+	options: TWebAuthnRequestOptions
+}
+
+export type TWebAuthnAttestation = {
+	id: string
+	rawId: string
+	type: string
+	response: {
+		clientDataJSON: string
+		attestationObject: string
+		transports?: string[]
+	}
+}
+
+export type TWebAuthnAssertion = {
+	id: string
+	rawId: string
+	type: string
+	response: {
+		clientDataJSON: string
+		authenticatorData: string
+		signature: string
+		userHandle?: string
+	}
+}
+
+export type TWebAuthnRegisterFinish = {
+	session_id: string
+	name?: string
+	credential: TWebAuthnAttestation
+}
+
+export type TWebAuthnLoginFinish = {
+	session_id: string
+	credential: TWebAuthnAssertion
+}
+
+export type TWebAuthnMFAFinish = TWebAuthnLoginFinish & {
+	mfa_token: string
+}
+
+export type TWebAuthnCredential = {
+	id: string
+	name: string
+	created_at: string
+	last_used_at?: string
+}
@@ -1 +1,28 @@
-export { type TAuth, type TVerifyEmail, type TResendCode } from './auth.types'
+export {
+	type TAuth,
+	type TVerifyEmail,
+	type TResendCode,
+	type TForgotPassword,
+	type TResetPassword,
+	type TChangePassword,
+	type TChangeEmail,
+	type TDeleteAccount,
+	type TExportFormat,
+	type TLoginResponse,
+	type TLogin2FA,
+	type TTOTPSetup,
+	type TTOTPConfirm,
+	type TTOTPDisable,
+	type TRecoveryCodes,
+	type TWebAuthnCredentialDescriptor,
+	type TWebAuthnCreationOptions,
+	type TWebAuthnRequestOptions,
+	type TWebAuthnRegistrationOptions,
+	type TWebAuthnLoginOptions,
+	type TWebAuthnAttestation,
+	type TWebAuthnAssertion,
+	type TWebAuthnRegisterFinish,
+	type TWebAuthnLoginFinish,
+	type TWebAuthnMFAFinish,
+	type TWebAuthnCredential,
+} from './auth.types'
@@ -0,0 +1,5 @@
+export {
+	createWebAuthnCredential,
+	getWebAuthnAssertion,
+	isWebAuthnSupported,
+} from './webauthn.utils'
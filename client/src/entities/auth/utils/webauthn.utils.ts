@@ -0,0 +1,97 @@
+import {
+	TWebAuthnAssertion,
+	TWebAuthnAttestation,
+	TWebAuthnCreationOptions,
+	TWebAuthnCredentialDescriptor,
+	TWebAuthnRequestOptions,
+} from '../types'
+
+// Сервер передает бинарные поля WebAuthn в base64url, браузер работает с ArrayBuffer
+
+const fromBase64URL = (value: string): ArrayBuffer => {
+	const base64 = value.replace(/-/g, '+').replace(/_/g, '/')
+	const binary = atob(base64.padEnd(base64.length + ((4 - (base64.length % 4)) % 4), '='))
+	const bytes = new Uint8Array(binary.length)
+	for (let i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i)
+	}
+	return bytes.buffer
+}
+
+const toBase64URL = (buffer: ArrayBuffer): string => {
+	let binary = ''
+	new Uint8Array(buffer).forEach((byte) => {
+		binary += String.fromCharCode(byte)
+	})
+	return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '')
+}
+
+const toDescriptors = (
+	descriptors: TWebAuthnCredentialDescriptor[],
+): PublicKeyCredentialDescriptor[] => {
+	return descriptors.map((descriptor) => ({
+		type: descriptor.type,
+		id: fromBase64URL(descriptor.id),
+		transports: descriptor.transports as AuthenticatorTransport[] | undefined,
+	}))
+}
+
+export const isWebAuthnSupported = (): boolean => {
+	return typeof window !== 'undefined' && !!window.PublicKeyCredential
+}
+
+export const createWebAuthnCredential = async (
+	options: TWebAuthnCreationOptions,
+): Promise<TWebAuthnAttestation> => {
+	const credential = (await navigator.credentials.create({
+		publicKey: {
+			...options,
+			challenge: fromBase64URL(options.challenge),
+			user: { ...options.user, id: fromBase64URL(options.user.id) },
+			excludeCredentials: toDescriptors(options.excludeCredentials),
+		},
+	})) as PublicKeyCredential | null
+
+	if (!credential) throw new Error('WebAuthn credential was not created')
+
+	const response = credential.response as AuthenticatorAttestationResponse
+
+	return {
+		id: credential.id,
+		rawId: toBase64URL(credential.rawId),
+		type: credential.type,
+		response: {
+			clientDataJSON: toBase64URL(response.clientDataJSON),
+			attestationObject: toBase64URL(response.attestationObject),
+			transports: response.getTransports?.(),
+		},
+	}
+}
+
+export const getWebAuthnAssertion = async (
+	options: TWebAuthnRequestOptions,
+): Promise<TWebAuthnAssertion> => {
+	const credential = (await navigator.credentials.get({
+		publicKey: {
+			...options,
+			challenge: fromBase64URL(options.challenge),
+			allowCredentials: toDescriptors(options.allowCredentials),
+		},
+	})) as PublicKeyCredential | null
+
+	if (!credential) throw new Error('WebAuthn assertion was not received')
+
+	const response = credential.response as AuthenticatorAssertionResponse
+
+	return {
+		id: credential.id,
+		rawId: toBase64URL(credential.rawId),
+		type: credential.type,
+		response: {
+			clientDataJSON: toBase64URL(response.clientDataJSON),
+			authenticatorData: toBase64URL(response.authenticatorData),
+			signature: toBase64URL(response.signature),
+			userHandle: response.userHandle ? toBase64URL(response.userHandle) : undefined,
+		},
+	}
+}
@@ -1,5 +1,10 @@
 export { RealtimeStore } from './models'
-export type { SecretEventType, SecretEventMessage, RealtimeConnectionStatus } from './types'
+export type {
+	SecretEventType,
+	SecretEvent,
+	SecretEventMessage,
+	RealtimeConnectionStatus,
+} from './types'
 export {
 	REALTIME_WS_URL,
 	SYNC_DEBOUNCE_MS,
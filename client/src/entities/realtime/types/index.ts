@@ -1,2 +1,7 @@
-export type { SecretEventType, SecretEventMessage, RealtimeConnectionStatus } from './realtime.types'
+export type {
+	SecretEventType,
+	SecretEvent,
+	SecretEventMessage,
+	RealtimeConnectionStatus,
+} from './realtime.types'
 
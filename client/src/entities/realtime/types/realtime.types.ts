@@ -1,9 +1,21 @@
-export type SecretEventType = 'secret_created' | 'secret_updated' | 'secret_deleted'
+export type SecretEventType =
+	| 'secret_created'
+	| 'secret_updated'
+	| 'secret_deleted'
+	| 'secret_restored'
+	| 'secrets_batch'
 
-export interface SecretEventMessage {
+export interface SecretEvent {
 	type: SecretEventType
 	secret_id: string
+}
+
+export interface SecretEventMessage {
+	type: SecretEventType
+	secret_id?: string
 	user_id: number
+	// Только для secrets_batch: изменения одного пакета POST /secrets/sync/push
+	events?: SecretEvent[]
 	timestamp: string
 }
 
@@ -3,21 +3,28 @@ import { useMemo, useState } from 'react'
 import { useForm } from 'react-hook-form'
 import { useTranslation } from 'react-i18next'
 
-import { TAuth } from '@entities/auth'
+import { TAuth, TResetPassword, isWebAuthnSupported } from '@entities/auth'
 
 import { StoreContextLogic, TStoreLogic, useStoreLogic } from '@shared/store'
 
 import { AuthPageView } from './auth-page.view'
+import { PasswordResetView } from './password-reset.view'
+import { TwoFactorView } from './two-factor.view'
 import { VerifyEmailView } from './verify-email.view'
 
 type TVerificationForm = {
 	code: string
 }
 
+type TTwoFactorForm = {
+	code: string
+}
+
 export const AuthPage = observer(() => {
 	const { t } = useTranslation()
 
 	const [isRegistration, setIsRegistration] = useState<boolean>(false)
+	const [isPasswordReset, setIsPasswordReset] = useState<boolean>(false)
 
 	const store = useStoreLogic<TStoreLogic>(StoreContextLogic)
 
@@ -26,15 +33,30 @@ export const AuthPage = observer(() => {
 		isRegistrationLoading, 
 		isVerifyEmailLoading, 
 		isResendCodeLoading,
+		isLogin2FALoading,
+		isWebAuthnLoading,
+		isForgotPasswordLoading,
+		isResetPasswordLoading,
 		awaitingEmailVerification,
+		awaitingPasswordReset,
+		passwordResetEmail,
+		awaitingMFA,
+		mfaMethods,
 		verificationEmail,
 		login, 
+		login2FA,
+		loginWebAuthn,
+		login2FAWebAuthn,
+		cancelMFA,
 		registration,
 		verifyEmail,
-		resendCode
+		resendCode,
+		forgotPassword,
+		resetPassword,
+		cancelPasswordReset
 	} = store.auth
 
-	const { control, handleSubmit } = useForm<TAuth>({
+	const { control, handleSubmit, getValues } = useForm<TAuth>({
 		mode: 'all',
 		defaultValues: {
 			email: '',
@@ -49,6 +71,30 @@ export const AuthPage = observer(() => {
 		},
 	})
 
+	const {
+		control: twoFactorControl,
+		handleSubmit: handleTwoFactorSubmit,
+		reset: resetTwoFactor,
+	} = useForm<TTwoFactorForm>({
+		mode: 'all',
+		defaultValues: {
+			code: '',
+		},
+	})
+
+	const {
+		control: passwordResetControl,
+		handleSubmit: handlePasswordResetSubmit,
+		reset: resetPasswordResetForm,
+	} = useForm<TResetPassword>({
+		mode: 'all',
+		defaultValues: {
+			email: '',
+			code: '',
+			password: '',
+		},
+	})
+
 	const title = useMemo(() => {
 		return t(isRegistration ? 'register' : 'login_to_system')
 	}, [isRegistration, t])
@@ -71,6 +117,10 @@ export const AuthPage = observer(() => {
 		setIsRegistration(!isRegistration)
 	}
 
+	const onPasskey = () => {
+		void loginWebAuthn(getValues('email')?.trim())
+	}
+
 	const onVerifySubmit = (data: TVerificationForm) => {
 		void verifyEmail({ email: verificationEmail, code: data.code })
 	}
@@ -81,6 +131,61 @@ export const AuthPage = observer(() => {
 		void resendCode({ email: verificationEmail })
 	}
 
+	const onTwoFactorSubmit = (data: TTwoFactorForm) => {
+		void login2FA(data.code.trim()).catch(() => resetTwoFactor())
+	}
+
+	const onTwoFactor = handleTwoFactorSubmit(onTwoFactorSubmit)
+
+	const onCancelTwoFactor = () => {
+		resetTwoFactor()
+		cancelMFA()
+	}
+
+	const onForgotPassword = () => {
+		resetPasswordResetForm({ email: getValues('email')?.trim() || '', code: '', password: '' })
+		setIsPasswordReset(true)
+	}
+
+	const onPasswordResetSubmit = (data: TResetPassword) => {
+		if (!awaitingPasswordReset) {
+			void forgotPassword({ email: data.email.trim() })
+			return
+		}
+
+		void resetPassword({ email: passwordResetEmail, code: data.code.trim(), password: data.password })
+			.then(() => {
+				resetPasswordResetForm()
+				setIsPasswordReset(false)
+			})
+			.catch(() => undefined)
+	}
+
+	const onPasswordReset = handlePasswordResetSubmit(onPasswordResetSubmit)
+
+	const onCancelPasswordReset = () => {
+		resetPasswordResetForm()
+		cancelPasswordReset()
+		setIsPasswordReset(false)
+	}
+
+	if (awaitingMFA) {
+		return (
+			<TwoFactorView
+				control={twoFactorControl}
+				loading={isLogin2FALoading}
+				codeEnabled={mfaMethods.includes('totp')}
+				webAuthn={
+					mfaMethods.includes('webauthn') && isWebAuthnSupported()
+						? { loading: isWebAuthnLoading, onClick: () => void login2FAWebAuthn() }
+						: undefined
+				}
+				onSubmit={onTwoFactor}
+				onCancel={onCancelTwoFactor}
+			/>
+		)
+	}
+
 	if (awaitingEmailVerification) {
 		return (
 			<VerifyEmailView
@@ -94,6 +199,19 @@ export const AuthPage = observer(() => {
 		)
 	}
 
+	if (isPasswordReset) {
+		return (
+			<PasswordResetView
+				control={passwordResetControl}
+				codeSent={awaitingPasswordReset}
+				email={passwordResetEmail}
+				loading={isForgotPasswordLoading || isResetPasswordLoading}
+				onSubmit={onPasswordReset}
+				onCancel={onCancelPasswordReset}
+			/>
+		)
+	}
+
 	return (
 		<AuthPageView
 			control={control}
@@ -102,6 +220,12 @@ export const AuthPage = observer(() => {
 			onLogin={onLogin}
 			loading={isLoginLoading || isRegistrationLoading}
 			redirect={{ label: redirectTitle, onClick: onRedirect }}
+			passkey={
+				!isRegistration && isWebAuthnSupported()
+					? { loading: isWebAuthnLoading, onClick: onPasskey }
+					: undefined
+			}
+			onForgotPassword={isRegistration ? undefined : onForgotPassword}
 		/>
 	)
 })
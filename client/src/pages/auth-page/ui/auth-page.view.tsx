@@ -19,6 +19,11 @@ type Props = {
 		label: string
 		onClick: () => void
 	}
+	passkey?: {
+		loading: boolean
+		onClick: () => void
+	}
+	onForgotPassword?: () => void
 }
 
 export const AuthPageView = ({
@@ -28,6 +33,8 @@ export const AuthPageView = ({
 	loading,
 	onLogin,
 	redirect,
+	passkey,
+	onForgotPassword,
 }: Props) => {
 	const { t } = useTranslation()
 
@@ -64,8 +71,31 @@ export const AuthPageView = ({
 						/>
 					</div>
 					<div className={styles.actions}>
-						<Button label={buttonTitle} type={'submit'} loading={loading} />
+						<Button
+							label={buttonTitle}
+							type={'submit'}
+							loading={loading}
+							disabled={passkey?.loading}
+						/>
+						{passkey && (
+							<Button
+								label={t('login_with_passkey')}
+								type={'button'}
+								onClick={passkey.onClick}
+								loading={passkey.loading}
+								disabled={loading}
+							/>
+						)}
 						<div className={styles.redirect}>
+							{onForgotPassword && (
+								<Button
+									label={t('forgot_password')}
+									link
+									onClick={onForgotPassword}
+									type={'button'}
+									disabled={loading}
+								/>
+							)}
 							<Button
 								label={redirect.label}
 								link
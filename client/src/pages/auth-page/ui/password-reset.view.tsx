@@ -0,0 +1,118 @@
+import { Control } from 'react-hook-form'
+import { useTranslation } from 'react-i18next'
+
+import { TResetPassword } from '@entities/auth'
+
+import { InputPasswordField } from '@shared/reused/input-password-field'
+import { InputTextField } from '@shared/reused/input-text-field'
+import { Button } from '@shared/uikit/button'
+
+import styles from './auth-page.module.sass'
+
+type Props = {
+	control: Control<TResetPassword>
+	// codeSent - код уже отправлен: вместо email запрашиваются код и новый пароль
+	codeSent: boolean
+	email: string
+	loading: boolean
+	onSubmit: () => void
+	onCancel: () => void
+}
+
+export const PasswordResetView = ({
+	control,
+	codeSent,
+	email,
+	loading,
+	onSubmit,
+	onCancel,
+}: Props) => {
+	const { t } = useTranslation()
+
+	return (
+		<div className={styles.root}>
+			<div className={styles.form}>
+				<span className={styles.form_title}>{t('password_reset')}</span>
+				<p className={styles.form_description}>
+					{codeSent ? `${t('password_reset_code_sent_to')} ${email}` : t('password_reset_hint')}
+				</p>
+				<form className={styles.form_content} onSubmit={onSubmit} noValidate>
+					<div className={styles.form_data}>
+						{codeSent ? (
+							<>
+								<InputTextField<TResetPassword>
+									control={control}
+									name="code"
+									label={t('verification_code')}
+									rules={{
+										validate: (value) => {
+											if (value && value.trim() !== '') {
+												const codeRegex = /^\d{6}$/
+												return (
+													codeRegex.test(value.trim()) ||
+													t('validation_error.invalid_code_format')
+												)
+											}
+											return true
+										},
+									}}
+									required
+									disabled={loading}
+									placeholder="123456"
+								/>
+								<InputPasswordField<TResetPassword>
+									control={control}
+									name="password"
+									label={t('new_password')}
+									rules={{
+										validate: (value) =>
+											!value ||
+											value.length >= 6 ||
+											t('validation_error.password_too_short'),
+									}}
+									required
+									disabled={loading}
+								/>
+							</>
+						) : (
+							<InputTextField<TResetPassword>
+								control={control}
+								name="email"
+								label={t('email')}
+								rules={{
+									validate: (value) => {
+										if (value && value.trim() !== '') {
+											const emailRegex = /^[A-Z0-9._%+-]+@[A-Z0-9.-]+\.[A-Z]{2,}$/i
+											return (
+												emailRegex.test(value) || t('validation_error.invalid_email_format')
+											)
+										}
+										return true
+									},
+								}}
+								required
+								disabled={loading}
+							/>
+						)}
+					</div>
+					<div className={styles.actions}>
+						<Button
+							label={t(codeSent ? 'reset_password' : 'send_code')}
+							type={'submit'}
+							loading={loading}
+						/>
+						<div className={styles.redirect}>
+							<Button
+								label={t('back_to_login')}
+								link
+								onClick={onCancel}
+								type={'button'}
+								disabled={loading}
+							/>
+						</div>
+					</div>
+				</form>
+			</div>
+		</div>
+	)
+}
@@ -0,0 +1,102 @@
+import { Control } from 'react-hook-form'
+import { useTranslation } from 'react-i18next'
+
+import { InputTextField } from '@shared/reused/input-text-field'
+import { Button } from '@shared/uikit/button'
+
+import styles from './auth-page.module.sass'
+
+type TTwoFactorForm = {
+	code: string
+}
+
+type Props = {
+	control: Control<TTwoFactorForm>
+	loading: boolean
+	// codeEnabled - подключен ли TOTP: без него вход подтверждается только ключом
+	codeEnabled: boolean
+	webAuthn?: {
+		loading: boolean
+		onClick: () => void
+	}
+	onSubmit: () => void
+	onCancel: () => void
+}
+
+export const TwoFactorView = ({
+	control,
+	loading,
+	codeEnabled,
+	webAuthn,
+	onSubmit,
+	onCancel,
+}: Props) => {
+	const { t } = useTranslation()
+
+	const disabled = loading || !!webAuthn?.loading
+
+	return (
+		<div className={styles.root}>
+			<div className={styles.form}>
+				<span className={styles.form_title}>{t('two_factor_auth')}</span>
+				<p className={styles.form_description}>
+					{t(codeEnabled ? 'two_factor_hint' : 'two_factor_security_key_hint')}
+				</p>
+				<form className={styles.form_content} onSubmit={onSubmit} noValidate>
+					{codeEnabled && (
+						<div className={styles.form_data}>
+							<InputTextField<TTwoFactorForm>
+								control={control}
+								name="code"
+								label={t('two_factor_code')}
+								rules={{
+									validate: (value) => {
+										if (value && value.trim() !== '') {
+											const codeRegex = /^(\d{3} ?\d{3}|[a-z0-9]{5}-?[a-z0-9]{5})$/i
+											return (
+												codeRegex.test(value.trim()) ||
+												t('validation_error.invalid_two_factor_code_format')
+											)
+										}
+										return true
+									},
+								}}
+								required
+								disabled={disabled}
+								placeholder="123456"
+							/>
+						</div>
+					)}
+					<div className={styles.actions}>
+						{codeEnabled && (
+							<Button
+								label={t('verify')}
+								type={'submit'}
+								loading={loading}
+								disabled={webAuthn?.loading}
+							/>
+						)}
+						{webAuthn && (
+							<Button
+								label={t('use_security_key')}
+								type={'button'}
+								onClick={webAuthn.onClick}
+								loading={webAuthn.loading}
+								disabled={loading}
+							/>
+						)}
+						<div className={styles.redirect}>
+							<Button
+								label={t('back_to_login')}
+								link
+								onClick={onCancel}
+								type={'button'}
+								disabled={disabled}
+							/>
+						</div>
+					</div>
+				</form>
+			</div>
+		</div>
+	)
+}
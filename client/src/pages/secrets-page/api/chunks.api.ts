@@ -20,6 +20,7 @@ export type TUploadChunkRequest = {
 	chunkIndex: number
 	totalChunks: number
 	data: string
+	checksum?: string
 }
 
 export type TFinalizeChunkedUploadRequest = {
@@ -28,6 +29,7 @@ export type TFinalizeChunkedUploadRequest = {
 	password: string
 	metadata?: Record<string, string>
 	version?: number
+	checksum?: string
 }
 
 export const initChunkedUploadApi = (
@@ -53,7 +55,7 @@ export const finalizeChunkedUploadApi = (
 export const downloadChunkApi = (
 	secretId: string,
 	chunkIndex: number,
-): Promise<IResponse<{ chunkIndex: number; data: string; totalChunks: number }>> => {
+): Promise<IResponse<{ chunkIndex: number; data: string; totalChunks: number; checksum?: string }>> => {
 	return api.get(`${SECRETS_URL.BASE}/${secretId}/chunks/${chunkIndex}`)
 }
 
@@ -4,6 +4,8 @@ import { IResponse } from '@shared/types'
 import { SECRETS_URL } from '../constants/api.constants'
 import {
 	TCreateSecretRequest,
+	TSecretListParams,
+	TSecretListResponse,
 	TSecretResponse,
 	TSyncResponse,
 	TUpdateSecretRequest,
@@ -15,8 +17,11 @@ export const createSecretApi = (
 	return api.post(SECRETS_URL.BASE, data)
 }
 
-export const getSecretsApi = (): Promise<IResponse<TSecretResponse[]>> => {
-	return api.get(SECRETS_URL.BASE)
+export const getSecretsApi = (
+	params?: TSecretListParams,
+): Promise<IResponse<TSecretListResponse>> => {
+	// Сервер ожидает повторяющийся параметр: tag=a&tag=b
+	return api.get(SECRETS_URL.BASE, { params, paramsSerializer: { indexes: null } })
 }
 
 export const getSecretApi = (id: string): Promise<IResponse<TSecretResponse>> => {
@@ -34,9 +39,9 @@ export const deleteSecretApi = (id: string): Promise<IResponse<null>> => {
 	return api.delete(SECRETS_URL.BY_ID(id))
 }
 
-export const syncSecretsApi = (since?: string): Promise<IResponse<TSyncResponse>> => {
-	const url = since
-		? `${SECRETS_URL.SYNC}?since=${encodeURIComponent(since)}`
+export const syncSecretsApi = (cursor?: string): Promise<IResponse<TSyncResponse>> => {
+	const url = cursor
+		? `${SECRETS_URL.SYNC}?cursor=${encodeURIComponent(cursor)}`
 		: SECRETS_URL.SYNC
 	return api.get(url)
 }
@@ -34,7 +34,7 @@ export class SecretsPageStore {
 	secrets: TSecret[] = []
 
 	syncStatus: 'idle' | 'syncing' | 'error' = 'idle'
-	lastSyncTime: string | null = null
+	syncCursor: string | null = null
 	lastSyncDate: Date | null = null
 	unsyncedCount = 0
 
@@ -419,7 +419,15 @@ export class SecretsPageStore {
 							syncStatus: 'synced',
 						})
 					} else {
-						const response = await createSecretApi(this.secretToCreateRequest(secret))
+						const response = await createSecretApi(this.secretToCreateRequest(secret)).catch(
+							(error) => {
+								// Секрет с этим ID уже создан: предыдущая отправка дошла, но ответ потерялся
+								if (axios.isAxiosError(error) && error.response?.status === StatusCodes.CONFLICT) {
+									return getSecretApi(secret.localId)
+								}
+								throw error
+							},
+						)
 						await db.secrets.put({
 							...secret,
 							id: response.data.id,
@@ -481,17 +489,21 @@ export class SecretsPageStore {
 
 	private async pullServerChanges() {
 		try {
-			const response = await syncSecretsApi(this.lastSyncTime || undefined)
+			let hasMore = true
+			while (hasMore) {
+				const response = await syncSecretsApi(this.syncCursor || undefined)
 
-			for (const serverSecret of response.data.secrets) {
-				await this.applyServerSecret(serverSecret)
-			}
+				for (const serverSecret of response.data.secrets) {
+					await this.applyServerSecret(serverSecret)
+				}
 
-			runInAction(() => {
-				this.lastSyncTime = response.data.server_time
-			})
+				runInAction(() => {
+					this.syncCursor = response.data.next_cursor
+				})
 
-			await this.saveLastSyncTime(response.data.server_time)
+				await this.saveSyncCursor(response.data.next_cursor)
+				hasMore = response.data.has_more
+			}
 		} catch (error) {
 			console.error(i18next.t('secrets.receive_error'), error)
 			throw error
@@ -585,12 +597,12 @@ export class SecretsPageStore {
 		})
 	}
 
-	private async loadLastSyncTime() {
+	private async loadSyncCursor() {
 		try {
-			const meta = await db.syncMeta.get('lastSyncTime')
+			const meta = await db.syncMeta.get('syncCursor')
 			if (meta) {
 				runInAction(() => {
-					this.lastSyncTime = meta.value
+					this.syncCursor = meta.value
 				})
 			}
 		} catch (error) {
@@ -598,9 +610,9 @@ export class SecretsPageStore {
 		}
 	}
 
-	private async saveLastSyncTime(time: string) {
+	private async saveSyncCursor(cursor: string) {
 		try {
-			await db.syncMeta.put({ key: 'lastSyncTime', value: time })
+			await db.syncMeta.put({ key: 'syncCursor', value: cursor })
 		} catch (error) {
 			console.error(i18next.t('secrets.save_sync_time_error'), error)
 		}
@@ -608,6 +620,7 @@ export class SecretsPageStore {
 
 	private secretToCreateRequest(secret: TSecret): TCreateSecretRequest {
 		return {
+			id: secret.localId,
 			login: secret.login,
 			password: secret.password,
 			metadata: secret.metadata,
@@ -812,7 +825,7 @@ export class SecretsPageStore {
 		await this.loadSecrets()
 		await this.updateUnsyncedCount()
 
-		await this.loadLastSyncTime()
+		await this.loadSyncCursor()
 
 		if (this.canSync()) {
 			await this.sync().catch((error) => {
@@ -1041,7 +1054,7 @@ export class SecretsPageStore {
 
 		this.secrets = []
 		this.syncStatus = 'idle'
-		this.lastSyncTime = null
+		this.syncCursor = null
 		this.lastSyncDate = null
 		this.unsyncedCount = 0
 		this.isLoading = false
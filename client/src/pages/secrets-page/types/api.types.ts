@@ -5,17 +5,73 @@ export type TSecretResponse = {
 	metadata?: Record<string, string>
 	binary_data?: string
 	binary_data_size?: number
+	checksum?: string
+	folder_id?: string
+	tags?: string[]
+	shared?: TSharedAccess
 	version: number
 	created_at: string
 	updated_at: string
 	deleted_at?: string
 }
 
+export type TSharePermission = 'read' | 'write'
+
+export type TSharedAccess = {
+	owner_email: string
+	permission: TSharePermission
+	wrapped_key: string
+}
+
+export type TShareSecretRequest = {
+	email: string
+	permission?: TSharePermission
+	wrapped_key: string
+}
+
+export type TShareResponse = {
+	grantee_id: number
+	email: string
+	permission: TSharePermission
+	created_at: string
+	updated_at: string
+}
+
+export type TKeyAlgorithm = 'x25519' | 'rsa-oaep'
+
+export type TPutKeysRequest = {
+	algorithm: TKeyAlgorithm
+	public_key: string
+	encrypted_private_key: string
+}
+
+export type TUserKeyResponse = {
+	key_id: string
+	algorithm: TKeyAlgorithm
+	public_key: string
+	encrypted_private_key: string
+	current: boolean
+	created_at: string
+	updated_at: string
+	rotated_at?: string
+}
+
+export type TPublicKeyResponse = {
+	key_id: string
+	email: string
+	algorithm: TKeyAlgorithm
+	public_key: string
+	created_at: string
+	rotated_at?: string
+}
+
 export type TCreateSecretRequest = {
+	id?: string
 	login: string
 	password: string
 	metadata?: Record<string, string>
 	binary_data?: string
+	folder_id?: string
 }
 
 export type TUpdateSecretRequest = {
@@ -24,10 +80,77 @@ export type TUpdateSecretRequest = {
 	metadata?: Record<string, string>
 	binary_data?: string
 	version: number
+	merge?: boolean
+}
+
+export type TMergeConflictResponse = {
+	error: string
+	conflicts: string[]
+	current: TSecretResponse
+}
+
+export type TPushOperation = {
+	client_id: string
+	action: 'create' | 'update' | 'delete'
+	secret_id?: string
+	base_version?: number
+	login?: string
+	password?: string
+	metadata?: Record<string, string>
+	binary_data?: string
+}
+
+export type TPushResult = {
+	client_id: string
+	status: 'applied' | 'conflict' | 'not_found' | 'invalid'
+	secret?: TSecretResponse
+	error?: string
+}
+
+export type TPushResponse = {
+	results: TPushResult[]
+}
+
+export type TSecretListResponse = {
+	secrets: TSecretResponse[]
+	next_cursor?: string
+	has_more: boolean
+}
+
+export type TSecretListParams = {
+	type?: string
+	sort?: 'created' | 'updated' | 'login'
+	order?: 'asc' | 'desc'
+	limit?: number
+	cursor?: string
+	tag?: string[]
+	tag_match?: 'any' | 'all'
+}
+
+export type TFolderResponse = {
+	id: string
+	parent_id?: string
+	name: string
+	version: number
+	created_at: string
+	updated_at: string
+	deleted_at?: string
+}
+
+export type TTagResponse = {
+	id: string
+	name: string
+	version: number
+	created_at: string
+	updated_at: string
+	deleted_at?: string
 }
 
 export type TSyncResponse = {
 	secrets: TSecretResponse[]
-	server_time: string
+	folders: TFolderResponse[]
+	tags: TTagResponse[]
+	next_cursor: string
+	has_more: boolean
 }
 
@@ -19,6 +19,20 @@ export const ru = {
 	verification_code_sent_to: 'Код подтверждения отправлен на',
 	verify: 'Подтвердить',
 	resend_code: 'Отправить код повторно',
+	two_factor_auth: 'Двухфакторная аутентификация',
+	two_factor_hint: 'Введите код из приложения-аутентификатора или один из кодов восстановления',
+	two_factor_code: 'Код',
+	back_to_login: 'Вернуться ко входу',
+	two_factor_security_key_hint: 'Подтвердите вход ключом безопасности',
+	use_security_key: 'Использовать ключ безопасности',
+	login_with_passkey: 'Войти с passkey',
+	forgot_password: 'Забыли пароль?',
+	password_reset: 'Сброс пароля',
+	password_reset_hint: 'Введите email, и мы отправим код для сброса пароля',
+	password_reset_code_sent_to: 'Если аккаунт существует, код сброса отправлен на',
+	send_code: 'Отправить код',
+	new_password: 'Новый пароль',
+	reset_password: 'Сменить пароль',
 	crypto_key: 'Ключ шифрования',
 	enter_crypto_key: 'Введите ключ шифрования или сгенерируйте новый',
 	no_crypto_key: 'Нет ключа шифрования',
@@ -39,6 +53,8 @@ export const ru = {
 		required_field: 'Поле не может быть пустым',
 		invalid_email_format: 'Неверный формат email',
 		invalid_code_format: 'Код должен состоять из 6 цифр',
+		password_too_short: 'Пароль должен содержать минимум 6 символов',
+		invalid_two_factor_code_format: 'Введите 6 цифр или код восстановления вида xxxxx-xxxxx',
 	},
 	realtime: {
 		error_parsing_message: '[Realtime] Ошибка парсинга сообщения',
@@ -68,8 +84,8 @@ export const ru = {
 		sync_error: 'Ошибка синхронизации:',
 		send_error: 'Ошибка отправки секрета на сервер:',
 		receive_error: 'Ошибка получения данных с сервера:',
-		load_sync_time_error: 'Ошибка загрузки lastSyncTime:',
-		save_sync_time_error: 'Ошибка сохранения lastSyncTime:',
+		load_sync_time_error: 'Ошибка загрузки курсора синхронизации:',
+		save_sync_time_error: 'Ошибка сохранения курсора синхронизации:',
 		sync_init_error: 'Не удалось синхронизировать при инициализации:',
 		unknown_error: 'Неизвестная ошибка',
 		select_file: 'Выберите файл',
@@ -8,16 +8,21 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Adigezalov/goph-keeper/internal/account"
+	"github.com/Adigezalov/goph-keeper/internal/blobstore"
 	"github.com/Adigezalov/goph-keeper/internal/config"
 	"github.com/Adigezalov/goph-keeper/internal/email"
 	"github.com/Adigezalov/goph-keeper/internal/emailworker"
+	"github.com/Adigezalov/goph-keeper/internal/folder"
 	"github.com/Adigezalov/goph-keeper/internal/health"
+	"github.com/Adigezalov/goph-keeper/internal/idempotency"
 	"github.com/Adigezalov/goph-keeper/internal/localization"
 	"github.com/Adigezalov/goph-keeper/internal/logger"
 	"github.com/Adigezalov/goph-keeper/internal/middleware"
 	"github.com/Adigezalov/goph-keeper/internal/realtime"
 	"github.com/Adigezalov/goph-keeper/internal/repositories"
 	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
 	"github.com/Adigezalov/goph-keeper/internal/tokens"
 	"github.com/Adigezalov/goph-keeper/internal/user"
 	"github.com/Adigezalov/goph-keeper/internal/verification"
@@ -55,6 +60,7 @@ func main() {
 	logger.Infof("Refresh Token TTL: %v", cfg.RefreshTokenTTL)
 	logger.Infof("Verification Code TTL: %v", cfg.VerificationCodeTTL)
 	logger.Infof("SMTP Host: %s:%s", cfg.SMTPHost, cfg.SMTPPort)
+	logger.Infof("Idempotency Key TTL: %v", cfg.IdempotencyKeyTTL)
 
 	dbRepo, err := repositories.NewDatabaseRepository(cfg.DatabaseURI)
 	if err != nil {
@@ -77,7 +83,8 @@ func main() {
 			}
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-ID")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Session-ID, Idempotency-Key, If-Match, If-None-Match")
+			w.Header().Set("Access-Control-Expose-Headers", "Idempotent-Replayed, ETag")
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 			if isWebSocket {
@@ -143,34 +150,151 @@ func main() {
 			verificationRepo,
 			cfg.VerificationCodeTTL,
 		)
+		if err := userService.SetTOTPKey(cfg.TOTPKey); err != nil {
+			logger.Fatalf("Ошибка инициализации ключа TOTP: %v", err)
+		}
+		if err := userService.SetWebAuthn(user.WebAuthnConfig{RPID: cfg.WebAuthnRPID, Origins: cfg.WebAuthnOrigins}); err != nil {
+			logger.Fatalf("Ошибка настройки WebAuthn: %v", err)
+		}
+
 		userHandler := user.NewHandler(userService, cfg.RefreshTokenTTL)
 		userRoutes := api.PathPrefix("/v1/user").Subrouter()
 
 		userRoutes.HandleFunc("/register", userHandler.Register).Methods("POST")
 		userRoutes.HandleFunc("/verify-email", userHandler.VerifyEmail).Methods("POST")
 		userRoutes.HandleFunc("/resend-code", userHandler.ResendCode).Methods("POST")
+		userRoutes.HandleFunc("/password/forgot", userHandler.ForgotPassword).Methods("POST")
+		userRoutes.HandleFunc("/password/reset", userHandler.ResetPassword).Methods("POST")
 		userRoutes.HandleFunc("/login", userHandler.Login).Methods("POST")
+		userRoutes.HandleFunc("/login/2fa", userHandler.Login2FA).Methods("POST")
+		userRoutes.HandleFunc("/login/2fa/webauthn/begin", userHandler.WebAuthnMFABegin).Methods("POST")
+		userRoutes.HandleFunc("/login/2fa/webauthn/finish", userHandler.WebAuthnMFAFinish).Methods("POST")
+		userRoutes.HandleFunc("/login/webauthn/begin", userHandler.WebAuthnLoginBegin).Methods("POST")
+		userRoutes.HandleFunc("/login/webauthn/finish", userHandler.WebAuthnLoginFinish).Methods("POST")
 		userRoutes.HandleFunc("/refresh", userHandler.Refresh).Methods("GET")
 		userRoutes.HandleFunc("/logout", userHandler.Logout).Methods("GET")
 		userRoutes.HandleFunc("/logout-all", authMiddleware.RequireAuth(userHandler.LogoutAll)).Methods("GET")
+		userRoutes.HandleFunc("/password", authMiddleware.RequireAuth(userHandler.ChangePassword)).Methods("PUT")
+		userRoutes.HandleFunc("/email", authMiddleware.RequireAuth(userHandler.ChangeEmail)).Methods("PUT")
+		userRoutes.HandleFunc("/email/confirm", authMiddleware.RequireAuth(userHandler.ConfirmEmailChange)).Methods("POST")
+		userRoutes.HandleFunc("/delete/code", authMiddleware.RequireAuth(userHandler.RequestAccountDeletion)).Methods("POST")
+		userRoutes.HandleFunc("/keys", authMiddleware.RequireAuth(userHandler.PutKeys)).Methods("PUT")
+		userRoutes.HandleFunc("/keys/me", authMiddleware.RequireAuth(userHandler.MyKeys)).Methods("GET")
+		userRoutes.HandleFunc("/2fa/totp/setup", authMiddleware.RequireAuth(userHandler.TOTPSetup)).Methods("POST")
+		userRoutes.HandleFunc("/2fa/totp/confirm", authMiddleware.RequireAuth(userHandler.TOTPConfirm)).Methods("POST")
+		userRoutes.HandleFunc("/2fa/totp/disable", authMiddleware.RequireAuth(userHandler.TOTPDisable)).Methods("POST")
+		userRoutes.HandleFunc("/webauthn/register/begin", authMiddleware.RequireAuth(userHandler.WebAuthnRegisterBegin)).Methods("POST")
+		userRoutes.HandleFunc("/webauthn/register/finish", authMiddleware.RequireAuth(userHandler.WebAuthnRegisterFinish)).Methods("POST")
+		userRoutes.HandleFunc("/webauthn/credentials", authMiddleware.RequireAuth(userHandler.WebAuthnCredentials)).Methods("GET")
+		userRoutes.HandleFunc("/webauthn/credentials/{id}", authMiddleware.RequireAuth(userHandler.WebAuthnDeleteCredential)).Methods("DELETE")
+		userRoutes.HandleFunc("/webauthn/confirm/begin", authMiddleware.RequireAuth(userHandler.WebAuthnConfirmBegin)).Methods("POST")
+
+		usersRoutes := api.PathPrefix("/v1/users").Subrouter()
+		usersRoutes.HandleFunc("/{email}/public-key", authMiddleware.RequireAuth(userHandler.PublicKey)).Methods("GET")
+
+		blobStore, err := newBlobStore(cfg)
+		if err != nil {
+			logger.Fatalf("Ошибка инициализации хранилища бинарных данных: %v", err)
+		}
+
+		secretRepo := secret.NewDatabaseRepository(dbRepo.GetDB(), blobStore)
+
+		// Файлы, сохраненные до появления внешнего хранилища, переносятся из binary_data
+		migrated, err := secretRepo.MigrateBinaryData()
+		if err != nil {
+			logger.Fatalf("Ошибка переноса бинарных данных в хранилище: %v", err)
+		}
+		if migrated > 0 {
+			logger.Infof("Перенесено в хранилище бинарных данных: %d записей", migrated)
+		}
+
+		folderRepo := folder.NewDatabaseRepository(dbRepo.GetDB())
+		folderService := folder.NewService(folderRepo)
+		folderService.SetRealtimeService(realtimeService)
+		folderHandler := folder.NewHandler(folderService)
+
+		tagRepo := tag.NewDatabaseRepository(dbRepo.GetDB())
+		tagService := tag.NewService(tagRepo)
+		tagService.SetRealtimeService(realtimeService)
+		tagHandler := tag.NewHandler(tagService)
 
-		secretRepo := secret.NewDatabaseRepository(dbRepo.GetDB())
 		secretService := secret.NewService(secretRepo)
 		secretService.SetRealtimeService(realtimeService)
-		secretHandler := secret.NewHandler(secretService)
+		secretService.SetFolderFeed(folderRepo)
+		secretService.SetTagFeed(tagRepo)
+		secretService.SetVersionsLimit(cfg.SecretVersionsLimit)
+		chunkedUploadService := secret.NewChunkedUploadService(secret.NewDatabaseUploadStore(dbRepo.GetDB()))
+		chunkedUploadService.Start()
+		defer chunkedUploadService.Stop()
+		secretHandler := secret.NewHandler(secretService, chunkedUploadService)
+
+		// Выгрузка и удаление аккаунта затрагивают все разделы, поэтому собираются после них
+		accountService := account.NewService(account.NewDatabaseRepository(dbRepo.GetDB()), userService, secretRepo, folderRepo, tagRepo)
+		accountService.SetRealtimeService(realtimeService)
+		accountHandler := account.NewHandler(accountService)
+
+		userRoutes.HandleFunc("", authMiddleware.RequireAuth(accountHandler.Delete)).Methods("DELETE")
+		userRoutes.HandleFunc("/export", authMiddleware.RequireAuth(accountHandler.Export)).Methods("GET")
+
+		// Устройство, не синхронизировавшееся дольше жизни refresh токена, не удерживает надгробия
+		trashPurger := secret.NewPurger(secretRepo, cfg.TrashRetention, cfg.RefreshTokenTTL, cfg.TrashPurgeInterval)
+		trashPurger.AddTombstonePurger(folderRepo)
+		trashPurger.AddTombstonePurger(tagRepo)
+		trashPurger.Start()
+		defer trashPurger.Stop()
+
+		// Изменяющие запросы с заголовком Idempotency-Key выполняются один раз, повтор получает сохраненный ответ
+		idempotencyStore := idempotency.NewDatabaseStore(dbRepo.GetDB())
+		idempotent := idempotency.NewMiddleware(idempotencyStore, cfg.IdempotencyKeyTTL).Wrap
+
+		idempotencyPurger := idempotency.NewPurger(idempotencyStore, cfg.IdempotencyKeyTTL, idempotency.PurgeInterval)
+		idempotencyPurger.Start()
+		defer idempotencyPurger.Stop()
+
 		secretRoutes := api.PathPrefix("/v1/secrets").Subrouter()
 
 		secretRoutes.HandleFunc("", authMiddleware.RequireAuth(secretHandler.GetAll)).Methods("GET")
-		secretRoutes.HandleFunc("", authMiddleware.RequireAuth(secretHandler.Create)).Methods("POST")
+		secretRoutes.HandleFunc("", authMiddleware.RequireAuth(idempotent(secretHandler.Create))).Methods("POST")
 		secretRoutes.HandleFunc("/sync", authMiddleware.RequireAuth(secretHandler.Sync)).Methods("GET")
+		secretRoutes.HandleFunc("/sync/push", authMiddleware.RequireAuth(idempotent(secretHandler.Push))).Methods("POST")
+		secretRoutes.HandleFunc("/trash", authMiddleware.RequireAuth(secretHandler.Trash)).Methods("GET")
 		secretRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(secretHandler.Get)).Methods("GET")
-		secretRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(secretHandler.Update)).Methods("PUT")
-		secretRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(secretHandler.Delete)).Methods("DELETE")
-
-		secretRoutes.HandleFunc("/chunks/init", authMiddleware.RequireAuth(secretHandler.InitChunkedUpload)).Methods("POST")
-		secretRoutes.HandleFunc("/{id}/chunks", authMiddleware.RequireAuth(secretHandler.UploadChunk)).Methods("POST")
-		secretRoutes.HandleFunc("/{id}/chunks/finalize", authMiddleware.RequireAuth(secretHandler.FinalizeChunkedUpload)).Methods("POST")
+		secretRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(secretHandler.Update))).Methods("PUT")
+		secretRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(secretHandler.Patch))).Methods("PATCH")
+		secretRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(secretHandler.Delete))).Methods("DELETE")
+		secretRoutes.HandleFunc("/{id}/restore", authMiddleware.RequireAuth(idempotent(secretHandler.Restore))).Methods("POST")
+		secretRoutes.HandleFunc("/{id}/versions", authMiddleware.RequireAuth(secretHandler.ListVersions)).Methods("GET")
+		secretRoutes.HandleFunc("/{id}/versions/{version}", authMiddleware.RequireAuth(secretHandler.GetVersion)).Methods("GET")
+		secretRoutes.HandleFunc("/{id}/versions/{version}/restore", authMiddleware.RequireAuth(idempotent(secretHandler.RestoreVersion))).Methods("POST")
+		secretRoutes.HandleFunc("/{id}/shares", authMiddleware.RequireAuth(secretHandler.ListShares)).Methods("GET")
+		secretRoutes.HandleFunc("/{id}/shares", authMiddleware.RequireAuth(idempotent(secretHandler.Share))).Methods("PUT")
+		secretRoutes.HandleFunc("/{id}/shares/{userId}", authMiddleware.RequireAuth(idempotent(secretHandler.RevokeShare))).Methods("DELETE")
+
+		secretRoutes.HandleFunc("/chunks/init", authMiddleware.RequireAuth(idempotent(secretHandler.InitChunkedUpload))).Methods("POST")
+		secretRoutes.HandleFunc("/{id}/chunks", authMiddleware.RequireAuth(idempotent(secretHandler.UploadChunk))).Methods("POST")
+		secretRoutes.HandleFunc("/{id}/chunks/finalize", authMiddleware.RequireAuth(idempotent(secretHandler.FinalizeChunkedUpload))).Methods("POST")
+		secretRoutes.HandleFunc("/{id}/chunks/status", authMiddleware.RequireAuth(secretHandler.ChunkStatus)).Methods("GET")
 		secretRoutes.HandleFunc("/{id}/chunks/{chunkIndex}", authMiddleware.RequireAuth(secretHandler.DownloadChunk)).Methods("GET")
+
+		secretRoutes.HandleFunc("/{id}/blob", authMiddleware.RequireAuth(idempotent(secretHandler.UploadBlob))).Methods("PUT")
+		secretRoutes.HandleFunc("/{id}/blob", authMiddleware.RequireAuth(secretHandler.DownloadBlob)).Methods("GET")
+
+		folderRoutes := api.PathPrefix("/v1/folders").Subrouter()
+
+		folderRoutes.HandleFunc("", authMiddleware.RequireAuth(folderHandler.List)).Methods("GET")
+		folderRoutes.HandleFunc("", authMiddleware.RequireAuth(idempotent(folderHandler.Create))).Methods("POST")
+		folderRoutes.HandleFunc("/move", authMiddleware.RequireAuth(idempotent(folderHandler.Move))).Methods("POST")
+		folderRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(folderHandler.Get)).Methods("GET")
+		folderRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(folderHandler.Update))).Methods("PUT")
+		folderRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(folderHandler.Delete))).Methods("DELETE")
+
+		tagRoutes := api.PathPrefix("/v1/tags").Subrouter()
+
+		tagRoutes.HandleFunc("", authMiddleware.RequireAuth(tagHandler.List)).Methods("GET")
+		tagRoutes.HandleFunc("", authMiddleware.RequireAuth(idempotent(tagHandler.Create))).Methods("POST")
+		tagRoutes.HandleFunc("/assign", authMiddleware.RequireAuth(idempotent(tagHandler.Assign))).Methods("POST")
+		tagRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(tagHandler.Rename))).Methods("PUT")
+		tagRoutes.HandleFunc("/{id}", authMiddleware.RequireAuth(idempotent(tagHandler.Delete))).Methods("DELETE")
 	}
 
 	// Swagger UI
@@ -205,3 +329,31 @@ func main() {
 		logger.Info("Сервер успешно остановлен")
 	}
 }
+
+// newBlobStore создает хранилище бинарных данных секретов, выбранное в BLOB_STORE
+func newBlobStore(cfg *config.Config) (secret.BlobStore, error) {
+	if cfg.BlobStore == "s3" {
+		store, err := blobstore.NewS3Store(blobstore.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := store.EnsureBucket(); err != nil {
+			return nil, err
+		}
+		logger.Infof("Бинарные данные хранятся в S3: %s/%s", cfg.S3Endpoint, cfg.S3Bucket)
+		return store, nil
+	}
+
+	store, err := blobstore.NewFileStore(cfg.BlobDir)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Бинарные данные хранятся в каталоге %s", cfg.BlobDir)
+	return store, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Adigezalov/goph-keeper/internal/cli"
+)
+
+// Значения подставляются при сборке:
+// go build -ldflags "-X main.version=1.0.0 -X main.buildDate=$(date -u +%Y-%m-%d)" ./cmd/keeper-cli
+var (
+	version   = "dev"
+	buildDate = "unknown"
+)
+
+func main() {
+	app := cli.NewApp(version, buildDate, os.Stdout, os.Stderr)
+
+	if err := app.Run(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Ошибка:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,17 @@
+package account
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidExportFormat = errors.New("account.invalid_export_format")
+)
+
+func WrapError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,240 @@
+package account
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+	"github.com/Adigezalov/goph-keeper/internal/utils"
+)
+
+type AccountService interface {
+	Export(userID int) (*Export, error)
+	ExportSecrets(userID int, fn func(*secret.Secret) error) error
+	OpenBlob(ref string) (io.ReadCloser, error)
+	DeleteAccount(userID int, req *user.DeleteAccountRequest) error
+}
+
+type Handler struct {
+	service AccountService
+}
+
+func NewHandler(service AccountService) *Handler {
+	return &Handler{service: service}
+}
+
+// Export godoc
+// @Summary Выгрузка данных пользователя
+// @Description Отдает профиль, папки, метки, события аккаунта и секреты (в том виде, в каком их зашифровал клиент). Секреты пишутся потоком полем secrets после остальных. format=zip кладет бинарные данные секретов в архив отдельными файлами. Отдельного журнала действий сервер не ведет: события восстанавливаются по хранящимся записям, действий с уже удаленными записями в выгрузке нет
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Produce application/zip
+// @Param format query string false "json (по умолчанию) или zip"
+// @Success 200 {object} Export
+// @Failure 400 {object} map[string]string "Неизвестный формат"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/export [get]
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	format := ExportFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = ExportFormatJSON
+	}
+	if !format.IsValid() {
+		localization.LocalizedError(w, r, http.StatusBadRequest, ErrInvalidExportFormat.Error(), nil)
+		return
+	}
+
+	export, err := h.service.Export(userID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+			return
+		}
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Account] Ошибка выгрузки данных")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	// Ответ уже начат: ошибку записи можно только залогировать
+	if format == ExportFormatZip {
+		err = h.writeZipExport(w, userID, export)
+	} else {
+		err = h.writeJSONExport(w, userID, export)
+	}
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"format":  format,
+			"error":   err.Error(),
+		}).Error("[Account] Ошибка отправки выгрузки")
+	}
+}
+
+// Delete godoc
+// @Summary Удаление аккаунта
+// @Description Удаляет аккаунт по паролю и коду из письма (POST /user/delete/code) одной транзакцией: секреты с бинарными данными, токены, коды и остальные данные пользователя. Получатели доступа к секретам получают надгробия, realtime подключения пользователя закрываются
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Param request body user.DeleteAccountRequest true "Пароль и код из письма"
+// @Success 204 "Аккаунт удален"
+// @Failure 400 {object} map[string]string "Ошибка валидации, неверный пароль или код"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user [delete]
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req user.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.DeleteAccount(userID, &req); err != nil {
+		switch {
+		case errors.Is(err, user.ErrRequestRequired),
+			errors.Is(err, user.ErrPasswordRequired),
+			errors.Is(err, user.ErrInvalidCredentials),
+			errors.Is(err, user.ErrDeletionCodeRequired),
+			errors.Is(err, user.ErrInvalidDeletionCode):
+			localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+		case errors.Is(err, user.ErrUserNotFound):
+			localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Account] Ошибка удаления аккаунта")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		}
+		return
+	}
+
+	utils.DeleteRefreshTokenCookie(w)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeJSONExport(w http.ResponseWriter, userID int, export *Export) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFileName(export, ExportFormatJSON)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	return h.encodeExport(w, userID, export, nil)
+}
+
+// writeZipExport пишет архив прямо в ответ: export.json и файлы files/<id секрета> с данными,
+// зашифрованными на клиенте. Файлы копируются из хранилища по ссылкам, запомненным при записи
+// export.json, поэтому совпадают с описанными в нем размерами и контрольными суммами.
+func (h *Handler) writeZipExport(w http.ResponseWriter, userID int, export *Export) error {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFileName(export, ExportFormatZip)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+
+	entry, err := archive.CreateHeader(&zip.FileHeader{Name: "export.json", Method: zip.Deflate, Modified: export.ExportedAt})
+	if err != nil {
+		return err
+	}
+
+	type blobFile struct {
+		secretID string
+		ref      string
+	}
+	var blobs []blobFile
+	err = h.encodeExport(entry, userID, export, func(sec *secret.Secret) {
+		if sec.BlobRef != "" {
+			blobs = append(blobs, blobFile{secretID: sec.ID, ref: sec.BlobRef})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range blobs {
+		// Зашифрованные данные не сжимаются
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: "files/" + blob.secretID, Method: zip.Store, Modified: export.ExportedAt})
+		if err != nil {
+			return err
+		}
+		if err := h.copyBlob(entry, blob.ref); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// encodeExport пишет JSON выгрузки: поля export, затем секреты по одному по мере чтения
+// из базы. onSecret получает каждый записанный секрет.
+func (h *Handler) encodeExport(out io.Writer, userID int, export *Export, onSecret func(*secret.Secret)) error {
+	head, err := json.Marshal(export)
+	if err != nil {
+		return err
+	}
+
+	// Ошибка записи запоминается в bw и возвращается из Encode или Flush
+	bw := bufio.NewWriter(out)
+	bw.Write(head[:len(head)-1])
+	bw.WriteString(`,"secrets":[`)
+
+	encoder := json.NewEncoder(bw)
+	first := true
+	err = h.service.ExportSecrets(userID, func(sec *secret.Secret) error {
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		if onSecret != nil {
+			onSecret(sec)
+		}
+		return encoder.Encode(sec.ToResponseForSync())
+	})
+	if err != nil {
+		return err
+	}
+
+	bw.WriteString("]}\n")
+	return bw.Flush()
+}
+
+func (h *Handler) copyBlob(out io.Writer, ref string) error {
+	rc, err := h.service.OpenBlob(ref)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(out, rc)
+	return err
+}
+
+func exportFileName(export *Export, format ExportFormat) string {
+	return "goph-keeper-export-" + export.ExportedAt.Format(time.DateOnly) + "." + string(format)
+}
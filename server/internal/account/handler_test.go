@@ -0,0 +1,144 @@
+package account
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRequest(method, target string, body string, userID int) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+}
+
+// exportDocument - выгрузка целиком, с секретами, которые пишутся потоком после полей Export
+type exportDocument struct {
+	Export
+	Secrets []secret.SecretResponse `json:"secrets"`
+}
+
+func TestHandler_Export_JSON(t *testing.T) {
+	service, deps := newTestService()
+	deps.secrets.deleted = []*secret.Secret{{ID: "s3", Type: secret.TypeText, Text: "enc-text", Version: 2}}
+	handler := NewHandler(service)
+
+	w := httptest.NewRecorder()
+	handler.Export(w, newTestRequest(http.MethodGet, "/api/v1/user/export", "", 1))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".json")
+
+	var export exportDocument
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&export))
+	assert.Equal(t, "test@example.com", export.Profile.Email)
+	require.Len(t, export.Folders, 1)
+	require.Len(t, export.Events, 2)
+	assert.Equal(t, EventAccountCreated, export.Events[0].Type)
+	require.Len(t, export.Secrets, 3)
+	assert.Equal(t, "enc-login", export.Secrets[0].Login)
+	assert.Empty(t, export.Secrets[1].BinaryData, "в JSON бинарные данные не встраиваются")
+	require.NotNil(t, export.Secrets[1].BinaryDataSize)
+	assert.Equal(t, "s3", export.Secrets[2].ID, "корзина тоже выгружается")
+}
+
+func TestHandler_Export_JSON_NoSecrets(t *testing.T) {
+	service, deps := newTestService()
+	deps.secrets.secrets = nil
+	handler := NewHandler(service)
+
+	w := httptest.NewRecorder()
+	handler.Export(w, newTestRequest(http.MethodGet, "/api/v1/user/export", "", 1))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var export exportDocument
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&export))
+	assert.NotNil(t, export.Secrets)
+	assert.Empty(t, export.Secrets)
+}
+
+func TestHandler_Export_Zip(t *testing.T) {
+	service, _ := newTestService()
+	handler := NewHandler(service)
+
+	w := httptest.NewRecorder()
+	handler.Export(w, newTestRequest(http.MethodGet, "/api/v1/user/export?format=zip", "", 1))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		require.NoError(t, err)
+		files[f.Name] = data
+	}
+
+	assert.Equal(t, []byte("enc-file"), files["files/s2"], "бинарные данные копируются из хранилища")
+	assert.NotContains(t, files, "files/s1")
+
+	var export exportDocument
+	require.NoError(t, json.Unmarshal(files["export.json"], &export))
+	require.Len(t, export.Secrets, 2)
+	assert.Empty(t, export.Secrets[1].BinaryData, "бинарные данные лежат в архиве отдельным файлом")
+	require.NotNil(t, export.Secrets[1].BinaryDataSize)
+	assert.Equal(t, int64(len("enc-file")), *export.Secrets[1].BinaryDataSize)
+}
+
+func TestHandler_Export_InvalidFormat(t *testing.T) {
+	service, _ := newTestService()
+	handler := NewHandler(service)
+
+	w := httptest.NewRecorder()
+	handler.Export(w, newTestRequest(http.MethodGet, "/api/v1/user/export?format=xml", "", 1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Delete(t *testing.T) {
+	tests := []struct {
+		name       string
+		confirmErr error
+		body       string
+		wantStatus int
+	}{
+		{"success", nil, `{"password":"password123","code":"123456"}`, http.StatusNoContent},
+		{"invalid code", user.ErrInvalidDeletionCode, `{"password":"password123","code":"000000"}`, http.StatusBadRequest},
+		{"wrong password", user.ErrInvalidCredentials, `{"password":"wrong","code":"123456"}`, http.StatusBadRequest},
+		{"invalid body", nil, `{`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, deps := newTestService()
+			deps.users.confirmErr = tt.confirmErr
+			handler := NewHandler(service)
+
+			w := httptest.NewRecorder()
+			handler.Delete(w, newTestRequest(http.MethodDelete, "/api/v1/user", tt.body, 1))
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantStatus == http.StatusNoContent {
+				assert.Contains(t, w.Header().Get("Set-Cookie"), "refresh_token=;")
+				assert.Equal(t, []int{1}, deps.realtime.disconnected)
+			} else {
+				assert.Empty(t, deps.realtime.disconnected)
+			}
+		})
+	}
+}
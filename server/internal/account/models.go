@@ -0,0 +1,72 @@
+package account
+
+import (
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/folder"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+)
+
+// ExportFormat - формат выгрузки данных пользователя
+type ExportFormat string
+
+const (
+	// ExportFormatJSON - один JSON документ, бинарные данные секретов внутри в base64
+	ExportFormatJSON ExportFormat = "json"
+	// ExportFormatZip - архив с export.json и бинарными данными секретов отдельными файлами
+	ExportFormatZip ExportFormat = "zip"
+)
+
+func (f ExportFormat) IsValid() bool {
+	switch f {
+	case ExportFormatJSON, ExportFormatZip:
+		return true
+	}
+	return false
+}
+
+// Export - данные пользователя, кроме секретов: секретов может быть много, поэтому они
+// пишутся в выгрузку потоком полем secrets после остальных. Ключи и названия папок и меток
+// остаются в том виде, в каком их зашифровал клиент.
+type Export struct {
+	ExportedAt time.Time               `json:"exported_at"`
+	Profile    *user.AccountProfile    `json:"profile"`
+	Folders    []folder.FolderResponse `json:"folders"`
+	Tags       []tag.TagResponse       `json:"tags"`
+	Events     []Event                 `json:"events"`
+}
+
+// Типы событий выгрузки
+const (
+	EventAccountCreated           = "account.created"
+	EventSessionStarted           = "session.started"
+	EventTOTPEnabled              = "mfa.totp_enabled"
+	EventRecoveryCodeUsed         = "mfa.recovery_code_used"
+	EventPasskeyAdded             = "mfa.passkey_added"
+	EventShareGranted             = "share.granted"
+	EventShareRevoked             = "share.revoked"
+	EventShareReceived            = "share.received"
+	EventShareWithdrawn           = "share.withdrawn"
+	EventSecretDeleted            = "secret.deleted"
+	EventPasswordResetRequested   = "password_reset.requested"
+	EventEmailChangeRequested     = "email_change.requested"
+	EventAccountDeletionRequested = "account_deletion.requested"
+)
+
+// Event - действие с аккаунтом. Отдельного журнала сервер не ведет: события восстанавливаются
+// по записям, которые хранятся в базе, поэтому действий, чьи записи уже удалены (завершенные
+// сессии, очищенные коды, окончательно удаленные секреты), в выгрузке нет.
+type Event struct {
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// SecretID - секрет, к которому относится событие доступа или удаления
+	SecretID string `json:"secret_id,omitempty"`
+}
+
+// DeletedAccount - что осталось сделать после удаления аккаунта из базы: освободить
+// бинарные данные и сообщить получателям доступа, какие секреты у них пропали
+type DeletedAccount struct {
+	BlobRefs []string
+	Unshared map[int][]string
+}
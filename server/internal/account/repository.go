@@ -0,0 +1,191 @@
+package account
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/Adigezalov/goph-keeper/internal/user"
+)
+
+type Repository interface {
+	ListEvents(userID int) ([]Event, error)
+	DeleteAccount(userID int) (*DeletedAccount, error)
+}
+
+type DatabaseRepository struct {
+	db *sql.DB
+}
+
+func NewDatabaseRepository(db *sql.DB) *DatabaseRepository {
+	return &DatabaseRepository{db: db}
+}
+
+// ListEvents восстанавливает события аккаунта по хранящимся записям в порядке времени
+func (r *DatabaseRepository) ListEvents(userID int) ([]Event, error) {
+	rows, err := r.db.Query(`
+		SELECT type, occurred_at, COALESCE(secret_id, '') FROM (
+			SELECT $2::text AS type, created_at AS occurred_at, NULL::text AS secret_id FROM users WHERE id = $1
+			UNION ALL
+			SELECT $3::text, created_at, NULL FROM refresh_tokens WHERE user_id = $1
+			UNION ALL
+			SELECT $4::text, confirmed_at, NULL FROM user_totp WHERE user_id = $1
+			UNION ALL
+			SELECT $5::text, used_at, NULL FROM user_recovery_codes WHERE user_id = $1
+			UNION ALL
+			SELECT $6::text, created_at, NULL FROM webauthn_credentials WHERE user_id = $1
+			UNION ALL
+			SELECT $7::text, sh.created_at, sh.secret_id::text FROM secret_shares sh JOIN secrets s ON s.id = sh.secret_id WHERE s.user_id = $1
+			UNION ALL
+			SELECT $8::text, sh.revoked_at, sh.secret_id::text FROM secret_shares sh JOIN secrets s ON s.id = sh.secret_id WHERE s.user_id = $1
+			UNION ALL
+			SELECT $9::text, created_at, secret_id::text FROM secret_shares WHERE grantee_user_id = $1
+			UNION ALL
+			SELECT $9::text, created_at, secret_id::text FROM share_tombstones WHERE grantee_user_id = $1
+			UNION ALL
+			SELECT $10::text, revoked_at, secret_id::text FROM secret_shares WHERE grantee_user_id = $1
+			UNION ALL
+			SELECT $10::text, revoked_at, secret_id::text FROM share_tombstones WHERE grantee_user_id = $1
+			UNION ALL
+			SELECT $11::text, deleted_at, id::text FROM secrets WHERE user_id = $1
+			UNION ALL
+			SELECT $12::text, created_at, NULL FROM password_reset_codes WHERE user_id = $1
+			UNION ALL
+			SELECT $13::text, created_at, NULL FROM email_verification_codes WHERE user_id = $1 AND new_email IS NOT NULL
+			UNION ALL
+			SELECT $14::text, created_at, NULL FROM account_deletion_codes WHERE user_id = $1
+		) events
+		WHERE occurred_at IS NOT NULL
+		ORDER BY occurred_at, type, secret_id
+	`, userID,
+		EventAccountCreated, EventSessionStarted, EventTOTPEnabled, EventRecoveryCodeUsed, EventPasskeyAdded,
+		EventShareGranted, EventShareRevoked, EventShareReceived, EventShareWithdrawn, EventSecretDeleted,
+		EventPasswordResetRequested, EventEmailChangeRequested, EventAccountDeletionRequested)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить события аккаунта")
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		if err := rows.Scan(&event.Type, &event.OccurredAt, &event.SecretID); err != nil {
+			return nil, WrapError(err, "не удалось прочитать событие аккаунта")
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, WrapError(err, "ошибка при чтении событий аккаунта")
+	}
+
+	return events, nil
+}
+
+// DeleteAccount удаляет пользователя со всеми записями одной транзакцией. Доступы к его
+// секретам сначала отзываются, и отзыв переносится в share_tombstones: строки secret_shares
+// уйдут каскадом вместе с секретами, а получатели должны получить надгробия. Секреты, токены
+// и коды из писем стираются явно, не полагаясь на каскад по users. Бинарные данные остаются
+// в хранилище: их освобождают по DeletedAccount.BlobRefs после фиксации.
+func (r *DatabaseRepository) DeleteAccount(userID int) (*DeletedAccount, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, user.ErrUserNotFound
+		}
+		return nil, WrapError(err, "не удалось заблокировать пользователя")
+	}
+
+	deleted := &DeletedAccount{Unshared: make(map[int][]string)}
+
+	deleted.BlobRefs, err = queryStrings(tx, `
+		SELECT blob_ref FROM secrets WHERE user_id = $1 AND blob_ref IS NOT NULL
+		UNION
+		SELECT blob_ref FROM secret_versions WHERE user_id = $1 AND blob_ref IS NOT NULL
+	`, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить ссылки на бинарные данные")
+	}
+
+	// Отзыв выдает доступу новый номер в ленте получателя
+	rows, err := tx.Query(`
+		UPDATE secret_shares sh
+		SET revoked_at = NOW()
+		FROM secrets s
+		WHERE s.id = sh.secret_id AND s.user_id = $1 AND sh.revoked_at IS NULL
+		RETURNING sh.grantee_user_id, sh.secret_id
+	`, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось отозвать доступы к секретам")
+	}
+	for rows.Next() {
+		var granteeID int
+		var secretID string
+		if err := rows.Scan(&granteeID, &secretID); err != nil {
+			rows.Close()
+			return nil, WrapError(err, "не удалось прочитать отозванный доступ")
+		}
+		deleted.Unshared[granteeID] = append(deleted.Unshared[granteeID], secretID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, WrapError(err, "ошибка при чтении отозванных доступов")
+	}
+
+	// Доступы, отозванные раньше, переносятся тоже: не все устройства получателя могли узнать об отзыве
+	if _, err := tx.Exec(`
+		INSERT INTO share_tombstones (secret_id, grantee_user_id, owner_user_id, type, version, change_seq, created_at, revoked_at)
+		SELECT sh.secret_id, sh.grantee_user_id, s.user_id, s.type, s.version, sh.change_seq, s.created_at, sh.revoked_at
+		FROM secret_shares sh JOIN secrets s ON s.id = sh.secret_id
+		WHERE s.user_id = $1
+	`, userID); err != nil {
+		return nil, WrapError(err, "не удалось сохранить надгробия доступов")
+	}
+
+	// История версий, доступы и метки уходят каскадом вместе с секретами
+	statements := []struct {
+		query   string
+		message string
+	}{
+		{`DELETE FROM secrets WHERE user_id = $1`, "не удалось удалить секреты пользователя"},
+		{`DELETE FROM refresh_tokens WHERE user_id = $1`, "не удалось удалить refresh токены пользователя"},
+		{`DELETE FROM email_verification_codes WHERE user_id = $1`, "не удалось удалить коды верификации"},
+		{`DELETE FROM password_reset_codes WHERE user_id = $1`, "не удалось удалить коды сброса пароля"},
+		{`DELETE FROM account_deletion_codes WHERE user_id = $1`, "не удалось удалить коды удаления аккаунта"},
+		{`DELETE FROM users WHERE id = $1`, "не удалось удалить пользователя"},
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt.query, userID); err != nil {
+			return nil, WrapError(err, stmt.message)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return deleted, nil
+}
+
+func queryStrings(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
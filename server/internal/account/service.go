@@ -0,0 +1,152 @@
+package account
+
+import (
+	"io"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/folder"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+)
+
+// UserService - учетная запись: профиль для выгрузки и подтверждение удаления
+type UserService interface {
+	GetAccountProfile(userID int) (*user.AccountProfile, error)
+	ConfirmAccountDeletion(userID int, req *user.DeleteAccountRequest) error
+}
+
+// SecretStore отдает секреты пользователя для выгрузки по одному и их бинарные данные
+// из хранилища, а после удаления аккаунта освобождает эти данные
+type SecretStore interface {
+	ExportSecrets(userID int, fn func(*secret.Secret) error) error
+	OpenBlob(ref string) (io.ReadCloser, error)
+	ReleaseBlobs(refs ...string)
+}
+
+type FolderStore interface {
+	ListFolders(userID int) ([]*folder.Folder, error)
+}
+
+type TagStore interface {
+	ListTags(userID int) ([]*tag.Tag, error)
+}
+
+// RealtimeService сообщает получателям доступа о пропавших секретах и закрывает
+// подключения удаленного пользователя
+type RealtimeService interface {
+	NotifySecretUnshared(userID int, secretID string, excludeSessionID string) error
+	DisconnectUser(userID int) int
+}
+
+type Service struct {
+	repo            Repository
+	users           UserService
+	secrets         SecretStore
+	folders         FolderStore
+	tags            TagStore
+	realtimeService RealtimeService
+}
+
+func NewService(repo Repository, users UserService, secrets SecretStore, folders FolderStore, tags TagStore) *Service {
+	return &Service{
+		repo:    repo,
+		users:   users,
+		secrets: secrets,
+		folders: folders,
+		tags:    tags,
+	}
+}
+
+func (s *Service) SetRealtimeService(realtimeService RealtimeService) {
+	s.realtimeService = realtimeService
+}
+
+// Export собирает данные пользователя, кроме секретов: профиль, папки, метки и события.
+// Секреты выгружаются следом через ExportSecrets.
+func (s *Service) Export(userID int) (*Export, error) {
+	profile, err := s.users.GetAccountProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	folders, err := s.folders.ListFolders(userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить папки")
+	}
+
+	tags, err := s.tags.ListTags(userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить метки")
+	}
+
+	events, err := s.repo.ListEvents(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &Export{
+		ExportedAt: time.Now().UTC(),
+		Profile:    profile,
+		Folders:    make([]folder.FolderResponse, 0, len(folders)),
+		Tags:       make([]tag.TagResponse, 0, len(tags)),
+		Events:     events,
+	}
+	for _, f := range folders {
+		export.Folders = append(export.Folders, f.ToResponse())
+	}
+	for _, t := range tags {
+		export.Tags = append(export.Tags, t.ToResponse())
+	}
+
+	return export, nil
+}
+
+// ExportSecrets передает fn секреты пользователя, включая корзину, по одному. Бинарные
+// данные не загружаются: их читают через OpenBlob по BlobRef.
+func (s *Service) ExportSecrets(userID int, fn func(*secret.Secret) error) error {
+	return s.secrets.ExportSecrets(userID, fn)
+}
+
+// OpenBlob открывает бинарные данные секрета из выгрузки
+func (s *Service) OpenBlob(ref string) (io.ReadCloser, error) {
+	return s.secrets.OpenBlob(ref)
+}
+
+// DeleteAccount удаляет аккаунт после проверки пароля и кода из письма. Все записи
+// пользователя удаляются одной транзакцией, бинарные данные освобождаются после нее:
+// каскад по users до хранилища не достает. Получатели доступа к секретам пользователя
+// получают надгробия, подключения пользователя закрываются.
+func (s *Service) DeleteAccount(userID int, req *user.DeleteAccountRequest) error {
+	if err := s.users.ConfirmAccountDeletion(userID, req); err != nil {
+		return err
+	}
+
+	deleted, err := s.repo.DeleteAccount(userID)
+	if err != nil {
+		return err
+	}
+
+	s.secrets.ReleaseBlobs(deleted.BlobRefs...)
+
+	if s.realtimeService == nil {
+		return nil
+	}
+
+	for granteeID, secretIDs := range deleted.Unshared {
+		for _, secretID := range secretIDs {
+			if err := s.realtimeService.NotifySecretUnshared(granteeID, secretID, ""); err != nil {
+				logger.Log.WithFields(map[string]interface{}{
+					"user_id":   granteeID,
+					"secret_id": secretID,
+					"error":     err.Error(),
+				}).Warn("[Account] Не удалось уведомить об отзыве доступа")
+			}
+		}
+	}
+
+	s.realtimeService.DisconnectUser(userID)
+
+	return nil
+}
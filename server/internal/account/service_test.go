@@ -0,0 +1,188 @@
+package account
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/folder"
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockUserService записывает, что и в каком порядке сделано с учетной записью
+type MockUserService struct {
+	confirmErr error
+	calls      *[]string
+}
+
+func (m *MockUserService) GetAccountProfile(userID int) (*user.AccountProfile, error) {
+	return &user.AccountProfile{ID: userID, Email: "test@example.com"}, nil
+}
+
+func (m *MockUserService) ConfirmAccountDeletion(userID int, req *user.DeleteAccountRequest) error {
+	*m.calls = append(*m.calls, "confirm")
+	return m.confirmErr
+}
+
+type MockRepository struct {
+	events  []Event
+	deleted *DeletedAccount
+	calls   *[]string
+}
+
+func (m *MockRepository) ListEvents(userID int) ([]Event, error) {
+	return m.events, nil
+}
+
+func (m *MockRepository) DeleteAccount(userID int) (*DeletedAccount, error) {
+	*m.calls = append(*m.calls, "delete account")
+	return m.deleted, nil
+}
+
+// MockSecretStore отдает секреты и корзину, бинарные данные лежат в blobs по ссылкам
+type MockSecretStore struct {
+	secrets  []*secret.Secret
+	deleted  []*secret.Secret
+	blobs    map[string][]byte
+	released []string
+	calls    *[]string
+}
+
+func (m *MockSecretStore) ExportSecrets(userID int, fn func(*secret.Secret) error) error {
+	for _, sec := range append(m.secrets, m.deleted...) {
+		if err := fn(sec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MockSecretStore) OpenBlob(ref string) (io.ReadCloser, error) {
+	data, ok := m.blobs[ref]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MockSecretStore) ReleaseBlobs(refs ...string) {
+	*m.calls = append(*m.calls, "release blobs")
+	m.released = append(m.released, refs...)
+}
+
+type MockFolderStore struct {
+	folders []*folder.Folder
+}
+
+func (m *MockFolderStore) ListFolders(userID int) ([]*folder.Folder, error) {
+	return m.folders, nil
+}
+
+type MockTagStore struct {
+	tags []*tag.Tag
+}
+
+func (m *MockTagStore) ListTags(userID int) ([]*tag.Tag, error) {
+	return m.tags, nil
+}
+
+type MockRealtimeService struct {
+	unshared     []string
+	disconnected []int
+	calls        *[]string
+}
+
+func (m *MockRealtimeService) NotifySecretUnshared(userID int, secretID string, excludeSessionID string) error {
+	m.unshared = append(m.unshared, secretID)
+	return nil
+}
+
+func (m *MockRealtimeService) DisconnectUser(userID int) int {
+	*m.calls = append(*m.calls, "disconnect")
+	m.disconnected = append(m.disconnected, userID)
+	return 1
+}
+
+type testDeps struct {
+	repo     *MockRepository
+	users    *MockUserService
+	secrets  *MockSecretStore
+	realtime *MockRealtimeService
+	calls    []string
+}
+
+func newTestService() (*Service, *testDeps) {
+	deps := &testDeps{}
+	deps.repo = &MockRepository{
+		events: []Event{
+			{Type: EventAccountCreated, OccurredAt: time.Date(2026, 1, 15, 10, 30, 0, 0, time.UTC)},
+			{Type: EventShareGranted, OccurredAt: time.Date(2026, 2, 1, 9, 0, 0, 0, time.UTC), SecretID: "s1"},
+		},
+		deleted: &DeletedAccount{Unshared: map[int][]string{}},
+		calls:   &deps.calls,
+	}
+	deps.users = &MockUserService{calls: &deps.calls}
+	deps.secrets = &MockSecretStore{
+		secrets: []*secret.Secret{
+			{ID: "s1", Type: secret.TypeLogin, Login: "enc-login", Version: 1},
+			{ID: "s2", Type: secret.TypeFile, BlobRef: "1/blob", BlobSize: int64(len("enc-file")), Version: 1},
+		},
+		blobs: map[string][]byte{"1/blob": []byte("enc-file")},
+		calls: &deps.calls,
+	}
+	deps.realtime = &MockRealtimeService{calls: &deps.calls}
+
+	service := NewService(
+		deps.repo,
+		deps.users,
+		deps.secrets,
+		&MockFolderStore{folders: []*folder.Folder{{ID: "f1", Name: "enc-folder", Version: 1}}},
+		&MockTagStore{tags: []*tag.Tag{{ID: "t1", Name: "enc-tag", Version: 1}}},
+	)
+	service.SetRealtimeService(deps.realtime)
+	return service, deps
+}
+
+func TestService_Export(t *testing.T) {
+	service, _ := newTestService()
+
+	export, err := service.Export(1)
+	require.NoError(t, err)
+
+	assert.Equal(t, "test@example.com", export.Profile.Email)
+	require.Len(t, export.Folders, 1)
+	require.Len(t, export.Tags, 1)
+	require.Len(t, export.Events, 2)
+	assert.Equal(t, EventShareGranted, export.Events[1].Type)
+	assert.Equal(t, "s1", export.Events[1].SecretID)
+	assert.False(t, export.ExportedAt.IsZero())
+}
+
+func TestService_DeleteAccount(t *testing.T) {
+	service, deps := newTestService()
+	deps.repo.deleted = &DeletedAccount{BlobRefs: []string{"1/blob"}, Unshared: map[int][]string{2: {"s1"}}}
+
+	err := service.DeleteAccount(1, &user.DeleteAccountRequest{Password: "password123", Code: "123456"})
+	require.NoError(t, err)
+
+	// Бинарные данные освобождаются только после удаления из базы
+	assert.Equal(t, []string{"confirm", "delete account", "release blobs", "disconnect"}, deps.calls)
+	assert.Equal(t, []string{"1/blob"}, deps.secrets.released)
+	assert.Equal(t, []string{"s1"}, deps.realtime.unshared)
+	assert.Equal(t, []int{1}, deps.realtime.disconnected)
+}
+
+func TestService_DeleteAccount_NotConfirmed(t *testing.T) {
+	service, deps := newTestService()
+	deps.users.confirmErr = user.ErrInvalidDeletionCode
+
+	err := service.DeleteAccount(1, &user.DeleteAccountRequest{Password: "password123", Code: "000000"})
+	assert.True(t, errors.Is(err, user.ErrInvalidDeletionCode))
+	assert.Equal(t, []string{"confirm"}, deps.calls, "без подтверждения ничего не удаляется")
+}
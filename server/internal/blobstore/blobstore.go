@@ -0,0 +1,38 @@
+// Package blobstore хранит бинарные данные секретов вне базы: в файловой системе
+// или в S3-совместимом объектном хранилище (AWS S3, MinIO)
+package blobstore
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blobstore.not_found")
+	ErrInvalidKey = errors.New("blobstore.invalid_key")
+)
+
+// validateKey допускает ключи вида "сегмент/сегмент" без пустых сегментов и переходов наверх,
+// чтобы ключ нельзя было использовать для выхода за пределы каталога или бакета
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return ErrInvalidKey
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+		for _, c := range segment {
+			if !isKeyChar(c) {
+				return ErrInvalidKey
+			}
+		}
+	}
+
+	return nil
+}
+
+func isKeyChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+}
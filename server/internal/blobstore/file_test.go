@@ -0,0 +1,71 @@
+package blobstore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore_PutGetDelete(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("1/abc", strings.NewReader("hello world")))
+
+	rc, err := store.Get("1/abc")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	part, err := store.ReadRange("1/abc", 6, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(part))
+
+	part, err = store.ReadRange("1/abc", 50, 10)
+	require.NoError(t, err)
+	assert.Empty(t, part)
+
+	entries, err := os.ReadDir(filepath.Join(dir, "1"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "временные файлы не должны оставаться в каталоге")
+
+	require.NoError(t, store.Delete("1/abc"))
+	require.NoError(t, store.Delete("1/abc"))
+
+	_, err = store.Get("1/abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileStore_Overwrite(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("key", strings.NewReader("first version")))
+	require.NoError(t, store.Put("key", strings.NewReader("second")))
+
+	data, err := store.ReadRange("key", 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+}
+
+func TestFileStore_RejectsInvalidKeys(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "/abs", "../escape", "a/../../b", "a//b", "a/", "a b", `a\b`} {
+		t.Run(key, func(t *testing.T) {
+			assert.ErrorIs(t, store.Put(key, strings.NewReader("x")), ErrInvalidKey)
+			_, err := store.Get(key)
+			assert.ErrorIs(t, err, ErrInvalidKey)
+			assert.ErrorIs(t, store.Delete(key), ErrInvalidKey)
+		})
+	}
+}
@@ -0,0 +1,901 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultServerURL = "https://localhost:8080/api"
+	requestTimeout   = 60 * time.Second
+)
+
+const usage = `Использование: keeper-cli [глобальные флаги] <команда> [флаги]
+
+Команды:
+  version        версия клиента
+  build-date     дата сборки клиента
+  register       регистрация нового пользователя
+  verify-email   подтверждение email кодом из письма
+  login          вход
+  logout         выход
+  list           список секретов
+  get            получить секрет
+  create         создать секрет
+  update         обновить секрет
+  delete         удалить секрет
+  upload         загрузить файл по частям
+  download       скачать бинарные данные секрета
+  sync           синхронизировать локальное хранилище с сервером
+  pending        показать изменения, ожидающие отправки
+  discard        удалить изменение из очереди отправки
+
+Глобальные флаги:
+  -server    адрес API (env KEEPER_SERVER_URL, по умолчанию ` + DefaultServerURL + `)
+  -insecure  не проверять TLS сертификат сервера (env KEEPER_INSECURE)
+  -session   путь к файлу сессии
+  -vault     путь к зашифрованному локальному хранилищу
+  -master    мастер-пароль хранилища; небезопасно, лучше env KEEPER_MASTER_PASSWORD.
+             Без пароля хранилище не используется, в режиме -offline он запрашивается
+  -offline   работать только с локальным хранилищем
+
+Пароль для register и login берется из env KEEPER_PASSWORD или запрашивается без отображения
+ввода. Флаги -password и -master остаются запасным вариантом: значения из argv видны в списке
+процессов и сохраняются в истории shell.
+
+Подробнее о флагах команды: keeper-cli <команда> -h
+`
+
+// App разбирает аргументы командной строки и выполняет команды CLI
+type App struct {
+	version   string
+	buildDate string
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+	input     *bufio.Reader
+	vault     *Vault
+	offline   bool
+}
+
+func NewApp(version, buildDate string, stdout, stderr io.Writer) *App {
+	return &App{
+		version:   version,
+		buildDate: buildDate,
+		stdin:     os.Stdin,
+		stdout:    stdout,
+		stderr:    stderr,
+	}
+}
+
+type commandFunc func(client *Client, args []string) error
+
+func (a *App) Run(args []string) error {
+	global := flag.NewFlagSet("keeper-cli", flag.ContinueOnError)
+	global.SetOutput(a.stderr)
+	global.Usage = func() { fmt.Fprint(a.stderr, usage) }
+
+	serverURL := global.String("server", envOrDefault("KEEPER_SERVER_URL", DefaultServerURL), "адрес API")
+	insecure := global.Bool("insecure", os.Getenv("KEEPER_INSECURE") == "true", "не проверять TLS сертификат")
+	sessionPath := global.String("session", "", "путь к файлу сессии")
+	vaultPath := global.String("vault", "", "путь к локальному хранилищу")
+	masterFlag := global.String("master", "", "мастер-пароль хранилища (небезопасно, используйте "+EnvMasterPassword+")")
+	offline := global.Bool("offline", false, "работать только с локальным хранилищем")
+
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+
+	if global.NArg() == 0 {
+		global.Usage()
+		return ErrMissingArgument
+	}
+
+	command, commandArgs := global.Arg(0), global.Args()[1:]
+
+	switch command {
+	case "version":
+		fmt.Fprintln(a.stdout, a.version)
+		return nil
+	case "build-date":
+		fmt.Fprintln(a.stdout, a.buildDate)
+		return nil
+	case "help":
+		global.Usage()
+		return nil
+	}
+
+	commands := map[string]commandFunc{
+		"register":     a.register,
+		"verify-email": a.verifyEmail,
+		"login":        a.login,
+		"logout":       a.logout,
+		"list":         a.list,
+		"get":          a.get,
+		"create":       a.create,
+		"update":       a.update,
+		"delete":       a.delete,
+		"upload":       a.upload,
+		"download":     a.download,
+		"sync":         a.sync,
+		"pending":      a.pending,
+		"discard":      a.discard,
+	}
+
+	run, ok := commands[command]
+	if !ok {
+		global.Usage()
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, command)
+	}
+
+	path := *sessionPath
+	if path == "" {
+		var err error
+		path, err = DefaultSessionPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	session, err := LoadSession(path)
+	if err != nil {
+		return err
+	}
+	session.ServerURL = *serverURL
+
+	masterPassword := os.Getenv(EnvMasterPassword)
+	if isFlagSet(global, "master") {
+		a.warnInsecureFlag("master", EnvMasterPassword)
+		masterPassword = *masterFlag
+	}
+	if masterPassword == "" && *offline {
+		masterPassword, err = a.promptPassword("Мастер-пароль")
+		if err != nil {
+			return err
+		}
+	}
+
+	a.offline = *offline
+	a.vault = nil
+	if masterPassword != "" {
+		if *vaultPath == "" {
+			*vaultPath, err = DefaultVaultPath()
+			if err != nil {
+				return err
+			}
+		}
+		a.vault, err = OpenVault(*vaultPath, masterPassword)
+		if err != nil {
+			return err
+		}
+	} else if a.offline {
+		return fmt.Errorf("%w: для работы offline нужен мастер-пароль (%s)", ErrMissingArgument, EnvMasterPassword)
+	}
+
+	client := NewClient(*serverURL, newHTTPClient(*insecure), session)
+
+	runErr := run(client, commandArgs)
+
+	if client.SessionChanged() {
+		if err := client.Session().Save(path); err != nil {
+			return err
+		}
+	}
+
+	if a.vault != nil {
+		if err := a.vault.Save(); err != nil {
+			return err
+		}
+	}
+
+	return runErr
+}
+
+func (a *App) register(client *Client, args []string) error {
+	fs := a.newFlagSet("register")
+	email := fs.String("email", "", "email")
+	fs.String("password", "", "пароль (небезопасно, используйте "+EnvPassword+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "email"); err != nil {
+		return err
+	}
+	password, err := a.accountPassword(fs)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Register(*email, password); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "Код подтверждения отправлен на", *email)
+	return nil
+}
+
+func (a *App) verifyEmail(client *Client, args []string) error {
+	fs := a.newFlagSet("verify-email")
+	email := fs.String("email", "", "email")
+	code := fs.String("code", "", "код из письма")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "email", "code"); err != nil {
+		return err
+	}
+
+	if err := client.VerifyEmail(*email, *code); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "Email подтвержден, вход выполнен")
+	return nil
+}
+
+func (a *App) login(client *Client, args []string) error {
+	fs := a.newFlagSet("login")
+	email := fs.String("email", "", "email")
+	fs.String("password", "", "пароль (небезопасно, используйте "+EnvPassword+")")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "email"); err != nil {
+		return err
+	}
+	password, err := a.accountPassword(fs)
+	if err != nil {
+		return err
+	}
+
+	if err := client.Login(*email, password); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "Вход выполнен")
+	return nil
+}
+
+func (a *App) logout(client *Client, args []string) error {
+	fs := a.newFlagSet("logout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := client.Logout(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "Выход выполнен")
+	return nil
+}
+
+func (a *App) list(client *Client, args []string) error {
+	fs := a.newFlagSet("list")
+	asJSON := fs.Bool("json", false, "вывести в формате JSON")
+	secretType := fs.String("type", "", "показать только секреты указанного типа")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var secrets []secret.SecretResponse
+	if a.offline {
+		secrets = a.vault.List(secret.SecretType(*secretType))
+	} else {
+		var err error
+		secrets, err = client.ListSecrets(secret.SecretType(*secretType))
+		switch {
+		case a.canFallBack(err):
+			secrets = a.vault.List(secret.SecretType(*secretType))
+		case err != nil:
+			return err
+		case a.vault != nil:
+			for _, s := range secrets {
+				a.vault.Put(s)
+			}
+		}
+	}
+
+	if *asJSON {
+		for i := range secrets {
+			stripBinaryData(&secrets[i])
+		}
+		return a.printJSON(secrets)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTYPE\tVERSION\tLOGIN\tUPDATED")
+	for _, s := range secrets {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", s.ID, s.Type, s.Version, s.Login, s.UpdatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (a *App) get(client *Client, args []string) error {
+	fs := a.newFlagSet("get")
+	id := fs.String("id", "", "ID секрета")
+	out := fs.String("out", "", "сохранить бинарные данные в файл")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "id"); err != nil {
+		return err
+	}
+
+	resp, err := a.fetchSecret(client, *id)
+	if err != nil {
+		return err
+	}
+
+	if *out != "" && len(resp.BinaryData) > 0 {
+		if err := os.WriteFile(*out, resp.BinaryData, 0o600); err != nil {
+			return fmt.Errorf("не удалось сохранить файл: %w", err)
+		}
+	}
+
+	stripBinaryData(resp)
+	return a.printJSON(resp)
+}
+
+func (a *App) create(client *Client, args []string) error {
+	fs := a.newFlagSet("create")
+	secretType := fs.String("type", "", "тип секрета: login, text, card, file (по умолчанию login)")
+	login := fs.String("login", "", "логин")
+	fs.String("password", "", "пароль (небезопасно, используйте -ask-password)")
+	askPassword := fs.Bool("ask-password", false, "запросить пароль без отображения ввода")
+	text := fs.String("text", "", "текст заметки")
+	file := fs.String("file", "", "путь к файлу с бинарными данными")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "meta", "метаданные key=value (можно указать несколько раз)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	password, err := a.secretPassword(fs, *askPassword)
+	if err != nil {
+		return err
+	}
+
+	if *file != "" {
+		info, err := os.Stat(*file)
+		if err != nil {
+			return fmt.Errorf("не удалось открыть файл: %w", err)
+		}
+		if info.Size() > secret.MinSizeForChunks && !a.offline {
+			return a.uploadFile(client, *file, secret.SecretType(*secretType), *login, password, metadata)
+		}
+	}
+
+	// ID генерируется заранее: если ответ на создание не дойдет, отложенное создание
+	// отправится с тем же ID и не станет дубликатом
+	req := &secret.CreateSecretRequest{
+		ID:       uuid.New().String(),
+		Type:     secret.SecretType(*secretType),
+		Login:    *login,
+		Password: password,
+		Text:     *text,
+		Metadata: metadata.toInterfaceMap(),
+	}
+
+	if *file != "" {
+		data, fileMetadata, err := readFile(*file)
+		if err != nil {
+			return err
+		}
+		req.BinaryData = data
+		req.Metadata = mergeMetadata(fileMetadata, metadata)
+	}
+
+	if a.offline {
+		return a.queueCreate(req)
+	}
+
+	resp, err := client.CreateSecret(req)
+	if a.canFallBack(err) {
+		return a.queueCreate(req)
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.vault != nil {
+		a.vault.Put(*resp)
+	}
+
+	stripBinaryData(resp)
+	return a.printJSON(resp)
+}
+
+func (a *App) update(client *Client, args []string) error {
+	fs := a.newFlagSet("update")
+	id := fs.String("id", "", "ID секрета")
+	version := fs.Int("version", 0, "ожидаемая версия секрета (по умолчанию текущая)")
+	login := fs.String("login", "", "новый логин")
+	fs.String("password", "", "новый пароль (небезопасно, используйте -ask-password)")
+	askPassword := fs.Bool("ask-password", false, "запросить новый пароль без отображения ввода")
+	text := fs.String("text", "", "новый текст заметки")
+	file := fs.String("file", "", "путь к файлу с новыми бинарными данными")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "meta", "метаданные key=value (можно указать несколько раз)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "id"); err != nil {
+		return err
+	}
+
+	current, err := a.fetchSecret(client, *id)
+	if err != nil {
+		return err
+	}
+
+	req := &secret.UpdateSecretRequest{
+		Type:       current.Type,
+		Login:      current.Login,
+		Password:   current.Password,
+		Text:       current.Text,
+		Card:       current.Card,
+		Metadata:   current.Metadata,
+		BinaryData: current.BinaryData,
+		Version:    current.Version,
+	}
+
+	if isFlagSet(fs, "version") {
+		req.Version = *version
+	}
+	if isFlagSet(fs, "login") {
+		req.Login = *login
+	}
+	if *askPassword || isFlagSet(fs, "password") {
+		req.Password, err = a.secretPassword(fs, *askPassword)
+		if err != nil {
+			return err
+		}
+	}
+	if isFlagSet(fs, "text") {
+		req.Text = *text
+	}
+	if *file != "" {
+		data, fileMetadata, err := readFile(*file)
+		if err != nil {
+			return err
+		}
+		req.BinaryData = data
+		req.Metadata = mergeMetadata(req.Metadata, metadataFlag(stringifyMetadata(fileMetadata)))
+	}
+	if len(metadata) > 0 {
+		req.Metadata = mergeMetadata(req.Metadata, metadata)
+	}
+
+	if a.offline {
+		return a.queueUpdate(*id, req)
+	}
+
+	resp, err := client.UpdateSecret(*id, req)
+	if a.canFallBack(err) {
+		return a.queueUpdate(*id, req)
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.vault != nil {
+		a.vault.Put(*resp)
+	}
+
+	stripBinaryData(resp)
+	return a.printJSON(resp)
+}
+
+func (a *App) delete(client *Client, args []string) error {
+	fs := a.newFlagSet("delete")
+	id := fs.String("id", "", "ID секрета")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "id"); err != nil {
+		return err
+	}
+
+	if a.offline {
+		return a.queueDelete(*id)
+	}
+
+	err := client.DeleteSecret(*id)
+	if a.canFallBack(err) {
+		return a.queueDelete(*id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if a.vault != nil {
+		a.vault.Remove(*id)
+	}
+
+	fmt.Fprintln(a.stdout, "Секрет удален:", *id)
+	return nil
+}
+
+func (a *App) sync(client *Client, args []string) error {
+	fs := a.newFlagSet("sync")
+	full := fs.Bool("full", false, "загрузить все секреты заново")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if a.vault == nil {
+		return fmt.Errorf("%w: для синхронизации нужен мастер-пароль (%s)", ErrMissingArgument, EnvMasterPassword)
+	}
+
+	report, err := a.vault.Replay(client)
+	if err != nil {
+		return err
+	}
+
+	cursor := a.vault.Cursor()
+	if *full {
+		cursor = ""
+	}
+
+	received := 0
+	for {
+		result, err := client.Sync(cursor)
+		if err != nil {
+			return err
+		}
+		a.vault.ApplySync(result.Secrets, result.NextCursor)
+		received += len(result.Secrets)
+		cursor = result.NextCursor
+
+		if !result.HasMore {
+			break
+		}
+	}
+
+	fmt.Fprintf(a.stdout, "Отправлено изменений: %d, получено с сервера: %d\n", report.Applied, received)
+	for _, op := range report.Conflicts {
+		fmt.Fprintf(a.stdout, "Конфликт версий: %s %s (операция %s). Обновите секрет или выполните discard\n", op.Action, op.SecretID, op.ID)
+	}
+	for _, op := range report.Rejected {
+		fmt.Fprintf(a.stdout, "Сервер отклонил %s %s (операция %s): %s. Выполните discard\n", op.Action, op.SecretID, op.ID, op.Reason)
+	}
+
+	return nil
+}
+
+func (a *App) pending(client *Client, args []string) error {
+	fs := a.newFlagSet("pending")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if a.vault == nil {
+		return fmt.Errorf("%w: нужен мастер-пароль (%s)", ErrMissingArgument, EnvMasterPassword)
+	}
+
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATION\tACTION\tSECRET\tBASE VERSION\tQUEUED\tCONFLICT")
+	for _, op := range a.vault.Pending() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%t\n", op.ID, op.Action, op.SecretID, op.BaseVersion, op.QueuedAt.Format(time.RFC3339), op.Conflict)
+	}
+	return tw.Flush()
+}
+
+func (a *App) discard(client *Client, args []string) error {
+	fs := a.newFlagSet("discard")
+	id := fs.String("id", "", "ID операции из pending")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "id"); err != nil {
+		return err
+	}
+	if a.vault == nil {
+		return fmt.Errorf("%w: нужен мастер-пароль (%s)", ErrMissingArgument, EnvMasterPassword)
+	}
+
+	if !a.vault.Discard(*id) {
+		return fmt.Errorf("операция %s не найдена", *id)
+	}
+
+	fmt.Fprintln(a.stdout, "Операция удалена из очереди:", *id)
+	fmt.Fprintln(a.stdout, "Выполните sync, чтобы загрузить серверную версию секрета")
+	return nil
+}
+
+// canFallBack сообщает, можно ли обслужить команду из локального хранилища
+func (a *App) canFallBack(err error) bool {
+	if a.vault == nil || !errors.Is(err, ErrServerUnavailable) {
+		return false
+	}
+	fmt.Fprintln(a.stderr, "Сервер недоступен, используется локальное хранилище")
+	return true
+}
+
+func (a *App) fetchSecret(client *Client, id string) (*secret.SecretResponse, error) {
+	if a.offline {
+		return a.vault.Get(id)
+	}
+
+	resp, err := client.GetSecret(id)
+	if a.canFallBack(err) {
+		return a.vault.Get(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if a.vault != nil {
+		a.vault.Put(*resp)
+	}
+	return resp, nil
+}
+
+func (a *App) queueCreate(req *secret.CreateSecretRequest) error {
+	resp := a.vault.QueueCreate(req)
+	fmt.Fprintln(a.stderr, "Секрет сохранен локально и будет отправлен при синхронизации")
+
+	stripBinaryData(&resp)
+	return a.printJSON(resp)
+}
+
+func (a *App) queueUpdate(id string, req *secret.UpdateSecretRequest) error {
+	resp, err := a.vault.QueueUpdate(id, req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stderr, "Изменение сохранено локально и будет отправлено при синхронизации")
+
+	stripBinaryData(&resp)
+	return a.printJSON(resp)
+}
+
+func (a *App) queueDelete(id string) error {
+	if err := a.vault.QueueDelete(id); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(a.stdout, "Секрет удален локально и будет удален на сервере при синхронизации:", id)
+	return nil
+}
+
+func (a *App) upload(client *Client, args []string) error {
+	fs := a.newFlagSet("upload")
+	secretType := fs.String("type", string(secret.TypeFile), "тип секрета")
+	login := fs.String("login", "", "логин")
+	fs.String("password", "", "пароль (небезопасно, используйте -ask-password)")
+	askPassword := fs.Bool("ask-password", false, "запросить пароль без отображения ввода")
+	file := fs.String("file", "", "путь к файлу")
+	metadata := metadataFlag{}
+	fs.Var(metadata, "meta", "метаданные key=value (можно указать несколько раз)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "file"); err != nil {
+		return err
+	}
+	password, err := a.secretPassword(fs, *askPassword)
+	if err != nil {
+		return err
+	}
+
+	return a.uploadFile(client, *file, secret.SecretType(*secretType), *login, password, metadata)
+}
+
+func (a *App) download(client *Client, args []string) error {
+	fs := a.newFlagSet("download")
+	id := fs.String("id", "", "ID секрета")
+	out := fs.String("out", "", "путь для сохранения файла")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireFlags(fs, "id", "out"); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("не удалось создать файл: %w", err)
+	}
+
+	written, err := client.DownloadFile(*id, f)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("не удалось закрыть файл: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(a.stdout, "Сохранено %d байт в %s\n", written, *out)
+	return nil
+}
+
+func (a *App) uploadFile(client *Client, path string, secretType secret.SecretType, login, password string, metadata metadataFlag) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("не удалось открыть файл: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("не удалось получить информацию о файле: %w", err)
+	}
+
+	fileMetadata := stringifyMetadata(fileMetadataFor(path, info.Size()))
+	for k, v := range metadata {
+		fileMetadata[k] = v
+	}
+
+	req := &secret.FinalizeChunkedUploadRequest{
+		Type:     secretType,
+		Login:    login,
+		Password: password,
+		Metadata: fileMetadata,
+	}
+
+	resp, err := client.UploadFile(f, info.Size(), req)
+	if err != nil {
+		return err
+	}
+
+	stripBinaryData(resp)
+	return a.printJSON(resp)
+}
+
+func (a *App) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+func (a *App) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func newHTTPClient(insecure bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   requestTimeout,
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func requireFlags(fs *flag.FlagSet, names ...string) error {
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil || f.Value.String() == "" {
+			return fmt.Errorf("%w: -%s", ErrMissingArgument, name)
+		}
+	}
+	return nil
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func stripBinaryData(resp *secret.SecretResponse) {
+	if len(resp.BinaryData) == 0 {
+		return
+	}
+	size := int64(len(resp.BinaryData))
+	resp.BinaryDataSize = &size
+	resp.BinaryData = nil
+}
+
+func readFile(path string) ([]byte, map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("не удалось прочитать файл: %w", err)
+	}
+	return data, fileMetadataFor(path, int64(len(data))), nil
+}
+
+// fileMetadataFor повторяет набор метаданных файла, который формирует веб-клиент
+func fileMetadataFor(path string, size int64) map[string]interface{} {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+
+	return map[string]interface{}{
+		"fileName":      strings.TrimSuffix(base, ext),
+		"fileExtension": strings.TrimPrefix(ext, "."),
+		"fileSize":      strconv.FormatInt(size, 10),
+	}
+}
+
+func mergeMetadata(base map[string]interface{}, overrides metadataFlag) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(overrides))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overrides {
+		result[k] = v
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+func stringifyMetadata(metadata map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		result[k] = fmt.Sprint(v)
+	}
+	return result
+}
+
+// metadataFlag собирает повторяющиеся флаги -meta key=value
+type metadataFlag map[string]string
+
+func (m metadataFlag) String() string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(k + "=" + m[k])
+	}
+	return buf.String()
+}
+
+func (m metadataFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("ожидается формат key=value, получено %q", value)
+	}
+	m[key] = val
+	return nil
+}
+
+func (m metadataFlag) toInterfaceMap() map[string]interface{} {
+	if len(m) == 0 {
+		return nil
+	}
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApp_Version(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	app := NewApp("1.2.3", "2025-01-01", &stdout, &stderr)
+
+	require.NoError(t, app.Run([]string{"version"}))
+	assert.Equal(t, "1.2.3\n", stdout.String())
+}
+
+func TestApp_BuildDate(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	app := NewApp("1.2.3", "2025-01-01", &stdout, &stderr)
+
+	require.NoError(t, app.Run([]string{"build-date"}))
+	assert.Equal(t, "2025-01-01\n", stdout.String())
+}
+
+func TestApp_UnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	app := NewApp("dev", "unknown", &stdout, &stderr)
+
+	err := app.Run([]string{"-session", t.TempDir() + "/s.json", "unknown"})
+
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+}
+
+func TestApp_NoCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	app := NewApp("dev", "unknown", &stdout, &stderr)
+
+	err := app.Run(nil)
+
+	assert.ErrorIs(t, err, ErrMissingArgument)
+	assert.Contains(t, stderr.String(), "Использование")
+}
+
+func TestApp_LoginPersistsSession(t *testing.T) {
+	_, server := newFakeServer(t)
+	sessionPath := t.TempDir() + "/session.json"
+
+	var stdout, stderr bytes.Buffer
+	app := NewApp("dev", "unknown", &stdout, &stderr)
+
+	t.Setenv(EnvPassword, "secret")
+	err := app.Run([]string{
+		"-server", server.URL + "/api",
+		"-session", sessionPath,
+		"login", "-email", "user@example.com",
+	})
+	require.NoError(t, err)
+
+	session, err := LoadSession(sessionPath)
+	require.NoError(t, err)
+	assert.Equal(t, "access-1", session.AccessToken)
+	assert.Equal(t, "refresh-1", session.RefreshToken)
+	assert.Equal(t, server.URL+"/api", session.ServerURL)
+
+	stdout.Reset()
+	err = app.Run([]string{"-server", server.URL + "/api", "-session", sessionPath, "list", "-json"})
+	require.NoError(t, err)
+
+	var secrets []secret.SecretResponse
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &secrets))
+	assert.Len(t, secrets, 1)
+}
+
+func TestApp_LoginRequiresFlags(t *testing.T) {
+	t.Setenv(EnvPassword, "")
+	var stdout, stderr bytes.Buffer
+	app := NewApp("dev", "unknown", &stdout, &stderr)
+	app.stdin = strings.NewReader("")
+
+	err := app.Run([]string{"-session", t.TempDir() + "/s.json", "login"})
+	assert.ErrorIs(t, err, ErrMissingArgument)
+
+	err = app.Run([]string{"-session", t.TempDir() + "/s.json", "login", "-email", "user@example.com"})
+	assert.ErrorIs(t, err, ErrMissingArgument)
+}
+
+func TestApp_LoginPasswordSources(t *testing.T) {
+	_, server := newFakeServer(t)
+	t.Setenv(EnvPassword, "")
+
+	t.Run("stdin", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		app := NewApp("dev", "unknown", &stdout, &stderr)
+		app.stdin = strings.NewReader("secret\n")
+
+		err := app.Run([]string{"-server", server.URL + "/api", "-session", t.TempDir() + "/s.json", "login", "-email", "user@example.com"})
+
+		require.NoError(t, err)
+		assert.Contains(t, stderr.String(), "Пароль: ")
+		assert.NotContains(t, stderr.String(), "Внимание")
+	})
+
+	t.Run("insecure flag", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		app := NewApp("dev", "unknown", &stdout, &stderr)
+		app.stdin = strings.NewReader("")
+
+		err := app.Run([]string{"-server", server.URL + "/api", "-session", t.TempDir() + "/s.json", "login", "-email", "user@example.com", "-password", "secret"})
+
+		require.NoError(t, err)
+		assert.Contains(t, stderr.String(), "Внимание: пароль из флага -password")
+	})
+}
+
+func TestMetadataFlag(t *testing.T) {
+	m := metadataFlag{}
+
+	require.NoError(t, m.Set("app=github"))
+	require.NoError(t, m.Set("url=https://a.b/?x=1"))
+	assert.Error(t, m.Set("invalid"))
+
+	assert.Equal(t, "app=github,url=https://a.b/?x=1", m.String())
+	assert.Equal(t, map[string]interface{}{"app": "github", "url": "https://a.b/?x=1"}, m.toInterfaceMap())
+}
+
+func TestFileMetadataFor(t *testing.T) {
+	metadata := fileMetadataFor("/tmp/report.final.pdf", 42)
+
+	assert.Equal(t, "report.final", metadata["fileName"])
+	assert.Equal(t, "pdf", metadata["fileExtension"])
+	assert.Equal(t, "42", metadata["fileSize"])
+}
+
+func TestIsStatus(t *testing.T) {
+	assert.True(t, IsStatus(&APIError{StatusCode: http.StatusNotFound}, http.StatusNotFound))
+	assert.False(t, IsStatus(ErrNotAuthenticated, http.StatusNotFound))
+}
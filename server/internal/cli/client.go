@@ -0,0 +1,366 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+	"github.com/Adigezalov/goph-keeper/internal/verification"
+)
+
+const (
+	refreshTokenCookieName = "refresh_token"
+	uploadChunkSize        = 100 * 1024
+)
+
+// Client обращается к REST API сервера от имени пользователя CLI
+type Client struct {
+	baseURL        string
+	httpClient     *http.Client
+	session        *Session
+	sessionChanged bool
+}
+
+func NewClient(baseURL string, httpClient *http.Client, session *Session) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if session == nil {
+		session = &Session{}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: httpClient,
+		session:    session,
+	}
+}
+
+func (c *Client) Session() *Session {
+	return c.session
+}
+
+func (c *Client) SessionChanged() bool {
+	return c.sessionChanged
+}
+
+func (c *Client) Register(email, password string) error {
+	req := &user.RegisterRequest{Email: email, Password: password}
+	return c.do(http.MethodPost, "/v1/user/register", req, nil, false)
+}
+
+func (c *Client) VerifyEmail(email, code string) error {
+	req := &verification.VerifyEmailRequest{Email: email, Code: code}
+
+	var resp user.TokenResponse
+	if err := c.do(http.MethodPost, "/v1/user/verify-email", req, &resp, false); err != nil {
+		return err
+	}
+
+	c.setAccessToken(email, resp.AccessToken)
+	return nil
+}
+
+func (c *Client) Login(email, password string) error {
+	req := &user.LoginRequest{Email: email, Password: password}
+
+	var resp user.TokenResponse
+	if err := c.do(http.MethodPost, "/v1/user/login", req, &resp, false); err != nil {
+		return err
+	}
+
+	c.setAccessToken(email, resp.AccessToken)
+	return nil
+}
+
+func (c *Client) Refresh() error {
+	if c.session.RefreshToken == "" {
+		return ErrNotAuthenticated
+	}
+
+	var resp user.TokenResponse
+	if err := c.do(http.MethodGet, "/v1/user/refresh", nil, &resp, false); err != nil {
+		return err
+	}
+
+	c.setAccessToken(c.session.Email, resp.AccessToken)
+	return nil
+}
+
+func (c *Client) Logout() error {
+	err := c.do(http.MethodGet, "/v1/user/logout", nil, nil, false)
+
+	c.session.Clear()
+	c.sessionChanged = true
+
+	return err
+}
+
+// ListSecrets получает все страницы списка секретов. Бинарные данные в список не входят.
+func (c *Client) ListSecrets(secretType secret.SecretType) ([]secret.SecretResponse, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(secret.MaxListLimit))
+	if secretType != "" {
+		query.Set("type", string(secretType))
+	}
+
+	var secrets []secret.SecretResponse
+	for {
+		var page secret.SecretListResponse
+		if err := c.do(http.MethodGet, "/v1/secrets?"+query.Encode(), nil, &page, true); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, page.Secrets...)
+
+		if !page.HasMore {
+			return secrets, nil
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+}
+
+func (c *Client) GetSecret(id string) (*secret.SecretResponse, error) {
+	var resp secret.SecretResponse
+	if err := c.do(http.MethodGet, "/v1/secrets/"+url.PathEscape(id), nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CreateSecret(req *secret.CreateSecretRequest) (*secret.SecretResponse, error) {
+	var resp secret.SecretResponse
+	if err := c.do(http.MethodPost, "/v1/secrets", req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateSecret(id string, req *secret.UpdateSecretRequest) (*secret.SecretResponse, error) {
+	var resp secret.SecretResponse
+	if err := c.do(http.MethodPut, "/v1/secrets/"+url.PathEscape(id), req, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteSecret(id string) error {
+	return c.do(http.MethodDelete, "/v1/secrets/"+url.PathEscape(id), nil, nil, true)
+}
+
+// SyncResult повторяет ответ GET /secrets/sync
+type SyncResult struct {
+	Secrets    []secret.SecretResponse `json:"secrets"`
+	NextCursor string                  `json:"next_cursor"`
+	HasMore    bool                    `json:"has_more"`
+}
+
+// Sync получает одну страницу изменений после cursor (пустой курсор - с начала)
+func (c *Client) Sync(cursor string) (*SyncResult, error) {
+	path := "/v1/secrets/sync"
+	if cursor != "" {
+		path += "?cursor=" + url.QueryEscape(cursor)
+	}
+
+	var resp SyncResult
+	if err := c.do(http.MethodGet, path, nil, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Push отправляет пакет отложенных изменений в POST /secrets/sync/push
+func (c *Client) Push(ops []secret.PushOperation) (*secret.PushResponse, error) {
+	var resp secret.PushResponse
+	if err := c.do(http.MethodPost, "/v1/secrets/sync/push", &secret.PushRequest{Operations: ops}, &resp, true); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UploadFile загружает содержимое r частями через /chunks/* и создает секрет
+func (c *Client) UploadFile(r io.Reader, size int64, req *secret.FinalizeChunkedUploadRequest) (*secret.SecretResponse, error) {
+	// Пустой файл загружается без частей
+	totalChunks := int((size + uploadChunkSize - 1) / uploadChunkSize)
+
+	initReq := &secret.InitChunkedUploadRequest{
+		TotalChunks: totalChunks,
+		TotalSize:   size,
+		Metadata:    req.Metadata,
+	}
+
+	var initResp secret.InitChunkedUploadResponse
+	if err := c.do(http.MethodPost, "/v1/secrets/chunks/init", initReq, &initResp, true); err != nil {
+		return nil, err
+	}
+
+	chunkPath := "/v1/secrets/" + url.PathEscape(initResp.SecretID) + "/chunks"
+	buf := make([]byte, uploadChunkSize)
+	for i := 0; i < totalChunks; i++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("не удалось прочитать часть файла %d: %w", i, err)
+		}
+
+		chunkReq := &secret.UploadChunkRequest{
+			UploadID:    initResp.UploadID,
+			ChunkIndex:  i,
+			TotalChunks: totalChunks,
+			Data:        base64.StdEncoding.EncodeToString(buf[:n]),
+		}
+
+		var chunkResp secret.UploadChunkResponse
+		if err := c.do(http.MethodPost, chunkPath, chunkReq, &chunkResp, true); err != nil {
+			return nil, fmt.Errorf("не удалось загрузить часть %d из %d: %w", i+1, totalChunks, err)
+		}
+	}
+
+	finalizeReq := *req
+	finalizeReq.UploadID = initResp.UploadID
+
+	var resp secret.SecretResponse
+	if err := c.do(http.MethodPost, chunkPath+"/finalize", &finalizeReq, &resp, true); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// DownloadFile скачивает бинарные данные секрета по частям и пишет их в w
+func (c *Client) DownloadFile(id string, w io.Writer) (int64, error) {
+	var written int64
+
+	for index, total := 0, 1; index < total; index++ {
+		var chunk secret.DownloadChunkResponse
+		path := fmt.Sprintf("/v1/secrets/%s/chunks/%d", url.PathEscape(id), index)
+		if err := c.do(http.MethodGet, path, nil, &chunk, true); err != nil {
+			return written, err
+		}
+
+		data, err := base64.StdEncoding.DecodeString(chunk.Data)
+		if err != nil {
+			return written, fmt.Errorf("не удалось декодировать часть %d: %w", index, err)
+		}
+
+		n, err := w.Write(data)
+		written += int64(n)
+		if err != nil {
+			return written, fmt.Errorf("не удалось записать часть %d: %w", index, err)
+		}
+
+		total = chunk.TotalChunks
+	}
+
+	return written, nil
+}
+
+func (c *Client) setAccessToken(email, accessToken string) {
+	c.session.Email = email
+	c.session.AccessToken = accessToken
+	c.sessionChanged = true
+}
+
+func (c *Client) do(method, path string, body interface{}, out interface{}, auth bool) error {
+	if auth && !c.session.IsAuthenticated() {
+		return ErrNotAuthenticated
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("не удалось сериализовать запрос: %w", err)
+		}
+	}
+
+	resp, err := c.send(method, path, payload, auth)
+	if err != nil {
+		return err
+	}
+
+	if auth && resp.StatusCode == http.StatusUnauthorized && c.session.RefreshToken != "" {
+		resp.Body.Close()
+
+		if err := c.Refresh(); err != nil {
+			return err
+		}
+
+		resp, err = c.send(method, path, payload, auth)
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	c.captureRefreshToken(resp)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("не удалось разобрать ответ сервера: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) send(method, path string, payload []byte, auth bool) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать запрос: %w", err)
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if auth {
+		req.Header.Set("Authorization", "Bearer "+c.session.AccessToken)
+	}
+	if c.session.RefreshToken != "" {
+		req.AddCookie(&http.Cookie{Name: refreshTokenCookieName, Value: c.session.RefreshToken})
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrServerUnavailable, err)
+	}
+
+	return resp, nil
+}
+
+func (c *Client) captureRefreshToken(resp *http.Response) {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name != refreshTokenCookieName {
+			continue
+		}
+
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			c.session.RefreshToken = ""
+		} else {
+			c.session.RefreshToken = cookie.Value
+		}
+		c.sessionChanged = true
+	}
+}
@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/Adigezalov/goph-keeper/internal/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeServer struct {
+	accessToken  string
+	refreshToken string
+	uploaded     map[int][]byte
+	blob         []byte
+	init         secret.InitChunkedUploadRequest
+	finalize     secret.FinalizeChunkedUploadRequest
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	fs := &fakeServer{
+		accessToken:  "access-1",
+		refreshToken: "refresh-1",
+		uploaded:     make(map[int][]byte),
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v1/user/login", func(w http.ResponseWriter, r *http.Request) {
+		var req user.LoginRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Password != "secret" {
+			http.Error(w, "Неверная пара email/пароль", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: fs.refreshToken})
+		json.NewEncoder(w).Encode(user.TokenResponse{AccessToken: fs.accessToken})
+	})
+
+	mux.HandleFunc("/api/v1/user/refresh", func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("refresh_token")
+		if err != nil || cookie.Value != fs.refreshToken {
+			http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+			return
+		}
+		fs.accessToken = "access-2"
+		fs.refreshToken = "refresh-2"
+		http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: fs.refreshToken})
+		json.NewEncoder(w).Encode(user.TokenResponse{AccessToken: fs.accessToken})
+	})
+
+	mux.HandleFunc("/api/v1/user/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: "", MaxAge: -1})
+	})
+
+	mux.HandleFunc("/api/v1/secrets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fs.accessToken {
+			http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(secret.SecretListResponse{Secrets: []secret.SecretResponse{{ID: "s1", Login: "l", Version: 1}}})
+	})
+
+	mux.HandleFunc("/api/v1/secrets/chunks/init", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&fs.init))
+		json.NewEncoder(w).Encode(secret.InitChunkedUploadResponse{UploadID: "u1", SecretID: "s2"})
+	})
+
+	mux.HandleFunc("/api/v1/secrets/s2/chunks", func(w http.ResponseWriter, r *http.Request) {
+		var req secret.UploadChunkRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		data, err := base64.StdEncoding.DecodeString(req.Data)
+		require.NoError(t, err)
+		fs.uploaded[req.ChunkIndex] = data
+		json.NewEncoder(w).Encode(secret.UploadChunkResponse{ChunkIndex: req.ChunkIndex, Received: true})
+	})
+
+	mux.HandleFunc("/api/v1/secrets/s2/chunks/finalize", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&fs.finalize))
+		json.NewEncoder(w).Encode(secret.SecretResponse{ID: "s2", Version: 1})
+	})
+
+	mux.HandleFunc("/api/v1/secrets/s3/chunks/", func(w http.ResponseWriter, r *http.Request) {
+		index := 0
+		if strings.HasSuffix(r.URL.Path, "/1") {
+			index = 1
+		}
+		chunks := secret.SplitIntoChunks(fs.blob, uploadChunkSize)
+		json.NewEncoder(w).Encode(secret.DownloadChunkResponse{
+			ChunkIndex:  index,
+			Data:        base64.StdEncoding.EncodeToString(chunks[index]),
+			TotalChunks: len(chunks),
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return fs, server
+}
+
+func TestClient_Login(t *testing.T) {
+	_, server := newFakeServer(t)
+	client := NewClient(server.URL+"/api", server.Client(), nil)
+
+	require.NoError(t, client.Login("user@example.com", "secret"))
+
+	assert.True(t, client.SessionChanged())
+	assert.Equal(t, "user@example.com", client.Session().Email)
+	assert.Equal(t, "access-1", client.Session().AccessToken)
+	assert.Equal(t, "refresh-1", client.Session().RefreshToken)
+}
+
+func TestClient_Login_InvalidCredentials(t *testing.T) {
+	_, server := newFakeServer(t)
+	client := NewClient(server.URL+"/api", server.Client(), nil)
+
+	err := client.Login("user@example.com", "wrong")
+
+	require.Error(t, err)
+	assert.True(t, IsStatus(err, http.StatusBadRequest))
+	assert.False(t, client.Session().IsAuthenticated())
+}
+
+func TestClient_ListSecrets_RequiresAuth(t *testing.T) {
+	_, server := newFakeServer(t)
+	client := NewClient(server.URL+"/api", server.Client(), nil)
+
+	_, err := client.ListSecrets("")
+
+	assert.ErrorIs(t, err, ErrNotAuthenticated)
+}
+
+func TestClient_ListSecrets_RefreshesExpiredToken(t *testing.T) {
+	_, server := newFakeServer(t)
+	session := &Session{AccessToken: "expired", RefreshToken: "refresh-1"}
+	client := NewClient(server.URL+"/api", server.Client(), session)
+
+	secrets, err := client.ListSecrets("")
+
+	require.NoError(t, err)
+	require.Len(t, secrets, 1)
+	assert.Equal(t, "s1", secrets[0].ID)
+	assert.Equal(t, "access-2", session.AccessToken)
+	assert.Equal(t, "refresh-2", session.RefreshToken)
+	assert.True(t, client.SessionChanged())
+}
+
+func TestClient_ListSecrets_FollowsCursor(t *testing.T) {
+	var cursors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		cursors = append(cursors, cursor)
+		if cursor == "" {
+			json.NewEncoder(w).Encode(secret.SecretListResponse{
+				Secrets:    []secret.SecretResponse{{ID: "s1"}},
+				NextCursor: "page-2",
+				HasMore:    true,
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(secret.SecretListResponse{Secrets: []secret.SecretResponse{{ID: "s2"}}})
+	}))
+	t.Cleanup(server.Close)
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "a", RefreshToken: "r"})
+
+	secrets, err := client.ListSecrets(secret.TypeLogin)
+
+	require.NoError(t, err)
+	require.Len(t, secrets, 2)
+	assert.Equal(t, "s2", secrets[1].ID)
+	assert.Equal(t, []string{"", "page-2"}, cursors)
+}
+
+func TestClient_Logout_ClearsSession(t *testing.T) {
+	_, server := newFakeServer(t)
+	session := &Session{Email: "user@example.com", AccessToken: "a", RefreshToken: "r"}
+	client := NewClient(server.URL+"/api", server.Client(), session)
+
+	require.NoError(t, client.Logout())
+
+	assert.False(t, session.IsAuthenticated())
+	assert.Empty(t, session.RefreshToken)
+}
+
+func TestClient_UploadFile(t *testing.T) {
+	fs, server := newFakeServer(t)
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "access-1"})
+
+	data := bytes.Repeat([]byte("x"), uploadChunkSize+10)
+	resp, err := client.UploadFile(bytes.NewReader(data), int64(len(data)), &secret.FinalizeChunkedUploadRequest{
+		Login:    "login",
+		Password: "password",
+		Metadata: map[string]string{"fileName": "test"},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, "s2", resp.ID)
+	require.Len(t, fs.uploaded, 2)
+	assert.Len(t, fs.uploaded[0], uploadChunkSize)
+	assert.Len(t, fs.uploaded[1], 10)
+	assert.Equal(t, "u1", fs.finalize.UploadID)
+	assert.Equal(t, "login", fs.finalize.Login)
+}
+
+func TestClient_UploadFile_Empty(t *testing.T) {
+	fs, server := newFakeServer(t)
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "access-1"})
+
+	resp, err := client.UploadFile(bytes.NewReader(nil), 0, &secret.FinalizeChunkedUploadRequest{})
+
+	require.NoError(t, err)
+	assert.Equal(t, "s2", resp.ID)
+	assert.Equal(t, 0, fs.init.TotalChunks)
+	assert.Equal(t, int64(0), fs.init.TotalSize)
+	assert.Empty(t, fs.uploaded, "пустой файл загружается без частей")
+	assert.Equal(t, "u1", fs.finalize.UploadID)
+}
+
+func TestClient_DownloadFile(t *testing.T) {
+	fs, server := newFakeServer(t)
+	fs.blob = bytes.Repeat([]byte("y"), uploadChunkSize+5)
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "access-1"})
+
+	var buf bytes.Buffer
+	written, err := client.DownloadFile("s3", &buf)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(fs.blob)), written)
+	assert.Equal(t, fs.blob, buf.Bytes())
+}
+
+func TestSession_SaveAndLoad(t *testing.T) {
+	path := t.TempDir() + "/nested/session.json"
+	session := &Session{ServerURL: "https://example.com/api", Email: "a@b.c", AccessToken: "a", RefreshToken: "r"}
+
+	require.NoError(t, session.Save(path))
+
+	loaded, err := LoadSession(path)
+	require.NoError(t, err)
+	assert.Equal(t, session, loaded)
+}
+
+func TestLoadSession_MissingFile(t *testing.T) {
+	loaded, err := LoadSession(t.TempDir() + "/missing.json")
+
+	require.NoError(t, err)
+	assert.False(t, loaded.IsAuthenticated())
+}
+
+func TestAPIError_Error(t *testing.T) {
+	err := &APIError{StatusCode: http.StatusConflict, Message: "Конфликт"}
+	assert.Contains(t, err.Error(), "409")
+	assert.Contains(t, err.Error(), "Конфликт")
+}
@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotAuthenticated  = errors.New("необходимо выполнить вход: keeper-cli login")
+	ErrUnknownCommand    = errors.New("неизвестная команда")
+	ErrMissingArgument   = errors.New("не указан обязательный аргумент")
+	ErrServerUnavailable = errors.New("сервер недоступен")
+)
+
+// APIError описывает неуспешный ответ сервера
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("сервер вернул статус %d", e.StatusCode)
+	}
+	return fmt.Sprintf("сервер вернул статус %d: %s", e.StatusCode, e.Message)
+}
+
+func IsStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
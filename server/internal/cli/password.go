@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	// EnvPassword задает пароль аккаунта для register и login без ввода с клавиатуры
+	EnvPassword = "KEEPER_PASSWORD"
+	// EnvMasterPassword задает мастер-пароль локального хранилища
+	EnvMasterPassword = "KEEPER_MASTER_PASSWORD"
+)
+
+// warnInsecureFlag предупреждает, что пароль передан флагом: значения из argv видны
+// в списке процессов и остаются в истории shell
+func (a *App) warnInsecureFlag(name, alternative string) {
+	fmt.Fprintf(a.stderr, "Внимание: пароль из флага -%s виден другим пользователям системы, используйте %s\n", name, alternative)
+}
+
+// accountPassword возвращает пароль аккаунта: из флага, если он явно задан (небезопасный
+// запасной вариант), иначе из KEEPER_PASSWORD, иначе запрашивает его без эха
+func (a *App) accountPassword(fs *flag.FlagSet) (string, error) {
+	if isFlagSet(fs, "password") {
+		a.warnInsecureFlag("password", EnvPassword)
+		return fs.Lookup("password").Value.String(), nil
+	}
+	if password := os.Getenv(EnvPassword); password != "" {
+		return password, nil
+	}
+
+	password, err := a.promptPassword("Пароль")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", fmt.Errorf("%w: пароль (%s или ввод с клавиатуры)", ErrMissingArgument, EnvPassword)
+	}
+	return password, nil
+}
+
+// secretPassword возвращает пароль, который сохраняется в секрете: по -ask-password он
+// запрашивается без эха, флаг -password оставлен как небезопасный запасной вариант
+func (a *App) secretPassword(fs *flag.FlagSet, ask bool) (string, error) {
+	if ask {
+		return a.promptPassword("Пароль секрета")
+	}
+	if isFlagSet(fs, "password") {
+		a.warnInsecureFlag("password", "-ask-password")
+		return fs.Lookup("password").Value.String(), nil
+	}
+	return "", nil
+}
+
+// promptPassword печатает приглашение в stderr и читает строку из stdin. Если stdin —
+// терминал, пароль читается без эха средствами ОС (в том числе на Windows); из канала
+// пароль читается как есть.
+func (a *App) promptPassword(prompt string) (string, error) {
+	fmt.Fprint(a.stderr, prompt+": ")
+
+	if f, ok := a.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		password, err := term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(a.stderr)
+		if err != nil {
+			return "", fmt.Errorf("не удалось прочитать пароль: %w", err)
+		}
+		return string(password), nil
+	}
+
+	if a.input == nil {
+		a.input = bufio.NewReader(a.stdin)
+	}
+	line, err := a.input.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("не удалось прочитать пароль: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const sessionFileName = "session.json"
+
+// Session хранит состояние авторизации CLI между запусками
+type Session struct {
+	ServerURL    string `json:"server_url"`
+	Email        string `json:"email,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+func DefaultConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("не удалось определить каталог конфигурации: %w", err)
+	}
+	return filepath.Join(dir, "goph-keeper"), nil
+}
+
+func DefaultSessionPath() (string, error) {
+	dir, err := DefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionFileName), nil
+}
+
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Session{}, nil
+		}
+		return nil, fmt.Errorf("не удалось прочитать файл сессии: %w", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать файл сессии: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (s *Session) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("не удалось создать каталог сессии: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("не удалось сериализовать сессию: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("не удалось сохранить файл сессии: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Session) Clear() {
+	s.Email = ""
+	s.AccessToken = ""
+	s.RefreshToken = ""
+}
+
+func (s *Session) IsAuthenticated() bool {
+	return s.AccessToken != ""
+}
@@ -0,0 +1,528 @@
+package cli
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	vaultFileName      = "vault.bin"
+	vaultFormatVersion = 1
+	// localIDPrefix - временные ID секретов, созданных офлайн до того, как ID стали генерироваться на клиенте
+	localIDPrefix = "local-"
+
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonKeyLen  = 32
+	saltLen      = 16
+)
+
+var (
+	ErrInvalidMasterPassword = errors.New("неверный мастер-пароль или поврежденное хранилище")
+	ErrSecretNotCached       = errors.New("секрет отсутствует в локальном хранилище")
+)
+
+type PendingAction string
+
+const (
+	PendingCreate PendingAction = "create"
+	PendingUpdate PendingAction = "update"
+	PendingDelete PendingAction = "delete"
+)
+
+// PendingOperation описывает изменение, сделанное без связи с сервером
+type PendingOperation struct {
+	ID          string                 `json:"id"`
+	Action      PendingAction          `json:"action"`
+	SecretID    string                 `json:"secret_id"`
+	BaseVersion int                    `json:"base_version,omitempty"`
+	Type        secret.SecretType      `json:"type,omitempty"`
+	Login       string                 `json:"login,omitempty"`
+	Password    string                 `json:"password,omitempty"`
+	Text        string                 `json:"text,omitempty"`
+	Card        *secret.CardData       `json:"card,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	BinaryData  []byte                 `json:"binary_data,omitempty"`
+	QueuedAt    time.Time              `json:"queued_at"`
+	Conflict    bool                   `json:"conflict,omitempty"`
+}
+
+type vaultData struct {
+	Secrets map[string]secret.SecretResponse `json:"secrets"`
+	Pending []PendingOperation               `json:"pending"`
+	Cursor  string                           `json:"cursor,omitempty"`
+}
+
+type vaultEnvelope struct {
+	Version    int    `json:"version"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Vault - зашифрованная локальная копия секретов пользователя.
+// Файл запечатан AES-256-GCM ключом, выведенным из мастер-пароля через Argon2id.
+type Vault struct {
+	path string
+	salt []byte
+	key  []byte
+	data vaultData
+}
+
+func DefaultVaultPath() (string, error) {
+	dir, err := DefaultConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, vaultFileName), nil
+}
+
+func OpenVault(path, masterPassword string) (*Vault, error) {
+	if masterPassword == "" {
+		return nil, fmt.Errorf("%w: мастер-пароль", ErrMissingArgument)
+	}
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		salt := make([]byte, saltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("не удалось сгенерировать соль: %w", err)
+		}
+		return &Vault{
+			path: path,
+			salt: salt,
+			key:  deriveVaultKey(masterPassword, salt),
+			data: vaultData{Secrets: make(map[string]secret.SecretResponse)},
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать хранилище: %w", err)
+	}
+
+	var envelope vaultEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать хранилище: %w", err)
+	}
+	if envelope.Version != vaultFormatVersion {
+		return nil, fmt.Errorf("неподдерживаемая версия хранилища: %d", envelope.Version)
+	}
+
+	key := deriveVaultKey(masterPassword, envelope.Salt)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, envelope.Nonce, envelope.Ciphertext, envelope.Salt)
+	if err != nil {
+		return nil, ErrInvalidMasterPassword
+	}
+
+	var data vaultData
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать содержимое хранилища: %w", err)
+	}
+	if data.Secrets == nil {
+		data.Secrets = make(map[string]secret.SecretResponse)
+	}
+
+	return &Vault{path: path, salt: envelope.Salt, key: key, data: data}, nil
+}
+
+func (v *Vault) Save() error {
+	plaintext, err := json.Marshal(v.data)
+	if err != nil {
+		return fmt.Errorf("не удалось сериализовать хранилище: %w", err)
+	}
+
+	gcm, err := newGCM(v.key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("не удалось сгенерировать nonce: %w", err)
+	}
+
+	raw, err := json.Marshal(vaultEnvelope{
+		Version:    vaultFormatVersion,
+		Salt:       v.salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, v.salt),
+	})
+	if err != nil {
+		return fmt.Errorf("не удалось сериализовать хранилище: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(v.path), 0o700); err != nil {
+		return fmt.Errorf("не удалось создать каталог хранилища: %w", err)
+	}
+
+	tmp := v.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("не удалось записать хранилище: %w", err)
+	}
+	if err := os.Rename(tmp, v.path); err != nil {
+		return fmt.Errorf("не удалось сохранить хранилище: %w", err)
+	}
+
+	return nil
+}
+
+// Cursor возвращает позицию последней примененной страницы синхронизации
+func (v *Vault) Cursor() string {
+	return v.data.Cursor
+}
+
+// ApplySync применяет страницу GET /secrets/sync, удаляя секреты с deleted_at.
+// Секреты с неотправленными изменениями не перезаписываются, чтобы локальная правка
+// не потерялась; если на сервере уже более новая версия, операция помечается конфликтом.
+func (v *Vault) ApplySync(secrets []secret.SecretResponse, cursor string) {
+	for _, s := range secrets {
+		if v.markPendingConflicts(s) {
+			continue
+		}
+		if s.DeletedAt != nil {
+			delete(v.data.Secrets, s.ID)
+			continue
+		}
+		v.data.Secrets[s.ID] = s
+	}
+	v.data.Cursor = cursor
+}
+
+func (v *Vault) Put(s secret.SecretResponse) {
+	if s.DeletedAt != nil {
+		delete(v.data.Secrets, s.ID)
+		return
+	}
+	v.data.Secrets[s.ID] = s
+}
+
+func (v *Vault) Remove(id string) {
+	delete(v.data.Secrets, id)
+}
+
+func (v *Vault) Get(id string) (*secret.SecretResponse, error) {
+	s, ok := v.data.Secrets[id]
+	if !ok {
+		return nil, ErrSecretNotCached
+	}
+	return &s, nil
+}
+
+// List возвращает секреты из хранилища; пустой secretType означает все типы
+func (v *Vault) List(secretType secret.SecretType) []secret.SecretResponse {
+	secrets := make([]secret.SecretResponse, 0, len(v.data.Secrets))
+	for _, s := range v.data.Secrets {
+		if secretType != "" && s.Type != secretType {
+			continue
+		}
+		secrets = append(secrets, s)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].CreatedAt.After(secrets[j].CreatedAt)
+	})
+	return secrets
+}
+
+func (v *Vault) Pending() []PendingOperation {
+	return append([]PendingOperation(nil), v.data.Pending...)
+}
+
+// QueueCreate сохраняет секрет локально до отправки на сервер. ID секрета генерируется
+// на клиенте (если не задан в запросе) и остается тем же после синхронизации.
+func (v *Vault) QueueCreate(req *secret.CreateSecretRequest) secret.SecretResponse {
+	now := time.Now()
+	id := req.ID
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	s := secret.SecretResponse{
+		ID:         id,
+		Type:       req.Type,
+		Login:      req.Login,
+		Password:   req.Password,
+		Text:       req.Text,
+		Card:       req.Card,
+		Metadata:   req.Metadata,
+		BinaryData: req.BinaryData,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	v.data.Secrets[id] = s
+
+	v.data.Pending = append(v.data.Pending, PendingOperation{
+		ID:         uuid.New().String(),
+		Action:     PendingCreate,
+		SecretID:   id,
+		Type:       req.Type,
+		Login:      req.Login,
+		Password:   req.Password,
+		Text:       req.Text,
+		Card:       req.Card,
+		Metadata:   req.Metadata,
+		BinaryData: req.BinaryData,
+		QueuedAt:   now,
+	})
+
+	return s
+}
+
+// QueueUpdate применяет изменение локально; version запроса становится базовой версией для сервера
+func (v *Vault) QueueUpdate(id string, req *secret.UpdateSecretRequest) (secret.SecretResponse, error) {
+	s, ok := v.data.Secrets[id]
+	if !ok {
+		return secret.SecretResponse{}, ErrSecretNotCached
+	}
+
+	s.Type = req.Type
+	s.Login = req.Login
+	s.Password = req.Password
+	s.Text = req.Text
+	s.Card = req.Card
+	s.Metadata = req.Metadata
+	s.BinaryData = req.BinaryData
+	s.UpdatedAt = time.Now()
+	v.data.Secrets[id] = s
+
+	op := v.findPending(id, PendingCreate)
+	if op == nil {
+		op = v.findPending(id, PendingUpdate)
+	}
+	if op == nil {
+		v.data.Pending = append(v.data.Pending, PendingOperation{
+			ID:          uuid.New().String(),
+			Action:      PendingUpdate,
+			SecretID:    id,
+			BaseVersion: req.Version,
+			QueuedAt:    time.Now(),
+		})
+		op = &v.data.Pending[len(v.data.Pending)-1]
+	}
+
+	op.Type = req.Type
+	op.Login = req.Login
+	op.Password = req.Password
+	op.Text = req.Text
+	op.Card = req.Card
+	op.Metadata = req.Metadata
+	op.BinaryData = req.BinaryData
+
+	return s, nil
+}
+
+func (v *Vault) QueueDelete(id string) error {
+	s, ok := v.data.Secrets[id]
+	if !ok {
+		return ErrSecretNotCached
+	}
+	delete(v.data.Secrets, id)
+	v.dropPendingFor(id)
+
+	// Секрет со старым временным ID точно не попал на сервер. Созданный с ID клиента мог попасть,
+	// если ответ на создание не дошел, поэтому удаление отправляется и для него.
+	if strings.HasPrefix(id, localIDPrefix) {
+		return nil
+	}
+
+	v.data.Pending = append(v.data.Pending, PendingOperation{
+		ID:          uuid.New().String(),
+		Action:      PendingDelete,
+		SecretID:    id,
+		BaseVersion: s.Version,
+		QueuedAt:    time.Now(),
+	})
+
+	return nil
+}
+
+// Discard удаляет операцию из очереди. Пока операция ждала отправки, синхронизация
+// не трогала локальную копию секрета, поэтому копия удаляется, а курсор сбрасывается:
+// следующий sync загрузит серверную версию.
+func (v *Vault) Discard(operationID string) bool {
+	for i, op := range v.data.Pending {
+		if op.ID == operationID {
+			v.data.Pending = append(v.data.Pending[:i], v.data.Pending[i+1:]...)
+			if !v.hasPending(op.SecretID) {
+				delete(v.data.Secrets, op.SecretID)
+				v.data.Cursor = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// ReplayReport итог отправки отложенных изменений на сервер
+type ReplayReport struct {
+	Applied   int
+	Conflicts []PendingOperation
+	Rejected  []RejectedOperation
+}
+
+// RejectedOperation - операция, которую сервер не примет и при повторной отправке
+type RejectedOperation struct {
+	PendingOperation
+	Reason string
+}
+
+// Replay отправляет отложенные изменения одним пакетом. Операции с конфликтом
+// версий остаются в очереди с пометкой conflict, отклоненные сервером - без пометки,
+// пока их не отменят через discard. Сетевая ошибка не теряет операции.
+func (v *Vault) Replay(client *Client) (*ReplayReport, error) {
+	report := &ReplayReport{}
+	if len(v.data.Pending) == 0 {
+		return report, nil
+	}
+
+	ops := make([]secret.PushOperation, 0, len(v.data.Pending))
+	for _, op := range v.data.Pending {
+		ops = append(ops, op.toPush())
+	}
+
+	resp, err := client.Push(ops)
+	if err != nil {
+		return report, err
+	}
+	if len(resp.Results) != len(ops) {
+		return report, fmt.Errorf("сервер вернул %d результатов на %d операций", len(resp.Results), len(ops))
+	}
+
+	remaining := make([]PendingOperation, 0)
+	for i, result := range resp.Results {
+		op := v.data.Pending[i]
+
+		switch {
+		case result.Status == secret.PushApplied:
+			report.Applied++
+			v.applyPushed(op, result.Secret)
+		case result.Status == secret.PushNotFound && op.Action == PendingDelete:
+			report.Applied++
+		case result.Status == secret.PushConflict && op.Action == PendingCreate:
+			// Секрет с этим ID уже создан: предыдущая отправка дошла, но ответ на нее потерялся
+			report.Applied++
+			v.applyPushed(op, result.Secret)
+		case result.Status == secret.PushConflict:
+			op.Conflict = true
+			report.Conflicts = append(report.Conflicts, op)
+			remaining = append(remaining, op)
+		default:
+			reason := result.Error
+			if reason == "" {
+				reason = string(result.Status)
+			}
+			report.Rejected = append(report.Rejected, RejectedOperation{PendingOperation: op, Reason: reason})
+			remaining = append(remaining, op)
+		}
+	}
+
+	v.data.Pending = remaining
+	return report, nil
+}
+
+func (op PendingOperation) toPush() secret.PushOperation {
+	push := secret.PushOperation{
+		ClientID:    op.ID,
+		Action:      secret.PushAction(op.Action),
+		BaseVersion: op.BaseVersion,
+		Type:        op.Type,
+		Login:       op.Login,
+		Password:    op.Password,
+		Text:        op.Text,
+		Card:        op.Card,
+		Metadata:    op.Metadata,
+		BinaryData:  op.BinaryData,
+	}
+	if !strings.HasPrefix(op.SecretID, localIDPrefix) {
+		push.SecretID = op.SecretID
+	}
+	return push
+}
+
+// applyPushed обновляет кэш после примененной операции. Секрет со старым временным ID получает серверный.
+func (v *Vault) applyPushed(op PendingOperation, resp *secret.SecretResponse) {
+	if op.Action == PendingCreate {
+		delete(v.data.Secrets, op.SecretID)
+	}
+	if resp != nil {
+		v.data.Secrets[resp.ID] = *resp
+	}
+}
+
+// markPendingConflicts сообщает, есть ли в очереди операции над секретом, и помечает
+// конфликтом те, что основаны на версии старше серверной
+func (v *Vault) markPendingConflicts(s secret.SecretResponse) bool {
+	found := false
+	for i := range v.data.Pending {
+		op := &v.data.Pending[i]
+		if op.SecretID != s.ID {
+			continue
+		}
+		found = true
+		if op.BaseVersion > 0 && (s.Version > op.BaseVersion || s.DeletedAt != nil) {
+			op.Conflict = true
+		}
+	}
+	return found
+}
+
+func (v *Vault) hasPending(secretID string) bool {
+	for _, op := range v.data.Pending {
+		if op.SecretID == secretID {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Vault) findPending(secretID string, action PendingAction) *PendingOperation {
+	for i := range v.data.Pending {
+		if v.data.Pending[i].SecretID == secretID && v.data.Pending[i].Action == action {
+			return &v.data.Pending[i]
+		}
+	}
+	return nil
+}
+
+func (v *Vault) dropPendingFor(secretID string) {
+	remaining := v.data.Pending[:0]
+	for _, op := range v.data.Pending {
+		if op.SecretID != secretID {
+			remaining = append(remaining, op)
+		}
+	}
+	v.data.Pending = remaining
+}
+
+func deriveVaultKey(masterPassword string, salt []byte) []byte {
+	return argon2.IDKey([]byte(masterPassword), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать шифр: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать GCM: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVault_SaveAndOpen(t *testing.T) {
+	path := t.TempDir() + "/vault.bin"
+
+	vault, err := OpenVault(path, "master")
+	require.NoError(t, err)
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1", Login: "login", Password: "p@ss", Version: 2}}, "cursor-1")
+	require.NoError(t, vault.Save())
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "p@ss")
+
+	reopened, err := OpenVault(path, "master")
+	require.NoError(t, err)
+	s, err := reopened.Get("s1")
+	require.NoError(t, err)
+	assert.Equal(t, "p@ss", s.Password)
+	assert.Equal(t, "cursor-1", reopened.Cursor())
+}
+
+func TestVault_WrongMasterPassword(t *testing.T) {
+	path := t.TempDir() + "/vault.bin"
+
+	vault, err := OpenVault(path, "master")
+	require.NoError(t, err)
+	require.NoError(t, vault.Save())
+
+	_, err = OpenVault(path, "other")
+	assert.ErrorIs(t, err, ErrInvalidMasterPassword)
+}
+
+func TestVault_ApplySync_DropsTombstones(t *testing.T) {
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1"}, {ID: "s2"}}, "t1")
+	deletedAt := time.Now()
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1", DeletedAt: &deletedAt}}, "t2")
+
+	_, err = vault.Get("s1")
+	assert.ErrorIs(t, err, ErrSecretNotCached)
+	assert.Len(t, vault.List(""), 1)
+	assert.Equal(t, "t2", vault.Cursor())
+}
+
+func TestVault_ApplySync_KeepsPendingChanges(t *testing.T) {
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1", Login: "old", Version: 3}, {ID: "s2", Version: 1}}, "t1")
+
+	_, err = vault.QueueUpdate("s1", &secret.UpdateSecretRequest{Login: "local", Version: 3})
+	require.NoError(t, err)
+	require.NoError(t, vault.QueueDelete("s2"))
+
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1", Login: "remote", Version: 4}, {ID: "s2", Version: 1}}, "t2")
+
+	cached, err := vault.Get("s1")
+	require.NoError(t, err)
+	assert.Equal(t, "local", cached.Login)
+	_, err = vault.Get("s2")
+	assert.ErrorIs(t, err, ErrSecretNotCached)
+
+	pending := vault.Pending()
+	require.Len(t, pending, 2)
+	assert.True(t, pending[0].Conflict)
+	assert.False(t, pending[1].Conflict)
+	assert.Equal(t, "t2", vault.Cursor())
+
+	// После discard локальная правка отбрасывается, серверная версия придет со следующим sync
+	require.True(t, vault.Discard(pending[0].ID))
+	_, err = vault.Get("s1")
+	assert.ErrorIs(t, err, ErrSecretNotCached)
+	assert.Empty(t, vault.Cursor())
+}
+
+func TestVault_QueueCollapsesOperations(t *testing.T) {
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1", Login: "old", Version: 3}}, "t1")
+
+	created := vault.QueueCreate(&secret.CreateSecretRequest{Login: "new"})
+	_, err = vault.QueueUpdate(created.ID, &secret.UpdateSecretRequest{Login: "new2"})
+	require.NoError(t, err)
+
+	_, err = vault.QueueUpdate("s1", &secret.UpdateSecretRequest{Login: "a", Version: 3})
+	require.NoError(t, err)
+	_, err = vault.QueueUpdate("s1", &secret.UpdateSecretRequest{Login: "b", Version: 3})
+	require.NoError(t, err)
+
+	pending := vault.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, PendingCreate, pending[0].Action)
+	assert.Equal(t, "new2", pending[0].Login)
+	assert.Equal(t, PendingUpdate, pending[1].Action)
+	assert.Equal(t, "b", pending[1].Login)
+	assert.Equal(t, 3, pending[1].BaseVersion)
+
+	require.NoError(t, vault.QueueDelete(created.ID))
+	require.NoError(t, vault.QueueDelete("s1"))
+
+	// Создание могло дойти до сервера, поэтому вместо него отправляется удаление без проверки версии
+	pending = vault.Pending()
+	require.Len(t, pending, 2)
+	assert.Equal(t, PendingDelete, pending[0].Action)
+	assert.Equal(t, created.ID, pending[0].SecretID)
+	assert.Zero(t, pending[0].BaseVersion)
+	assert.Equal(t, PendingDelete, pending[1].Action)
+	assert.Equal(t, "s1", pending[1].SecretID)
+}
+
+func TestVault_Replay(t *testing.T) {
+	var pushed []secret.PushOperation
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/secrets/sync/push", func(w http.ResponseWriter, r *http.Request) {
+		var req secret.PushRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		pushed = req.Operations
+
+		var resp secret.PushResponse
+		for _, op := range req.Operations {
+			result := secret.PushResultResponse{ClientID: op.ClientID}
+			switch op.Action {
+			case secret.PushCreate:
+				result.Status = secret.PushApplied
+				result.Secret = &secret.SecretResponse{ID: op.SecretID, Login: op.Login, Version: 1}
+			case secret.PushUpdate:
+				result.Status = secret.PushConflict
+				result.Secret = &secret.SecretResponse{ID: op.SecretID, Version: 2}
+			case secret.PushDelete:
+				result.Status = secret.PushNotFound
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "a"})
+
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+	vault.ApplySync([]secret.SecretResponse{{ID: "s1", Version: 1}, {ID: "s2", Version: 1}}, "t1")
+
+	created := vault.QueueCreate(&secret.CreateSecretRequest{Login: "offline"})
+	_, err = vault.QueueUpdate("s1", &secret.UpdateSecretRequest{Login: "x", Version: 1})
+	require.NoError(t, err)
+	require.NoError(t, vault.QueueDelete("s2"))
+
+	report, err := vault.Replay(client)
+	require.NoError(t, err)
+
+	require.Len(t, pushed, 3)
+	assert.Equal(t, created.ID, pushed[0].SecretID)
+	assert.Equal(t, 1, pushed[1].BaseVersion)
+
+	assert.Equal(t, 2, report.Applied)
+	require.Len(t, report.Conflicts, 1)
+	assert.Equal(t, "s1", report.Conflicts[0].SecretID)
+
+	pending := vault.Pending()
+	require.Len(t, pending, 1)
+	assert.True(t, pending[0].Conflict)
+
+	s, err := vault.Get(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "offline", s.Login)
+	assert.Equal(t, 1, s.Version)
+}
+
+func TestVault_Replay_RepeatedCreate(t *testing.T) {
+	var pushed []secret.PushOperation
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req secret.PushRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		pushed = req.Operations
+
+		// Оба секрета уже созданы предыдущей отправкой, ответ на которую потерялся
+		var resp secret.PushResponse
+		for _, op := range req.Operations {
+			id := op.SecretID
+			if id == "" {
+				id = "server-1"
+			}
+			resp.Results = append(resp.Results, secret.PushResultResponse{
+				ClientID: op.ClientID,
+				Status:   secret.PushConflict,
+				Secret:   &secret.SecretResponse{ID: id, Login: op.Login, Version: 1},
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "a"})
+
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+	created := vault.QueueCreate(&secret.CreateSecretRequest{Login: "offline"})
+
+	// Очередь, сохраненная до генерации ID на клиенте
+	legacyID := localIDPrefix + "1"
+	vault.data.Secrets[legacyID] = secret.SecretResponse{ID: legacyID, Login: "legacy"}
+	vault.data.Pending = append(vault.data.Pending, PendingOperation{ID: "op-legacy", Action: PendingCreate, SecretID: legacyID, Login: "legacy"})
+
+	report, err := vault.Replay(client)
+	require.NoError(t, err)
+
+	require.Len(t, pushed, 2)
+	assert.Empty(t, pushed[1].SecretID, "local ID must not be sent")
+	assert.Equal(t, 2, report.Applied)
+	assert.Empty(t, report.Conflicts)
+	assert.Empty(t, vault.Pending())
+
+	_, err = vault.Get(created.ID)
+	assert.NoError(t, err)
+	_, err = vault.Get(legacyID)
+	assert.ErrorIs(t, err, ErrSecretNotCached)
+	_, err = vault.Get("server-1")
+	assert.NoError(t, err)
+}
+
+func TestVault_Replay_KeepsQueueWhenServerUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "a"})
+
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+	vault.QueueCreate(&secret.CreateSecretRequest{Login: "offline"})
+
+	_, err = vault.Replay(client)
+
+	assert.ErrorIs(t, err, ErrServerUnavailable)
+	require.Len(t, vault.Pending(), 1)
+	assert.Equal(t, vault.Pending()[0].SecretID, vault.List("")[0].ID)
+}
+
+func TestVault_Replay_KeepsRejectedOperations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(secret.PushResponse{Results: []secret.PushResultResponse{
+			{ClientID: "op", Status: secret.PushInvalid, Error: "Пароль обязателен"},
+		}})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/api", server.Client(), &Session{AccessToken: "a"})
+
+	vault, err := OpenVault(t.TempDir()+"/vault.bin", "master")
+	require.NoError(t, err)
+	vault.QueueCreate(&secret.CreateSecretRequest{Login: "offline"})
+
+	report, err := vault.Replay(client)
+	require.NoError(t, err)
+
+	require.Len(t, report.Rejected, 1)
+	assert.Equal(t, "Пароль обязателен", report.Rejected[0].Reason)
+	assert.Len(t, vault.Pending(), 1)
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -15,6 +17,15 @@ const (
 	DefaultSMTPHost            = "smtp.yandex.ru"
 	DefaultSMTPPort            = "465"
 	DefaultVerificationCodeTTL = 10 * time.Minute
+	DefaultSecretVersionsLimit = 20
+	DefaultTrashRetention      = 30 * 24 * time.Hour
+	DefaultTrashPurgeInterval  = time.Hour
+	DefaultBlobStore           = "fs"
+	DefaultBlobDir             = "data/blobs"
+	DefaultS3Region            = "us-east-1"
+	DefaultIdempotencyKeyTTL   = 24 * time.Hour
+	DefaultWebAuthnRPID        = "localhost"
+	DefaultWebAuthnOrigins     = "http://localhost:3000"
 )
 
 type Config struct {
@@ -31,6 +42,20 @@ type Config struct {
 	VerificationCodeTTL time.Duration
 	TLSCertFile         string
 	TLSKeyFile          string
+	SecretVersionsLimit int
+	TrashRetention      time.Duration
+	TrashPurgeInterval  time.Duration
+	BlobStore           string
+	BlobDir             string
+	S3Endpoint          string
+	S3Region            string
+	S3Bucket            string
+	S3AccessKey         string
+	S3SecretKey         string
+	IdempotencyKeyTTL   time.Duration
+	TOTPKey             string
+	WebAuthnRPID        string
+	WebAuthnOrigins     []string
 }
 
 func NewConfig() *Config {
@@ -46,6 +71,20 @@ func NewConfig() *Config {
 	smtpFrom := os.Getenv("SMTP_FROM")
 	var tlsCertFile string
 	var tlsKeyFile string
+	secretVersionsLimit := DefaultSecretVersionsLimit
+	trashRetention := DefaultTrashRetention
+	trashPurgeInterval := DefaultTrashPurgeInterval
+	blobStore := DefaultBlobStore
+	blobDir := DefaultBlobDir
+	s3Endpoint := os.Getenv("S3_ENDPOINT")
+	s3Region := DefaultS3Region
+	s3Bucket := os.Getenv("S3_BUCKET")
+	s3AccessKey := os.Getenv("S3_ACCESS_KEY")
+	s3SecretKey := os.Getenv("S3_SECRET_KEY")
+	idempotencyKeyTTL := DefaultIdempotencyKeyTTL
+	totpKey := os.Getenv("TOTP_KEY")
+	webAuthnRPID := DefaultWebAuthnRPID
+	webAuthnOrigins := DefaultWebAuthnOrigins
 
 	if envRunAddr := os.Getenv("RUN_ADDRESS"); envRunAddr != "" {
 		serverAddress = envRunAddr
@@ -68,6 +107,41 @@ func NewConfig() *Config {
 	if envTLSKeyFile := os.Getenv("TLS_KEY_FILE"); envTLSKeyFile != "" {
 		tlsKeyFile = envTLSKeyFile
 	}
+	if envVersionsLimit := os.Getenv("SECRET_VERSIONS_LIMIT"); envVersionsLimit != "" {
+		if limit, err := strconv.Atoi(envVersionsLimit); err == nil {
+			secretVersionsLimit = limit
+		}
+	}
+	if envTrashRetention := os.Getenv("TRASH_RETENTION"); envTrashRetention != "" {
+		if retention, err := time.ParseDuration(envTrashRetention); err == nil {
+			trashRetention = retention
+		}
+	}
+	if envPurgeInterval := os.Getenv("TRASH_PURGE_INTERVAL"); envPurgeInterval != "" {
+		if interval, err := time.ParseDuration(envPurgeInterval); err == nil {
+			trashPurgeInterval = interval
+		}
+	}
+	if envBlobStore := os.Getenv("BLOB_STORE"); envBlobStore != "" {
+		blobStore = envBlobStore
+	}
+	if envBlobDir := os.Getenv("BLOB_DIR"); envBlobDir != "" {
+		blobDir = envBlobDir
+	}
+	if envS3Region := os.Getenv("S3_REGION"); envS3Region != "" {
+		s3Region = envS3Region
+	}
+	if envIdempotencyTTL := os.Getenv("IDEMPOTENCY_KEY_TTL"); envIdempotencyTTL != "" {
+		if ttl, err := time.ParseDuration(envIdempotencyTTL); err == nil {
+			idempotencyKeyTTL = ttl
+		}
+	}
+	if envWebAuthnRPID := os.Getenv("WEBAUTHN_RP_ID"); envWebAuthnRPID != "" {
+		webAuthnRPID = envWebAuthnRPID
+	}
+	if envWebAuthnOrigins := os.Getenv("WEBAUTHN_ORIGINS"); envWebAuthnOrigins != "" {
+		webAuthnOrigins = envWebAuthnOrigins
+	}
 
 	flag.StringVar(&cfg.ServerAddress, "a", serverAddress, "адрес и порт запуска сервиса")
 	flag.StringVar(&cfg.DatabaseURI, "d", databaseURI, "адрес подключения к базе данных")
@@ -76,16 +150,36 @@ func NewConfig() *Config {
 	flag.StringVar(&cfg.SMTPPort, "smtp-port", smtpPort, "SMTP порт")
 	flag.StringVar(&cfg.TLSCertFile, "tls-cert", tlsCertFile, "путь к TLS сертификату (обязательный)")
 	flag.StringVar(&cfg.TLSKeyFile, "tls-key", tlsKeyFile, "путь к TLS приватному ключу (обязательный)")
+	flag.IntVar(&cfg.SecretVersionsLimit, "secret-versions-limit", secretVersionsLimit, "сколько версий секрета хранить в истории (0 - без ограничений)")
+	flag.DurationVar(&cfg.TrashRetention, "trash-retention", trashRetention, "сколько удаленный секрет хранится в корзине")
+	flag.DurationVar(&cfg.TrashPurgeInterval, "trash-purge-interval", trashPurgeInterval, "как часто запускать очистку корзины")
+	flag.StringVar(&cfg.BlobStore, "blob-store", blobStore, "хранилище бинарных данных: fs или s3")
+	flag.StringVar(&cfg.BlobDir, "blob-dir", blobDir, "каталог для бинарных данных (для fs)")
+	flag.StringVar(&cfg.S3Endpoint, "s3-endpoint", s3Endpoint, "адрес S3-совместимого хранилища, например http://localhost:9000")
+	flag.StringVar(&cfg.S3Region, "s3-region", s3Region, "регион S3")
+	flag.StringVar(&cfg.S3Bucket, "s3-bucket", s3Bucket, "бакет S3 для бинарных данных")
+	flag.DurationVar(&cfg.IdempotencyKeyTTL, "idempotency-key-ttl", idempotencyKeyTTL, "сколько хранится ответ на запрос с заголовком Idempotency-Key")
+	flag.StringVar(&cfg.TOTPKey, "totp-key", totpKey, "ключ шифрования секретов TOTP в базе (по умолчанию выводится из JWT_SECRET)")
+	flag.StringVar(&cfg.WebAuthnRPID, "webauthn-rp-id", webAuthnRPID, "домен, к которому привязываются ключи WebAuthn")
+	flag.StringVar(&webAuthnOrigins, "webauthn-origins", webAuthnOrigins, "адреса клиента через запятую, с которых разрешен вход по ключам WebAuthn")
 
 	cfg.SMTPUsername = smtpUsername
 	cfg.SMTPPassword = smtpPassword
 	cfg.SMTPFrom = smtpFrom
+	cfg.S3AccessKey = s3AccessKey
+	cfg.S3SecretKey = s3SecretKey
 	cfg.AccessTokenTTL = DefaultAccessTokenTTL
 	cfg.RefreshTokenTTL = DefaultRefreshTokenTTL
 	cfg.VerificationCodeTTL = DefaultVerificationCodeTTL
 
 	flag.Parse()
 
+	for _, origin := range strings.Split(webAuthnOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.WebAuthnOrigins = append(cfg.WebAuthnOrigins, origin)
+		}
+	}
+
 	cfg.normalize()
 	cfg.validate()
 
@@ -93,6 +187,12 @@ func NewConfig() *Config {
 }
 
 func (c *Config) normalize() {
+	// Без отдельного ключа секреты TOTP шифруются ключом, выведенным из JWT_SECRET:
+	// после смены JWT_SECRET второй фактор придется подключить заново
+	if c.TOTPKey == "" && c.JWTSecret != "" {
+		c.TOTPKey = "totp:" + c.JWTSecret
+	}
+
 	if len(c.ServerAddress) == 0 {
 		c.ServerAddress = DefaultServerAddress
 		return
@@ -117,4 +217,28 @@ func (c *Config) validate() {
 	if c.TLSKeyFile == "" {
 		panic("TLS_KEY_FILE must be set via environment variable or -tls-key flag. TLS is required for security.")
 	}
+	if c.SecretVersionsLimit < 0 {
+		panic("SECRET_VERSIONS_LIMIT cannot be negative")
+	}
+	if c.TrashRetention < 0 {
+		panic("TRASH_RETENTION cannot be negative")
+	}
+	if c.TrashPurgeInterval <= 0 {
+		panic("TRASH_PURGE_INTERVAL must be positive")
+	}
+	if c.IdempotencyKeyTTL <= 0 {
+		panic("IDEMPOTENCY_KEY_TTL must be positive")
+	}
+	switch c.BlobStore {
+	case "fs":
+		if c.BlobDir == "" {
+			panic("BLOB_DIR cannot be empty when BLOB_STORE=fs")
+		}
+	case "s3":
+		if c.S3Endpoint == "" || c.S3Bucket == "" {
+			panic("S3_ENDPOINT and S3_BUCKET must be set when BLOB_STORE=s3")
+		}
+	default:
+		panic("BLOB_STORE must be fs or s3")
+	}
 }
@@ -173,6 +173,60 @@ func TestDefaultConstants(t *testing.T) {
 	t.Run("DefaultRefreshTokenTTL", func(t *testing.T) {
 		assert.Equal(t, 120*time.Hour, DefaultRefreshTokenTTL)
 	})
+
+	t.Run("DefaultSecretVersionsLimit", func(t *testing.T) {
+		assert.Equal(t, 20, DefaultSecretVersionsLimit)
+	})
+
+	t.Run("DefaultTrashRetention", func(t *testing.T) {
+		assert.Equal(t, 30*24*time.Hour, DefaultTrashRetention)
+	})
+
+	t.Run("DefaultTrashPurgeInterval", func(t *testing.T) {
+		assert.Equal(t, time.Hour, DefaultTrashPurgeInterval)
+	})
+
+	t.Run("DefaultBlobStore", func(t *testing.T) {
+		assert.Equal(t, "fs", DefaultBlobStore)
+		assert.Equal(t, "data/blobs", DefaultBlobDir)
+		assert.Equal(t, "us-east-1", DefaultS3Region)
+	})
+
+	t.Run("DefaultIdempotencyKeyTTL", func(t *testing.T) {
+		assert.Equal(t, 24*time.Hour, DefaultIdempotencyKeyTTL)
+	})
+}
+
+func TestConfig_Validate_BlobStore(t *testing.T) {
+	valid := func() *Config {
+		return &Config{
+			ServerAddress:      ":8080",
+			JWTSecret:          "secret",
+			TLSCertFile:        "cert.pem",
+			TLSKeyFile:         "key.pem",
+			TrashPurgeInterval: time.Hour,
+			BlobStore:          "fs",
+			BlobDir:            "data/blobs",
+			IdempotencyKeyTTL:  time.Hour,
+		}
+	}
+
+	assert.NotPanics(t, func() { valid().validate() })
+
+	s3 := valid()
+	s3.BlobStore = "s3"
+	assert.Panics(t, func() { s3.validate() })
+	s3.S3Endpoint = "http://localhost:9000"
+	s3.S3Bucket = "goph-keeper"
+	assert.NotPanics(t, func() { s3.validate() })
+
+	unknown := valid()
+	unknown.BlobStore = "ftp"
+	assert.Panics(t, func() { unknown.validate() })
+
+	noIdempotencyTTL := valid()
+	noIdempotencyTTL.IdempotencyKeyTTL = 0
+	assert.Panics(t, func() { noIdempotencyTTL.validate() })
 }
 
 func TestConfig_TTLValues(t *testing.T) {
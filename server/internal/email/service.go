@@ -27,14 +27,76 @@ func NewService(host, port, username, password, from string) *Service {
 }
 
 func (s *Service) SendVerificationCode(toEmail, code string) error {
-	if s.username == "" || s.password == "" || s.from == "" {
+	if !s.configured() {
 		logger.Warnf("[Email] SMTP не настроен. Код подтверждения для %s: %s", toEmail, code)
 		return nil
 	}
 
-	subject := "Код подтверждения"
-	body := code
+	if err := s.send(toEmail, "Код подтверждения", code); err != nil {
+		return err
+	}
+
+	logger.Infof("[Email] Код подтверждения отправлен на %s", toEmail)
+	return nil
+}
+
+// SendPasswordResetCode отправляет одноразовый код для сброса пароля
+func (s *Service) SendPasswordResetCode(toEmail, code string) error {
+	if !s.configured() {
+		logger.Warnf("[Email] SMTP не настроен. Код сброса пароля для %s: %s", toEmail, code)
+		return nil
+	}
+
+	body := fmt.Sprintf("Код для сброса пароля: %s\r\n\r\n"+
+		"Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.", code)
+	if err := s.send(toEmail, "Сброс пароля", body); err != nil {
+		return err
+	}
+
+	logger.Infof("[Email] Код сброса пароля отправлен на %s", toEmail)
+	return nil
+}
+
+// SendEmailChangedNotice сообщает на прежний адрес, что email аккаунта изменен
+func (s *Service) SendEmailChangedNotice(toEmail, newEmail string) error {
+	if !s.configured() {
+		logger.Warnf("[Email] SMTP не настроен. Email аккаунта %s изменен на %s", toEmail, newEmail)
+		return nil
+	}
 
+	body := fmt.Sprintf("Email вашего аккаунта изменен на %s.\r\n\r\n"+
+		"Если это сделали не вы, немедленно восстановите доступ и смените пароль.", newEmail)
+	if err := s.send(toEmail, "Email аккаунта изменен", body); err != nil {
+		return err
+	}
+
+	logger.Infof("[Email] Уведомление о смене email отправлено на %s", toEmail)
+	return nil
+}
+
+// SendAccountDeletionCode отправляет код, которым пользователь подтверждает удаление аккаунта
+func (s *Service) SendAccountDeletionCode(toEmail, code string) error {
+	if !s.configured() {
+		logger.Warnf("[Email] SMTP не настроен. Код удаления аккаунта для %s: %s", toEmail, code)
+		return nil
+	}
+
+	body := fmt.Sprintf("Код для удаления аккаунта: %s\r\n\r\n"+
+		"Удаление необратимо: будут стерты все ваши секреты и файлы.\r\n"+
+		"Если вы не запрашивали удаление, смените пароль.", code)
+	if err := s.send(toEmail, "Удаление аккаунта", body); err != nil {
+		return err
+	}
+
+	logger.Infof("[Email] Код удаления аккаунта отправлен на %s", toEmail)
+	return nil
+}
+
+func (s *Service) configured() bool {
+	return s.username != "" && s.password != "" && s.from != ""
+}
+
+func (s *Service) send(toEmail, subject, body string) error {
 	message := fmt.Sprintf("From: %s\r\n"+
 		"To: %s\r\n"+
 		"Subject: %s\r\n"+
@@ -87,6 +149,5 @@ func (s *Service) SendVerificationCode(toEmail, code string) error {
 		return fmt.Errorf("не удалось закрыть data writer: %w", err)
 	}
 
-	logger.Infof("[Email] Код подтверждения отправлен на %s", toEmail)
 	return nil
 }
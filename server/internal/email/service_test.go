@@ -16,6 +16,33 @@ func TestService_SendVerificationCode_NoSMTPConfig(t *testing.T) {
 	}
 }
 
+func TestService_SendPasswordResetCode_NoSMTPConfig(t *testing.T) {
+	service := NewService("smtp.yandex.ru", "465", "", "", "")
+
+	err := service.SendPasswordResetCode("test@example.com", "123456")
+	if err != nil {
+		t.Errorf("Expected no error for missing SMTP config, got: %v", err)
+	}
+}
+
+func TestService_SendEmailChangedNotice_NoSMTPConfig(t *testing.T) {
+	service := NewService("smtp.yandex.ru", "465", "", "", "")
+
+	err := service.SendEmailChangedNotice("old@example.com", "new@example.com")
+	if err != nil {
+		t.Errorf("Expected no error for missing SMTP config, got: %v", err)
+	}
+}
+
+func TestService_SendAccountDeletionCode_NoSMTPConfig(t *testing.T) {
+	service := NewService("smtp.yandex.ru", "465", "", "", "")
+
+	err := service.SendAccountDeletionCode("test@example.com", "123456")
+	if err != nil {
+		t.Errorf("Expected no error for missing SMTP config, got: %v", err)
+	}
+}
+
 func TestService_NewService(t *testing.T) {
 	tests := []struct {
 		name     string
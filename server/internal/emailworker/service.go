@@ -23,3 +23,15 @@ func (s *EmailWorkerService) GenerateVerificationCode() string {
 func (s *EmailWorkerService) SendEmail(toEmail, code string) {
 	s.worker.SendEmail(toEmail, code)
 }
+
+func (s *EmailWorkerService) SendPasswordResetEmail(toEmail, code string) {
+	s.worker.SendPasswordReset(toEmail, code)
+}
+
+func (s *EmailWorkerService) SendEmailChangedNotice(oldEmail, newEmail string) {
+	s.worker.SendEmailChangedNotice(oldEmail, newEmail)
+}
+
+func (s *EmailWorkerService) SendAccountDeletionEmail(toEmail, code string) {
+	s.worker.SendAccountDeletion(toEmail, code)
+}
@@ -8,14 +8,31 @@ import (
 	"github.com/Adigezalov/goph-keeper/internal/logger"
 )
 
+// EmailKind определяет, какое письмо отправить
+type EmailKind string
+
+const (
+	EmailKindVerification  EmailKind = "verification"
+	EmailKindPasswordReset EmailKind = "password_reset"
+	EmailKindEmailChanged  EmailKind = "email_changed"
+	// EmailKindAccountDeletion - код подтверждения удаления аккаунта
+	EmailKindAccountDeletion EmailKind = "account_deletion"
+)
+
 type EmailJob struct {
-	To      string
-	Code    string
-	Attempt int
+	To   string
+	Code string
+	// NewEmail - новый адрес пользователя в уведомлении о смене email
+	NewEmail string
+	Kind     EmailKind
+	Attempt  int
 }
 
 type EmailSender interface {
 	SendVerificationCode(toEmail, code string) error
+	SendPasswordResetCode(toEmail, code string) error
+	SendEmailChangedNotice(toEmail, newEmail string) error
+	SendAccountDeletionCode(toEmail, code string) error
 }
 
 type Worker struct {
@@ -55,20 +72,29 @@ func (w *Worker) Stop() {
 }
 
 func (w *Worker) SendEmail(to, code string) {
-	w.sendEmailWithAttempt(to, code, 0)
+	w.enqueue(EmailJob{To: to, Code: code, Kind: EmailKindVerification})
 }
 
-func (w *Worker) sendEmailWithAttempt(to, code string, attempt int) {
-	job := EmailJob{
-		To:      to,
-		Code:    code,
-		Attempt: attempt,
-	}
+// SendPasswordReset ставит в очередь письмо с кодом сброса пароля
+func (w *Worker) SendPasswordReset(to, code string) {
+	w.enqueue(EmailJob{To: to, Code: code, Kind: EmailKindPasswordReset})
+}
+
+// SendEmailChangedNotice ставит в очередь уведомление на прежний адрес о смене email
+func (w *Worker) SendEmailChangedNotice(to, newEmail string) {
+	w.enqueue(EmailJob{To: to, NewEmail: newEmail, Kind: EmailKindEmailChanged})
+}
+
+// SendAccountDeletion ставит в очередь письмо с кодом подтверждения удаления аккаунта
+func (w *Worker) SendAccountDeletion(to, code string) {
+	w.enqueue(EmailJob{To: to, Code: code, Kind: EmailKindAccountDeletion})
+}
 
+func (w *Worker) enqueue(job EmailJob) {
 	select {
 	case w.jobQueue <- job:
-		if attempt == 0 {
-			logger.Infof("[EmailWorker] Задача добавлена в очередь: %s", to)
+		if job.Attempt == 0 {
+			logger.Infof("[EmailWorker] Задача добавлена в очередь: %s", job.To)
 		}
 	case <-w.ctx.Done():
 		logger.Warn("[EmailWorker] Worker остановлен, задача отклонена")
@@ -97,14 +123,25 @@ func (w *Worker) run() {
 }
 
 func (w *Worker) processJob(job EmailJob) {
-	err := w.emailService.SendVerificationCode(job.To, job.Code)
+	var err error
+	switch job.Kind {
+	case EmailKindPasswordReset:
+		err = w.emailService.SendPasswordResetCode(job.To, job.Code)
+	case EmailKindEmailChanged:
+		err = w.emailService.SendEmailChangedNotice(job.To, job.NewEmail)
+	case EmailKindAccountDeletion:
+		err = w.emailService.SendAccountDeletionCode(job.To, job.Code)
+	default:
+		err = w.emailService.SendVerificationCode(job.To, job.Code)
+	}
 	if err != nil {
 		logger.Errorf("[EmailWorker] Ошибка отправки email на %s (попытка %d): %v", job.To, job.Attempt+1, err)
 
 		if job.Attempt < w.maxRetries {
 			logger.Infof("[EmailWorker] Повторная попытка через %v", w.retryDelay)
 			time.Sleep(w.retryDelay)
-			w.sendEmailWithAttempt(job.To, job.Code, job.Attempt+1)
+			job.Attempt++
+			w.enqueue(job)
 		} else {
 			logger.Errorf("[EmailWorker] Превышено максимальное количество попыток для %s", job.To)
 		}
@@ -17,9 +17,11 @@ type MockEmailSender struct {
 }
 
 type EmailCall struct {
-	To   string
-	Code string
-	Time time.Time
+	To       string
+	Code     string
+	NewEmail string
+	Kind     EmailKind
+	Time     time.Time
 }
 
 func NewMockEmailSender() *MockEmailSender {
@@ -29,14 +31,27 @@ func NewMockEmailSender() *MockEmailSender {
 }
 
 func (m *MockEmailSender) SendVerificationCode(toEmail, code string) error {
+	return m.record(EmailCall{To: toEmail, Code: code, Kind: EmailKindVerification})
+}
+
+func (m *MockEmailSender) SendPasswordResetCode(toEmail, code string) error {
+	return m.record(EmailCall{To: toEmail, Code: code, Kind: EmailKindPasswordReset})
+}
+
+func (m *MockEmailSender) SendEmailChangedNotice(toEmail, newEmail string) error {
+	return m.record(EmailCall{To: toEmail, NewEmail: newEmail, Kind: EmailKindEmailChanged})
+}
+
+func (m *MockEmailSender) SendAccountDeletionCode(toEmail, code string) error {
+	return m.record(EmailCall{To: toEmail, Code: code, Kind: EmailKindAccountDeletion})
+}
+
+func (m *MockEmailSender) record(call EmailCall) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.calls = append(m.calls, EmailCall{
-		To:   toEmail,
-		Code: code,
-		Time: time.Now(),
-	})
+	call.Time = time.Now()
+	m.calls = append(m.calls, call)
 
 	if m.shouldFail {
 		if m.failCount > 0 {
@@ -111,6 +126,76 @@ func TestWorker_SuccessfulEmailSend(t *testing.T) {
 	}
 }
 
+func TestWorker_PasswordResetEmail(t *testing.T) {
+	mockSender := NewMockEmailSender()
+	mockSender.SetFailCount(1)
+	mockSender.SetShouldFail(true)
+
+	worker := NewWorker(mockSender, 10, 3, 50*time.Millisecond)
+	worker.Start()
+	defer worker.Stop()
+
+	worker.SendEmail("test@example.com", "111111")
+	worker.SendPasswordReset("test@example.com", "222222")
+
+	time.Sleep(500 * time.Millisecond)
+
+	calls := mockSender.GetCalls()
+	if len(calls) != 3 {
+		t.Fatalf("Expected 3 calls, got %d", len(calls))
+	}
+
+	// Повторная попытка должна сохранить тип письма
+	kinds := map[string]EmailKind{}
+	for _, call := range calls {
+		kinds[call.Code] = call.Kind
+	}
+	if kinds["111111"] != EmailKindVerification {
+		t.Errorf("Expected verification email for code 111111, got '%s'", kinds["111111"])
+	}
+	if kinds["222222"] != EmailKindPasswordReset {
+		t.Errorf("Expected password reset email for code 222222, got '%s'", kinds["222222"])
+	}
+}
+
+func TestWorker_EmailChangedNotice(t *testing.T) {
+	mockSender := NewMockEmailSender()
+	worker := NewWorker(mockSender, 10, 3, 50*time.Millisecond)
+	worker.Start()
+	defer worker.Stop()
+
+	worker.SendEmailChangedNotice("old@example.com", "new@example.com")
+
+	time.Sleep(200 * time.Millisecond)
+
+	calls := mockSender.GetCalls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Kind != EmailKindEmailChanged || calls[0].To != "old@example.com" || calls[0].NewEmail != "new@example.com" {
+		t.Errorf("Expected email changed notice to old@example.com about new@example.com, got %+v", calls[0])
+	}
+}
+
+func TestWorker_AccountDeletionEmail(t *testing.T) {
+	mockSender := NewMockEmailSender()
+	worker := NewWorker(mockSender, 10, 3, 50*time.Millisecond)
+	worker.Start()
+	defer worker.Stop()
+
+	worker.SendAccountDeletion("test@example.com", "654321")
+
+	time.Sleep(200 * time.Millisecond)
+
+	calls := mockSender.GetCalls()
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 call, got %d", len(calls))
+	}
+	if calls[0].Kind != EmailKindAccountDeletion || calls[0].Code != "654321" {
+		t.Errorf("Expected account deletion email with code 654321, got %+v", calls[0])
+	}
+}
+
 func TestWorker_MultipleEmails(t *testing.T) {
 	mockSender := NewMockEmailSender()
 	worker := NewWorker(mockSender, 10, 3, 100*time.Millisecond)
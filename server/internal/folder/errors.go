@@ -0,0 +1,32 @@
+package folder
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrFolderNotFound      = errors.New("folder.not_found")
+	ErrFolderAlreadyExists = errors.New("folder.already_exists")
+	ErrVersionConflict     = errors.New("folder.version_conflict")
+	ErrPreconditionFailed  = errors.New("folder.precondition_failed")
+	ErrParentNotFound      = errors.New("folder.parent_not_found")
+	ErrCycle               = errors.New("folder.cycle")
+	ErrSecretNotFound      = errors.New("folder.secret_not_found")
+)
+
+var (
+	ErrRequestRequired = errors.New("folder.request_required")
+	ErrInvalidID       = errors.New("folder.invalid_id")
+	ErrNameRequired    = errors.New("folder.name_required")
+	ErrNameTooLong     = errors.New("folder.name_too_long")
+	ErrNothingToMove   = errors.New("folder.nothing_to_move")
+	ErrTooManyItems    = errors.New("folder.move_too_large")
+)
+
+func WrapError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
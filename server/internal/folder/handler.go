@@ -0,0 +1,310 @@
+package folder
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+type FolderService interface {
+	CreateFolder(userID int, req *CreateFolderRequest, excludeSessionID string) (*Folder, error)
+	GetFolder(id string, userID int) (*Folder, error)
+	ListFolders(userID int) ([]*Folder, error)
+	UpdateFolder(id string, userID int, req *UpdateFolderRequest, excludeSessionID string) (*Folder, error)
+	DeleteFolder(id string, userID int, version int, excludeSessionID string) error
+	Move(userID int, req *MoveRequest, excludeSessionID string) (*MoveResult, error)
+}
+
+type Handler struct {
+	service FolderService
+}
+
+func NewHandler(service FolderService) *Handler {
+	return &Handler{service: service}
+}
+
+// List godoc
+// @Summary Получить папки
+// @Description Возвращает все папки пользователя. Дерево строится по parent_id.
+// @Tags folders
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} FolderResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /folders [get]
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	folders, err := h.service.ListFolders(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Folder] Ошибка получения папок")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	responses := make([]FolderResponse, 0, len(folders))
+	for _, folder := range folders {
+		responses = append(responses, folder.ToResponse())
+	}
+
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// Create godoc
+// @Summary Создать папку
+// @Description Создает папку в корне или внутри parent_id
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body CreateFolderRequest true "Данные папки"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 201 {object} FolderResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Родительская папка не найдена"
+// @Failure 409 {object} map[string]string "Папка с таким ID уже существует"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /folders [post]
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req CreateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	folder, err := h.service.CreateFolder(userID, &req, sessionID(r))
+	if err != nil {
+		h.writeError(w, r, userID, req.ID, err, "[Folder] Ошибка создания папки")
+		return
+	}
+
+	w.Header().Set("ETag", folderETag(folder.ID, folder.Version))
+	writeJSON(w, http.StatusCreated, folder.ToResponse())
+}
+
+// Get godoc
+// @Summary Получить папку
+// @Tags folders
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID папки"
+// @Success 200 {object} FolderResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Папка не найдена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /folders/{id} [get]
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	folder, err := h.service.GetFolder(id, userID)
+	if err != nil {
+		h.writeError(w, r, userID, id, err, "[Folder] Ошибка получения папки")
+		return
+	}
+
+	w.Header().Set("ETag", folderETag(folder.ID, folder.Version))
+	writeJSON(w, http.StatusOK, folder.ToResponse())
+}
+
+// Update godoc
+// @Summary Изменить папку
+// @Description Переименовывает папку и переносит ее в parent_id (пусто - в корень). Папку нельзя перенести внутрь нее самой.
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID папки"
+// @Param request body UpdateFolderRequest true "Новые данные папки"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 200 {object} FolderResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Папка не найдена"
+// @Failure 409 {object} map[string]string "Конфликт версий или цикл"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /folders/{id} [put]
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req UpdateFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	folder, err := h.service.UpdateFolder(id, userID, &req, sessionID(r))
+	if err != nil {
+		h.writeError(w, r, userID, id, err, "[Folder] Ошибка обновления папки")
+		return
+	}
+
+	w.Header().Set("ETag", folderETag(folder.ID, folder.Version))
+	writeJSON(w, http.StatusOK, folder.ToResponse())
+}
+
+// Delete godoc
+// @Summary Удалить папку
+// @Description Удаляет папку. Вложенные папки и секреты переносятся в ее родительскую папку.
+// @Tags folders
+// @Security BearerAuth
+// @Param id path string true "ID папки"
+// @Param If-Match header string false "ETag папки: удалить, только если она не изменилась"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 204 "Папка удалена"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Папка не найдена"
+// @Failure 412 {object} map[string]string "Папка изменилась"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /folders/{id} [delete]
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	version := 0
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		var matched bool
+		if version, matched = ifMatchVersion(ifMatch, id); !matched {
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "folder.precondition_failed", nil)
+			return
+		}
+	}
+
+	if err := h.service.DeleteFolder(id, userID, version, sessionID(r)); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "folder.precondition_failed", nil)
+			return
+		}
+		h.writeError(w, r, userID, id, err, "[Folder] Ошибка удаления папки")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Move godoc
+// @Summary Перенести секреты и папки
+// @Description Переносит секреты и папки в target_id (пусто - в корень). Если хотя бы один элемент не найден, не переносится ничего.
+// @Tags folders
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body MoveRequest true "Что и куда перенести"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 200 {object} MoveResult "ID перенесенных секретов и папок"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Папка или секрет не найдены"
+// @Failure 409 {object} map[string]string "Папка попала бы внутрь себя"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /folders/move [post]
+func (h *Handler) Move(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	result, err := h.service.Move(userID, &req, sessionID(r))
+	if err != nil {
+		h.writeError(w, r, userID, req.TargetID, err, "[Folder] Ошибка переноса")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+var validationErrors = []error{
+	ErrRequestRequired,
+	ErrInvalidID,
+	ErrNameRequired,
+	ErrNameTooLong,
+	ErrNothingToMove,
+	ErrTooManyItems,
+}
+
+// writeError отвечает на ошибку сервиса. Неожиданные ошибки пишутся в лог с logMessage.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, userID int, folderID string, err error, logMessage string) {
+	for _, validationErr := range validationErrors {
+		if errors.Is(err, validationErr) {
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationErr.Error(), nil)
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, ErrFolderNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "folder.not_found", nil)
+	case errors.Is(err, ErrParentNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "folder.parent_not_found", nil)
+	case errors.Is(err, ErrSecretNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "folder.secret_not_found", nil)
+	case errors.Is(err, ErrFolderAlreadyExists):
+		localization.LocalizedError(w, r, http.StatusConflict, "folder.already_exists", nil)
+	case errors.Is(err, ErrVersionConflict):
+		localization.LocalizedError(w, r, http.StatusConflict, "folder.version_conflict", nil)
+	case errors.Is(err, ErrCycle):
+		localization.LocalizedError(w, r, http.StatusConflict, "folder.cycle", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"folder_id": folderID,
+			"error":     err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
+
+func sessionID(r *http.Request) string {
+	sessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+	return sessionID
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Errorf("[Folder] Ошибка отправки JSON ответа: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package folder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRequest(method, target string, body interface{}, userID int) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+}
+
+func TestHandler_CreateAndList(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	w := httptest.NewRecorder()
+	handler.Create(w, newTestRequest(http.MethodPost, "/api/v1/folders", CreateFolderRequest{Name: "Работа"}, 1))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created FolderResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "Работа", created.Name)
+	assert.Equal(t, folderETag(created.ID, 1), w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	handler.List(w, newTestRequest(http.MethodGet, "/api/v1/folders", nil, 1))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var folders []FolderResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&folders))
+	require.Len(t, folders, 1)
+	assert.Equal(t, created.ID, folders[0].ID)
+
+	// Папки другого пользователя не видны
+	w = httptest.NewRecorder()
+	req := mux.SetURLVars(newTestRequest(http.MethodGet, "/api/v1/folders/"+created.ID, nil, 2), map[string]string{"id": created.ID})
+	handler.Get(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_Create_Errors(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"invalid json", "not an object", http.StatusBadRequest},
+		{"empty name", CreateFolderRequest{}, http.StatusBadRequest},
+		{"unknown parent", CreateFolderRequest{Name: "a", ParentID: "11111111-1111-1111-1111-111111111111"}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Create(w, newTestRequest(http.MethodPost, "/api/v1/folders", tt.body, 1))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestHandler_Update_Cycle(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	parent, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "parent"}, "")
+	child, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "child", ParentID: parent.ID}, "")
+
+	w := httptest.NewRecorder()
+	req := newTestRequest(http.MethodPut, "/api/v1/folders/"+parent.ID, UpdateFolderRequest{Name: "parent", ParentID: child.ID, Version: 1}, 1)
+	handler.Update(w, mux.SetURLVars(req, map[string]string{"id": parent.ID}))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	req = newTestRequest(http.MethodPut, "/api/v1/folders/"+child.ID, UpdateFolderRequest{Name: "moved", Version: 1}, 1)
+	handler.Update(w, mux.SetURLVars(req, map[string]string{"id": child.ID}))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var updated FolderResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&updated))
+	assert.Empty(t, updated.ParentID)
+	assert.Equal(t, 2, updated.Version)
+}
+
+func TestHandler_Delete_IfMatch(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	folder, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "a"}, "")
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+	}{
+		{"other folder etag", folderETag("other", 1), http.StatusPreconditionFailed},
+		{"stale version", folderETag(folder.ID, 2), http.StatusPreconditionFailed},
+		{"current version", folderETag(folder.ID, 1), http.StatusNoContent},
+		{"already deleted", "*", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := newTestRequest(http.MethodDelete, "/api/v1/folders/"+folder.ID, nil, 1)
+			req.Header.Set("If-Match", tt.ifMatch)
+			handler.Delete(w, mux.SetURLVars(req, map[string]string{"id": folder.ID}))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestHandler_Move(t *testing.T) {
+	service, repo, _ := newTestService()
+	handler := NewHandler(service)
+
+	target, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "target"}, "")
+	secretID := "11111111-1111-1111-1111-111111111111"
+	repo.secrets[secretID] = ""
+
+	w := httptest.NewRecorder()
+	handler.Move(w, newTestRequest(http.MethodPost, "/api/v1/folders/move", MoveRequest{TargetID: target.ID, SecretIDs: []string{secretID}}, 1))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result MoveResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal(t, []string{secretID}, result.SecretIDs)
+	assert.Empty(t, result.FolderIDs)
+	assert.Equal(t, target.ID, repo.secrets[secretID])
+
+	w = httptest.NewRecorder()
+	handler.Move(w, newTestRequest(http.MethodPost, "/api/v1/folders/move", MoveRequest{TargetID: target.ID}, 1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	handler := NewHandler(NewService(NewMockRepository()))
+
+	w := httptest.NewRecorder()
+	handler.List(w, httptest.NewRequest(http.MethodGet, "/api/v1/folders", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,116 @@
+package folder
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxNameLength - наибольшая длина названия папки. Название может быть зашифровано на клиенте.
+	MaxNameLength = 1024
+	// MaxMoveItems ограничивает число секретов и папок в одном переносе: он выполняется в одной транзакции
+	MaxMoveItems = 500
+)
+
+type Folder struct {
+	ID        string       `json:"id" db:"id"`
+	UserID    int          `json:"user_id" db:"user_id"`
+	ParentID  string       `json:"parent_id,omitempty" db:"parent_id"` // пусто - корень
+	Name      string       `json:"name" db:"name"`
+	Version   int          `json:"version" db:"version"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+	DeletedAt sql.NullTime `json:"deleted_at,omitempty" db:"deleted_at"`
+	ChangeSeq int64        `json:"-" db:"change_seq"`
+}
+
+type CreateFolderRequest struct {
+	// ID можно сгенерировать на клиенте (UUID), тогда повтор запроса не создаст дубликат
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// UpdateFolderRequest переименовывает папку и переносит ее в ParentID (пусто - в корень)
+type UpdateFolderRequest struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id,omitempty"`
+	Version  int    `json:"version"`
+}
+
+// MoveRequest переносит секреты и папки в TargetID (пусто - в корень)
+type MoveRequest struct {
+	TargetID  string   `json:"target_id,omitempty"`
+	SecretIDs []string `json:"secret_ids,omitempty"`
+	FolderIDs []string `json:"folder_ids,omitempty"`
+}
+
+// MoveResult - что изменилось при переносе. Уже лежащие в TargetID элементы не меняются.
+type MoveResult struct {
+	SecretIDs []string `json:"secret_ids"`
+	FolderIDs []string `json:"folder_ids"`
+}
+
+// DeleteResult - папка удалена, ее содержимое поднято в родительскую папку
+type DeleteResult struct {
+	SecretIDs []string
+	FolderIDs []string
+}
+
+type FolderResponse struct {
+	ID        string     `json:"id"`
+	ParentID  string     `json:"parent_id,omitempty"`
+	Name      string     `json:"name"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (f *Folder) ToResponse() FolderResponse {
+	resp := FolderResponse{
+		ID:        f.ID,
+		ParentID:  f.ParentID,
+		Name:      f.Name,
+		Version:   f.Version,
+		CreatedAt: f.CreatedAt,
+		UpdatedAt: f.UpdatedAt,
+	}
+
+	if f.DeletedAt.Valid {
+		resp.DeletedAt = &f.DeletedAt.Time
+	}
+
+	return resp
+}
+
+// folderETag - ETag папки, как у секретов: id и версия
+func folderETag(id string, version int) string {
+	return `"` + id + "-" + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion возвращает версию папки id из заголовка If-Match. Для * подходит
+// любая версия (0), false - ни один ETag не относится к этой папке.
+func ifMatchVersion(header, id string) (int, bool) {
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" {
+			return 0, true
+		}
+
+		value, ok := strings.CutPrefix(etag, `"`+id+"-")
+		if !ok {
+			continue
+		}
+		value, ok = strings.CutSuffix(value, `"`)
+		if !ok {
+			continue
+		}
+		if version, err := strconv.Atoi(value); err == nil && version > 0 {
+			return version, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,482 @@
+package folder
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Repository interface {
+	CreateFolder(folder *Folder) error
+	GetFolder(id string, userID int) (*Folder, error)
+	ListFolders(userID int) ([]*Folder, error)
+	UpdateFolder(folder *Folder) error
+	DeleteFolder(id string, userID int, version int) (*DeleteResult, error)
+	Move(userID int, req *MoveRequest) (*MoveResult, error)
+	GetFolderChanges(userID int, afterSeq int64, limit int) ([]*Folder, error)
+	PurgeTombstones(deletedBefore time.Time) (int64, error)
+}
+
+type DatabaseRepository struct {
+	db *sql.DB
+}
+
+func NewDatabaseRepository(db *sql.DB) *DatabaseRepository {
+	return &DatabaseRepository{db: db}
+}
+
+const folderColumns = `id, user_id, parent_id, name, version, change_seq, created_at, updated_at, deleted_at`
+
+// rowQuerier - общее у *sql.DB и *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// CreateFolder создает папку. Родитель должен быть неудаленной папкой того же пользователя.
+func (r *DatabaseRepository) CreateFolder(folder *Folder) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	if err := checkParent(tx, folder.UserID, folder.ParentID); err != nil {
+		return err
+	}
+
+	// При конфликте ID строка не возвращается: папку с этим ID уже создал этот или другой запрос
+	query := `
+		INSERT INTO folders (id, user_id, parent_id, name)
+		VALUES (COALESCE(NULLIF($1, '')::uuid, uuid_generate_v4()), $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id, version, change_seq, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, folder.ID, folder.UserID, nullableID(folder.ParentID), folder.Name).Scan(
+		&folder.ID, &folder.Version, &folder.ChangeSeq, &folder.CreatedAt, &folder.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrFolderAlreadyExists
+		}
+		return WrapError(err, "не удалось создать папку")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return nil
+}
+
+func (r *DatabaseRepository) GetFolder(id string, userID int) (*Folder, error) {
+	query := `
+		SELECT ` + folderColumns + `
+		FROM folders
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+
+	folder, err := scanFolder(r.db.QueryRow(query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrFolderNotFound
+		}
+		return nil, WrapError(err, "не удалось получить папку")
+	}
+
+	return folder, nil
+}
+
+// ListFolders возвращает все неудаленные папки пользователя. Дерево клиент строит по parent_id.
+func (r *DatabaseRepository) ListFolders(userID int) ([]*Folder, error) {
+	query := `
+		SELECT ` + folderColumns + `
+		FROM folders
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY name, id
+	`
+
+	folders, err := queryFolders(r.db, query, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить папки")
+	}
+
+	return folders, nil
+}
+
+// UpdateFolder переименовывает и переносит папку, если ее версия равна folder.Version
+func (r *DatabaseRepository) UpdateFolder(folder *Folder) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	if err := lockFolders(tx, folder.UserID); err != nil {
+		return err
+	}
+	if err := checkParent(tx, folder.UserID, folder.ParentID); err != nil {
+		return err
+	}
+	if err := checkCycle(tx, folder.UserID, folder.ParentID, []string{folder.ID}); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE folders
+		SET name = $3,
+		    parent_id = $4,
+		    version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND version = $5
+		RETURNING version, change_seq, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, folder.ID, folder.UserID, folder.Name, nullableID(folder.ParentID), folder.Version).Scan(
+		&folder.Version, &folder.ChangeSeq, &folder.CreatedAt, &folder.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rejectionError(tx, folder.ID, folder.UserID)
+		}
+		return WrapError(err, "не удалось обновить папку")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return nil
+}
+
+// DeleteFolder оставляет от папки надгробие, а ее вложенные папки и секреты (в том числе
+// из корзины) поднимает в родительскую папку. version 0 - без проверки версии.
+func (r *DatabaseRepository) DeleteFolder(id string, userID int, version int) (*DeleteResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	if err := lockFolders(tx, userID); err != nil {
+		return nil, err
+	}
+
+	var parentID sql.NullString
+	err = tx.QueryRow(`
+		UPDATE folders
+		SET deleted_at = NOW(),
+		    version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+		RETURNING parent_id
+	`, id, userID, version).Scan(&parentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rejectionError(tx, id, userID)
+		}
+		return nil, WrapError(err, "не удалось удалить папку")
+	}
+
+	result := &DeleteResult{}
+
+	result.FolderIDs, err = queryIDs(tx, `
+		UPDATE folders
+		SET parent_id = $3,
+		    version = version + 1
+		WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING id
+	`, id, userID, parentID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось перенести вложенные папки")
+	}
+
+	// Версия секрета из корзины не меняется, чтобы не сломать проверку версии при восстановлении
+	result.SecretIDs, err = queryIDs(tx, `
+		WITH moved AS (
+		    UPDATE secrets
+		    SET folder_id = $3,
+		        version = CASE WHEN deleted_at IS NULL THEN version + 1 ELSE version END
+		    WHERE folder_id = $1 AND user_id = $2 AND purged_at IS NULL
+		    RETURNING id, deleted_at
+		)
+		SELECT id FROM moved WHERE deleted_at IS NULL
+	`, id, userID, parentID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось перенести секреты папки")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return result, nil
+}
+
+// Move переносит секреты и папки в req.TargetID одной транзакцией. Если хотя бы один
+// элемент не найден или папка попала бы внутрь себя, не переносится ничего.
+func (r *DatabaseRepository) Move(userID int, req *MoveRequest) (*MoveResult, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	if err := lockFolders(tx, userID); err != nil {
+		return nil, err
+	}
+	if err := checkParent(tx, userID, req.TargetID); err != nil {
+		return nil, err
+	}
+	if err := checkCycle(tx, userID, req.TargetID, req.FolderIDs); err != nil {
+		return nil, err
+	}
+
+	result := &MoveResult{SecretIDs: []string{}, FolderIDs: []string{}}
+
+	if len(req.FolderIDs) > 0 {
+		found, err := countLive(tx, "folders", userID, req.FolderIDs)
+		if err != nil {
+			return nil, err
+		}
+		if found != countUnique(req.FolderIDs) {
+			return nil, ErrFolderNotFound
+		}
+
+		result.FolderIDs, err = queryIDs(tx, `
+			UPDATE folders
+			SET parent_id = $3,
+			    version = version + 1
+			WHERE user_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+			  AND parent_id IS DISTINCT FROM $3::uuid
+			RETURNING id
+		`, userID, req.FolderIDs, nullableID(req.TargetID))
+		if err != nil {
+			return nil, WrapError(err, "не удалось перенести папки")
+		}
+	}
+
+	if len(req.SecretIDs) > 0 {
+		found, err := countLive(tx, "secrets", userID, req.SecretIDs)
+		if err != nil {
+			return nil, err
+		}
+		if found != countUnique(req.SecretIDs) {
+			return nil, ErrSecretNotFound
+		}
+
+		result.SecretIDs, err = queryIDs(tx, `
+			UPDATE secrets
+			SET folder_id = $3,
+			    version = version + 1
+			WHERE user_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+			  AND folder_id IS DISTINCT FROM $3::uuid
+			RETURNING id
+		`, userID, req.SecretIDs, nullableID(req.TargetID))
+		if err != nil {
+			return nil, WrapError(err, "не удалось перенести секреты")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return result, nil
+}
+
+// GetFolderChanges возвращает до limit папок пользователя, включая надгробия,
+// измененных после номера afterSeq, в порядке номеров изменений
+func (r *DatabaseRepository) GetFolderChanges(userID int, afterSeq int64, limit int) ([]*Folder, error) {
+	query := `
+		SELECT ` + folderColumns + `
+		FROM folders
+		WHERE user_id = $1 AND change_seq > $2
+		ORDER BY change_seq ASC
+		LIMIT $3
+	`
+
+	folders, err := queryFolders(r.db, query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить измененные папки")
+	}
+
+	return folders, nil
+}
+
+// PurgeTombstones физически удаляет надгробия папок старше deletedBefore,
+// если все устройства пользователя уже получили удаление
+func (r *DatabaseRepository) PurgeTombstones(deletedBefore time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM folders f
+		WHERE f.deleted_at IS NOT NULL AND f.deleted_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM sync_devices d
+		      WHERE d.user_id = f.user_id AND d.last_synced_seq < f.change_seq
+		  )
+	`, deletedBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить надгробия папок")
+	}
+
+	return result.RowsAffected()
+}
+
+// lockFolders блокирует папки пользователя до конца транзакции: два встречных переноса,
+// выполненных одновременно, могли бы замкнуть папки в цикл
+func lockFolders(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`SELECT id FROM folders WHERE user_id = $1 AND deleted_at IS NULL FOR UPDATE`, userID)
+	if err != nil {
+		return WrapError(err, "не удалось заблокировать папки")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// checkParent проверяет, что parentID - неудаленная папка пользователя. Пустой parentID - корень.
+func checkParent(q rowQuerier, userID int, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, parentID, userID).Scan(&exists)
+	if err != nil {
+		return WrapError(err, "не удалось проверить родительскую папку")
+	}
+	if !exists {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+// checkCycle не дает перенести папки в parentID, если parentID - одна из них или вложена в одну из них
+func checkCycle(q rowQuerier, userID int, parentID string, folderIDs []string) error {
+	if parentID == "" || len(folderIDs) == 0 {
+		return nil
+	}
+
+	var cycle bool
+	err := q.QueryRow(`
+		WITH RECURSIVE ancestors AS (
+		    SELECT id, parent_id FROM folders WHERE id = $1 AND user_id = $2
+		    UNION
+		    SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = ANY($3::uuid[]))
+	`, parentID, userID, folderIDs).Scan(&cycle)
+	if err != nil {
+		return WrapError(err, "не удалось проверить вложенность папок")
+	}
+	if cycle {
+		return ErrCycle
+	}
+	return nil
+}
+
+// rejectionError объясняет, почему изменение с проверкой версии не затронуло ни одной строки
+func rejectionError(q rowQuerier, id string, userID int) error {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, id, userID).Scan(&exists)
+	if err != nil {
+		return WrapError(err, "не удалось проверить версию папки")
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrFolderNotFound
+}
+
+// countLive считает неудаленные строки пользователя в table (folders или secrets) среди ids
+func countLive(q rowQuerier, table string, userID int, ids []string) (int, error) {
+	var count int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM `+table+` WHERE user_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+	`, userID, ids).Scan(&count)
+	if err != nil {
+		return 0, WrapError(err, "не удалось проверить переносимые элементы")
+	}
+	return count, nil
+}
+
+func countUnique(ids []string) int {
+	unique := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return len(unique)
+}
+
+func queryIDs(q rowQuerier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func queryFolders(q rowQuerier, query string, args ...interface{}) ([]*Folder, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var folders []*Folder
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanFolder(row scanner) (*Folder, error) {
+	var folder Folder
+	var parentID sql.NullString
+
+	err := row.Scan(
+		&folder.ID,
+		&folder.UserID,
+		&parentID,
+		&folder.Name,
+		&folder.Version,
+		&folder.ChangeSeq,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+		&folder.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	folder.ParentID = parentID.String
+	return &folder, nil
+}
+
+// nullableID - пустой ID папки означает корень (NULL)
+func nullableID(id string) sql.NullString {
+	return sql.NullString{String: id, Valid: id != ""}
+}
@@ -0,0 +1,308 @@
+package folder
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/google/uuid"
+)
+
+// RealtimeService рассылает изменения папок и перенесенных секретов на другие устройства
+type RealtimeService interface {
+	NotifyFolderCreated(userID int, folderID string, excludeSessionID string) error
+	NotifyFolderUpdated(userID int, folderID string, excludeSessionID string) error
+	NotifyFolderDeleted(userID int, folderID string, excludeSessionID string) error
+	NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error
+}
+
+type Service struct {
+	repo            Repository
+	realtimeService RealtimeService
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+func (s *Service) SetRealtimeService(realtimeService RealtimeService) {
+	s.realtimeService = realtimeService
+}
+
+func (s *Service) CreateFolder(userID int, req *CreateFolderRequest, excludeSessionID string) (*Folder, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	id, err := normalizeID(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	parentID, err := normalizeID(req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateName(req.Name); err != nil {
+		return nil, err
+	}
+
+	folder := &Folder{
+		ID:       id,
+		UserID:   userID,
+		ParentID: parentID,
+		Name:     req.Name,
+	}
+
+	if err := s.repo.CreateFolder(folder); err != nil {
+		if !errors.Is(err, ErrFolderAlreadyExists) && !errors.Is(err, ErrParentNotFound) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Folder] Ошибка создания папки в репозитории")
+		}
+		return nil, WrapError(err, "не удалось создать папку")
+	}
+
+	s.notify(RealtimeService.NotifyFolderCreated, userID, folder.ID, excludeSessionID)
+
+	return folder, nil
+}
+
+func (s *Service) GetFolder(id string, userID int) (*Folder, error) {
+	id, err := pathID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err := s.repo.GetFolder(id, userID)
+	if err != nil {
+		if !errors.Is(err, ErrFolderNotFound) {
+			logger.Log.WithFields(map[string]interface{}{
+				"folder_id": id,
+				"user_id":   userID,
+				"error":     err.Error(),
+			}).Error("[Folder] Ошибка получения папки из репозитория")
+		}
+		return nil, WrapError(err, "не удалось получить папку")
+	}
+
+	return folder, nil
+}
+
+func (s *Service) ListFolders(userID int) ([]*Folder, error) {
+	folders, err := s.repo.ListFolders(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Folder] Ошибка получения папок из репозитория")
+		return nil, WrapError(err, "не удалось получить папки")
+	}
+
+	if folders == nil {
+		folders = []*Folder{}
+	}
+
+	return folders, nil
+}
+
+// UpdateFolder переименовывает папку и переносит ее в req.ParentID
+func (s *Service) UpdateFolder(id string, userID int, req *UpdateFolderRequest, excludeSessionID string) (*Folder, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	id, err := pathID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	parentID, err := normalizeID(req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateName(req.Name); err != nil {
+		return nil, err
+	}
+
+	folder := &Folder{
+		ID:       id,
+		UserID:   userID,
+		ParentID: parentID,
+		Name:     req.Name,
+		Version:  req.Version,
+	}
+
+	if err := s.repo.UpdateFolder(folder); err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"folder_id": id,
+				"user_id":   userID,
+				"error":     err.Error(),
+			}).Error("[Folder] Ошибка обновления папки в репозитории")
+		}
+		return nil, WrapError(err, "не удалось обновить папку")
+	}
+
+	s.notify(RealtimeService.NotifyFolderUpdated, userID, folder.ID, excludeSessionID)
+
+	return folder, nil
+}
+
+// DeleteFolder удаляет папку, поднимая ее содержимое на уровень выше. version 0 - без проверки версии.
+func (s *Service) DeleteFolder(id string, userID int, version int, excludeSessionID string) error {
+	id, err := pathID(id)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.repo.DeleteFolder(id, userID, version)
+	if err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"folder_id": id,
+				"user_id":   userID,
+				"error":     err.Error(),
+			}).Error("[Folder] Ошибка удаления папки в репозитории")
+		}
+		return WrapError(err, "не удалось удалить папку")
+	}
+
+	s.notify(RealtimeService.NotifyFolderDeleted, userID, id, excludeSessionID)
+	s.notifyMoved(userID, result.FolderIDs, result.SecretIDs, excludeSessionID)
+
+	return nil
+}
+
+// Move переносит секреты и папки в req.TargetID. Элементы, которые уже там, не меняются.
+func (s *Service) Move(userID int, req *MoveRequest, excludeSessionID string) (*MoveResult, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	if len(req.SecretIDs) == 0 && len(req.FolderIDs) == 0 {
+		return nil, ErrNothingToMove
+	}
+	if len(req.SecretIDs)+len(req.FolderIDs) > MaxMoveItems {
+		return nil, ErrTooManyItems
+	}
+
+	targetID, err := normalizeID(req.TargetID)
+	if err != nil {
+		return nil, err
+	}
+	normalized := &MoveRequest{TargetID: targetID}
+	if normalized.SecretIDs, err = normalizeIDs(req.SecretIDs); err != nil {
+		return nil, err
+	}
+	if normalized.FolderIDs, err = normalizeIDs(req.FolderIDs); err != nil {
+		return nil, err
+	}
+
+	result, err := s.repo.Move(userID, normalized)
+	if err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"target_id": targetID,
+				"error":     err.Error(),
+			}).Error("[Folder] Ошибка переноса в репозитории")
+		}
+		return nil, WrapError(err, "не удалось перенести элементы")
+	}
+
+	s.notifyMoved(userID, result.FolderIDs, result.SecretIDs, excludeSessionID)
+
+	return result, nil
+}
+
+// GetFolderChanges - папки для ленты синхронизации, включая надгробия
+func (s *Service) GetFolderChanges(userID int, afterSeq int64, limit int) ([]*Folder, error) {
+	return s.repo.GetFolderChanges(userID, afterSeq, limit)
+}
+
+// notifyMoved сообщает о папках и секретах, которые поменяли родителя
+func (s *Service) notifyMoved(userID int, folderIDs, secretIDs []string, excludeSessionID string) {
+	for _, folderID := range folderIDs {
+		s.notify(RealtimeService.NotifyFolderUpdated, userID, folderID, excludeSessionID)
+	}
+
+	if s.realtimeService == nil || len(secretIDs) == 0 {
+		return
+	}
+	if err := s.realtimeService.NotifySecretsBatch(userID, nil, secretIDs, nil, excludeSessionID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Folder] Ошибка отправки события переноса секретов через WebSocket")
+	}
+}
+
+func (s *Service) notify(send func(RealtimeService, int, string, string) error, userID int, folderID string, excludeSessionID string) {
+	if s.realtimeService == nil {
+		return
+	}
+	if err := send(s.realtimeService, userID, folderID, excludeSessionID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"folder_id": folderID,
+			"error":     err.Error(),
+		}).Error("[Folder] Ошибка отправки события папки через WebSocket")
+	}
+}
+
+func isExpectedError(err error) bool {
+	for _, expected := range []error{ErrFolderNotFound, ErrVersionConflict, ErrParentNotFound, ErrCycle, ErrSecretNotFound} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return ErrNameRequired
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return ErrNameTooLong
+	}
+	return nil
+}
+
+// normalizeID проверяет UUID и приводит его к каноническому виду. Пустой ID допустим.
+func normalizeID(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return parsed.String(), nil
+}
+
+// pathID - ID папки из пути запроса. Строка, не являющаяся UUID, не может быть ID папки.
+func pathID(id string) (string, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrFolderNotFound
+	}
+	return parsed.String(), nil
+}
+
+func normalizeIDs(ids []string) ([]string, error) {
+	normalized := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return nil, ErrInvalidID
+		}
+		parsed, err := normalizeID(id)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, parsed)
+	}
+	return normalized, nil
+}
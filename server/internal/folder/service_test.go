@@ -0,0 +1,410 @@
+package folder
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockRepository хранит папки в памяти. secrets - ID секрета -> ID папки (пусто - корень).
+type MockRepository struct {
+	folders   map[string]*Folder
+	secrets   map[string]string
+	changeSeq int64
+	idCounter int
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		folders: make(map[string]*Folder),
+		secrets: make(map[string]string),
+	}
+}
+
+func (m *MockRepository) touch(folder *Folder) {
+	m.changeSeq++
+	folder.ChangeSeq = m.changeSeq
+	folder.UpdatedAt = time.Now()
+}
+
+func (m *MockRepository) live(id string, userID int) (*Folder, bool) {
+	folder, ok := m.folders[id]
+	if !ok || folder.UserID != userID || folder.DeletedAt.Valid {
+		return nil, false
+	}
+	return folder, true
+}
+
+func (m *MockRepository) CreateFolder(folder *Folder) error {
+	if folder.ParentID != "" {
+		if _, ok := m.live(folder.ParentID, folder.UserID); !ok {
+			return ErrParentNotFound
+		}
+	}
+	if folder.ID == "" {
+		m.idCounter++
+		folder.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", m.idCounter)
+	}
+	if _, exists := m.folders[folder.ID]; exists {
+		return ErrFolderAlreadyExists
+	}
+
+	folder.Version = 1
+	folder.CreatedAt = time.Now()
+	m.touch(folder)
+	stored := *folder
+	m.folders[folder.ID] = &stored
+	return nil
+}
+
+func (m *MockRepository) GetFolder(id string, userID int) (*Folder, error) {
+	folder, ok := m.live(id, userID)
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+	copied := *folder
+	return &copied, nil
+}
+
+func (m *MockRepository) ListFolders(userID int) ([]*Folder, error) {
+	var result []*Folder
+	for _, folder := range m.folders {
+		if folder.UserID == userID && !folder.DeletedAt.Valid {
+			result = append(result, folder)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) UpdateFolder(folder *Folder) error {
+	if err := m.checkMove(folder.UserID, folder.ParentID, []string{folder.ID}); err != nil {
+		return err
+	}
+	existing, ok := m.live(folder.ID, folder.UserID)
+	if !ok {
+		return ErrFolderNotFound
+	}
+	if existing.Version != folder.Version {
+		return ErrVersionConflict
+	}
+
+	existing.Name = folder.Name
+	existing.ParentID = folder.ParentID
+	existing.Version++
+	m.touch(existing)
+	*folder = *existing
+	return nil
+}
+
+func (m *MockRepository) DeleteFolder(id string, userID int, version int) (*DeleteResult, error) {
+	existing, ok := m.live(id, userID)
+	if !ok {
+		return nil, ErrFolderNotFound
+	}
+	if version != 0 && existing.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	existing.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	existing.Version++
+	m.touch(existing)
+
+	result := &DeleteResult{}
+	for _, child := range m.folders {
+		if child.ParentID == id && !child.DeletedAt.Valid {
+			child.ParentID = existing.ParentID
+			child.Version++
+			m.touch(child)
+			result.FolderIDs = append(result.FolderIDs, child.ID)
+		}
+	}
+	for secretID, folderID := range m.secrets {
+		if folderID == id {
+			m.secrets[secretID] = existing.ParentID
+			result.SecretIDs = append(result.SecretIDs, secretID)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) Move(userID int, req *MoveRequest) (*MoveResult, error) {
+	if err := m.checkMove(userID, req.TargetID, req.FolderIDs); err != nil {
+		return nil, err
+	}
+	for _, id := range req.FolderIDs {
+		if _, ok := m.live(id, userID); !ok {
+			return nil, ErrFolderNotFound
+		}
+	}
+	for _, id := range req.SecretIDs {
+		if _, ok := m.secrets[id]; !ok {
+			return nil, ErrSecretNotFound
+		}
+	}
+
+	result := &MoveResult{SecretIDs: []string{}, FolderIDs: []string{}}
+	for _, id := range req.FolderIDs {
+		folder := m.folders[id]
+		if folder.ParentID != req.TargetID {
+			folder.ParentID = req.TargetID
+			folder.Version++
+			m.touch(folder)
+			result.FolderIDs = append(result.FolderIDs, id)
+		}
+	}
+	for _, id := range req.SecretIDs {
+		if m.secrets[id] != req.TargetID {
+			m.secrets[id] = req.TargetID
+			result.SecretIDs = append(result.SecretIDs, id)
+		}
+	}
+	return result, nil
+}
+
+// checkMove повторяет проверки родителя и цикла из DatabaseRepository
+func (m *MockRepository) checkMove(userID int, parentID string, folderIDs []string) error {
+	if parentID == "" {
+		return nil
+	}
+	if _, ok := m.live(parentID, userID); !ok {
+		return ErrParentNotFound
+	}
+	for current := parentID; current != ""; current = m.folders[current].ParentID {
+		for _, id := range folderIDs {
+			if current == id {
+				return ErrCycle
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MockRepository) GetFolderChanges(userID int, afterSeq int64, limit int) ([]*Folder, error) {
+	var result []*Folder
+	for _, folder := range m.folders {
+		if folder.UserID == userID && folder.ChangeSeq > afterSeq {
+			result = append(result, folder)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) PurgeTombstones(deletedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+type folderEvent struct {
+	Type     string
+	FolderID string
+}
+
+type MockRealtimeService struct {
+	events       []folderEvent
+	movedSecrets []string
+}
+
+func (m *MockRealtimeService) NotifyFolderCreated(userID int, folderID string, excludeSessionID string) error {
+	m.events = append(m.events, folderEvent{"created", folderID})
+	return nil
+}
+
+func (m *MockRealtimeService) NotifyFolderUpdated(userID int, folderID string, excludeSessionID string) error {
+	m.events = append(m.events, folderEvent{"updated", folderID})
+	return nil
+}
+
+func (m *MockRealtimeService) NotifyFolderDeleted(userID int, folderID string, excludeSessionID string) error {
+	m.events = append(m.events, folderEvent{"deleted", folderID})
+	return nil
+}
+
+func (m *MockRealtimeService) NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error {
+	m.movedSecrets = append(m.movedSecrets, updated...)
+	return nil
+}
+
+func newTestService() (*Service, *MockRepository, *MockRealtimeService) {
+	repo := NewMockRepository()
+	realtime := &MockRealtimeService{}
+	service := NewService(repo)
+	service.SetRealtimeService(realtime)
+	return service, repo, realtime
+}
+
+func TestService_CreateFolder(t *testing.T) {
+	service, _, realtime := newTestService()
+
+	parent, err := service.CreateFolder(1, &CreateFolderRequest{Name: "Работа"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, parent.Version)
+	assert.Empty(t, parent.ParentID)
+
+	child, err := service.CreateFolder(1, &CreateFolderRequest{Name: "Серверы", ParentID: strings.ToUpper(parent.ID)}, "")
+	require.NoError(t, err)
+	assert.Equal(t, parent.ID, child.ParentID, "ID родителя приводится к каноническому виду")
+
+	assert.Equal(t, []folderEvent{{"created", parent.ID}, {"created", child.ID}}, realtime.events)
+}
+
+func TestService_CreateFolder_Validation(t *testing.T) {
+	service, _, _ := newTestService()
+
+	tests := []struct {
+		name string
+		req  *CreateFolderRequest
+		err  error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"empty name", &CreateFolderRequest{Name: "  "}, ErrNameRequired},
+		{"long name", &CreateFolderRequest{Name: strings.Repeat("я", MaxNameLength+1)}, ErrNameTooLong},
+		{"invalid id", &CreateFolderRequest{ID: "not-a-uuid", Name: "a"}, ErrInvalidID},
+		{"invalid parent", &CreateFolderRequest{Name: "a", ParentID: "not-a-uuid"}, ErrInvalidID},
+		{"unknown parent", &CreateFolderRequest{Name: "a", ParentID: "11111111-1111-1111-1111-111111111111"}, ErrParentNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateFolder(1, tt.req, "")
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestService_CreateFolder_ClientID(t *testing.T) {
+	service, _, _ := newTestService()
+	id := "6f1c2b7e-3d4a-4f5b-8c6d-7e8f9a0b1c2d"
+
+	folder, err := service.CreateFolder(1, &CreateFolderRequest{ID: id, Name: "a"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, id, folder.ID)
+
+	_, err = service.CreateFolder(1, &CreateFolderRequest{ID: id, Name: "a"}, "")
+	assert.ErrorIs(t, err, ErrFolderAlreadyExists)
+}
+
+func TestService_UpdateFolder(t *testing.T) {
+	service, _, realtime := newTestService()
+
+	a, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "a"}, "")
+	b, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "b"}, "")
+
+	moved, err := service.UpdateFolder(b.ID, 1, &UpdateFolderRequest{Name: "b2", ParentID: a.ID, Version: 1}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "b2", moved.Name)
+	assert.Equal(t, a.ID, moved.ParentID)
+	assert.Equal(t, 2, moved.Version)
+	assert.Equal(t, folderEvent{"updated", b.ID}, realtime.events[len(realtime.events)-1])
+
+	_, err = service.UpdateFolder(b.ID, 1, &UpdateFolderRequest{Name: "b3", Version: 1}, "")
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	// a нельзя перенести внутрь вложенной в нее b
+	_, err = service.UpdateFolder(a.ID, 1, &UpdateFolderRequest{Name: "a", ParentID: b.ID, Version: 1}, "")
+	assert.ErrorIs(t, err, ErrCycle)
+
+	_, err = service.UpdateFolder(a.ID, 1, &UpdateFolderRequest{Name: "a", ParentID: a.ID, Version: 1}, "")
+	assert.ErrorIs(t, err, ErrCycle)
+
+	_, err = service.UpdateFolder("not-a-uuid", 1, &UpdateFolderRequest{Name: "a", Version: 1}, "")
+	assert.ErrorIs(t, err, ErrFolderNotFound)
+}
+
+func TestService_DeleteFolder(t *testing.T) {
+	service, repo, realtime := newTestService()
+
+	parent, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "parent"}, "")
+	doomed, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "doomed", ParentID: parent.ID}, "")
+	child, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "child", ParentID: doomed.ID}, "")
+	repo.secrets["secret-1"] = doomed.ID
+
+	assert.ErrorIs(t, service.DeleteFolder(doomed.ID, 1, 5, ""), ErrVersionConflict)
+
+	require.NoError(t, service.DeleteFolder(doomed.ID, 1, doomed.Version, ""))
+
+	_, err := service.GetFolder(doomed.ID, 1)
+	assert.ErrorIs(t, err, ErrFolderNotFound)
+
+	lifted, err := service.GetFolder(child.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, parent.ID, lifted.ParentID, "вложенная папка поднимается в родителя удаленной")
+	assert.Equal(t, parent.ID, repo.secrets["secret-1"])
+
+	assert.Contains(t, realtime.events, folderEvent{"deleted", doomed.ID})
+	assert.Contains(t, realtime.events, folderEvent{"updated", child.ID})
+	assert.Equal(t, []string{"secret-1"}, realtime.movedSecrets)
+
+	changes, _ := repo.GetFolderChanges(1, 0, 10)
+	var tombstone bool
+	for _, folder := range changes {
+		if folder.ID == doomed.ID {
+			tombstone = folder.DeletedAt.Valid
+		}
+	}
+	assert.True(t, tombstone, "удаленная папка остается в ленте синхронизации надгробием")
+}
+
+func TestService_Move(t *testing.T) {
+	service, repo, realtime := newTestService()
+
+	target, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "target"}, "")
+	folder, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "folder"}, "")
+	repo.secrets["11111111-1111-1111-1111-111111111111"] = ""
+	repo.secrets["22222222-2222-2222-2222-222222222222"] = target.ID
+
+	result, err := service.Move(1, &MoveRequest{
+		TargetID:  target.ID,
+		SecretIDs: []string{"11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222"},
+		FolderIDs: []string{folder.ID},
+	}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"11111111-1111-1111-1111-111111111111"}, result.SecretIDs, "секрет, уже лежащий в папке, не меняется")
+	assert.Equal(t, []string{folder.ID}, result.FolderIDs)
+	assert.Equal(t, result.SecretIDs, realtime.movedSecrets)
+	assert.Equal(t, folderEvent{"updated", folder.ID}, realtime.events[len(realtime.events)-1])
+
+	// Обратно в корень
+	result, err = service.Move(1, &MoveRequest{FolderIDs: []string{folder.ID}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{folder.ID}, result.FolderIDs)
+}
+
+func TestService_Move_Validation(t *testing.T) {
+	service, _, _ := newTestService()
+
+	folder, _ := service.CreateFolder(1, &CreateFolderRequest{Name: "folder"}, "")
+	tooMany := make([]string, MaxMoveItems+1)
+
+	tests := []struct {
+		name string
+		req  *MoveRequest
+		err  error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"nothing to move", &MoveRequest{TargetID: folder.ID}, ErrNothingToMove},
+		{"too many", &MoveRequest{SecretIDs: tooMany}, ErrTooManyItems},
+		{"invalid secret id", &MoveRequest{SecretIDs: []string{"x"}}, ErrInvalidID},
+		{"empty folder id", &MoveRequest{FolderIDs: []string{""}}, ErrInvalidID},
+		{"unknown secret", &MoveRequest{SecretIDs: []string{"33333333-3333-3333-3333-333333333333"}}, ErrSecretNotFound},
+		{"into itself", &MoveRequest{TargetID: folder.ID, FolderIDs: []string{folder.ID}}, ErrCycle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Move(1, tt.req, "")
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestService_WithoutRealtime(t *testing.T) {
+	service := NewService(NewMockRepository())
+
+	folder, err := service.CreateFolder(1, &CreateFolderRequest{Name: "a"}, "")
+	require.NoError(t, err)
+	assert.NoError(t, service.DeleteFolder(folder.ID, 1, 0, ""))
+}
@@ -0,0 +1,19 @@
+package idempotency
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidKey        = errors.New("idempotency.invalid_key")
+	ErrKeyReused         = errors.New("idempotency.key_reused")
+	ErrRequestInProgress = errors.New("idempotency.request_in_progress")
+)
+
+func WrapError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,272 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+)
+
+// Middleware повторяет сохраненный ответ на запрос, ключ Idempotency-Key которого уже встречался.
+// Ключи действуют в пределах пользователя, поэтому обработчик оборачивается после RequireAuth.
+type Middleware struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewMiddleware создает middleware, которое помнит ответы в течение ttl
+func NewMiddleware(store Store, ttl time.Duration) *Middleware {
+	return &Middleware{
+		store: store,
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Wrap выполняет next один раз на ключ. Ответы 5xx не сохраняются: такой запрос можно повторить.
+// Повтор с тем же ключом, но другим запросом отклоняется с 422, а пока первый запрос
+// выполняется - с 409. Вместе с ответом повторяются Content-Type и ETag.
+func (m *Middleware) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderKey)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+			return
+		}
+
+		if len(key) > MaxKeyLength {
+			localization.LocalizedError(w, r, http.StatusBadRequest, ErrInvalidKey.Error(), map[string]interface{}{
+				"Max": MaxKeyLength,
+			})
+			return
+		}
+
+		fingerprint, err := requestFingerprint(r)
+		if err != nil {
+			localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+			return
+		}
+
+		now := m.now()
+		existing, err := m.store.Reserve(&Record{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			CreatedAt:   now,
+		}, now.Add(-m.ttl), now.Add(-PendingTimeout))
+		if errors.Is(err, ErrRequestInProgress) {
+			localization.LocalizedError(w, r, http.StatusConflict, err.Error(), nil)
+			return
+		}
+		if err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Idempotency] Ошибка получения ключа идемпотентности")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+
+		if existing != nil {
+			// Завершенный потоковый запрос сверяется по содержимому тела: его приходится дочитать
+			if isStream(r) && !existing.IsPending() {
+				fingerprint, err = streamFingerprint(r)
+				if err != nil {
+					localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+					return
+				}
+			}
+			replay(w, r, existing, fingerprint)
+			return
+		}
+
+		var stream *hashingBody
+		if isStream(r) {
+			stream = newHashingBody(r)
+			r.Body = stream
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		defer func() {
+			// Обработчик упал или ответил 5xx - ключ освобождается для повтора
+			if !completed {
+				m.release(userID, key)
+			}
+		}()
+
+		next(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		if stream != nil {
+			// Ответ на тело, прочитанное не до конца, нельзя связать с его содержимым:
+			// такой запрос не запоминается и при повторе выполняется заново
+			if !stream.eof {
+				return
+			}
+			fingerprint = hex.EncodeToString(stream.hash.Sum(nil))
+		}
+
+		err = m.store.Complete(&Record{
+			UserID:      userID,
+			Key:         key,
+			Fingerprint: fingerprint,
+			StatusCode:  recorder.status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			ETag:        recorder.Header().Get("ETag"),
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Idempotency] Ошибка сохранения ответа")
+			return
+		}
+		completed = true
+	}
+}
+
+func (m *Middleware) release(userID int, key string) {
+	if err := m.store.Release(userID, key); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Warn("[Idempotency] Не удалось освободить ключ идемпотентности")
+	}
+}
+
+func replay(w http.ResponseWriter, r *http.Request, record *Record, fingerprint string) {
+	if record.Fingerprint != fingerprint {
+		localization.LocalizedError(w, r, http.StatusUnprocessableEntity, ErrKeyReused.Error(), nil)
+		return
+	}
+	if record.IsPending() {
+		localization.LocalizedError(w, r, http.StatusConflict, ErrRequestInProgress.Error(), nil)
+		return
+	}
+
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	if record.ETag != "" {
+		w.Header().Set("ETag", record.ETag)
+	}
+	w.Header().Set(HeaderReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+	if _, err := w.Write(record.Body); err != nil {
+		logger.Errorf("[Idempotency] Ошибка отправки сохраненного ответа: %v", err)
+	}
+}
+
+// requestFingerprint - SHA-256 метода, адреса и тела запроса. Потоковые загрузки
+// (application/octet-stream) не буферизуются: пока запрос выполняется, вместо тела
+// учитывается его длина, а итоговый отпечаток считается по мере чтения тела (см. hashingBody).
+func requestFingerprint(r *http.Request) (string, error) {
+	hash := newRequestHash(r)
+
+	if isStream(r) {
+		io.WriteString(hash, r.Header.Get("Content-Length"))
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	if r.Body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return "", err
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// streamFingerprint дочитывает потоковое тело и возвращает отпечаток, совпадающий
+// с тем, что hashingBody сохранил для исходного запроса
+func streamFingerprint(r *http.Request) (string, error) {
+	hash := newRequestHash(r)
+	if r.Body != nil {
+		if _, err := io.Copy(hash, r.Body); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func newRequestHash(r *http.Request) hash.Hash {
+	h := sha256.New()
+	io.WriteString(h, r.Method+"\n"+r.URL.RequestURI()+"\n")
+	return h
+}
+
+func isStream(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/octet-stream")
+}
+
+// hashingBody хеширует тело потоковой загрузки, пока его читает обработчик.
+// eof - тело прочитано целиком, и хеш покрывает все содержимое.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	eof  bool
+}
+
+func newHashingBody(r *http.Request) *hashingBody {
+	body := r.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	return &hashingBody{ReadCloser: body, hash: newRequestHash(r)}
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// responseRecorder передает ответ клиенту и одновременно запоминает его
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
@@ -0,0 +1,264 @@
+package idempotency
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRequest(userID int, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+}
+
+// countingHandler отвечает 201 с номером вызова и проверяет, что тело запроса доступно
+func countingHandler(calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"call":` + strconv.Itoa(*calls) + `,"body":` + string(body) + `}`))
+	}
+}
+
+func TestMiddleware_ReplaysResponse(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(countingHandler(&calls))
+
+	first := httptest.NewRecorder()
+	handler(first, newRequest(1, "key-1", `{"a":1}`))
+
+	second := httptest.NewRecorder()
+	handler(second, newRequest(1, "key-1", `{"a":1}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, `{"call":1,"body":{"a":1}}`, second.Body.String())
+	assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+	assert.Equal(t, "true", second.Header().Get(HeaderReplayed))
+	assert.Empty(t, first.Header().Get(HeaderReplayed))
+}
+
+func TestMiddleware_WithoutKey(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(countingHandler(&calls))
+
+	handler(httptest.NewRecorder(), newRequest(1, "", `{}`))
+	handler(httptest.NewRecorder(), newRequest(1, "", `{}`))
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_KeysArePerUser(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(countingHandler(&calls))
+
+	handler(httptest.NewRecorder(), newRequest(1, "key", `{}`))
+	handler(httptest.NewRecorder(), newRequest(2, "key", `{}`))
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_KeyReusedWithDifferentRequest(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(countingHandler(&calls))
+
+	handler(httptest.NewRecorder(), newRequest(1, "key", `{"a":1}`))
+
+	w := httptest.NewRecorder()
+	handler(w, newRequest(1, "key", `{"a":2}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestMiddleware_RequestInProgress(t *testing.T) {
+	store := NewMemoryStore()
+	m := NewMiddleware(store, time.Hour)
+
+	var inner *httptest.ResponseRecorder
+	handler := m.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		// Повтор приходит, пока первый запрос еще выполняется
+		inner = httptest.NewRecorder()
+		m.Wrap(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Handler must not run twice")
+		})(inner, newRequest(1, "key", `{}`))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, newRequest(1, "key", `{}`))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	require.NotNil(t, inner)
+	assert.Equal(t, http.StatusConflict, inner.Code)
+}
+
+func TestMiddleware_ServerErrorReleasesKey(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	first := httptest.NewRecorder()
+	handler(first, newRequest(1, "key", `{}`))
+	second := httptest.NewRecorder()
+	handler(second, newRequest(1, "key", `{}`))
+
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusInternalServerError, first.Code)
+	assert.Equal(t, http.StatusOK, second.Code)
+}
+
+func TestMiddleware_ClientErrorIsReplayed(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusConflict)
+	})
+
+	handler(httptest.NewRecorder(), newRequest(1, "key", `{}`))
+	w := httptest.NewRecorder()
+	handler(w, newRequest(1, "key", `{}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestMiddleware_ExpiredKey(t *testing.T) {
+	calls := 0
+	m := NewMiddleware(NewMemoryStore(), time.Hour)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	handler := m.Wrap(countingHandler(&calls))
+
+	handler(httptest.NewRecorder(), newRequest(1, "key", `{}`))
+	now = now.Add(30 * time.Minute)
+	handler(httptest.NewRecorder(), newRequest(1, "key", `{}`))
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Hour)
+	handler(httptest.NewRecorder(), newRequest(1, "key", `{}`))
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_KeyTooLong(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(countingHandler(&calls))
+
+	w := httptest.NewRecorder()
+	handler(w, newRequest(1, strings.Repeat("k", MaxKeyLength+1), `{}`))
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRequestFingerprint_Stream(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/1/blob?version=2", strings.NewReader("data"))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", "4")
+
+	fingerprint, err := requestFingerprint(req)
+	require.NoError(t, err)
+	assert.Len(t, fingerprint, 64)
+
+	// Тело потоковой загрузки не читается
+	body, _ := io.ReadAll(req.Body)
+	assert.Equal(t, "data", string(body))
+
+	other := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/1/blob?version=3", strings.NewReader("data"))
+	other.Header.Set("Content-Type", "application/octet-stream")
+	other.Header.Set("Content-Length", "4")
+	otherFingerprint, _ := requestFingerprint(other)
+	assert.NotEqual(t, fingerprint, otherFingerprint)
+}
+
+func newStreamRequest(userID int, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/1/blob", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	req.Header.Set(HeaderKey, key)
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+}
+
+func TestMiddleware_StreamReplayedBySameBody(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(countingHandler(&calls))
+
+	handler(httptest.NewRecorder(), newStreamRequest(1, "key", `"aaaa"`))
+
+	same := httptest.NewRecorder()
+	handler(same, newStreamRequest(1, "key", `"aaaa"`))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, same.Code)
+	assert.Equal(t, "true", same.Header().Get(HeaderReplayed))
+
+	// Тело той же длины, но с другим содержимым
+	other := httptest.NewRecorder()
+	handler(other, newStreamRequest(1, "key", `"bbbb"`))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, other.Code)
+}
+
+func TestMiddleware_StreamNotReadIsNotStored(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	handler(httptest.NewRecorder(), newStreamRequest(1, "key", "data"))
+	handler(httptest.NewRecorder(), newStreamRequest(1, "key", "data"))
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddleware_ReplaysETag(t *testing.T) {
+	calls := 0
+	handler := NewMiddleware(NewMemoryStore(), time.Hour).Wrap(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("ETag", `"checksum"`)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handler(httptest.NewRecorder(), newStreamRequest(1, "key", "data"))
+	w := httptest.NewRecorder()
+	handler(w, newStreamRequest(1, "key", "data"))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, `"checksum"`, w.Header().Get("ETag"))
+}
+
+func TestPurger_PurgeOnce(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	store.Reserve(&Record{UserID: 1, Key: "old", CreatedAt: now.Add(-2 * time.Hour)}, time.Time{}, time.Time{})
+	store.Reserve(&Record{UserID: 1, Key: "fresh", CreatedAt: now.Add(-time.Minute)}, time.Time{}, time.Time{})
+
+	purger := NewPurger(store, time.Hour, time.Hour)
+
+	assert.Equal(t, int64(1), purger.PurgeOnce(now))
+	assert.Len(t, store.records, 1)
+}
@@ -0,0 +1,35 @@
+package idempotency
+
+import "time"
+
+const (
+	// HeaderKey - заголовок, в котором клиент передает ключ идемпотентности
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed выставляется в ответе, повторенном из сохраненного
+	HeaderReplayed = "Idempotent-Replayed"
+
+	MaxKeyLength = 255
+
+	// PendingTimeout - через сколько незавершенный запрос (например, при падении сервера)
+	// перестает блокировать свой ключ
+	PendingTimeout = 5 * time.Minute
+
+	// PurgeInterval - как часто удаляются устаревшие ключи
+	PurgeInterval = time.Hour
+)
+
+// Record - ключ идемпотентности и ответ на запрос с ним. StatusCode 0 - запрос еще выполняется.
+type Record struct {
+	UserID      int
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	ETag        string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+func (r *Record) IsPending() bool {
+	return r.StatusCode == 0
+}
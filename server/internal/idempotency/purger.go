@@ -0,0 +1,76 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+)
+
+// Purger периодически удаляет ключи идемпотентности старше ttl
+type Purger struct {
+	store    Store
+	ttl      time.Duration
+	interval time.Duration
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewPurger(store Store, ttl, interval time.Duration) *Purger {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Purger{
+		store:    store,
+		ttl:      ttl,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (p *Purger) Start() {
+	p.wg.Add(1)
+	go p.run()
+	logger.Info("[Idempotency] Очистка ключей идемпотентности запущена")
+}
+
+func (p *Purger) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	logger.Info("[Idempotency] Очистка ключей идемпотентности остановлена")
+}
+
+func (p *Purger) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.PurgeOnce(time.Now())
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce удаляет устаревшие ключи и возвращает их количество
+func (p *Purger) PurgeOnce(now time.Time) int64 {
+	deleted, err := p.store.DeleteExpired(now.Add(-p.ttl))
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("[Idempotency] Ошибка удаления устаревших ключей")
+		return 0
+	}
+
+	if deleted > 0 {
+		logger.Infof("[Idempotency] Удалено устаревших ключей: %d", deleted)
+	}
+
+	return deleted
+}
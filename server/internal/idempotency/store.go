@@ -0,0 +1,174 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Store хранит ключи идемпотентности вместе с ответами
+type Store interface {
+	// Reserve занимает ключ под новый запрос. Если ключ уже занят, возвращает существующую запись.
+	// Записи, созданные раньше expiredBefore, и незавершенные записи старше staleBefore
+	// считаются свободными.
+	Reserve(record *Record, expiredBefore, staleBefore time.Time) (*Record, error)
+	// Complete сохраняет ответ и окончательный отпечаток запроса
+	Complete(record *Record) error
+	Release(userID int, key string) error
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+// DatabaseStore хранит ключи в таблице idempotency_keys
+type DatabaseStore struct {
+	db *sql.DB
+}
+
+func NewDatabaseStore(db *sql.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) Reserve(record *Record, expiredBefore, staleBefore time.Time) (*Record, error) {
+	// Устаревшая запись перезаписывается тем же запросом, поэтому гонки двух повторов нет:
+	// строку получит только один из них
+	var userID int
+	err := s.db.QueryRow(`
+		INSERT INTO idempotency_keys (user_id, key, fingerprint, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+		    status_code = 0,
+		    content_type = '',
+		    etag = '',
+		    body = NULL,
+		    created_at = EXCLUDED.created_at
+		WHERE idempotency_keys.created_at < $5
+		   OR (idempotency_keys.status_code = 0 AND idempotency_keys.created_at < $6)
+		RETURNING user_id
+	`, record.UserID, record.Key, record.Fingerprint, record.CreatedAt, expiredBefore, staleBefore).Scan(&userID)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, WrapError(err, "не удалось занять ключ идемпотентности")
+	}
+
+	existing := &Record{UserID: record.UserID, Key: record.Key}
+	err = s.db.QueryRow(`
+		SELECT fingerprint, status_code, content_type, etag, body, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`, record.UserID, record.Key).Scan(
+		&existing.Fingerprint,
+		&existing.StatusCode,
+		&existing.ContentType,
+		&existing.ETag,
+		&existing.Body,
+		&existing.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Запись удалили между запросами: ее владелец завершился ошибкой, клиент может повторить
+		return nil, ErrRequestInProgress
+	}
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить ключ идемпотентности")
+	}
+
+	return existing, nil
+}
+
+func (s *DatabaseStore) Complete(record *Record) error {
+	_, err := s.db.Exec(`
+		UPDATE idempotency_keys
+		SET fingerprint = $3, status_code = $4, content_type = $5, etag = $6, body = $7
+		WHERE user_id = $1 AND key = $2
+	`, record.UserID, record.Key, record.Fingerprint, record.StatusCode, record.ContentType, record.ETag, record.Body)
+	if err != nil {
+		return WrapError(err, "не удалось сохранить ответ")
+	}
+	return nil
+}
+
+func (s *DatabaseStore) Release(userID int, key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2`, userID, key)
+	if err != nil {
+		return WrapError(err, "не удалось освободить ключ идемпотентности")
+	}
+	return nil
+}
+
+func (s *DatabaseStore) DeleteExpired(before time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить устаревшие ключи идемпотентности")
+	}
+	return result.RowsAffected()
+}
+
+type memoryKey struct {
+	userID int
+	key    string
+}
+
+// MemoryStore хранит ключи в памяти процесса. Подходит для тестов и одного экземпляра сервера.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[memoryKey]*Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[memoryKey]*Record)}
+}
+
+func (s *MemoryStore) Reserve(record *Record, expiredBefore, staleBefore time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := memoryKey{userID: record.UserID, key: record.Key}
+	if existing, ok := s.records[id]; ok {
+		expired := existing.CreatedAt.Before(expiredBefore) ||
+			(existing.IsPending() && existing.CreatedAt.Before(staleBefore))
+		if !expired {
+			copied := *existing
+			return &copied, nil
+		}
+	}
+
+	stored := *record
+	stored.StatusCode, stored.ContentType, stored.ETag, stored.Body = 0, "", "", nil
+	s.records[id] = &stored
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stored, ok := s.records[memoryKey{userID: record.UserID, key: record.Key}]; ok {
+		stored.Fingerprint = record.Fingerprint
+		stored.StatusCode, stored.ContentType, stored.ETag, stored.Body = record.StatusCode, record.ContentType, record.ETag, record.Body
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(userID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, memoryKey{userID: userID, key: key})
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpired(before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, record := range s.records {
+		if record.CreatedAt.Before(before) {
+			delete(s.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
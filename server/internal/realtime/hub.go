@@ -146,6 +146,35 @@ func (h *Hub) BroadcastToUser(userID int, message *SecretEventMessage, excludeSe
 	return nil
 }
 
+// DisconnectUser закрывает все WebSocket подключения пользователя, например после удаления
+// аккаунта. Сессии уходят из hub в HandleDisconnect. Возвращает число закрытых подключений.
+func (h *Hub) DisconnectUser(userID int) int {
+	h.mu.RLock()
+	sessions := append([]*melody.Session(nil), h.connections[userID]...)
+	h.mu.RUnlock()
+
+	closed := 0
+	for _, session := range sessions {
+		if err := session.Close(); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Warn("[Realtime] Не удалось закрыть подключение")
+			continue
+		}
+		closed++
+	}
+
+	if closed > 0 {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":     userID,
+			"connections": closed,
+		}).Info("[Realtime] Подключения пользователя закрыты")
+	}
+
+	return closed
+}
+
 func (h *Hub) GetConnectionCount(userID int) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -1,9 +1,15 @@
 package realtime
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHub_GetConnectionCount_NoConnections(t *testing.T) {
@@ -69,6 +75,54 @@ func TestHub_GetSessionByID_NoSessions(t *testing.T) {
 	assert.Nil(t, session)
 }
 
+func TestHub_DisconnectUser_NoConnections(t *testing.T) {
+	hub := NewHub()
+
+	assert.Equal(t, 0, hub.DisconnectUser(1))
+}
+
+func TestHub_DisconnectUser(t *testing.T) {
+	hub := NewHub()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := 1
+		if r.URL.Query().Get("user") == "2" {
+			userID = 2
+		}
+		_ = hub.GetMelody().HandleRequestWithKeys(w, r, map[string]interface{}{"user_id": userID})
+	}))
+	defer server.Close()
+	defer hub.GetMelody().Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, nil)
+		require.NoError(t, err)
+		return conn
+	}
+
+	first := dial("?user=1")
+	defer first.Close()
+	second := dial("?user=1")
+	defer second.Close()
+	other := dial("?user=2")
+	defer other.Close()
+
+	require.Eventually(t, func() bool {
+		return hub.GetConnectionCount(1) == 2 && hub.GetConnectionCount(2) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 2, hub.DisconnectUser(1))
+
+	// Клиент получает закрытие, сессии уходят из hub
+	_ = first.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := first.ReadMessage()
+	assert.Error(t, err)
+	assert.Eventually(t, func() bool {
+		return hub.GetConnectionCount(1) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, hub.GetConnectionCount(2))
+}
+
 func TestHub_GetMelody(t *testing.T) {
 	hub := NewHub()
 
@@ -81,4 +135,5 @@ func TestSecretEventTypes_Values(t *testing.T) {
 	assert.Equal(t, "secret_created", string(SecretEventCreated))
 	assert.Equal(t, "secret_updated", string(SecretEventUpdated))
 	assert.Equal(t, "secret_deleted", string(SecretEventDeleted))
+	assert.Equal(t, "secret_restored", string(SecretEventRestored))
 }
@@ -64,3 +64,107 @@ func (s *Service) NotifySecretDeleted(userID int, secretID string, excludeSessio
 	message := NewSecretEventMessage(SecretEventDeleted, secretID, userID)
 	return s.hub.BroadcastToUser(userID, message, excludeSession)
 }
+
+func (s *Service) NotifySecretRestored(userID int, secretID string, excludeSessionID string) error {
+	var excludeSession *melody.Session
+	if excludeSessionID != "" {
+		excludeSession = s.hub.GetSessionByID(userID, excludeSessionID)
+	}
+
+	message := NewSecretEventMessage(SecretEventRestored, secretID, userID)
+	return s.hub.BroadcastToUser(userID, message, excludeSession)
+}
+
+// NotifySecretsBatch отправляет одно событие на весь пакет изменений вместо события на каждый секрет
+func (s *Service) NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error {
+	var excludeSession *melody.Session
+	if excludeSessionID != "" {
+		excludeSession = s.hub.GetSessionByID(userID, excludeSessionID)
+	}
+
+	events := make([]SecretEvent, 0, len(created)+len(updated)+len(deleted))
+	for _, group := range []struct {
+		eventType SecretEventType
+		ids       []string
+	}{
+		{SecretEventCreated, created},
+		{SecretEventUpdated, updated},
+		{SecretEventDeleted, deleted},
+	} {
+		for _, id := range group.ids {
+			events = append(events, SecretEvent{Type: group.eventType, SecretID: id})
+		}
+	}
+
+	message := NewSecretBatchMessage(userID, events)
+	return s.hub.BroadcastToUser(userID, message, excludeSession)
+}
+
+// NotifySecretShared сообщает о выдаче или изменении доступа к секрету
+func (s *Service) NotifySecretShared(userID int, secretID string, excludeSessionID string) error {
+	return s.notifySecret(SecretEventShared, userID, secretID, excludeSessionID)
+}
+
+// NotifySecretUnshared сообщает об отзыве доступа к секрету
+func (s *Service) NotifySecretUnshared(userID int, secretID string, excludeSessionID string) error {
+	return s.notifySecret(SecretEventUnshared, userID, secretID, excludeSessionID)
+}
+
+func (s *Service) notifySecret(eventType SecretEventType, userID int, secretID string, excludeSessionID string) error {
+	var excludeSession *melody.Session
+	if excludeSessionID != "" {
+		excludeSession = s.hub.GetSessionByID(userID, excludeSessionID)
+	}
+
+	message := NewSecretEventMessage(eventType, secretID, userID)
+	return s.hub.BroadcastToUser(userID, message, excludeSession)
+}
+
+func (s *Service) NotifyFolderCreated(userID int, folderID string, excludeSessionID string) error {
+	return s.notifyFolder(FolderEventCreated, userID, folderID, excludeSessionID)
+}
+
+func (s *Service) NotifyFolderUpdated(userID int, folderID string, excludeSessionID string) error {
+	return s.notifyFolder(FolderEventUpdated, userID, folderID, excludeSessionID)
+}
+
+func (s *Service) NotifyFolderDeleted(userID int, folderID string, excludeSessionID string) error {
+	return s.notifyFolder(FolderEventDeleted, userID, folderID, excludeSessionID)
+}
+
+func (s *Service) notifyFolder(eventType SecretEventType, userID int, folderID string, excludeSessionID string) error {
+	var excludeSession *melody.Session
+	if excludeSessionID != "" {
+		excludeSession = s.hub.GetSessionByID(userID, excludeSessionID)
+	}
+
+	message := NewFolderEventMessage(eventType, folderID, userID)
+	return s.hub.BroadcastToUser(userID, message, excludeSession)
+}
+
+func (s *Service) NotifyTagCreated(userID int, tagID string, excludeSessionID string) error {
+	return s.notifyTag(TagEventCreated, userID, tagID, excludeSessionID)
+}
+
+func (s *Service) NotifyTagUpdated(userID int, tagID string, excludeSessionID string) error {
+	return s.notifyTag(TagEventUpdated, userID, tagID, excludeSessionID)
+}
+
+func (s *Service) NotifyTagDeleted(userID int, tagID string, excludeSessionID string) error {
+	return s.notifyTag(TagEventDeleted, userID, tagID, excludeSessionID)
+}
+
+func (s *Service) notifyTag(eventType SecretEventType, userID int, tagID string, excludeSessionID string) error {
+	var excludeSession *melody.Session
+	if excludeSessionID != "" {
+		excludeSession = s.hub.GetSessionByID(userID, excludeSessionID)
+	}
+
+	message := NewTagEventMessage(eventType, tagID, userID)
+	return s.hub.BroadcastToUser(userID, message, excludeSession)
+}
+
+// DisconnectUser закрывает все подключения пользователя
+func (s *Service) DisconnectUser(userID int) int {
+	return s.hub.DisconnectUser(userID)
+}
@@ -55,6 +55,55 @@ func TestService_NotifySecretDeleted(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestService_NotifySecretRestored(t *testing.T) {
+	hub := NewHub()
+	service := NewService(hub)
+
+	err := service.NotifySecretRestored(1, "test-secret-id", "exclude-session")
+	assert.NoError(t, err)
+}
+
+func TestService_NotifySecretsBatch(t *testing.T) {
+	hub := NewHub()
+	service := NewService(hub)
+
+	err := service.NotifySecretsBatch(1, []string{"s1"}, []string{"s2"}, []string{"s3"}, "exclude-session")
+	assert.NoError(t, err)
+}
+
+func TestService_NotifyShareEvents(t *testing.T) {
+	hub := NewHub()
+	service := NewService(hub)
+
+	assert.NoError(t, service.NotifySecretShared(2, "secret-1", "exclude-session"))
+	assert.NoError(t, service.NotifySecretUnshared(2, "secret-1", ""))
+}
+
+func TestService_DisconnectUser_NoConnections(t *testing.T) {
+	hub := NewHub()
+	service := NewService(hub)
+
+	assert.Equal(t, 0, service.DisconnectUser(1))
+}
+
+func TestService_NotifyFolderEvents(t *testing.T) {
+	hub := NewHub()
+	service := NewService(hub)
+
+	assert.NoError(t, service.NotifyFolderCreated(1, "folder-1", "exclude-session"))
+	assert.NoError(t, service.NotifyFolderUpdated(1, "folder-1", "exclude-session"))
+	assert.NoError(t, service.NotifyFolderDeleted(1, "folder-1", ""))
+}
+
+func TestService_NotifyTagEvents(t *testing.T) {
+	hub := NewHub()
+	service := NewService(hub)
+
+	assert.NoError(t, service.NotifyTagCreated(1, "tag-1", "exclude-session"))
+	assert.NoError(t, service.NotifyTagUpdated(1, "tag-1", "exclude-session"))
+	assert.NoError(t, service.NotifyTagDeleted(1, "tag-1", ""))
+}
+
 func TestService_NotifySecretCreated_WithActiveConnections(t *testing.T) {
 	hub := NewHub()
 	service := NewService(hub)
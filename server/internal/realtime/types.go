@@ -5,18 +5,43 @@ import "time"
 type SecretEventType string
 
 const (
-	SecretEventCreated SecretEventType = "secret_created"
-	SecretEventUpdated SecretEventType = "secret_updated"
-	SecretEventDeleted SecretEventType = "secret_deleted"
+	SecretEventCreated  SecretEventType = "secret_created"
+	SecretEventUpdated  SecretEventType = "secret_updated"
+	SecretEventDeleted  SecretEventType = "secret_deleted"
+	SecretEventRestored SecretEventType = "secret_restored"
+
+	// SecretEventShared и SecretEventUnshared получают владелец и получатель доступа к секрету
+	SecretEventShared   SecretEventType = "secret_shared"
+	SecretEventUnshared SecretEventType = "secret_unshared"
+
+	// SecretEventBatch объединяет изменения одного пакета POST /secrets/sync/push
+	SecretEventBatch SecretEventType = "secrets_batch"
+
+	FolderEventCreated SecretEventType = "folder_created"
+	FolderEventUpdated SecretEventType = "folder_updated"
+	FolderEventDeleted SecretEventType = "folder_deleted"
+
+	TagEventCreated SecretEventType = "tag_created"
+	TagEventUpdated SecretEventType = "tag_updated"
+	TagEventDeleted SecretEventType = "tag_deleted"
 )
 
 type SecretEventMessage struct {
 	Type      SecretEventType `json:"type"`
-	SecretID  string          `json:"secret_id"`
+	SecretID  string          `json:"secret_id,omitempty"`
+	FolderID  string          `json:"folder_id,omitempty"`
+	TagID     string          `json:"tag_id,omitempty"`
 	UserID    int             `json:"user_id"`
+	Events    []SecretEvent   `json:"events,omitempty"`
 	Timestamp string          `json:"timestamp"`
 }
 
+// SecretEvent - одно изменение внутри пакетного события
+type SecretEvent struct {
+	Type     SecretEventType `json:"type"`
+	SecretID string          `json:"secret_id"`
+}
+
 func NewSecretEventMessage(eventType SecretEventType, secretID string, userID int) *SecretEventMessage {
 	return &SecretEventMessage{
 		Type:      eventType,
@@ -25,3 +50,30 @@ func NewSecretEventMessage(eventType SecretEventType, secretID string, userID in
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 }
+
+func NewFolderEventMessage(eventType SecretEventType, folderID string, userID int) *SecretEventMessage {
+	return &SecretEventMessage{
+		Type:      eventType,
+		FolderID:  folderID,
+		UserID:    userID,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
+
+func NewTagEventMessage(eventType SecretEventType, tagID string, userID int) *SecretEventMessage {
+	return &SecretEventMessage{
+		Type:      eventType,
+		TagID:     tagID,
+		UserID:    userID,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
+
+func NewSecretBatchMessage(userID int, events []SecretEvent) *SecretEventMessage {
+	return &SecretEventMessage{
+		Type:      SecretEventBatch,
+		UserID:    userID,
+		Events:    events,
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
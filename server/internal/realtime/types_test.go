@@ -46,6 +46,51 @@ func TestSecretEventTypes(t *testing.T) {
 			eventType: SecretEventDeleted,
 			expected:  "secret_deleted",
 		},
+		{
+			name:      "Secret Restored Event",
+			eventType: SecretEventRestored,
+			expected:  "secret_restored",
+		},
+		{
+			name:      "Secret Shared Event",
+			eventType: SecretEventShared,
+			expected:  "secret_shared",
+		},
+		{
+			name:      "Secret Unshared Event",
+			eventType: SecretEventUnshared,
+			expected:  "secret_unshared",
+		},
+		{
+			name:      "Folder Created Event",
+			eventType: FolderEventCreated,
+			expected:  "folder_created",
+		},
+		{
+			name:      "Folder Updated Event",
+			eventType: FolderEventUpdated,
+			expected:  "folder_updated",
+		},
+		{
+			name:      "Folder Deleted Event",
+			eventType: FolderEventDeleted,
+			expected:  "folder_deleted",
+		},
+		{
+			name:      "Tag Created Event",
+			eventType: TagEventCreated,
+			expected:  "tag_created",
+		},
+		{
+			name:      "Tag Updated Event",
+			eventType: TagEventUpdated,
+			expected:  "tag_updated",
+		},
+		{
+			name:      "Tag Deleted Event",
+			eventType: TagEventDeleted,
+			expected:  "tag_deleted",
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,6 +111,7 @@ func TestSecretEventMessage_AllEventTypes(t *testing.T) {
 		{"Created event", SecretEventCreated},
 		{"Updated event", SecretEventUpdated},
 		{"Deleted event", SecretEventDeleted},
+		{"Restored event", SecretEventRestored},
 	}
 
 	for _, tt := range tests {
@@ -79,6 +125,26 @@ func TestSecretEventMessage_AllEventTypes(t *testing.T) {
 	}
 }
 
+func TestNewFolderEventMessage(t *testing.T) {
+	message := NewFolderEventMessage(FolderEventUpdated, "folder-1", 1)
+
+	assert.Equal(t, FolderEventUpdated, message.Type)
+	assert.Equal(t, "folder-1", message.FolderID)
+	assert.Empty(t, message.SecretID)
+	assert.Equal(t, 1, message.UserID)
+	assert.NotEmpty(t, message.Timestamp)
+}
+
+func TestNewTagEventMessage(t *testing.T) {
+	message := NewTagEventMessage(TagEventDeleted, "tag-1", 1)
+
+	assert.Equal(t, TagEventDeleted, message.Type)
+	assert.Equal(t, "tag-1", message.TagID)
+	assert.Empty(t, message.SecretID)
+	assert.Equal(t, 1, message.UserID)
+	assert.NotEmpty(t, message.Timestamp)
+}
+
 func TestSecretEventMessage_TimestampUniqueness(t *testing.T) {
 	msg1 := NewSecretEventMessage(SecretEventCreated, "secret-1", 1)
 	time.Sleep(1 * time.Millisecond)
@@ -90,3 +156,18 @@ func TestSecretEventMessage_TimestampUniqueness(t *testing.T) {
 
 	assert.True(t, ts2.After(ts1) || ts2.Equal(ts1), "Second message timestamp should be equal or after the first")
 }
+
+func TestNewSecretBatchMessage(t *testing.T) {
+	events := []SecretEvent{
+		{Type: SecretEventCreated, SecretID: "s1"},
+		{Type: SecretEventDeleted, SecretID: "s2"},
+	}
+
+	message := NewSecretBatchMessage(7, events)
+
+	assert.Equal(t, SecretEventBatch, message.Type)
+	assert.Equal(t, 7, message.UserID)
+	assert.Empty(t, message.SecretID)
+	assert.Equal(t, events, message.Events)
+	assert.NotEmpty(t, message.Timestamp)
+}
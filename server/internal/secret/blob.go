@@ -0,0 +1,87 @@
+package secret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// blobPieceSize - размер части, которой бинарные данные читаются из хранилища
+const blobPieceSize = 1024 * 1024
+
+// BlobStore хранит бинарные данные секретов вне базы. Ключи выбирает репозиторий,
+// в базе остаются только ссылка, размер и контрольная сумма.
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	ReadRange(key string, offset, length int64) ([]byte, error)
+	Delete(key string) error
+}
+
+// blobChecksum возвращает SHA-256 данных в hex - в таком виде контрольная сумма хранится и отдается клиентам
+func blobChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// BlobReader читает часть бинарных данных секрета
+type BlobReader interface {
+	ReadBlob(info *BlobInfo, offset, length int64) ([]byte, error)
+}
+
+// blobReaderAt отдает бинарные данные секрета через io.ReaderAt, запрашивая их у хранилища
+// частями не меньше blobPieceSize, чтобы не обращаться к хранилищу на каждые несколько килобайт.
+// Все части читаются из одного объекта info.Ref.
+type blobReaderAt struct {
+	source BlobReader
+	info   *BlobInfo
+	size   int64
+
+	pieceOffset int64
+	piece       []byte
+}
+
+// NewBlobReader возвращает io.ReadSeeker по бинарным данным, описанным info
+func NewBlobReader(source BlobReader, info *BlobInfo) io.ReadSeeker {
+	return io.NewSectionReader(&blobReaderAt{
+		source: source,
+		info:   info,
+		size:   info.Size,
+	}, 0, info.Size)
+}
+
+func (b *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < b.size {
+		if off < b.pieceOffset || off >= b.pieceOffset+int64(len(b.piece)) {
+			length := int64(len(p) - n)
+			if length < blobPieceSize {
+				length = blobPieceSize
+			}
+
+			piece, err := b.source.ReadBlob(b.info, off, length)
+			if err != nil {
+				return n, err
+			}
+			if len(piece) == 0 {
+				return n, io.ErrUnexpectedEOF
+			}
+
+			b.pieceOffset = off
+			b.piece = piece
+		}
+
+		copied := copy(p[n:], b.piece[off-b.pieceOffset:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
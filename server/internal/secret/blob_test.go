@@ -0,0 +1,49 @@
+package secret
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingBlobSource struct {
+	data  []byte
+	calls int
+}
+
+func (s *countingBlobSource) ReadBlob(info *BlobInfo, offset, length int64) ([]byte, error) {
+	s.calls++
+	end := offset + length
+	if end > int64(len(s.data)) {
+		end = int64(len(s.data))
+	}
+	return s.data[offset:end], nil
+}
+
+func TestBlobReader_ReadsInPieces(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), blobPieceSize*2+10)
+	source := &countingBlobSource{data: data}
+
+	reader := NewBlobReader(source, &BlobInfo{SecretID: "s1", UserID: 1, Size: int64(len(data))})
+	result, err := io.ReadAll(reader)
+	require.NoError(t, err)
+
+	assert.Equal(t, data, result)
+	assert.Equal(t, 3, source.calls)
+}
+
+func TestBlobReader_Seek(t *testing.T) {
+	source := &countingBlobSource{data: []byte("0123456789")}
+
+	reader := NewBlobReader(source, &BlobInfo{SecretID: "s1", UserID: 1, Size: 10})
+	_, err := reader.Seek(4, io.SeekStart)
+	require.NoError(t, err)
+
+	part := make([]byte, 3)
+	_, err = io.ReadFull(reader, part)
+	require.NoError(t, err)
+	assert.Equal(t, "456", string(part))
+}
@@ -10,7 +10,6 @@ type ChunkedUploadSession struct {
 	UserID      string    `json:"user_id"`
 	TotalChunks int       `json:"total_chunks"`
 	TotalSize   int64     `json:"total_size"`
-	Chunks      [][]byte  `json:"-"`
 	CreatedAt   time.Time `json:"created_at"`
 	ExpiresAt   time.Time `json:"expires_at"`
 }
@@ -31,6 +30,8 @@ type UploadChunkRequest struct {
 	ChunkIndex  int    `json:"chunkIndex"`
 	TotalChunks int    `json:"totalChunks"`
 	Data        string `json:"data"`
+	// Checksum - SHA-256 части (hex) до кодирования в base64. Проверяется, если передан.
+	Checksum string `json:"checksum,omitempty"`
 }
 
 type UploadChunkResponse struct {
@@ -38,16 +39,30 @@ type UploadChunkResponse struct {
 	Received   bool `json:"received"`
 }
 
+// ChunkedUploadStatusResponse позволяет клиенту продолжить загрузку после обрыва соединения
+type ChunkedUploadStatusResponse struct {
+	UploadID      string    `json:"uploadId"`
+	SecretID      string    `json:"secretId"`
+	TotalChunks   int       `json:"totalChunks"`
+	MissingChunks []int     `json:"missingChunks"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
 type FinalizeChunkedUploadRequest struct {
 	UploadID string            `json:"uploadId"`
+	Type     SecretType        `json:"type,omitempty"`
 	Login    string            `json:"login"`
 	Password string            `json:"password"`
 	Metadata map[string]string `json:"metadata"`
 	Version  *int              `json:"version,omitempty"`
+	// Checksum - SHA-256 всего файла (hex). Проверяется, если передан.
+	Checksum string `json:"checksum,omitempty"`
 }
 
 type DownloadChunkResponse struct {
 	ChunkIndex  int    `json:"chunkIndex"`
 	Data        string `json:"data"`
 	TotalChunks int    `json:"totalChunks"`
+	// Checksum - SHA-256 всего файла (hex), чтобы клиент проверил собранные части
+	Checksum string `json:"checksum,omitempty"`
 }
@@ -1,10 +1,12 @@
 package secret
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestInitChunkedUploadRequest(t *testing.T) {
@@ -101,7 +103,6 @@ func TestChunkedUploadSession(t *testing.T) {
 		UserID:      "user-789",
 		TotalChunks: 5,
 		TotalSize:   500000,
-		Chunks:      make([][]byte, 5),
 		CreatedAt:   now,
 		ExpiresAt:   now.Add(1 * time.Hour),
 	}
@@ -111,25 +112,21 @@ func TestChunkedUploadSession(t *testing.T) {
 	assert.Equal(t, "user-789", session.UserID)
 	assert.Equal(t, 5, session.TotalChunks)
 	assert.Equal(t, int64(500000), session.TotalSize)
-	assert.Len(t, session.Chunks, 5)
 	assert.Equal(t, now, session.CreatedAt)
 	assert.True(t, session.ExpiresAt.After(now))
 }
 
-func TestChunkedUploadSession_WithChunks(t *testing.T) {
-	session := ChunkedUploadSession{
-		UploadID:    "upload-999",
-		SecretID:    "secret-999",
-		UserID:      "user-999",
-		TotalChunks: 3,
-		TotalSize:   300,
-		Chunks:      [][]byte{[]byte("chunk1"), []byte("chunk2"), []byte("chunk3")},
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(30 * time.Minute),
+func TestChunkedUploadStatusResponse(t *testing.T) {
+	resp := ChunkedUploadStatusResponse{
+		UploadID:      "upload-999",
+		SecretID:      "secret-999",
+		TotalChunks:   3,
+		MissingChunks: []int{1},
+		ExpiresAt:     time.Now().Add(30 * time.Minute),
 	}
 
-	assert.Len(t, session.Chunks, 3)
-	assert.Equal(t, []byte("chunk1"), session.Chunks[0])
-	assert.Equal(t, []byte("chunk2"), session.Chunks[1])
-	assert.Equal(t, []byte("chunk3"), session.Chunks[2])
+	data, err := json.Marshal(resp)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"missingChunks":[1]`)
+	assert.Contains(t, string(data), `"uploadId":"upload-999"`)
 }
@@ -1,8 +1,14 @@
 package secret
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,22 +16,59 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	// uploadSessionTTL - сколько сессия живет без новых частей. Каждая часть продлевает сессию.
+	uploadSessionTTL = 30 * time.Minute
+	// uploadCleanupInterval - как часто удаляются истекшие сессии
+	uploadCleanupInterval = 5 * time.Minute
+
+	// MaxUploadSize - наибольший размер файла, загружаемого по частям
+	MaxUploadSize = 4 << 30
+	// MaxUploadChunks - наибольшее число частей одной загрузки
+	MaxUploadChunks = 100000
+	// MaxUploadChunkSize - наибольший размер одной части до кодирования в base64
+	MaxUploadChunkSize = 4 << 20
+	// maxChunkRequestSize - наибольшее тело запроса с частью: часть в base64 и остальные поля JSON
+	maxChunkRequestSize = (MaxUploadChunkSize+2)/3*4 + 64<<10
+)
+
 type ChunkedUploadService struct {
-	sessions map[string]*ChunkedUploadSession
-	mu       sync.RWMutex
+	store  UploadStore
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewChunkedUploadService() *ChunkedUploadService {
-	service := &ChunkedUploadService{
-		sessions: make(map[string]*ChunkedUploadSession),
+// NewChunkedUploadService создает сервис загрузок. Истекшие сессии удаляются только после Start.
+func NewChunkedUploadService(store UploadStore) *ChunkedUploadService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ChunkedUploadService{
+		store:  store,
+		ctx:    ctx,
+		cancel: cancel,
 	}
+}
 
-	go service.cleanupExpiredSessions()
+func (s *ChunkedUploadService) Start() {
+	s.wg.Add(1)
+	go s.cleanupExpiredSessions()
+	logger.Info("[ChunkedUpload] Очистка истекших сессий запущена")
+}
 
-	return service
+func (s *ChunkedUploadService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	logger.Info("[ChunkedUpload] Очистка истекших сессий остановлена")
 }
 
+// InitUpload открывает сессию загрузки. Каждая часть должна быть непустой, поэтому частей
+// не может быть больше, чем байт в файле. Пустой файл загружается без частей: 0 частей и 0 байт.
 func (s *ChunkedUploadService) InitUpload(userID string, totalChunks int, totalSize int64) (*ChunkedUploadSession, error) {
+	emptyFile := totalChunks == 0 && totalSize == 0
+	if !emptyFile && (totalChunks <= 0 || totalChunks > MaxUploadChunks || totalSize <= 0 || totalSize > MaxUploadSize || int64(totalChunks) > totalSize) {
+		return nil, fmt.Errorf("%w: %d chunks, %d bytes", ErrInvalidUploadSize, totalChunks, totalSize)
+	}
+
 	uploadID := uuid.New().String()
 	secretID := uuid.New().String()
 
@@ -37,35 +80,35 @@ func (s *ChunkedUploadService) InitUpload(userID string, totalChunks int, totalS
 		"total_size":   totalSize,
 	}).Info("[ChunkedUpload] Инициализация загрузки")
 
+	now := time.Now()
 	session := &ChunkedUploadSession{
 		UploadID:    uploadID,
 		SecretID:    secretID,
 		UserID:      userID,
 		TotalChunks: totalChunks,
 		TotalSize:   totalSize,
-		Chunks:      make([][]byte, totalChunks),
-		CreatedAt:   time.Now(),
-		ExpiresAt:   time.Now().Add(30 * time.Minute),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(uploadSessionTTL),
 	}
 
-	s.mu.Lock()
-	s.sessions[uploadID] = session
-	s.mu.Unlock()
+	if err := s.store.CreateSession(session); err != nil {
+		return nil, err
+	}
 
 	return session, nil
 }
 
-func (s *ChunkedUploadService) UploadChunk(uploadID string, chunkIndex int, data string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	session, exists := s.sessions[uploadID]
-	if !exists {
-		return fmt.Errorf("upload session not found or expired")
+// UploadChunk сохраняет часть файла. Если передан checksum (SHA-256 в hex), часть с другим
+// содержимым отклоняется, чтобы клиент отправил ее повторно. Часть, с которой сохраненные
+// данные превысили бы totalSize, отклоняется с ErrUploadSizeExceeded.
+func (s *ChunkedUploadService) UploadChunk(uploadID string, chunkIndex int, data string, checksum string) error {
+	session, err := s.GetSession(uploadID)
+	if err != nil {
+		return err
 	}
 
 	if chunkIndex < 0 || chunkIndex >= session.TotalChunks {
-		return fmt.Errorf("invalid chunk index: %d (totalChunks: %d)", chunkIndex, session.TotalChunks)
+		return fmt.Errorf("%w: %d (totalChunks: %d)", ErrChunkIndexInvalid, chunkIndex, session.TotalChunks)
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(data)
@@ -73,69 +116,154 @@ func (s *ChunkedUploadService) UploadChunk(uploadID string, chunkIndex int, data
 		return fmt.Errorf("failed to decode chunk data: %w", err)
 	}
 
-	session.Chunks[chunkIndex] = decoded
-	return nil
+	if len(decoded) > MaxUploadChunkSize || int64(len(decoded)) > session.TotalSize {
+		return fmt.Errorf("%w: chunk %d is %d bytes", ErrChunkTooLarge, chunkIndex, len(decoded))
+	}
+
+	if checksum != "" && !checksumMatches(decoded, checksum) {
+		return fmt.Errorf("%w: chunk %d", ErrChunkChecksumMismatch, chunkIndex)
+	}
+
+	return s.store.SaveChunk(uploadID, chunkIndex, decoded, time.Now().Add(uploadSessionTTL))
 }
 
-func (s *ChunkedUploadService) GetCompleteData(uploadID string) ([]byte, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// GetMissingChunks возвращает индексы частей, которые клиенту еще нужно отправить
+func (s *ChunkedUploadService) GetMissingChunks(uploadID string) ([]int, error) {
+	session, err := s.GetSession(uploadID)
+	if err != nil {
+		return nil, err
+	}
 
-	session, exists := s.sessions[uploadID]
-	if !exists {
-		return nil, fmt.Errorf("upload session not found")
+	received, err := s.store.GetReceivedChunks(uploadID)
+	if err != nil {
+		return nil, err
 	}
 
-	for i, chunk := range session.Chunks {
-		if chunk == nil {
-			return nil, fmt.Errorf("chunk %d is missing", i)
+	present := make(map[int]bool, len(received))
+	for _, index := range received {
+		present[index] = true
+	}
+
+	missing := []int{}
+	for i := 0; i < session.TotalChunks; i++ {
+		if !present[i] {
+			missing = append(missing, i)
 		}
 	}
 
-	totalSize := 0
-	for _, chunk := range session.Chunks {
-		totalSize += len(chunk)
+	return missing, nil
+}
+
+// OpenData возвращает собранный файл потоком: части читаются из хранилища по одной в порядке
+// индексов. Размер сверяется с заявленным при инициализации, а SHA-256 - с checksum, если он
+// передан; расхождение возвращается ошибкой чтения, поэтому BlobStore не сохранит объект.
+func (s *ChunkedUploadService) OpenData(uploadID string, checksum string) (io.Reader, error) {
+	session, err := s.GetSession(uploadID)
+	if err != nil {
+		return nil, err
 	}
 
-	result := make([]byte, 0, totalSize)
-	for _, chunk := range session.Chunks {
-		result = append(result, chunk...)
+	missing, err := s.GetMissingChunks(uploadID)
+	if err != nil {
+		return nil, err
 	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: chunk %d is missing", ErrChunksNotComplete, missing[0])
+	}
+
+	return &uploadReader{
+		store:    s.store,
+		session:  session,
+		checksum: checksum,
+		hash:     sha256.New(),
+	}, nil
+}
+
+// uploadReader склеивает части загрузки, держа в памяти только текущую
+type uploadReader struct {
+	store    UploadStore
+	session  *ChunkedUploadSession
+	checksum string
+	hash     hash.Hash
+
+	next  int
+	chunk []byte
+	read  int64
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.next == r.session.TotalChunks {
+			return 0, r.verify()
+		}
+
+		chunk, err := r.store.GetChunk(r.session.UploadID, r.next)
+		if err != nil {
+			return 0, err
+		}
+		if r.read+int64(len(chunk)) > r.session.TotalSize {
+			return 0, fmt.Errorf("%w: more than %d bytes", ErrFileSizeMismatch, r.session.TotalSize)
+		}
+		r.next++
+		r.chunk = chunk
+	}
+
+	n := copy(p, r.chunk)
+	r.hash.Write(p[:n])
+	r.chunk = r.chunk[n:]
+	r.read += int64(n)
+	return n, nil
+}
 
-	return result, nil
+func (r *uploadReader) verify() error {
+	if r.read != r.session.TotalSize {
+		return fmt.Errorf("%w: got %d bytes, expected %d", ErrFileSizeMismatch, r.read, r.session.TotalSize)
+	}
+	if r.checksum != "" && !strings.EqualFold(hex.EncodeToString(r.hash.Sum(nil)), r.checksum) {
+		return ErrFileChecksumMismatch
+	}
+	return io.EOF
+}
+
+// checksumMatches сравнивает SHA-256 данных с hex-строкой клиента без учета регистра
+func checksumMatches(data []byte, checksum string) bool {
+	return strings.EqualFold(blobChecksum(data), checksum)
 }
 
 func (s *ChunkedUploadService) CleanupSession(uploadID string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.sessions, uploadID)
+	if err := s.store.DeleteSession(uploadID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"upload_id": uploadID,
+			"error":     err.Error(),
+		}).Error("[ChunkedUpload] Ошибка удаления сессии загрузки")
+	}
 }
 
 func (s *ChunkedUploadService) GetSession(uploadID string) (*ChunkedUploadSession, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	session, exists := s.sessions[uploadID]
-	if !exists {
-		return nil, fmt.Errorf("upload session not found")
+	if _, err := uuid.Parse(uploadID); err != nil {
+		return nil, ErrUploadSessionNotFound
 	}
 
-	return session, nil
+	return s.store.GetSession(uploadID)
 }
 
 func (s *ChunkedUploadService) cleanupExpiredSessions() {
-	ticker := time.NewTicker(5 * time.Minute)
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(uploadCleanupInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		now := time.Now()
-		s.mu.Lock()
-		for id, session := range s.sessions {
-			if now.After(session.ExpiresAt) {
-				delete(s.sessions, id)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.store.DeleteExpiredSessions(time.Now()); err != nil {
+				logger.Log.WithFields(map[string]interface{}{
+					"error": err.Error(),
+				}).Error("[ChunkedUpload] Ошибка удаления истекших сессий")
 			}
 		}
-		s.mu.Unlock()
 	}
 }
 
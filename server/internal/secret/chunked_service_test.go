@@ -2,6 +2,8 @@ package secret
 
 import (
 	"encoding/base64"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
@@ -10,7 +12,7 @@ import (
 )
 
 func TestChunkedUploadService_InitUpload(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	session, err := service.InitUpload("user-1", 5, 1000)
 	require.NoError(t, err)
@@ -19,11 +21,59 @@ func TestChunkedUploadService_InitUpload(t *testing.T) {
 	assert.Equal(t, "user-1", session.UserID)
 	assert.Equal(t, 5, session.TotalChunks)
 	assert.Equal(t, int64(1000), session.TotalSize)
-	assert.Equal(t, 5, len(session.Chunks))
+
+	missing, err := service.GetMissingChunks(session.UploadID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, missing)
+}
+
+func TestChunkedUploadService_InitUpload_InvalidSize(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
+
+	tests := []struct {
+		name        string
+		totalChunks int
+		totalSize   int64
+	}{
+		{name: "no chunks", totalChunks: 0, totalSize: 100},
+		{name: "empty file with chunks", totalChunks: 1, totalSize: 0},
+		{name: "chunks without size", totalChunks: 0, totalSize: -1},
+		{name: "negative chunks", totalChunks: -1, totalSize: 100},
+		{name: "too many chunks", totalChunks: MaxUploadChunks + 1, totalSize: MaxUploadSize},
+		{name: "too large", totalChunks: 10, totalSize: MaxUploadSize + 1},
+		{name: "more chunks than bytes", totalChunks: 10, totalSize: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.InitUpload("user-1", tt.totalChunks, tt.totalSize)
+			assert.ErrorIs(t, err, ErrInvalidUploadSize)
+		})
+	}
+}
+
+func TestChunkedUploadService_EmptyFile(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
+
+	session, err := service.InitUpload("user-1", 0, 0)
+	require.NoError(t, err)
+
+	data, err := readUpload(service, session.UploadID, blobChecksum(nil))
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+// readUpload читает собранный файл так же, как его читает BlobStore
+func readUpload(service *ChunkedUploadService, uploadID, checksum string) ([]byte, error) {
+	r, err := service.OpenData(uploadID, checksum)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
 }
 
 func TestChunkedUploadService_UploadChunk(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	session, err := service.InitUpload("user-1", 3, 300)
 	require.NoError(t, err)
@@ -31,16 +81,16 @@ func TestChunkedUploadService_UploadChunk(t *testing.T) {
 	data := []byte("test data")
 	encoded := base64.StdEncoding.EncodeToString(data)
 
-	err = service.UploadChunk(session.UploadID, 0, encoded)
+	err = service.UploadChunk(session.UploadID, 0, encoded, "")
 	assert.NoError(t, err)
 
-	retrievedSession, err := service.GetSession(session.UploadID)
+	missing, err := service.GetMissingChunks(session.UploadID)
 	require.NoError(t, err)
-	assert.NotNil(t, retrievedSession.Chunks[0])
+	assert.Equal(t, []int{1, 2}, missing)
 }
 
 func TestChunkedUploadService_UploadChunk_InvalidIndex(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	session, err := service.InitUpload("user-1", 3, 300)
 	require.NoError(t, err)
@@ -48,67 +98,67 @@ func TestChunkedUploadService_UploadChunk_InvalidIndex(t *testing.T) {
 	data := []byte("test data")
 	encoded := base64.StdEncoding.EncodeToString(data)
 
-	err = service.UploadChunk(session.UploadID, 5, encoded)
-	assert.Error(t, err)
+	err = service.UploadChunk(session.UploadID, 5, encoded, "")
+	assert.ErrorIs(t, err, ErrChunkIndexInvalid)
 }
 
 func TestChunkedUploadService_UploadChunk_SessionNotFound(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	data := []byte("test data")
 	encoded := base64.StdEncoding.EncodeToString(data)
 
-	err := service.UploadChunk("non-existent-id", 0, encoded)
-	assert.Error(t, err)
+	err := service.UploadChunk("non-existent-id", 0, encoded, "")
+	assert.ErrorIs(t, err, ErrUploadSessionNotFound)
 }
 
-func TestChunkedUploadService_GetCompleteData(t *testing.T) {
-	service := NewChunkedUploadService()
+func TestChunkedUploadService_OpenData(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
-	session, err := service.InitUpload("user-1", 3, 300)
+	session, err := service.InitUpload("user-1", 3, 18)
 	require.NoError(t, err)
 
 	chunk1 := []byte("chunk1")
 	chunk2 := []byte("chunk2")
 	chunk3 := []byte("chunk3")
 
-	err = service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString(chunk1))
+	err = service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString(chunk1), "")
 	require.NoError(t, err)
-	err = service.UploadChunk(session.UploadID, 1, base64.StdEncoding.EncodeToString(chunk2))
+	err = service.UploadChunk(session.UploadID, 1, base64.StdEncoding.EncodeToString(chunk2), "")
 	require.NoError(t, err)
-	err = service.UploadChunk(session.UploadID, 2, base64.StdEncoding.EncodeToString(chunk3))
+	err = service.UploadChunk(session.UploadID, 2, base64.StdEncoding.EncodeToString(chunk3), "")
 	require.NoError(t, err)
 
-	completeData, err := service.GetCompleteData(session.UploadID)
+	completeData, err := readUpload(service, session.UploadID, "")
 	require.NoError(t, err)
 
 	expected := append(append(chunk1, chunk2...), chunk3...)
 	assert.Equal(t, expected, completeData)
 }
 
-func TestChunkedUploadService_GetCompleteData_MissingChunk(t *testing.T) {
-	service := NewChunkedUploadService()
+func TestChunkedUploadService_OpenData_MissingChunk(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	session, err := service.InitUpload("user-1", 3, 300)
 	require.NoError(t, err)
 
 	chunk1 := []byte("chunk1")
-	err = service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString(chunk1))
+	err = service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString(chunk1), "")
 	require.NoError(t, err)
 
-	_, err = service.GetCompleteData(session.UploadID)
-	assert.Error(t, err)
+	_, err = readUpload(service, session.UploadID, "")
+	assert.ErrorIs(t, err, ErrChunksNotComplete)
 }
 
-func TestChunkedUploadService_GetCompleteData_SessionNotFound(t *testing.T) {
-	service := NewChunkedUploadService()
+func TestChunkedUploadService_OpenData_SessionNotFound(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
-	_, err := service.GetCompleteData("non-existent-id")
+	_, err := readUpload(service, "non-existent-id", "")
 	assert.Error(t, err)
 }
 
 func TestChunkedUploadService_CleanupSession(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	session, err := service.InitUpload("user-1", 3, 300)
 	require.NoError(t, err)
@@ -123,7 +173,7 @@ func TestChunkedUploadService_CleanupSession(t *testing.T) {
 }
 
 func TestChunkedUploadService_GetSession(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	session, err := service.InitUpload("user-1", 3, 300)
 	require.NoError(t, err)
@@ -136,34 +186,141 @@ func TestChunkedUploadService_GetSession(t *testing.T) {
 }
 
 func TestChunkedUploadService_GetSession_NotFound(t *testing.T) {
-	service := NewChunkedUploadService()
+	service := NewChunkedUploadService(NewMemoryUploadStore())
 
 	_, err := service.GetSession("non-existent-id")
 	assert.Error(t, err)
 }
 
 func TestChunkedUploadService_CleanupExpiredSessions(t *testing.T) {
-	service := NewChunkedUploadService()
+	store := NewMemoryUploadStore()
+	service := NewChunkedUploadService(store)
 
 	expiredSession := &ChunkedUploadSession{
-		UploadID:    "expired-upload-id",
+		UploadID:    "6f1c1f5e-0a8e-4c52-9d4a-6b8f1b0b7d21",
 		SecretID:    "test-secret-id",
 		UserID:      "user-1",
 		TotalChunks: 1,
 		TotalSize:   100,
-		Chunks:      make([][]byte, 1),
 		CreatedAt:   time.Now(),
 		ExpiresAt:   time.Now().Add(-1 * time.Minute),
 	}
+	require.NoError(t, store.CreateSession(expiredSession))
 
-	service.mu.Lock()
-	service.sessions[expiredSession.UploadID] = expiredSession
-	service.mu.Unlock()
+	_, err := service.GetSession(expiredSession.UploadID)
+	assert.ErrorIs(t, err, ErrUploadSessionNotFound)
 
-	service.CleanupSession(expiredSession.UploadID)
+	deleted, err := store.DeleteExpiredSessions(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+}
 
-	_, err := service.GetSession(expiredSession.UploadID)
-	assert.Error(t, err)
+func TestChunkedUploadService_ResumeAfterRestart(t *testing.T) {
+	store := NewMemoryUploadStore()
+
+	session, err := NewChunkedUploadService(store).InitUpload("user-1", 3, 18)
+	require.NoError(t, err)
+	err = NewChunkedUploadService(store).UploadChunk(session.UploadID, 1, base64.StdEncoding.EncodeToString([]byte("chunk2")), "")
+	require.NoError(t, err)
+
+	// Новый экземпляр сервиса видит загрузку через общее хранилище
+	restarted := NewChunkedUploadService(store)
+	missing, err := restarted.GetMissingChunks(session.UploadID)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 2}, missing)
+
+	require.NoError(t, restarted.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString([]byte("chunk1")), ""))
+	require.NoError(t, restarted.UploadChunk(session.UploadID, 2, base64.StdEncoding.EncodeToString([]byte("chunk3")), ""))
+
+	data, err := readUpload(restarted, session.UploadID, "")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk1chunk2chunk3"), data)
+}
+
+func TestChunkedUploadService_Checksums(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
+
+	session, err := service.InitUpload("user-1", 2, 12)
+	require.NoError(t, err)
+
+	chunk1 := []byte("chunk1")
+	chunk2 := []byte("chunk2")
+
+	err = service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString(chunk1), blobChecksum(chunk2))
+	assert.ErrorIs(t, err, ErrChunkChecksumMismatch)
+
+	require.NoError(t, service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString(chunk1), strings.ToUpper(blobChecksum(chunk1))))
+	require.NoError(t, service.UploadChunk(session.UploadID, 1, base64.StdEncoding.EncodeToString(chunk2), blobChecksum(chunk2)))
+
+	_, err = readUpload(service, session.UploadID, blobChecksum(chunk1))
+	assert.ErrorIs(t, err, ErrFileChecksumMismatch)
+
+	data, err := readUpload(service, session.UploadID, blobChecksum([]byte("chunk1chunk2")))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk1chunk2"), data)
+}
+
+func TestChunkedUploadService_OpenData_SizeMismatch(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
+
+	session, err := service.InitUpload("user-1", 1, 100)
+	require.NoError(t, err)
+	require.NoError(t, service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString([]byte("short")), ""))
+
+	_, err = readUpload(service, session.UploadID, "")
+	assert.ErrorIs(t, err, ErrFileSizeMismatch)
+}
+
+func TestChunkedUploadService_OpenData_TooLarge(t *testing.T) {
+	store := NewMemoryUploadStore()
+	service := NewChunkedUploadService(store)
+
+	session, err := service.InitUpload("user-1", 2, 8)
+	require.NoError(t, err)
+	require.NoError(t, service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString([]byte("chunk1")), ""))
+	// UploadChunk такую часть не примет, но в хранилище она могла остаться от прежних версий сервера
+	store.chunks[session.UploadID][1] = []byte("chunk2")
+
+	// Лишние байты обнаруживаются до того, как часть попадет в поток
+	r, err := service.OpenData(session.UploadID, "")
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.ErrorIs(t, err, ErrFileSizeMismatch)
+	assert.Equal(t, []byte("chunk1"), data)
+}
+
+func TestChunkedUploadService_UploadChunk_SizeLimits(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
+
+	session, err := service.InitUpload("user-1", 2, 8)
+	require.NoError(t, err)
+
+	err = service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString([]byte("123456789")), "")
+	assert.ErrorIs(t, err, ErrChunkTooLarge)
+
+	require.NoError(t, service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString([]byte("chunk1")), ""))
+	err = service.UploadChunk(session.UploadID, 1, base64.StdEncoding.EncodeToString([]byte("chunk2")), "")
+	assert.ErrorIs(t, err, ErrUploadSizeExceeded)
+
+	// Повторная отправка части заменяет ее и не считается дважды
+	require.NoError(t, service.UploadChunk(session.UploadID, 0, base64.StdEncoding.EncodeToString([]byte("chunk")), ""))
+	require.NoError(t, service.UploadChunk(session.UploadID, 1, base64.StdEncoding.EncodeToString([]byte("123")), ""))
+
+	data, err := readUpload(service, session.UploadID, "")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("chunk123"), data)
+
+	big, err := service.InitUpload("user-1", 1, MaxUploadChunkSize+1)
+	require.NoError(t, err)
+	err = service.UploadChunk(big.UploadID, 0, base64.StdEncoding.EncodeToString(make([]byte, MaxUploadChunkSize+1)), "")
+	assert.ErrorIs(t, err, ErrChunkTooLarge)
+}
+
+func TestChunkedUploadService_StartStop(t *testing.T) {
+	service := NewChunkedUploadService(NewMemoryUploadStore())
+
+	service.Start()
+	service.Stop()
 }
 
 func TestSplitIntoChunks(t *testing.T) {
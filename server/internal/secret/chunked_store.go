@@ -0,0 +1,306 @@
+package secret
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// UploadStore хранит незавершенные загрузки по частям
+type UploadStore interface {
+	CreateSession(session *ChunkedUploadSession) error
+	GetSession(uploadID string) (*ChunkedUploadSession, error)
+	// SaveChunk сохраняет часть или возвращает ErrUploadSizeExceeded, если вместе с остальными
+	// частями она превысит TotalSize сессии
+	SaveChunk(uploadID string, chunkIndex int, data []byte, expiresAt time.Time) error
+	GetReceivedChunks(uploadID string) ([]int, error)
+	// GetChunk возвращает часть с индексом chunkIndex или ErrChunksNotComplete, если ее нет
+	GetChunk(uploadID string, chunkIndex int) ([]byte, error)
+	DeleteSession(uploadID string) error
+	DeleteExpiredSessions(now time.Time) (int64, error)
+}
+
+// DatabaseUploadStore хранит сессии и части файлов в таблицах upload_sessions и upload_chunks
+type DatabaseUploadStore struct {
+	db *sql.DB
+}
+
+func NewDatabaseUploadStore(db *sql.DB) *DatabaseUploadStore {
+	return &DatabaseUploadStore{db: db}
+}
+
+func (s *DatabaseUploadStore) CreateSession(session *ChunkedUploadSession) error {
+	userID, err := strconv.Atoi(session.UserID)
+	if err != nil {
+		return WrapError(err, "некорректный ID пользователя")
+	}
+
+	query := `
+		INSERT INTO upload_sessions (upload_id, secret_id, user_id, total_chunks, total_size, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	_, err = s.db.Exec(query,
+		session.UploadID,
+		session.SecretID,
+		userID,
+		session.TotalChunks,
+		session.TotalSize,
+		session.CreatedAt,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		return WrapError(err, "не удалось создать сессию загрузки")
+	}
+
+	return nil
+}
+
+func (s *DatabaseUploadStore) GetSession(uploadID string) (*ChunkedUploadSession, error) {
+	query := `
+		SELECT upload_id, secret_id, user_id, total_chunks, total_size, created_at, expires_at
+		FROM upload_sessions
+		WHERE upload_id = $1 AND expires_at > NOW()
+	`
+
+	var session ChunkedUploadSession
+	var userID int
+	err := s.db.QueryRow(query, uploadID).Scan(
+		&session.UploadID,
+		&session.SecretID,
+		&userID,
+		&session.TotalChunks,
+		&session.TotalSize,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUploadSessionNotFound
+		}
+		return nil, WrapError(err, "не удалось получить сессию загрузки")
+	}
+
+	session.UserID = strconv.Itoa(userID)
+	return &session, nil
+}
+
+// SaveChunk сохраняет часть файла и продлевает сессию. Повторная отправка части перезаписывает ее.
+// UPDATE блокирует строку сессии, поэтому части одной загрузки сверяются с total_size по очереди.
+func (s *DatabaseUploadStore) SaveChunk(uploadID string, chunkIndex int, data []byte, expiresAt time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	var totalSize int64
+	err = tx.QueryRow(`
+		UPDATE upload_sessions SET expires_at = $2
+		WHERE upload_id = $1 AND expires_at > NOW()
+		RETURNING total_size
+	`, uploadID, expiresAt).Scan(&totalSize)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUploadSessionNotFound
+		}
+		return WrapError(err, "не удалось продлить сессию загрузки")
+	}
+
+	// Прежняя версия этой же части заменяется и не учитывается
+	var storedSize int64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(octet_length(data)), 0) FROM upload_chunks
+		WHERE upload_id = $1 AND chunk_index <> $2
+	`, uploadID, chunkIndex).Scan(&storedSize)
+	if err != nil {
+		return WrapError(err, "не удалось подсчитать размер загруженных частей")
+	}
+	if storedSize+int64(len(data)) > totalSize {
+		return fmt.Errorf("%w: %d of %d bytes", ErrUploadSizeExceeded, storedSize+int64(len(data)), totalSize)
+	}
+
+	query := `
+		INSERT INTO upload_chunks (upload_id, chunk_index, data)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (upload_id, chunk_index) DO UPDATE SET data = EXCLUDED.data
+	`
+	if _, err := tx.Exec(query, uploadID, chunkIndex, data); err != nil {
+		return WrapError(err, "не удалось сохранить часть файла")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return nil
+}
+
+func (s *DatabaseUploadStore) GetReceivedChunks(uploadID string) ([]int, error) {
+	rows, err := s.db.Query(`SELECT chunk_index FROM upload_chunks WHERE upload_id = $1 ORDER BY chunk_index`, uploadID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить список частей")
+	}
+	defer rows.Close()
+
+	received := []int{}
+	for rows.Next() {
+		var index int
+		if err := rows.Scan(&index); err != nil {
+			return nil, WrapError(err, "не удалось прочитать индекс части")
+		}
+		received = append(received, index)
+	}
+
+	return received, rows.Err()
+}
+
+func (s *DatabaseUploadStore) GetChunk(uploadID string, chunkIndex int) ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM upload_chunks WHERE upload_id = $1 AND chunk_index = $2`, uploadID, chunkIndex).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: chunk %d is missing", ErrChunksNotComplete, chunkIndex)
+		}
+		return nil, WrapError(err, "не удалось получить часть файла")
+	}
+
+	return data, nil
+}
+
+func (s *DatabaseUploadStore) DeleteSession(uploadID string) error {
+	if _, err := s.db.Exec(`DELETE FROM upload_sessions WHERE upload_id = $1`, uploadID); err != nil {
+		return WrapError(err, "не удалось удалить сессию загрузки")
+	}
+	return nil
+}
+
+func (s *DatabaseUploadStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := s.db.Exec(`DELETE FROM upload_sessions WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить истекшие сессии загрузки")
+	}
+	return result.RowsAffected()
+}
+
+// MemoryUploadStore хранит загрузки в памяти процесса. Подходит для тестов и запуска без базы.
+type MemoryUploadStore struct {
+	sessions map[string]*ChunkedUploadSession
+	chunks   map[string]map[int][]byte
+	mu       sync.RWMutex
+}
+
+func NewMemoryUploadStore() *MemoryUploadStore {
+	return &MemoryUploadStore{
+		sessions: make(map[string]*ChunkedUploadSession),
+		chunks:   make(map[string]map[int][]byte),
+	}
+}
+
+func (s *MemoryUploadStore) CreateSession(session *ChunkedUploadSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *session
+	s.sessions[session.UploadID] = &stored
+	s.chunks[session.UploadID] = make(map[int][]byte)
+	return nil
+}
+
+func (s *MemoryUploadStore) GetSession(uploadID string) (*ChunkedUploadSession, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[uploadID]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	result := *session
+	return &result, nil
+}
+
+func (s *MemoryUploadStore) SaveChunk(uploadID string, chunkIndex int, data []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[uploadID]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return ErrUploadSessionNotFound
+	}
+
+	storedSize := int64(len(data))
+	for index, chunk := range s.chunks[uploadID] {
+		if index != chunkIndex {
+			storedSize += int64(len(chunk))
+		}
+	}
+	if storedSize > session.TotalSize {
+		return fmt.Errorf("%w: %d of %d bytes", ErrUploadSizeExceeded, storedSize, session.TotalSize)
+	}
+
+	session.ExpiresAt = expiresAt
+	s.chunks[uploadID][chunkIndex] = data
+	return nil
+}
+
+func (s *MemoryUploadStore) GetReceivedChunks(uploadID string) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[uploadID]
+	if !ok {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	received := []int{}
+	for i := 0; i < session.TotalChunks; i++ {
+		if _, ok := s.chunks[uploadID][i]; ok {
+			received = append(received, i)
+		}
+	}
+	return received, nil
+}
+
+func (s *MemoryUploadStore) GetChunk(uploadID string, chunkIndex int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.chunks[uploadID]
+	if !ok {
+		return nil, ErrUploadSessionNotFound
+	}
+
+	data, ok := stored[chunkIndex]
+	if !ok {
+		return nil, fmt.Errorf("%w: chunk %d is missing", ErrChunksNotComplete, chunkIndex)
+	}
+	return data, nil
+}
+
+func (s *MemoryUploadStore) DeleteSession(uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, uploadID)
+	delete(s.chunks, uploadID)
+	return nil
+}
+
+func (s *MemoryUploadStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, id)
+			delete(s.chunks, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
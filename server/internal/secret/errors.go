@@ -6,14 +6,55 @@ import (
 )
 
 var (
-	ErrSecretNotFound  = errors.New("secret.not_found")
-	ErrVersionConflict = errors.New("secret.version_conflict")
+	ErrSecretNotFound      = errors.New("secret.not_found")
+	ErrSecretAlreadyExists = errors.New("secret.already_exists")
+	ErrVersionConflict     = errors.New("secret.version_conflict")
+	ErrVersionNotFound     = errors.New("secret.version_not_found")
+	ErrInvalidCursor       = errors.New("secret.invalid_cursor")
+	ErrPreconditionFailed  = errors.New("secret.precondition_failed")
+	ErrFolderNotFound      = errors.New("secret.folder_not_found")
+	ErrForbidden           = errors.New("secret.forbidden")
+)
+
+var (
+	ErrShareNotFound     = errors.New("secret.share_not_found")
+	ErrGranteeNotFound   = errors.New("secret.grantee_not_found")
+	ErrShareWithSelf     = errors.New("secret.share_with_self")
+	ErrEmailRequired     = errors.New("secret.email_required")
+	ErrInvalidPermission = errors.New("secret.invalid_permission")
+	ErrWrappedKeyInvalid = errors.New("secret.wrapped_key_invalid")
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("secret.session_not_found")
+	ErrChunkIndexInvalid     = errors.New("secret.chunk_index_invalid")
+	ErrChunksNotComplete     = errors.New("secret.chunks_not_complete")
+	ErrChunkChecksumMismatch = errors.New("secret.chunk_checksum_mismatch")
+	ErrFileSizeMismatch      = errors.New("secret.file_size_mismatch")
+	ErrFileChecksumMismatch  = errors.New("secret.file_checksum_mismatch")
+	ErrInvalidUploadSize     = errors.New("secret.invalid_upload_size")
+	ErrChunkTooLarge         = errors.New("secret.chunk_too_large")
+	ErrUploadSizeExceeded    = errors.New("secret.upload_size_exceeded")
 )
 
 var (
 	ErrRequestRequired  = errors.New("secret.request_required")
+	ErrInvalidID        = errors.New("secret.invalid_id")
 	ErrLoginRequired    = errors.New("secret.login_required")
 	ErrPasswordRequired = errors.New("secret.password_required")
+	ErrInvalidType      = errors.New("secret.invalid_type")
+	ErrTextRequired     = errors.New("secret.text_required")
+	ErrCardRequired     = errors.New("secret.card_required")
+	ErrFileRequired     = errors.New("secret.file_required")
+	ErrUnexpectedFields = errors.New("secret.unexpected_fields")
+	ErrInvalidPatch     = errors.New("secret.invalid_patch")
+	ErrInvalidFolderID  = errors.New("secret.invalid_folder_id")
+)
+
+var (
+	ErrSecretIDRequired      = errors.New("secret.id_required")
+	ErrInvalidPushAction     = errors.New("secret.invalid_push_action")
+	ErrTooManyPushOperations = errors.New("secret.push_too_large")
 )
 
 func WrapError(err error, message string) error {
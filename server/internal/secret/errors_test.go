@@ -85,6 +85,16 @@ func TestErrorVariables(t *testing.T) {
 			err:      ErrPasswordRequired,
 			expected: "secret.password_required",
 		},
+		{
+			name:     "ErrInvalidType",
+			err:      ErrInvalidType,
+			expected: "secret.invalid_type",
+		},
+		{
+			name:     "ErrUnexpectedFields",
+			err:      ErrUnexpectedFields,
+			expected: "secret.unexpected_fields",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,73 @@
+package secret
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// secretETag - ETag секрета. Любое изменение секрета увеличивает версию, поэтому пары
+// id и версии достаточно, чтобы различать его состояния.
+func secretETag(id string, version int) string {
+	return `"` + id + "-" + strconv.Itoa(version) + `"`
+}
+
+// blobETag - ETag бинарных данных. Данные не меняются без смены контрольной суммы,
+// поэтому If-Range по нему не склеит части разных файлов.
+func blobETag(checksum string) string {
+	return `"` + checksum + `"`
+}
+
+// parseSecretETag возвращает версию из ETag секрета id. false - ETag не от этого секрета
+// или слабый: If-Match требует строгого сравнения.
+func parseSecretETag(etag, id string) (int, bool) {
+	value, ok := strings.CutPrefix(etag, `"`+id+"-")
+	if !ok {
+		return 0, false
+	}
+	value, ok = strings.CutSuffix(value, `"`)
+	if !ok {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// collectionETag - ETag списка секретов. Номер последнего изменения растет при любом
+// изменении секретов пользователя, parts отличают разные запросы (путь, параметры).
+func collectionETag(changeSeq int64, parts ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(strconv.FormatInt(changeSeq, 10)))
+	for _, part := range parts {
+		hash.Write([]byte{0})
+		hash.Write([]byte(part))
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// parseETags разбирает заголовок If-Match / If-None-Match: список ETag через запятую или *
+func parseETags(header string) []string {
+	var etags []string
+	for _, etag := range strings.Split(header, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+// noneMatch проверяет If-None-Match: true - у клиента уже есть актуальная копия.
+// Сравнение слабое, префикс W/ не учитывается.
+func noneMatch(header, etag string) bool {
+	for _, candidate := range parseETags(header) {
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecretETag(t *testing.T) {
+	tests := []struct {
+		name    string
+		etag    string
+		version int
+		ok      bool
+	}{
+		{name: "strong", etag: secretETag("abc", 3), version: 3, ok: true},
+		{name: "weak", etag: "W/" + secretETag("abc", 3)},
+		{name: "other secret", etag: secretETag("abd", 3)},
+		{name: "unquoted", etag: "abc-3"},
+		{name: "bad version", etag: `"abc-x"`},
+		{name: "zero version", etag: `"abc-0"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, ok := parseSecretETag(tt.etag, "abc")
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.version, version)
+		})
+	}
+}
+
+func TestNoneMatch(t *testing.T) {
+	etag := secretETag("abc", 2)
+
+	assert.True(t, noneMatch(etag, etag))
+	assert.True(t, noneMatch(`"x", `+etag, etag))
+	assert.True(t, noneMatch("W/"+etag, etag))
+	assert.True(t, noneMatch("*", etag))
+	assert.False(t, noneMatch("", etag))
+	assert.False(t, noneMatch(secretETag("abc", 1), etag))
+}
+
+func TestCollectionETag(t *testing.T) {
+	assert.Equal(t, collectionETag(5, "/secrets", ""), collectionETag(5, "/secrets", ""))
+	assert.NotEqual(t, collectionETag(5, "/secrets", ""), collectionETag(6, "/secrets", ""))
+	assert.NotEqual(t, collectionETag(5, "/secrets", ""), collectionETag(5, "/secrets", "type=login"))
+	assert.NotEqual(t, collectionETag(5, "/secrets", "a"), collectionETag(5, "/secretsa", ""))
+}
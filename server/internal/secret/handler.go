@@ -5,22 +5,44 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
+	"strings"
 
+	"github.com/Adigezalov/goph-keeper/internal/folder"
 	"github.com/Adigezalov/goph-keeper/internal/localization"
 	"github.com/Adigezalov/goph-keeper/internal/logger"
 	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
 	"github.com/gorilla/mux"
 )
 
 type SecretService interface {
 	CreateSecret(userID int, req *CreateSecretRequest, excludeSessionID string) (*Secret, error)
 	GetSecret(id string, userID int) (*Secret, error)
-	GetAllSecrets(userID int) ([]*Secret, error)
+	ListSecrets(userID int, query *ListSecretsQuery) (*SecretListResponse, error)
+	GetChangeSeq(userID int) (int64, error)
 	UpdateSecret(id string, userID int, req *UpdateSecretRequest, excludeSessionID string) (*Secret, error)
-	DeleteSecret(id string, userID int, excludeSessionID string) error
-	GetSecretsForSync(userID int, since *time.Time) (*SyncResponse, error)
+	PatchSecret(id string, userID int, req *PatchSecretRequest, excludeSessionID string) (*Secret, error)
+	DeleteSecret(id string, userID int, version int, excludeSessionID string) error
+	GetTrash(userID int) ([]*Secret, error)
+	RestoreSecret(id string, userID int, excludeSessionID string) (*Secret, error)
+	PurgeSecret(id string, userID int, version int, excludeSessionID string) error
+	RecordDeviceSync(userID int, deviceID string, cursor string)
+	GetBlobInfo(id string, userID int) (*BlobInfo, error)
+	ReadBlob(info *BlobInfo, offset, length int64) ([]byte, error)
+	UploadBlob(id string, userID int, version int, r io.Reader, excludeSessionID string) (*BlobInfo, error)
+	GetSecretsForSync(userID int, cursor string, limit int) (*SyncResponse, error)
+	PushChanges(userID int, req *PushRequest, excludeSessionID string) ([]*PushResult, error)
+	GetSecretVersions(id string, userID int) ([]*SecretVersion, error)
+	GetSecretVersion(id string, userID int, version int) (*SecretVersion, error)
+	RestoreSecretVersion(id string, userID int, version int, req *RestoreVersionRequest, excludeSessionID string) (*Secret, error)
+	ShareSecret(id string, userID int, req *ShareSecretRequest, excludeSessionID string) (*SecretShare, error)
+	ListShares(id string, userID int) ([]*SecretShare, error)
+	RevokeShare(id string, userID int, granteeID int, excludeSessionID string) error
 }
 
 type Handler struct {
@@ -28,10 +50,10 @@ type Handler struct {
 	chunkedService *ChunkedUploadService
 }
 
-func NewHandler(service SecretService) *Handler {
+func NewHandler(service SecretService, chunkedService *ChunkedUploadService) *Handler {
 	return &Handler{
 		service:        service,
-		chunkedService: NewChunkedUploadService(),
+		chunkedService: chunkedService,
 	}
 }
 
@@ -43,9 +65,12 @@ func NewHandler(service SecretService) *Handler {
 // @Accept json
 // @Produce json
 // @Param request body CreateSecretRequest true "Данные секрета"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
 // @Success 201 {object} SecretResponse
 // @Failure 400 {object} map[string]string "Ошибка валидации"
 // @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Папка не найдена"
+// @Failure 409 {object} map[string]string "Секрет с таким ID уже существует"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /secrets [post]
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
@@ -70,10 +95,14 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	secret, err := h.service.CreateSecret(userID, &req, excludeSessionID)
 	if err != nil {
 		switch {
-		case errors.Is(err, ErrLoginRequired),
-			errors.Is(err, ErrPasswordRequired),
-			errors.Is(err, ErrRequestRequired):
-			localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+		case isValidationError(err):
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
+			return
+		case errors.Is(err, ErrSecretAlreadyExists):
+			localization.LocalizedError(w, r, http.StatusConflict, "secret.already_exists", nil)
+			return
+		case errors.Is(err, ErrFolderNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.folder_not_found", nil)
 			return
 		default:
 			logger.Log.WithFields(map[string]interface{}{
@@ -86,6 +115,7 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", secretETag(secret.ID, secret.Version))
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(secret.ToResponse()); err != nil {
 		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
@@ -99,7 +129,9 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 // @Security BearerAuth
 // @Produce json
 // @Param id path string true "ID секрета"
+// @Param If-None-Match header string false "ETag копии, которая уже есть у клиента"
 // @Success 200 {object} SecretResponse
+// @Success 304 "Секрет не изменился"
 // @Failure 400 {object} map[string]string "Неверный ID"
 // @Failure 401 {object} map[string]string "Ошибка авторизации"
 // @Failure 404 {object} map[string]string "Секрет не найден"
@@ -136,6 +168,13 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	etag := secretETag(secret.ID, secret.Version)
+	w.Header().Set("ETag", etag)
+	if noneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(secret.ToResponse()); err != nil {
@@ -144,12 +183,23 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetAll godoc
-// @Summary Получить все секреты
-// @Description Получает список всех секретов пользователя
+// @Summary Получить список секретов
+// @Description Постранично отдает активные секреты пользователя без бинарных данных (только размер и контрольная сумма)
 // @Tags secrets
 // @Security BearerAuth
 // @Produce json
-// @Success 200 {array} SecretResponse
+// @Param type query string false "Тип секрета: login, text, card, file"
+// @Param sort query string false "Сортировка: created (по умолчанию), updated, login"
+// @Param order query string false "Порядок: asc или desc (по умолчанию desc для дат, asc для login)"
+// @Param limit query int false "Размер страницы (по умолчанию 100, не больше 1000)"
+// @Param cursor query string false "next_cursor из предыдущего ответа"
+// @Param has_metadata query string false "Ключ, который должен быть в metadata (можно повторять)"
+// @Param tag query string false "Название метки (можно повторять)"
+// @Param tag_match query string false "any (по умолчанию) - любая из меток, all - все"
+// @Param If-None-Match header string false "ETag списка, который уже есть у клиента"
+// @Success 200 {object} SecretListResponse
+// @Success 304 "Список не изменился"
+// @Failure 400 {object} map[string]string "Неверные параметры или курсор"
 // @Failure 401 {object} map[string]string "Ошибка авторизации"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /secrets [get]
@@ -160,19 +210,31 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secrets, err := h.service.GetAllSecrets(userID)
-	if err != nil {
-		logger.Log.WithFields(map[string]interface{}{
-			"user_id": userID,
-			"error":   err.Error(),
-		}).Error("[Secret] Ошибка получения секретов")
-		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	query, messageID := parseListQuery(r.URL.Query())
+	if messageID != "" {
+		localization.LocalizedError(w, r, http.StatusBadRequest, messageID, nil)
 		return
 	}
 
-	response := make([]SecretResponse, 0, len(secrets))
-	for _, secret := range secrets {
-		response = append(response, secret.ToResponse())
+	if h.notModified(w, r, userID) {
+		return
+	}
+
+	response, err := h.service.ListSecrets(userID, query)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCursor):
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_list_cursor", nil)
+		case errors.Is(err, ErrInvalidType):
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_type", nil)
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Secret] Ошибка получения секретов")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		}
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -184,18 +246,21 @@ func (h *Handler) GetAll(w http.ResponseWriter, r *http.Request) {
 
 // Update godoc
 // @Summary Обновить секрет
-// @Description Обновляет существующий секрет
+// @Description Обновляет существующий секрет. С merge=true изменение от устаревшей версии сливается с изменениями других устройств
 // @Tags secrets
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Param id path string true "ID секрета"
 // @Param request body UpdateSecretRequest true "Данные для обновления"
+// @Param If-Match header string false "ETag изменяемой версии, заменяет version из тела"
 // @Success 200 {object} SecretResponse
 // @Failure 400 {object} map[string]string "Ошибка валидации"
 // @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Доступ к чужому секрету только на чтение"
 // @Failure 404 {object} map[string]string "Секрет не найден"
-// @Failure 409 {object} map[string]string "Конфликт версий"
+// @Failure 409 {object} MergeConflictResponse "Конфликт версий (при merge=true - список конфликтующих полей)"
+// @Failure 412 {object} map[string]string "ETag из If-Match устарел"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /secrets/{id} [put]
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
@@ -224,19 +289,38 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// If-Match заменяет version из тела запроса
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" {
+		version, err := h.ifMatchVersion(id, userID, ifMatch)
+		if err != nil {
+			h.writeIfMatchError(w, r, userID, id, err)
+			return
+		}
+		req.Version = version
+	}
+
 	secret, err := h.service.UpdateSecret(id, userID, &req, excludeSessionID)
 	if err != nil {
+		var mergeErr *MergeConflictError
 		switch {
+		case errors.As(err, &mergeErr):
+			writeMergeConflict(w, r, mergeErr)
+			return
 		case errors.Is(err, ErrSecretNotFound):
 			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
 			return
+		case errors.Is(err, ErrForbidden):
+			localization.LocalizedError(w, r, http.StatusForbidden, "secret.forbidden", nil)
+			return
+		case errors.Is(err, ErrVersionConflict) && ifMatch != "":
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "secret.precondition_failed", nil)
+			return
 		case errors.Is(err, ErrVersionConflict):
 			localization.LocalizedError(w, r, http.StatusConflict, "secret.version_conflict_detailed", nil)
 			return
-		case errors.Is(err, ErrLoginRequired),
-			errors.Is(err, ErrPasswordRequired),
-			errors.Is(err, ErrRequestRequired):
-			localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+		case isValidationError(err):
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
 			return
 		default:
 			logger.Log.WithFields(map[string]interface{}{
@@ -250,6 +334,108 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", secretETag(secret.ID, secret.Version))
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(secret.ToResponse()); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// Patch godoc
+// @Summary Частично обновить секрет
+// @Description Применяет JSON Merge Patch (RFC 7396) к login, password, text, card, metadata и binary_data. Бинарные данные меняются, только если binary_data есть в патче
+// @Tags secrets
+// @Security BearerAuth
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Param request body object true "Патч; поле version - версия, от которой сделано изменение"
+// @Param If-Match header string false "ETag изменяемой версии, заменяет version из патча"
+// @Success 200 {object} SecretResponse
+// @Failure 400 {object} map[string]string "Некорректный патч или ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Доступ к чужому секрету только на чтение"
+// @Failure 404 {object} map[string]string "Секрет не найден"
+// @Failure 409 {object} map[string]string "Конфликт версий"
+// @Failure 412 {object} map[string]string "ETag из If-Match устарел"
+// @Failure 415 {object} map[string]string "Неподдерживаемый Content-Type"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id} [patch]
+func (h *Handler) Patch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.id_required", nil)
+		return
+	}
+
+	// application/json тоже принимается: многие клиенты не умеют задавать свой тип
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != MergePatchContentType && mediaType != "application/json") {
+			localization.LocalizedError(w, r, http.StatusUnsupportedMediaType, "secret.unsupported_patch_type", nil)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	req, err := parsePatchRequest(body)
+	if err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_patch", nil)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" {
+		version, err := h.ifMatchVersion(id, userID, ifMatch)
+		if err != nil {
+			h.writeIfMatchError(w, r, userID, id, err)
+			return
+		}
+		req.Version = version
+	}
+
+	secret, err := h.service.PatchSecret(id, userID, req, excludeSessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSecretNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+		case errors.Is(err, ErrForbidden):
+			localization.LocalizedError(w, r, http.StatusForbidden, "secret.forbidden", nil)
+		case errors.Is(err, ErrVersionConflict) && ifMatch != "":
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "secret.precondition_failed", nil)
+		case errors.Is(err, ErrVersionConflict):
+			localization.LocalizedError(w, r, http.StatusConflict, "secret.version_conflict_detailed", nil)
+		case isValidationError(err):
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка частичного обновления секрета")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", secretETag(secret.ID, secret.Version))
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(secret.ToResponse()); err != nil {
 		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
@@ -258,14 +444,18 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
 
 // Delete godoc
 // @Summary Удалить секрет
-// @Description Удаляет секрет (мягкое удаление)
+// @Description Перемещает секрет в корзину. С permanent=true стирает его окончательно
 // @Tags secrets
 // @Security BearerAuth
 // @Param id path string true "ID секрета"
+// @Param permanent query bool false "Удалить окончательно, минуя корзину"
+// @Param If-Match header string false "ETag удаляемой версии"
 // @Success 204 "Секрет успешно удален"
 // @Failure 400 {object} map[string]string "Неверный ID"
 // @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Чужой секрет удаляет только владелец"
 // @Failure 404 {object} map[string]string "Секрет не найден"
+// @Failure 412 {object} map[string]string "ETag из If-Match устарел"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /secrets/{id} [delete]
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -287,12 +477,32 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.service.DeleteSecret(id, userID, excludeSessionID)
+	version := 0
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		var err error
+		if version, err = h.ifMatchVersion(id, userID, ifMatch); err != nil {
+			h.writeIfMatchError(w, r, userID, id, err)
+			return
+		}
+	}
+
+	var err error
+	if r.URL.Query().Get("permanent") == "true" {
+		err = h.service.PurgeSecret(id, userID, version, excludeSessionID)
+	} else {
+		err = h.service.DeleteSecret(id, userID, version, excludeSessionID)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrSecretNotFound):
 			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
 			return
+		case errors.Is(err, ErrForbidden):
+			localization.LocalizedError(w, r, http.StatusForbidden, "secret.forbidden", nil)
+			return
+		case errors.Is(err, ErrVersionConflict):
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "secret.precondition_failed", nil)
+			return
 		default:
 			logger.Log.WithFields(map[string]interface{}{
 				"user_id":   userID,
@@ -309,13 +519,16 @@ func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
 
 // Sync godoc
 // @Summary Синхронизация секретов
-// @Description Получает секреты измененные после указанной даты
+// @Description Получает страницу изменений секретов, папок и меток после курсора. Без курсора - с начала.
 // @Tags secrets
 // @Security BearerAuth
 // @Produce json
-// @Param since query string false "Дата в формате RFC3339"
-// @Success 200 {object} map[string]interface{} "Список секретов и время сервера"
-// @Failure 400 {object} map[string]string "Неверный формат даты"
+// @Param cursor query string false "Курсор из next_cursor предыдущего ответа"
+// @Param limit query int false "Размер страницы (по умолчанию 500, не больше 1000)"
+// @Param If-None-Match header string false "ETag ответа на тот же запрос"
+// @Success 200 {object} map[string]interface{} "Измененные секреты, папки и метки, курсор и признак продолжения"
+// @Success 304 "Изменений после курсора не появилось"
+// @Failure 400 {object} map[string]string "Неверный курсор или размер страницы"
 // @Failure 401 {object} map[string]string "Ошибка авторизации"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /secrets/sync [get]
@@ -326,19 +539,31 @@ func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var since *time.Time
-	sinceStr := r.URL.Query().Get("since")
-	if sinceStr != "" {
-		parsedTime, err := time.Parse(time.RFC3339, sinceStr)
-		if err != nil {
-			localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_since_format", nil)
+	cursor := r.URL.Query().Get("cursor")
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_sync_limit", nil)
 			return
 		}
-		since = &parsedTime
+		limit = parsed
+	}
+
+	if h.notModified(w, r, userID) {
+		if deviceID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+			h.service.RecordDeviceSync(userID, deviceID, cursor)
+		}
+		return
 	}
 
-	response, err := h.service.GetSecretsForSync(userID, since)
+	response, err := h.service.GetSecretsForSync(userID, cursor, limit)
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_cursor", nil)
+			return
+		}
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id": userID,
 			"error":   err.Error(),
@@ -347,17 +572,37 @@ func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if deviceID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		h.service.RecordDeviceSync(userID, deviceID, cursor)
+	}
+
 	secretResponses := make([]SecretResponse, 0, len(response.Secrets))
 	for _, secret := range response.Secrets {
 		secretResponses = append(secretResponses, secret.ToResponseForSync())
 	}
 
+	folderResponses := make([]folder.FolderResponse, 0, len(response.Folders))
+	for _, f := range response.Folders {
+		folderResponses = append(folderResponses, f.ToResponse())
+	}
+
+	tagResponses := make([]tag.TagResponse, 0, len(response.Tags))
+	for _, t := range response.Tags {
+		tagResponses = append(tagResponses, t.ToResponse())
+	}
+
 	syncResponse := struct {
-		Secrets    []SecretResponse `json:"secrets"`
-		ServerTime string           `json:"server_time"`
+		Secrets    []SecretResponse        `json:"secrets"`
+		Folders    []folder.FolderResponse `json:"folders"`
+		Tags       []tag.TagResponse       `json:"tags"`
+		NextCursor string                  `json:"next_cursor"`
+		HasMore    bool                    `json:"has_more"`
 	}{
 		Secrets:    secretResponses,
-		ServerTime: response.ServerTime.Format(time.RFC3339),
+		Folders:    folderResponses,
+		Tags:       tagResponses,
+		NextCursor: response.NextCursor,
+		HasMore:    response.HasMore,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -367,110 +612,408 @@ func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *Handler) InitChunkedUpload(w http.ResponseWriter, r *http.Request) {
+// Push godoc
+// @Summary Отправка пакета офлайн-изменений
+// @Description Применяет создания, обновления и удаления секретов в одной транзакции и возвращает итог каждой операции
+// @Tags secrets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body PushRequest true "Операции в порядке применения"
+// @Success 200 {object} PushResponse
+// @Failure 400 {object} map[string]string "Неверный формат запроса или слишком большой пакет"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/sync/push [post]
+func (h *Handler) Push(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
 		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
 		return
 	}
 
-	var req InitChunkedUploadRequest
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
+	var req PushRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
 		return
 	}
 
-	session, err := h.chunkedService.InitUpload(fmt.Sprintf("%d", userID), req.TotalChunks, req.TotalSize)
+	results, err := h.service.PushChanges(userID, &req, excludeSessionID)
 	if err != nil {
-		logger.Log.WithFields(map[string]interface{}{
-			"user_id": userID,
-			"error":   err.Error(),
-		}).Error("[Secret] Ошибка инициализации chunked upload")
-		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
-		return
+		switch {
+		case errors.Is(err, ErrTooManyPushOperations):
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.push_too_large",
+				map[string]interface{}{"Max": MaxPushOperations})
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Secret] Ошибка применения пакета изменений")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
 	}
 
-	response := InitChunkedUploadResponse{
-		UploadID: session.UploadID,
-		SecretID: session.SecretID,
+	lang := localization.GetLanguageFromContext(r.Context())
+	response := PushResponse{Results: make([]PushResultResponse, 0, len(results))}
+	for _, result := range results {
+		item := PushResultResponse{ClientID: result.ClientID, Status: result.Status}
+		if result.Secret != nil {
+			secretResponse := result.Secret.ToResponseForSync()
+			item.Secret = &secretResponse
+		}
+		if result.Err != nil {
+			item.Error = localization.Translate(lang, result.Err.Error(), nil)
+		}
+		response.Results = append(response.Results, item)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
 }
 
-func (h *Handler) UploadChunk(w http.ResponseWriter, r *http.Request) {
+// ListVersions godoc
+// @Summary История версий секрета
+// @Description Возвращает список сохраненных версий секрета без их содержимого
+// @Tags secrets
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Success 200 {array} SecretVersionSummary
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Секрет не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/versions [get]
+func (h *Handler) ListVersions(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
 		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
 		return
 	}
 
-	vars := mux.Vars(r)
-	secretID := vars["id"]
+	id := mux.Vars(r)["id"]
 
-	var req UploadChunkRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
-		return
+	versions, err := h.service.GetSecretVersions(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSecretNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения истории версий")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
 	}
 
-	session, err := h.chunkedService.GetSession(req.UploadID)
-	if err != nil {
-		localization.LocalizedError(w, r, http.StatusNotFound, "secret.session_not_found", nil)
-		return
+	response := make([]SecretVersionSummary, 0, len(versions))
+	for _, version := range versions {
+		response = append(response, version.ToSummary())
 	}
 
-	if session.UserID != fmt.Sprintf("%d", userID) {
-		localization.LocalizedError(w, r, http.StatusForbidden, "secret.access_denied", nil)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
 	}
+}
 
-	if session.SecretID != secretID {
-		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_secret_id", nil)
+// GetVersion godoc
+// @Summary Получить версию секрета
+// @Description Возвращает содержимое секрета в указанной версии
+// @Tags secrets
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Param version path int true "Номер версии"
+// @Success 200 {object} SecretResponse
+// @Failure 400 {object} map[string]string "Неверный номер версии"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Версия не найдена"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/versions/{version} [get]
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
 		return
 	}
 
-	if err := h.chunkedService.UploadChunk(req.UploadID, req.ChunkIndex, req.Data); err != nil {
-		logger.Log.WithFields(map[string]interface{}{
-			"user_id":   userID,
-			"secret_id": vars["id"],
-			"error":     err.Error(),
-		}).Error("[Secret] Ошибка загрузки чанка")
-		localization.LocalizedError(w, r, http.StatusInternalServerError, "secret.chunk_upload_error", nil)
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.version_invalid", nil)
 		return
 	}
 
-	response := UploadChunkResponse{
-		ChunkIndex: req.ChunkIndex,
-		Received:   true,
+	snapshot, err := h.service.GetSecretVersion(vars["id"], userID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrVersionNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.version_not_found", nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": vars["id"],
+				"version":   version,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения версии секрета")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	if err := json.NewEncoder(w).Encode(snapshot.ToResponse()); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
 }
 
-func (h *Handler) FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request) {
+// RestoreVersion godoc
+// @Summary Восстановить версию секрета
+// @Description Сохраняет содержимое указанной версии как новую версию секрета. В теле передается текущая версия секрета для проверки конфликтов
+// @Tags secrets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Param version path int true "Номер восстанавливаемой версии"
+// @Param request body RestoreVersionRequest true "Текущая версия секрета"
+// @Success 200 {object} SecretResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Доступ к чужому секрету только на чтение"
+// @Failure 404 {object} map[string]string "Версия не найдена"
+// @Failure 409 {object} map[string]string "Конфликт версий"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/versions/{version}/restore [post]
+func (h *Handler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
 		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
 		return
 	}
 
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
 	vars := mux.Vars(r)
-	secretID := vars["id"]
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil || version < 1 {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.version_invalid", nil)
+		return
+	}
 
-	var req FinalizeChunkedUploadRequest
+	var req RestoreVersionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
 		return
 	}
 
-	session, err := h.chunkedService.GetSession(req.UploadID)
+	secret, err := h.service.RestoreSecretVersion(vars["id"], userID, version, &req, excludeSessionID)
 	if err != nil {
-		localization.LocalizedError(w, r, http.StatusNotFound, "secret.session_not_found_simple", nil)
+		switch {
+		case errors.Is(err, ErrSecretNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+			return
+		case errors.Is(err, ErrVersionNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.version_not_found", nil)
+			return
+		case errors.Is(err, ErrForbidden):
+			localization.LocalizedError(w, r, http.StatusForbidden, "secret.forbidden", nil)
+			return
+		case errors.Is(err, ErrVersionConflict):
+			localization.LocalizedError(w, r, http.StatusConflict, "secret.version_conflict_detailed", nil)
+			return
+		case isValidationError(err):
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": vars["id"],
+				"version":   version,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка восстановления версии секрета")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(secret.ToResponse()); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// Trash godoc
+// @Summary Корзина
+// @Description Возвращает удаленные секреты, которые еще можно восстановить
+// @Tags secrets
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} SecretResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/trash [get]
+func (h *Handler) Trash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	secrets, err := h.service.GetTrash(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Secret] Ошибка получения корзины")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	response := make([]SecretResponse, 0, len(secrets))
+	for _, secret := range secrets {
+		response = append(response, secret.ToResponseForSync())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// Restore godoc
+// @Summary Восстановить секрет из корзины
+// @Description Возвращает удаленный секрет и увеличивает его версию
+// @Tags secrets
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Success 200 {object} SecretResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Секрет не найден в корзине"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/restore [post]
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
+	id := mux.Vars(r)["id"]
+
+	secret, err := h.service.RestoreSecret(id, userID, excludeSessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrSecretNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_in_trash", nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка восстановления секрета")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(secret.ToResponse()); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+func (h *Handler) InitChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req InitChunkedUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	session, err := h.chunkedService.InitUpload(fmt.Sprintf("%d", userID), req.TotalChunks, req.TotalSize)
+	if err != nil {
+		if errors.Is(err, ErrInvalidUploadSize) {
+			localization.LocalizedError(w, r, http.StatusBadRequest, ErrInvalidUploadSize.Error(), nil)
+			return
+		}
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Secret] Ошибка инициализации chunked upload")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	response := InitChunkedUploadResponse{
+		UploadID: session.UploadID,
+		SecretID: session.SecretID,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) UploadChunk(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	vars := mux.Vars(r)
+	secretID := vars["id"]
+
+	var req UploadChunkRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxChunkRequestSize)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			localization.LocalizedError(w, r, http.StatusRequestEntityTooLarge, ErrChunkTooLarge.Error(), nil)
+			return
+		}
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	session, err := h.chunkedService.GetSession(req.UploadID)
+	if err != nil {
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.session_not_found", nil)
 		return
 	}
 
@@ -484,14 +1027,88 @@ func (h *Handler) FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	binaryData, err := h.chunkedService.GetCompleteData(req.UploadID)
+	if err := h.chunkedService.UploadChunk(req.UploadID, req.ChunkIndex, req.Data, req.Checksum); err != nil {
+		switch {
+		case errors.Is(err, ErrUploadSessionNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.session_not_found", nil)
+			return
+		case errors.Is(err, ErrChunkIndexInvalid):
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.chunk_index_invalid", nil)
+			return
+		case errors.Is(err, ErrChunkChecksumMismatch):
+			localization.LocalizedError(w, r, http.StatusBadRequest, "secret.chunk_checksum_mismatch", nil)
+			return
+		case errors.Is(err, ErrChunkTooLarge):
+			localization.LocalizedError(w, r, http.StatusRequestEntityTooLarge, ErrChunkTooLarge.Error(), nil)
+			return
+		case errors.Is(err, ErrUploadSizeExceeded):
+			localization.LocalizedError(w, r, http.StatusBadRequest, ErrUploadSizeExceeded.Error(), nil)
+			return
+		}
+
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": vars["id"],
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка загрузки чанка")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "secret.chunk_upload_error", nil)
+		return
+	}
+
+	response := UploadChunkResponse{
+		ChunkIndex: req.ChunkIndex,
+		Received:   true,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	vars := mux.Vars(r)
+	secretID := vars["id"]
+
+	var req FinalizeChunkedUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	session, err := h.chunkedService.GetSession(req.UploadID)
+	if err != nil {
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.session_not_found_simple", nil)
+		return
+	}
+
+	if session.UserID != fmt.Sprintf("%d", userID) {
+		localization.LocalizedError(w, r, http.StatusForbidden, "secret.access_denied", nil)
+		return
+	}
+
+	if session.SecretID != secretID {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_secret_id", nil)
+		return
+	}
+
+	// Части читаются потоком прямо в BlobStore. При несовпадении размера или суммы
+	// сессия сохраняется: клиент может перезагрузить части.
+	binaryData, err := h.chunkedService.OpenData(req.UploadID, req.Checksum)
 	if err != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":   userID,
 			"secret_id": vars["id"],
 			"error":     err.Error(),
 		}).Error("[Secret] Ошибка сборки чанков")
-		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.chunks_not_complete", nil)
+		if !writeAssemblyError(w, r, err) {
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		}
 		return
 	}
 
@@ -506,20 +1123,22 @@ func (h *Handler) FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request)
 	}
 
 	createReq := &CreateSecretRequest{
-		Login:      req.Login,
-		Password:   req.Password,
-		Metadata:   metadata,
-		BinaryData: binaryData,
+		Type:         req.Type,
+		Login:        req.Login,
+		Password:     req.Password,
+		Metadata:     metadata,
+		BinaryReader: binaryData,
 	}
 
 	var secret *Secret
 	if req.Version != nil {
 		updateReq := &UpdateSecretRequest{
-			Login:      req.Login,
-			Password:   req.Password,
-			Metadata:   metadata,
-			BinaryData: binaryData,
-			Version:    *req.Version,
+			Type:         req.Type,
+			Login:        req.Login,
+			Password:     req.Password,
+			Metadata:     metadata,
+			BinaryReader: binaryData,
+			Version:      *req.Version,
 		}
 		secret, err = h.service.UpdateSecret(secretID, userID, updateReq, excludeSessionID)
 	} else {
@@ -533,11 +1152,20 @@ func (h *Handler) FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request)
 			"error":     err.Error(),
 		}).Error("[Secret] Ошибка создания/обновления секрета")
 
+		if writeAssemblyError(w, r, err) {
+			return
+		}
+
 		if errors.Is(err, ErrVersionConflict) {
 			localization.LocalizedError(w, r, http.StatusConflict, "secret.version_conflict", nil)
 			return
 		}
 
+		if isValidationError(err) {
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
+			return
+		}
+
 		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
 		return
 	}
@@ -549,6 +1177,98 @@ func (h *Handler) FinalizeChunkedUpload(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(secret.ToResponse())
 }
 
+// writeAssemblyError отвечает 400 на ошибки сборки файла из частей. Они приходят и при открытии
+// загрузки, и при чтении частей в BlobStore.
+func writeAssemblyError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, ErrChunksNotComplete):
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.chunks_not_complete", nil)
+	case errors.Is(err, ErrFileSizeMismatch):
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.file_size_mismatch", nil)
+	case errors.Is(err, ErrFileChecksumMismatch):
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.file_checksum_mismatch", nil)
+	default:
+		return false
+	}
+	return true
+}
+
+// ChunkStatus godoc
+// @Summary Состояние загрузки по частям
+// @Description Возвращает индексы частей, которые еще не получены сервером, чтобы клиент мог продолжить загрузку
+// @Tags secrets
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID секрета из chunks/init"
+// @Param uploadId query string true "ID сессии загрузки"
+// @Success 200 {object} ChunkedUploadStatusResponse
+// @Failure 400 {object} map[string]string "Неверный ID секрета"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Доступ запрещен"
+// @Failure 404 {object} map[string]string "Сессия не найдена или истекла"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/chunks/status [get]
+func (h *Handler) ChunkStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	secretID := mux.Vars(r)["id"]
+	uploadID := r.URL.Query().Get("uploadId")
+
+	session, err := h.chunkedService.GetSession(uploadID)
+	if err != nil {
+		if !errors.Is(err, ErrUploadSessionNotFound) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"upload_id": uploadID,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения сессии загрузки")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.session_not_found", nil)
+		return
+	}
+
+	if session.UserID != fmt.Sprintf("%d", userID) {
+		localization.LocalizedError(w, r, http.StatusForbidden, "secret.access_denied", nil)
+		return
+	}
+
+	if session.SecretID != secretID {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.invalid_secret_id", nil)
+		return
+	}
+
+	missing, err := h.chunkedService.GetMissingChunks(uploadID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"upload_id": uploadID,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка получения состояния загрузки")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	response := ChunkedUploadStatusResponse{
+		UploadID:      session.UploadID,
+		SecretID:      session.SecretID,
+		TotalChunks:   session.TotalChunks,
+		MissingChunks: missing,
+		ExpiresAt:     session.ExpiresAt,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
 func (h *Handler) DownloadChunk(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
@@ -564,7 +1284,7 @@ func (h *Handler) DownloadChunk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	secret, err := h.service.GetSecret(secretID, userID)
+	info, err := h.service.GetBlobInfo(secretID, userID)
 	if err != nil {
 		if errors.Is(err, ErrSecretNotFound) {
 			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
@@ -580,23 +1300,334 @@ func (h *Handler) DownloadChunk(w http.ResponseWriter, r *http.Request) {
 	}
 
 	const chunkSize = 100 * 1024
-	chunks := SplitIntoChunks(secret.BinaryData, chunkSize)
+	totalChunks := int((info.Size + chunkSize - 1) / chunkSize)
 
-	if chunkIndex < 0 || chunkIndex >= len(chunks) {
+	if chunkIndex < 0 || chunkIndex >= totalChunks {
 		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.chunk_index_invalid", nil)
 		return
 	}
 
-	chunkData := chunks[chunkIndex]
-	base64Data := base64.StdEncoding.EncodeToString(chunkData)
+	chunkData, err := h.service.ReadBlob(info, int64(chunkIndex)*chunkSize, chunkSize)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": vars["id"],
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка чтения части бинарных данных")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
 
 	response := DownloadChunkResponse{
 		ChunkIndex:  chunkIndex,
-		Data:        base64Data,
-		TotalChunks: len(chunks),
+		Data:        base64.StdEncoding.EncodeToString(chunkData),
+		TotalChunks: totalChunks,
+		Checksum:    info.Checksum,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// UploadBlob godoc
+// @Summary Загрузить бинарные данные секрета
+// @Description Заменяет бинарные данные секрета телом запроса application/octet-stream без base64 и JSON
+// @Tags secrets
+// @Security BearerAuth
+// @Accept application/octet-stream
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Param version query int true "Текущая версия секрета"
+// @Success 200 {object} BlobResponse
+// @Failure 400 {object} map[string]string "Неверная версия или тип секрета"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Доступ к чужому секрету только на чтение"
+// @Failure 404 {object} map[string]string "Секрет не найден"
+// @Failure 409 {object} map[string]string "Конфликт версий"
+// @Failure 413 {object} map[string]string "Бинарные данные больше 4 ГиБ"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/blob [put]
+func (h *Handler) UploadBlob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	version, err := strconv.Atoi(r.URL.Query().Get("version"))
+	if err != nil || version < 1 {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "secret.version_invalid", nil)
+		return
+	}
+
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
+	body := http.MaxBytesReader(w, r.Body, MaxUploadSize)
+	info, err := h.service.UploadBlob(id, userID, version, body, excludeSessionID)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			localization.LocalizedError(w, r, http.StatusRequestEntityTooLarge, "secret.blob_too_large", nil)
+			return
+		case errors.Is(err, ErrSecretNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+			return
+		case errors.Is(err, ErrForbidden):
+			localization.LocalizedError(w, r, http.StatusForbidden, "secret.forbidden", nil)
+			return
+		case errors.Is(err, ErrVersionConflict):
+			localization.LocalizedError(w, r, http.StatusConflict, "secret.version_conflict", nil)
+			return
+		case isValidationError(err):
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка загрузки бинарных данных")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info.ToResponse()); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// DownloadBlob godoc
+// @Summary Скачать бинарные данные секрета
+// @Description Отдает бинарные данные потоком application/octet-stream. Поддерживает заголовок Range
+// @Tags secrets
+// @Security BearerAuth
+// @Produce application/octet-stream
+// @Param id path string true "ID секрета"
+// @Param Range header string false "Диапазон байт, например bytes=0-1023"
+// @Param If-Range header string false "ETag (SHA-256 файла) из предыдущего ответа: диапазон отдается, только если файл не менялся"
+// @Success 200 {file} binary
+// @Success 206 {file} binary "Запрошенный диапазон"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Секрет не найден"
+// @Failure 416 "Диапазон вне файла"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/blob [get]
+func (h *Handler) DownloadBlob(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	info, err := h.service.GetBlobInfo(id, userID)
+	if err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+			return
+		}
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка получения сведений о бинарных данных")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	// ServeContent сам разбирает Range и If-Range, а данные читаются из хранилища частями
+	// по мере отправки. ETag - контрольная сумма: If-Range с суммой старого файла вернет его целиком.
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if info.Checksum != "" {
+		w.Header().Set("ETag", blobETag(info.Checksum))
+	}
+	http.ServeContent(w, r, "", info.UpdatedAt, NewBlobReader(h.service, info))
+}
+
+// parseListQuery разбирает параметры GET /secrets. Второе значение - ID сообщения об ошибке.
+func parseListQuery(values url.Values) (*ListSecretsQuery, string) {
+	query := &ListSecretsQuery{
+		Type:   SecretType(values.Get("type")),
+		Sort:   ListSort(values.Get("sort")),
+		Cursor: values.Get("cursor"),
+	}
+
+	if query.Type != "" && !query.Type.IsValid() {
+		return nil, "secret.invalid_type"
+	}
+
+	if query.Sort == "" {
+		query.Sort = SortCreated
+	}
+	if !query.Sort.IsValid() {
+		return nil, "secret.invalid_sort"
+	}
+
+	switch values.Get("order") {
+	case "":
+		query.Desc = query.Sort != SortLogin
+	case "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return nil, "secret.invalid_sort"
+	}
+
+	if limitStr := values.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return nil, "secret.invalid_list_limit"
+		}
+		query.Limit = limit
+	}
+
+	// metadata.<ключ>=<значение> - совпадение значения, has_metadata=<ключ> - наличие ключа
+	for name, vals := range values {
+		key, ok := strings.CutPrefix(name, "metadata.")
+		if !ok {
+			continue
+		}
+		if key == "" || len(vals) != 1 {
+			return nil, "secret.invalid_metadata_filter"
+		}
+		if query.Metadata == nil {
+			query.Metadata = make(map[string]string)
+		}
+		query.Metadata[key] = vals[0]
+	}
+	for _, key := range values["has_metadata"] {
+		if key == "" {
+			return nil, "secret.invalid_metadata_filter"
+		}
+		query.MetadataKeys = append(query.MetadataKeys, key)
+	}
+
+	// tag=<название> можно повторять, tag_match=all требует все метки, any (по умолчанию) - любую
+	for _, name := range values["tag"] {
+		if name = strings.TrimSpace(name); name == "" {
+			return nil, "secret.invalid_tag_filter"
+		}
+		query.Tags = append(query.Tags, name)
+	}
+	switch values.Get("tag_match") {
+	case "", "any":
+	case "all":
+		query.TagsMatchAll = true
+	default:
+		return nil, "secret.invalid_tag_filter"
+	}
+
+	return query, ""
+}
+
+// notModified выставляет ETag списка и отвечает 304, если If-None-Match с ним совпадает.
+// Номер изменения читается до самого списка: если секреты изменятся между запросами,
+// ETag окажется старее ответа, и клиент лишь получит список еще раз.
+func (h *Handler) notModified(w http.ResponseWriter, r *http.Request, userID int) bool {
+	seq, err := h.service.GetChangeSeq(userID)
+	if err != nil {
+		// Без ETag список просто отдается целиком
+		return false
+	}
+
+	etag := collectionETag(seq, r.URL.Path, r.URL.Query().Encode())
+	w.Header().Set("ETag", etag)
+	if !noneMatch(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ifMatchVersion возвращает версию секрета, которую ожидает заголовок If-Match.
+// Для * подходит любая текущая версия.
+func (h *Handler) ifMatchVersion(id string, userID int, ifMatch string) (int, error) {
+	for _, etag := range parseETags(ifMatch) {
+		if etag == "*" {
+			secret, err := h.service.GetSecret(id, userID)
+			if err != nil {
+				return 0, err
+			}
+			return secret.Version, nil
+		}
+		if version, ok := parseSecretETag(etag, id); ok {
+			return version, nil
+		}
+	}
+	return 0, ErrPreconditionFailed
+}
+
+func (h *Handler) writeIfMatchError(w http.ResponseWriter, r *http.Request, userID int, id string, err error) {
+	switch {
+	case errors.Is(err, ErrPreconditionFailed):
+		localization.LocalizedError(w, r, http.StatusPreconditionFailed, "secret.precondition_failed", nil)
+	case errors.Is(err, ErrSecretNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка проверки If-Match")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
+
+var validationErrors = []error{
+	ErrRequestRequired,
+	ErrInvalidID,
+	ErrLoginRequired,
+	ErrPasswordRequired,
+	ErrInvalidType,
+	ErrTextRequired,
+	ErrCardRequired,
+	ErrFileRequired,
+	ErrUnexpectedFields,
+	ErrInvalidPatch,
+	ErrInvalidFolderID,
+	ErrEmailRequired,
+	ErrInvalidPermission,
+	ErrWrappedKeyInvalid,
+	ErrShareWithSelf,
+}
+
+// writeMergeConflict отвечает 409 со списком конфликтующих полей и текущей копией секрета
+func writeMergeConflict(w http.ResponseWriter, r *http.Request, mergeErr *MergeConflictError) {
+	response := MergeConflictResponse{
+		Error:     localization.Translate(localization.GetLanguageFromContext(r.Context()), mergeErr.Error(), nil),
+		Conflicts: mergeErr.Fields,
+		Current:   mergeErr.Current.ToResponseForSync(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+func isValidationError(err error) bool {
+	return validationMessageID(err) != ""
+}
+
+// validationMessageID возвращает ID сообщения локализации для ошибки валидации
+func validationMessageID(err error) string {
+	for _, validationErr := range validationErrors {
+		if errors.Is(err, validationErr) {
+			return validationErr.Error()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+// ListShares godoc
+// @Summary Доступы к секрету
+// @Description Возвращает пользователей, которым владелец открыл секрет
+// @Tags secrets
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Success 200 {array} ShareResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Доступы видит только владелец"
+// @Failure 404 {object} map[string]string "Секрет не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/shares [get]
+func (h *Handler) ListShares(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	shares, err := h.service.ListShares(id, userID)
+	if err != nil {
+		writeShareError(w, r, userID, id, err, "[Secret] Ошибка получения доступов к секрету")
+		return
+	}
+
+	response := make([]ShareResponse, 0, len(shares))
+	for _, share := range shares {
+		response = append(response, share.ToResponse())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// Share godoc
+// @Summary Открыть секрет другому пользователю
+// @Description Выдает пользователю доступ read или write к секрету либо меняет выданный. wrapped_key - ключ секрета, зашифрованный на клиенте для получателя
+// @Tags secrets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID секрета"
+// @Param request body ShareSecretRequest true "Получатель, право и ключ"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 200 {object} ShareResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 403 {object} map[string]string "Открыть секрет может только владелец"
+// @Failure 404 {object} map[string]string "Секрет или получатель не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/shares [put]
+func (h *Handler) Share(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req ShareSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	share, err := h.service.ShareSecret(id, userID, &req, excludeSessionID)
+	if err != nil {
+		writeShareError(w, r, userID, id, err, "[Secret] Ошибка выдачи доступа к секрету")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(share.ToResponse()); err != nil {
+		logger.Errorf("[Secret] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// RevokeShare godoc
+// @Summary Закрыть доступ к секрету
+// @Description Владелец отзывает доступ любого получателя, получатель может отказаться от своего
+// @Tags secrets
+// @Security BearerAuth
+// @Param id path string true "ID секрета"
+// @Param userId path int true "ID получателя"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 204 "Доступ отозван"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Доступ не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /secrets/{id}/shares/{userId} [delete]
+func (h *Handler) RevokeShare(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var excludeSessionID string
+	if sessionID, ok := middleware.GetSessionIDFromContext(r.Context()); ok {
+		excludeSessionID = sessionID
+	}
+
+	vars := mux.Vars(r)
+	granteeID, err := strconv.Atoi(vars["userId"])
+	if err != nil {
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.share_not_found", nil)
+		return
+	}
+
+	if err := h.service.RevokeShare(vars["id"], userID, granteeID, excludeSessionID); err != nil {
+		writeShareError(w, r, userID, vars["id"], err, "[Secret] Ошибка отзыва доступа к секрету")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeShareError отвечает на ошибку операций с доступами. Неожиданные ошибки пишутся в лог с logMessage.
+func writeShareError(w http.ResponseWriter, r *http.Request, userID int, secretID string, err error, logMessage string) {
+	switch {
+	case isValidationError(err):
+		localization.LocalizedError(w, r, http.StatusBadRequest, validationMessageID(err), nil)
+	case errors.Is(err, ErrForbidden):
+		localization.LocalizedError(w, r, http.StatusForbidden, "secret.forbidden", nil)
+	case errors.Is(err, ErrSecretNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.not_found", nil)
+	case errors.Is(err, ErrGranteeNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.grantee_not_found", nil)
+	case errors.Is(err, ErrShareNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "secret.share_not_found", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": secretID,
+			"error":     err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
@@ -3,9 +3,15 @@ package secret
 import (
 	"bytes"
 	"context"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,33 +20,54 @@ import (
 )
 
 type MockService struct {
-	secrets map[string]*Secret
+	secrets   map[string]*Secret
+	users     map[string]int // email -> ID пользователя
+	shares    []*SecretShare
+	purged    []string
+	devices   []string
+	syncLimit int
+	changeSeq int64
 }
 
 func NewMockService() *MockService {
 	return &MockService{
 		secrets: make(map[string]*Secret),
+		users:   make(map[string]int),
 	}
 }
 
 func (m *MockService) CreateSecret(userID int, req *CreateSecretRequest, excludeSessionID string) (*Secret, error) {
-	if req.Login == "" {
-		return nil, ErrLoginRequired
+	if err := validatePayload(normalizeType(req.Type), req.Login, req.Password, req.Text, req.Card, len(req.BinaryData) > 0 || req.BinaryReader != nil); err != nil {
+		return nil, err
 	}
-	if req.Password == "" {
-		return nil, ErrPasswordRequired
+
+	id := req.ID
+	if id == "" {
+		id = "test-uuid-" + time.Now().Format("20060102150405.000000000")
+	} else if _, exists := m.secrets[id]; exists {
+		return nil, ErrSecretAlreadyExists
 	}
 
 	secret := &Secret{
-		ID:         "test-uuid-" + time.Now().Format("20060102150405"),
-		UserID:     userID,
-		Login:      req.Login,
-		Password:   req.Password,
-		Metadata:   req.Metadata,
-		BinaryData: req.BinaryData,
-		Version:    1,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+		ID:           id,
+		UserID:       userID,
+		Type:         normalizeType(req.Type),
+		Login:        req.Login,
+		Password:     req.Password,
+		Text:         req.Text,
+		Card:         req.Card,
+		Metadata:     req.Metadata,
+		BinaryData:   req.BinaryData,
+		BinaryReader: req.BinaryReader,
+		Version:      1,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := drainBinaryReader(secret); err != nil {
+		return nil, err
+	}
+	if len(secret.BinaryData) > 0 {
+		secret.BlobChecksum = blobChecksum(secret.BinaryData)
 	}
 	m.secrets[secret.ID] = secret
 	return secret, nil
@@ -54,14 +81,19 @@ func (m *MockService) GetSecret(id string, userID int) (*Secret, error) {
 	return secret, nil
 }
 
-func (m *MockService) GetAllSecrets(userID int) ([]*Secret, error) {
-	var result []*Secret
+// ListSecrets фильтрует только по типу и отдает все секреты одной страницей
+func (m *MockService) ListSecrets(userID int, query *ListSecretsQuery) (*SecretListResponse, error) {
+	if _, err := decodeListCursor(query.Cursor, query.Sort, query.Desc); err != nil {
+		return nil, err
+	}
+
+	response := &SecretListResponse{Secrets: []SecretResponse{}}
 	for _, secret := range m.secrets {
-		if secret.UserID == userID {
-			result = append(result, secret)
+		if secret.UserID == userID && (query.Type == "" || secret.Type == query.Type) {
+			response.Secrets = append(response.Secrets, secret.ToListResponse())
 		}
 	}
-	return result, nil
+	return response, nil
 }
 
 func (m *MockService) UpdateSecret(id string, userID int, req *UpdateSecretRequest, excludeSessionID string) (*Secret, error) {
@@ -77,43 +109,260 @@ func (m *MockService) UpdateSecret(id string, userID int, req *UpdateSecretReque
 		return nil, ErrSecretNotFound
 	}
 	if secret.Version != req.Version {
+		if req.Merge {
+			return nil, &MergeConflictError{Fields: []string{"password"}, Current: secret}
+		}
 		return nil, ErrVersionConflict
 	}
 
 	secret.Login = req.Login
 	secret.Password = req.Password
 	secret.Metadata = req.Metadata
-	secret.BinaryData = req.BinaryData
+	secret.BinaryData, secret.BinaryReader = req.BinaryData, req.BinaryReader
+	if err := drainBinaryReader(secret); err != nil {
+		return nil, err
+	}
+	secret.BlobChecksum = blobChecksum(secret.BinaryData)
+	secret.Version++
+	secret.UpdatedAt = time.Now()
+
+	return secret, nil
+}
+
+func (m *MockService) PatchSecret(id string, userID int, req *PatchSecretRequest, excludeSessionID string) (*Secret, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID {
+		return nil, ErrSecretNotFound
+	}
+	if secret.Version != req.Version {
+		return nil, ErrVersionConflict
+	}
+	if err := applySecretPatch(secret, req.Fields); err != nil {
+		return nil, err
+	}
+
+	secret.BlobChecksum = blobChecksum(secret.BinaryData)
 	secret.Version++
 	secret.UpdatedAt = time.Now()
 
 	return secret, nil
 }
 
-func (m *MockService) DeleteSecret(id string, userID int, excludeSessionID string) error {
+func (m *MockService) DeleteSecret(id string, userID int, version int, excludeSessionID string) error {
 	secret, ok := m.secrets[id]
 	if !ok || secret.UserID != userID {
 		return ErrSecretNotFound
 	}
+	if version != 0 && secret.Version != version {
+		return ErrVersionConflict
+	}
 	delete(m.secrets, id)
 	return nil
 }
 
-func (m *MockService) GetSecretsForSync(userID int, since *time.Time) (*SyncResponse, error) {
+// GetSecretsForSync отдает все секреты при пустом курсоре и ничего - при любом другом
+func (m *MockService) GetSecretsForSync(userID int, cursor string, limit int) (*SyncResponse, error) {
+	if _, err := decodeSyncCursor(cursor); err != nil {
+		return nil, err
+	}
+	m.syncLimit = limit
+
 	var result []*Secret
-	for _, secret := range m.secrets {
-		if secret.UserID == userID {
-			if since == nil || secret.UpdatedAt.After(*since) {
+	if cursor == "" {
+		for _, secret := range m.secrets {
+			if secret.UserID == userID {
 				result = append(result, secret)
 			}
 		}
 	}
 	return &SyncResponse{
 		Secrets:    result,
-		ServerTime: time.Now(),
+		NextCursor: encodeSyncCursor(int64(len(m.secrets))),
 	}, nil
 }
 
+func (m *MockService) PushChanges(userID int, req *PushRequest, excludeSessionID string) ([]*PushResult, error) {
+	if len(req.Operations) > MaxPushOperations {
+		return nil, ErrTooManyPushOperations
+	}
+	results := make([]*PushResult, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		change, err := pushOperationToChange(&op)
+		if err != nil {
+			results = append(results, &PushResult{ClientID: op.ClientID, Status: PushInvalid, Err: err})
+			continue
+		}
+		if op.Action != PushCreate {
+			results = append(results, &PushResult{ClientID: op.ClientID, Status: PushNotFound})
+			continue
+		}
+		secret, _ := m.CreateSecret(userID, &CreateSecretRequest{Login: change.Secret.Login, Password: change.Secret.Password}, excludeSessionID)
+		results = append(results, &PushResult{ClientID: op.ClientID, Status: PushApplied, Secret: secret})
+	}
+	return results, nil
+}
+
+func (m *MockService) GetSecretVersions(id string, userID int) ([]*SecretVersion, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID {
+		return nil, ErrSecretNotFound
+	}
+	return []*SecretVersion{{SecretID: id, UserID: userID, Version: secret.Version, Type: secret.Type}}, nil
+}
+
+func (m *MockService) GetSecretVersion(id string, userID int, version int) (*SecretVersion, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID || version != secret.Version {
+		return nil, ErrVersionNotFound
+	}
+	return &SecretVersion{SecretID: id, UserID: userID, Version: version, Type: secret.Type, Login: secret.Login, Password: secret.Password}, nil
+}
+
+func (m *MockService) RestoreSecretVersion(id string, userID int, version int, req *RestoreVersionRequest, excludeSessionID string) (*Secret, error) {
+	snapshot, err := m.GetSecretVersion(id, userID, version)
+	if err != nil {
+		return nil, err
+	}
+	return m.UpdateSecret(id, userID, &UpdateSecretRequest{
+		Type:     snapshot.Type,
+		Login:    snapshot.Login,
+		Password: snapshot.Password,
+		Version:  req.Version,
+	}, excludeSessionID)
+}
+
+func (m *MockService) GetTrash(userID int) ([]*Secret, error) {
+	var result []*Secret
+	for _, secret := range m.secrets {
+		if secret.UserID == userID && secret.DeletedAt.Valid {
+			result = append(result, secret)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockService) RestoreSecret(id string, userID int, excludeSessionID string) (*Secret, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID || !secret.DeletedAt.Valid {
+		return nil, ErrSecretNotFound
+	}
+	secret.DeletedAt.Valid = false
+	secret.Version++
+	return secret, nil
+}
+
+func (m *MockService) PurgeSecret(id string, userID int, version int, excludeSessionID string) error {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID {
+		return ErrSecretNotFound
+	}
+	if version != 0 && secret.Version != version {
+		return ErrVersionConflict
+	}
+	delete(m.secrets, id)
+	m.purged = append(m.purged, id)
+	return nil
+}
+
+func (m *MockService) GetChangeSeq(userID int) (int64, error) {
+	return m.changeSeq, nil
+}
+
+func (m *MockService) RecordDeviceSync(userID int, deviceID string, cursor string) {
+	m.devices = append(m.devices, deviceID)
+}
+
+func (m *MockService) GetBlobInfo(id string, userID int) (*BlobInfo, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID {
+		return nil, ErrSecretNotFound
+	}
+	return &BlobInfo{SecretID: id, UserID: userID, Type: secret.Type, Version: secret.Version, Size: int64(len(secret.BinaryData)), Checksum: secret.BlobChecksum, UpdatedAt: secret.UpdatedAt, Ref: id}, nil
+}
+
+func (m *MockService) ReadBlob(info *BlobInfo, offset, length int64) ([]byte, error) {
+	secret, ok := m.secrets[info.Ref]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	end := offset + length
+	if end > int64(len(secret.BinaryData)) {
+		end = int64(len(secret.BinaryData))
+	}
+	return secret.BinaryData[offset:end], nil
+}
+
+func (m *MockService) UploadBlob(id string, userID int, version int, r io.Reader, excludeSessionID string) (*BlobInfo, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID {
+		return nil, ErrSecretNotFound
+	}
+	if secret.Version != version {
+		return nil, ErrVersionConflict
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	secret.BinaryData = data
+	secret.BlobChecksum = blobChecksum(data)
+	secret.Version++
+	return m.GetBlobInfo(id, userID)
+}
+
+func (m *MockService) ShareSecret(id string, userID int, req *ShareSecretRequest, excludeSessionID string) (*SecretShare, error) {
+	if req.Email == "" {
+		return nil, ErrEmailRequired
+	}
+	secret, ok := m.secrets[id]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	if secret.UserID != userID {
+		return nil, ErrForbidden
+	}
+	granteeID, ok := m.users[req.Email]
+	if !ok {
+		return nil, ErrGranteeNotFound
+	}
+	share := &SecretShare{
+		SecretID:     id,
+		OwnerID:      userID,
+		GranteeID:    granteeID,
+		GranteeEmail: req.Email,
+		Permission:   req.Permission,
+		WrappedKey:   req.WrappedKey,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	m.shares = append(m.shares, share)
+	return share, nil
+}
+
+func (m *MockService) ListShares(id string, userID int) ([]*SecretShare, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID {
+		return nil, ErrSecretNotFound
+	}
+	var shares []*SecretShare
+	for _, share := range m.shares {
+		if share.SecretID == id {
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
+}
+
+func (m *MockService) RevokeShare(id string, userID int, granteeID int, excludeSessionID string) error {
+	for i, share := range m.shares {
+		if share.SecretID == id && share.GranteeID == granteeID && (share.OwnerID == userID || granteeID == userID) {
+			m.shares = append(m.shares[:i], m.shares[i+1:]...)
+			return nil
+		}
+	}
+	return ErrShareNotFound
+}
+
 func addUserIDToContext(r *http.Request, userID int) *http.Request {
 	ctx := context.WithValue(r.Context(), middleware.UserIDKey, userID)
 	return r.WithContext(ctx)
@@ -121,7 +370,7 @@ func addUserIDToContext(r *http.Request, userID int) *http.Request {
 
 func TestHandler_Create(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	reqBody := CreateSecretRequest{
 		Login:    "encrypted_login",
@@ -152,7 +401,7 @@ func TestHandler_Create(t *testing.T) {
 
 func TestHandler_Create_Validation(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	reqBody := CreateSecretRequest{
 		Login:    "",
@@ -171,9 +420,32 @@ func TestHandler_Create_Validation(t *testing.T) {
 	}
 }
 
+func TestHandler_Create_ClientID(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	body, _ := json.Marshal(CreateSecretRequest{
+		ID:       "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		Login:    "login",
+		Password: "password",
+	})
+
+	for _, expected := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets", bytes.NewReader(body))
+		req = addUserIDToContext(req, 1)
+		w := httptest.NewRecorder()
+
+		handler.Create(w, req)
+
+		if w.Code != expected {
+			t.Errorf("Expected status %d, got %d", expected, w.Code)
+		}
+	}
+}
+
 func TestHandler_Get(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
 		Login:    "login",
@@ -203,7 +475,7 @@ func TestHandler_Get(t *testing.T) {
 
 func TestHandler_Get_NotFound(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/nonexistent", nil)
 	req = addUserIDToContext(req, 1)
@@ -219,7 +491,7 @@ func TestHandler_Get_NotFound(t *testing.T) {
 
 func TestHandler_GetAll(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
 
@@ -233,13 +505,13 @@ func TestHandler_GetAll(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
-	var response []SecretResponse
+	var response SecretListResponse
 	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
 
 	found := false
-	for _, s := range response {
+	for _, s := range response.Secrets {
 		if s.ID == secret.ID {
 			found = true
 			break
@@ -250,9 +522,142 @@ func TestHandler_GetAll(t *testing.T) {
 	}
 }
 
+func TestHandler_GetAll_FilterByType(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
+	note, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeText, Text: "note"}, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets?type=text", nil)
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.GetAll(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response SecretListResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.Secrets) != 1 || response.Secrets[0].ID != note.ID {
+		t.Fatalf("Expected only text secret %s, got %+v", note.ID, response.Secrets)
+	}
+	if response.Secrets[0].Type != TypeText || response.Secrets[0].Text != "note" {
+		t.Errorf("Expected text payload, got type %s text %q", response.Secrets[0].Type, response.Secrets[0].Text)
+	}
+}
+
+func TestHandler_GetAll_InvalidParams(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	for _, query := range []string{
+		"sort=name",
+		"order=up",
+		"limit=0",
+		"limit=abc",
+		"metadata.=x",
+		"has_metadata=",
+		"tag=",
+		"tag=prod&tag_match=some",
+		"cursor=not-a-cursor",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets?"+query, nil)
+		req = addUserIDToContext(req, 1)
+		w := httptest.NewRecorder()
+
+		handler.GetAll(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestParseListQuery(t *testing.T) {
+	values, _ := url.ParseQuery("sort=login&limit=20&metadata.app=github&has_metadata=folder&has_metadata=tag")
+	query, messageID := parseListQuery(values)
+	if messageID != "" {
+		t.Fatalf("Unexpected error %s", messageID)
+	}
+
+	if query.Sort != SortLogin || query.Desc || query.Limit != 20 {
+		t.Errorf("Unexpected sort or limit: %+v", query)
+	}
+	if !reflect.DeepEqual(query.Metadata, map[string]string{"app": "github"}) {
+		t.Errorf("Unexpected metadata filter: %v", query.Metadata)
+	}
+	if !reflect.DeepEqual(query.MetadataKeys, []string{"folder", "tag"}) {
+		t.Errorf("Unexpected metadata keys: %v", query.MetadataKeys)
+	}
+
+	query, _ = parseListQuery(url.Values{})
+	if query.Sort != SortCreated || !query.Desc {
+		t.Errorf("Expected newest first by default, got %+v", query)
+	}
+}
+
+func TestParseListQuery_Tags(t *testing.T) {
+	values, _ := url.ParseQuery("tag=prod&tag=shared-with-oncall")
+	query, messageID := parseListQuery(values)
+	if messageID != "" {
+		t.Fatalf("Unexpected error %s", messageID)
+	}
+	if !reflect.DeepEqual(query.Tags, []string{"prod", "shared-with-oncall"}) || query.TagsMatchAll {
+		t.Errorf("Expected any of two tags, got %v (all=%v)", query.Tags, query.TagsMatchAll)
+	}
+
+	values, _ = url.ParseQuery("tag=prod&tag=staging&tag_match=all")
+	query, _ = parseListQuery(values)
+	if !query.TagsMatchAll {
+		t.Error("Expected tag_match=all to require every tag")
+	}
+}
+
+func TestHandler_GetAll_InvalidType(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets?type=unknown", nil)
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.GetAll(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_Create_CardRequiresAllFields(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	reqBody := CreateSecretRequest{
+		Type: TypeCard,
+		Card: &CardData{Number: "4111", Expiry: "12/30", Holder: "IVAN IVANOV"},
+	}
+	body, _ := json.Marshal(reqBody)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets", bytes.NewReader(body))
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.Create(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
 func TestHandler_Update(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
 		Login:    "old_login",
@@ -293,7 +698,7 @@ func TestHandler_Update(t *testing.T) {
 
 func TestHandler_Update_VersionConflict(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
 		Login:    "login",
@@ -321,7 +726,7 @@ func TestHandler_Update_VersionConflict(t *testing.T) {
 
 func TestHandler_Delete(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
 	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
 		Login:    "login",
@@ -340,69 +745,187 @@ func TestHandler_Delete(t *testing.T) {
 	}
 }
 
-func TestHandler_Sync(t *testing.T) {
+func TestHandler_Delete_Permanent(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
-	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+	}, "")
 
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync", nil)
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/secrets/"+secret.ID+"?permanent=true", nil)
 	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
 	w := httptest.NewRecorder()
 
-	handler.Sync(w, req)
+	handler.Delete(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+	if len(service.purged) != 1 || service.purged[0] != secret.ID {
+		t.Errorf("Expected secret %s to be purged, got %v", secret.ID, service.purged)
 	}
+}
 
-	var response struct {
-		Secrets    []SecretResponse `json:"secrets"`
-		ServerTime string           `json:"server_time"`
+func TestHandler_TrashAndRestore(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+	secret.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/trash", nil)
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.Trash(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
-	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+	var trash []SecretResponse
+	if err := json.NewDecoder(w.Body).Decode(&trash); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
+	if len(trash) != 1 || trash[0].ID != secret.ID || trash[0].DeletedAt == nil {
+		t.Fatalf("Expected deleted secret in trash, got %v", trash)
+	}
 
-	found := false
-	for _, s := range response.Secrets {
-		if s.ID == secret.ID {
-			found = true
-			break
-		}
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/secrets/"+secret.ID+"/restore", nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w = httptest.NewRecorder()
+
+	handler.Restore(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
-	if !found {
-		t.Error("Created secret not found in sync response")
+	var restored SecretResponse
+	if err := json.NewDecoder(w.Body).Decode(&restored); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
 	}
-
-	if response.ServerTime == "" {
-		t.Error("Expected ServerTime to be set")
+	if restored.DeletedAt != nil {
+		t.Error("Expected restored secret to have no deleted_at")
+	}
+	if restored.Version != 2 {
+		t.Errorf("Expected version 2, got %d", restored.Version)
 	}
 }
 
-func TestHandler_Sync_WithSince(t *testing.T) {
+func TestHandler_Restore_NotInTrash(t *testing.T) {
 	service := NewMockService()
-	handler := NewHandler(service)
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
 
-	service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
 
-	futureTime := time.Now().Add(1 * time.Hour)
-	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync", nil)
-	q := req.URL.Query()
-	q.Add("since", futureTime.Format(time.RFC3339))
-	req.URL.RawQuery = q.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/"+secret.ID+"/restore", nil)
 	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
 	w := httptest.NewRecorder()
 
-	handler.Sync(w, req)
+	handler.Restore(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandler_Sync_RecordsDevice(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync", nil)
+	req = addUserIDToContext(req, 1)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.SessionIDKey, "device-1"))
+	w := httptest.NewRecorder()
+
+	handler.Sync(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if len(service.devices) != 1 || service.devices[0] != "device-1" {
+		t.Errorf("Expected device-1 to be recorded, got %v", service.devices)
+	}
+}
+
+func TestHandler_Sync(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync", nil)
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.Sync(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
 	var response struct {
-		Secrets    []SecretResponse `json:"secrets"`
-		ServerTime string           `json:"server_time"`
+		Secrets    []SecretResponse  `json:"secrets"`
+		Folders    []json.RawMessage `json:"folders"`
+		Tags       []json.RawMessage `json:"tags"`
+		NextCursor string            `json:"next_cursor"`
+		HasMore    bool              `json:"has_more"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Folders == nil {
+		t.Error("Expected folders array in sync response")
+	}
+	if response.Tags == nil {
+		t.Error("Expected tags array in sync response")
+	}
+
+	found := false
+	for _, s := range response.Secrets {
+		if s.ID == secret.ID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("Created secret not found in sync response")
+	}
+
+	if response.NextCursor == "" {
+		t.Error("Expected NextCursor to be set")
+	}
+	if response.HasMore {
+		t.Error("Expected HasMore to be false")
+	}
+}
+
+func TestHandler_Sync_WithCursor(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync", nil)
+	q := req.URL.Query()
+	q.Add("cursor", encodeSyncCursor(1))
+	q.Add("limit", "50")
+	req.URL.RawQuery = q.Encode()
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.Sync(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Secrets []SecretResponse `json:"secrets"`
 	}
 	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
@@ -411,4 +934,841 @@ func TestHandler_Sync_WithSince(t *testing.T) {
 	if len(response.Secrets) != 0 {
 		t.Errorf("Expected 0 secrets, got %d", len(response.Secrets))
 	}
+	if service.syncLimit != 50 {
+		t.Errorf("Expected limit 50 to be passed to service, got %d", service.syncLimit)
+	}
+}
+
+func TestHandler_Sync_InvalidParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{name: "Invalid cursor", query: "cursor=garbage"},
+		{name: "Non-numeric limit", query: "limit=abc"},
+		{name: "Zero limit", query: "limit=0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(NewMockService(), NewChunkedUploadService(NewMemoryUploadStore()))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync?"+tt.query, nil)
+			req = addUserIDToContext(req, 1)
+			w := httptest.NewRecorder()
+
+			handler.Sync(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_Push(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	body, _ := json.Marshal(PushRequest{Operations: []PushOperation{
+		{ClientID: "op-1", Action: PushCreate, Login: "login", Password: "password"},
+		{ClientID: "op-2", Action: PushDelete, SecretID: "missing"},
+		{ClientID: "op-3", Action: PushCreate, Login: "login"},
+	}})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/sync/push", bytes.NewReader(body))
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.Push(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d. Body: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response PushResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(response.Results))
+	}
+	if response.Results[0].Status != PushApplied || response.Results[0].Secret == nil || response.Results[0].Secret.ID == "" {
+		t.Errorf("Expected applied create with secret, got %+v", response.Results[0])
+	}
+	if response.Results[1].Status != PushNotFound || response.Results[1].Secret != nil {
+		t.Errorf("Expected not_found without secret, got %+v", response.Results[1])
+	}
+	if response.Results[2].Status != PushInvalid || response.Results[2].Error == "" {
+		t.Errorf("Expected invalid with error message, got %+v", response.Results[2])
+	}
+}
+
+func TestHandler_Push_InvalidRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "Malformed JSON", body: []byte("{")},
+		{name: "Too many operations", body: func() []byte {
+			data, _ := json.Marshal(PushRequest{Operations: make([]PushOperation, MaxPushOperations+1)})
+			return data
+		}()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(NewMockService(), NewChunkedUploadService(NewMemoryUploadStore()))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/sync/push", bytes.NewReader(tt.body))
+			req = addUserIDToContext(req, 1)
+			w := httptest.NewRecorder()
+
+			handler.Push(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_Update_MergeConflict(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "server"}, "")
+	secret.Version = 3
+
+	body, _ := json.Marshal(UpdateSecretRequest{Login: "login", Password: "local", Version: 1, Merge: true})
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID, bytes.NewReader(body))
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w := httptest.NewRecorder()
+
+	handler.Update(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON body, got %q", ct)
+	}
+
+	var response MergeConflictResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Conflicts) != 1 || response.Conflicts[0] != "password" {
+		t.Errorf("Expected password conflict, got %v", response.Conflicts)
+	}
+	if response.Current.Version != 3 || response.Current.Password != "server" {
+		t.Errorf("Expected current server copy, got %+v", response.Current)
+	}
+	if response.Error == "" {
+		t.Error("Expected error message")
+	}
+}
+
+func TestHandler_ListVersions(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+secret.ID+"/versions", nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w := httptest.NewRecorder()
+
+	handler.ListVersions(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response []SecretVersionSummary
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response) != 1 || response[0].Version != 1 {
+		t.Errorf("Expected single version 1, got %+v", response)
+	}
+}
+
+func TestHandler_GetVersion_InvalidNumber(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/id/versions/abc", nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": "id", "version": "abc"})
+	w := httptest.NewRecorder()
+
+	handler.GetVersion(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_RestoreVersion_Conflict(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+
+	body, _ := json.Marshal(RestoreVersionRequest{Version: 7})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/"+secret.ID+"/versions/1/restore", bytes.NewReader(body))
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID, "version": "1"})
+	w := httptest.NewRecorder()
+
+	handler.RestoreVersion(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestHandler_InitChunkedUpload_InvalidSize(t *testing.T) {
+	handler := NewHandler(NewMockService(), NewChunkedUploadService(NewMemoryUploadStore()))
+
+	body, _ := json.Marshal(InitChunkedUploadRequest{TotalChunks: 0, TotalSize: 100})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/chunks/init", bytes.NewReader(body))
+	req = addUserIDToContext(req, 1)
+	w := httptest.NewRecorder()
+
+	handler.InitChunkedUpload(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestHandler_ChunkStatus(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	session, err := handler.chunkedService.InitUpload("1", 3, 300)
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+	if err := handler.chunkedService.UploadChunk(session.UploadID, 1, "AAAA", ""); err != nil {
+		t.Fatalf("UploadChunk failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+session.SecretID+"/chunks/status?uploadId="+session.UploadID, nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": session.SecretID})
+	w := httptest.NewRecorder()
+
+	handler.ChunkStatus(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response ChunkedUploadStatusResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.MissingChunks) != 2 || response.MissingChunks[0] != 0 || response.MissingChunks[1] != 2 {
+		t.Errorf("Expected missing chunks [0 2], got %v", response.MissingChunks)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+session.SecretID+"/chunks/status?uploadId="+session.UploadID, nil)
+	req = addUserIDToContext(req, 2)
+	req = mux.SetURLVars(req, map[string]string{"id": session.SecretID})
+	w = httptest.NewRecorder()
+
+	handler.ChunkStatus(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d for another user, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHandler_ChunkStatus_UnknownUpload(t *testing.T) {
+	handler := NewHandler(NewMockService(), NewChunkedUploadService(NewMemoryUploadStore()))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/s1/chunks/status?uploadId=missing", nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": "s1"})
+	w := httptest.NewRecorder()
+
+	handler.ChunkStatus(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandler_UploadChunk_SizeLimits(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	session, err := handler.chunkedService.InitUpload("1", 2, 8)
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+
+	upload := func(index int, data []byte) int {
+		body, _ := json.Marshal(UploadChunkRequest{
+			UploadID:   session.UploadID,
+			ChunkIndex: index,
+			Data:       base64.StdEncoding.EncodeToString(data),
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/"+session.SecretID+"/chunks", bytes.NewReader(body))
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": session.SecretID})
+		w := httptest.NewRecorder()
+		handler.UploadChunk(w, req)
+		return w.Code
+	}
+
+	if code := upload(0, make([]byte, 2*MaxUploadChunkSize)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for oversized body, got %d", http.StatusRequestEntityTooLarge, code)
+	}
+	if code := upload(0, []byte("123456789")); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d for chunk larger than file, got %d", http.StatusRequestEntityTooLarge, code)
+	}
+	if code := upload(0, []byte("chunk1")); code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := upload(1, []byte("chunk2")); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d when chunks exceed totalSize, got %d", http.StatusBadRequest, code)
+	}
+}
+
+func TestHandler_FinalizeChunkedUpload_Checksums(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	content := []byte("chunk1chunk2")
+	session, err := handler.chunkedService.InitUpload("1", 2, int64(len(content)))
+	if err != nil {
+		t.Fatalf("InitUpload failed: %v", err)
+	}
+
+	upload := func(index int, data []byte, checksum string) int {
+		body, _ := json.Marshal(UploadChunkRequest{
+			UploadID:   session.UploadID,
+			ChunkIndex: index,
+			Data:       base64.StdEncoding.EncodeToString(data),
+			Checksum:   checksum,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/"+session.SecretID+"/chunks", bytes.NewReader(body))
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": session.SecretID})
+		w := httptest.NewRecorder()
+		handler.UploadChunk(w, req)
+		return w.Code
+	}
+
+	if code := upload(0, []byte("chunk1"), blobChecksum([]byte("corrupted"))); code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for corrupted chunk, got %d", http.StatusBadRequest, code)
+	}
+	if code := upload(0, []byte("chunk1"), blobChecksum([]byte("chunk1"))); code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+	if code := upload(1, []byte("chunk2"), ""); code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, code)
+	}
+
+	finalize := func(checksum string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(FinalizeChunkedUploadRequest{UploadID: session.UploadID, Type: TypeFile, Checksum: checksum})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/secrets/"+session.SecretID+"/chunks/finalize", bytes.NewReader(body))
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": session.SecretID})
+		w := httptest.NewRecorder()
+		handler.FinalizeChunkedUpload(w, req)
+		return w
+	}
+
+	if w := finalize(blobChecksum([]byte("something else"))); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for file checksum mismatch, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w := finalize(blobChecksum(content))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response SecretResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Checksum != blobChecksum(content) {
+		t.Errorf("Expected checksum %s, got %s", blobChecksum(content), response.Checksum)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+response.ID+"/chunks/0", nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": response.ID, "chunkIndex": "0"})
+	w = httptest.NewRecorder()
+
+	handler.DownloadChunk(w, req)
+
+	var chunk DownloadChunkResponse
+	if err := json.NewDecoder(w.Body).Decode(&chunk); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if chunk.Checksum != blobChecksum(content) {
+		t.Errorf("Expected chunk response checksum %s, got %s", blobChecksum(content), chunk.Checksum)
+	}
+}
+
+func TestHandler_UploadAndDownloadBlob(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeFile, BinaryData: []byte("old")}, "")
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID+"/blob?version=1", bytes.NewReader(content))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w := httptest.NewRecorder()
+
+	handler.UploadBlob(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var uploaded BlobResponse
+	if err := json.NewDecoder(w.Body).Decode(&uploaded); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if uploaded.Version != 2 || uploaded.Size != int64(len(content)) {
+		t.Errorf("Unexpected upload response: %+v", uploaded)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+secret.ID+"/blob", nil)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w = httptest.NewRecorder()
+
+	handler.DownloadBlob(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Unexpected Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	if !bytes.Equal(w.Body.Bytes(), content) {
+		t.Error("Downloaded content does not match uploaded")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+secret.ID+"/blob", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w = httptest.NewRecorder()
+
+	handler.DownloadBlob(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("Expected status %d, got %d", http.StatusPartialContent, w.Code)
+	}
+	if w.Body.String() != "0123456789" {
+		t.Errorf("Expected range content 0123456789, got %q", w.Body.String())
+	}
+	if w.Header().Get("Content-Range") != "bytes 10-19/10000" {
+		t.Errorf("Unexpected Content-Range %q", w.Header().Get("Content-Range"))
+	}
+}
+
+func TestHandler_DownloadBlob_IfRange(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	content := []byte("0123456789")
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeFile, BinaryData: content}, "")
+
+	download := func(ifRange string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+secret.ID+"/blob", nil)
+		req.Header.Set("Range", "bytes=5-")
+		req.Header.Set("If-Range", ifRange)
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+		w := httptest.NewRecorder()
+		handler.DownloadBlob(w, req)
+		return w
+	}
+
+	w := download(blobETag(blobChecksum(content)))
+	if w.Code != http.StatusPartialContent || w.Body.String() != "56789" {
+		t.Fatalf("Expected partial content 56789, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != blobETag(blobChecksum(content)) {
+		t.Errorf("Unexpected ETag %q", w.Header().Get("ETag"))
+	}
+
+	// Докачка файла, который уже заменили, получает новый файл целиком
+	w = download(blobETag(blobChecksum([]byte("old"))))
+	if w.Code != http.StatusOK || w.Body.String() != string(content) {
+		t.Errorf("Expected full content, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_UploadBlob_TooLarge(t *testing.T) {
+	service := &discardBlobService{MockService: NewMockService()}
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeFile, BinaryData: []byte("old")}, "")
+
+	// Тело длиннее MaxUploadSize читается потоком и в памяти теста не собирается
+	body := io.LimitReader(zeroReader{}, MaxUploadSize+1)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID+"/blob?version=1", body)
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w := httptest.NewRecorder()
+
+	handler.UploadBlob(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+// discardBlobService читает загружаемые данные, не сохраняя их
+type discardBlobService struct {
+	*MockService
+}
+
+func (s *discardBlobService) UploadBlob(id string, userID int, version int, r io.Reader, excludeSessionID string) (*BlobInfo, error) {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, err
+	}
+	return s.GetBlobInfo(id, userID)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestHandler_UploadBlob_VersionRequired(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeFile, BinaryData: []byte("old")}, "")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID+"/blob", bytes.NewReader([]byte("data")))
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w := httptest.NewRecorder()
+
+	handler.UploadBlob(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID+"/blob?version=5", bytes.NewReader([]byte("data")))
+	req = addUserIDToContext(req, 1)
+	req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+	w = httptest.NewRecorder()
+
+	handler.UploadBlob(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+}
+
+func TestHandler_Get_NotModified(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+	}, "")
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+secret.ID, nil)
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.Get(w, req)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if etag != secretETag(secret.ID, secret.Version) {
+		t.Fatalf("Expected ETag %s, got %q", secretETag(secret.ID, secret.Version), etag)
+	}
+
+	w = get(etag)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", w.Body.String())
+	}
+
+	secret.Version++
+	w = get(etag)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d after update, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandler_GetAll_NotModified(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+
+	getAll := func(target, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = addUserIDToContext(req, 1)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.GetAll(w, req)
+		return w
+	}
+
+	etag := getAll("/api/v1/secrets", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag header")
+	}
+
+	if w := getAll("/api/v1/secrets", etag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, w.Code)
+	}
+	if w := getAll("/api/v1/secrets?type=login", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for another filter, got %d", http.StatusOK, w.Code)
+	}
+
+	service.changeSeq++
+	if w := getAll("/api/v1/secrets", etag); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d after change, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandler_Sync_NotModified(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	sync := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/sync", nil)
+		req = addUserIDToContext(req, 1)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.SessionIDKey, "device-1"))
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.Sync(w, req)
+		return w
+	}
+
+	etag := sync("").Header().Get("ETag")
+	w := sync(etag)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, w.Code)
+	}
+	if len(service.devices) != 2 {
+		t.Errorf("Expected device sync to be recorded on 304, got %v", service.devices)
+	}
+}
+
+func TestHandler_Update_IfMatch(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+	}, "")
+	etag := secretETag(secret.ID, secret.Version)
+
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(UpdateSecretRequest{Login: "new_login", Password: "new_password"})
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID, bytes.NewReader(body))
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		handler.Update(w, req)
+		return w
+	}
+
+	w := update(etag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != secretETag(secret.ID, secret.Version) {
+		t.Errorf("Expected new ETag %s, got %q", secretETag(secret.ID, secret.Version), got)
+	}
+
+	if w := update(etag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d for stale ETag, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if w := update(`"other-1"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d for foreign ETag, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if w := update("*"); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for *, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestHandler_Delete_IfMatch(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+	}, "")
+
+	del := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/secrets/"+secret.ID+"?permanent=true", nil)
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		handler.Delete(w, req)
+		return w
+	}
+
+	if w := del(secretETag(secret.ID, secret.Version+1)); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if len(service.purged) != 0 {
+		t.Errorf("Expected secret to stay, got purged %v", service.purged)
+	}
+
+	if w := del(secretETag(secret.ID, secret.Version)); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+}
+
+func TestHandler_Patch(t *testing.T) {
+	service := NewMockService()
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Type:       TypeFile,
+		Metadata:   map[string]interface{}{"name": "a.txt"},
+		BinaryData: []byte("data"),
+	}, "")
+
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/secrets/"+secret.ID, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req = addUserIDToContext(req, 1)
+		req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+		w := httptest.NewRecorder()
+		handler.Patch(w, req)
+		return w
+	}
+
+	w := patch(MergePatchContentType, `{"version":1,"metadata":{"name":"b.txt"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response SecretResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Metadata["name"] != "b.txt" || string(response.BinaryData) != "data" || response.Version != 2 {
+		t.Errorf("Unexpected patched secret: %+v", response)
+	}
+
+	if w := patch(MergePatchContentType, `{"version":1,"metadata":{"name":"c.txt"}}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected status %d for stale version, got %d", http.StatusConflict, w.Code)
+	}
+	if w := patch(MergePatchContentType, `{"version":2,"created_at":null}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for read-only field, got %d", http.StatusBadRequest, w.Code)
+	}
+	if w := patch("text/plain", `{"version":2}`); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status %d, got %d", http.StatusUnsupportedMediaType, w.Code)
+	}
+}
+
+func TestHandler_Shares(t *testing.T) {
+	service := NewMockService()
+	service.users["friend@example.com"] = 2
+	handler := NewHandler(service, NewChunkedUploadService(NewMemoryUploadStore()))
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+
+	share := func(userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/secrets/"+secret.ID+"/shares", strings.NewReader(body))
+		req = addUserIDToContext(req, userID)
+		req = mux.SetURLVars(req, map[string]string{"id": secret.ID})
+		w := httptest.NewRecorder()
+		handler.Share(w, req)
+		return w
+	}
+
+	w := share(1, `{"email":"friend@example.com","permission":"write","wrapped_key":"k"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var created ShareResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.GranteeID != 2 || created.Email != "friend@example.com" || created.Permission != PermissionWrite {
+		t.Errorf("Unexpected share: %+v", created)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		body   string
+		status int
+	}{
+		{"invalid json", 1, `not json`, http.StatusBadRequest},
+		{"empty email", 1, `{"wrapped_key":"k"}`, http.StatusBadRequest},
+		{"unknown grantee", 1, `{"email":"nobody@example.com","wrapped_key":"k"}`, http.StatusNotFound},
+		{"not owner", 2, `{"email":"friend@example.com","wrapped_key":"k"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := share(tt.userID, tt.body); w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, w.Code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/secrets/"+secret.ID+"/shares", nil)
+	req = mux.SetURLVars(addUserIDToContext(req, 1), map[string]string{"id": secret.ID})
+	w = httptest.NewRecorder()
+	handler.ListShares(w, req)
+	var shares []ShareResponse
+	if err := json.NewDecoder(w.Body).Decode(&shares); err != nil || w.Code != http.StatusOK || len(shares) != 1 {
+		t.Fatalf("Expected one share, got status %d and %d shares", w.Code, len(shares))
+	}
+
+	revoke := func(granteeID string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/secrets/"+secret.ID+"/shares/"+granteeID, nil)
+		req = mux.SetURLVars(addUserIDToContext(req, 1), map[string]string{"id": secret.ID, "userId": granteeID})
+		w := httptest.NewRecorder()
+		handler.RevokeShare(w, req)
+		return w.Code
+	}
+
+	if status := revoke("2"); status != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, status)
+	}
+	if status := revoke("2"); status != http.StatusNotFound {
+		t.Errorf("Expected status %d for repeated revoke, got %d", http.StatusNotFound, status)
+	}
+	if status := revoke("abc"); status != http.StatusNotFound {
+		t.Errorf("Expected status %d for invalid user id, got %d", http.StatusNotFound, status)
+	}
 }
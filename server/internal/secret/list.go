@@ -0,0 +1,137 @@
+package secret
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// DefaultListLimit - размер страницы списка секретов, если клиент его не указал
+	DefaultListLimit = 100
+	// MaxListLimit - наибольший допустимый размер страницы списка секретов
+	MaxListLimit = 1000
+)
+
+// ListSort - поле, по которому упорядочен список секретов
+type ListSort string
+
+const (
+	SortCreated ListSort = "created"
+	SortUpdated ListSort = "updated"
+	SortLogin   ListSort = "login"
+)
+
+func (s ListSort) IsValid() bool {
+	switch s {
+	case SortCreated, SortUpdated, SortLogin:
+		return true
+	}
+	return false
+}
+
+// ListSecretsQuery - параметры GET /secrets. Пустые поля не ограничивают выборку.
+type ListSecretsQuery struct {
+	Type SecretType
+	Sort ListSort
+	// Desc - обратный порядок. По умолчанию даты идут от новых к старым, логины - по возрастанию.
+	Desc bool
+	// Metadata - значения ключей metadata, которые должны совпасть
+	Metadata map[string]string
+	// MetadataKeys - ключи, которые должны быть в metadata
+	MetadataKeys []string
+	// Tags - названия меток. Секрет подходит, если у него есть хотя бы одна из них,
+	// а при TagsMatchAll - все.
+	Tags         []string
+	TagsMatchAll bool
+	Cursor       string
+	Limit        int
+}
+
+// SecretListResponse - страница списка секретов. Бинарные данные в список не входят:
+// вместо них - binary_data_size и checksum.
+type SecretListResponse struct {
+	Secrets    []SecretResponse `json:"secrets"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	HasMore    bool             `json:"has_more"`
+}
+
+// listPosition - последний секрет страницы. Следующая страница начинается строго после него.
+type listPosition struct {
+	Sort  ListSort `json:"s"`
+	Desc  bool     `json:"d,omitempty"`
+	Value string   `json:"v"`
+	ID    string   `json:"id"`
+}
+
+func newListPosition(secret *Secret, sort ListSort, desc bool) *listPosition {
+	position := &listPosition{Sort: sort, Desc: desc, ID: secret.ID}
+	switch sort {
+	case SortUpdated:
+		position.Value = secret.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case SortLogin:
+		position.Value = secret.Login
+	default:
+		position.Value = secret.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return position
+}
+
+func encodeListCursor(position *listPosition) string {
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor разбирает курсор списка. Курсор от другой сортировки не подходит.
+func decodeListCursor(cursor string, sort ListSort, desc bool) (*listPosition, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var position listPosition
+	if err := json.Unmarshal(data, &position); err != nil || position.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if position.Sort != sort || position.Desc != desc {
+		return nil, ErrInvalidCursor
+	}
+	if sort != SortLogin {
+		if _, err := time.Parse(time.RFC3339Nano, position.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return &position, nil
+}
+
+// ToListResponse - элемент списка: без бинарных данных, только их размер и контрольная сумма
+func (s *Secret) ToListResponse() SecretResponse {
+	resp := SecretResponse{
+		ID:        s.ID,
+		Type:      s.Type,
+		Login:     s.Login,
+		Password:  s.Password,
+		Text:      s.Text,
+		Card:      s.Card,
+		Metadata:  s.Metadata,
+		Checksum:  s.BlobChecksum,
+		FolderID:  s.FolderID,
+		Tags:      s.Tags,
+		Shared:    s.Share,
+		Version:   s.Version,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+	}
+
+	if s.BlobSize > 0 {
+		size := s.BlobSize
+		resp.BinaryDataSize = &size
+	}
+
+	return resp
+}
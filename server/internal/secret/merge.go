@@ -0,0 +1,113 @@
+package secret
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+)
+
+// MergeConflictError возвращается, когда изменения клиента и другого устройства затронули
+// одни и те же поля. Fields - имена полей (login, password, metadata.<ключ> и т.д.),
+// Current - текущая копия секрета на сервере.
+type MergeConflictError struct {
+	Fields  []string
+	Current *Secret
+}
+
+func (e *MergeConflictError) Error() string {
+	return "secret.merge_conflict"
+}
+
+// Unwrap позволяет обрабатывать конфликт слияния как обычный конфликт версий
+func (e *MergeConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// MergeConflictResponse - тело ответа 409 при конфликте слияния
+type MergeConflictResponse struct {
+	Error     string         `json:"error"`
+	Conflicts []string       `json:"conflicts"`
+	Current   SecretResponse `json:"current"`
+}
+
+// mergeSecret выполняет трехстороннее слияние: base - версия, от которой клиент начал
+// изменение, current - секрет на сервере, req - изменение клиента. Поле, измененное только
+// одной стороной, берется у нее; поле, по-разному измененное обеими, попадает в конфликты.
+// Metadata сливается по ключам. current не изменяется.
+func mergeSecret(base *SecretVersion, current *Secret, req *UpdateSecretRequest) (*Secret, []string) {
+	merged := *current
+	var conflicts []string
+
+	field := func(name string, changedLocally, changedOnServer, sameResult bool, apply func()) {
+		if !changedLocally {
+			return
+		}
+		if changedOnServer && !sameResult {
+			conflicts = append(conflicts, name)
+			return
+		}
+		apply()
+	}
+
+	// Клиент, не передавший тип, его не менял
+	reqType := base.Type
+	if req.Type != "" {
+		reqType = normalizeType(req.Type)
+	}
+	field("type", reqType != base.Type, current.Type != base.Type, reqType == current.Type,
+		func() { merged.Type = reqType })
+	field("login", req.Login != base.Login, current.Login != base.Login, req.Login == current.Login,
+		func() { merged.Login = req.Login })
+	field("password", req.Password != base.Password, current.Password != base.Password, req.Password == current.Password,
+		func() { merged.Password = req.Password })
+	field("text", req.Text != base.Text, current.Text != base.Text, req.Text == current.Text,
+		func() { merged.Text = req.Text })
+	field("card", !reflect.DeepEqual(req.Card, base.Card), !reflect.DeepEqual(current.Card, base.Card),
+		reflect.DeepEqual(req.Card, current.Card), func() { merged.Card = req.Card })
+	field("binary_data", !bytes.Equal(req.BinaryData, base.BinaryData), !bytes.Equal(current.BinaryData, base.BinaryData),
+		bytes.Equal(req.BinaryData, current.BinaryData), func() { merged.BinaryData = req.BinaryData })
+
+	merged.Metadata = make(map[string]interface{}, len(current.Metadata))
+	for key, value := range current.Metadata {
+		merged.Metadata[key] = value
+	}
+
+	for _, key := range metadataKeys(base.Metadata, current.Metadata, req.Metadata) {
+		baseValue, inBase := base.Metadata[key]
+		currentValue, inCurrent := current.Metadata[key]
+		localValue, inLocal := req.Metadata[key]
+
+		changedLocally := inLocal != inBase || !reflect.DeepEqual(localValue, baseValue)
+		changedOnServer := inCurrent != inBase || !reflect.DeepEqual(currentValue, baseValue)
+		sameResult := inLocal == inCurrent && reflect.DeepEqual(localValue, currentValue)
+
+		field("metadata."+key, changedLocally, changedOnServer, sameResult, func() {
+			if inLocal {
+				merged.Metadata[key] = localValue
+			} else {
+				delete(merged.Metadata, key)
+			}
+		})
+	}
+
+	if len(merged.Metadata) == 0 && current.Metadata == nil {
+		merged.Metadata = nil
+	}
+
+	return &merged, conflicts
+}
+
+func metadataKeys(maps ...map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,102 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeSecret(t *testing.T) {
+	base := &SecretVersion{
+		Type:     TypeLogin,
+		Login:    "login",
+		Password: "password",
+		Metadata: map[string]interface{}{"url": "a", "note": "n"},
+		Version:  1,
+	}
+
+	tests := []struct {
+		name          string
+		current       *Secret
+		req           *UpdateSecretRequest
+		wantConflicts []string
+		wantLogin     string
+		wantPassword  string
+		wantMetadata  map[string]interface{}
+	}{
+		{
+			name:         "Only server changed",
+			current:      &Secret{Type: TypeLogin, Login: "login", Password: "server", Metadata: map[string]interface{}{"url": "a", "note": "n"}},
+			req:          &UpdateSecretRequest{Login: "login", Password: "password", Metadata: map[string]interface{}{"url": "a", "note": "n"}},
+			wantLogin:    "login",
+			wantPassword: "server",
+			wantMetadata: map[string]interface{}{"url": "a", "note": "n"},
+		},
+		{
+			name:         "Both changed the same way",
+			current:      &Secret{Type: TypeLogin, Login: "login", Password: "same", Metadata: map[string]interface{}{"url": "a", "note": "n"}},
+			req:          &UpdateSecretRequest{Login: "login", Password: "same", Metadata: map[string]interface{}{"url": "a", "note": "n"}},
+			wantLogin:    "login",
+			wantPassword: "same",
+			wantMetadata: map[string]interface{}{"url": "a", "note": "n"},
+		},
+		{
+			name:         "Independent metadata keys",
+			current:      &Secret{Type: TypeLogin, Login: "login", Password: "password", Metadata: map[string]interface{}{"url": "b", "note": "n", "server": "s"}},
+			req:          &UpdateSecretRequest{Login: "local", Password: "password", Metadata: map[string]interface{}{"url": "a"}},
+			wantLogin:    "local",
+			wantPassword: "password",
+			wantMetadata: map[string]interface{}{"url": "b", "server": "s"},
+		},
+		{
+			name:          "Key removed on server and changed locally",
+			current:       &Secret{Type: TypeLogin, Login: "login", Password: "password", Metadata: map[string]interface{}{"url": "a"}},
+			req:           &UpdateSecretRequest{Login: "login", Password: "password", Metadata: map[string]interface{}{"url": "a", "note": "changed"}},
+			wantConflicts: []string{"metadata.note"},
+		},
+		{
+			name:          "Login and password changed on both sides",
+			current:       &Secret{Type: TypeLogin, Login: "server-login", Password: "server", Metadata: map[string]interface{}{"url": "a", "note": "n"}},
+			req:           &UpdateSecretRequest{Login: "local-login", Password: "local", Metadata: map[string]interface{}{"url": "a", "note": "n"}},
+			wantConflicts: []string{"login", "password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, conflicts := mergeSecret(base, tt.current, tt.req)
+
+			assert.Equal(t, tt.wantConflicts, conflicts)
+			if len(tt.wantConflicts) > 0 {
+				return
+			}
+			assert.Equal(t, tt.wantLogin, merged.Login)
+			assert.Equal(t, tt.wantPassword, merged.Password)
+			assert.Equal(t, tt.wantMetadata, merged.Metadata)
+		})
+	}
+}
+
+func TestMergeSecret_DoesNotModifyCurrent(t *testing.T) {
+	base := &SecretVersion{Type: TypeLogin, Login: "l", Password: "p", Metadata: map[string]interface{}{"k": "v"}}
+	current := &Secret{Type: TypeLogin, Login: "l", Password: "p", Metadata: map[string]interface{}{"k": "v"}}
+
+	merged, conflicts := mergeSecret(base, current, &UpdateSecretRequest{Login: "l2", Password: "p", Metadata: map[string]interface{}{}})
+
+	assert.Empty(t, conflicts)
+	assert.Equal(t, "l2", merged.Login)
+	assert.Empty(t, merged.Metadata)
+	assert.Equal(t, "l", current.Login)
+	assert.Equal(t, map[string]interface{}{"k": "v"}, current.Metadata)
+}
+
+func TestMergeSecret_OmittedTypeIsUnchanged(t *testing.T) {
+	base := &SecretVersion{Type: TypeText, Text: "note", Version: 1}
+	current := &Secret{Type: TypeText, Text: "note", Version: 2}
+
+	merged, conflicts := mergeSecret(base, current, &UpdateSecretRequest{Text: "local note"})
+
+	assert.Empty(t, conflicts)
+	assert.Equal(t, TypeText, merged.Type)
+	assert.Equal(t, "local note", merged.Text)
+}
@@ -2,44 +2,110 @@ package secret
 
 import (
 	"database/sql"
+	"io"
 	"time"
 )
 
+// SecretType определяет, какие поля секрета заполнены
+type SecretType string
+
+const (
+	TypeLogin SecretType = "login"
+	TypeText  SecretType = "text"
+	TypeCard  SecretType = "card"
+	TypeFile  SecretType = "file"
+)
+
+func (t SecretType) IsValid() bool {
+	switch t {
+	case TypeLogin, TypeText, TypeCard, TypeFile:
+		return true
+	}
+	return false
+}
+
+// CardData - данные банковской карты. Поля шифруются на клиенте (base64)
+type CardData struct {
+	Number string `json:"number"`
+	Expiry string `json:"expiry"`
+	Holder string `json:"holder"`
+	CVV    string `json:"cvv"`
+}
+
 type Secret struct {
 	ID         string                 `json:"id" db:"id"`
 	UserID     int                    `json:"user_id" db:"user_id"`
+	Type       SecretType             `json:"type" db:"type"`
 	Login      string                 `json:"login" db:"login"`
 	Password   string                 `json:"password" db:"password"`
+	Text       string                 `json:"text,omitempty" db:"text_data"`
+	Card       *CardData              `json:"card,omitempty" db:"card_data"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
-	BinaryData []byte                 `json:"binary_data,omitempty" db:"binary_data"`
+	BinaryData []byte                 `json:"binary_data,omitempty" db:"-"`
+	FolderID   string                 `json:"folder_id,omitempty" db:"folder_id"` // пусто - корень
+	Tags       []string               `json:"tags,omitempty" db:"-"`              // ID меток из secret_tags
 	Version    int                    `json:"version" db:"version"`
 	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time              `json:"updated_at" db:"updated_at"`
 	DeletedAt  sql.NullTime           `json:"deleted_at,omitempty" db:"deleted_at"`
+	ChangeSeq  int64                  `json:"-" db:"change_seq"`
+	// Share - доступ, с которым пользователь видит чужой секрет. У своего секрета пусто.
+	Share *ShareAccess `json:"share,omitempty" db:"-"`
+
+	// BinaryReader заменяет BinaryData, когда данные приходят потоком (сборка загрузки по частям)
+	BinaryReader io.Reader `json:"-" db:"-"`
+
+	// Бинарные данные лежат в BlobStore, в базе - только ссылка на объект
+	BlobRef      string `json:"-" db:"blob_ref"`
+	BlobSize     int64  `json:"-" db:"blob_size"`
+	BlobChecksum string `json:"-" db:"blob_checksum"`
 }
 
 type CreateSecretRequest struct {
+	// ID можно сгенерировать на клиенте (UUID), тогда повтор запроса не создаст дубликат
+	ID         string                 `json:"id,omitempty"`
+	Type       SecretType             `json:"type,omitempty"`
 	Login      string                 `json:"login"`
 	Password   string                 `json:"password"`
+	Text       string                 `json:"text,omitempty"`
+	Card       *CardData              `json:"card,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	BinaryData []byte                 `json:"binary_data,omitempty"`
+	// BinaryReader - бинарные данные потоком вместо BinaryData, не приходит в JSON
+	BinaryReader io.Reader `json:"-"`
+	// FolderID - папка, в которую попадет секрет. Переносят секреты через /folders/move
+	FolderID string `json:"folder_id,omitempty"`
 }
 
 type UpdateSecretRequest struct {
+	Type       SecretType             `json:"type,omitempty"`
 	Login      string                 `json:"login"`
 	Password   string                 `json:"password"`
+	Text       string                 `json:"text,omitempty"`
+	Card       *CardData              `json:"card,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
 	BinaryData []byte                 `json:"binary_data,omitempty"`
-	Version    int                    `json:"version"`
+	// BinaryReader - бинарные данные потоком вместо BinaryData, не приходит в JSON
+	BinaryReader io.Reader `json:"-"`
+	Version      int       `json:"version"`
+	// Merge включает слияние с изменениями других устройств, если Version устарела
+	Merge bool `json:"merge,omitempty"`
 }
 
 type SecretResponse struct {
 	ID             string                 `json:"id"`
+	Type           SecretType             `json:"type"`
 	Login          string                 `json:"login"`
 	Password       string                 `json:"password"`
+	Text           string                 `json:"text,omitempty"`
+	Card           *CardData              `json:"card,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
 	BinaryData     []byte                 `json:"binary_data,omitempty"`
 	BinaryDataSize *int64                 `json:"binary_data_size,omitempty"`
+	Checksum       string                 `json:"checksum,omitempty"` // SHA-256 бинарных данных (hex)
+	FolderID       string                 `json:"folder_id,omitempty"`
+	Tags           []string               `json:"tags,omitempty"` // ID меток
+	Shared         *ShareAccess           `json:"shared,omitempty"`
 	Version        int                    `json:"version"`
 	CreatedAt      time.Time              `json:"created_at"`
 	UpdatedAt      time.Time              `json:"updated_at"`
@@ -53,10 +119,17 @@ const (
 func (s *Secret) ToResponse() SecretResponse {
 	resp := SecretResponse{
 		ID:         s.ID,
+		Type:       s.Type,
 		Login:      s.Login,
 		Password:   s.Password,
+		Text:       s.Text,
+		Card:       s.Card,
 		Metadata:   s.Metadata,
 		BinaryData: s.BinaryData,
+		Checksum:   s.BlobChecksum,
+		FolderID:   s.FolderID,
+		Tags:       s.Tags,
+		Shared:     s.Share,
 		Version:    s.Version,
 		CreatedAt:  s.CreatedAt,
 		UpdatedAt:  s.UpdatedAt,
@@ -66,15 +139,28 @@ func (s *Secret) ToResponse() SecretResponse {
 		resp.DeletedAt = &s.DeletedAt.Time
 	}
 
+	// Данные, записанные потоком, в ответ не попадают: клиент скачивает их отдельно
+	if len(s.BinaryData) == 0 && s.BlobSize > 0 {
+		size := s.BlobSize
+		resp.BinaryDataSize = &size
+	}
+
 	return resp
 }
 
 func (s *Secret) ToResponseForSync() SecretResponse {
 	resp := SecretResponse{
 		ID:        s.ID,
+		Type:      s.Type,
 		Login:     s.Login,
 		Password:  s.Password,
+		Text:      s.Text,
+		Card:      s.Card,
 		Metadata:  s.Metadata,
+		Checksum:  s.BlobChecksum,
+		FolderID:  s.FolderID,
+		Tags:      s.Tags,
+		Shared:    s.Share,
 		Version:   s.Version,
 		CreatedAt: s.CreatedAt,
 		UpdatedAt: s.UpdatedAt,
@@ -84,12 +170,98 @@ func (s *Secret) ToResponseForSync() SecretResponse {
 		resp.DeletedAt = &s.DeletedAt.Time
 	}
 
-	if len(s.BinaryData) > MinSizeForChunks {
-		size := int64(len(s.BinaryData))
+	// Бинарные данные в синхронизацию не попадают, клиент скачивает их отдельно
+	if s.BlobSize > 0 {
+		size := s.BlobSize
 		resp.BinaryDataSize = &size
-	} else {
-		resp.BinaryData = s.BinaryData
 	}
 
 	return resp
 }
+
+// BlobInfo описывает бинарные данные секрета, не загружая их
+type BlobInfo struct {
+	SecretID  string
+	UserID    int
+	Type      SecretType
+	Version   int
+	Size      int64
+	Checksum  string
+	UpdatedAt time.Time
+	// Ref - объект в BlobStore, из которого читаются данные. Наружу не отдается.
+	Ref string
+}
+
+// BlobResponse - ответ на потоковую загрузку бинарных данных
+type BlobResponse struct {
+	ID        string    `json:"id"`
+	Version   int       `json:"version"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (b *BlobInfo) ToResponse() BlobResponse {
+	return BlobResponse{
+		ID:        b.SecretID,
+		Version:   b.Version,
+		Size:      b.Size,
+		Checksum:  b.Checksum,
+		UpdatedAt: b.UpdatedAt,
+	}
+}
+
+// SecretVersion - снимок секрета из истории версий
+type SecretVersion struct {
+	SecretID       string                 `json:"secret_id" db:"secret_id"`
+	UserID         int                    `json:"user_id" db:"user_id"`
+	Version        int                    `json:"version" db:"version"`
+	Type           SecretType             `json:"type" db:"type"`
+	Login          string                 `json:"login" db:"login"`
+	Password       string                 `json:"password" db:"password"`
+	Text           string                 `json:"text,omitempty" db:"text_data"`
+	Card           *CardData              `json:"card,omitempty" db:"card_data"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty" db:"metadata"`
+	BinaryData     []byte                 `json:"binary_data,omitempty" db:"-"`
+	BinaryDataSize int64                  `json:"binary_data_size" db:"blob_size"`
+	CreatedAt      time.Time              `json:"created_at" db:"created_at"`
+}
+
+// SecretVersionSummary - элемент списка истории без содержимого секрета
+type SecretVersionSummary struct {
+	Version        int                    `json:"version"`
+	Type           SecretType             `json:"type"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+	BinaryDataSize int64                  `json:"binary_data_size"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+type RestoreVersionRequest struct {
+	Version int `json:"version"`
+}
+
+func (v *SecretVersion) ToSummary() SecretVersionSummary {
+	return SecretVersionSummary{
+		Version:        v.Version,
+		Type:           v.Type,
+		Metadata:       v.Metadata,
+		BinaryDataSize: v.BinaryDataSize,
+		CreatedAt:      v.CreatedAt,
+	}
+}
+
+func (v *SecretVersion) ToResponse() SecretResponse {
+	return SecretResponse{
+		ID:         v.SecretID,
+		Type:       v.Type,
+		Login:      v.Login,
+		Password:   v.Password,
+		Text:       v.Text,
+		Card:       v.Card,
+		Metadata:   v.Metadata,
+		BinaryData: v.BinaryData,
+		Version:    v.Version,
+		CreatedAt:  v.CreatedAt,
+		UpdatedAt:  v.CreatedAt,
+	}
+}
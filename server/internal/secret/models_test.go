@@ -43,6 +43,33 @@ func TestSecret_ToResponse(t *testing.T) {
 	}
 }
 
+func TestSecret_ToResponse_Card(t *testing.T) {
+	card := &CardData{Number: "4111", Expiry: "12/30", Holder: "IVAN IVANOV", CVV: "123"}
+	secret := &Secret{ID: "card-id", Type: TypeCard, Card: card}
+
+	resp := secret.ToResponse()
+	if resp.Type != TypeCard || resp.Card != card {
+		t.Errorf("Expected card payload in response, got type %s card %+v", resp.Type, resp.Card)
+	}
+
+	resp = secret.ToResponseForSync()
+	if resp.Type != TypeCard || resp.Card != card {
+		t.Errorf("Expected card payload in sync response, got type %s card %+v", resp.Type, resp.Card)
+	}
+}
+
+func TestSecretType_IsValid(t *testing.T) {
+	for _, secretType := range []SecretType{TypeLogin, TypeText, TypeCard, TypeFile} {
+		if !secretType.IsValid() {
+			t.Errorf("Expected %s to be valid", secretType)
+		}
+	}
+
+	if SecretType("bank").IsValid() || SecretType("").IsValid() {
+		t.Error("Expected unknown and empty types to be invalid")
+	}
+}
+
 func TestSecret_ToResponse_WithDeletedAt(t *testing.T) {
 	now := time.Now()
 	deletedTime := now.Add(-1 * time.Hour)
@@ -69,18 +96,16 @@ func TestSecret_ToResponse_WithDeletedAt(t *testing.T) {
 
 func TestSecret_ToResponseForSync(t *testing.T) {
 	now := time.Now()
-	smallData := []byte("small data")
 	secret := &Secret{
-		ID:         "test-id",
-		UserID:     1,
-		Login:      "test-login",
-		Password:   "test-password",
-		Metadata:   map[string]interface{}{"key": "value"},
-		BinaryData: smallData,
-		Version:    1,
-		CreatedAt:  now,
-		UpdatedAt:  now,
-		DeletedAt:  sql.NullTime{Valid: false},
+		ID:        "test-id",
+		UserID:    1,
+		Login:     "test-login",
+		Password:  "test-password",
+		Metadata:  map[string]interface{}{"key": "value"},
+		Version:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+		DeletedAt: sql.NullTime{Valid: false},
 	}
 
 	resp := secret.ToResponseForSync()
@@ -88,45 +113,42 @@ func TestSecret_ToResponseForSync(t *testing.T) {
 	if resp.ID != secret.ID {
 		t.Errorf("Expected ID %s, got %s", secret.ID, resp.ID)
 	}
-	if len(resp.BinaryData) != len(smallData) {
-		t.Errorf("Expected binary data length %d, got %d", len(smallData), len(resp.BinaryData))
+	if resp.BinaryData != nil {
+		t.Error("Expected BinaryData to be nil")
 	}
 	if resp.BinaryDataSize != nil {
-		t.Error("Expected BinaryDataSize to be nil for small data")
+		t.Error("Expected BinaryDataSize to be nil for secret without blob")
 	}
 }
 
-func TestSecret_ToResponseForSync_LargeData(t *testing.T) {
+func TestSecret_ToResponseForSync_WithBlob(t *testing.T) {
 	now := time.Now()
-	// Create data larger than MinSizeForChunks (1 MB)
-	largeData := make([]byte, MinSizeForChunks+1000)
-	for i := range largeData {
-		largeData[i] = byte(i % 256)
-	}
-
 	secret := &Secret{
-		ID:         "test-id",
-		UserID:     1,
-		Login:      "test-login",
-		Password:   "test-password",
-		BinaryData: largeData,
-		Version:    1,
-		CreatedAt:  now,
-		UpdatedAt:  now,
-		DeletedAt:  sql.NullTime{Valid: false},
+		ID:           "test-id",
+		UserID:       1,
+		Login:        "test-login",
+		Password:     "test-password",
+		BlobSize:     MinSizeForChunks + 1000,
+		BlobChecksum: "checksum",
+		Version:      1,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		DeletedAt:    sql.NullTime{Valid: false},
 	}
 
 	resp := secret.ToResponseForSync()
 
 	if resp.BinaryData != nil {
-		t.Error("Expected BinaryData to be nil for large data")
+		t.Error("Expected BinaryData to be nil")
 	}
 	if resp.BinaryDataSize == nil {
-		t.Fatal("Expected BinaryDataSize to be set for large data")
+		t.Fatal("Expected BinaryDataSize to be set")
 	}
-	expectedSize := int64(len(largeData))
-	if *resp.BinaryDataSize != expectedSize {
-		t.Errorf("Expected BinaryDataSize %d, got %d", expectedSize, *resp.BinaryDataSize)
+	if *resp.BinaryDataSize != secret.BlobSize {
+		t.Errorf("Expected BinaryDataSize %d, got %d", secret.BlobSize, *resp.BinaryDataSize)
+	}
+	if resp.Checksum != secret.BlobChecksum {
+		t.Errorf("Expected Checksum %s, got %s", secret.BlobChecksum, resp.Checksum)
 	}
 }
 
@@ -155,33 +177,26 @@ func TestSecret_ToResponseForSync_WithDeletedAt(t *testing.T) {
 	}
 }
 
-func TestSecret_ToResponseForSync_ExactlyAtThreshold(t *testing.T) {
+func TestSecret_ToResponseForSync_IgnoresLoadedData(t *testing.T) {
 	now := time.Now()
-	// Create data exactly at MinSizeForChunks
-	thresholdData := make([]byte, MinSizeForChunks)
-	for i := range thresholdData {
-		thresholdData[i] = byte(i % 256)
-	}
-
+	data := []byte("small data")
 	secret := &Secret{
 		ID:         "test-id",
 		UserID:     1,
-		Login:      "test-login",
-		Password:   "test-password",
-		BinaryData: thresholdData,
+		BinaryData: data,
+		BlobSize:   int64(len(data)),
 		Version:    1,
 		CreatedAt:  now,
 		UpdatedAt:  now,
-		DeletedAt:  sql.NullTime{Valid: false},
 	}
 
 	resp := secret.ToResponseForSync()
 
-	// At exactly MinSizeForChunks, should NOT use chunked mode (only > MinSizeForChunks)
-	if resp.BinaryData == nil || len(resp.BinaryData) != MinSizeForChunks {
-		t.Error("Expected BinaryData to be included at exact threshold")
+	// Даже загруженные данные не попадают в синхронизацию, только размер
+	if resp.BinaryData != nil {
+		t.Error("Expected BinaryData to be omitted from sync response")
 	}
-	if resp.BinaryDataSize != nil {
-		t.Error("Expected BinaryDataSize to be nil at exact threshold")
+	if resp.BinaryDataSize == nil || *resp.BinaryDataSize != int64(len(data)) {
+		t.Errorf("Expected BinaryDataSize %d", len(data))
 	}
 }
@@ -0,0 +1,163 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MergePatchContentType - тип содержимого JSON Merge Patch (RFC 7396)
+const MergePatchContentType = "application/merge-patch+json"
+
+// PatchSecretRequest - частичное обновление секрета в формате JSON Merge Patch (RFC 7396).
+// Отсутствующее поле не меняется, null удаляет значение, объекты (metadata, card)
+// сливаются рекурсивно. Version - версия, от которой сделано изменение.
+type PatchSecretRequest struct {
+	Version int
+	Fields  map[string]json.RawMessage
+}
+
+// parsePatchRequest разбирает тело PATCH. Поле version в патче задает проверяемую версию.
+func parsePatchRequest(body []byte) (*PatchSecretRequest, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, ErrInvalidPatch
+	}
+
+	req := &PatchSecretRequest{Fields: fields}
+	if raw, ok := fields["version"]; ok {
+		if err := json.Unmarshal(raw, &req.Version); err != nil {
+			return nil, ErrInvalidPatch
+		}
+		delete(fields, "version")
+	}
+
+	return req, nil
+}
+
+// applySecretPatch применяет патч к секрету. Бинарные данные меняются, только если
+// binary_data есть в патче.
+func applySecretPatch(secret *Secret, fields map[string]json.RawMessage) error {
+	for field, raw := range fields {
+		var err error
+		switch field {
+		case "login":
+			err = patchString(&secret.Login, raw)
+		case "password":
+			err = patchString(&secret.Password, raw)
+		case "text":
+			err = patchString(&secret.Text, raw)
+		case "binary_data":
+			secret.BinaryData = nil
+			if !isJSONNull(raw) {
+				err = json.Unmarshal(raw, &secret.BinaryData)
+			}
+		case "metadata":
+			var metadata map[string]interface{}
+			metadata, err = patchObject(secret.Metadata, raw)
+			secret.Metadata = metadata
+		case "card":
+			err = patchCard(secret, raw)
+		default:
+			err = ErrInvalidPatch
+		}
+		if err != nil {
+			return ErrInvalidPatch
+		}
+	}
+
+	return nil
+}
+
+func patchString(target *string, raw json.RawMessage) error {
+	if isJSONNull(raw) {
+		*target = ""
+		return nil
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// patchObject сливает объект с патчем. Пустой результат становится nil.
+func patchObject(current map[string]interface{}, raw json.RawMessage) (map[string]interface{}, error) {
+	var patch interface{}
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, err
+	}
+
+	var target interface{}
+	if current != nil {
+		target = current
+	}
+
+	merged, _ := applyMergePatch(target, patch).(map[string]interface{})
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+func patchCard(secret *Secret, raw json.RawMessage) error {
+	var current map[string]interface{}
+	if secret.Card != nil {
+		data, err := json.Marshal(secret.Card)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &current); err != nil {
+			return err
+		}
+	}
+
+	merged, err := patchObject(current, raw)
+	if err != nil {
+		return err
+	}
+	if merged == nil {
+		secret.Card = nil
+		return nil
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var card CardData
+	if err := decoder.Decode(&card); err != nil {
+		return err
+	}
+	secret.Card = &card
+	return nil
+}
+
+// applyMergePatch - алгоритм MergePatch из RFC 7396 над значениями, разобранными encoding/json
+func applyMergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	result := make(map[string]interface{}, len(targetObject))
+	for key, value := range targetObject {
+		result[key] = value
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = applyMergePatch(result[key], value)
+	}
+
+	return result
+}
+
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
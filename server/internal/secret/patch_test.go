@@ -0,0 +1,83 @@
+package secret
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Примеры из приложения A RFC 7396
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target+" + "+tt.patch, func(t *testing.T) {
+			var target, patch, expected interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.target), &target))
+			require.NoError(t, json.Unmarshal([]byte(tt.patch), &patch))
+			require.NoError(t, json.Unmarshal([]byte(tt.result), &expected))
+
+			assert.Equal(t, expected, applyMergePatch(target, patch))
+		})
+	}
+}
+
+func TestApplySecretPatch(t *testing.T) {
+	secret := &Secret{
+		Type:       TypeCard,
+		Card:       &CardData{Number: "n", Expiry: "e", Holder: "h", CVV: "c"},
+		Metadata:   map[string]interface{}{"bank": "old"},
+		BinaryData: []byte("keep"),
+	}
+
+	err := applySecretPatch(secret, map[string]json.RawMessage{
+		"card":     json.RawMessage(`{"expiry":"e2"}`),
+		"metadata": json.RawMessage(`{"bank":null}`),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, &CardData{Number: "n", Expiry: "e2", Holder: "h", CVV: "c"}, secret.Card)
+	assert.Nil(t, secret.Metadata)
+	assert.Equal(t, []byte("keep"), secret.BinaryData)
+
+	require.NoError(t, applySecretPatch(secret, map[string]json.RawMessage{"binary_data": json.RawMessage(`null`)}))
+	assert.Nil(t, secret.BinaryData)
+
+	assert.ErrorIs(t, applySecretPatch(secret, map[string]json.RawMessage{"card": json.RawMessage(`{"pin":"1"}`)}), ErrInvalidPatch)
+	assert.ErrorIs(t, applySecretPatch(secret, map[string]json.RawMessage{"login": json.RawMessage(`1`)}), ErrInvalidPatch)
+	assert.ErrorIs(t, applySecretPatch(secret, map[string]json.RawMessage{"id": json.RawMessage(`"x"`)}), ErrInvalidPatch)
+}
+
+func TestParsePatchRequest(t *testing.T) {
+	req, err := parsePatchRequest([]byte(`{"version":3,"login":"l"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, req.Version)
+	assert.Equal(t, map[string]json.RawMessage{"login": json.RawMessage(`"l"`)}, req.Fields)
+
+	for _, body := range []string{`null`, `[]`, `"x"`, `{"version":"3"}`, `{`} {
+		_, err := parsePatchRequest([]byte(body))
+		assert.ErrorIs(t, err, ErrInvalidPatch, body)
+	}
+}
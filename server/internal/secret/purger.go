@@ -0,0 +1,107 @@
+package secret
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+)
+
+// TombstonePurger удаляет надгробия других записей ленты синхронизации (например, папок)
+type TombstonePurger interface {
+	PurgeTombstones(deletedBefore time.Time) (int64, error)
+}
+
+// Purger периодически удаляет из базы надгробия секретов, о которых уже знают все устройства
+type Purger struct {
+	repo      Repository
+	extra     []TombstonePurger
+	retention time.Duration
+	deviceTTL time.Duration
+	interval  time.Duration
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// NewPurger создает очистку корзины. retention - сколько секрет хранится в корзине,
+// deviceTTL - после какого простоя устройство перестает удерживать надгробия.
+func NewPurger(repo Repository, retention, deviceTTL, interval time.Duration) *Purger {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Purger{
+		repo:      repo,
+		retention: retention,
+		deviceTTL: deviceTTL,
+		interval:  interval,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// AddTombstonePurger добавляет в каждый проход очистку надгробий с тем же сроком хранения
+func (p *Purger) AddTombstonePurger(purger TombstonePurger) {
+	p.extra = append(p.extra, purger)
+}
+
+func (p *Purger) Start() {
+	p.wg.Add(1)
+	go p.run()
+	logger.Info("[Purger] Очистка корзины запущена")
+}
+
+func (p *Purger) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	logger.Info("[Purger] Очистка корзины остановлена")
+}
+
+func (p *Purger) run() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.PurgeOnce(time.Now())
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce выполняет один проход очистки и возвращает количество удаленных секретов
+func (p *Purger) PurgeOnce(now time.Time) int64 {
+	if devices, err := p.repo.DeleteStaleDevices(now.Add(-p.deviceTTL)); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("[Purger] Ошибка удаления неактивных устройств")
+	} else if devices > 0 {
+		logger.Infof("[Purger] Забыто неактивных устройств: %d", devices)
+	}
+
+	for _, purger := range p.extra {
+		if _, err := purger.PurgeTombstones(now.Add(-p.retention)); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"error": err.Error(),
+			}).Error("[Purger] Ошибка очистки надгробий")
+		}
+	}
+
+	purged, err := p.repo.PurgeTombstones(now.Add(-p.retention))
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"error": err.Error(),
+		}).Error("[Purger] Ошибка очистки корзины")
+		return 0
+	}
+
+	if purged > 0 {
+		logger.Infof("[Purger] Окончательно удалено секретов: %d", purged)
+	}
+
+	return purged
+}
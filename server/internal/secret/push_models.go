@@ -0,0 +1,73 @@
+package secret
+
+// PushAction - вид изменения в пакете POST /secrets/sync/push
+type PushAction string
+
+const (
+	PushCreate PushAction = "create"
+	PushUpdate PushAction = "update"
+	PushDelete PushAction = "delete"
+)
+
+// PushStatus - итог применения одной операции пакета
+type PushStatus string
+
+const (
+	PushApplied  PushStatus = "applied"
+	PushConflict PushStatus = "conflict"
+	PushNotFound PushStatus = "not_found"
+	PushInvalid  PushStatus = "invalid"
+)
+
+// MaxPushOperations ограничивает размер пакета: все операции применяются в одной транзакции
+const MaxPushOperations = 500
+
+// PushOperation - изменение, сделанное клиентом без связи с сервером.
+// ClientID выбирает клиент, он возвращается в результате операции.
+// Для create SecretID необязателен: это UUID, сгенерированный клиентом.
+type PushOperation struct {
+	ClientID    string                 `json:"client_id"`
+	Action      PushAction             `json:"action"`
+	SecretID    string                 `json:"secret_id,omitempty"`
+	BaseVersion int                    `json:"base_version,omitempty"`
+	Type        SecretType             `json:"type,omitempty"`
+	Login       string                 `json:"login,omitempty"`
+	Password    string                 `json:"password,omitempty"`
+	Text        string                 `json:"text,omitempty"`
+	Card        *CardData              `json:"card,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	BinaryData  []byte                 `json:"binary_data,omitempty"`
+	// FolderID учитывается только в create: несуществующая папка означает корень
+	FolderID string `json:"folder_id,omitempty"`
+}
+
+type PushRequest struct {
+	Operations []PushOperation `json:"operations"`
+}
+
+// SecretChange - проверенная операция пакета. Для update и delete Secret.Version -
+// версия, от которой клиент делал изменение (для delete 0 - без проверки).
+type SecretChange struct {
+	Action PushAction
+	Secret *Secret
+}
+
+// PushResult - итог операции пакета. Secret - новое состояние секрета (applied)
+// или текущая копия на сервере (conflict).
+type PushResult struct {
+	ClientID string
+	Status   PushStatus
+	Secret   *Secret
+	Err      error
+}
+
+type PushResultResponse struct {
+	ClientID string          `json:"client_id"`
+	Status   PushStatus      `json:"status"`
+	Secret   *SecretResponse `json:"secret,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type PushResponse struct {
+	Results []PushResultResponse `json:"results"`
+}
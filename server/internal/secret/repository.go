@@ -4,274 +4,963 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Repository interface {
 	CreateSecret(secret *Secret) error
 	GetSecretByID(id string, userID int) (*Secret, error)
-	GetSecretsByUserID(userID int) ([]*Secret, error)
-	GetSecretsModifiedSince(userID int, since time.Time) ([]*Secret, error)
+	LoadBinaryData(secret *Secret) error
+	ListSecrets(userID int, query *ListSecretsQuery, after *listPosition, limit int) ([]*Secret, error)
+	GetSecretChanges(userID int, afterSeq int64, limit int) ([]*Secret, error)
+	GetChangeSeq(userID int) (int64, error)
+	FolderExists(userID int, folderID string) (bool, error)
 	UpdateSecret(secret *Secret) error
-	SoftDeleteSecret(id string, userID int) error
+	SoftDeleteSecret(id string, userID int, version int) error
+	GetSecretVersions(secretID string, userID int) ([]*SecretVersion, error)
+	GetSecretVersion(secretID string, userID int, version int) (*SecretVersion, error)
+	PruneSecretVersions(secretID string, keep int) error
+	GetDeletedSecrets(userID int) ([]*Secret, error)
+	RestoreSecret(id string, userID int) error
+	PurgeSecret(id string, userID int, version int) error
+	SaveDeviceSync(userID int, deviceID string, syncedSeq int64) error
+	DeleteStaleDevices(seenBefore time.Time) (int64, error)
+	PurgeTombstones(deletedBefore time.Time) (int64, error)
+	GetBlobInfo(id string, userID int) (*BlobInfo, error)
+	ReadBlob(ref string, offset, length int64) ([]byte, error)
+	WriteBlob(id string, userID int, version int, r io.Reader) (*BlobInfo, error)
+	ApplyChanges(userID int, changes []*SecretChange) ([]*PushResult, error)
+	GetSharedSecretChanges(userID int, afterSeq int64, limit int) ([]*Secret, error)
+	GetShare(secretID string, granteeID int) (*SecretShare, error)
+	GetShareGrantees(secretID string) ([]int, error)
+	ListShares(secretID string, ownerID int) ([]*SecretShare, error)
+	ShareSecret(share *SecretShare) error
+	RevokeShare(secretID string, granteeID int, userID int) (int, error)
 }
 
 type DatabaseRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	blobs BlobStore
 }
 
-func NewDatabaseRepository(db *sql.DB) *DatabaseRepository {
-	return &DatabaseRepository{db: db}
+func NewDatabaseRepository(db *sql.DB, blobs BlobStore) *DatabaseRepository {
+	return &DatabaseRepository{db: db, blobs: blobs}
 }
 
 func (r *DatabaseRepository) CreateSecret(secret *Secret) error {
-	var metadataJSON []byte
-	var err error
-	if secret.Metadata != nil {
-		metadataJSON, err = json.Marshal(secret.Metadata)
+	created, err := r.storeBinaryData(secret)
+	if err != nil {
+		return err
+	}
+
+	if err := insertSecret(r.db, secret); err != nil {
+		r.releaseBlobs(created)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSecretAlreadyExists
+		}
+		return WrapError(err, "не удалось создать секрет")
+	}
+
+	return nil
+}
+
+// GetSecretByID возвращает секрет пользователя, включая удаленный, или неудаленный чужой,
+// к которому у него есть доступ. Бинарные данные не читаются: их догружает LoadBinaryData.
+func (r *DatabaseRepository) GetSecretByID(id string, userID int) (*Secret, error) {
+	query := `
+		SELECT ` + secretColumns + `, ` + shareColumns + `
+		FROM secrets` + shareJoin + `
+		WHERE id = $2 AND ` + visibleToUser + ` AND (user_id = $1 OR deleted_at IS NULL)
+	`
+
+	secret, err := scanVisibleSecret(r.db.QueryRow(query, userID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSecretNotFound
+		}
+		return nil, WrapError(err, "не удалось получить секрет")
+	}
+
+	return secret, nil
+}
+
+// listSortColumns - колонка и ее тип для каждой сортировки списка
+var listSortColumns = map[ListSort][2]string{
+	SortCreated: {"created_at", "timestamptz"},
+	SortUpdated: {"updated_at", "timestamptz"},
+	SortLogin:   {"login", "text"},
+}
+
+// ListSecrets возвращает до limit активных секретов после позиции after, включая чужие,
+// к которым у пользователя есть доступ. Бинарные данные не загружаются. Фильтры по metadata используют операторы @> и ?, которые обслуживает
+// индекс idx_secrets_metadata.
+func (r *DatabaseRepository) ListSecrets(userID int, query *ListSecretsQuery, after *listPosition, limit int) ([]*Secret, error) {
+	args := []interface{}{userID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	conditions := []string{visibleToUser, "deleted_at IS NULL"}
+	if query.Type != "" {
+		conditions = append(conditions, "type = "+arg(query.Type))
+	}
+	if len(query.Metadata) > 0 {
+		metadataJSON, err := json.Marshal(query.Metadata)
 		if err != nil {
-			return WrapError(err, "не удалось сериализовать metadata")
+			return nil, WrapError(err, "не удалось сериализовать фильтр metadata")
 		}
+		conditions = append(conditions, "metadata @> "+arg(string(metadataJSON))+"::jsonb")
+	}
+	for _, key := range query.MetadataKeys {
+		conditions = append(conditions, "metadata ? "+arg(key))
+	}
+	if len(query.Tags) > 0 {
+		tagged := `id IN (
+			SELECT st.secret_id FROM secret_tags st JOIN tags t ON t.id = st.tag_id
+			WHERE t.user_id = $1 AND t.deleted_at IS NULL AND t.name = ANY(` + arg(query.Tags) + `)`
+		if query.TagsMatchAll {
+			tagged += ` GROUP BY st.secret_id HAVING COUNT(*) = ` + arg(countUnique(query.Tags))
+		}
+		conditions = append(conditions, tagged+`)`)
+	}
+
+	sortColumn, ok := listSortColumns[query.Sort]
+	if !ok {
+		sortColumn = listSortColumns[SortCreated]
+	}
+	direction, comparison := "ASC", ">"
+	if query.Desc {
+		direction, comparison = "DESC", "<"
 	}
+	if after != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s::%s, %s::uuid)",
+			sortColumn[0], comparison, arg(after.Value), sortColumn[1], arg(after.ID)))
+	}
+
+	sqlQuery := `
+		SELECT ` + secretColumns + `, ` + shareColumns + `
+		FROM secrets` + shareJoin + `
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + sortColumn[0] + ` ` + direction + `, id ` + direction + `
+		LIMIT ` + arg(limit)
+
+	rows, err := r.db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить список секретов")
+	}
+	defer rows.Close()
+
+	secrets, err := scanSecrets(rows, scanVisibleSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
 
+// GetSecretChanges возвращает до limit секретов пользователя, включая надгробия,
+// измененных после номера afterSeq, в порядке номеров изменений
+func (r *DatabaseRepository) GetSecretChanges(userID int, afterSeq int64, limit int) ([]*Secret, error) {
 	query := `
-		INSERT INTO secrets (user_id, login, password, metadata, binary_data, version)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at
+		SELECT ` + secretColumns + `
+		FROM secrets
+		WHERE user_id = $1 AND change_seq > $2
+		ORDER BY change_seq ASC
+		LIMIT $3
 	`
 
-	err = r.db.QueryRow(
-		query,
-		secret.UserID,
-		secret.Login,
-		secret.Password,
-		metadataJSON,
-		secret.BinaryData,
-		secret.Version,
-	).Scan(&secret.ID, &secret.CreatedAt, &secret.UpdatedAt)
+	secrets, err := r.querySecrets(query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить измененные секреты")
+	}
+
+	return secrets, nil
+}
 
+func (r *DatabaseRepository) UpdateSecret(secret *Secret) error {
+	created, err := r.storeBinaryData(secret)
 	if err != nil {
-		return WrapError(err, "не удалось создать секрет")
+		return err
+	}
+
+	previousRef, err := updateSecretRow(r.db, secret)
+	if err != nil {
+		r.releaseBlobs(created)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVersionConflict
+		}
+		return WrapError(err, "не удалось обновить секрет")
+	}
+
+	if previousRef != secret.BlobRef {
+		r.releaseBlobs(previousRef)
 	}
 
 	return nil
 }
 
-func (r *DatabaseRepository) GetSecretByID(id string, userID int) (*Secret, error) {
-	var secret Secret
-	var metadataJSON []byte
+// SoftDeleteSecret перемещает секрет в корзину. version 0 - без проверки версии.
+func (r *DatabaseRepository) SoftDeleteSecret(id string, userID int, version int) error {
+	if err := softDeleteSecretRow(r.db, id, userID, version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return r.rejectionError(id, userID, version, "deleted_at IS NULL")
+		}
+		return WrapError(err, "не удалось удалить секрет")
+	}
+
+	return nil
+}
 
+// GetDeletedSecrets возвращает содержимое корзины: удаленные, но не стертые окончательно секреты
+func (r *DatabaseRepository) GetDeletedSecrets(userID int) ([]*Secret, error) {
 	query := `
-		SELECT id, user_id, login, password, metadata, binary_data, version,
-		       created_at, updated_at, deleted_at
+		SELECT ` + secretColumns + `
 		FROM secrets
-		WHERE id = $1 AND user_id = $2
+		WHERE user_id = $1 AND deleted_at IS NOT NULL AND purged_at IS NULL
+		ORDER BY deleted_at DESC
 	`
 
-	err := r.db.QueryRow(query, id, userID).Scan(
-		&secret.ID,
-		&secret.UserID,
-		&secret.Login,
-		&secret.Password,
-		&metadataJSON,
-		&secret.BinaryData,
-		&secret.Version,
-		&secret.CreatedAt,
-		&secret.UpdatedAt,
-		&secret.DeletedAt,
-	)
+	secrets, err := r.querySecrets(query, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить корзину")
+	}
+
+	return secrets, nil
+}
 
+// RestoreSecret возвращает секрет из корзины, увеличивая версию, чтобы устройства получили изменение
+func (r *DatabaseRepository) RestoreSecret(id string, userID int) error {
+	query := `
+		UPDATE secrets
+		SET deleted_at = NULL,
+		    version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL AND purged_at IS NULL
+		RETURNING updated_at
+	`
+
+	var updatedAt time.Time
+	err := r.db.QueryRow(query, id, userID).Scan(&updatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrSecretNotFound
+			return ErrSecretNotFound
 		}
-		return nil, WrapError(err, "не удалось получить секрет")
+		return WrapError(err, "не удалось восстановить секрет")
 	}
 
-	if metadataJSON != nil {
-		if err := json.Unmarshal(metadataJSON, &secret.Metadata); err != nil {
-			return nil, WrapError(err, "не удалось десериализовать metadata")
+	return nil
+}
+
+// PurgeSecret стирает данные секрета и его историю. Строка остается надгробием
+// до тех пор, пока все устройства не узнают об удалении. version 0 - без проверки версии.
+func (r *DatabaseRepository) PurgeSecret(id string, userID int, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	refs, err := queryBlobRefs(tx, `
+		SELECT blob_ref FROM secrets WHERE id = $1 AND user_id = $2 AND blob_ref IS NOT NULL
+		UNION
+		SELECT blob_ref FROM secret_versions WHERE secret_id = $1 AND user_id = $2 AND blob_ref IS NOT NULL
+	`, id, userID)
+	if err != nil {
+		return WrapError(err, "не удалось получить ссылки на бинарные данные")
+	}
+
+	query := `
+		UPDATE secrets
+		SET login = '',
+		    password = '',
+		    text_data = '',
+		    card_data = NULL,
+		    metadata = NULL,
+		    blob_ref = NULL,
+		    blob_size = 0,
+		    blob_checksum = NULL,
+		    deleted_at = COALESCE(deleted_at, NOW()),
+		    purged_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND purged_at IS NULL
+		  AND ($3 = 0 OR version = $3)
+		RETURNING updated_at
+	`
+
+	var updatedAt time.Time
+	if err := tx.QueryRow(query, id, userID, version).Scan(&updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return r.rejectionError(id, userID, version, "purged_at IS NULL")
 		}
+		return WrapError(err, "не удалось окончательно удалить секрет")
 	}
 
-	return &secret, nil
+	if _, err := tx.Exec(`DELETE FROM secret_versions WHERE secret_id = $1`, id); err != nil {
+		return WrapError(err, "не удалось удалить историю версий")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	r.releaseBlobs(refs...)
+
+	return nil
+}
+
+// rejectionError объясняет, почему изменение с проверкой версии не затронуло ни одной строки:
+// секрет в состоянии condition есть, но его версия другая, - или секрета нет
+func (r *DatabaseRepository) rejectionError(id string, userID int, version int, condition string) error {
+	if version == 0 {
+		return ErrSecretNotFound
+	}
+
+	var exists bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM secrets WHERE id = $1 AND user_id = $2 AND `+condition+`)
+	`, id, userID).Scan(&exists)
+	if err != nil {
+		return WrapError(err, "не удалось проверить версию секрета")
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrSecretNotFound
 }
 
-func (r *DatabaseRepository) GetSecretsByUserID(userID int) ([]*Secret, error) {
+// GetChangeSeq возвращает номер последнего изменения секретов пользователя, 0 - изменений не было
+func (r *DatabaseRepository) GetChangeSeq(userID int) (int64, error) {
+	var seq int64
+	err := r.db.QueryRow(`SELECT last_seq FROM sync_counters WHERE user_id = $1`, userID).Scan(&seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, WrapError(err, "не удалось получить номер последнего изменения")
+	}
+	return seq, nil
+}
+
+// FolderExists проверяет, что у пользователя есть неудаленная папка folderID
+func (r *DatabaseRepository) FolderExists(userID int, folderID string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM folders WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, folderID, userID).Scan(&exists)
+	if err != nil {
+		return false, WrapError(err, "не удалось проверить папку")
+	}
+	return exists, nil
+}
+
+// SaveDeviceSync запоминает, до какого номера изменения устройство получило данные
+func (r *DatabaseRepository) SaveDeviceSync(userID int, deviceID string, syncedSeq int64) error {
 	query := `
-		SELECT id, user_id, login, password, metadata, binary_data, version,
-		       created_at, updated_at, deleted_at
-		FROM secrets
-		WHERE user_id = $1 AND deleted_at IS NULL
-		ORDER BY created_at DESC
+		INSERT INTO sync_devices (user_id, device_id, last_synced_seq, last_synced_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (user_id, device_id)
+		DO UPDATE SET last_synced_seq = EXCLUDED.last_synced_seq, last_synced_at = NOW(), updated_at = NOW()
+	`
+
+	if _, err := r.db.Exec(query, userID, deviceID, syncedSeq); err != nil {
+		return WrapError(err, "не удалось сохранить позицию синхронизации устройства")
+	}
+
+	return nil
+}
+
+// DeleteStaleDevices забывает устройства, которые давно не синхронизировались,
+// чтобы они не удерживали надгробия бесконечно
+func (r *DatabaseRepository) DeleteStaleDevices(seenBefore time.Time) (int64, error) {
+	result, err := r.db.Exec(`DELETE FROM sync_devices WHERE updated_at < $1`, seenBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить неактивные устройства")
+	}
+
+	return result.RowsAffected()
+}
+
+// PurgeTombstones физически удаляет надгробия старше deletedBefore (окончательно удаленные -
+// сразу), если все устройства владельца и получателей доступа уже получили удаление.
+// Так же удаляются отозванные доступы и надгробия доступов удаленных аккаунтов.
+func (r *DatabaseRepository) PurgeTombstones(deletedBefore time.Time) (int64, error) {
+	condition := `
+		s.deleted_at IS NOT NULL
+		  AND (s.purged_at IS NOT NULL OR s.deleted_at < $1)
+		  AND NOT EXISTS (
+		      SELECT 1 FROM sync_devices d
+		      WHERE d.user_id = s.user_id AND d.last_synced_seq < s.change_seq
+		  )
+		  AND NOT EXISTS (
+		      SELECT 1 FROM secret_shares sh JOIN sync_devices d ON d.user_id = sh.grantee_user_id
+		      WHERE sh.secret_id = s.id AND sh.revoked_at IS NULL AND d.last_synced_seq < sh.change_seq
+		  )
 	`
 
-	rows, err := r.db.Query(query, userID)
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	// Ссылки собираются до удаления: история версий уходит каскадом вместе с секретом
+	refs, err := queryBlobRefs(tx, `
+		SELECT s.blob_ref FROM secrets s WHERE `+condition+` AND s.blob_ref IS NOT NULL
+		UNION
+		SELECT v.blob_ref FROM secret_versions v JOIN secrets s ON s.id = v.secret_id
+		WHERE `+condition+` AND v.blob_ref IS NOT NULL
+	`, deletedBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось получить ссылки на бинарные данные")
+	}
+
+	result, err := tx.Exec(`DELETE FROM secrets s WHERE `+condition, deletedBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось очистить корзину")
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, WrapError(err, "не удалось получить число удаленных секретов")
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM secret_shares sh
+		WHERE sh.revoked_at IS NOT NULL AND sh.revoked_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM sync_devices d
+		      WHERE d.user_id = sh.grantee_user_id AND d.last_synced_seq < sh.change_seq
+		  )
+	`, deletedBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить отозванные доступы")
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM share_tombstones t
+		WHERE t.revoked_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM sync_devices d
+		      WHERE d.user_id = t.grantee_user_id AND d.last_synced_seq < t.change_seq
+		  )
+	`, deletedBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить надгробия доступов удаленных аккаунтов")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	r.releaseBlobs(refs...)
+
+	return deleted, nil
+}
+
+// ExportSecrets передает fn секреты пользователя, включая корзину, по одному по мере чтения
+// строк, чтобы выгрузка не держала все секреты в памяти. Бинарные данные не загружаются.
+// Соединение с базой занято, пока fn не обработает последний секрет.
+func (r *DatabaseRepository) ExportSecrets(userID int, fn func(*Secret) error) error {
+	rows, err := r.db.Query(`
+		SELECT `+secretColumns+`
+		FROM secrets
+		WHERE user_id = $1 AND purged_at IS NULL
+		ORDER BY created_at DESC, id
+	`, userID)
 	if err != nil {
-		return nil, WrapError(err, "не удалось получить секреты")
+		return WrapError(err, "не удалось получить секреты")
 	}
 	defer rows.Close()
 
-	var secrets []*Secret
 	for rows.Next() {
-		var secret Secret
-		var metadataJSON []byte
+		secret, err := scanSecret(rows)
+		if err != nil {
+			return WrapError(err, "не удалось прочитать секрет")
+		}
+		if err := fn(secret); err != nil {
+			return err
+		}
+	}
 
-		err := rows.Scan(
-			&secret.ID,
-			&secret.UserID,
-			&secret.Login,
-			&secret.Password,
-			&metadataJSON,
-			&secret.BinaryData,
-			&secret.Version,
-			&secret.CreatedAt,
-			&secret.UpdatedAt,
-			&secret.DeletedAt,
-		)
+	if err := rows.Err(); err != nil {
+		return WrapError(err, "ошибка при чтении секретов")
+	}
 
-		if err != nil {
-			return nil, WrapError(err, "не удалось прочитать секрет")
+	return nil
+}
+
+// GetBlobInfo возвращает размер бинарных данных секрета без чтения самих данных
+func (r *DatabaseRepository) GetBlobInfo(id string, userID int) (*BlobInfo, error) {
+	query := `
+		SELECT id, user_id, type, version, blob_size, COALESCE(blob_checksum, ''), updated_at, COALESCE(blob_ref, '')
+		FROM secrets
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+
+	var info BlobInfo
+	err := r.db.QueryRow(query, id, userID).Scan(
+		&info.SecretID,
+		&info.UserID,
+		&info.Type,
+		&info.Version,
+		&info.Size,
+		&info.Checksum,
+		&info.UpdatedAt,
+		&info.Ref,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSecretNotFound
 		}
+		return nil, WrapError(err, "не удалось получить сведения о бинарных данных")
+	}
 
-		if metadataJSON != nil {
-			if err := json.Unmarshal(metadataJSON, &secret.Metadata); err != nil {
-				return nil, WrapError(err, "не удалось десериализовать metadata")
-			}
+	return &info, nil
+}
+
+// ReadBlob читает length байт объекта ref начиная с offset. Ссылка берется из GetBlobInfo
+// один раз на запрос: если секрет тем временем получит новые данные, чтение не перескочит
+// на другой объект, а завершится ошибкой, когда старый объект освободят.
+func (r *DatabaseRepository) ReadBlob(ref string, offset, length int64) ([]byte, error) {
+	if ref == "" {
+		return []byte{}, nil
+	}
+
+	data, err := r.blobs.ReadRange(ref, offset, length)
+	if err != nil {
+		return nil, WrapError(err, "не удалось прочитать бинарные данные")
+	}
+
+	return data, nil
+}
+
+// WriteBlob заменяет бинарные данные секрета содержимым r. Данные сначала целиком пишутся
+// в хранилище, затем одним запросом переключается ссылка и увеличивается версия, чтобы
+// триггер истории сохранил уже полный файл.
+func (r *DatabaseRepository) WriteBlob(id string, userID int, version int, reader io.Reader) (*BlobInfo, error) {
+	blob, err := r.putBlob(userID, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	info, previousRef, err := r.switchBlob(id, userID, version, blob)
+	if err != nil {
+		r.releaseBlobs(blob.ref)
+		return nil, err
+	}
+
+	r.releaseBlobs(previousRef)
+
+	return info, nil
+}
+
+// switchBlob проверяет версию и переключает секрет на новый объект. Возвращает прежнюю ссылку.
+func (r *DatabaseRepository) switchBlob(id string, userID int, version int, blob *storedBlob) (*BlobInfo, string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, "", WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	var currentVersion int
+	var previousRef sql.NullString
+	err = tx.QueryRow(`
+		SELECT version, blob_ref FROM secrets
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id, userID).Scan(&currentVersion, &previousRef)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrSecretNotFound
 		}
+		return nil, "", WrapError(err, "не удалось заблокировать секрет")
+	}
+	if currentVersion != version {
+		return nil, "", ErrVersionConflict
+	}
 
-		secrets = append(secrets, &secret)
+	info := BlobInfo{SecretID: id, UserID: userID, Checksum: blob.checksum}
+	err = tx.QueryRow(`
+		UPDATE secrets
+		SET blob_ref = $2, blob_size = $3, blob_checksum = $4, version = version + 1
+		WHERE id = $1
+		RETURNING type, version, blob_size, updated_at
+	`, id, nullString(blob.ref), blob.size, nullString(blob.checksum)).Scan(&info.Type, &info.Version, &info.Size, &info.UpdatedAt)
+	if err != nil {
+		return nil, "", WrapError(err, "не удалось обновить версию секрета")
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, WrapError(err, "ошибка при чтении секретов")
+	if err := tx.Commit(); err != nil {
+		return nil, "", WrapError(err, "не удалось зафиксировать транзакцию")
 	}
 
-	return secrets, nil
+	return &info, previousRef.String, nil
 }
 
-func (r *DatabaseRepository) GetSecretsModifiedSince(userID int, since time.Time) ([]*Secret, error) {
+// GetSecretVersions возвращает историю без содержимого секрета, от новых версий к старым
+func (r *DatabaseRepository) GetSecretVersions(secretID string, userID int) ([]*SecretVersion, error) {
 	query := `
-		SELECT id, user_id, login, password, metadata, binary_data, version,
-		       created_at, updated_at, deleted_at
-		FROM secrets
-		WHERE user_id = $1 
-		  AND (
-		      created_at >= $2 
-		      OR updated_at >= $2 
-		      OR (deleted_at IS NOT NULL AND deleted_at >= $2)
-		  )
-		ORDER BY updated_at ASC
+		SELECT secret_id, user_id, version, type, metadata, blob_size, created_at
+		FROM secret_versions
+		WHERE secret_id = $1 AND user_id = $2
+		ORDER BY version DESC
 	`
 
-	rows, err := r.db.Query(query, userID, since)
+	rows, err := r.db.Query(query, secretID, userID)
 	if err != nil {
-		return nil, WrapError(err, "не удалось получить измененные секреты")
+		return nil, WrapError(err, "не удалось получить историю версий")
 	}
 	defer rows.Close()
 
-	var secrets []*Secret
+	var versions []*SecretVersion
 	for rows.Next() {
-		var secret Secret
+		var version SecretVersion
 		var metadataJSON []byte
 
 		err := rows.Scan(
-			&secret.ID,
-			&secret.UserID,
-			&secret.Login,
-			&secret.Password,
+			&version.SecretID,
+			&version.UserID,
+			&version.Version,
+			&version.Type,
 			&metadataJSON,
-			&secret.BinaryData,
-			&secret.Version,
-			&secret.CreatedAt,
-			&secret.UpdatedAt,
-			&secret.DeletedAt,
+			&version.BinaryDataSize,
+			&version.CreatedAt,
 		)
-
 		if err != nil {
-			return nil, WrapError(err, "не удалось прочитать секрет")
+			return nil, WrapError(err, "не удалось прочитать версию секрета")
 		}
 
 		if metadataJSON != nil {
-			if err := json.Unmarshal(metadataJSON, &secret.Metadata); err != nil {
+			if err := json.Unmarshal(metadataJSON, &version.Metadata); err != nil {
 				return nil, WrapError(err, "не удалось десериализовать metadata")
 			}
 		}
 
-		secrets = append(secrets, &secret)
+		versions = append(versions, &version)
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, WrapError(err, "ошибка при чтении измененных секретов")
+		return nil, WrapError(err, "ошибка при чтении истории версий")
 	}
 
-	return secrets, nil
+	return versions, nil
 }
 
-func (r *DatabaseRepository) UpdateSecret(secret *Secret) error {
-	var metadataJSON []byte
-	var err error
-	if secret.Metadata != nil {
-		metadataJSON, err = json.Marshal(secret.Metadata)
+func (r *DatabaseRepository) GetSecretVersion(secretID string, userID int, version int) (*SecretVersion, error) {
+	query := `
+		SELECT secret_id, user_id, version, type, login, password, text_data, card_data,
+		       metadata, blob_ref, blob_size, created_at
+		FROM secret_versions
+		WHERE secret_id = $1 AND user_id = $2 AND version = $3
+	`
+
+	var v SecretVersion
+	var cardJSON, metadataJSON []byte
+	var ref sql.NullString
+
+	err := r.db.QueryRow(query, secretID, userID, version).Scan(
+		&v.SecretID,
+		&v.UserID,
+		&v.Version,
+		&v.Type,
+		&v.Login,
+		&v.Password,
+		&v.Text,
+		&cardJSON,
+		&metadataJSON,
+		&ref,
+		&v.BinaryDataSize,
+		&v.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, WrapError(err, "не удалось получить версию секрета")
+	}
+
+	if cardJSON != nil {
+		if err := json.Unmarshal(cardJSON, &v.Card); err != nil {
+			return nil, WrapError(err, "не удалось десериализовать данные карты")
+		}
+	}
+
+	if metadataJSON != nil {
+		if err := json.Unmarshal(metadataJSON, &v.Metadata); err != nil {
+			return nil, WrapError(err, "не удалось десериализовать metadata")
+		}
+	}
+
+	if v.BinaryData, err = r.readBlob(ref.String); err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// PruneSecretVersions оставляет в истории только keep последних версий
+func (r *DatabaseRepository) PruneSecretVersions(secretID string, keep int) error {
+	query := `
+		DELETE FROM secret_versions
+		WHERE secret_id = $1
+		  AND version NOT IN (
+		      SELECT version FROM secret_versions
+		      WHERE secret_id = $1
+		      ORDER BY version DESC
+		      LIMIT $2
+		  )
+		RETURNING blob_ref
+	`
+
+	refs, err := queryBlobRefs(r.db, query, secretID, keep)
+	if err != nil {
+		return WrapError(err, "не удалось очистить историю версий")
+	}
+
+	r.releaseBlobs(refs...)
+
+	return nil
+}
+
+// Метки секрета читаются одной строкой через запятую: ID меток - UUID и запятых не содержат
+const secretColumns = `id, user_id, type, login, password, text_data, card_data, metadata,
+		       blob_ref, blob_size, blob_checksum, folder_id, version, change_seq, created_at, updated_at, deleted_at,
+		       (SELECT string_agg(st.tag_id::text, ',' ORDER BY st.tag_id) FROM secret_tags st WHERE st.secret_id = secrets.id)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSecret читает колонки secretColumns и следом за ними - колонки в extra
+func scanSecret(row rowScanner, extra ...interface{}) (*Secret, error) {
+	var secret Secret
+	var cardJSON, metadataJSON []byte
+	var blobRef, blobChecksum, folderID, tags sql.NullString
+
+	dest := []interface{}{
+		&secret.ID,
+		&secret.UserID,
+		&secret.Type,
+		&secret.Login,
+		&secret.Password,
+		&secret.Text,
+		&cardJSON,
+		&metadataJSON,
+		&blobRef,
+		&secret.BlobSize,
+		&blobChecksum,
+		&folderID,
+		&secret.Version,
+		&secret.ChangeSeq,
+		&secret.CreatedAt,
+		&secret.UpdatedAt,
+		&secret.DeletedAt,
+		&tags,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	secret.BlobRef = blobRef.String
+	secret.BlobChecksum = blobChecksum.String
+	secret.FolderID = folderID.String
+	secret.Tags = splitTags(tags)
+
+	if cardJSON != nil {
+		if err := json.Unmarshal(cardJSON, &secret.Card); err != nil {
+			return nil, WrapError(err, "не удалось десериализовать данные карты")
+		}
+	}
+
+	if metadataJSON != nil {
+		if err := json.Unmarshal(metadataJSON, &secret.Metadata); err != nil {
+			return nil, WrapError(err, "не удалось десериализовать metadata")
+		}
+	}
+
+	return &secret, nil
+}
+
+func (r *DatabaseRepository) querySecrets(query string, args ...interface{}) ([]*Secret, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSecrets(rows, func(row rowScanner) (*Secret, error) { return scanSecret(row) })
+}
+
+// scanSecrets читает строки секретов без бинарных данных
+func scanSecrets(rows *sql.Rows, scan func(rowScanner) (*Secret, error)) ([]*Secret, error) {
+	var secrets []*Secret
+	for rows.Next() {
+		secret, err := scan(rows)
 		if err != nil {
-			return WrapError(err, "не удалось сериализовать metadata")
+			return nil, WrapError(err, "не удалось прочитать секрет")
 		}
+		secrets = append(secrets, secret)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, WrapError(err, "ошибка при чтении секретов")
+	}
+
+	return secrets, nil
+}
+
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// insertSecret записывает новый секрет. Бинарные данные к этому моменту уже лежат в хранилище.
+// Пустой secret.ID назначает база; sql.ErrNoRows - секрет с таким ID уже существует.
+// Секрет из несуществующей или удаленной папки попадает в корень.
+func insertSecret(q rowQuerier, secret *Secret) error {
+	metadataJSON, cardJSON, err := marshalSecretJSON(secret)
+	if err != nil {
+		return err
 	}
 
 	query := `
-		UPDATE secrets
-		SET login = $1, 
-		    password = $2, 
-		    metadata = $3, 
-		    binary_data = $4, 
-		    version = $5
-		WHERE id = $6 
-		  AND user_id = $7 
-		  AND version = $8 
-		  AND deleted_at IS NULL
-		RETURNING updated_at
+		INSERT INTO secrets (id, user_id, type, login, password, text_data, card_data, metadata,
+		                     blob_ref, blob_size, blob_checksum, version, folder_id)
+		VALUES (COALESCE($1::uuid, uuid_generate_v4()), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12,
+		        (SELECT f.id FROM folders f WHERE f.id = $13::uuid AND f.user_id = $2 AND f.deleted_at IS NULL))
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id, folder_id, created_at, updated_at
+	`
+
+	var folderID sql.NullString
+	err = q.QueryRow(
+		query,
+		nullString(secret.ID),
+		secret.UserID,
+		secret.Type,
+		secret.Login,
+		secret.Password,
+		secret.Text,
+		cardJSON,
+		metadataJSON,
+		nullString(secret.BlobRef),
+		secret.BlobSize,
+		nullString(secret.BlobChecksum),
+		secret.Version,
+		nullString(secret.FolderID),
+	).Scan(&secret.ID, &folderID, &secret.CreatedAt, &secret.UpdatedAt)
+	secret.FolderID = folderID.String
+	return err
+}
+
+// updateSecretRow записывает содержимое секрета, если его версия все еще secret.Version, и
+// увеличивает версию. Возвращает ссылку на замененные бинарные данные; sql.ErrNoRows -
+// секрет не найден, удален или изменен другим устройством.
+func updateSecretRow(q rowQuerier, secret *Secret) (string, error) {
+	metadataJSON, cardJSON, err := marshalSecretJSON(secret)
+	if err != nil {
+		return "", err
+	}
+
+	// previous нужен, чтобы узнать ссылку, которую заменяет обновление
+	query := `
+		WITH previous AS (
+		    SELECT id, blob_ref FROM secrets WHERE id = $11 AND user_id = $12 FOR UPDATE
+		)
+		UPDATE secrets s
+		SET type = $1,
+		    login = $2, 
+		    password = $3, 
+		    text_data = $4,
+		    card_data = $5,
+		    metadata = $6, 
+		    blob_ref = $7,
+		    blob_size = $8,
+		    blob_checksum = $9,
+		    version = $10
+		FROM previous p
+		WHERE s.id = p.id
+		  AND s.version = $13 
+		  AND s.deleted_at IS NULL
+		RETURNING s.updated_at, s.folder_id, p.blob_ref,
+		          (SELECT string_agg(st.tag_id::text, ',' ORDER BY st.tag_id) FROM secret_tags st WHERE st.secret_id = s.id)
 	`
 
-	err = r.db.QueryRow(
+	var previousRef, folderID, tags sql.NullString
+	err = q.QueryRow(
 		query,
+		secret.Type,
 		secret.Login,
 		secret.Password,
+		secret.Text,
+		cardJSON,
 		metadataJSON,
-		secret.BinaryData,
+		nullString(secret.BlobRef),
+		secret.BlobSize,
+		nullString(secret.BlobChecksum),
 		secret.Version+1,
 		secret.ID,
 		secret.UserID,
 		secret.Version,
-	).Scan(&secret.UpdatedAt)
-
+	).Scan(&secret.UpdatedAt, &folderID, &previousRef, &tags)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrVersionConflict
-		}
-		return WrapError(err, "не удалось обновить секрет")
+		return "", err
 	}
 
 	secret.Version++
-
-	return nil
+	secret.FolderID = folderID.String
+	secret.Tags = splitTags(tags)
+	return previousRef.String, nil
 }
 
-func (r *DatabaseRepository) SoftDeleteSecret(id string, userID int) error {
+// softDeleteSecretRow переносит секрет в корзину. version 0 - без проверки версии;
+// sql.ErrNoRows - секрет не найден, уже удален или его версия другая.
+func softDeleteSecretRow(q rowQuerier, id string, userID int, version int) error {
 	query := `
 		UPDATE secrets
 		SET deleted_at = NOW()
 		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		  AND ($3 = 0 OR version = $3)
 		RETURNING updated_at
 	`
 
 	var updatedAt time.Time
-	err := r.db.QueryRow(query, id, userID).Scan(&updatedAt)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrSecretNotFound
+	return q.QueryRow(query, id, userID, version).Scan(&updatedAt)
+}
+
+func marshalSecretJSON(secret *Secret) (metadataJSON, cardJSON []byte, err error) {
+	if secret.Metadata != nil {
+		metadataJSON, err = json.Marshal(secret.Metadata)
+		if err != nil {
+			return nil, nil, WrapError(err, "не удалось сериализовать metadata")
 		}
-		return WrapError(err, "не удалось удалить секрет")
 	}
 
-	return nil
+	if secret.Card != nil {
+		cardJSON, err = json.Marshal(secret.Card)
+		if err != nil {
+			return nil, nil, WrapError(err, "не удалось сериализовать данные карты")
+		}
+	}
+
+	return metadataJSON, cardJSON, nil
+}
+
+// splitTags разбирает метки секрета из string_agg
+func splitTags(tags sql.NullString) []string {
+	if tags.String == "" {
+		return nil
+	}
+	return strings.Split(tags.String, ",")
+}
+
+func countUnique(values []string) int {
+	unique := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		unique[value] = struct{}{}
+	}
+	return len(unique)
 }
@@ -0,0 +1,264 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/google/uuid"
+)
+
+// storedBlob - объект, записанный в BlobStore. Пустые данные объекта не создают: ref пустой.
+type storedBlob struct {
+	ref      string
+	size     int64
+	checksum string
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+type blobQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// putBlob записывает содержимое reader новым объектом, считая по пути размер и SHA-256
+func (r *DatabaseRepository) putBlob(userID int, reader io.Reader) (*storedBlob, error) {
+	hash := sha256.New()
+	counter := &countingWriter{}
+	key := fmt.Sprintf("%d/%s", userID, uuid.NewString())
+
+	if err := r.blobs.Put(key, io.TeeReader(reader, io.MultiWriter(hash, counter))); err != nil {
+		return nil, WrapError(err, "не удалось сохранить бинарные данные")
+	}
+
+	if counter.n == 0 {
+		r.releaseBlobs(key)
+		return &storedBlob{}, nil
+	}
+
+	return &storedBlob{
+		ref:      key,
+		size:     counter.n,
+		checksum: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// storeBinaryData сохраняет secret.BinaryData (или поток secret.BinaryReader) в хранилище
+// и заполняет BlobRef, BlobSize и BlobChecksum. Неизменившиеся данные повторно не загружаются.
+// Возвращает ключ созданного объекта, который нужно освободить, если запись в базу не удастся.
+func (r *DatabaseRepository) storeBinaryData(secret *Secret) (string, error) {
+	if secret.BinaryReader != nil {
+		blob, err := r.putBlob(secret.UserID, secret.BinaryReader)
+		if err != nil {
+			return "", err
+		}
+		secret.BinaryReader = nil
+		secret.BlobRef, secret.BlobSize, secret.BlobChecksum = blob.ref, blob.size, blob.checksum
+		return blob.ref, nil
+	}
+
+	if len(secret.BinaryData) == 0 {
+		secret.BlobRef, secret.BlobSize, secret.BlobChecksum = "", 0, ""
+		return "", nil
+	}
+
+	if secret.BlobRef != "" && secret.BlobChecksum == blobChecksum(secret.BinaryData) {
+		return "", nil
+	}
+
+	blob, err := r.putBlob(secret.UserID, bytes.NewReader(secret.BinaryData))
+	if err != nil {
+		return "", err
+	}
+
+	secret.BlobRef, secret.BlobSize, secret.BlobChecksum = blob.ref, blob.size, blob.checksum
+	return blob.ref, nil
+}
+
+// LoadBinaryData читает бинарные данные секрета из хранилища целиком. Нужен только там, где
+// работают с одним секретом; списки отдают размер и контрольную сумму, а данные клиент
+// скачивает через GET /secrets/{id}/blob.
+func (r *DatabaseRepository) LoadBinaryData(secret *Secret) error {
+	data, err := r.readBlob(secret.BlobRef)
+	if err != nil {
+		return err
+	}
+	secret.BinaryData = data
+	return nil
+}
+
+// OpenBlob открывает объект ref для чтения целиком, не загружая его в память
+func (r *DatabaseRepository) OpenBlob(ref string) (io.ReadCloser, error) {
+	rc, err := r.blobs.Get(ref)
+	if err != nil {
+		return nil, WrapError(err, "не удалось открыть бинарные данные")
+	}
+	return rc, nil
+}
+
+func (r *DatabaseRepository) readBlob(ref string) ([]byte, error) {
+	if ref == "" {
+		return nil, nil
+	}
+
+	rc, err := r.blobs.Get(ref)
+	if err != nil {
+		return nil, WrapError(err, "не удалось открыть бинарные данные")
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, WrapError(err, "не удалось прочитать бинарные данные")
+	}
+
+	return data, nil
+}
+
+// ReleaseBlobs освобождает объекты секретов, удаленных в обход репозитория, - при удалении аккаунта
+func (r *DatabaseRepository) ReleaseBlobs(refs ...string) {
+	r.releaseBlobs(refs...)
+}
+
+// releaseBlobs удаляет объекты, на которые больше не ссылаются ни секреты, ни их история.
+// Изменение в базе к этому моменту уже зафиксировано, поэтому ошибки только логируются:
+// в худшем случае в хранилище останется лишний объект.
+func (r *DatabaseRepository) releaseBlobs(refs ...string) {
+	for _, ref := range refs {
+		if ref == "" {
+			continue
+		}
+
+		var used bool
+		err := r.db.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM secrets WHERE blob_ref = $1)
+			    OR EXISTS (SELECT 1 FROM secret_versions WHERE blob_ref = $1)
+		`, ref).Scan(&used)
+		if err == nil && !used {
+			err = r.blobs.Delete(ref)
+		}
+		if err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"blob_ref": ref,
+				"error":    err.Error(),
+			}).Warn("[Secret] Не удалось освободить бинарные данные")
+		}
+	}
+}
+
+func queryBlobRefs(q blobQuerier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refs []string
+	for rows.Next() {
+		var ref sql.NullString
+		if err := rows.Scan(&ref); err != nil {
+			return nil, err
+		}
+		if ref.Valid {
+			refs = append(refs, ref.String)
+		}
+	}
+
+	return refs, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// MigrateBinaryData переносит данные, оставшиеся в колонке binary_data со времен хранения файлов
+// в базе, в BlobStore. Одинаковые данные одного секрета (текущая версия и история) попадают
+// в один объект. Перенесенные строки повторно не обрабатываются, поэтому перенос можно прервать
+// и запустить снова. Возвращает число перенесенных строк.
+func (r *DatabaseRepository) MigrateBinaryData() (int64, error) {
+	tables := []struct {
+		name           string
+		secretIDColumn string
+	}{
+		{name: "secrets", secretIDColumn: "id"},
+		{name: "secret_versions", secretIDColumn: "secret_id"},
+	}
+
+	var migrated int64
+	for _, table := range tables {
+		for {
+			var rowID interface{}
+			var secretID string
+			var userID int
+			var data []byte
+
+			err := r.db.QueryRow(`
+				SELECT id, `+table.secretIDColumn+`, user_id, binary_data
+				FROM `+table.name+`
+				WHERE binary_data IS NOT NULL
+				LIMIT 1
+			`).Scan(&rowID, &secretID, &userID, &data)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				return migrated, WrapError(err, "не удалось получить бинарные данные для переноса")
+			}
+
+			blob, err := r.migrateBlob(secretID, userID, data)
+			if err != nil {
+				return migrated, err
+			}
+
+			_, err = r.db.Exec(`
+				UPDATE `+table.name+`
+				SET blob_ref = $2, blob_size = $3, blob_checksum = $4, binary_data = NULL
+				WHERE id = $1
+			`, rowID, nullString(blob.ref), blob.size, nullString(blob.checksum))
+			if err != nil {
+				r.releaseBlobs(blob.ref)
+				return migrated, WrapError(err, "не удалось сохранить ссылку на бинарные данные")
+			}
+
+			migrated++
+		}
+	}
+
+	return migrated, nil
+}
+
+func (r *DatabaseRepository) migrateBlob(secretID string, userID int, data []byte) (*storedBlob, error) {
+	if len(data) == 0 {
+		return &storedBlob{}, nil
+	}
+
+	checksum := blobChecksum(data)
+
+	var ref string
+	err := r.db.QueryRow(`
+		SELECT blob_ref FROM secrets WHERE id = $1 AND blob_checksum = $2 AND blob_ref IS NOT NULL
+		UNION ALL
+		SELECT blob_ref FROM secret_versions WHERE secret_id = $1 AND blob_checksum = $2 AND blob_ref IS NOT NULL
+		LIMIT 1
+	`, secretID, checksum).Scan(&ref)
+	if err == nil {
+		return &storedBlob{ref: ref, size: int64(len(data)), checksum: checksum}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, WrapError(err, "не удалось найти перенесенные бинарные данные")
+	}
+
+	return r.putBlob(userID, bytes.NewReader(data))
+}
@@ -0,0 +1,195 @@
+package secret
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// ApplyChanges применяет пакет изменений в одной транзакции. Конфликт или отсутствие
+// секрета не прерывают пакет: они попадают в результат операции, а остальные операции
+// применяются. Ошибка базы откатывает весь пакет.
+func (r *DatabaseRepository) ApplyChanges(userID int, changes []*SecretChange) ([]*PushResult, error) {
+	// Бинарные данные загружаются в хранилище до транзакции, чтобы не держать блокировки
+	var created []string
+	for _, change := range changes {
+		change.Secret.UserID = userID
+		if change.Action == PushDelete {
+			continue
+		}
+		if change.Action == PushUpdate {
+			// Данные чужого секрета хранятся под владельцем. Доступ здесь только определяет
+			// владельца, окончательно он проверяется в транзакции.
+			if ownerID, _, err := secretWriteAccess(r.db, change.Secret.ID, userID); err == nil {
+				change.Secret.UserID = ownerID
+			}
+			r.reuseCurrentBlob(change.Secret)
+		}
+		ref, err := r.storeBinaryData(change.Secret)
+		if err != nil {
+			r.releaseBlobs(created...)
+			return nil, err
+		}
+		created = append(created, ref)
+	}
+
+	results, replaced, err := r.applyChangesTx(userID, changes)
+	if err != nil {
+		r.releaseBlobs(created...)
+		return nil, err
+	}
+
+	// Объекты операций с конфликтом никуда не записаны и освобождаются вместе с замененными
+	r.releaseBlobs(append(replaced, created...)...)
+
+	return results, nil
+}
+
+func (r *DatabaseRepository) applyChangesTx(userID int, changes []*SecretChange) ([]*PushResult, []string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, nil, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	results := make([]*PushResult, len(changes))
+	var replaced []string
+
+	for i, change := range changes {
+		secret := change.Secret
+
+		switch change.Action {
+		case PushCreate:
+			err = insertSecret(tx, secret)
+
+		case PushUpdate:
+			var access *ShareAccess
+			access, err = r.checkWriteAccess(tx, secret, userID)
+			if errors.Is(err, ErrForbidden) {
+				results[i] = &PushResult{Status: PushInvalid, Err: err}
+				continue
+			}
+			var previousRef string
+			if err == nil {
+				previousRef, err = updateSecretRow(tx, secret)
+			}
+			if err == nil {
+				if previousRef != secret.BlobRef {
+					replaced = append(replaced, previousRef)
+				}
+				if access != nil {
+					secret.applyShare(access)
+				}
+			}
+
+		case PushDelete:
+			err = softDeleteSecretRow(tx, secret.ID, userID, secret.Version)
+		}
+
+		if err == nil {
+			results[i] = &PushResult{Status: PushApplied, Secret: secret}
+			if change.Action == PushDelete {
+				results[i].Secret = nil
+			}
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, WrapError(err, "не удалось применить изменение")
+		}
+
+		results[i], err = r.rejectedChange(tx, secret.ID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		// Секрет с ID из create уже есть: скорее всего, это повтор уже примененной операции
+		case change.Action == PushCreate:
+			results[i].Status = PushConflict
+		// Удалять чужой секрет может только владелец
+		case change.Action == PushDelete && results[i].Secret != nil && results[i].Secret.Share != nil:
+			results[i] = &PushResult{Status: PushInvalid, Err: ErrForbidden}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return results, replaced, nil
+}
+
+// rejectedChange объясняет, почему изменение не применилось: секрета нет (или он в корзине)
+// либо его версия на сервере уже другая - тогда клиент получает текущую копию без бинарных данных.
+// Чужой секрет с действующим доступом возвращается так же, как в синхронизации.
+func (r *DatabaseRepository) rejectedChange(tx *sql.Tx, id string, userID int) (*PushResult, error) {
+	current, err := scanVisibleSecret(tx.QueryRow(`
+		SELECT `+secretColumns+`, `+shareColumns+`
+		FROM secrets`+shareJoin+`
+		WHERE id = $2 AND `+visibleToUser+` AND deleted_at IS NULL
+	`, userID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return &PushResult{Status: PushNotFound}, nil
+	}
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить текущую версию секрета")
+	}
+
+	return &PushResult{Status: PushConflict, Secret: current}, nil
+}
+
+// checkWriteAccess проверяет в транзакции, что пользователь может менять секрет: свой или чужой
+// с доступом на запись. Возвращает доступ к чужому секрету (nil для своего); sql.ErrNoRows -
+// секрет пользователю не виден, ErrForbidden - доступ только на чтение.
+func (r *DatabaseRepository) checkWriteAccess(tx *sql.Tx, secret *Secret, userID int) (*ShareAccess, error) {
+	ownerID, access, err := secretWriteAccess(tx, secret.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !access.CanWrite() {
+		return nil, ErrForbidden
+	}
+	// Доступ выдали после того, как ApplyChanges сохранил данные под пользователем:
+	// изменение не применяется, клиент получит конфликт и повторит его
+	if ownerID != secret.UserID {
+		return nil, sql.ErrNoRows
+	}
+	return access, nil
+}
+
+// secretWriteAccess возвращает владельца секрета, видимого пользователю, и доступ пользователя
+// к нему (nil - секрет свой)
+func secretWriteAccess(q rowQuerier, id string, userID int) (int, *ShareAccess, error) {
+	var ownerID int
+	var permission, wrappedKey, ownerEmail sql.NullString
+	err := q.QueryRow(`
+		SELECT user_id, share_permission, share_wrapped_key, share_owner_email
+		FROM secrets`+shareJoin+`
+		WHERE id = $2 AND `+visibleToUser+`
+	`, userID, id).Scan(&ownerID, &permission, &wrappedKey, &ownerEmail)
+	if err != nil {
+		return 0, nil, err
+	}
+	if ownerID == userID || !permission.Valid {
+		return ownerID, nil, nil
+	}
+
+	return ownerID, &ShareAccess{
+		OwnerEmail: ownerEmail.String,
+		Permission: SharePermission(permission.String),
+		WrappedKey: wrappedKey.String,
+	}, nil
+}
+
+// reuseCurrentBlob подставляет ссылку на текущие бинарные данные секрета, чтобы storeBinaryData
+// не загружал их повторно, если они не изменились. Ссылка берется, только если версия совпадает
+// с базовой: иначе обновление все равно закончится конфликтом.
+func (r *DatabaseRepository) reuseCurrentBlob(secret *Secret) {
+	var ref, checksum sql.NullString
+	var size int64
+	err := r.db.QueryRow(`
+		SELECT blob_ref, blob_size, blob_checksum FROM secrets
+		WHERE id = $1 AND user_id = $2 AND version = $3
+	`, secret.ID, secret.UserID, secret.Version).Scan(&ref, &size, &checksum)
+	if err == nil {
+		secret.BlobRef, secret.BlobSize, secret.BlobChecksum = ref.String, size, checksum.String
+	}
+}
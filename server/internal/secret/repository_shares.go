@@ -0,0 +1,287 @@
+package secret
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// shareJoin присоединяет к secrets доступ пользователя $1 к чужому секрету, включая отозванный.
+// У своего секрета колонки доступа пустые.
+const shareJoin = `
+		LEFT JOIN LATERAL (
+		    SELECT sh.permission AS share_permission, sh.wrapped_key AS share_wrapped_key,
+		           o.email AS share_owner_email, sh.change_seq AS share_change_seq, sh.revoked_at AS share_revoked_at
+		    FROM secret_shares sh JOIN users o ON o.id = secrets.user_id
+		    WHERE sh.secret_id = secrets.id AND sh.grantee_user_id = $1
+		) share ON TRUE`
+
+const shareColumns = `share_permission, share_wrapped_key, share_owner_email, share_change_seq, share_revoked_at`
+
+// visibleToUser - свой секрет пользователя $1 или чужой с действующим доступом
+const visibleToUser = `(user_id = $1 OR id IN (
+		    SELECT sh.secret_id FROM secret_shares sh WHERE sh.grantee_user_id = $1 AND sh.revoked_at IS NULL
+		))`
+
+const shareSelect = `
+		SELECT sh.secret_id, s.user_id, sh.grantee_user_id, g.email, sh.permission, sh.wrapped_key, sh.created_at, sh.updated_at
+		FROM secret_shares sh
+		JOIN secrets s ON s.id = sh.secret_id
+		JOIN users g ON g.id = sh.grantee_user_id`
+
+// scanVisibleSecret читает колонки secretColumns и shareColumns. Чужой секрет идет под номером
+// изменения из ленты получателя, а после отзыва доступа от него остается только надгробие.
+func scanVisibleSecret(row rowScanner) (*Secret, error) {
+	var permission, wrappedKey, ownerEmail sql.NullString
+	var changeSeq sql.NullInt64
+	var revokedAt sql.NullTime
+
+	secret, err := scanSecret(row, &permission, &wrappedKey, &ownerEmail, &changeSeq, &revokedAt)
+	if err != nil || !permission.Valid {
+		return secret, err
+	}
+
+	if revokedAt.Valid {
+		return &Secret{
+			ID:        secret.ID,
+			UserID:    secret.UserID,
+			Type:      secret.Type,
+			Version:   secret.Version,
+			CreatedAt: secret.CreatedAt,
+			UpdatedAt: revokedAt.Time,
+			DeletedAt: revokedAt,
+			ChangeSeq: changeSeq.Int64,
+		}, nil
+	}
+
+	secret.applyShare(&ShareAccess{
+		OwnerEmail: ownerEmail.String,
+		Permission: SharePermission(permission.String),
+		WrappedKey: wrappedKey.String,
+	})
+	secret.ChangeSeq = changeSeq.Int64
+
+	return secret, nil
+}
+
+// GetSharedSecretChanges возвращает до limit чужих секретов, доступ к которым или сами секреты
+// изменились после номера afterSeq ленты пользователя. Отозванный доступ приходит надгробием,
+// в том числе доступ к секрету удаленного аккаунта.
+func (r *DatabaseRepository) GetSharedSecretChanges(userID int, afterSeq int64, limit int) ([]*Secret, error) {
+	query := `
+		SELECT ` + secretColumns + `, ` + shareColumns + `
+		FROM secrets` + shareJoin + `
+		WHERE id IN (SELECT secret_id FROM secret_shares WHERE grantee_user_id = $1 AND change_seq > $2)
+		ORDER BY share_change_seq ASC
+		LIMIT $3
+	`
+
+	rows, err := r.db.Query(query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить измененные чужие секреты")
+	}
+	defer rows.Close()
+
+	shared, err := scanSecrets(rows, scanVisibleSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstones, err := r.getShareTombstones(userID, afterSeq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ленты нумеруются одним счетчиком получателя: берутся первые limit изменений из обеих
+	shared = append(shared, tombstones...)
+	sort.Slice(shared, func(i, j int) bool { return shared[i].ChangeSeq < shared[j].ChangeSeq })
+	if len(shared) > limit {
+		shared = shared[:limit]
+	}
+
+	return shared, nil
+}
+
+// getShareTombstones возвращает надгробия секретов, которые пропали вместе с удаленным аккаунтом
+// владельца, после номера afterSeq ленты пользователя
+func (r *DatabaseRepository) getShareTombstones(userID int, afterSeq int64, limit int) ([]*Secret, error) {
+	rows, err := r.db.Query(`
+		SELECT secret_id, owner_user_id, type, version, change_seq, created_at, revoked_at
+		FROM share_tombstones
+		WHERE grantee_user_id = $1 AND change_seq > $2
+		ORDER BY change_seq ASC
+		LIMIT $3
+	`, userID, afterSeq, limit)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить надгробия чужих секретов")
+	}
+	defer rows.Close()
+
+	return scanSecrets(rows, func(row rowScanner) (*Secret, error) {
+		var secret Secret
+		if err := row.Scan(&secret.ID, &secret.UserID, &secret.Type, &secret.Version, &secret.ChangeSeq, &secret.CreatedAt, &secret.UpdatedAt); err != nil {
+			return nil, err
+		}
+		secret.DeletedAt = sql.NullTime{Time: secret.UpdatedAt, Valid: true}
+		return &secret, nil
+	})
+}
+
+// GetShare возвращает действующий доступ пользователя granteeID к неудаленному секрету
+func (r *DatabaseRepository) GetShare(secretID string, granteeID int) (*SecretShare, error) {
+	query := shareSelect + `
+		WHERE sh.secret_id = $1 AND sh.grantee_user_id = $2 AND sh.revoked_at IS NULL AND s.deleted_at IS NULL
+	`
+
+	share, err := scanShare(r.db.QueryRow(query, secretID, granteeID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrShareNotFound
+		}
+		return nil, WrapError(err, "не удалось получить доступ к секрету")
+	}
+
+	return share, nil
+}
+
+// GetShareGrantees возвращает пользователей с действующим доступом к секрету
+func (r *DatabaseRepository) GetShareGrantees(secretID string) ([]int, error) {
+	rows, err := r.db.Query(`
+		SELECT grantee_user_id FROM secret_shares
+		WHERE secret_id = $1 AND revoked_at IS NULL
+		ORDER BY grantee_user_id
+	`, secretID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить получателей доступа")
+	}
+	defer rows.Close()
+
+	var grantees []int
+	for rows.Next() {
+		var granteeID int
+		if err := rows.Scan(&granteeID); err != nil {
+			return nil, WrapError(err, "не удалось прочитать получателя доступа")
+		}
+		grantees = append(grantees, granteeID)
+	}
+
+	return grantees, rows.Err()
+}
+
+// ListShares возвращает действующие доступы к секрету владельца ownerID
+func (r *DatabaseRepository) ListShares(secretID string, ownerID int) ([]*SecretShare, error) {
+	var exists bool
+	err := r.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM secrets WHERE id = $1 AND user_id = $2)
+	`, secretID, ownerID).Scan(&exists)
+	if err != nil {
+		return nil, WrapError(err, "не удалось проверить секрет")
+	}
+	if !exists {
+		return nil, ErrSecretNotFound
+	}
+
+	rows, err := r.db.Query(shareSelect+`
+		WHERE sh.secret_id = $1 AND sh.revoked_at IS NULL
+		ORDER BY g.email
+	`, secretID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить доступы к секрету")
+	}
+	defer rows.Close()
+
+	shares := []*SecretShare{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return nil, WrapError(err, "не удалось прочитать доступ к секрету")
+		}
+		shares = append(shares, share)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, WrapError(err, "ошибка при чтении доступов к секрету")
+	}
+
+	return shares, nil
+}
+
+// ShareSecret выдает пользователю с адресом share.GranteeEmail доступ к неудаленному секрету
+// владельца share.OwnerID или заменяет выданный, в том числе отозванный. Заполняет GranteeID и даты.
+func (r *DatabaseRepository) ShareSecret(share *SecretShare) error {
+	err := r.db.QueryRow(`SELECT id FROM users WHERE email = $1`, share.GranteeEmail).Scan(&share.GranteeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrGranteeNotFound
+		}
+		return WrapError(err, "не удалось найти получателя")
+	}
+	if share.GranteeID == share.OwnerID {
+		return ErrShareWithSelf
+	}
+
+	// Повторная выдача после отзыва - новый доступ, поэтому created_at обновляется
+	err = r.db.QueryRow(`
+		INSERT INTO secret_shares (secret_id, grantee_user_id, permission, wrapped_key)
+		SELECT id, $3, $4, $5 FROM secrets
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		ON CONFLICT (secret_id, grantee_user_id) DO UPDATE
+		SET permission = EXCLUDED.permission,
+		    wrapped_key = EXCLUDED.wrapped_key,
+		    created_at = CASE WHEN secret_shares.revoked_at IS NULL THEN secret_shares.created_at ELSE NOW() END,
+		    revoked_at = NULL
+		RETURNING created_at, updated_at
+	`, share.SecretID, share.OwnerID, share.GranteeID, share.Permission, share.WrappedKey).Scan(
+		&share.CreatedAt, &share.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSecretNotFound
+		}
+		return WrapError(err, "не удалось выдать доступ к секрету")
+	}
+
+	return nil
+}
+
+// RevokeShare отзывает доступ granteeID к секрету. Отозвать может владелец секрета или сам
+// получатель. Возвращает владельца секрета.
+func (r *DatabaseRepository) RevokeShare(secretID string, granteeID int, userID int) (int, error) {
+	var ownerID int
+	err := r.db.QueryRow(`
+		UPDATE secret_shares sh
+		SET revoked_at = NOW()
+		FROM secrets s
+		WHERE sh.secret_id = $1 AND sh.grantee_user_id = $2 AND sh.revoked_at IS NULL
+		  AND s.id = sh.secret_id AND (s.user_id = $3 OR sh.grantee_user_id = $3)
+		RETURNING s.user_id
+	`, secretID, granteeID, userID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrShareNotFound
+		}
+		return 0, WrapError(err, "не удалось отозвать доступ к секрету")
+	}
+
+	return ownerID, nil
+}
+
+func scanShare(row rowScanner) (*SecretShare, error) {
+	var share SecretShare
+
+	err := row.Scan(
+		&share.SecretID,
+		&share.OwnerID,
+		&share.GranteeID,
+		&share.GranteeEmail,
+		&share.Permission,
+		&share.WrappedKey,
+		&share.CreatedAt,
+		&share.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
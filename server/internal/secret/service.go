@@ -1,20 +1,42 @@
 package secret
 
 import (
-	"time"
+	"bufio"
+	"errors"
+	"io"
 
+	"github.com/Adigezalov/goph-keeper/internal/folder"
 	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
+	"github.com/google/uuid"
 )
 
 type RealtimeService interface {
 	NotifySecretCreated(userID int, secretID string, excludeSessionID string) error
 	NotifySecretUpdated(userID int, secretID string, excludeSessionID string) error
 	NotifySecretDeleted(userID int, secretID string, excludeSessionID string) error
+	NotifySecretRestored(userID int, secretID string, excludeSessionID string) error
+	NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error
+	NotifySecretShared(userID int, secretID string, excludeSessionID string) error
+	NotifySecretUnshared(userID int, secretID string, excludeSessionID string) error
+}
+
+// FolderFeed - изменения папок. Папки и секреты нумеруются одним счетчиком и идут в одной ленте синхронизации.
+type FolderFeed interface {
+	GetFolderChanges(userID int, afterSeq int64, limit int) ([]*folder.Folder, error)
+}
+
+// TagFeed - изменения меток, нумеруются тем же счетчиком. Назначения меток приходят в Secret.Tags.
+type TagFeed interface {
+	GetTagChanges(userID int, afterSeq int64, limit int) ([]*tag.Tag, error)
 }
 
 type Service struct {
 	repo            Repository
 	realtimeService RealtimeService
+	folderFeed      FolderFeed
+	tagFeed         TagFeed
+	versionsLimit   int
 }
 
 func NewService(repo Repository) *Service {
@@ -27,9 +49,36 @@ func (s *Service) SetRealtimeService(realtimeService RealtimeService) {
 	s.realtimeService = realtimeService
 }
 
+// SetFolderFeed включает папки в ответ синхронизации
+func (s *Service) SetFolderFeed(folderFeed FolderFeed) {
+	s.folderFeed = folderFeed
+}
+
+// SetTagFeed включает метки в ответ синхронизации
+func (s *Service) SetTagFeed(tagFeed TagFeed) {
+	s.tagFeed = tagFeed
+}
+
+// SetVersionsLimit задает, сколько последних версий секрета хранить в истории (0 - без ограничений)
+func (s *Service) SetVersionsLimit(limit int) {
+	s.versionsLimit = limit
+}
+
+const (
+	// DefaultSyncLimit - размер страницы синхронизации, если клиент его не указал
+	DefaultSyncLimit = 500
+	// MaxSyncLimit - наибольший допустимый размер страницы синхронизации
+	MaxSyncLimit = 1000
+)
+
+// SyncResponse - страница изменений. NextCursor передается в следующий запрос;
+// HasMore означает, что изменения после NextCursor уже есть и их нужно дочитать сразу.
 type SyncResponse struct {
-	Secrets    []*Secret `json:"secrets"`
-	ServerTime time.Time `json:"server_time"`
+	Secrets    []*Secret        `json:"secrets"`
+	Folders    []*folder.Folder `json:"folders"`
+	Tags       []*tag.Tag       `json:"tags"`
+	NextCursor string           `json:"next_cursor"`
+	HasMore    bool             `json:"has_more"`
 }
 
 func (s *Service) CreateSecret(userID int, req *CreateSecretRequest, excludeSessionID string) (*Secret, error) {
@@ -41,16 +90,40 @@ func (s *Service) CreateSecret(userID int, req *CreateSecretRequest, excludeSess
 		return nil, err
 	}
 
+	id, _ := normalizeSecretID(req.ID)
 	secret := &Secret{
-		UserID:     userID,
-		Login:      req.Login,
-		Password:   req.Password,
-		Metadata:   req.Metadata,
-		BinaryData: req.BinaryData,
-		Version:    1,
+		ID:           id,
+		UserID:       userID,
+		Type:         normalizeType(req.Type),
+		Login:        req.Login,
+		Password:     req.Password,
+		Text:         req.Text,
+		Card:         req.Card,
+		Metadata:     req.Metadata,
+		BinaryData:   req.BinaryData,
+		BinaryReader: req.BinaryReader,
+		FolderID:     req.FolderID,
+		Version:      1,
+	}
+
+	if secret.FolderID != "" {
+		exists, err := s.repo.FolderExists(userID, secret.FolderID)
+		if err != nil {
+			return nil, WrapError(err, "не удалось проверить папку")
+		}
+		if !exists {
+			return nil, ErrFolderNotFound
+		}
 	}
 
 	if err := s.repo.CreateSecret(secret); err != nil {
+		if errors.Is(err, ErrSecretAlreadyExists) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+			}).Warn("[Secret] Секрет с таким ID уже существует")
+			return nil, err
+		}
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id": userID,
 			"error":   err.Error(),
@@ -94,28 +167,93 @@ func (s *Service) GetSecret(id string, userID int) (*Secret, error) {
 		return nil, err
 	}
 
+	if err := s.repo.LoadBinaryData(secret); err != nil {
+		return nil, WrapError(err, "не удалось получить бинарные данные секрета")
+	}
+
 	return secret, nil
 }
 
-func (s *Service) GetAllSecrets(userID int) ([]*Secret, error) {
-	secrets, err := s.repo.GetSecretsByUserID(userID)
+// GetChangeSeq возвращает номер последнего изменения секретов пользователя.
+// Он растет при любом изменении, поэтому по нему строится ETag списков.
+func (s *Service) GetChangeSeq(userID int) (int64, error) {
+	seq, err := s.repo.GetChangeSeq(userID)
 	if err != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id": userID,
 			"error":   err.Error(),
-		}).Error("[Secret] Ошибка получения всех секретов пользователя из репозитория")
+		}).Error("[Secret] Ошибка получения номера последнего изменения")
+		return 0, err
+	}
+	return seq, nil
+}
+
+// ListSecrets возвращает страницу активных секретов без бинарных данных
+func (s *Service) ListSecrets(userID int, query *ListSecretsQuery) (*SecretListResponse, error) {
+	if query.Type != "" && !query.Type.IsValid() {
+		return nil, ErrInvalidType
+	}
+	if query.Sort == "" {
+		query.Sort = SortCreated
+	}
+
+	after, err := decodeListCursor(query.Cursor, query.Sort, query.Desc)
+	if err != nil {
 		return nil, err
 	}
 
-	if secrets == nil {
-		secrets = []*Secret{}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
 	}
 
-	return secrets, nil
+	// Лишняя запись показывает, есть ли следующая страница
+	secrets, err := s.repo.ListSecrets(userID, query, after, limit+1)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"sort":    query.Sort,
+			"error":   err.Error(),
+		}).Error("[Secret] Ошибка получения списка секретов из репозитория")
+		return nil, WrapError(err, "не удалось получить список секретов")
+	}
+
+	response := &SecretListResponse{Secrets: make([]SecretResponse, 0, len(secrets))}
+	if len(secrets) > limit {
+		secrets = secrets[:limit]
+		response.HasMore = true
+		response.NextCursor = encodeListCursor(newListPosition(secrets[limit-1], query.Sort, query.Desc))
+	}
+	for _, secret := range secrets {
+		response.Secrets = append(response.Secrets, secret.ToListResponse())
+	}
+
+	return response, nil
 }
 
 func (s *Service) UpdateSecret(id string, userID int, req *UpdateSecretRequest, excludeSessionID string) (*Secret, error) {
-	if err := s.validateUpdateRequest(req); err != nil {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	secret, err := s.repo.GetSecretByID(id, userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка получения секрета для обновления из репозитория")
+		return nil, err
+	}
+
+	if !secret.Share.CanWrite() {
+		return nil, ErrForbidden
+	}
+
+	if err := s.validateUpdateRequest(req, secret.Type); err != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":   userID,
 			"secret_id": id,
@@ -124,31 +262,94 @@ func (s *Service) UpdateSecret(id string, userID int, req *UpdateSecretRequest,
 		return nil, err
 	}
 
+	if secret.Version != req.Version {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":         userID,
+			"secret_id":       secret.ID,
+			"current_version": secret.Version,
+			"request_version": req.Version,
+			"merge":           req.Merge,
+		}).Warn("[Secret] Конфликт версий при обновлении секрета")
+		// Поток нельзя сравнить с базовой версией, поэтому загрузка потоком не сливается
+		if !req.Merge || req.BinaryReader != nil {
+			return nil, ErrVersionConflict
+		}
+
+		secret, err = s.mergeUpdate(secret, req)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if req.Type != "" {
+			secret.Type = normalizeType(req.Type)
+		}
+		secret.Login = req.Login
+		secret.Password = req.Password
+		secret.Text = req.Text
+		secret.Card = req.Card
+		secret.Metadata = req.Metadata
+		secret.BinaryData = req.BinaryData
+		secret.BinaryReader = req.BinaryReader
+	}
+
+	return s.saveUpdate(secret, userID, excludeSessionID)
+}
+
+// PatchSecret применяет к секрету JSON Merge Patch. Неупомянутые в патче поля,
+// в том числе бинарные данные, остаются прежними.
+func (s *Service) PatchSecret(id string, userID int, req *PatchSecretRequest, excludeSessionID string) (*Secret, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
 	secret, err := s.repo.GetSecretByID(id, userID)
 	if err != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":   userID,
 			"secret_id": id,
 			"error":     err.Error(),
-		}).Error("[Secret] Ошибка получения секрета для обновления из репозитория")
+		}).Error("[Secret] Ошибка получения секрета для изменения из репозитория")
 		return nil, err
 	}
 
+	if !secret.Share.CanWrite() {
+		return nil, ErrForbidden
+	}
+
 	if secret.Version != req.Version {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":         userID,
 			"secret_id":       secret.ID,
 			"current_version": secret.Version,
 			"request_version": req.Version,
-		}).Warn("[Secret] Конфликт версий при обновлении секрета")
+		}).Warn("[Secret] Конфликт версий при изменении секрета")
 		return nil, ErrVersionConflict
 	}
 
-	secret.Login = req.Login
-	secret.Password = req.Password
-	secret.Metadata = req.Metadata
-	secret.BinaryData = req.BinaryData
+	// Данные, не упомянутые в патче, должны сохраниться
+	if err := s.repo.LoadBinaryData(secret); err != nil {
+		return nil, WrapError(err, "не удалось получить бинарные данные секрета")
+	}
 
+	if err := applySecretPatch(secret, req.Fields); err != nil {
+		return nil, err
+	}
+
+	if err := validatePayload(normalizeType(secret.Type), secret.Login, secret.Password, secret.Text, secret.Card, len(secret.BinaryData) > 0); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Warn("[Secret] Ошибка валидации секрета после применения патча")
+		return nil, err
+	}
+
+	return s.saveUpdate(secret, userID, excludeSessionID)
+}
+
+// saveUpdate сохраняет измененный секрет и рассылает событие обновления владельцу
+// и получателям доступа
+func (s *Service) saveUpdate(secret *Secret, userID int, excludeSessionID string) (*Secret, error) {
 	if err := s.repo.UpdateSecret(secret); err != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":   userID,
@@ -158,13 +359,20 @@ func (s *Service) UpdateSecret(id string, userID int, req *UpdateSecretRequest,
 		return nil, WrapError(err, "не удалось обновить секрет")
 	}
 
+	// Сохранение перечитывает папку и метки владельца, получателю они не видны
+	if secret.Share != nil {
+		secret.applyShare(secret.Share)
+	}
+
+	s.pruneVersions(secret.ID, secret.UserID)
+
 	if s.realtimeService != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":         userID,
 			"secret_id":       secret.ID,
 			"exclude_session": excludeSessionID,
 		}).Info("[Secret] Отправка события обновления секрета")
-		if err := s.realtimeService.NotifySecretUpdated(userID, secret.ID, excludeSessionID); err != nil {
+		if err := s.notifyAll(RealtimeService.NotifySecretUpdated, secret.UserID, secret.ID, excludeSessionID); err != nil {
 			logger.Log.WithFields(map[string]interface{}{
 				"user_id":   userID,
 				"secret_id": secret.ID,
@@ -181,8 +389,214 @@ func (s *Service) UpdateSecret(id string, userID int, req *UpdateSecretRequest,
 	return secret, nil
 }
 
-func (s *Service) DeleteSecret(id string, userID int, excludeSessionID string) error {
-	if err := s.repo.SoftDeleteSecret(id, userID); err != nil {
+// mergeUpdate сливает изменение клиента, сделанное от версии req.Version, с текущим секретом.
+// Если базовой версии уже нет в истории, слить нечего и возвращается обычный конфликт.
+func (s *Service) mergeUpdate(current *Secret, req *UpdateSecretRequest) (*Secret, error) {
+	base, err := s.repo.GetSecretVersion(current.ID, current.UserID, req.Version)
+	if err != nil {
+		if errors.Is(err, ErrVersionNotFound) {
+			return nil, ErrVersionConflict
+		}
+		return nil, WrapError(err, "не удалось получить базовую версию для слияния")
+	}
+
+	if err := s.repo.LoadBinaryData(current); err != nil {
+		return nil, WrapError(err, "не удалось получить бинарные данные секрета")
+	}
+
+	merged, conflicts := mergeSecret(base, current, req)
+	if len(conflicts) > 0 {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   current.UserID,
+			"secret_id": current.ID,
+			"fields":    conflicts,
+		}).Warn("[Secret] Слияние невозможно: поля изменены на разных устройствах")
+		return nil, &MergeConflictError{Fields: conflicts, Current: current}
+	}
+
+	if err := validatePayload(merged.Type, merged.Login, merged.Password, merged.Text, merged.Card, len(merged.BinaryData) > 0); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// GetSecretVersions возвращает историю версий. Получатель доступа видит историю чужого секрета.
+func (s *Service) GetSecretVersions(id string, userID int) ([]*SecretVersion, error) {
+	secret, err := s.repo.GetSecretByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.repo.GetSecretVersions(id, secret.UserID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка получения истории версий из репозитория")
+		return nil, err
+	}
+
+	if versions == nil {
+		versions = []*SecretVersion{}
+	}
+
+	return versions, nil
+}
+
+func (s *Service) GetSecretVersion(id string, userID int, version int) (*SecretVersion, error) {
+	ownerID, _, err := s.ownerOf(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := s.repo.GetSecretVersion(id, ownerID, version)
+	if err != nil {
+		if !errors.Is(err, ErrVersionNotFound) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"version":   version,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения версии секрета из репозитория")
+		}
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// RestoreSecretVersion записывает содержимое старой версии как новую версию секрета.
+// req.Version - текущая версия секрета у клиента, проверяется так же, как при обновлении.
+func (s *Service) RestoreSecretVersion(id string, userID int, version int, req *RestoreVersionRequest, excludeSessionID string) (*Secret, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	snapshot, err := s.GetSecretVersion(id, userID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.UpdateSecret(id, userID, &UpdateSecretRequest{
+		Type:       snapshot.Type,
+		Login:      snapshot.Login,
+		Password:   snapshot.Password,
+		Text:       snapshot.Text,
+		Card:       snapshot.Card,
+		Metadata:   snapshot.Metadata,
+		BinaryData: snapshot.BinaryData,
+		Version:    req.Version,
+	}, excludeSessionID)
+}
+
+func (s *Service) pruneVersions(secretID string, userID int) {
+	if s.versionsLimit <= 0 {
+		return
+	}
+
+	if err := s.repo.PruneSecretVersions(secretID, s.versionsLimit); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": secretID,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка очистки истории версий")
+	}
+}
+
+func (s *Service) GetBlobInfo(id string, userID int) (*BlobInfo, error) {
+	ownerID, _, err := s.ownerOf(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getBlobInfo(id, ownerID)
+}
+
+func (s *Service) getBlobInfo(id string, ownerID int) (*BlobInfo, error) {
+	info, err := s.repo.GetBlobInfo(id, ownerID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   ownerID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка получения сведений о бинарных данных")
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// ReadBlob читает часть данных, описанных info. Доступ проверен при получении info в GetBlobInfo.
+func (s *Service) ReadBlob(info *BlobInfo, offset, length int64) ([]byte, error) {
+	return s.repo.ReadBlob(info.Ref, offset, length)
+}
+
+// UploadBlob заменяет бинарные данные секрета потоком r, не собирая его целиком в памяти
+func (s *Service) UploadBlob(id string, userID int, version int, r io.Reader, excludeSessionID string) (*BlobInfo, error) {
+	ownerID, share, err := s.ownerOf(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !share.CanWrite() {
+		return nil, ErrForbidden
+	}
+
+	info, err := s.getBlobInfo(id, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Бинарные данные допустимы только у файлов и у логинов с вложением
+	if info.Type != TypeFile && info.Type != TypeLogin {
+		return nil, ErrUnexpectedFields
+	}
+
+	if info.Version != version {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":         userID,
+			"secret_id":       id,
+			"current_version": info.Version,
+			"request_version": version,
+		}).Warn("[Secret] Конфликт версий при загрузке бинарных данных")
+		return nil, ErrVersionConflict
+	}
+
+	body := bufio.NewReaderSize(r, blobPieceSize)
+	if _, err := body.Peek(1); err == io.EOF && info.Type == TypeFile {
+		return nil, ErrFileRequired
+	}
+
+	info, err = s.repo.WriteBlob(id, ownerID, version, body)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка записи бинарных данных")
+		return nil, err
+	}
+
+	s.pruneVersions(id, ownerID)
+
+	if s.realtimeService != nil {
+		if err := s.notifyAll(RealtimeService.NotifySecretUpdated, ownerID, id, excludeSessionID); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка отправки события обновления через WebSocket")
+		}
+	}
+
+	return info, nil
+}
+
+// DeleteSecret перемещает секрет в корзину. version 0 - без проверки версии.
+// Удалить секрет может только владелец.
+func (s *Service) DeleteSecret(id string, userID int, version int, excludeSessionID string) error {
+	if err := s.ownerOnly(id, userID, s.repo.SoftDeleteSecret(id, userID, version)); err != nil {
 		logger.Log.WithFields(map[string]interface{}{
 			"user_id":   userID,
 			"secret_id": id,
@@ -197,7 +611,7 @@ func (s *Service) DeleteSecret(id string, userID int, excludeSessionID string) e
 			"secret_id":       id,
 			"exclude_session": excludeSessionID,
 		}).Info("[Secret] Отправка события удаления секрета")
-		if err := s.realtimeService.NotifySecretDeleted(userID, id, excludeSessionID); err != nil {
+		if err := s.notifyAll(RealtimeService.NotifySecretDeleted, userID, id, excludeSessionID); err != nil {
 			logger.Log.WithFields(map[string]interface{}{
 				"user_id":   userID,
 				"secret_id": id,
@@ -214,64 +628,480 @@ func (s *Service) DeleteSecret(id string, userID int, excludeSessionID string) e
 	return nil
 }
 
-func (s *Service) GetSecretsForSync(userID int, since *time.Time) (*SyncResponse, error) {
-	var secrets []*Secret
-	var err error
+func (s *Service) GetTrash(userID int) ([]*Secret, error) {
+	secrets, err := s.repo.GetDeletedSecrets(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Secret] Ошибка получения корзины из репозитория")
+		return nil, err
+	}
 
-	if since == nil {
-		secrets, err = s.repo.GetSecretsByUserID(userID)
-	} else {
-		secrets, err = s.repo.GetSecretsModifiedSince(userID, *since)
+	if secrets == nil {
+		secrets = []*Secret{}
 	}
 
+	return secrets, nil
+}
+
+func (s *Service) RestoreSecret(id string, userID int, excludeSessionID string) (*Secret, error) {
+	if err := s.repo.RestoreSecret(id, userID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка восстановления секрета из корзины")
+		return nil, err
+	}
+
+	secret, err := s.repo.GetSecretByID(id, userID)
 	if err != nil {
+		return nil, WrapError(err, "не удалось получить восстановленный секрет")
+	}
+
+	if s.realtimeService != nil {
+		if err := s.notifyAll(RealtimeService.NotifySecretRestored, userID, id, excludeSessionID); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка отправки события восстановления через WebSocket")
+		}
+	}
+
+	return secret, nil
+}
+
+// PurgeSecret окончательно удаляет секрет, минуя корзину
+func (s *Service) PurgeSecret(id string, userID int, version int, excludeSessionID string) error {
+	if err := s.ownerOnly(id, userID, s.repo.PurgeSecret(id, userID, version)); err != nil {
 		logger.Log.WithFields(map[string]interface{}{
-			"user_id": userID,
-			"since":   since,
-			"error":   err.Error(),
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка окончательного удаления секрета")
+		return err
+	}
+
+	if s.realtimeService != nil {
+		if err := s.notifyAll(RealtimeService.NotifySecretDeleted, userID, id, excludeSessionID); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка отправки события удаления через WebSocket")
+		}
+	}
+
+	return nil
+}
+
+// RecordDeviceSync запоминает позицию синхронизации устройства для очистки корзины.
+// Курсор в запросе подтверждает, что устройство уже получило все изменения до него.
+func (s *Service) RecordDeviceSync(userID int, deviceID string, cursor string) {
+	if deviceID == "" {
+		return
+	}
+
+	syncedSeq, err := decodeSyncCursor(cursor)
+	if err != nil {
+		return
+	}
+
+	if err := s.repo.SaveDeviceSync(userID, deviceID, syncedSeq); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"device_id": deviceID,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка сохранения позиции синхронизации устройства")
+	}
+}
+
+// GetSecretsForSync возвращает до limit изменений после курсора (пустой курсор - с начала).
+// Удаленные секреты приходят надгробиями с deleted_at.
+func (s *Service) GetSecretsForSync(userID int, cursor string, limit int) (*SyncResponse, error) {
+	afterSeq, err := decodeSyncCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = DefaultSyncLimit
+	}
+	if limit > MaxSyncLimit {
+		limit = MaxSyncLimit
+	}
+
+	// Лишняя запись показывает, есть ли следующая страница
+	secrets, err := s.repo.GetSecretChanges(userID, afterSeq, limit+1)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"after_seq": afterSeq,
+			"error":     err.Error(),
 		}).Error("[Secret] Ошибка получения секретов для синхронизации из репозитория")
 		return nil, WrapError(err, "не удалось получить секреты для синхронизации")
 	}
 
-	if secrets == nil {
+	shared, err := s.repo.GetSharedSecretChanges(userID, afterSeq, limit+1)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"after_seq": afterSeq,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка получения чужих секретов для синхронизации из репозитория")
+		return nil, WrapError(err, "не удалось получить чужие секреты для синхронизации")
+	}
+
+	var folders []*folder.Folder
+	if s.folderFeed != nil {
+		folders, err = s.folderFeed.GetFolderChanges(userID, afterSeq, limit+1)
+		if err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"after_seq": afterSeq,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения папок для синхронизации")
+			return nil, WrapError(err, "не удалось получить папки для синхронизации")
+		}
+	}
+
+	var tags []*tag.Tag
+	if s.tagFeed != nil {
+		tags, err = s.tagFeed.GetTagChanges(userID, afterSeq, limit+1)
+		if err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"after_seq": afterSeq,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения меток для синхронизации")
+			return nil, WrapError(err, "не удалось получить метки для синхронизации")
+		}
+	}
+
+	// Из лент берутся первые limit изменений по общему номеру. Чужие секреты нумеруются
+	// счетчиком получателя, поэтому идут в той же ленте, что и свои.
+	seqs := [][]int64{make([]int64, len(secrets)), make([]int64, len(shared)), make([]int64, len(folders)), make([]int64, len(tags))}
+	for i, secret := range secrets {
+		seqs[0][i] = secret.ChangeSeq
+	}
+	for i, secret := range shared {
+		seqs[1][i] = secret.ChangeSeq
+	}
+	for i, f := range folders {
+		seqs[2][i] = f.ChangeSeq
+	}
+	for i, t := range tags {
+		seqs[3][i] = t.ChangeSeq
+	}
+	counts, hasMore := takeChanges(limit, seqs...)
+	secrets = mergeBySeq(secrets[:counts[0]], shared[:counts[1]])
+	folders, tags = folders[:counts[2]], tags[:counts[3]]
+
+	nextSeq := afterSeq
+	for i, feed := range seqs {
+		if counts[i] > 0 && feed[counts[i]-1] > nextSeq {
+			nextSeq = feed[counts[i]-1]
+		}
+	}
+
+	if len(secrets) == 0 {
 		secrets = []*Secret{}
 	}
+	if len(folders) == 0 {
+		folders = []*folder.Folder{}
+	}
+	if len(tags) == 0 {
+		tags = []*tag.Tag{}
+	}
 
 	response := &SyncResponse{
 		Secrets:    secrets,
-		ServerTime: time.Now(),
+		Folders:    folders,
+		Tags:       tags,
+		NextCursor: encodeSyncCursor(nextSeq),
+		HasMore:    hasMore,
 	}
 
 	return response, nil
 }
 
-func (s *Service) validateCreateRequest(req *CreateSecretRequest) error {
+// mergeBySeq сливает две упорядоченные по номеру изменения ленты секретов
+func mergeBySeq(own, shared []*Secret) []*Secret {
+	merged := make([]*Secret, 0, len(own)+len(shared))
+	for len(own) > 0 && len(shared) > 0 {
+		if own[0].ChangeSeq < shared[0].ChangeSeq {
+			merged, own = append(merged, own[0]), own[1:]
+		} else {
+			merged, shared = append(merged, shared[0]), shared[1:]
+		}
+	}
+	merged = append(merged, own...)
+	return append(merged, shared...)
+}
+
+// takeChanges выбирает первые limit изменений из лент, упорядоченных по номеру изменения, и
+// возвращает, сколько элементов взято из каждой ленты. hasMore - в лентах остались изменения после них.
+func takeChanges(limit int, feeds ...[]int64) ([]int, bool) {
+	counts := make([]int, len(feeds))
+	for taken := 0; taken < limit; taken++ {
+		next := -1
+		for i, feed := range feeds {
+			if counts[i] < len(feed) && (next == -1 || feed[counts[i]] < feeds[next][counts[next]]) {
+				next = i
+			}
+		}
+		if next == -1 {
+			break
+		}
+		counts[next]++
+	}
+
+	hasMore := false
+	for i, feed := range feeds {
+		if counts[i] < len(feed) {
+			hasMore = true
+		}
+	}
+	return counts, hasMore
+}
+
+// PushChanges применяет пакет офлайн-изменений клиента. Невалидные операции получают статус
+// invalid и не мешают остальным; валидные применяются в одной транзакции. Устройства получают
+// одно событие на весь пакет.
+func (s *Service) PushChanges(userID int, req *PushRequest, excludeSessionID string) ([]*PushResult, error) {
 	if req == nil {
-		return ErrRequestRequired
+		return nil, ErrRequestRequired
+	}
+	if len(req.Operations) > MaxPushOperations {
+		return nil, ErrTooManyPushOperations
 	}
 
-	if req.Login == "" {
-		return ErrLoginRequired
+	results := make([]*PushResult, len(req.Operations))
+	changes := make([]*SecretChange, 0, len(req.Operations))
+	positions := make([]int, 0, len(req.Operations))
+
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		change, err := pushOperationToChange(op)
+		if err != nil {
+			results[i] = &PushResult{ClientID: op.ClientID, Status: PushInvalid, Err: err}
+			continue
+		}
+		changes = append(changes, change)
+		positions = append(positions, i)
 	}
 
-	if req.Password == "" {
-		return ErrPasswordRequired
+	applied, err := s.repo.ApplyChanges(userID, changes)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":    userID,
+			"operations": len(changes),
+			"error":      err.Error(),
+		}).Error("[Secret] Ошибка применения пакета изменений в репозитории")
+		return nil, WrapError(err, "не удалось применить пакет изменений")
 	}
 
-	return nil
+	var created, updated, deleted []string
+	for j, result := range applied {
+		op := req.Operations[positions[j]]
+		result.ClientID = op.ClientID
+		results[positions[j]] = result
+
+		if result.Status != PushApplied {
+			continue
+		}
+		switch op.Action {
+		case PushCreate:
+			created = append(created, result.Secret.ID)
+		case PushUpdate:
+			s.pruneVersions(result.Secret.ID, result.Secret.UserID)
+			// Об изменении чужого секрета узнают владелец и все получатели доступа
+			if result.Secret.Share != nil {
+				s.notifySharedUpdate(result.Secret, userID, excludeSessionID)
+				continue
+			}
+			updated = append(updated, result.Secret.ID)
+		case PushDelete:
+			deleted = append(deleted, op.SecretID)
+		}
+	}
+
+	if s.realtimeService != nil && len(created)+len(updated)+len(deleted) > 0 {
+		if err := s.realtimeService.NotifySecretsBatch(userID, created, updated, deleted, excludeSessionID); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Secret] Ошибка отправки пакета событий через WebSocket")
+		}
+	}
+
+	return results, nil
 }
 
-func (s *Service) validateUpdateRequest(req *UpdateSecretRequest) error {
+func (s *Service) notifySharedUpdate(secret *Secret, userID int, excludeSessionID string) {
+	if s.realtimeService == nil {
+		return
+	}
+	if err := s.notifyAll(RealtimeService.NotifySecretUpdated, secret.UserID, secret.ID, excludeSessionID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": secret.ID,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка отправки события обновления через WebSocket")
+	}
+}
+
+func pushOperationToChange(op *PushOperation) (*SecretChange, error) {
+	switch op.Action {
+	case PushCreate, PushUpdate:
+		if op.Action == PushUpdate && op.SecretID == "" {
+			return nil, ErrSecretIDRequired
+		}
+		id := op.SecretID
+		if op.Action == PushCreate {
+			var err error
+			if id, err = normalizeSecretID(op.SecretID); err != nil {
+				return nil, err
+			}
+		}
+		secretType := normalizeType(op.Type)
+		if err := validatePayload(secretType, op.Login, op.Password, op.Text, op.Card, len(op.BinaryData) > 0); err != nil {
+			return nil, err
+		}
+		version := 1
+		folderID := op.FolderID
+		if op.Action == PushUpdate {
+			version = op.BaseVersion
+			folderID = ""
+		}
+		if err := validateFolderID(folderID); err != nil {
+			return nil, err
+		}
+		return &SecretChange{Action: op.Action, Secret: &Secret{
+			ID:         id,
+			Type:       secretType,
+			Login:      op.Login,
+			Password:   op.Password,
+			Text:       op.Text,
+			Card:       op.Card,
+			Metadata:   op.Metadata,
+			BinaryData: op.BinaryData,
+			FolderID:   folderID,
+			Version:    version,
+		}}, nil
+
+	case PushDelete:
+		if op.SecretID == "" {
+			return nil, ErrSecretIDRequired
+		}
+		return &SecretChange{Action: op.Action, Secret: &Secret{ID: op.SecretID, Version: op.BaseVersion}}, nil
+	}
+
+	return nil, ErrInvalidPushAction
+}
+
+func (s *Service) validateCreateRequest(req *CreateSecretRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if _, err := normalizeSecretID(req.ID); err != nil {
+		return err
+	}
+	if err := validateFolderID(req.FolderID); err != nil {
+		return err
+	}
+
+	return validatePayload(normalizeType(req.Type), req.Login, req.Password, req.Text, req.Card, len(req.BinaryData) > 0 || req.BinaryReader != nil)
+}
+
+// validateUpdateRequest проверяет содержимое по типу из запроса, а если тип не передан -
+// по текущему типу секрета: обновление без type тип не меняет.
+func (s *Service) validateUpdateRequest(req *UpdateSecretRequest, currentType SecretType) error {
 	if req == nil {
 		return ErrRequestRequired
 	}
 
-	if req.Login == "" {
-		return ErrLoginRequired
+	secretType := currentType
+	if req.Type != "" {
+		secretType = normalizeType(req.Type)
 	}
 
-	if req.Password == "" {
-		return ErrPasswordRequired
+	return validatePayload(secretType, req.Login, req.Password, req.Text, req.Card, len(req.BinaryData) > 0 || req.BinaryReader != nil)
+}
+
+// normalizeSecretID приводит ID, сгенерированный клиентом, к каноническому виду UUID.
+// Пустой ID остается пустым: его назначит база.
+func normalizeSecretID(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return parsed.String(), nil
+}
+
+// validateFolderID проверяет ID папки из запроса. Пустой ID - корень.
+func validateFolderID(id string) error {
+	if id == "" {
+		return nil
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrInvalidFolderID
+	}
+	return nil
+}
+
+// normalizeType сохраняет совместимость со старыми клиентами, которые не передают тип
+func normalizeType(secretType SecretType) SecretType {
+	if secretType == "" {
+		return TypeLogin
+	}
+	return secretType
+}
+
+// validatePayload проверяет, что заполнены поля своего типа и только они.
+// Значения зашифрованы на клиенте, поэтому проверяется только их наличие.
+func validatePayload(secretType SecretType, login, password, text string, card *CardData, hasBinary bool) error {
+	hasCredentials := login != "" || password != ""
+
+	switch secretType {
+	case TypeLogin:
+		if login == "" {
+			return ErrLoginRequired
+		}
+		if password == "" {
+			return ErrPasswordRequired
+		}
+		if text != "" || card != nil {
+			return ErrUnexpectedFields
+		}
+	case TypeText:
+		if text == "" {
+			return ErrTextRequired
+		}
+		if hasCredentials || card != nil || hasBinary {
+			return ErrUnexpectedFields
+		}
+	case TypeCard:
+		if card == nil || card.Number == "" || card.Expiry == "" || card.Holder == "" || card.CVV == "" {
+			return ErrCardRequired
+		}
+		if hasCredentials || text != "" || hasBinary {
+			return ErrUnexpectedFields
+		}
+	case TypeFile:
+		if !hasBinary {
+			return ErrFileRequired
+		}
+		if hasCredentials || text != "" || card != nil {
+			return ErrUnexpectedFields
+		}
+	default:
+		return ErrInvalidType
 	}
 
 	return nil
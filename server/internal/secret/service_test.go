@@ -1,57 +1,243 @@
 package secret
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/folder"
+	"github.com/Adigezalov/goph-keeper/internal/tag"
 )
 
 type MockRepository struct {
 	secrets   map[string]*Secret
+	versions  map[string][]*SecretVersion
+	devices   map[string]mockDevice
+	purged    map[string]bool
+	folders   map[string]int // ID папки -> владелец
+	users     map[string]int // email -> ID пользователя
+	shares    map[string]*mockShare
 	idCounter int
+	changeSeq int64
+}
+
+// mockShare - строка secret_shares
+type mockShare struct {
+	share     SecretShare
+	changeSeq int64
+	revokedAt time.Time
+}
+
+type mockDevice struct {
+	syncedSeq int64
+	seenAt    time.Time
 }
 
 func NewMockRepository() *MockRepository {
 	return &MockRepository{
 		secrets:   make(map[string]*Secret),
+		versions:  make(map[string][]*SecretVersion),
+		devices:   make(map[string]mockDevice),
+		purged:    make(map[string]bool),
+		folders:   make(map[string]int),
+		users:     make(map[string]int),
+		shares:    make(map[string]*mockShare),
 		idCounter: 0,
 	}
 }
 
+// recordVersion повторяет триггер record_secret_version
+func (m *MockRepository) recordVersion(secret *Secret) {
+	m.versions[secret.ID] = append(m.versions[secret.ID], &SecretVersion{
+		SecretID:       secret.ID,
+		UserID:         secret.UserID,
+		Version:        secret.Version,
+		Type:           secret.Type,
+		Login:          secret.Login,
+		Password:       secret.Password,
+		Text:           secret.Text,
+		Card:           secret.Card,
+		Metadata:       secret.Metadata,
+		BinaryData:     secret.BinaryData,
+		BinaryDataSize: int64(len(secret.BinaryData)),
+		CreatedAt:      time.Now(),
+	})
+}
+
+// touch повторяет триггеры set_secret_change_seq и touch_secret_shares
+func (m *MockRepository) touch(secret *Secret) {
+	m.changeSeq++
+	secret.ChangeSeq = m.changeSeq
+	for _, sh := range m.shares {
+		if sh.share.SecretID == secret.ID && sh.revokedAt.IsZero() {
+			m.changeSeq++
+			sh.changeSeq = m.changeSeq
+		}
+	}
+}
+
+func (m *MockRepository) liveShare(secretID string, granteeID int) *mockShare {
+	sh, ok := m.shares[fmt.Sprintf("%s/%d", secretID, granteeID)]
+	if !ok || !sh.revokedAt.IsZero() {
+		return nil
+	}
+	return sh
+}
+
+// visible повторяет условие visibleToUser: свой секрет или копия чужого, каким его видит получатель
+func (m *MockRepository) visible(secret *Secret, userID int) *Secret {
+	if secret.UserID == userID {
+		return secret
+	}
+	sh := m.liveShare(secret.ID, userID)
+	if sh == nil {
+		return nil
+	}
+	shared := *secret
+	shared.applyShare(&ShareAccess{
+		OwnerEmail: m.emailOf(secret.UserID),
+		Permission: sh.share.Permission,
+		WrappedKey: sh.share.WrappedKey,
+	})
+	shared.ChangeSeq = sh.changeSeq
+	return &shared
+}
+
+func (m *MockRepository) emailOf(userID int) string {
+	for email, id := range m.users {
+		if id == userID {
+			return email
+		}
+	}
+	return ""
+}
+
+// drainBinaryReader читает поток бинарных данных в BinaryData, как это делает репозиторий
+// при записи в BlobStore
+func drainBinaryReader(secret *Secret) error {
+	if secret.BinaryReader == nil {
+		return nil
+	}
+	data, err := io.ReadAll(secret.BinaryReader)
+	if err != nil {
+		return err
+	}
+	secret.BinaryData, secret.BinaryReader = data, nil
+	return nil
+}
+
 func (m *MockRepository) CreateSecret(secret *Secret) error {
-	m.idCounter++
-	secret.ID = fmt.Sprintf("test-uuid-%d", m.idCounter)
+	if err := drainBinaryReader(secret); err != nil {
+		return err
+	}
+	if secret.ID == "" {
+		m.idCounter++
+		secret.ID = fmt.Sprintf("test-uuid-%d", m.idCounter)
+	} else if _, exists := m.secrets[secret.ID]; exists {
+		return ErrSecretAlreadyExists
+	}
 	secret.CreatedAt = time.Now()
 	secret.UpdatedAt = time.Now()
+	m.touch(secret)
 	m.secrets[secret.ID] = secret
+	m.recordVersion(secret)
 	return nil
 }
 
 func (m *MockRepository) GetSecretByID(id string, userID int) (*Secret, error) {
 	secret, ok := m.secrets[id]
-	if !ok || secret.UserID != userID {
+	if !ok {
 		return nil, ErrSecretNotFound
 	}
-	return secret, nil
+	visible := m.visible(secret, userID)
+	if visible == nil || (visible.Share != nil && visible.DeletedAt.Valid) {
+		return nil, ErrSecretNotFound
+	}
+	return visible, nil
+}
+
+// LoadBinaryData ничего не делает: мок хранит бинарные данные прямо в секрете
+func (m *MockRepository) LoadBinaryData(secret *Secret) error {
+	return nil
 }
 
-func (m *MockRepository) GetSecretsByUserID(userID int) ([]*Secret, error) {
+func (m *MockRepository) ListSecrets(userID int, query *ListSecretsQuery, after *listPosition, limit int) ([]*Secret, error) {
+	less := func(a, b *Secret) bool {
+		switch query.Sort {
+		case SortUpdated:
+			if !a.UpdatedAt.Equal(b.UpdatedAt) {
+				return a.UpdatedAt.Before(b.UpdatedAt) != query.Desc
+			}
+		case SortLogin:
+			if a.Login != b.Login {
+				return (a.Login < b.Login) != query.Desc
+			}
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt) != query.Desc
+			}
+		}
+		return (a.ID < b.ID) != query.Desc
+	}
+
+	var last *Secret
+	if after != nil {
+		last = &Secret{ID: after.ID, Login: after.Value}
+		last.CreatedAt, _ = time.Parse(time.RFC3339Nano, after.Value)
+		last.UpdatedAt = last.CreatedAt
+	}
+
 	var result []*Secret
-	for _, secret := range m.secrets {
-		if secret.UserID == userID && !secret.DeletedAt.Valid {
+	for _, stored := range m.secrets {
+		secret := m.visible(stored, userID)
+		if secret == nil || secret.DeletedAt.Valid || (query.Type != "" && secret.Type != query.Type) {
+			continue
+		}
+		if last != nil && !less(last, secret) {
+			continue
+		}
+		matches := true
+		for key, value := range query.Metadata {
+			if secret.Metadata[key] != value {
+				matches = false
+			}
+		}
+		for _, key := range query.MetadataKeys {
+			if _, ok := secret.Metadata[key]; !ok {
+				matches = false
+			}
+		}
+		if matches {
 			result = append(result, secret)
 		}
 	}
+
+	sort.Slice(result, func(i, j int) bool { return less(result[i], result[j]) })
+	if len(result) > limit {
+		result = result[:limit]
+	}
 	return result, nil
 }
 
-func (m *MockRepository) GetSecretsModifiedSince(userID int, since time.Time) ([]*Secret, error) {
+func (m *MockRepository) GetSecretChanges(userID int, afterSeq int64, limit int) ([]*Secret, error) {
 	var result []*Secret
 	for _, secret := range m.secrets {
-		if secret.UserID == userID && secret.UpdatedAt.After(since) {
+		if secret.UserID == userID && secret.ChangeSeq > afterSeq {
 			result = append(result, secret)
 		}
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ChangeSeq < result[j].ChangeSeq })
+	if len(result) > limit {
+		result = result[:limit]
+	}
 	return result, nil
 }
 
@@ -63,22 +249,355 @@ func (m *MockRepository) UpdateSecret(secret *Secret) error {
 	if existing.Version != secret.Version {
 		return ErrVersionConflict
 	}
+	if err := drainBinaryReader(secret); err != nil {
+		return err
+	}
 	secret.Version++
 	secret.UpdatedAt = time.Now()
-	m.secrets[secret.ID] = secret
+	m.touch(secret)
+	stored := secret
+	if secret.Share != nil {
+		// Секрет изменил получатель: папка и метки остаются владельца
+		owned := *secret
+		owned.Share, owned.FolderID, owned.Tags = nil, existing.FolderID, existing.Tags
+		stored = &owned
+	}
+	m.secrets[secret.ID] = stored
+	m.recordVersion(stored)
 	return nil
 }
 
-func (m *MockRepository) SoftDeleteSecret(id string, userID int) error {
+func (m *MockRepository) SoftDeleteSecret(id string, userID int, version int) error {
 	secret, ok := m.secrets[id]
 	if !ok || secret.UserID != userID {
 		return ErrSecretNotFound
 	}
+	if version != 0 && secret.Version != version {
+		return ErrVersionConflict
+	}
 	secret.DeletedAt.Valid = true
 	secret.DeletedAt.Time = time.Now()
+	m.touch(secret)
+	return nil
+}
+
+func (m *MockRepository) GetDeletedSecrets(userID int) ([]*Secret, error) {
+	var result []*Secret
+	for _, secret := range m.secrets {
+		if secret.UserID == userID && secret.DeletedAt.Valid && !m.purged[secret.ID] {
+			result = append(result, secret)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) RestoreSecret(id string, userID int) error {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID || !secret.DeletedAt.Valid || m.purged[id] {
+		return ErrSecretNotFound
+	}
+	secret.DeletedAt.Valid = false
+	secret.Version++
+	secret.UpdatedAt = time.Now()
+	m.touch(secret)
+	m.recordVersion(secret)
+	return nil
+}
+
+func (m *MockRepository) PurgeSecret(id string, userID int, version int) error {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID || m.purged[id] {
+		return ErrSecretNotFound
+	}
+	if version != 0 && secret.Version != version {
+		return ErrVersionConflict
+	}
+	now := time.Now()
+	if !secret.DeletedAt.Valid {
+		secret.DeletedAt.Valid = true
+		secret.DeletedAt.Time = now
+	}
+	m.purged[id] = true
+	secret.Login, secret.Password, secret.BinaryData = "", "", nil
+	m.touch(secret)
+	delete(m.versions, id)
+	return nil
+}
+
+func (m *MockRepository) FolderExists(userID int, folderID string) (bool, error) {
+	return m.folders[folderID] == userID, nil
+}
+
+func (m *MockRepository) GetChangeSeq(userID int) (int64, error) {
+	return m.changeSeq, nil
+}
+
+func (m *MockRepository) SaveDeviceSync(userID int, deviceID string, syncedSeq int64) error {
+	m.devices[fmt.Sprintf("%d/%s", userID, deviceID)] = mockDevice{syncedSeq: syncedSeq, seenAt: time.Now()}
+	return nil
+}
+
+func (m *MockRepository) DeleteStaleDevices(seenBefore time.Time) (int64, error) {
+	var deleted int64
+	for key, device := range m.devices {
+		if device.seenAt.Before(seenBefore) {
+			delete(m.devices, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *MockRepository) PurgeTombstones(deletedBefore time.Time) (int64, error) {
+	var purged int64
+	for id, secret := range m.secrets {
+		if !secret.DeletedAt.Valid || (!m.purged[id] && !secret.DeletedAt.Time.Before(deletedBefore)) {
+			continue
+		}
+		if m.deviceBehind(secret) {
+			continue
+		}
+		delete(m.secrets, id)
+		delete(m.versions, id)
+		delete(m.purged, id)
+		purged++
+	}
+	return purged, nil
+}
+
+// deviceBehind сообщает, есть ли устройство, еще не получившее удаление секрета
+func (m *MockRepository) deviceBehind(secret *Secret) bool {
+	prefix := fmt.Sprintf("%d/", secret.UserID)
+	for key, device := range m.devices {
+		if strings.HasPrefix(key, prefix) && device.syncedSeq < secret.ChangeSeq {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockRepository) GetBlobInfo(id string, userID int) (*BlobInfo, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID || secret.DeletedAt.Valid {
+		return nil, ErrSecretNotFound
+	}
+	return &BlobInfo{
+		SecretID:  secret.ID,
+		UserID:    secret.UserID,
+		Type:      secret.Type,
+		Version:   secret.Version,
+		Size:      int64(len(secret.BinaryData)),
+		UpdatedAt: secret.UpdatedAt,
+		Ref:       secret.ID,
+	}, nil
+}
+
+func (m *MockRepository) ReadBlob(ref string, offset, length int64) ([]byte, error) {
+	secret, ok := m.secrets[ref]
+	if !ok {
+		return nil, ErrSecretNotFound
+	}
+	data := secret.BinaryData
+	if offset >= int64(len(data)) {
+		return []byte{}, nil
+	}
+	end := offset + length
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return data[offset:end], nil
+}
+
+func (m *MockRepository) WriteBlob(id string, userID int, version int, r io.Reader) (*BlobInfo, error) {
+	secret, ok := m.secrets[id]
+	if !ok || secret.UserID != userID || secret.DeletedAt.Valid {
+		return nil, ErrSecretNotFound
+	}
+	if secret.Version != version {
+		return nil, ErrVersionConflict
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	secret.BinaryData = data
+	secret.Version++
+	secret.UpdatedAt = time.Now()
+	m.touch(secret)
+	m.recordVersion(secret)
+	return m.GetBlobInfo(id, userID)
+}
+
+func (m *MockRepository) GetSecretVersions(secretID string, userID int) ([]*SecretVersion, error) {
+	var result []*SecretVersion
+	history := m.versions[secretID]
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].UserID == userID {
+			result = append(result, history[i])
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) GetSecretVersion(secretID string, userID int, version int) (*SecretVersion, error) {
+	for _, v := range m.versions[secretID] {
+		if v.UserID == userID && v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
+
+func (m *MockRepository) PruneSecretVersions(secretID string, keep int) error {
+	if history := m.versions[secretID]; len(history) > keep {
+		m.versions[secretID] = history[len(history)-keep:]
+	}
+	return nil
+}
+
+func (m *MockRepository) ApplyChanges(userID int, changes []*SecretChange) ([]*PushResult, error) {
+	results := make([]*PushResult, len(changes))
+	for i, change := range changes {
+		secret := change.Secret
+		secret.UserID = userID
+
+		if change.Action == PushCreate {
+			if existing, exists := m.secrets[secret.ID]; exists {
+				results[i] = &PushResult{Status: PushConflict, Secret: existing}
+				continue
+			}
+			_ = m.CreateSecret(secret)
+			results[i] = &PushResult{Status: PushApplied, Secret: secret}
+			continue
+		}
+
+		var existing *Secret
+		if stored, ok := m.secrets[secret.ID]; ok {
+			existing = m.visible(stored, userID)
+		}
+		switch {
+		case existing == nil || existing.DeletedAt.Valid:
+			results[i] = &PushResult{Status: PushNotFound}
+		case change.Action == PushUpdate && !existing.Share.CanWrite(),
+			change.Action == PushDelete && existing.Share != nil:
+			results[i] = &PushResult{Status: PushInvalid, Err: ErrForbidden}
+		case change.Action == PushUpdate && existing.Version != secret.Version,
+			change.Action == PushDelete && secret.Version != 0 && existing.Version != secret.Version:
+			results[i] = &PushResult{Status: PushConflict, Secret: existing}
+		case change.Action == PushUpdate:
+			secret.UserID = existing.UserID
+			secret.CreatedAt = existing.CreatedAt
+			_ = m.UpdateSecret(secret)
+			if existing.Share != nil {
+				secret.applyShare(existing.Share)
+			}
+			results[i] = &PushResult{Status: PushApplied, Secret: secret}
+		default:
+			_ = m.SoftDeleteSecret(secret.ID, userID, 0)
+			results[i] = &PushResult{Status: PushApplied}
+		}
+	}
+	return results, nil
+}
+
+func (m *MockRepository) GetSharedSecretChanges(userID int, afterSeq int64, limit int) ([]*Secret, error) {
+	var result []*Secret
+	for _, sh := range m.shares {
+		if sh.share.GranteeID != userID || sh.changeSeq <= afterSeq {
+			continue
+		}
+		secret := m.secrets[sh.share.SecretID]
+		if !sh.revokedAt.IsZero() {
+			result = append(result, &Secret{
+				ID:        secret.ID,
+				UserID:    secret.UserID,
+				Type:      secret.Type,
+				Version:   secret.Version,
+				DeletedAt: sql.NullTime{Time: sh.revokedAt, Valid: true},
+				ChangeSeq: sh.changeSeq,
+			})
+			continue
+		}
+		result = append(result, m.visible(secret, userID))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ChangeSeq < result[j].ChangeSeq })
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *MockRepository) GetShare(secretID string, granteeID int) (*SecretShare, error) {
+	sh := m.liveShare(secretID, granteeID)
+	if sh == nil || m.secrets[secretID].DeletedAt.Valid {
+		return nil, ErrShareNotFound
+	}
+	share := sh.share
+	return &share, nil
+}
+
+func (m *MockRepository) GetShareGrantees(secretID string) ([]int, error) {
+	var grantees []int
+	for _, sh := range m.shares {
+		if sh.share.SecretID == secretID && sh.revokedAt.IsZero() {
+			grantees = append(grantees, sh.share.GranteeID)
+		}
+	}
+	sort.Ints(grantees)
+	return grantees, nil
+}
+
+func (m *MockRepository) ListShares(secretID string, ownerID int) ([]*SecretShare, error) {
+	secret, ok := m.secrets[secretID]
+	if !ok || secret.UserID != ownerID {
+		return nil, ErrSecretNotFound
+	}
+	shares := []*SecretShare{}
+	for _, sh := range m.shares {
+		if sh.share.SecretID == secretID && sh.revokedAt.IsZero() {
+			share := sh.share
+			shares = append(shares, &share)
+		}
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].GranteeEmail < shares[j].GranteeEmail })
+	return shares, nil
+}
+
+func (m *MockRepository) ShareSecret(share *SecretShare) error {
+	granteeID, ok := m.users[share.GranteeEmail]
+	if !ok {
+		return ErrGranteeNotFound
+	}
+	if granteeID == share.OwnerID {
+		return ErrShareWithSelf
+	}
+	secret, ok := m.secrets[share.SecretID]
+	if !ok || secret.UserID != share.OwnerID || secret.DeletedAt.Valid {
+		return ErrSecretNotFound
+	}
+
+	share.GranteeID = granteeID
+	share.UpdatedAt = time.Now()
+	share.CreatedAt = share.UpdatedAt
+	if existing := m.liveShare(share.SecretID, granteeID); existing != nil {
+		share.CreatedAt = existing.share.CreatedAt
+	}
+	m.changeSeq++
+	m.shares[fmt.Sprintf("%s/%d", share.SecretID, granteeID)] = &mockShare{share: *share, changeSeq: m.changeSeq}
 	return nil
 }
 
+func (m *MockRepository) RevokeShare(secretID string, granteeID int, userID int) (int, error) {
+	sh := m.liveShare(secretID, granteeID)
+	if sh == nil || (sh.share.OwnerID != userID && granteeID != userID) {
+		return 0, ErrShareNotFound
+	}
+	m.changeSeq++
+	sh.changeSeq = m.changeSeq
+	sh.revokedAt = time.Now()
+	return sh.share.OwnerID, nil
+}
+
 func TestService_CreateSecret(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
@@ -130,144 +649,916 @@ func TestService_CreateSecret_Validation(t *testing.T) {
 			wantErr: ErrLoginRequired,
 		},
 		{
-			name: "empty password",
-			req: &CreateSecretRequest{
-				Login:    "login",
-				Password: "",
-			},
-			wantErr: ErrPasswordRequired,
+			name: "empty password",
+			req: &CreateSecretRequest{
+				Login:    "login",
+				Password: "",
+			},
+			wantErr: ErrPasswordRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateSecret(1, tt.req, "")
+			if err != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestService_CreateSecret_ClientID(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	req := &CreateSecretRequest{
+		ID:       "6BA7B810-9DAD-11D1-80B4-00C04FD430C8",
+		Login:    "login",
+		Password: "password",
+	}
+
+	secret, err := service.CreateSecret(1, req, "")
+	if err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	if secret.ID != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("Expected client ID in canonical form, got %s", secret.ID)
+	}
+
+	// Повтор создания не создает дубликат
+	if _, err := service.CreateSecret(1, req, ""); !errors.Is(err, ErrSecretAlreadyExists) {
+		t.Errorf("Expected ErrSecretAlreadyExists, got %v", err)
+	}
+	if len(repo.secrets) != 1 {
+		t.Errorf("Expected 1 secret, got %d", len(repo.secrets))
+	}
+
+	req.ID = "not-a-uuid"
+	if _, err := service.CreateSecret(1, req, ""); err != ErrInvalidID {
+		t.Errorf("Expected ErrInvalidID, got %v", err)
+	}
+}
+
+func TestService_GetSecretsForSync(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	var created []*Secret
+	for i := 0; i < 3; i++ {
+		secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: fmt.Sprintf("login-%d", i), Password: "p"}, "")
+		created = append(created, secret)
+	}
+
+	page, err := service.GetSecretsForSync(1, "", 2)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Secrets) != 2 || !page.HasMore {
+		t.Fatalf("Expected first page of 2 with has_more, got %d (has_more=%v)", len(page.Secrets), page.HasMore)
+	}
+	if page.Secrets[0].ID != created[0].ID || page.Secrets[1].ID != created[1].ID {
+		t.Error("Expected secrets in change order")
+	}
+
+	page, err = service.GetSecretsForSync(1, page.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Secrets) != 1 || page.HasMore || page.Secrets[0].ID != created[2].ID {
+		t.Fatalf("Expected last page with 1 secret, got %d (has_more=%v)", len(page.Secrets), page.HasMore)
+	}
+	cursor := page.NextCursor
+
+	// Без новых изменений курсор не двигается
+	empty, _ := service.GetSecretsForSync(1, cursor, 0)
+	if len(empty.Secrets) != 0 || empty.NextCursor != cursor {
+		t.Errorf("Expected empty page with the same cursor, got %d secrets", len(empty.Secrets))
+	}
+
+	// Изменение старого секрета и удаление попадают в следующую страницу
+	_, _ = service.UpdateSecret(created[0].ID, 1, &UpdateSecretRequest{Login: "updated", Password: "p", Version: created[0].Version}, "")
+	_ = service.DeleteSecret(created[1].ID, 1, 0, "")
+
+	changes, _ := service.GetSecretsForSync(1, cursor, 0)
+	if len(changes.Secrets) != 2 {
+		t.Fatalf("Expected 2 changes, got %d", len(changes.Secrets))
+	}
+	if changes.Secrets[0].Login != "updated" || !changes.Secrets[1].DeletedAt.Valid {
+		t.Error("Expected update followed by tombstone")
+	}
+}
+
+// mockFolderFeed отдает папки, пронумерованные тем же счетчиком, что и секреты MockRepository
+type mockFolderFeed struct {
+	folders []*folder.Folder
+}
+
+func (m *mockFolderFeed) GetFolderChanges(userID int, afterSeq int64, limit int) ([]*folder.Folder, error) {
+	var result []*folder.Folder
+	for _, f := range m.folders {
+		if f.UserID == userID && f.ChangeSeq > afterSeq && len(result) < limit {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+func TestService_GetSecretsForSync_WithFolders(t *testing.T) {
+	repo := NewMockRepository()
+	feed := &mockFolderFeed{}
+	service := NewService(repo)
+	service.SetFolderFeed(feed)
+
+	// Порядок изменений: секрет, папка, секрет, папка
+	for i := 0; i < 2; i++ {
+		_, _ = service.CreateSecret(1, &CreateSecretRequest{Login: fmt.Sprintf("login-%d", i), Password: "p"}, "")
+		repo.changeSeq++
+		feed.folders = append(feed.folders, &folder.Folder{ID: fmt.Sprintf("folder-%d", i), UserID: 1, Name: "f", ChangeSeq: repo.changeSeq})
+	}
+
+	page, err := service.GetSecretsForSync(1, "", 3)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Secrets) != 2 || len(page.Folders) != 1 || !page.HasMore {
+		t.Fatalf("Expected 2 secrets and 1 folder with has_more, got %d and %d (has_more=%v)",
+			len(page.Secrets), len(page.Folders), page.HasMore)
+	}
+
+	page, err = service.GetSecretsForSync(1, page.NextCursor, 3)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Secrets) != 0 || len(page.Folders) != 1 || page.HasMore || page.Folders[0].ID != "folder-1" {
+		t.Fatalf("Expected last page with folder-1, got %d secrets and %d folders", len(page.Secrets), len(page.Folders))
+	}
+}
+
+// mockTagFeed отдает метки, пронумерованные тем же счетчиком, что и секреты MockRepository
+type mockTagFeed struct {
+	tags []*tag.Tag
+}
+
+func (m *mockTagFeed) GetTagChanges(userID int, afterSeq int64, limit int) ([]*tag.Tag, error) {
+	var result []*tag.Tag
+	for _, t := range m.tags {
+		if t.UserID == userID && t.ChangeSeq > afterSeq && len(result) < limit {
+			result = append(result, t)
+		}
+	}
+	return result, nil
+}
+
+func TestService_GetSecretsForSync_WithTags(t *testing.T) {
+	repo := NewMockRepository()
+	folders := &mockFolderFeed{}
+	tags := &mockTagFeed{}
+	service := NewService(repo)
+	service.SetFolderFeed(folders)
+	service.SetTagFeed(tags)
+
+	// Порядок изменений: метка, секрет, папка, метка
+	repo.changeSeq++
+	tags.tags = append(tags.tags, &tag.Tag{ID: "tag-0", UserID: 1, Name: "prod", ChangeSeq: repo.changeSeq})
+	_, _ = service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "p"}, "")
+	repo.changeSeq++
+	folders.folders = append(folders.folders, &folder.Folder{ID: "folder-0", UserID: 1, Name: "f", ChangeSeq: repo.changeSeq})
+	repo.changeSeq++
+	tags.tags = append(tags.tags, &tag.Tag{ID: "tag-1", UserID: 1, Name: "dev", ChangeSeq: repo.changeSeq})
+
+	page, err := service.GetSecretsForSync(1, "", 2)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Tags) != 1 || len(page.Secrets) != 1 || len(page.Folders) != 0 || !page.HasMore {
+		t.Fatalf("Expected 1 tag and 1 secret with has_more, got %d tags, %d secrets, %d folders",
+			len(page.Tags), len(page.Secrets), len(page.Folders))
+	}
+
+	page, err = service.GetSecretsForSync(1, page.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Secrets) != 0 || len(page.Folders) != 1 || len(page.Tags) != 1 || page.HasMore || page.Tags[0].ID != "tag-1" {
+		t.Fatalf("Expected last page with folder-0 and tag-1, got %d folders and %d tags", len(page.Folders), len(page.Tags))
+	}
+}
+
+func TestTakeChanges(t *testing.T) {
+	counts, hasMore := takeChanges(3, []int64{1, 5}, []int64{2, 3, 4}, nil)
+	if !reflect.DeepEqual(counts, []int{1, 2, 0}) || !hasMore {
+		t.Errorf("Expected [1 2 0] with has_more, got %v (has_more=%v)", counts, hasMore)
+	}
+
+	counts, hasMore = takeChanges(10, []int64{1}, []int64{2})
+	if !reflect.DeepEqual(counts, []int{1, 1}) || hasMore {
+		t.Errorf("Expected [1 1] without has_more, got %v (has_more=%v)", counts, hasMore)
+	}
+}
+
+const sharedSecretID = "11111111-1111-1111-1111-111111111111"
+
+// newSharingService создает секрет владельца 1; пользователь 2 - будущий получатель доступа
+func newSharingService(t *testing.T) (*Service, *MockRepository, *MockRealtimeService) {
+	repo := NewMockRepository()
+	repo.users["owner@example.com"] = 1
+	repo.users["friend@example.com"] = 2
+	repo.folders["22222222-2222-2222-2222-222222222222"] = 1
+	realtime := &MockRealtimeService{}
+	service := NewService(repo)
+	service.SetRealtimeService(realtime)
+
+	_, err := service.CreateSecret(1, &CreateSecretRequest{
+		ID:       sharedSecretID,
+		Login:    "login",
+		Password: "password",
+		FolderID: "22222222-2222-2222-2222-222222222222",
+	}, "")
+	if err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+
+	return service, repo, realtime
+}
+
+func TestService_ShareSecret_Validation(t *testing.T) {
+	service, _, _ := newSharingService(t)
+
+	tests := []struct {
+		name string
+		id   string
+		req  *ShareSecretRequest
+		err  error
+	}{
+		{"nil request", sharedSecretID, nil, ErrRequestRequired},
+		{"empty email", sharedSecretID, &ShareSecretRequest{Email: " ", WrappedKey: "k"}, ErrEmailRequired},
+		{"invalid permission", sharedSecretID, &ShareSecretRequest{Email: "friend@example.com", Permission: "admin", WrappedKey: "k"}, ErrInvalidPermission},
+		{"empty key", sharedSecretID, &ShareSecretRequest{Email: "friend@example.com"}, ErrWrappedKeyInvalid},
+		{"too long key", sharedSecretID, &ShareSecretRequest{Email: "friend@example.com", WrappedKey: strings.Repeat("k", MaxWrappedKeyLength+1)}, ErrWrappedKeyInvalid},
+		{"unknown grantee", sharedSecretID, &ShareSecretRequest{Email: "nobody@example.com", WrappedKey: "k"}, ErrGranteeNotFound},
+		{"self", sharedSecretID, &ShareSecretRequest{Email: "owner@example.com", WrappedKey: "k"}, ErrShareWithSelf},
+		{"not uuid", "secret", &ShareSecretRequest{Email: "friend@example.com", WrappedKey: "k"}, ErrSecretNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.ShareSecret(tt.id, 1, tt.req, ""); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestService_ShareSecret_Permissions(t *testing.T) {
+	service, _, realtime := newSharingService(t)
+
+	share, err := service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", WrappedKey: "key-for-friend"}, "session-1")
+	if err != nil {
+		t.Fatalf("ShareSecret failed: %v", err)
+	}
+	if share.GranteeID != 2 || share.Permission != PermissionRead {
+		t.Errorf("Expected read access for user 2, got %+v", share)
+	}
+	if !reflect.DeepEqual(realtime.SharedUsers, []int{1, 2}) {
+		t.Errorf("Expected secret_shared for owner and grantee, got %v", realtime.SharedUsers)
+	}
+
+	// Получатель видит секрет с ключом, но без папки владельца
+	secret, err := service.GetSecret(sharedSecretID, 2)
+	if err != nil {
+		t.Fatalf("GetSecret by grantee failed: %v", err)
+	}
+	if secret.Share == nil || secret.Share.WrappedKey != "key-for-friend" || secret.Share.OwnerEmail != "owner@example.com" {
+		t.Errorf("Expected share access in secret, got %+v", secret.Share)
+	}
+	if secret.FolderID != "" {
+		t.Errorf("Expected owner's folder to be hidden, got %s", secret.FolderID)
+	}
+
+	if _, err := service.UpdateSecret(sharedSecretID, 2, &UpdateSecretRequest{Login: "x", Password: "y", Version: 1}, ""); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for read-only update, got %v", err)
+	}
+	if _, err := service.UploadBlob(sharedSecretID, 2, 1, strings.NewReader("data"), ""); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for read-only upload, got %v", err)
+	}
+	if err := service.DeleteSecret(sharedSecretID, 2, 0, ""); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for delete by grantee, got %v", err)
+	}
+	if _, err := service.ListShares(sharedSecretID, 2); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for listing by grantee, got %v", err)
+	}
+	if err := service.DeleteSecret(sharedSecretID, 3, 0, ""); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Expected ErrSecretNotFound for stranger, got %v", err)
+	}
+
+	// Повторная выдача меняет право
+	if _, err := service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", Permission: PermissionWrite, WrappedKey: "key-for-friend"}, ""); err != nil {
+		t.Fatalf("ShareSecret with write failed: %v", err)
+	}
+
+	realtime.UpdatedUsers = nil
+	updated, err := service.UpdateSecret(sharedSecretID, 2, &UpdateSecretRequest{Login: "new", Password: "y", Version: 1}, "")
+	if err != nil {
+		t.Fatalf("UpdateSecret by grantee failed: %v", err)
+	}
+	if updated.Share == nil || updated.FolderID != "" {
+		t.Errorf("Expected grantee's view of updated secret, got share %+v and folder %q", updated.Share, updated.FolderID)
+	}
+	if !reflect.DeepEqual(realtime.UpdatedUsers, []int{1, 2}) {
+		t.Errorf("Expected secret_updated for owner and grantee, got %v", realtime.UpdatedUsers)
+	}
+
+	owned, _ := service.GetSecret(sharedSecretID, 1)
+	if owned.Login != "new" || owned.Share != nil || owned.FolderID == "" {
+		t.Errorf("Expected owner to see grantee's change in own folder, got %+v", owned)
+	}
+
+	shares, err := service.ListShares(sharedSecretID, 1)
+	if err != nil || len(shares) != 1 || shares[0].Permission != PermissionWrite {
+		t.Fatalf("Expected one write share, got %v (%v)", shares, err)
+	}
+}
+
+func TestService_PushChanges_SharedSecret(t *testing.T) {
+	service, repo, realtime := newSharingService(t)
+	_, _ = service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", WrappedKey: "k"}, "")
+
+	push := func(op PushOperation) *PushResult {
+		t.Helper()
+		results, err := service.PushChanges(2, &PushRequest{Operations: []PushOperation{op}}, "")
+		if err != nil {
+			t.Fatalf("PushChanges failed: %v", err)
+		}
+		return results[0]
+	}
+	update := PushOperation{ClientID: "op", Action: PushUpdate, SecretID: sharedSecretID, BaseVersion: 1, Login: "pushed", Password: "p"}
+
+	if result := push(update); result.Status != PushInvalid || !errors.Is(result.Err, ErrForbidden) {
+		t.Errorf("Expected forbidden update with read access, got %s (%v)", result.Status, result.Err)
+	}
+
+	_, _ = service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", Permission: PermissionWrite, WrappedKey: "k"}, "")
+	realtime.UpdatedUsers, realtime.BatchCalls = nil, 0
+
+	result := push(update)
+	if result.Status != PushApplied || result.Secret.Share == nil {
+		t.Fatalf("Expected applied update with grantee's view, got %s (%+v)", result.Status, result.Secret)
+	}
+	if owned := repo.secrets[sharedSecretID]; owned.Login != "pushed" || owned.UserID != 1 {
+		t.Errorf("Expected owner's secret to be updated, got %+v", owned)
+	}
+	if !reflect.DeepEqual(realtime.UpdatedUsers, []int{1, 2}) || realtime.BatchCalls != 0 {
+		t.Errorf("Expected secret_updated for owner and grantee, got %v (batches %d)", realtime.UpdatedUsers, realtime.BatchCalls)
+	}
+
+	if result := push(PushOperation{ClientID: "op", Action: PushDelete, SecretID: sharedSecretID}); result.Status != PushInvalid || !errors.Is(result.Err, ErrForbidden) {
+		t.Errorf("Expected forbidden delete by grantee, got %s (%v)", result.Status, result.Err)
+	}
+}
+
+func TestService_RevokeShare(t *testing.T) {
+	service, _, realtime := newSharingService(t)
+	_, _ = service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", WrappedKey: "k"}, "")
+
+	if err := service.RevokeShare(sharedSecretID, 3, 2, ""); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Expected ErrShareNotFound for stranger, got %v", err)
+	}
+
+	// Получатель может сам отказаться от доступа
+	if err := service.RevokeShare(sharedSecretID, 2, 2, ""); err != nil {
+		t.Fatalf("RevokeShare failed: %v", err)
+	}
+	if !reflect.DeepEqual(realtime.UnsharedUsers, []int{1, 2}) {
+		t.Errorf("Expected secret_unshared for owner and grantee, got %v", realtime.UnsharedUsers)
+	}
+	if _, err := service.GetSecret(sharedSecretID, 2); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Expected ErrSecretNotFound after revoke, got %v", err)
+	}
+	if err := service.RevokeShare(sharedSecretID, 1, 2, ""); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Expected ErrShareNotFound for repeated revoke, got %v", err)
+	}
+}
+
+func TestService_GetSecretsForSync_Shared(t *testing.T) {
+	service, _, _ := newSharingService(t)
+	_, _ = service.CreateSecret(2, &CreateSecretRequest{Login: "own", Password: "p"}, "")
+	_, _ = service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", WrappedKey: "k"}, "")
+
+	page, err := service.GetSecretsForSync(2, "", 10)
+	if err != nil {
+		t.Fatalf("GetSecretsForSync failed: %v", err)
+	}
+	if len(page.Secrets) != 2 || page.Secrets[0].Login != "own" || page.Secrets[1].Share == nil {
+		t.Fatalf("Expected own secret followed by shared one, got %d secrets", len(page.Secrets))
+	}
+
+	// Изменение владельцем приходит получателю
+	if _, err := service.UpdateSecret(sharedSecretID, 1, &UpdateSecretRequest{Login: "changed", Password: "p", Version: 1}, ""); err != nil {
+		t.Fatalf("UpdateSecret failed: %v", err)
+	}
+	page, _ = service.GetSecretsForSync(2, page.NextCursor, 10)
+	if len(page.Secrets) != 1 || page.Secrets[0].Login != "changed" {
+		t.Fatalf("Expected updated shared secret, got %d secrets", len(page.Secrets))
+	}
+
+	// Отзыв доступа приходит надгробием без содержимого
+	_ = service.RevokeShare(sharedSecretID, 1, 2, "")
+	page, _ = service.GetSecretsForSync(2, page.NextCursor, 10)
+	if len(page.Secrets) != 1 || !page.Secrets[0].DeletedAt.Valid || page.Secrets[0].Login != "" {
+		t.Fatalf("Expected tombstone for revoked share, got %+v", page.Secrets)
+	}
+
+	// Владелец видит только свой секрет
+	page, _ = service.GetSecretsForSync(1, "", 10)
+	if len(page.Secrets) != 1 || page.Secrets[0].Share != nil {
+		t.Errorf("Expected only owner's secret in owner's sync, got %d", len(page.Secrets))
+	}
+}
+
+func TestService_ListSecrets_Shared(t *testing.T) {
+	service, _, _ := newSharingService(t)
+	_, _ = service.ShareSecret(sharedSecretID, 1, &ShareSecretRequest{Email: "friend@example.com", WrappedKey: "k"}, "")
+
+	page, err := service.ListSecrets(2, &ListSecretsQuery{})
+	if err != nil {
+		t.Fatalf("ListSecrets failed: %v", err)
+	}
+	if len(page.Secrets) != 1 || page.Secrets[0].Shared == nil || page.Secrets[0].Shared.Permission != PermissionRead {
+		t.Fatalf("Expected shared secret in grantee's list, got %+v", page.Secrets)
+	}
+}
+
+func TestService_GetSecretsForSync_InvalidCursor(t *testing.T) {
+	service := NewService(NewMockRepository())
+
+	for _, cursor := range []string{"not base64!", "bm90LWpzb24", encodeSyncCursor(-1)} {
+		if _, err := service.GetSecretsForSync(1, cursor, 0); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor for %q, got %v", cursor, err)
+		}
+	}
+}
+
+func TestService_GetSecretsForSync_Limit(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	for i := 0; i < MaxSyncLimit+1; i++ {
+		_, _ = service.CreateSecret(1, &CreateSecretRequest{Login: "l", Password: "p"}, "")
+	}
+
+	page, _ := service.GetSecretsForSync(1, "", 0)
+	if len(page.Secrets) != DefaultSyncLimit || !page.HasMore {
+		t.Errorf("Expected default limit %d, got %d", DefaultSyncLimit, len(page.Secrets))
+	}
+
+	page, _ = service.GetSecretsForSync(1, "", MaxSyncLimit*2)
+	if len(page.Secrets) != MaxSyncLimit || !page.HasMore {
+		t.Errorf("Expected limit capped at %d, got %d", MaxSyncLimit, len(page.Secrets))
+	}
+}
+
+func TestService_UpdateSecret_Merge(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	base, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+		Metadata: map[string]interface{}{"url": "a.example", "note": "n"},
+	}, "")
+
+	// Другое устройство меняет пароль и ключ url
+	_, err := service.UpdateSecret(base.ID, 1, &UpdateSecretRequest{
+		Login:    "login",
+		Password: "server-password",
+		Metadata: map[string]interface{}{"url": "b.example", "note": "n"},
+		Version:  1,
+	}, "")
+	if err != nil {
+		t.Fatalf("UpdateSecret failed: %v", err)
+	}
+
+	// Без merge устаревшая версия - обычный конфликт
+	stale := &UpdateSecretRequest{
+		Login:    "new-login",
+		Password: "password",
+		Metadata: map[string]interface{}{"url": "a.example", "tag": "work"},
+		Version:  1,
+	}
+	if _, err := service.UpdateSecret(base.ID, 1, stale, ""); err != ErrVersionConflict {
+		t.Fatalf("Expected ErrVersionConflict without merge, got %v", err)
+	}
+
+	// Клиент менял логин, добавил tag и удалил note - это не пересекается с сервером
+	stale.Merge = true
+	merged, err := service.UpdateSecret(base.ID, 1, stale, "")
+	if err != nil {
+		t.Fatalf("Expected merge to succeed, got %v", err)
+	}
+	if merged.Version != 3 {
+		t.Errorf("Expected version 3, got %d", merged.Version)
+	}
+	if merged.Login != "new-login" || merged.Password != "server-password" {
+		t.Errorf("Expected local login and server password, got %q/%q", merged.Login, merged.Password)
+	}
+	want := map[string]interface{}{"url": "b.example", "tag": "work"}
+	if !reflect.DeepEqual(merged.Metadata, want) {
+		t.Errorf("Expected metadata %v, got %v", want, merged.Metadata)
+	}
+}
+
+func TestService_UpdateSecret_MergeConflict(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	base, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+		Metadata: map[string]interface{}{"url": "a.example"},
+	}, "")
+	_, _ = service.UpdateSecret(base.ID, 1, &UpdateSecretRequest{
+		Login:    "login",
+		Password: "server-password",
+		Metadata: map[string]interface{}{"url": "b.example"},
+		Version:  1,
+	}, "")
+
+	_, err := service.UpdateSecret(base.ID, 1, &UpdateSecretRequest{
+		Login:    "login",
+		Password: "local-password",
+		Metadata: map[string]interface{}{"url": "c.example"},
+		Version:  1,
+		Merge:    true,
+	}, "")
+
+	var mergeErr *MergeConflictError
+	if !errors.As(err, &mergeErr) {
+		t.Fatalf("Expected MergeConflictError, got %v", err)
+	}
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Error("Expected merge conflict to match ErrVersionConflict")
+	}
+	if !reflect.DeepEqual(mergeErr.Fields, []string{"password", "metadata.url"}) {
+		t.Errorf("Expected password and metadata.url conflicts, got %v", mergeErr.Fields)
+	}
+	if mergeErr.Current.Version != 2 || repo.secrets[base.ID].Password != "server-password" {
+		t.Error("Expected server copy to stay unchanged")
+	}
+}
+
+func TestService_UpdateSecret_MergeWithoutBase(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	base, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+	_, _ = service.UpdateSecret(base.ID, 1, &UpdateSecretRequest{Login: "login", Password: "p2", Version: 1}, "")
+	delete(repo.versions, base.ID)
+
+	_, err := service.UpdateSecret(base.ID, 1, &UpdateSecretRequest{Login: "l2", Password: "password", Version: 1, Merge: true}, "")
+	if err != ErrVersionConflict {
+		t.Errorf("Expected plain ErrVersionConflict when base version is pruned, got %v", err)
+	}
+}
+
+func TestService_UpdateSecret_VersionConflict(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	createReq := &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+	}
+	secret, _ := service.CreateSecret(1, createReq, "")
+
+	updateReq := &UpdateSecretRequest{
+		Login:    "new_login",
+		Password: "new_password",
+		Version:  999,
+	}
+
+	_, err := service.UpdateSecret(secret.ID, 1, updateReq, "")
+	if err != ErrVersionConflict {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+}
+
+func TestService_GetSecret(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	createReq := &CreateSecretRequest{
+		Login:    "test_login",
+		Password: "test_password",
+		Metadata: map[string]interface{}{"key": "value"},
+	}
+	created, _ := service.CreateSecret(1, createReq, "")
+
+	secret, err := service.GetSecret(created.ID, 1)
+	if err != nil {
+		t.Fatalf("GetSecret failed: %v", err)
+	}
+
+	if secret.ID != created.ID {
+		t.Errorf("Expected secret ID %s, got %s", created.ID, secret.ID)
+	}
+	if secret.Login != createReq.Login {
+		t.Errorf("Expected login %s, got %s", createReq.Login, secret.Login)
+	}
+}
+
+func TestService_GetSecret_NotFound(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	_, err := service.GetSecret("nonexistent", 1)
+	if err != ErrSecretNotFound {
+		t.Errorf("Expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestService_ListSecrets_Pagination(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, login := range []string{"carol", "alice", "dave", "bob", "erin"} {
+		secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: login, Password: "p"}, "")
+		secret.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+	}
+	service.CreateSecret(2, &CreateSecretRequest{Login: "other", Password: "p"}, "")
+
+	var logins []string
+	query := &ListSecretsQuery{Sort: SortLogin, Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("Pagination did not stop")
+		}
+		page, err := service.ListSecrets(1, query)
+		if err != nil {
+			t.Fatalf("ListSecrets failed: %v", err)
+		}
+		for _, secret := range page.Secrets {
+			logins = append(logins, secret.Login)
+		}
+		if !page.HasMore {
+			if page.NextCursor != "" {
+				t.Error("Expected no cursor on the last page")
+			}
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	if !reflect.DeepEqual(logins, []string{"alice", "bob", "carol", "dave", "erin"}) {
+		t.Errorf("Unexpected order: %v", logins)
+	}
+
+	page, err := service.ListSecrets(1, &ListSecretsQuery{Sort: SortCreated, Desc: true, Limit: 2})
+	if err != nil {
+		t.Fatalf("ListSecrets failed: %v", err)
+	}
+	if len(page.Secrets) != 2 || page.Secrets[0].Login != "erin" || page.Secrets[1].Login != "bob" {
+		t.Errorf("Expected newest first, got %+v", page.Secrets)
+	}
+
+	// Курсор от другой сортировки не подходит
+	_, err = service.ListSecrets(1, &ListSecretsQuery{Sort: SortLogin, Cursor: page.NextCursor})
+	if err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestService_ListSecrets_FiltersWithoutBinaryData(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	file, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Type:       TypeFile,
+		Metadata:   map[string]interface{}{"app": "drive", "folder": "work"},
+		BinaryData: []byte("large file"),
+	}, "")
+	file.BlobSize = int64(len(file.BinaryData))
+	service.CreateSecret(1, &CreateSecretRequest{
+		Login:    "login",
+		Password: "password",
+		Metadata: map[string]interface{}{"app": "github"},
+	}, "")
+
+	page, err := service.ListSecrets(1, &ListSecretsQuery{Metadata: map[string]string{"app": "drive"}})
+	if err != nil {
+		t.Fatalf("ListSecrets failed: %v", err)
+	}
+	if len(page.Secrets) != 1 || page.Secrets[0].ID != file.ID {
+		t.Fatalf("Expected only file secret, got %+v", page.Secrets)
+	}
+	if page.Secrets[0].BinaryData != nil {
+		t.Error("List must not contain binary data")
+	}
+	if page.Secrets[0].BinaryDataSize == nil || *page.Secrets[0].BinaryDataSize != file.BlobSize {
+		t.Errorf("Expected binary data size %d, got %v", file.BlobSize, page.Secrets[0].BinaryDataSize)
+	}
+
+	page, _ = service.ListSecrets(1, &ListSecretsQuery{MetadataKeys: []string{"folder"}})
+	if len(page.Secrets) != 1 || page.Secrets[0].ID != file.ID {
+		t.Errorf("Expected secrets with folder key, got %+v", page.Secrets)
+	}
+
+	if _, err := service.ListSecrets(1, &ListSecretsQuery{Type: "unknown"}); err != ErrInvalidType {
+		t.Errorf("Expected ErrInvalidType, got %v", err)
+	}
+}
+
+func TestService_CreateSecret_Types(t *testing.T) {
+	card := &CardData{Number: "4111", Expiry: "12/30", Holder: "IVAN IVANOV", CVV: "123"}
+
+	tests := []struct {
+		name    string
+		req     *CreateSecretRequest
+		wantErr error
+	}{
+		{
+			name: "default type is login",
+			req:  &CreateSecretRequest{Login: "login", Password: "password"},
+		},
+		{
+			name:    "unknown type",
+			req:     &CreateSecretRequest{Type: "bank", Login: "login", Password: "password"},
+			wantErr: ErrInvalidType,
+		},
+		{
+			name: "text without login",
+			req:  &CreateSecretRequest{Type: TypeText, Text: "note"},
+		},
+		{
+			name:    "empty text",
+			req:     &CreateSecretRequest{Type: TypeText},
+			wantErr: ErrTextRequired,
+		},
+		{
+			name:    "text with password",
+			req:     &CreateSecretRequest{Type: TypeText, Text: "note", Password: "password"},
+			wantErr: ErrUnexpectedFields,
+		},
+		{
+			name: "card",
+			req:  &CreateSecretRequest{Type: TypeCard, Card: card},
+		},
+		{
+			name:    "card without cvv",
+			req:     &CreateSecretRequest{Type: TypeCard, Card: &CardData{Number: "4111", Expiry: "12/30", Holder: "IVAN IVANOV"}},
+			wantErr: ErrCardRequired,
+		},
+		{
+			name:    "card in login secret",
+			req:     &CreateSecretRequest{Login: "login", Password: "password", Card: card},
+			wantErr: ErrUnexpectedFields,
+		},
+		{
+			name: "file",
+			req:  &CreateSecretRequest{Type: TypeFile, BinaryData: []byte("data")},
+		},
+		{
+			name:    "file without data",
+			req:     &CreateSecretRequest{Type: TypeFile},
+			wantErr: ErrFileRequired,
+		},
+		{
+			name:    "file with login",
+			req:     &CreateSecretRequest{Type: TypeFile, Login: "login", BinaryData: []byte("data")},
+			wantErr: ErrUnexpectedFields,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := service.CreateSecret(1, tt.req, "")
+			service := NewService(NewMockRepository())
+
+			secret, err := service.CreateSecret(1, tt.req, "")
 			if err != tt.wantErr {
-				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && secret.Type != normalizeType(tt.req.Type) {
+				t.Errorf("Expected type %s, got %s", normalizeType(tt.req.Type), secret.Type)
 			}
 		})
 	}
 }
 
-func TestService_GetSecretsForSync(t *testing.T) {
+func TestService_UpdateSecret_ChangesType(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
 
-	req := &CreateSecretRequest{
-		Login:    "encrypted_login",
-		Password: "encrypted_password",
-	}
-	secret, _ := service.CreateSecret(1, req, "")
-
-	resp, err := service.GetSecretsForSync(1, nil)
-	if err != nil {
-		t.Fatalf("GetSecretsForSync failed: %v", err)
-	}
-
-	if len(resp.Secrets) != 1 {
-		t.Errorf("Expected 1 secret, got %d", len(resp.Secrets))
-	}
-
-	if resp.ServerTime.IsZero() {
-		t.Error("Expected ServerTime to be set")
-	}
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
 
-	since := secret.CreatedAt.Add(-1 * time.Second)
-	resp2, err := service.GetSecretsForSync(1, &since)
+	updated, err := service.UpdateSecret(secret.ID, 1, &UpdateSecretRequest{
+		Type:    TypeText,
+		Text:    "note",
+		Version: 1,
+	}, "")
 	if err != nil {
-		t.Fatalf("GetSecretsForSync failed: %v", err)
+		t.Fatalf("UpdateSecret failed: %v", err)
 	}
 
-	if len(resp2.Secrets) != 1 {
-		t.Errorf("Expected 1 modified secret, got %d", len(resp2.Secrets))
+	if updated.Type != TypeText || updated.Text != "note" || updated.Login != "" {
+		t.Errorf("Expected text secret without login, got %+v", updated)
 	}
 }
 
-func TestService_UpdateSecret_VersionConflict(t *testing.T) {
+func TestService_UpdateSecret_KeepsTypeWhenOmitted(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
 
-	createReq := &CreateSecretRequest{
-		Login:    "login",
-		Password: "password",
-	}
-	secret, _ := service.CreateSecret(1, createReq, "")
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeText, Text: "note"}, "")
 
-	updateReq := &UpdateSecretRequest{
-		Login:    "new_login",
-		Password: "new_password",
-		Version:  999,
+	updated, err := service.UpdateSecret(secret.ID, 1, &UpdateSecretRequest{
+		Text:    "new note",
+		Version: 1,
+	}, "")
+	if err != nil {
+		t.Fatalf("UpdateSecret failed: %v", err)
 	}
 
-	_, err := service.UpdateSecret(secret.ID, 1, updateReq, "")
-	if err != ErrVersionConflict {
-		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	if updated.Type != TypeText || updated.Text != "new note" {
+		t.Errorf("Expected text secret to stay text, got %+v", updated)
 	}
 }
 
-func TestService_GetSecret(t *testing.T) {
+func TestService_SecretVersions(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
 
-	createReq := &CreateSecretRequest{
-		Login:    "test_login",
-		Password: "test_password",
-		Metadata: map[string]interface{}{"key": "value"},
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "v1", Password: "p1"}, "")
+	if _, err := service.UpdateSecret(secret.ID, 1, &UpdateSecretRequest{Login: "v2", Password: "p2", Version: 1}, ""); err != nil {
+		t.Fatalf("UpdateSecret failed: %v", err)
 	}
-	created, _ := service.CreateSecret(1, createReq, "")
 
-	secret, err := service.GetSecret(created.ID, 1)
+	versions, err := service.GetSecretVersions(secret.ID, 1)
 	if err != nil {
-		t.Fatalf("GetSecret failed: %v", err)
+		t.Fatalf("GetSecretVersions failed: %v", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+		t.Fatalf("Expected versions [2 1], got %d entries", len(versions))
 	}
 
-	if secret.ID != created.ID {
-		t.Errorf("Expected secret ID %s, got %s", created.ID, secret.ID)
+	first, err := service.GetSecretVersion(secret.ID, 1, 1)
+	if err != nil {
+		t.Fatalf("GetSecretVersion failed: %v", err)
 	}
-	if secret.Login != createReq.Login {
-		t.Errorf("Expected login %s, got %s", createReq.Login, secret.Login)
+	if first.Login != "v1" {
+		t.Errorf("Expected login v1, got %s", first.Login)
 	}
-}
-
-func TestService_GetSecret_NotFound(t *testing.T) {
-	repo := NewMockRepository()
-	service := NewService(repo)
 
-	_, err := service.GetSecret("nonexistent", 1)
-	if err != ErrSecretNotFound {
-		t.Errorf("Expected ErrSecretNotFound, got %v", err)
+	if _, err := service.GetSecretVersion(secret.ID, 1, 5); err != ErrVersionNotFound {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+	if _, err := service.GetSecretVersions(secret.ID, 2); err != ErrSecretNotFound {
+		t.Errorf("Expected ErrSecretNotFound for another user, got %v", err)
 	}
 }
 
-func TestService_GetAllSecrets(t *testing.T) {
+func TestService_RestoreSecretVersion(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
+	realtime := &MockRealtimeService{}
+	service.SetRealtimeService(realtime)
 
-	service.CreateSecret(1, &CreateSecretRequest{Login: "login1", Password: "pass1"}, "")
-	service.CreateSecret(1, &CreateSecretRequest{Login: "login2", Password: "pass2"}, "")
-	service.CreateSecret(2, &CreateSecretRequest{Login: "login3", Password: "pass3"}, "")
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "v1", Password: "p1"}, "")
+	service.UpdateSecret(secret.ID, 1, &UpdateSecretRequest{Login: "v2", Password: "p2", Version: 1}, "")
 
-	secrets, err := service.GetAllSecrets(1)
+	if _, err := service.RestoreSecretVersion(secret.ID, 1, 1, &RestoreVersionRequest{Version: 1}, ""); err != ErrVersionConflict {
+		t.Errorf("Expected ErrVersionConflict for stale version, got %v", err)
+	}
+
+	realtime.UpdatedCalled = false
+	restored, err := service.RestoreSecretVersion(secret.ID, 1, 1, &RestoreVersionRequest{Version: 2}, "session-1")
 	if err != nil {
-		t.Fatalf("GetAllSecrets failed: %v", err)
+		t.Fatalf("RestoreSecretVersion failed: %v", err)
 	}
 
-	if len(secrets) != 2 {
-		t.Errorf("Expected 2 secrets for user 1, got %d", len(secrets))
+	if restored.Login != "v1" || restored.Version != 3 {
+		t.Errorf("Expected login v1 at version 3, got %s at %d", restored.Login, restored.Version)
+	}
+	if !realtime.UpdatedCalled || realtime.LastExcludeSessionID != "session-1" {
+		t.Error("Expected secret_updated notification for restore")
 	}
 }
 
-func TestService_GetAllSecrets_Empty(t *testing.T) {
+func TestService_VersionsLimit(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
+	service.SetVersionsLimit(2)
 
-	secrets, err := service.GetAllSecrets(999)
-	if err != nil {
-		t.Fatalf("GetAllSecrets failed: %v", err)
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "v1", Password: "p"}, "")
+	for version := 1; version <= 3; version++ {
+		if _, err := service.UpdateSecret(secret.ID, 1, &UpdateSecretRequest{Login: "next", Password: "p", Version: version}, ""); err != nil {
+			t.Fatalf("UpdateSecret failed: %v", err)
+		}
 	}
 
-	if len(secrets) != 0 {
-		t.Errorf("Expected 0 secrets, got %d", len(secrets))
+	versions, _ := service.GetSecretVersions(secret.ID, 1)
+	if len(versions) != 2 || versions[1].Version != 3 {
+		t.Errorf("Expected only versions 4 and 3 to be kept, got %d entries", len(versions))
 	}
 }
 
@@ -301,6 +1592,93 @@ func TestService_UpdateSecret(t *testing.T) {
 	}
 }
 
+func TestService_CreateSecret_InFolder(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	folderID := "7d444840-9dc0-11d1-b245-5ffdce74fad2"
+	repo.folders[folderID] = 1
+
+	secret, err := service.CreateSecret(1, &CreateSecretRequest{Login: "l", Password: "p", FolderID: folderID}, "")
+	if err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+	if secret.FolderID != folderID {
+		t.Errorf("Expected folder %s, got %q", folderID, secret.FolderID)
+	}
+
+	if _, err := service.CreateSecret(2, &CreateSecretRequest{Login: "l", Password: "p", FolderID: folderID}, ""); err != ErrFolderNotFound {
+		t.Errorf("Expected ErrFolderNotFound for foreign folder, got %v", err)
+	}
+	if _, err := service.CreateSecret(1, &CreateSecretRequest{Login: "l", Password: "p", FolderID: "work"}, ""); err != ErrInvalidFolderID {
+		t.Errorf("Expected ErrInvalidFolderID, got %v", err)
+	}
+}
+
+func TestService_PatchSecret(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	realtime := &MockRealtimeService{}
+	service.SetRealtimeService(realtime)
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{
+		Type:       TypeFile,
+		Metadata:   map[string]interface{}{"name": "report.pdf", "folder": "work"},
+		BinaryData: []byte("file contents"),
+	}, "")
+
+	patched, err := service.PatchSecret(secret.ID, 1, &PatchSecretRequest{
+		Version: secret.Version,
+		Fields:  map[string]json.RawMessage{"metadata": json.RawMessage(`{"name":"final.pdf","folder":null}`)},
+	}, "session-1")
+	if err != nil {
+		t.Fatalf("PatchSecret failed: %v", err)
+	}
+
+	if string(patched.BinaryData) != "file contents" {
+		t.Errorf("Expected binary data to be kept, got %q", patched.BinaryData)
+	}
+	if !reflect.DeepEqual(patched.Metadata, map[string]interface{}{"name": "final.pdf"}) {
+		t.Errorf("Unexpected metadata after patch: %v", patched.Metadata)
+	}
+	if patched.Version != 2 {
+		t.Errorf("Expected version 2, got %d", patched.Version)
+	}
+	if !realtime.UpdatedCalled || realtime.LastExcludeSessionID != "session-1" {
+		t.Error("Expected secret_updated notification for patch")
+	}
+
+	_, err = service.PatchSecret(secret.ID, 1, &PatchSecretRequest{
+		Version: 1,
+		Fields:  map[string]json.RawMessage{"metadata": json.RawMessage(`{"name":"stale.pdf"}`)},
+	}, "")
+	if err != ErrVersionConflict {
+		t.Errorf("Expected ErrVersionConflict for stale version, got %v", err)
+	}
+}
+
+func TestService_PatchSecret_Validation(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+
+	_, err := service.PatchSecret(secret.ID, 1, &PatchSecretRequest{
+		Version: secret.Version,
+		Fields:  map[string]json.RawMessage{"password": json.RawMessage(`null`)},
+	}, "")
+	if err != ErrPasswordRequired {
+		t.Errorf("Expected ErrPasswordRequired, got %v", err)
+	}
+
+	_, err = service.PatchSecret(secret.ID, 1, &PatchSecretRequest{
+		Version: secret.Version,
+		Fields:  map[string]json.RawMessage{"type": json.RawMessage(`"text"`)},
+	}, "")
+	if err != ErrInvalidPatch {
+		t.Errorf("Expected ErrInvalidPatch, got %v", err)
+	}
+}
+
 func TestService_UpdateSecret_NotFound(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
@@ -321,6 +1699,9 @@ func TestService_UpdateSecret_Validation(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
 
+	// Без type содержимое проверяется по типу сохраненного секрета
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+
 	tests := []struct {
 		name    string
 		req     *UpdateSecretRequest
@@ -353,7 +1734,7 @@ func TestService_UpdateSecret_Validation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := service.UpdateSecret("some-id", 1, tt.req, "")
+			_, err := service.UpdateSecret(secret.ID, 1, tt.req, "")
 			if err != tt.wantErr {
 				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
 			}
@@ -371,14 +1752,13 @@ func TestService_DeleteSecret(t *testing.T) {
 	}
 	secret, _ := service.CreateSecret(1, createReq, "")
 
-	err := service.DeleteSecret(secret.ID, 1, "")
+	err := service.DeleteSecret(secret.ID, 1, 0, "")
 	if err != nil {
 		t.Fatalf("DeleteSecret failed: %v", err)
 	}
 
-	secrets, _ := service.GetAllSecrets(1)
-	if len(secrets) != 0 {
-		t.Errorf("Expected 0 secrets after deletion, got %d", len(secrets))
+	if stored := repo.secrets[secret.ID]; stored == nil || !stored.DeletedAt.Valid {
+		t.Errorf("Expected secret to be deleted")
 	}
 }
 
@@ -386,12 +1766,299 @@ func TestService_DeleteSecret_NotFound(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
 
-	err := service.DeleteSecret("nonexistent", 1, "")
+	err := service.DeleteSecret("nonexistent", 1, 0, "")
 	if err != ErrSecretNotFound {
 		t.Errorf("Expected ErrSecretNotFound, got %v", err)
 	}
 }
 
+func TestService_TrashAndRestore(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	mockRealtime := &MockRealtimeService{}
+	service.SetRealtimeService(mockRealtime)
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+	if err := service.DeleteSecret(secret.ID, 1, 0, ""); err != nil {
+		t.Fatalf("DeleteSecret failed: %v", err)
+	}
+
+	trash, err := service.GetTrash(1)
+	if err != nil {
+		t.Fatalf("GetTrash failed: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != secret.ID {
+		t.Fatalf("Expected deleted secret in trash, got %v", trash)
+	}
+
+	restored, err := service.RestoreSecret(secret.ID, 1, "session-1")
+	if err != nil {
+		t.Fatalf("RestoreSecret failed: %v", err)
+	}
+	if restored.DeletedAt.Valid {
+		t.Error("Expected restored secret to have no deleted_at")
+	}
+	if restored.Version != 2 {
+		t.Errorf("Expected version 2 after restore, got %d", restored.Version)
+	}
+	if !mockRealtime.RestoredCalled || mockRealtime.LastExcludeSessionID != "session-1" {
+		t.Error("Expected NotifySecretRestored to be called with session-1")
+	}
+
+	trash, _ = service.GetTrash(1)
+	if len(trash) != 0 {
+		t.Errorf("Expected empty trash, got %d", len(trash))
+	}
+
+	if _, err := service.RestoreSecret(secret.ID, 1, ""); err != ErrSecretNotFound {
+		t.Errorf("Expected ErrSecretNotFound for active secret, got %v", err)
+	}
+}
+
+func TestService_PurgeSecret(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	mockRealtime := &MockRealtimeService{}
+	service.SetRealtimeService(mockRealtime)
+
+	secret, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "login", Password: "password"}, "")
+	if err := service.PurgeSecret(secret.ID, 1, 0, ""); err != nil {
+		t.Fatalf("PurgeSecret failed: %v", err)
+	}
+	if !mockRealtime.DeletedCalled {
+		t.Error("Expected NotifySecretDeleted to be called")
+	}
+
+	trash, _ := service.GetTrash(1)
+	if len(trash) != 0 {
+		t.Errorf("Expected purged secret to be absent from trash, got %d", len(trash))
+	}
+	if _, err := service.RestoreSecret(secret.ID, 1, ""); err != ErrSecretNotFound {
+		t.Errorf("Expected ErrSecretNotFound for purged secret, got %v", err)
+	}
+
+	sync, _ := service.GetSecretsForSync(1, "", 0)
+	if len(sync.Secrets) != 1 || sync.Secrets[0].Password != "" {
+		t.Error("Expected wiped tombstone to remain visible for sync")
+	}
+}
+
+func TestPurger_PurgeOnce(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	now := time.Now()
+
+	old, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "old", Password: "p"}, "")
+	fresh, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "fresh", Password: "p"}, "")
+	beforeDelete, _ := service.GetSecretsForSync(1, "", 0)
+	_ = service.DeleteSecret(old.ID, 1, 0, "")
+	_ = service.DeleteSecret(fresh.ID, 1, 0, "")
+	repo.secrets[old.ID].DeletedAt.Time = now.Add(-48 * time.Hour)
+
+	// Устройство синхронизировалось до удаления и еще не знает о нем
+	service.RecordDeviceSync(1, "laptop", beforeDelete.NextCursor)
+
+	purger := NewPurger(repo, 24*time.Hour, 7*24*time.Hour, time.Hour)
+	if purged := purger.PurgeOnce(now); purged != 0 {
+		t.Errorf("Expected lagging device to block purge, got %d purged", purged)
+	}
+
+	sync, _ := service.GetSecretsForSync(1, "", 0)
+	service.RecordDeviceSync(1, "laptop", sync.NextCursor)
+	if purged := purger.PurgeOnce(now); purged != 1 {
+		t.Errorf("Expected 1 purged tombstone, got %d", purged)
+	}
+	if _, ok := repo.secrets[old.ID]; ok {
+		t.Error("Expected old tombstone to be removed")
+	}
+	if _, ok := repo.secrets[fresh.ID]; !ok {
+		t.Error("Expected recent tombstone to stay in trash")
+	}
+
+	// Устройство, пропавшее дольше deviceTTL, больше не удерживает надгробия
+	repo.devices["1/laptop"] = mockDevice{seenAt: now.Add(-30 * 24 * time.Hour)}
+	repo.secrets[fresh.ID].DeletedAt.Time = now.Add(-48 * time.Hour)
+	if purged := purger.PurgeOnce(now); purged != 1 {
+		t.Errorf("Expected stale device to be ignored, got %d purged", purged)
+	}
+}
+
+func TestService_PushChanges(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	mockRealtime := &MockRealtimeService{}
+	service.SetRealtimeService(mockRealtime)
+
+	updated, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "old", Password: "p"}, "")
+	conflicted, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "server", Password: "p"}, "")
+	deleted, _ := service.CreateSecret(1, &CreateSecretRequest{Login: "gone", Password: "p"}, "")
+	foreign, _ := service.CreateSecret(2, &CreateSecretRequest{Login: "foreign", Password: "p"}, "")
+	mockRealtime.CreatedCalled = false
+
+	results, err := service.PushChanges(1, &PushRequest{Operations: []PushOperation{
+		{ClientID: "op-create", Action: PushCreate, Login: "new", Password: "p"},
+		{ClientID: "op-update", Action: PushUpdate, SecretID: updated.ID, BaseVersion: 1, Login: "changed", Password: "p"},
+		{ClientID: "op-conflict", Action: PushUpdate, SecretID: conflicted.ID, BaseVersion: 5, Login: "local", Password: "p"},
+		{ClientID: "op-delete", Action: PushDelete, SecretID: deleted.ID, BaseVersion: 1},
+		{ClientID: "op-foreign", Action: PushDelete, SecretID: foreign.ID},
+		{ClientID: "op-invalid", Action: PushCreate, Login: "no-password"},
+		{ClientID: "op-unknown", Action: "rename", SecretID: updated.ID},
+	}}, "session-1")
+	if err != nil {
+		t.Fatalf("PushChanges failed: %v", err)
+	}
+
+	expected := []struct {
+		clientID string
+		status   PushStatus
+	}{
+		{"op-create", PushApplied},
+		{"op-update", PushApplied},
+		{"op-conflict", PushConflict},
+		{"op-delete", PushApplied},
+		{"op-foreign", PushNotFound},
+		{"op-invalid", PushInvalid},
+		{"op-unknown", PushInvalid},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, want := range expected {
+		if results[i].ClientID != want.clientID || results[i].Status != want.status {
+			t.Errorf("Result %d: expected %s/%s, got %s/%s", i, want.clientID, want.status, results[i].ClientID, results[i].Status)
+		}
+	}
+
+	if results[0].Secret == nil || results[0].Secret.ID == "" {
+		t.Error("Expected created secret with server ID")
+	}
+	if results[1].Secret.Version != 2 || repo.secrets[updated.ID].Login != "changed" {
+		t.Error("Expected update to be applied with new version")
+	}
+	if results[2].Secret == nil || results[2].Secret.Login != "server" {
+		t.Error("Expected conflict to return the server copy")
+	}
+	if !repo.secrets[deleted.ID].DeletedAt.Valid {
+		t.Error("Expected secret to be moved to trash")
+	}
+	if results[5].Err != ErrPasswordRequired || results[6].Err != ErrInvalidPushAction {
+		t.Errorf("Expected validation errors, got %v and %v", results[5].Err, results[6].Err)
+	}
+	if repo.secrets[foreign.ID].DeletedAt.Valid {
+		t.Error("Expected other user's secret to stay untouched")
+	}
+
+	if mockRealtime.BatchCalls != 1 || mockRealtime.CreatedCalled || mockRealtime.UpdatedCalled || mockRealtime.DeletedCalled {
+		t.Errorf("Expected exactly one batch notification, got %d", mockRealtime.BatchCalls)
+	}
+	if len(mockRealtime.BatchCreated) != 1 || len(mockRealtime.BatchUpdated) != 1 || len(mockRealtime.BatchDeleted) != 1 {
+		t.Errorf("Expected 1 created, 1 updated, 1 deleted in batch, got %v %v %v",
+			mockRealtime.BatchCreated, mockRealtime.BatchUpdated, mockRealtime.BatchDeleted)
+	}
+	if mockRealtime.LastExcludeSessionID != "session-1" {
+		t.Errorf("Expected session-1 to be excluded, got %q", mockRealtime.LastExcludeSessionID)
+	}
+}
+
+func TestService_PushChanges_NothingApplied(t *testing.T) {
+	service := NewService(NewMockRepository())
+	mockRealtime := &MockRealtimeService{}
+	service.SetRealtimeService(mockRealtime)
+
+	results, err := service.PushChanges(1, &PushRequest{Operations: []PushOperation{
+		{ClientID: "op-1", Action: PushDelete, SecretID: "missing"},
+	}}, "")
+	if err != nil {
+		t.Fatalf("PushChanges failed: %v", err)
+	}
+	if results[0].Status != PushNotFound {
+		t.Errorf("Expected not_found, got %s", results[0].Status)
+	}
+	if mockRealtime.BatchCalls != 0 {
+		t.Error("Expected no notification when nothing was applied")
+	}
+}
+
+func TestService_PushChanges_ClientID(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+
+	const id = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	req := &PushRequest{Operations: []PushOperation{
+		{ClientID: "op-1", Action: PushCreate, SecretID: id, Login: "login", Password: "password"},
+	}}
+
+	results, err := service.PushChanges(1, req, "")
+	if err != nil {
+		t.Fatalf("PushChanges failed: %v", err)
+	}
+	if results[0].Status != PushApplied || results[0].Secret.ID != id {
+		t.Fatalf("Expected create with client ID, got %+v", results[0])
+	}
+
+	// Повторная отправка того же пакета не создает второй секрет
+	results, err = service.PushChanges(1, req, "")
+	if err != nil {
+		t.Fatalf("PushChanges failed: %v", err)
+	}
+	if results[0].Status != PushConflict || results[0].Secret.ID != id {
+		t.Errorf("Expected conflict with existing secret, got %+v", results[0])
+	}
+	if len(repo.secrets) != 1 {
+		t.Errorf("Expected 1 secret, got %d", len(repo.secrets))
+	}
+
+	req.Operations[0].SecretID = "bad"
+	results, _ = service.PushChanges(1, req, "")
+	if results[0].Status != PushInvalid || results[0].Err != ErrInvalidID {
+		t.Errorf("Expected invalid ID result, got %+v", results[0])
+	}
+}
+
+func TestService_PushChanges_TooMany(t *testing.T) {
+	service := NewService(NewMockRepository())
+
+	_, err := service.PushChanges(1, &PushRequest{Operations: make([]PushOperation, MaxPushOperations+1)}, "")
+	if err != ErrTooManyPushOperations {
+		t.Errorf("Expected ErrTooManyPushOperations, got %v", err)
+	}
+}
+
+func TestService_UploadBlob(t *testing.T) {
+	repo := NewMockRepository()
+	service := NewService(repo)
+	mockRealtime := &MockRealtimeService{}
+	service.SetRealtimeService(mockRealtime)
+
+	secret, err := service.CreateSecret(1, &CreateSecretRequest{Type: TypeFile, BinaryData: []byte("old")}, "")
+	if err != nil {
+		t.Fatalf("CreateSecret failed: %v", err)
+	}
+
+	info, err := service.UploadBlob(secret.ID, 1, secret.Version, bytes.NewReader([]byte("new content")), "session-1")
+	if err != nil {
+		t.Fatalf("UploadBlob failed: %v", err)
+	}
+	if info.Version != 2 || info.Size != int64(len("new content")) {
+		t.Errorf("Expected version 2 and size %d, got %d and %d", len("new content"), info.Version, info.Size)
+	}
+	if !mockRealtime.UpdatedCalled {
+		t.Error("Expected NotifySecretUpdated to be called")
+	}
+
+	if _, err := service.UploadBlob(secret.ID, 1, 1, bytes.NewReader([]byte("x")), ""); err != ErrVersionConflict {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if _, err := service.UploadBlob(secret.ID, 1, 2, bytes.NewReader(nil), ""); err != ErrFileRequired {
+		t.Errorf("Expected ErrFileRequired for empty file, got %v", err)
+	}
+
+	text, _ := service.CreateSecret(1, &CreateSecretRequest{Type: TypeText, Text: "note"}, "")
+	if _, err := service.UploadBlob(text.ID, 1, text.Version, bytes.NewReader([]byte("x")), ""); err != ErrUnexpectedFields {
+		t.Errorf("Expected ErrUnexpectedFields for text secret, got %v", err)
+	}
+}
+
 func TestService_WithRealtimeService(t *testing.T) {
 	repo := NewMockRepository()
 	service := NewService(repo)
@@ -428,7 +2095,7 @@ func TestService_WithRealtimeService(t *testing.T) {
 		t.Error("Expected NotifySecretUpdated to be called")
 	}
 
-	err = service.DeleteSecret(secret.ID, 1, "session-789")
+	err = service.DeleteSecret(secret.ID, 1, 0, "session-789")
 	if err != nil {
 		t.Fatalf("DeleteSecret failed: %v", err)
 	}
@@ -441,7 +2108,15 @@ type MockRealtimeService struct {
 	CreatedCalled        bool
 	UpdatedCalled        bool
 	DeletedCalled        bool
+	RestoredCalled       bool
+	BatchCalls           int
+	BatchCreated         []string
+	BatchUpdated         []string
+	BatchDeleted         []string
 	LastExcludeSessionID string
+	UpdatedUsers         []int
+	SharedUsers          []int
+	UnsharedUsers        []int
 }
 
 func (m *MockRealtimeService) NotifySecretCreated(userID int, secretID string, excludeSessionID string) error {
@@ -452,6 +2127,7 @@ func (m *MockRealtimeService) NotifySecretCreated(userID int, secretID string, e
 
 func (m *MockRealtimeService) NotifySecretUpdated(userID int, secretID string, excludeSessionID string) error {
 	m.UpdatedCalled = true
+	m.UpdatedUsers = append(m.UpdatedUsers, userID)
 	m.LastExcludeSessionID = excludeSessionID
 	return nil
 }
@@ -461,3 +2137,28 @@ func (m *MockRealtimeService) NotifySecretDeleted(userID int, secretID string, e
 	m.LastExcludeSessionID = excludeSessionID
 	return nil
 }
+
+func (m *MockRealtimeService) NotifySecretRestored(userID int, secretID string, excludeSessionID string) error {
+	m.RestoredCalled = true
+	m.LastExcludeSessionID = excludeSessionID
+	return nil
+}
+
+func (m *MockRealtimeService) NotifySecretShared(userID int, secretID string, excludeSessionID string) error {
+	m.SharedUsers = append(m.SharedUsers, userID)
+	m.LastExcludeSessionID = excludeSessionID
+	return nil
+}
+
+func (m *MockRealtimeService) NotifySecretUnshared(userID int, secretID string, excludeSessionID string) error {
+	m.UnsharedUsers = append(m.UnsharedUsers, userID)
+	m.LastExcludeSessionID = excludeSessionID
+	return nil
+}
+
+func (m *MockRealtimeService) NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error {
+	m.BatchCalls++
+	m.BatchCreated, m.BatchUpdated, m.BatchDeleted = created, updated, deleted
+	m.LastExcludeSessionID = excludeSessionID
+	return nil
+}
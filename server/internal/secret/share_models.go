@@ -0,0 +1,85 @@
+package secret
+
+import "time"
+
+// SharePermission - право получателя на чужой секрет
+type SharePermission string
+
+const (
+	PermissionRead  SharePermission = "read"
+	PermissionWrite SharePermission = "write"
+)
+
+func (p SharePermission) IsValid() bool {
+	switch p {
+	case PermissionRead, PermissionWrite:
+		return true
+	}
+	return false
+}
+
+// MaxWrappedKeyLength - наибольший размер ключа секрета, зашифрованного для получателя (base64)
+const MaxWrappedKeyLength = 4096
+
+// ShareAccess - доступ, с которым получатель видит чужой секрет
+type ShareAccess struct {
+	OwnerEmail string          `json:"owner_email"`
+	Permission SharePermission `json:"permission"`
+	// WrappedKey - ключ секрета, зашифрованный открытым ключом получателя. Сервер его не читает.
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// CanWrite сообщает, может ли пользователь менять секрет. Свой секрет (nil) менять можно.
+func (a *ShareAccess) CanWrite() bool {
+	return a == nil || a.Permission == PermissionWrite
+}
+
+// SecretShare - доступ пользователя GranteeID к секрету владельца OwnerID
+type SecretShare struct {
+	SecretID     string
+	OwnerID      int
+	GranteeID    int
+	GranteeEmail string
+	Permission   SharePermission
+	WrappedKey   string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// ShareSecretRequest выдает пользователю с адресом Email доступ к секрету или меняет выданный
+type ShareSecretRequest struct {
+	Email string `json:"email"`
+	// Permission - read или write. По умолчанию read.
+	Permission SharePermission `json:"permission,omitempty"`
+	WrappedKey string          `json:"wrapped_key"`
+}
+
+type ShareResponse struct {
+	GranteeID  int             `json:"grantee_id"`
+	Email      string          `json:"email"`
+	Permission SharePermission `json:"permission"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// CanWrite сообщает, может ли получатель менять секрет. nil - секрет свой, его менять можно.
+func (s *SecretShare) CanWrite() bool {
+	return s == nil || s.Permission == PermissionWrite
+}
+
+func (s *SecretShare) ToResponse() ShareResponse {
+	return ShareResponse{
+		GranteeID:  s.GranteeID,
+		Email:      s.GranteeEmail,
+		Permission: s.Permission,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+}
+
+// applyShare показывает секрет получателю: папки и метки владельца ему не видны
+func (s *Secret) applyShare(share *ShareAccess) {
+	s.Share = share
+	s.FolderID = ""
+	s.Tags = nil
+}
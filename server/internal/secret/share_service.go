@@ -0,0 +1,175 @@
+package secret
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/google/uuid"
+)
+
+// ShareSecret выдает пользователю с адресом req.Email доступ к секрету или меняет выданный.
+// Делиться секретом может только владелец.
+func (s *Service) ShareSecret(id string, userID int, req *ShareSecretRequest, excludeSessionID string) (*SecretShare, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		return nil, ErrEmailRequired
+	}
+	permission := req.Permission
+	if permission == "" {
+		permission = PermissionRead
+	}
+	if !permission.IsValid() {
+		return nil, ErrInvalidPermission
+	}
+	if req.WrappedKey == "" || len(req.WrappedKey) > MaxWrappedKeyLength {
+		return nil, ErrWrappedKeyInvalid
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrSecretNotFound
+	}
+
+	share := &SecretShare{
+		SecretID:     id,
+		OwnerID:      userID,
+		GranteeEmail: email,
+		Permission:   permission,
+		WrappedKey:   req.WrappedKey,
+	}
+
+	if err := s.ownerOnly(id, userID, s.repo.ShareSecret(share)); err != nil {
+		if !isExpectedShareError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка выдачи доступа к секрету")
+		}
+		return nil, err
+	}
+
+	s.notifyShare(RealtimeService.NotifySecretShared, userID, share.GranteeID, id, excludeSessionID)
+
+	return share, nil
+}
+
+// ListShares возвращает действующие доступы к секрету. Список видит только владелец.
+func (s *Service) ListShares(id string, userID int) ([]*SecretShare, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrSecretNotFound
+	}
+
+	shares, err := s.repo.ListShares(id, userID)
+	if err = s.ownerOnly(id, userID, err); err != nil {
+		if !isExpectedShareError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": id,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка получения доступов к секрету")
+		}
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// RevokeShare отзывает доступ granteeID к секрету. Владелец отзывает любой доступ,
+// получатель может отказаться от своего.
+func (s *Service) RevokeShare(id string, userID int, granteeID int, excludeSessionID string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrShareNotFound
+	}
+
+	ownerID, err := s.repo.RevokeShare(id, granteeID, userID)
+	if err != nil {
+		if !isExpectedShareError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":    userID,
+				"secret_id":  id,
+				"grantee_id": granteeID,
+				"error":      err.Error(),
+			}).Error("[Secret] Ошибка отзыва доступа к секрету")
+		}
+		return err
+	}
+
+	s.notifyShare(RealtimeService.NotifySecretUnshared, ownerID, granteeID, id, excludeSessionID)
+
+	return nil
+}
+
+// ownerOf возвращает владельца секрета, доступного userID, и доступ, если секрет чужой
+func (s *Service) ownerOf(id string, userID int) (int, *SecretShare, error) {
+	share, err := s.repo.GetShare(id, userID)
+	if errors.Is(err, ErrShareNotFound) {
+		return userID, nil, nil
+	}
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id":   userID,
+			"secret_id": id,
+			"error":     err.Error(),
+		}).Error("[Secret] Ошибка проверки доступа к секрету")
+		return 0, nil, err
+	}
+
+	return share.OwnerID, share, nil
+}
+
+// ownerOnly уточняет ошибку операции, доступной только владельцу: если секрет не найден
+// среди своих, но пользователю выдан доступ к нему, возвращается ErrForbidden
+func (s *Service) ownerOnly(id string, userID int, err error) error {
+	if !errors.Is(err, ErrSecretNotFound) {
+		return err
+	}
+	if _, shareErr := s.repo.GetShare(id, userID); shareErr == nil {
+		return ErrForbidden
+	}
+	return err
+}
+
+// notifyAll рассылает событие о секрете владельцу и всем получателям доступа
+func (s *Service) notifyAll(send func(RealtimeService, int, string, string) error, ownerID int, secretID string, excludeSessionID string) error {
+	grantees, err := s.repo.GetShareGrantees(secretID)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, userID := range append([]int{ownerID}, grantees...) {
+		if err := send(s.realtimeService, userID, secretID, excludeSessionID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// notifyShare сообщает о выдаче или отзыве доступа владельцу и получателю
+func (s *Service) notifyShare(send func(RealtimeService, int, string, string) error, ownerID, granteeID int, secretID string, excludeSessionID string) {
+	if s.realtimeService == nil {
+		return
+	}
+	for _, userID := range []int{ownerID, granteeID} {
+		if err := send(s.realtimeService, userID, secretID, excludeSessionID); err != nil {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id":   userID,
+				"secret_id": secretID,
+				"error":     err.Error(),
+			}).Error("[Secret] Ошибка отправки события доступа к секрету через WebSocket")
+		}
+	}
+}
+
+func isExpectedShareError(err error) bool {
+	for _, expected := range []error{ErrSecretNotFound, ErrShareNotFound, ErrGranteeNotFound, ErrShareWithSelf, ErrForbidden} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package secret
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// syncCursor - позиция клиента в потоке изменений. Клиенту передается в непрозрачном виде,
+// чтобы формат можно было менять без изменения API.
+type syncCursor struct {
+	Seq int64 `json:"s"`
+}
+
+func encodeSyncCursor(seq int64) string {
+	data, _ := json.Marshal(syncCursor{Seq: seq})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSyncCursor возвращает номер изменения из курсора. Пустой курсор - начало потока.
+func decodeSyncCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	var c syncCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Seq < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return c.Seq, nil
+}
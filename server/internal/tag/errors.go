@@ -0,0 +1,31 @@
+package tag
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTagNotFound        = errors.New("tag.not_found")
+	ErrTagAlreadyExists   = errors.New("tag.already_exists")
+	ErrNameTaken          = errors.New("tag.name_taken")
+	ErrVersionConflict    = errors.New("tag.version_conflict")
+	ErrPreconditionFailed = errors.New("tag.precondition_failed")
+	ErrSecretNotFound     = errors.New("tag.secret_not_found")
+)
+
+var (
+	ErrRequestRequired = errors.New("tag.request_required")
+	ErrInvalidID       = errors.New("tag.invalid_id")
+	ErrNameRequired    = errors.New("tag.name_required")
+	ErrNameTooLong     = errors.New("tag.name_too_long")
+	ErrNothingToAssign = errors.New("tag.nothing_to_assign")
+	ErrTooManyItems    = errors.New("tag.assign_too_large")
+)
+
+func WrapError(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,274 @@
+package tag
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+type TagService interface {
+	CreateTag(userID int, req *CreateTagRequest, excludeSessionID string) (*Tag, error)
+	ListTags(userID int) ([]*Tag, error)
+	RenameTag(id string, userID int, req *RenameTagRequest, excludeSessionID string) (*Tag, error)
+	DeleteTag(id string, userID int, version int, excludeSessionID string) error
+	Assign(userID int, req *AssignRequest, excludeSessionID string) (*AssignResult, error)
+}
+
+type Handler struct {
+	service TagService
+}
+
+func NewHandler(service TagService) *Handler {
+	return &Handler{service: service}
+}
+
+// List godoc
+// @Summary Получить метки
+// @Description Возвращает все метки пользователя, упорядоченные по названию
+// @Tags tags
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} TagResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tags [get]
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	tags, err := h.service.ListTags(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Tag] Ошибка получения меток")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	responses := make([]TagResponse, 0, len(tags))
+	for _, tag := range tags {
+		responses = append(responses, tag.ToResponse())
+	}
+
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// Create godoc
+// @Summary Создать метку
+// @Tags tags
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body CreateTagRequest true "Данные метки"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 201 {object} TagResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 409 {object} map[string]string "Метка с таким ID или названием уже существует"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tags [post]
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req CreateTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	tag, err := h.service.CreateTag(userID, &req, sessionID(r))
+	if err != nil {
+		h.writeError(w, r, userID, req.ID, err, "[Tag] Ошибка создания метки")
+		return
+	}
+
+	w.Header().Set("ETag", tagETag(tag.ID, tag.Version))
+	writeJSON(w, http.StatusCreated, tag.ToResponse())
+}
+
+// Rename godoc
+// @Summary Переименовать метку
+// @Tags tags
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path string true "ID метки"
+// @Param request body RenameTagRequest true "Новое название и версия"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 200 {object} TagResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Метка не найдена"
+// @Failure 409 {object} map[string]string "Конфликт версий или название занято"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tags/{id} [put]
+func (h *Handler) Rename(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req RenameTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	tag, err := h.service.RenameTag(id, userID, &req, sessionID(r))
+	if err != nil {
+		h.writeError(w, r, userID, id, err, "[Tag] Ошибка переименования метки")
+		return
+	}
+
+	w.Header().Set("ETag", tagETag(tag.ID, tag.Version))
+	writeJSON(w, http.StatusOK, tag.ToResponse())
+}
+
+// Delete godoc
+// @Summary Удалить метку
+// @Description Удаляет метку и снимает ее со всех секретов
+// @Tags tags
+// @Security BearerAuth
+// @Param id path string true "ID метки"
+// @Param If-Match header string false "ETag метки: удалить, только если она не изменилась"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 204 "Метка удалена"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Метка не найдена"
+// @Failure 412 {object} map[string]string "Метка изменилась"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tags/{id} [delete]
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	version := 0
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		var matched bool
+		if version, matched = ifMatchVersion(ifMatch, id); !matched {
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "tag.precondition_failed", nil)
+			return
+		}
+	}
+
+	if err := h.service.DeleteTag(id, userID, version, sessionID(r)); err != nil {
+		if errors.Is(err, ErrVersionConflict) {
+			localization.LocalizedError(w, r, http.StatusPreconditionFailed, "tag.precondition_failed", nil)
+			return
+		}
+		h.writeError(w, r, userID, id, err, "[Tag] Ошибка удаления метки")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Assign godoc
+// @Summary Назначить метки
+// @Description Добавляет секретам метки add и снимает метки remove. Если хотя бы один секрет или метка не найдены, не меняется ничего.
+// @Tags tags
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body AssignRequest true "Секреты и метки"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 200 {object} AssignResult "Секреты, у которых изменился набор меток"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Секрет или метка не найдены"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /tags/assign [post]
+func (h *Handler) Assign(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req AssignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	result, err := h.service.Assign(userID, &req, sessionID(r))
+	if err != nil {
+		h.writeError(w, r, userID, "", err, "[Tag] Ошибка назначения меток")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+var validationErrors = []error{
+	ErrRequestRequired,
+	ErrInvalidID,
+	ErrNameRequired,
+	ErrNameTooLong,
+	ErrNothingToAssign,
+	ErrTooManyItems,
+}
+
+// writeError отвечает на ошибку сервиса. Неожиданные ошибки пишутся в лог с logMessage.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, userID int, tagID string, err error, logMessage string) {
+	for _, validationErr := range validationErrors {
+		if errors.Is(err, validationErr) {
+			localization.LocalizedError(w, r, http.StatusBadRequest, validationErr.Error(), nil)
+			return
+		}
+	}
+
+	switch {
+	case errors.Is(err, ErrTagNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "tag.not_found", nil)
+	case errors.Is(err, ErrSecretNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, "tag.secret_not_found", nil)
+	case errors.Is(err, ErrTagAlreadyExists):
+		localization.LocalizedError(w, r, http.StatusConflict, "tag.already_exists", nil)
+	case errors.Is(err, ErrNameTaken):
+		localization.LocalizedError(w, r, http.StatusConflict, "tag.name_taken", nil)
+	case errors.Is(err, ErrVersionConflict):
+		localization.LocalizedError(w, r, http.StatusConflict, "tag.version_conflict", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"tag_id":  tagID,
+			"error":   err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
+
+func sessionID(r *http.Request) string {
+	sessionID, _ := middleware.GetSessionIDFromContext(r.Context())
+	return sessionID
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Errorf("[Tag] Ошибка отправки JSON ответа: %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package tag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRequest(method, target string, body interface{}, userID int) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, target, &buf)
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+}
+
+func TestHandler_CreateAndList(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	w := httptest.NewRecorder()
+	handler.Create(w, newTestRequest(http.MethodPost, "/api/v1/tags", CreateTagRequest{Name: "prod"}, 1))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created TagResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "prod", created.Name)
+	assert.Equal(t, tagETag(created.ID, 1), w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	handler.Create(w, newTestRequest(http.MethodPost, "/api/v1/tags", CreateTagRequest{Name: "prod"}, 1))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.List(w, newTestRequest(http.MethodGet, "/api/v1/tags", nil, 1))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var tags []TagResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&tags))
+	require.Len(t, tags, 1)
+	assert.Equal(t, created.ID, tags[0].ID)
+
+	// Метки другого пользователя не видны
+	w = httptest.NewRecorder()
+	handler.List(w, newTestRequest(http.MethodGet, "/api/v1/tags", nil, 2))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
+
+func TestHandler_Create_Errors(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"invalid json", "not an object", http.StatusBadRequest},
+		{"empty name", CreateTagRequest{}, http.StatusBadRequest},
+		{"invalid id", CreateTagRequest{ID: "x", Name: "a"}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Create(w, newTestRequest(http.MethodPost, "/api/v1/tags", tt.body, 1))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestHandler_Rename(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	tag, _ := service.CreateTag(1, &CreateTagRequest{Name: "a"}, "")
+
+	w := httptest.NewRecorder()
+	req := newTestRequest(http.MethodPut, "/api/v1/tags/"+tag.ID, RenameTagRequest{Name: "b", Version: 1}, 1)
+	handler.Rename(w, mux.SetURLVars(req, map[string]string{"id": tag.ID}))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var renamed TagResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&renamed))
+	assert.Equal(t, "b", renamed.Name)
+	assert.Equal(t, tagETag(tag.ID, 2), w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	req = newTestRequest(http.MethodPut, "/api/v1/tags/"+tag.ID, RenameTagRequest{Name: "c", Version: 1}, 1)
+	handler.Rename(w, mux.SetURLVars(req, map[string]string{"id": tag.ID}))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	req = newTestRequest(http.MethodPut, "/api/v1/tags/unknown", RenameTagRequest{Name: "c", Version: 1}, 1)
+	handler.Rename(w, mux.SetURLVars(req, map[string]string{"id": "unknown"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_Delete_IfMatch(t *testing.T) {
+	service, _, _ := newTestService()
+	handler := NewHandler(service)
+
+	tag, _ := service.CreateTag(1, &CreateTagRequest{Name: "a"}, "")
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		status  int
+	}{
+		{"other tag etag", tagETag("other", 1), http.StatusPreconditionFailed},
+		{"stale version", tagETag(tag.ID, 2), http.StatusPreconditionFailed},
+		{"current version", tagETag(tag.ID, 1), http.StatusNoContent},
+		{"already deleted", "*", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := newTestRequest(http.MethodDelete, "/api/v1/tags/"+tag.ID, nil, 1)
+			req.Header.Set("If-Match", tt.ifMatch)
+			handler.Delete(w, mux.SetURLVars(req, map[string]string{"id": tag.ID}))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestHandler_Assign(t *testing.T) {
+	service, repo, _ := newTestService()
+	handler := NewHandler(service)
+
+	tag, _ := service.CreateTag(1, &CreateTagRequest{Name: "prod"}, "")
+	secretID := "11111111-1111-1111-1111-111111111111"
+	repo.secrets[secretID] = map[string]bool{}
+
+	w := httptest.NewRecorder()
+	handler.Assign(w, newTestRequest(http.MethodPost, "/api/v1/tags/assign", AssignRequest{SecretIDs: []string{secretID}, Add: []string{tag.ID}}, 1))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result AssignResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+	assert.Equal(t, []string{secretID}, result.SecretIDs)
+	assert.True(t, repo.secrets[secretID][tag.ID])
+
+	w = httptest.NewRecorder()
+	handler.Assign(w, newTestRequest(http.MethodPost, "/api/v1/tags/assign", AssignRequest{Add: []string{tag.ID}}, 1))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.Assign(w, newTestRequest(http.MethodPost, "/api/v1/tags/assign", AssignRequest{SecretIDs: []string{"22222222-2222-2222-2222-222222222222"}, Add: []string{tag.ID}}, 1))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	handler := NewHandler(NewService(NewMockRepository()))
+
+	w := httptest.NewRecorder()
+	handler.List(w, httptest.NewRequest(http.MethodGet, "/api/v1/tags", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
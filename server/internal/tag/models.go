@@ -0,0 +1,103 @@
+package tag
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxNameLength - наибольшая длина названия метки
+	MaxNameLength = 255
+	// MaxAssignSecrets ограничивает число секретов в одном назначении: оно выполняется в одной транзакции
+	MaxAssignSecrets = 500
+)
+
+type Tag struct {
+	ID        string       `json:"id" db:"id"`
+	UserID    int          `json:"user_id" db:"user_id"`
+	Name      string       `json:"name" db:"name"`
+	Version   int          `json:"version" db:"version"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at" db:"updated_at"`
+	DeletedAt sql.NullTime `json:"deleted_at,omitempty" db:"deleted_at"`
+	ChangeSeq int64        `json:"-" db:"change_seq"`
+}
+
+type CreateTagRequest struct {
+	// ID можно сгенерировать на клиенте (UUID), тогда повтор запроса не создаст дубликат
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type RenameTagRequest struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+}
+
+// AssignRequest добавляет секретам метки Add и снимает метки Remove
+type AssignRequest struct {
+	SecretIDs []string `json:"secret_ids"`
+	Add       []string `json:"add,omitempty"`
+	Remove    []string `json:"remove,omitempty"`
+}
+
+// AssignResult - секреты, у которых изменился набор меток
+type AssignResult struct {
+	SecretIDs []string `json:"secret_ids"`
+}
+
+type TagResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (t *Tag) ToResponse() TagResponse {
+	resp := TagResponse{
+		ID:        t.ID,
+		Name:      t.Name,
+		Version:   t.Version,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+
+	if t.DeletedAt.Valid {
+		resp.DeletedAt = &t.DeletedAt.Time
+	}
+
+	return resp
+}
+
+// tagETag - ETag метки, как у секретов и папок: id и версия
+func tagETag(id string, version int) string {
+	return `"` + id + "-" + strconv.Itoa(version) + `"`
+}
+
+// ifMatchVersion возвращает версию метки id из заголовка If-Match. Для * подходит
+// любая версия (0), false - ни один ETag не относится к этой метке.
+func ifMatchVersion(header, id string) (int, bool) {
+	for _, etag := range strings.Split(header, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" {
+			return 0, true
+		}
+
+		value, ok := strings.CutPrefix(etag, `"`+id+"-")
+		if !ok {
+			continue
+		}
+		value, ok = strings.CutSuffix(value, `"`)
+		if !ok {
+			continue
+		}
+		if version, err := strconv.Atoi(value); err == nil && version > 0 {
+			return version, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,382 @@
+package tag
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type Repository interface {
+	CreateTag(tag *Tag) error
+	GetTag(id string, userID int) (*Tag, error)
+	ListTags(userID int) ([]*Tag, error)
+	RenameTag(tag *Tag) error
+	DeleteTag(id string, userID int, version int) ([]string, error)
+	Assign(userID int, req *AssignRequest) ([]string, error)
+	GetTagChanges(userID int, afterSeq int64, limit int) ([]*Tag, error)
+	PurgeTombstones(deletedBefore time.Time) (int64, error)
+}
+
+type DatabaseRepository struct {
+	db *sql.DB
+}
+
+func NewDatabaseRepository(db *sql.DB) *DatabaseRepository {
+	return &DatabaseRepository{db: db}
+}
+
+const tagColumns = `id, user_id, name, version, change_seq, created_at, updated_at, deleted_at`
+
+// rowQuerier - общее у *sql.DB и *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (r *DatabaseRepository) CreateTag(tag *Tag) error {
+	// При конфликте ID строка не возвращается: метку с этим ID уже создал этот или другой запрос
+	query := `
+		INSERT INTO tags (id, user_id, name)
+		VALUES (COALESCE(NULLIF($1, '')::uuid, uuid_generate_v4()), $2, $3)
+		ON CONFLICT (id) DO NOTHING
+		RETURNING id, version, change_seq, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(query, tag.ID, tag.UserID, tag.Name).Scan(
+		&tag.ID, &tag.Version, &tag.ChangeSeq, &tag.CreatedAt, &tag.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTagAlreadyExists
+		}
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
+		return WrapError(err, "не удалось создать метку")
+	}
+
+	return nil
+}
+
+func (r *DatabaseRepository) GetTag(id string, userID int) (*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+	`
+
+	tag, err := scanTag(r.db.QueryRow(query, id, userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTagNotFound
+		}
+		return nil, WrapError(err, "не удалось получить метку")
+	}
+
+	return tag, nil
+}
+
+func (r *DatabaseRepository) ListTags(userID int) ([]*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE user_id = $1 AND deleted_at IS NULL
+		ORDER BY name
+	`
+
+	tags, err := queryTags(r.db, query, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить метки")
+	}
+
+	return tags, nil
+}
+
+// RenameTag меняет название метки, если ее версия равна tag.Version. Назначения не меняются:
+// секреты ссылаются на метку по ID.
+func (r *DatabaseRepository) RenameTag(tag *Tag) error {
+	query := `
+		UPDATE tags
+		SET name = $3,
+		    version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND version = $4
+		RETURNING version, change_seq, created_at, updated_at
+	`
+
+	err := r.db.QueryRow(query, tag.ID, tag.UserID, tag.Name, tag.Version).Scan(
+		&tag.Version, &tag.ChangeSeq, &tag.CreatedAt, &tag.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return rejectionError(r.db, tag.ID, tag.UserID)
+		}
+		if isUniqueViolation(err) {
+			return ErrNameTaken
+		}
+		return WrapError(err, "не удалось переименовать метку")
+	}
+
+	return nil
+}
+
+// DeleteTag оставляет от метки надгробие и снимает ее со всех секретов. Возвращает
+// неудаленные секреты, у которых изменился набор меток. version 0 - без проверки версии.
+func (r *DatabaseRepository) DeleteTag(id string, userID int, version int) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	var deletedID string
+	err = tx.QueryRow(`
+		UPDATE tags
+		SET deleted_at = NOW(),
+		    version = version + 1
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)
+		RETURNING id
+	`, id, userID, version).Scan(&deletedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, rejectionError(tx, id, userID)
+		}
+		return nil, WrapError(err, "не удалось удалить метку")
+	}
+
+	untagged, err := queryIDs(tx, `DELETE FROM secret_tags WHERE tag_id = $1 RETURNING secret_id`, id)
+	if err != nil {
+		return nil, WrapError(err, "не удалось снять метку с секретов")
+	}
+
+	secretIDs, err := bumpSecrets(tx, userID, untagged)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return secretIDs, nil
+}
+
+// Assign добавляет и снимает метки у секретов одной транзакцией. Если хотя бы один
+// секрет или метка не найдены, не меняется ничего. Возвращает секреты, у которых изменился набор меток.
+func (r *DatabaseRepository) Assign(userID int, req *AssignRequest) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	found, err := countLive(tx, "secrets", userID, req.SecretIDs)
+	if err != nil {
+		return nil, err
+	}
+	if found != countUnique(req.SecretIDs) {
+		return nil, ErrSecretNotFound
+	}
+
+	tagIDs := append(append([]string{}, req.Add...), req.Remove...)
+	found, err = countLive(tx, "tags", userID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+	if found != countUnique(tagIDs) {
+		return nil, ErrTagNotFound
+	}
+
+	changed := []string{}
+	if len(req.Add) > 0 {
+		added, err := queryIDs(tx, `
+			INSERT INTO secret_tags (secret_id, tag_id)
+			SELECT s, t FROM unnest($1::uuid[]) s CROSS JOIN unnest($2::uuid[]) t
+			ON CONFLICT DO NOTHING
+			RETURNING secret_id
+		`, req.SecretIDs, req.Add)
+		if err != nil {
+			return nil, WrapError(err, "не удалось назначить метки")
+		}
+		changed = append(changed, added...)
+	}
+	if len(req.Remove) > 0 {
+		removed, err := queryIDs(tx, `
+			DELETE FROM secret_tags
+			WHERE secret_id = ANY($1::uuid[]) AND tag_id = ANY($2::uuid[])
+			RETURNING secret_id
+		`, req.SecretIDs, req.Remove)
+		if err != nil {
+			return nil, WrapError(err, "не удалось снять метки")
+		}
+		changed = append(changed, removed...)
+	}
+
+	secretIDs, err := bumpSecrets(tx, userID, changed)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return secretIDs, nil
+}
+
+// GetTagChanges возвращает до limit меток пользователя, включая надгробия,
+// измененных после номера afterSeq, в порядке номеров изменений
+func (r *DatabaseRepository) GetTagChanges(userID int, afterSeq int64, limit int) ([]*Tag, error) {
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE user_id = $1 AND change_seq > $2
+		ORDER BY change_seq ASC
+		LIMIT $3
+	`
+
+	tags, err := queryTags(r.db, query, userID, afterSeq, limit)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить измененные метки")
+	}
+
+	return tags, nil
+}
+
+// PurgeTombstones физически удаляет надгробия меток старше deletedBefore,
+// если все устройства пользователя уже получили удаление
+func (r *DatabaseRepository) PurgeTombstones(deletedBefore time.Time) (int64, error) {
+	result, err := r.db.Exec(`
+		DELETE FROM tags t
+		WHERE t.deleted_at IS NOT NULL AND t.deleted_at < $1
+		  AND NOT EXISTS (
+		      SELECT 1 FROM sync_devices d
+		      WHERE d.user_id = t.user_id AND d.last_synced_seq < t.change_seq
+		  )
+	`, deletedBefore)
+	if err != nil {
+		return 0, WrapError(err, "не удалось удалить надгробия меток")
+	}
+
+	return result.RowsAffected()
+}
+
+// bumpSecrets увеличивает версию секретов с изменившимися метками, чтобы изменение попало
+// в ленту синхронизации. Секреты из корзины не меняются.
+func bumpSecrets(q rowQuerier, userID int, secretIDs []string) ([]string, error) {
+	if len(secretIDs) == 0 {
+		return []string{}, nil
+	}
+
+	ids, err := queryIDs(q, `
+		UPDATE secrets
+		SET version = version + 1
+		WHERE user_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+		RETURNING id
+	`, userID, secretIDs)
+	if err != nil {
+		return nil, WrapError(err, "не удалось обновить версии секретов")
+	}
+	return ids, nil
+}
+
+// rejectionError объясняет, почему изменение с проверкой версии не затронуло ни одной строки
+func rejectionError(q rowQuerier, id string, userID int) error {
+	var exists bool
+	err := q.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM tags WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL)
+	`, id, userID).Scan(&exists)
+	if err != nil {
+		return WrapError(err, "не удалось проверить версию метки")
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrTagNotFound
+}
+
+// countLive считает неудаленные строки пользователя в table (tags или secrets) среди ids
+func countLive(q rowQuerier, table string, userID int, ids []string) (int, error) {
+	var count int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM `+table+` WHERE user_id = $1 AND id = ANY($2::uuid[]) AND deleted_at IS NULL
+	`, userID, ids).Scan(&count)
+	if err != nil {
+		return 0, WrapError(err, "не удалось проверить секреты и метки")
+	}
+	return count, nil
+}
+
+func countUnique(ids []string) int {
+	unique := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return len(unique)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func queryIDs(q rowQuerier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func queryTags(q rowQuerier, query string, args ...interface{}) ([]*Tag, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []*Tag
+	for rows.Next() {
+		tag, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTag(row scanner) (*Tag, error) {
+	var tag Tag
+
+	err := row.Scan(
+		&tag.ID,
+		&tag.UserID,
+		&tag.Name,
+		&tag.Version,
+		&tag.ChangeSeq,
+		&tag.CreatedAt,
+		&tag.UpdatedAt,
+		&tag.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
@@ -0,0 +1,274 @@
+package tag
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/google/uuid"
+)
+
+// RealtimeService рассылает изменения меток и секретов с измененными метками на другие устройства
+type RealtimeService interface {
+	NotifyTagCreated(userID int, tagID string, excludeSessionID string) error
+	NotifyTagUpdated(userID int, tagID string, excludeSessionID string) error
+	NotifyTagDeleted(userID int, tagID string, excludeSessionID string) error
+	NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error
+}
+
+type Service struct {
+	repo            Repository
+	realtimeService RealtimeService
+}
+
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo: repo,
+	}
+}
+
+func (s *Service) SetRealtimeService(realtimeService RealtimeService) {
+	s.realtimeService = realtimeService
+}
+
+func (s *Service) CreateTag(userID int, req *CreateTagRequest, excludeSessionID string) (*Tag, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	id, err := normalizeID(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	name, err := normalizeName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := &Tag{
+		ID:     id,
+		UserID: userID,
+		Name:   name,
+	}
+
+	if err := s.repo.CreateTag(tag); err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Tag] Ошибка создания метки в репозитории")
+		}
+		return nil, WrapError(err, "не удалось создать метку")
+	}
+
+	s.notify(RealtimeService.NotifyTagCreated, userID, tag.ID, excludeSessionID)
+
+	return tag, nil
+}
+
+func (s *Service) ListTags(userID int) ([]*Tag, error) {
+	tags, err := s.repo.ListTags(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Tag] Ошибка получения меток из репозитория")
+		return nil, WrapError(err, "не удалось получить метки")
+	}
+
+	if tags == nil {
+		tags = []*Tag{}
+	}
+
+	return tags, nil
+}
+
+func (s *Service) RenameTag(id string, userID int, req *RenameTagRequest, excludeSessionID string) (*Tag, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	id, err := pathID(id)
+	if err != nil {
+		return nil, err
+	}
+	name, err := normalizeName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := &Tag{
+		ID:      id,
+		UserID:  userID,
+		Name:    name,
+		Version: req.Version,
+	}
+
+	if err := s.repo.RenameTag(tag); err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"tag_id":  id,
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Tag] Ошибка переименования метки в репозитории")
+		}
+		return nil, WrapError(err, "не удалось переименовать метку")
+	}
+
+	s.notify(RealtimeService.NotifyTagUpdated, userID, tag.ID, excludeSessionID)
+
+	return tag, nil
+}
+
+// DeleteTag удаляет метку и снимает ее со всех секретов. version 0 - без проверки версии.
+func (s *Service) DeleteTag(id string, userID int, version int, excludeSessionID string) error {
+	id, err := pathID(id)
+	if err != nil {
+		return err
+	}
+
+	secretIDs, err := s.repo.DeleteTag(id, userID, version)
+	if err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"tag_id":  id,
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Tag] Ошибка удаления метки в репозитории")
+		}
+		return WrapError(err, "не удалось удалить метку")
+	}
+
+	s.notify(RealtimeService.NotifyTagDeleted, userID, id, excludeSessionID)
+	s.notifySecrets(userID, secretIDs, excludeSessionID)
+
+	return nil
+}
+
+// Assign добавляет секретам метки req.Add и снимает req.Remove
+func (s *Service) Assign(userID int, req *AssignRequest, excludeSessionID string) (*AssignResult, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	if len(req.SecretIDs) == 0 || len(req.Add)+len(req.Remove) == 0 {
+		return nil, ErrNothingToAssign
+	}
+	if len(req.SecretIDs) > MaxAssignSecrets {
+		return nil, ErrTooManyItems
+	}
+
+	normalized := &AssignRequest{}
+	var err error
+	if normalized.SecretIDs, err = normalizeIDs(req.SecretIDs); err != nil {
+		return nil, err
+	}
+	if normalized.Add, err = normalizeIDs(req.Add); err != nil {
+		return nil, err
+	}
+	if normalized.Remove, err = normalizeIDs(req.Remove); err != nil {
+		return nil, err
+	}
+
+	secretIDs, err := s.repo.Assign(userID, normalized)
+	if err != nil {
+		if !isExpectedError(err) {
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[Tag] Ошибка назначения меток в репозитории")
+		}
+		return nil, WrapError(err, "не удалось назначить метки")
+	}
+
+	s.notifySecrets(userID, secretIDs, excludeSessionID)
+
+	return &AssignResult{SecretIDs: secretIDs}, nil
+}
+
+// GetTagChanges - метки для ленты синхронизации, включая надгробия
+func (s *Service) GetTagChanges(userID int, afterSeq int64, limit int) ([]*Tag, error) {
+	return s.repo.GetTagChanges(userID, afterSeq, limit)
+}
+
+// notifySecrets сообщает о секретах, у которых изменился набор меток
+func (s *Service) notifySecrets(userID int, secretIDs []string, excludeSessionID string) {
+	if s.realtimeService == nil || len(secretIDs) == 0 {
+		return
+	}
+	if err := s.realtimeService.NotifySecretsBatch(userID, nil, secretIDs, nil, excludeSessionID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[Tag] Ошибка отправки события изменения меток секретов через WebSocket")
+	}
+}
+
+func (s *Service) notify(send func(RealtimeService, int, string, string) error, userID int, tagID string, excludeSessionID string) {
+	if s.realtimeService == nil {
+		return
+	}
+	if err := send(s.realtimeService, userID, tagID, excludeSessionID); err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"tag_id":  tagID,
+			"error":   err.Error(),
+		}).Error("[Tag] Ошибка отправки события метки через WebSocket")
+	}
+}
+
+func isExpectedError(err error) bool {
+	for _, expected := range []error{ErrTagNotFound, ErrTagAlreadyExists, ErrNameTaken, ErrVersionConflict, ErrSecretNotFound} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeName убирает пробелы по краям: " prod" и "prod" - одна метка
+func normalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrNameRequired
+	}
+	if utf8.RuneCountInString(name) > MaxNameLength {
+		return "", ErrNameTooLong
+	}
+	return name, nil
+}
+
+// normalizeID проверяет UUID и приводит его к каноническому виду. Пустой ID допустим.
+func normalizeID(id string) (string, error) {
+	if id == "" {
+		return "", nil
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	return parsed.String(), nil
+}
+
+// pathID - ID метки из пути запроса. Строка, не являющаяся UUID, не может быть ID метки.
+func pathID(id string) (string, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", ErrTagNotFound
+	}
+	return parsed.String(), nil
+}
+
+func normalizeIDs(ids []string) ([]string, error) {
+	normalized := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return nil, ErrInvalidID
+		}
+		parsed, err := normalizeID(id)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, parsed)
+	}
+	return normalized, nil
+}
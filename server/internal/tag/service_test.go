@@ -0,0 +1,403 @@
+package tag
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockRepository хранит метки в памяти. secrets - ID секрета -> множество ID его меток.
+type MockRepository struct {
+	tags      map[string]*Tag
+	secrets   map[string]map[string]bool
+	changeSeq int64
+	idCounter int
+}
+
+func NewMockRepository() *MockRepository {
+	return &MockRepository{
+		tags:    make(map[string]*Tag),
+		secrets: make(map[string]map[string]bool),
+	}
+}
+
+func (m *MockRepository) touch(tag *Tag) {
+	m.changeSeq++
+	tag.ChangeSeq = m.changeSeq
+	tag.UpdatedAt = time.Now()
+}
+
+func (m *MockRepository) live(id string, userID int) (*Tag, bool) {
+	tag, ok := m.tags[id]
+	if !ok || tag.UserID != userID || tag.DeletedAt.Valid {
+		return nil, false
+	}
+	return tag, true
+}
+
+func (m *MockRepository) nameTaken(userID int, name string, exceptID string) bool {
+	for _, tag := range m.tags {
+		if tag.UserID == userID && tag.Name == name && tag.ID != exceptID && !tag.DeletedAt.Valid {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockRepository) CreateTag(tag *Tag) error {
+	if tag.ID == "" {
+		m.idCounter++
+		tag.ID = fmt.Sprintf("00000000-0000-0000-0000-%012d", m.idCounter)
+	}
+	if _, exists := m.tags[tag.ID]; exists {
+		return ErrTagAlreadyExists
+	}
+	if m.nameTaken(tag.UserID, tag.Name, "") {
+		return ErrNameTaken
+	}
+
+	tag.Version = 1
+	tag.CreatedAt = time.Now()
+	m.touch(tag)
+	stored := *tag
+	m.tags[tag.ID] = &stored
+	return nil
+}
+
+func (m *MockRepository) GetTag(id string, userID int) (*Tag, error) {
+	tag, ok := m.live(id, userID)
+	if !ok {
+		return nil, ErrTagNotFound
+	}
+	copied := *tag
+	return &copied, nil
+}
+
+func (m *MockRepository) ListTags(userID int) ([]*Tag, error) {
+	var result []*Tag
+	for _, tag := range m.tags {
+		if tag.UserID == userID && !tag.DeletedAt.Valid {
+			result = append(result, tag)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (m *MockRepository) RenameTag(tag *Tag) error {
+	existing, ok := m.live(tag.ID, tag.UserID)
+	if !ok {
+		return ErrTagNotFound
+	}
+	if existing.Version != tag.Version {
+		return ErrVersionConflict
+	}
+	if m.nameTaken(tag.UserID, tag.Name, tag.ID) {
+		return ErrNameTaken
+	}
+
+	existing.Name = tag.Name
+	existing.Version++
+	m.touch(existing)
+	*tag = *existing
+	return nil
+}
+
+func (m *MockRepository) DeleteTag(id string, userID int, version int) ([]string, error) {
+	existing, ok := m.live(id, userID)
+	if !ok {
+		return nil, ErrTagNotFound
+	}
+	if version != 0 && existing.Version != version {
+		return nil, ErrVersionConflict
+	}
+
+	existing.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	existing.Version++
+	m.touch(existing)
+
+	secretIDs := []string{}
+	for secretID, tags := range m.secrets {
+		if tags[id] {
+			delete(tags, id)
+			secretIDs = append(secretIDs, secretID)
+		}
+	}
+	sort.Strings(secretIDs)
+	return secretIDs, nil
+}
+
+func (m *MockRepository) Assign(userID int, req *AssignRequest) ([]string, error) {
+	for _, id := range req.SecretIDs {
+		if _, ok := m.secrets[id]; !ok {
+			return nil, ErrSecretNotFound
+		}
+	}
+	for _, id := range append(append([]string{}, req.Add...), req.Remove...) {
+		if _, ok := m.live(id, userID); !ok {
+			return nil, ErrTagNotFound
+		}
+	}
+
+	changed := []string{}
+	for _, secretID := range req.SecretIDs {
+		tags := m.secrets[secretID]
+		touched := false
+		for _, id := range req.Add {
+			if !tags[id] {
+				tags[id] = true
+				touched = true
+			}
+		}
+		for _, id := range req.Remove {
+			if tags[id] {
+				delete(tags, id)
+				touched = true
+			}
+		}
+		if touched {
+			changed = append(changed, secretID)
+		}
+	}
+	return changed, nil
+}
+
+func (m *MockRepository) GetTagChanges(userID int, afterSeq int64, limit int) ([]*Tag, error) {
+	var result []*Tag
+	for _, tag := range m.tags {
+		if tag.UserID == userID && tag.ChangeSeq > afterSeq {
+			result = append(result, tag)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockRepository) PurgeTombstones(deletedBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+type tagEvent struct {
+	Type  string
+	TagID string
+}
+
+type MockRealtimeService struct {
+	events         []tagEvent
+	updatedSecrets []string
+}
+
+func (m *MockRealtimeService) NotifyTagCreated(userID int, tagID string, excludeSessionID string) error {
+	m.events = append(m.events, tagEvent{"created", tagID})
+	return nil
+}
+
+func (m *MockRealtimeService) NotifyTagUpdated(userID int, tagID string, excludeSessionID string) error {
+	m.events = append(m.events, tagEvent{"updated", tagID})
+	return nil
+}
+
+func (m *MockRealtimeService) NotifyTagDeleted(userID int, tagID string, excludeSessionID string) error {
+	m.events = append(m.events, tagEvent{"deleted", tagID})
+	return nil
+}
+
+func (m *MockRealtimeService) NotifySecretsBatch(userID int, created, updated, deleted []string, excludeSessionID string) error {
+	m.updatedSecrets = append(m.updatedSecrets, updated...)
+	return nil
+}
+
+func newTestService() (*Service, *MockRepository, *MockRealtimeService) {
+	repo := NewMockRepository()
+	realtime := &MockRealtimeService{}
+	service := NewService(repo)
+	service.SetRealtimeService(realtime)
+	return service, repo, realtime
+}
+
+func TestService_CreateTag(t *testing.T) {
+	service, _, realtime := newTestService()
+
+	tag, err := service.CreateTag(1, &CreateTagRequest{Name: "  prod "}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", tag.Name, "пробелы по краям названия убираются")
+	assert.Equal(t, 1, tag.Version)
+	assert.Equal(t, []tagEvent{{"created", tag.ID}}, realtime.events)
+
+	_, err = service.CreateTag(1, &CreateTagRequest{Name: "prod"}, "")
+	assert.ErrorIs(t, err, ErrNameTaken)
+
+	// Названия уникальны в пределах пользователя
+	_, err = service.CreateTag(2, &CreateTagRequest{Name: "prod"}, "")
+	assert.NoError(t, err)
+}
+
+func TestService_CreateTag_Validation(t *testing.T) {
+	service, _, _ := newTestService()
+
+	tests := []struct {
+		name string
+		req  *CreateTagRequest
+		err  error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"empty name", &CreateTagRequest{Name: "  "}, ErrNameRequired},
+		{"long name", &CreateTagRequest{Name: strings.Repeat("я", MaxNameLength+1)}, ErrNameTooLong},
+		{"invalid id", &CreateTagRequest{ID: "not-a-uuid", Name: "a"}, ErrInvalidID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateTag(1, tt.req, "")
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestService_CreateTag_ClientID(t *testing.T) {
+	service, _, _ := newTestService()
+	id := "6f1c2b7e-3d4a-4f5b-8c6d-7e8f9a0b1c2d"
+
+	tag, err := service.CreateTag(1, &CreateTagRequest{ID: strings.ToUpper(id), Name: "a"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, id, tag.ID)
+
+	_, err = service.CreateTag(1, &CreateTagRequest{ID: id, Name: "b"}, "")
+	assert.ErrorIs(t, err, ErrTagAlreadyExists)
+}
+
+func TestService_ListTags(t *testing.T) {
+	service, _, _ := newTestService()
+
+	tags, err := service.ListTags(1)
+	require.NoError(t, err)
+	assert.NotNil(t, tags)
+	assert.Empty(t, tags)
+
+	_, _ = service.CreateTag(1, &CreateTagRequest{Name: "work"}, "")
+	_, _ = service.CreateTag(1, &CreateTagRequest{Name: "home"}, "")
+	_, _ = service.CreateTag(2, &CreateTagRequest{Name: "other"}, "")
+
+	tags, err = service.ListTags(1)
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	assert.Equal(t, "home", tags[0].Name)
+	assert.Equal(t, "work", tags[1].Name)
+}
+
+func TestService_RenameTag(t *testing.T) {
+	service, _, realtime := newTestService()
+
+	a, _ := service.CreateTag(1, &CreateTagRequest{Name: "a"}, "")
+	_, _ = service.CreateTag(1, &CreateTagRequest{Name: "b"}, "")
+
+	renamed, err := service.RenameTag(a.ID, 1, &RenameTagRequest{Name: "c", Version: 1}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "c", renamed.Name)
+	assert.Equal(t, 2, renamed.Version)
+	assert.Equal(t, tagEvent{"updated", a.ID}, realtime.events[len(realtime.events)-1])
+
+	_, err = service.RenameTag(a.ID, 1, &RenameTagRequest{Name: "d", Version: 1}, "")
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	_, err = service.RenameTag(a.ID, 1, &RenameTagRequest{Name: "b", Version: 2}, "")
+	assert.ErrorIs(t, err, ErrNameTaken)
+
+	_, err = service.RenameTag(a.ID, 2, &RenameTagRequest{Name: "d", Version: 2}, "")
+	assert.ErrorIs(t, err, ErrTagNotFound)
+
+	_, err = service.RenameTag("not-a-uuid", 1, &RenameTagRequest{Name: "d", Version: 1}, "")
+	assert.ErrorIs(t, err, ErrTagNotFound)
+}
+
+func TestService_DeleteTag(t *testing.T) {
+	service, repo, realtime := newTestService()
+
+	tag, _ := service.CreateTag(1, &CreateTagRequest{Name: "doomed"}, "")
+	repo.secrets["secret-1"] = map[string]bool{tag.ID: true}
+	repo.secrets["secret-2"] = map[string]bool{}
+
+	assert.ErrorIs(t, service.DeleteTag(tag.ID, 1, 5, ""), ErrVersionConflict)
+
+	require.NoError(t, service.DeleteTag(tag.ID, 1, tag.Version, ""))
+
+	tags, _ := service.ListTags(1)
+	assert.Empty(t, tags)
+	assert.Empty(t, repo.secrets["secret-1"], "метка снимается с секретов")
+	assert.Contains(t, realtime.events, tagEvent{"deleted", tag.ID})
+	assert.Equal(t, []string{"secret-1"}, realtime.updatedSecrets)
+
+	changes, _ := service.GetTagChanges(1, 0, 10)
+	require.Len(t, changes, 1)
+	assert.True(t, changes[0].DeletedAt.Valid, "удаленная метка остается в ленте синхронизации надгробием")
+
+	// Название удаленной метки снова свободно
+	_, err := service.CreateTag(1, &CreateTagRequest{Name: "doomed"}, "")
+	assert.NoError(t, err)
+}
+
+func TestService_Assign(t *testing.T) {
+	service, repo, realtime := newTestService()
+
+	prod, _ := service.CreateTag(1, &CreateTagRequest{Name: "prod"}, "")
+	dev, _ := service.CreateTag(1, &CreateTagRequest{Name: "dev"}, "")
+	first := "11111111-1111-1111-1111-111111111111"
+	second := "22222222-2222-2222-2222-222222222222"
+	repo.secrets[first] = map[string]bool{}
+	repo.secrets[second] = map[string]bool{prod.ID: true}
+
+	result, err := service.Assign(1, &AssignRequest{SecretIDs: []string{first, strings.ToUpper(second)}, Add: []string{prod.ID}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{first}, result.SecretIDs, "секрет, у которого метка уже есть, не меняется")
+	assert.Equal(t, []string{first}, realtime.updatedSecrets)
+
+	result, err = service.Assign(1, &AssignRequest{SecretIDs: []string{first, second}, Add: []string{dev.ID}, Remove: []string{prod.ID}}, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, result.SecretIDs)
+	assert.Equal(t, map[string]bool{dev.ID: true}, repo.secrets[first])
+	assert.Equal(t, map[string]bool{dev.ID: true}, repo.secrets[second])
+}
+
+func TestService_Assign_Validation(t *testing.T) {
+	service, repo, _ := newTestService()
+
+	tag, _ := service.CreateTag(1, &CreateTagRequest{Name: "prod"}, "")
+	secretID := "11111111-1111-1111-1111-111111111111"
+	repo.secrets[secretID] = map[string]bool{}
+	tooMany := make([]string, MaxAssignSecrets+1)
+
+	tests := []struct {
+		name string
+		req  *AssignRequest
+		err  error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"no secrets", &AssignRequest{Add: []string{tag.ID}}, ErrNothingToAssign},
+		{"no tags", &AssignRequest{SecretIDs: []string{secretID}}, ErrNothingToAssign},
+		{"too many", &AssignRequest{SecretIDs: tooMany, Add: []string{tag.ID}}, ErrTooManyItems},
+		{"invalid secret id", &AssignRequest{SecretIDs: []string{"x"}, Add: []string{tag.ID}}, ErrInvalidID},
+		{"empty tag id", &AssignRequest{SecretIDs: []string{secretID}, Remove: []string{""}}, ErrInvalidID},
+		{"unknown secret", &AssignRequest{SecretIDs: []string{"33333333-3333-3333-3333-333333333333"}, Add: []string{tag.ID}}, ErrSecretNotFound},
+		{"unknown tag", &AssignRequest{SecretIDs: []string{secretID}, Add: []string{"33333333-3333-3333-3333-333333333333"}}, ErrTagNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Assign(1, tt.req, "")
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestService_WithoutRealtime(t *testing.T) {
+	service := NewService(NewMockRepository())
+
+	tag, err := service.CreateTag(1, &CreateTagRequest{Name: "a"}, "")
+	require.NoError(t, err)
+	assert.NoError(t, service.DeleteTag(tag.ID, 1, 0, ""))
+}
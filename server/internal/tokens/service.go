@@ -72,7 +72,28 @@ func (s *Service) generateRefreshToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
+// MFATokenTTL - сколько действует токен второго шага входа
+const MFATokenTTL = 5 * time.Minute
+
+// GenerateMFAToken выдает короткоживущий токен, который после проверки пароля
+// обменивается на пару токенов вторым фактором. Доступа к API он не дает.
+func (s *Service) GenerateMFAToken(userID int, email string) (string, error) {
+	token, err := s.generateJWT(userID, email, "mfa", MFATokenTTL)
+	if err != nil {
+		return "", fmt.Errorf("не удалось создать токен второго фактора: %w", err)
+	}
+	return token, nil
+}
+
 func (s *Service) ValidateAccessToken(tokenString string) (*Claims, error) {
+	return s.validateToken(tokenString, "access")
+}
+
+func (s *Service) ValidateMFAToken(tokenString string) (*Claims, error) {
+	return s.validateToken(tokenString, "mfa")
+}
+
+func (s *Service) validateToken(tokenString, expectedType string) (*Claims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("неожиданный метод подписи: %v", token.Header["alg"])
@@ -86,7 +107,7 @@ func (s *Service) ValidateAccessToken(tokenString string) (*Claims, error) {
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		tokenType, ok := claims["type"].(string)
-		if !ok || tokenType != "access" {
+		if !ok || tokenType != expectedType {
 			return nil, fmt.Errorf("Неверный тип токена")
 		}
 
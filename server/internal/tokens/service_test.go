@@ -510,3 +510,32 @@ func TestService_GenerateRefreshToken_UniqueTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestService_MFAToken(t *testing.T) {
+	service := NewService(&MockRepository{}, "test-secret", 10*time.Minute, 24*time.Hour)
+
+	mfaToken, err := service.GenerateMFAToken(7, "test@example.com")
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	claims, err := service.ValidateMFAToken(mfaToken)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if claims.UserID != 7 || claims.Email != "test@example.com" || claims.Type != "mfa" {
+		t.Errorf("неожиданные claims: %+v", claims)
+	}
+
+	if _, err := service.ValidateAccessToken(mfaToken); err == nil {
+		t.Error("токен второго фактора не должен приниматься как access токен")
+	}
+
+	pair, err := service.GenerateTokenPair(7, "test@example.com")
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if _, err := service.ValidateMFAToken(pair.AccessToken); err == nil {
+		t.Error("access токен не должен приниматься как токен второго фактора")
+	}
+}
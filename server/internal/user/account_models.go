@@ -0,0 +1,41 @@
+package user
+
+import "time"
+
+// MaxAccountDeletionAttempts - неверных вводов кода удаления, после которых код перестает действовать
+const MaxAccountDeletionAttempts = 5
+
+// AccountDeletionCode - код подтверждения удаления аккаунта из письма
+type AccountDeletionCode struct {
+	ID        int
+	UserID    int
+	Code      string
+	Attempts  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// AccountDeletionRequest запрашивает код удаления аккаунта. Пароль подтверждает, что запрос
+// делает владелец, а не тот, к кому попал токен доступа.
+type AccountDeletionRequest struct {
+	Password string `json:"password"`
+}
+
+// DeleteAccountRequest удаляет аккаунт по паролю и коду из письма
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// AccountProfile - учетная запись в выгрузке данных пользователя
+type AccountProfile struct {
+	ID                  int                           `json:"id"`
+	Email               string                        `json:"email"`
+	EmailVerified       bool                          `json:"email_verified"`
+	CreatedAt           time.Time                     `json:"created_at"`
+	UpdatedAt           time.Time                     `json:"updated_at"`
+	TOTPEnabled         bool                          `json:"totp_enabled"`
+	Keys                []UserKeyResponse             `json:"keys"`
+	WebAuthnCredentials []*WebAuthnCredentialResponse `json:"webauthn_credentials"`
+}
@@ -0,0 +1,145 @@
+package user
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// GetAccountProfile собирает учетную запись для выгрузки: профиль, ключи и подключенные
+// вторые факторы. Секрет TOTP и открытые ключи passkey в выгрузку не попадают.
+func (s *Service) GetAccountProfile(userID int) (*AccountProfile, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := s.repo.ListUserKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.repo.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := s.repo.GetTOTP(userID)
+	if err != nil && !errors.Is(err, ErrTOTPNotFound) {
+		return nil, err
+	}
+
+	profile := &AccountProfile{
+		ID:                  user.ID,
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerified,
+		CreatedAt:           user.CreatedAt,
+		UpdatedAt:           user.UpdatedAt,
+		TOTPEnabled:         totp.Enabled(),
+		Keys:                make([]UserKeyResponse, 0, len(keys)),
+		WebAuthnCredentials: make([]*WebAuthnCredentialResponse, 0, len(credentials)),
+	}
+	for _, key := range keys {
+		profile.Keys = append(profile.Keys, key.ToResponse())
+	}
+	for _, cred := range credentials {
+		profile.WebAuthnCredentials = append(profile.WebAuthnCredentials, cred.ToResponse())
+	}
+
+	return profile, nil
+}
+
+// RequestAccountDeletion проверяет пароль и отправляет на email код подтверждения удаления
+func (s *Service) RequestAccountDeletion(userID int, req *AccountDeletionRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Password == "" {
+		return ErrPasswordRequired
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	// Действует только последний отправленный код
+	if err := s.repo.DeleteAccountDeletionCodes(user.ID); err != nil {
+		return err
+	}
+
+	code, err := generateEmailCode()
+	if err != nil {
+		return WrapError(err, "не удалось сгенерировать код удаления аккаунта")
+	}
+	deletionCode := &AccountDeletionCode{
+		UserID:    user.ID,
+		Code:      code,
+		ExpiresAt: time.Now().Add(s.verificationCodeTTL),
+	}
+	if err := s.repo.CreateAccountDeletionCode(deletionCode); err != nil {
+		return err
+	}
+
+	// Асинхронная отправка через worker
+	s.emailService.SendAccountDeletionEmail(user.Email, code)
+
+	return nil
+}
+
+// ConfirmAccountDeletion проверяет пароль и погашает код из письма. После этого аккаунт
+// можно удалять: все его записи удаляет account.Repository.
+func (s *Service) ConfirmAccountDeletion(userID int, req *DeleteAccountRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Password == "" {
+		return ErrPasswordRequired
+	}
+	if req.Code == "" {
+		return ErrDeletionCodeRequired
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	deletionCode, err := s.repo.GetActiveAccountDeletionCode(user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Попытка засчитывается до сравнения, как и при сбросе пароля
+	reserved, err := s.repo.ReserveAccountDeletionAttempt(deletionCode.ID, MaxAccountDeletionAttempts)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrInvalidDeletionCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(deletionCode.Code), []byte(req.Code)) != 1 {
+		return ErrInvalidDeletionCode
+	}
+
+	used, err := s.repo.UseAccountDeletionCode(deletionCode.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidDeletionCode
+	}
+
+	return nil
+}
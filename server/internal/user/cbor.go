@@ -0,0 +1,162 @@
+package user
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Декодер CBOR (RFC 8949) в объеме, который нужен WebAuthn: attestationObject, ключи COSE
+// и расширения authenticatorData. Поддерживаются целые числа, байтовые и текстовые строки,
+// массивы, словари, теги и простые значения. Строки и контейнеры неопределенной длины
+// и числа с плавающей точкой аутентификаторы в этих структурах не используют.
+
+const cborMaxDepth = 16
+
+var errCBORInvalid = errors.New("некорректные данные CBOR")
+
+// decodeCBOR разбирает первое значение из data и возвращает его вместе с числом прочитанных байт.
+// Целые числа возвращаются как int64, словари - как map[interface{}]interface{} с ключами int64 или string.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, d.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > cborMaxDepth || d.pos >= len(d.data) {
+		return nil, errCBORInvalid
+	}
+
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		default:
+			return nil, errCBORInvalid
+		}
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBORInvalid
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBORInvalid
+		}
+		return -1 - int64(arg), nil
+	case 2:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 3:
+		b, err := d.bytes(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		// Каждый элемент занимает хотя бы байт: длина больше остатка данных заведомо неверна
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, errCBORInvalid
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos)/2 {
+			return nil, errCBORInvalid
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errCBORInvalid
+			}
+			if _, ok := m[key]; ok {
+				return nil, errCBORInvalid
+			}
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = item
+		}
+		return m, nil
+	default:
+		// Теги (major 6) не меняют смысла значений WebAuthn, берем само значение
+		return d.value(depth + 1)
+	}
+}
+
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	var size int
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, errCBORInvalid
+	}
+
+	if len(d.data)-d.pos < size {
+		return 0, errCBORInvalid
+	}
+	var buf [8]byte
+	copy(buf[8-size:], d.data[d.pos:d.pos+size])
+	d.pos += size
+	return binary.BigEndian.Uint64(buf[:]), nil
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errCBORInvalid
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
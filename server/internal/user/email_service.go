@@ -0,0 +1,126 @@
+package user
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/mail"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/verification"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MaxEmailChangeAttempts - неверных вводов кода смены email, после которых код перестает действовать
+const MaxEmailChangeAttempts = 5
+
+// ChangeEmail отправляет код подтверждения на новый адрес. Email пользователя
+// меняется только в ConfirmEmailChange.
+func (s *Service) ChangeEmail(userID int, req *ChangeEmailRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Email == "" {
+		return ErrEmailRequired
+	}
+	if req.Password == "" {
+		return ErrPasswordRequired
+	}
+	if _, err := mail.ParseAddress(req.Email); err != nil {
+		return ErrInvalidEmail
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	if req.Email == user.Email {
+		return ErrEmailUnchanged
+	}
+
+	if existingUser, err := s.repo.GetUserByEmail(req.Email); err == nil && existingUser != nil {
+		return ErrUserAlreadyExists
+	}
+
+	// Действует только последний запрошенный адрес
+	if err := s.verificationRepo.DeleteEmailChangeCodes(user.ID); err != nil {
+		return WrapError(err, "не удалось удалить старые коды")
+	}
+
+	code, err := generateEmailCode()
+	if err != nil {
+		return WrapError(err, "не удалось сгенерировать код смены email")
+	}
+	verificationCode := &verification.VerificationCode{
+		UserID:    user.ID,
+		Code:      code,
+		ExpiresAt: time.Now().Add(s.verificationCodeTTL),
+		NewEmail:  req.Email,
+	}
+	if err := s.verificationRepo.CreateVerificationCode(verificationCode); err != nil {
+		return WrapError(err, "не удалось создать код верификации")
+	}
+
+	// Асинхронная отправка через worker
+	s.emailService.SendEmail(req.Email, code)
+
+	return nil
+}
+
+// ConfirmEmailChange меняет email на адрес, подтвержденный кодом, и уведомляет прежний адрес
+func (s *Service) ConfirmEmailChange(userID int, req *ConfirmEmailChangeRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Code == "" {
+		return verification.ErrCodeRequired
+	}
+
+	verificationCode, err := s.verificationRepo.GetActiveEmailChangeCode(userID)
+	if err != nil {
+		if errors.Is(err, verification.ErrCodeNotFound) {
+			return verification.ErrInvalidCode
+		}
+		return WrapError(err, "не удалось получить код верификации")
+	}
+
+	if verificationCode.ExpiresAt.Before(time.Now()) {
+		return verification.ErrCodeExpired
+	}
+
+	// Попытка засчитывается до сравнения, как и для кода сброса пароля
+	reserved, err := s.verificationRepo.ReserveEmailChangeAttempt(verificationCode.ID, MaxEmailChangeAttempts)
+	if err != nil {
+		return WrapError(err, "не удалось учесть попытку ввода кода")
+	}
+	if !reserved {
+		return verification.ErrInvalidCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(verificationCode.Code), []byte(req.Code)) != 1 {
+		return verification.ErrInvalidCode
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	// Адрес мог занять другой пользователь, пока код был в пути. Код гасится только после
+	// смены адреса, чтобы при ошибке его можно было ввести снова.
+	if err := s.repo.UpdateEmail(user.ID, verificationCode.NewEmail); err != nil {
+		return err
+	}
+
+	if err := s.verificationRepo.MarkCodeAsUsed(verificationCode.ID); err != nil {
+		return WrapError(err, "не удалось пометить код как использованный")
+	}
+
+	s.emailService.SendEmailChangedNotice(user.Email, verificationCode.NewEmail)
+
+	return nil
+}
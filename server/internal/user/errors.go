@@ -27,6 +27,67 @@ var (
 	ErrRequestRequired = errors.New("user.request_required")
 
 	ErrEmailNotVerified = errors.New("user.email_not_verified")
+
+	ErrNewPasswordRequired = errors.New("user.new_password_required")
+
+	ErrEmailUnchanged = errors.New("user.email_unchanged")
+)
+
+// Ошибки реестра открытых ключей
+var (
+	ErrKeyAlgorithmInvalid = errors.New("user.key_algorithm_invalid")
+
+	ErrPublicKeyInvalid = errors.New("user.public_key_invalid")
+
+	ErrEncryptedPrivateKeyInvalid = errors.New("user.encrypted_private_key_invalid")
+
+	ErrPublicKeyNotFound = errors.New("user.public_key_not_found")
+)
+
+// Ошибки второго фактора
+var (
+	ErrTOTPAlreadyEnabled = errors.New("user.totp_already_enabled")
+
+	ErrTOTPNotFound = errors.New("user.totp_not_found")
+
+	ErrMFACodeRequired = errors.New("user.mfa_code_required")
+
+	ErrInvalidMFACode = errors.New("user.invalid_mfa_code")
+
+	ErrInvalidMFAToken = errors.New("user.invalid_mfa_token")
+
+	ErrMFATooManyAttempts = errors.New("user.mfa_too_many_attempts")
+)
+
+// Ошибки WebAuthn
+var (
+	ErrWebAuthnSessionNotFound = errors.New("user.webauthn_session_not_found")
+
+	ErrWebAuthnVerificationFailed = errors.New("user.webauthn_verification_failed")
+
+	ErrWebAuthnAlgorithmUnsupported = errors.New("user.webauthn_algorithm_unsupported")
+
+	ErrWebAuthnCredentialExists = errors.New("user.webauthn_credential_exists")
+
+	ErrWebAuthnCredentialNotFound = errors.New("user.webauthn_credential_not_found")
+
+	ErrWebAuthnCredentialNameTooLong = errors.New("user.webauthn_credential_name_too_long")
+
+	ErrWebAuthnConfirmationRequired = errors.New("user.webauthn_confirmation_required")
+)
+
+// Ошибки сброса пароля
+var (
+	ErrResetCodeRequired = errors.New("user.reset_code_required")
+
+	ErrInvalidResetCode = errors.New("user.invalid_reset_code")
+)
+
+// Ошибки удаления аккаунта
+var (
+	ErrDeletionCodeRequired = errors.New("user.deletion_code_required")
+
+	ErrInvalidDeletionCode = errors.New("user.invalid_deletion_code")
 )
 
 type HTTPError struct {
@@ -18,10 +18,35 @@ type UserService interface {
 	RegisterUser(req *RegisterRequest) error
 	VerifyEmail(req *verification.VerifyEmailRequest) (*tokens.TokenPair, error)
 	ResendVerificationCode(req *verification.ResendCodeRequest) error
-	LoginUser(req *LoginRequest) (*tokens.TokenPair, error)
+	LoginUser(req *LoginRequest) (*LoginResult, error)
 	RefreshTokens(refreshTokenString string) (*tokens.TokenPair, error)
 	Logout(refreshTokenString string) error
 	LogoutAll(userID int) error
+	ForgotPassword(req *ForgotPasswordRequest) error
+	ResetPassword(req *ResetPasswordRequest) error
+	ChangePassword(userID int, req *ChangePasswordRequest) (*tokens.TokenPair, error)
+	ChangeEmail(userID int, req *ChangeEmailRequest) error
+	ConfirmEmailChange(userID int, req *ConfirmEmailChangeRequest) error
+	RequestAccountDeletion(userID int, req *AccountDeletionRequest) error
+
+	PutUserKey(userID int, req *PutKeyRequest) (*UserKey, error)
+	ListUserKeys(userID int) ([]*UserKey, error)
+	GetPublicKey(email string, keyID string) (*UserKey, error)
+
+	SetupTOTP(userID int) (*TOTPSetupResponse, error)
+	ConfirmTOTP(userID int, req *TOTPConfirmRequest) ([]string, error)
+	DisableTOTP(userID int, req *TOTPDisableRequest) error
+	CompleteLogin2FA(req *Login2FARequest) (*tokens.TokenPair, error)
+
+	BeginWebAuthnRegistration(userID int) (*WebAuthnRegistrationOptions, error)
+	FinishWebAuthnRegistration(userID int, req *WebAuthnRegisterFinishRequest) (*WebAuthnCredential, error)
+	ListWebAuthnCredentials(userID int) ([]*WebAuthnCredential, error)
+	BeginWebAuthnConfirmation(userID int) (*WebAuthnLoginOptions, error)
+	DeleteWebAuthnCredential(userID int, id string, req *WebAuthnDeleteRequest) error
+	BeginWebAuthnLogin(req *WebAuthnLoginBeginRequest) (*WebAuthnLoginOptions, error)
+	FinishWebAuthnLogin(req *WebAuthnLoginFinishRequest) (*tokens.TokenPair, error)
+	BeginWebAuthnMFA(req *WebAuthnMFABeginRequest) (*WebAuthnLoginOptions, error)
+	FinishWebAuthnMFA(req *WebAuthnMFAFinishRequest) (*tokens.TokenPair, error)
 }
 
 type Handler struct {
@@ -189,12 +214,12 @@ func (h *Handler) ResendCode(w http.ResponseWriter, r *http.Request) {
 
 // Login godoc
 // @Summary Вход пользователя
-// @Description Аутентифицирует пользователя и возвращает access token
+// @Description Аутентифицирует пользователя и возвращает access token. Если включен второй фактор, возвращает mfa_token и methods: totp - POST /user/login/2fa, webauthn - POST /user/login/2fa/webauthn/begin
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param request body LoginRequest true "Данные для входа"
-// @Success 200 {object} map[string]string "access_token"
+// @Success 200 {object} map[string]string "access_token или MFAChallengeResponse"
 // @Failure 400 {object} map[string]string "Неверные учетные данные"
 // @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
 // @Router /user/login [post]
@@ -206,7 +231,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenPair, err := h.service.LoginUser(&req)
+	result, err := h.service.LoginUser(&req)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrInvalidCredentials):
@@ -229,9 +254,22 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	utils.SetRefreshTokenCookie(w, tokenPair.RefreshToken, h.refreshTokenTTL)
+	if result.MFAToken != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+			Methods:     result.MFAMethods,
+		}); err != nil {
+			logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+		}
+		return
+	}
 
-	h.sendTokenResponse(w, tokenPair.AccessToken)
+	utils.SetRefreshTokenCookie(w, result.Tokens.RefreshToken, h.refreshTokenTTL)
+
+	h.sendTokenResponse(w, result.Tokens.AccessToken)
 }
 
 // Refresh godoc
@@ -0,0 +1,68 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+)
+
+// RequestAccountDeletion godoc
+// @Summary Запрос удаления аккаунта
+// @Description Проверяет пароль и отправляет на email код, которым подтверждается DELETE /user
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body AccountDeletionRequest true "Текущий пароль"
+// @Success 200 {object} map[string]string "Код отправлен"
+// @Failure 400 {object} map[string]string "Ошибка валидации или неверный пароль"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/delete/code [post]
+func (h *Handler) RequestAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req AccountDeletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.RequestAccountDeletion(userID, &req); err != nil {
+		writeAccountDeletionError(w, r, userID, err, "[User] Ошибка запроса удаления аккаунта")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "deletion_code_sent",
+	})
+}
+
+func writeAccountDeletionError(w http.ResponseWriter, r *http.Request, userID int, err error, logMessage string) {
+	switch {
+	case errors.Is(err, ErrRequestRequired),
+		errors.Is(err, ErrPasswordRequired),
+		errors.Is(err, ErrInvalidCredentials),
+		errors.Is(err, ErrDeletionCodeRequired),
+		errors.Is(err, ErrInvalidDeletionCode):
+		localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, ErrUserNotFound):
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
@@ -0,0 +1,110 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/verification"
+)
+
+// ChangeEmail godoc
+// @Summary Смена email
+// @Description Отправляет код подтверждения на новый адрес. Email изменится после подтверждения кодом
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body ChangeEmailRequest true "Новый email и текущий пароль"
+// @Success 200 {object} map[string]string "Код отправлен"
+// @Failure 400 {object} map[string]string "Ошибка валидации или неверный пароль"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 409 {object} map[string]string "Адрес занят"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/email [put]
+func (h *Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.ChangeEmail(userID, &req); err != nil {
+		writeEmailChangeError(w, r, userID, err, "[User] Ошибка начала смены email")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "verification_code_sent",
+	})
+}
+
+// ConfirmEmailChange godoc
+// @Summary Подтверждение смены email
+// @Description Меняет email на новый адрес по коду из письма и уведомляет прежний адрес
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Param request body ConfirmEmailChangeRequest true "Код из письма"
+// @Success 204 "Email изменен"
+// @Failure 400 {object} map[string]string "Неверный или истекший код"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 409 {object} map[string]string "Адрес занят"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/email/confirm [post]
+func (h *Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req ConfirmEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.ConfirmEmailChange(userID, &req); err != nil {
+		writeEmailChangeError(w, r, userID, err, "[User] Ошибка подтверждения смены email")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeEmailChangeError(w http.ResponseWriter, r *http.Request, userID int, err error, logMessage string) {
+	switch {
+	case errors.Is(err, ErrRequestRequired),
+		errors.Is(err, ErrEmailRequired),
+		errors.Is(err, ErrInvalidEmail),
+		errors.Is(err, ErrPasswordRequired),
+		errors.Is(err, ErrInvalidCredentials),
+		errors.Is(err, ErrEmailUnchanged),
+		errors.Is(err, verification.ErrCodeRequired),
+		errors.Is(err, verification.ErrInvalidCode),
+		errors.Is(err, verification.ErrCodeExpired):
+		localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, ErrUserAlreadyExists):
+		localization.LocalizedError(w, r, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrUserNotFound):
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
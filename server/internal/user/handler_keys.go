@@ -0,0 +1,157 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/gorilla/mux"
+)
+
+// PutKeys godoc
+// @Summary Сохранение ключевой пары
+// @Description Делает ключ действующим. Тот же открытый ключ заменяет только зашифрованный закрытый, новый выводит прежний из работы; прежние ключи остаются доступными по key_id
+// @Tags keys
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body PutKeyRequest true "Алгоритм, открытый ключ и зашифрованный закрытый ключ"
+// @Param Idempotency-Key header string false "Ключ идемпотентности"
+// @Success 200 {object} UserKeyResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/keys [put]
+func (h *Handler) PutKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req PutKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	key, err := h.service.PutUserKey(userID, &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrKeyAlgorithmInvalid),
+			errors.Is(err, ErrPublicKeyInvalid),
+			errors.Is(err, ErrEncryptedPrivateKeyInvalid),
+			errors.Is(err, ErrRequestRequired):
+			localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+			return
+		case errors.Is(err, ErrUserNotFound):
+			localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"user_id": userID,
+				"error":   err.Error(),
+			}).Error("[User] Ошибка сохранения ключа пользователя")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(key.ToResponse()); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// MyKeys godoc
+// @Summary Свои ключевые пары
+// @Description Возвращает действующий и прежние ключи пользователя вместе с зашифрованными закрытыми ключами
+// @Tags keys
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} UserKeyResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/keys/me [get]
+func (h *Handler) MyKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	keys, err := h.service.ListUserKeys(userID)
+	if err != nil {
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error("[User] Ошибка получения ключей пользователя")
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+		return
+	}
+
+	response := make([]UserKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, key.ToResponse())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// PublicKey godoc
+// @Summary Открытый ключ пользователя
+// @Description Возвращает действующий открытый ключ пользователя или, если указан key_id, ключ с этим ID, в том числе выведенный из работы
+// @Tags keys
+// @Security BearerAuth
+// @Produce json
+// @Param email path string true "Email пользователя"
+// @Param key_id query string false "ID ключа"
+// @Success 200 {object} PublicKeyResponse
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Ключ не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /users/{email}/public-key [get]
+func (h *Handler) PublicKey(w http.ResponseWriter, r *http.Request) {
+	if _, ok := middleware.GetUserIDFromContext(r.Context()); !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	email := mux.Vars(r)["email"]
+	keyID := r.URL.Query().Get("key_id")
+
+	key, err := h.service.GetPublicKey(email, keyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEmailRequired):
+			localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+			return
+		case errors.Is(err, ErrPublicKeyNotFound):
+			localization.LocalizedError(w, r, http.StatusNotFound, "user.public_key_not_found", nil)
+			return
+		default:
+			logger.Log.WithFields(map[string]interface{}{
+				"email":  email,
+				"key_id": keyID,
+				"error":  err.Error(),
+			}).Error("[User] Ошибка получения открытого ключа")
+			localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(key.ToPublicResponse()); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/utils"
+)
+
+// ForgotPassword godoc
+// @Summary Запрос сброса пароля
+// @Description Отправляет на email одноразовый код сброса пароля, не больше 3 кодов в час на аккаунт. Ответ одинаковый для существующих и несуществующих адресов
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body ForgotPasswordRequest true "Email"
+// @Success 200 {object} map[string]string "Код отправлен"
+// @Failure 400 {object} map[string]string "Ошибка валидации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/password/forgot [post]
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.ForgotPassword(&req); err != nil {
+		writePasswordError(w, r, 0, err, "[User] Ошибка отправки кода сброса пароля")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "password_reset_code_sent",
+	})
+}
+
+// ResetPassword godoc
+// @Summary Сброс пароля
+// @Description Задает новый пароль по коду из письма. Код одноразовый, все сессии пользователя завершаются
+// @Tags auth
+// @Accept json
+// @Param request body ResetPasswordRequest true "Email, код и новый пароль"
+// @Success 204 "Пароль изменен"
+// @Failure 400 {object} map[string]string "Ошибка валидации или неверный код"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/password/reset [post]
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.ResetPassword(&req); err != nil {
+		writePasswordError(w, r, 0, err, "[User] Ошибка сброса пароля")
+		return
+	}
+
+	utils.DeleteRefreshTokenCookie(w)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword godoc
+// @Summary Смена пароля
+// @Description Меняет пароль по текущему паролю. Остальные сессии пользователя завершаются, текущая получает новую пару токенов
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body ChangePasswordRequest true "Текущий и новый пароль"
+// @Success 200 {object} map[string]string "access_token"
+// @Failure 400 {object} map[string]string "Ошибка валидации или неверный текущий пароль"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/password [put]
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	tokenPair, err := h.service.ChangePassword(userID, &req)
+	if err != nil {
+		writePasswordError(w, r, userID, err, "[User] Ошибка смены пароля")
+		return
+	}
+
+	utils.SetRefreshTokenCookie(w, tokenPair.RefreshToken, h.refreshTokenTTL)
+	h.sendTokenResponse(w, tokenPair.AccessToken)
+}
+
+// writePasswordError пишет ответ с ошибкой смены или сброса пароля. userID равен 0 для
+// запросов без авторизации.
+func writePasswordError(w http.ResponseWriter, r *http.Request, userID int, err error, logMessage string) {
+	switch {
+	case errors.Is(err, ErrRequestRequired),
+		errors.Is(err, ErrEmailRequired),
+		errors.Is(err, ErrPasswordRequired),
+		errors.Is(err, ErrNewPasswordRequired),
+		errors.Is(err, ErrPasswordTooShort),
+		errors.Is(err, ErrInvalidCredentials),
+		errors.Is(err, ErrResetCodeRequired),
+		errors.Is(err, ErrInvalidResetCode):
+		localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, ErrUserNotFound):
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+	default:
+		fields := map[string]interface{}{
+			"error": err.Error(),
+		}
+		if userID != 0 {
+			fields["user_id"] = userID
+		}
+		logger.Log.WithFields(fields).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
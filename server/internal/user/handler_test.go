@@ -7,39 +7,78 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Adigezalov/goph-keeper/internal/middleware"
 	"github.com/Adigezalov/goph-keeper/internal/tokens"
+	"github.com/Adigezalov/goph-keeper/internal/verification"
+	"github.com/gorilla/mux"
 )
 
 type MockService struct {
-	RegisterUserFunc  func(req *RegisterRequest) (*tokens.TokenPair, error)
-	LoginUserFunc     func(req *LoginRequest) (*tokens.TokenPair, error)
+	RegisterUserFunc  func(req *RegisterRequest) error
+	VerifyEmailFunc   func(req *verification.VerifyEmailRequest) (*tokens.TokenPair, error)
+	ResendCodeFunc    func(req *verification.ResendCodeRequest) error
+	LoginUserFunc     func(req *LoginRequest) (*LoginResult, error)
 	RefreshTokensFunc func(refreshTokenString string) (*tokens.TokenPair, error)
 	LogoutFunc        func(refreshTokenString string) error
 	LogoutAllFunc     func(userID int) error
+
+	ForgotPasswordFunc  func(req *ForgotPasswordRequest) error
+	ResetPasswordFunc   func(req *ResetPasswordRequest) error
+	ChangePasswordFunc  func(userID int, req *ChangePasswordRequest) (*tokens.TokenPair, error)
+	ChangeEmailFunc     func(userID int, req *ChangeEmailRequest) error
+	ConfirmEmailFunc    func(userID int, req *ConfirmEmailChangeRequest) error
+	RequestDeletionFunc func(userID int, req *AccountDeletionRequest) error
+
+	PutUserKeyFunc   func(userID int, req *PutKeyRequest) (*UserKey, error)
+	ListUserKeysFunc func(userID int) ([]*UserKey, error)
+	GetPublicKeyFunc func(email string, keyID string) (*UserKey, error)
+
+	ConfirmTOTPFunc      func(userID int, req *TOTPConfirmRequest) ([]string, error)
+	DisableTOTPFunc      func(userID int, req *TOTPDisableRequest) error
+	CompleteLogin2FAFunc func(req *Login2FARequest) (*tokens.TokenPair, error)
+
+	FinishWebAuthnRegistrationFunc func(userID int, req *WebAuthnRegisterFinishRequest) (*WebAuthnCredential, error)
+	DeleteWebAuthnCredentialFunc   func(userID int, id string, req *WebAuthnDeleteRequest) error
+	FinishWebAuthnLoginFunc        func(req *WebAuthnLoginFinishRequest) (*tokens.TokenPair, error)
+	BeginWebAuthnMFAFunc           func(req *WebAuthnMFABeginRequest) (*WebAuthnLoginOptions, error)
 }
 
-func (m *MockService) RegisterUser(req *RegisterRequest) (*tokens.TokenPair, error) {
+func (m *MockService) RegisterUser(req *RegisterRequest) error {
 	if m.RegisterUserFunc != nil {
 		return m.RegisterUserFunc(req)
 	}
+	return nil
+}
+
+func (m *MockService) VerifyEmail(req *verification.VerifyEmailRequest) (*tokens.TokenPair, error) {
+	if m.VerifyEmailFunc != nil {
+		return m.VerifyEmailFunc(req)
+	}
 	return &tokens.TokenPair{
 		AccessToken:  "mock-access-token",
 		RefreshToken: "mock-refresh-token",
 	}, nil
 }
 
-func (m *MockService) LoginUser(req *LoginRequest) (*tokens.TokenPair, error) {
+func (m *MockService) ResendVerificationCode(req *verification.ResendCodeRequest) error {
+	if m.ResendCodeFunc != nil {
+		return m.ResendCodeFunc(req)
+	}
+	return nil
+}
+
+func (m *MockService) LoginUser(req *LoginRequest) (*LoginResult, error) {
 	if m.LoginUserFunc != nil {
 		return m.LoginUserFunc(req)
 	}
-	return &tokens.TokenPair{
+	return &LoginResult{Tokens: &tokens.TokenPair{
 		AccessToken:  "mock-access-token",
 		RefreshToken: "mock-refresh-token",
-	}, nil
+	}}, nil
 }
 
 func (m *MockService) RefreshTokens(refreshTokenString string) (*tokens.TokenPair, error) {
@@ -66,6 +105,160 @@ func (m *MockService) LogoutAll(userID int) error {
 	return nil
 }
 
+func (m *MockService) ForgotPassword(req *ForgotPasswordRequest) error {
+	if m.ForgotPasswordFunc != nil {
+		return m.ForgotPasswordFunc(req)
+	}
+	return nil
+}
+
+func (m *MockService) ResetPassword(req *ResetPasswordRequest) error {
+	if m.ResetPasswordFunc != nil {
+		return m.ResetPasswordFunc(req)
+	}
+	return nil
+}
+
+func (m *MockService) ChangePassword(userID int, req *ChangePasswordRequest) (*tokens.TokenPair, error) {
+	if m.ChangePasswordFunc != nil {
+		return m.ChangePasswordFunc(userID, req)
+	}
+	return &tokens.TokenPair{
+		AccessToken:  "mock-access-token",
+		RefreshToken: "mock-refresh-token",
+	}, nil
+}
+
+func (m *MockService) ChangeEmail(userID int, req *ChangeEmailRequest) error {
+	if m.ChangeEmailFunc != nil {
+		return m.ChangeEmailFunc(userID, req)
+	}
+	return nil
+}
+
+func (m *MockService) ConfirmEmailChange(userID int, req *ConfirmEmailChangeRequest) error {
+	if m.ConfirmEmailFunc != nil {
+		return m.ConfirmEmailFunc(userID, req)
+	}
+	return nil
+}
+
+func (m *MockService) RequestAccountDeletion(userID int, req *AccountDeletionRequest) error {
+	if m.RequestDeletionFunc != nil {
+		return m.RequestDeletionFunc(userID, req)
+	}
+	return nil
+}
+
+func (m *MockService) PutUserKey(userID int, req *PutKeyRequest) (*UserKey, error) {
+	if m.PutUserKeyFunc != nil {
+		return m.PutUserKeyFunc(userID, req)
+	}
+	return &UserKey{ID: "key-1", UserID: userID, Algorithm: req.Algorithm, PublicKey: req.PublicKey, EncryptedPrivateKey: req.EncryptedPrivateKey}, nil
+}
+
+func (m *MockService) ListUserKeys(userID int) ([]*UserKey, error) {
+	if m.ListUserKeysFunc != nil {
+		return m.ListUserKeysFunc(userID)
+	}
+	return []*UserKey{}, nil
+}
+
+func (m *MockService) GetPublicKey(email string, keyID string) (*UserKey, error) {
+	if m.GetPublicKeyFunc != nil {
+		return m.GetPublicKeyFunc(email, keyID)
+	}
+	return nil, ErrPublicKeyNotFound
+}
+
+func (m *MockService) SetupTOTP(userID int) (*TOTPSetupResponse, error) {
+	return &TOTPSetupResponse{Secret: "SECRET", OtpauthURI: "otpauth://totp/GophKeeper:test@example.com?secret=SECRET"}, nil
+}
+
+func (m *MockService) ConfirmTOTP(userID int, req *TOTPConfirmRequest) ([]string, error) {
+	if m.ConfirmTOTPFunc != nil {
+		return m.ConfirmTOTPFunc(userID, req)
+	}
+	return []string{"abcde-fghjk"}, nil
+}
+
+func (m *MockService) DisableTOTP(userID int, req *TOTPDisableRequest) error {
+	if m.DisableTOTPFunc != nil {
+		return m.DisableTOTPFunc(userID, req)
+	}
+	return nil
+}
+
+func (m *MockService) CompleteLogin2FA(req *Login2FARequest) (*tokens.TokenPair, error) {
+	if m.CompleteLogin2FAFunc != nil {
+		return m.CompleteLogin2FAFunc(req)
+	}
+	return &tokens.TokenPair{
+		AccessToken:  "mock-access-token",
+		RefreshToken: "mock-refresh-token",
+	}, nil
+}
+
+func (m *MockService) BeginWebAuthnRegistration(userID int) (*WebAuthnRegistrationOptions, error) {
+	return &WebAuthnRegistrationOptions{
+		SessionID: "session-1",
+		Options:   &PublicKeyCredentialCreationOptions{Challenge: Base64URL("challenge"), Attestation: "none"},
+	}, nil
+}
+
+func (m *MockService) FinishWebAuthnRegistration(userID int, req *WebAuthnRegisterFinishRequest) (*WebAuthnCredential, error) {
+	if m.FinishWebAuthnRegistrationFunc != nil {
+		return m.FinishWebAuthnRegistrationFunc(userID, req)
+	}
+	return &WebAuthnCredential{ID: "cred-1", UserID: userID, Name: req.Name, CreatedAt: time.Now()}, nil
+}
+
+func (m *MockService) ListWebAuthnCredentials(userID int) ([]*WebAuthnCredential, error) {
+	return []*WebAuthnCredential{{ID: "cred-1", UserID: userID, Name: "Passkey"}}, nil
+}
+
+func (m *MockService) BeginWebAuthnConfirmation(userID int) (*WebAuthnLoginOptions, error) {
+	return &WebAuthnLoginOptions{SessionID: "session-1", Options: &PublicKeyCredentialRequestOptions{}}, nil
+}
+
+func (m *MockService) DeleteWebAuthnCredential(userID int, id string, req *WebAuthnDeleteRequest) error {
+	if m.DeleteWebAuthnCredentialFunc != nil {
+		return m.DeleteWebAuthnCredentialFunc(userID, id, req)
+	}
+	return nil
+}
+
+func (m *MockService) BeginWebAuthnLogin(req *WebAuthnLoginBeginRequest) (*WebAuthnLoginOptions, error) {
+	return &WebAuthnLoginOptions{
+		SessionID: "session-1",
+		Options:   &PublicKeyCredentialRequestOptions{Challenge: Base64URL("challenge"), UserVerification: "required"},
+	}, nil
+}
+
+func (m *MockService) FinishWebAuthnLogin(req *WebAuthnLoginFinishRequest) (*tokens.TokenPair, error) {
+	if m.FinishWebAuthnLoginFunc != nil {
+		return m.FinishWebAuthnLoginFunc(req)
+	}
+	return &tokens.TokenPair{
+		AccessToken:  "mock-access-token",
+		RefreshToken: "mock-refresh-token",
+	}, nil
+}
+
+func (m *MockService) BeginWebAuthnMFA(req *WebAuthnMFABeginRequest) (*WebAuthnLoginOptions, error) {
+	if m.BeginWebAuthnMFAFunc != nil {
+		return m.BeginWebAuthnMFAFunc(req)
+	}
+	return &WebAuthnLoginOptions{SessionID: "session-1", Options: &PublicKeyCredentialRequestOptions{}}, nil
+}
+
+func (m *MockService) FinishWebAuthnMFA(req *WebAuthnMFAFinishRequest) (*tokens.TokenPair, error) {
+	return &tokens.TokenPair{
+		AccessToken:  "mock-access-token",
+		RefreshToken: "mock-refresh-token",
+	}, nil
+}
+
 func TestHandler_Register_Success(t *testing.T) {
 	mockService := &MockService{}
 	handler := NewHandler(mockService, 5*time.Minute)
@@ -86,28 +279,20 @@ func TestHandler_Register_Success(t *testing.T) {
 		t.Errorf("ожидался статус 200, получен %d", w.Code)
 	}
 
-	var response TokenResponse
+	var response map[string]string
 	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
 		t.Fatalf("не удалось декодировать ответ: %v", err)
 	}
 
-	if response.AccessToken == "" {
-		t.Error("AccessToken не должен быть пустым")
+	if response["message"] != "verification_code_sent" {
+		t.Errorf("ожидалось сообщение verification_code_sent, получено %q", response["message"])
 	}
 
-	cookies := w.Result().Cookies()
-	foundRefreshToken := false
-	for _, cookie := range cookies {
+	for _, cookie := range w.Result().Cookies() {
 		if cookie.Name == "refresh_token" {
-			foundRefreshToken = true
-			if cookie.Value == "" {
-				t.Error("refresh_token cookie не должен быть пустым")
-			}
+			t.Error("refresh_token не должен выдаваться до верификации email")
 		}
 	}
-	if !foundRefreshToken {
-		t.Error("refresh_token cookie не найден")
-	}
 }
 
 func TestHandler_Register_InvalidJSON(t *testing.T) {
@@ -127,8 +312,8 @@ func TestHandler_Register_InvalidJSON(t *testing.T) {
 
 func TestHandler_Register_EmailRequired(t *testing.T) {
 	mockService := &MockService{
-		RegisterUserFunc: func(req *RegisterRequest) (*tokens.TokenPair, error) {
-			return nil, ErrEmailRequired
+		RegisterUserFunc: func(req *RegisterRequest) error {
+			return ErrEmailRequired
 		},
 	}
 	handler := NewHandler(mockService, 5*time.Minute)
@@ -152,8 +337,8 @@ func TestHandler_Register_EmailRequired(t *testing.T) {
 
 func TestHandler_Register_UserAlreadyExists(t *testing.T) {
 	mockService := &MockService{
-		RegisterUserFunc: func(req *RegisterRequest) (*tokens.TokenPair, error) {
-			return nil, ErrUserAlreadyExists
+		RegisterUserFunc: func(req *RegisterRequest) error {
+			return ErrUserAlreadyExists
 		},
 	}
 	handler := NewHandler(mockService, 5*time.Minute)
@@ -177,8 +362,8 @@ func TestHandler_Register_UserAlreadyExists(t *testing.T) {
 
 func TestHandler_Register_InternalError(t *testing.T) {
 	mockService := &MockService{
-		RegisterUserFunc: func(req *RegisterRequest) (*tokens.TokenPair, error) {
-			return nil, errors.New("database connection failed")
+		RegisterUserFunc: func(req *RegisterRequest) error {
+			return errors.New("database connection failed")
 		},
 	}
 	handler := NewHandler(mockService, 5*time.Minute)
@@ -247,7 +432,7 @@ func TestHandler_Login_InvalidJSON(t *testing.T) {
 
 func TestHandler_Login_InvalidCredentials(t *testing.T) {
 	mockService := &MockService{
-		LoginUserFunc: func(req *LoginRequest) (*tokens.TokenPair, error) {
+		LoginUserFunc: func(req *LoginRequest) (*LoginResult, error) {
 			return nil, ErrInvalidCredentials
 		},
 	}
@@ -272,7 +457,7 @@ func TestHandler_Login_InvalidCredentials(t *testing.T) {
 
 func TestHandler_Login_EmailRequired(t *testing.T) {
 	mockService := &MockService{
-		LoginUserFunc: func(req *LoginRequest) (*tokens.TokenPair, error) {
+		LoginUserFunc: func(req *LoginRequest) (*LoginResult, error) {
 			return nil, ErrEmailRequired
 		},
 	}
@@ -550,3 +735,529 @@ func TestHandler_LogoutAll_ServiceError(t *testing.T) {
 		t.Errorf("ожидался статус 500, получен %d", w.Code)
 	}
 }
+
+func TestHandler_Keys(t *testing.T) {
+	rotatedAt := time.Now()
+	mockService := &MockService{
+		ListUserKeysFunc: func(userID int) ([]*UserKey, error) {
+			return []*UserKey{
+				{ID: "key-2", UserID: userID, Algorithm: KeyAlgorithmX25519, PublicKey: "pub-2", EncryptedPrivateKey: "priv-2"},
+				{ID: "key-1", UserID: userID, Algorithm: KeyAlgorithmRSAOAEP, PublicKey: "pub-1", EncryptedPrivateKey: "priv-1", RotatedAt: &rotatedAt},
+			}, nil
+		},
+		GetPublicKeyFunc: func(email string, keyID string) (*UserKey, error) {
+			if email == "owner@example.com" && keyID == "key-1" {
+				return &UserKey{ID: "key-1", Email: email, Algorithm: KeyAlgorithmRSAOAEP, PublicKey: "pub-1", EncryptedPrivateKey: "priv-1", RotatedAt: &rotatedAt}, nil
+			}
+			return nil, ErrPublicKeyNotFound
+		},
+	}
+	handler := NewHandler(mockService, 5*time.Minute)
+
+	withUser := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+	}
+
+	t.Run("put", func(t *testing.T) {
+		body, _ := json.Marshal(PutKeyRequest{Algorithm: KeyAlgorithmX25519, PublicKey: "pub", EncryptedPrivateKey: "priv"})
+		w := httptest.NewRecorder()
+		handler.PutKeys(w, withUser(httptest.NewRequest(http.MethodPut, "/api/v1/user/keys", bytes.NewReader(body))))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("ожидался статус 200, получен %d", w.Code)
+		}
+		var response UserKeyResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("не удалось декодировать ответ: %v", err)
+		}
+		if response.KeyID != "key-1" || !response.Current || response.EncryptedPrivateKey != "priv" {
+			t.Errorf("неожиданный ответ: %+v", response)
+		}
+	})
+
+	t.Run("put invalid", func(t *testing.T) {
+		mockService.PutUserKeyFunc = func(userID int, req *PutKeyRequest) (*UserKey, error) {
+			return nil, ErrPublicKeyInvalid
+		}
+		defer func() { mockService.PutUserKeyFunc = nil }()
+
+		w := httptest.NewRecorder()
+		handler.PutKeys(w, withUser(httptest.NewRequest(http.MethodPut, "/api/v1/user/keys", bytes.NewReader([]byte(`{}`)))))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("ожидался статус 400, получен %d", w.Code)
+		}
+	})
+
+	t.Run("put unauthorized", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.PutKeys(w, httptest.NewRequest(http.MethodPut, "/api/v1/user/keys", bytes.NewReader([]byte(`{}`))))
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("ожидался статус 401, получен %d", w.Code)
+		}
+	})
+
+	t.Run("my keys", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.MyKeys(w, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/user/keys/me", nil)))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("ожидался статус 200, получен %d", w.Code)
+		}
+		var response []UserKeyResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("не удалось декодировать ответ: %v", err)
+		}
+		if len(response) != 2 || !response[0].Current || response[1].Current || response[1].RotatedAt == nil {
+			t.Errorf("неожиданный ответ: %+v", response)
+		}
+	})
+
+	t.Run("public key by id", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/owner@example.com/public-key?key_id=key-1", nil)
+		req = mux.SetURLVars(withUser(req), map[string]string{"email": "owner@example.com"})
+		w := httptest.NewRecorder()
+		handler.PublicKey(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("ожидался статус 200, получен %d", w.Code)
+		}
+		body := w.Body.String()
+		if strings.Contains(body, "priv-1") || strings.Contains(body, "encrypted_private_key") {
+			t.Errorf("открытый ключ не должен содержать закрытый: %s", body)
+		}
+	})
+
+	t.Run("public key not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/nobody@example.com/public-key", nil)
+		req = mux.SetURLVars(withUser(req), map[string]string{"email": "nobody@example.com"})
+		w := httptest.NewRecorder()
+		handler.PublicKey(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("ожидался статус 404, получен %d", w.Code)
+		}
+	})
+}
+
+func TestHandler_Login_MFARequired(t *testing.T) {
+	mockService := &MockService{
+		LoginUserFunc: func(req *LoginRequest) (*LoginResult, error) {
+			return &LoginResult{MFAToken: "mfa-token", MFAMethods: []string{MFAMethodTOTP}}, nil
+		},
+	}
+	handler := NewHandler(mockService, 5*time.Minute)
+
+	body, _ := json.Marshal(LoginRequest{Email: "test@example.com", Password: "password123"})
+	w := httptest.NewRecorder()
+	handler.Login(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/login", bytes.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("ожидался статус 200, получен %d", w.Code)
+	}
+	var response MFAChallengeResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("не удалось декодировать ответ: %v", err)
+	}
+	if !response.MFARequired || response.MFAToken != "mfa-token" || len(response.Methods) != 1 {
+		t.Errorf("неожиданный ответ: %+v", response)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "refresh_token" {
+			t.Error("refresh_token не должен выдаваться до второго фактора")
+		}
+	}
+}
+
+func TestHandler_Login2FA(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"invalid token", ErrInvalidMFAToken, http.StatusUnauthorized},
+		{"invalid code", ErrInvalidMFACode, http.StatusBadRequest},
+		{"code required", ErrMFACodeRequired, http.StatusBadRequest},
+		{"too many attempts", ErrMFATooManyAttempts, http.StatusTooManyRequests},
+		{"internal", errors.New("database error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{}
+			if tt.err != nil {
+				mockService.CompleteLogin2FAFunc = func(req *Login2FARequest) (*tokens.TokenPair, error) {
+					return nil, tt.err
+				}
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			body, _ := json.Marshal(Login2FARequest{MFAToken: "mfa-token", Code: "123456"})
+			w := httptest.NewRecorder()
+			handler.Login2FA(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/login/2fa", bytes.NewReader(body)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_TOTP(t *testing.T) {
+	mockService := &MockService{}
+	handler := NewHandler(mockService, 5*time.Minute)
+
+	withUser := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+	}
+
+	w := httptest.NewRecorder()
+	handler.TOTPSetup(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/2fa/totp/setup", nil)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "otpauth://") {
+		t.Errorf("ожидался статус 200 с otpauth_uri, получен %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.TOTPConfirm(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/2fa/totp/confirm", strings.NewReader(`{"code":"123456"}`))))
+	var codes RecoveryCodesResponse
+	if err := json.NewDecoder(w.Body).Decode(&codes); err != nil || w.Code != http.StatusOK || len(codes.RecoveryCodes) != 1 {
+		t.Errorf("ожидались коды восстановления, получен статус %d, %+v, %v", w.Code, codes, err)
+	}
+
+	mockService.ConfirmTOTPFunc = func(userID int, req *TOTPConfirmRequest) ([]string, error) {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	w = httptest.NewRecorder()
+	handler.TOTPConfirm(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/2fa/totp/confirm", strings.NewReader(`{"code":"123456"}`))))
+	if w.Code != http.StatusConflict {
+		t.Errorf("ожидался статус 409, получен %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.TOTPDisable(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/2fa/totp/disable", strings.NewReader(`{"password":"password123","code":"123456"}`))))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("ожидался статус 204, получен %d", w.Code)
+	}
+
+	mockService.DisableTOTPFunc = func(userID int, req *TOTPDisableRequest) error {
+		return ErrInvalidCredentials
+	}
+	w = httptest.NewRecorder()
+	handler.TOTPDisable(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/2fa/totp/disable", strings.NewReader(`{"password":"wrong","code":"123456"}`))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("ожидался статус 400, получен %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.TOTPSetup(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/2fa/totp/setup", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("ожидался статус 401, получен %d", w.Code)
+	}
+}
+
+func TestHandler_WebAuthn(t *testing.T) {
+	mockService := &MockService{}
+	handler := NewHandler(mockService, 5*time.Minute)
+
+	withUser := func(req *http.Request) *http.Request {
+		return req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+	}
+
+	w := httptest.NewRecorder()
+	handler.WebAuthnRegisterBegin(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/webauthn/register/begin", nil)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"challenge":"Y2hhbGxlbmdl"`) {
+		t.Errorf("ожидался статус 200 с challenge в base64url, получен %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.WebAuthnRegisterFinish(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/webauthn/register/finish", strings.NewReader(`{"session_id":"session-1","name":"YubiKey","credential":{}}`))))
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), "YubiKey") {
+		t.Errorf("ожидался статус 201, получен %d: %s", w.Code, w.Body.String())
+	}
+
+	mockService.FinishWebAuthnRegistrationFunc = func(userID int, req *WebAuthnRegisterFinishRequest) (*WebAuthnCredential, error) {
+		return nil, ErrWebAuthnCredentialExists
+	}
+	w = httptest.NewRecorder()
+	handler.WebAuthnRegisterFinish(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/user/webauthn/register/finish", strings.NewReader(`{"session_id":"session-1","credential":{}}`))))
+	if w.Code != http.StatusConflict {
+		t.Errorf("ожидался статус 409, получен %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.WebAuthnCredentials(w, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/user/webauthn/credentials", nil)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "cred-1") {
+		t.Errorf("ожидался список ключей, получен %d: %s", w.Code, w.Body.String())
+	}
+
+	var deletedID string
+	mockService.DeleteWebAuthnCredentialFunc = func(userID int, id string, req *WebAuthnDeleteRequest) error {
+		deletedID = id
+		return nil
+	}
+	req := withUser(httptest.NewRequest(http.MethodDelete, "/api/v1/user/webauthn/credentials/cred-1", strings.NewReader(`{"password":"password123"}`)))
+	req = mux.SetURLVars(req, map[string]string{"id": "cred-1"})
+	w = httptest.NewRecorder()
+	handler.WebAuthnDeleteCredential(w, req)
+	if w.Code != http.StatusNoContent || deletedID != "cred-1" {
+		t.Errorf("ожидался статус 204 для cred-1, получен %d для %q", w.Code, deletedID)
+	}
+
+	w = httptest.NewRecorder()
+	handler.WebAuthnRegisterBegin(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/webauthn/register/begin", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("ожидался статус 401, получен %d", w.Code)
+	}
+}
+
+func TestHandler_WebAuthnLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"verification failed", ErrWebAuthnVerificationFailed, http.StatusBadRequest},
+		{"session expired", ErrWebAuthnSessionNotFound, http.StatusBadRequest},
+		{"email not verified", ErrEmailNotVerified, http.StatusBadRequest},
+		{"internal", errors.New("database error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{}
+			if tt.err != nil {
+				mockService.FinishWebAuthnLoginFunc = func(req *WebAuthnLoginFinishRequest) (*tokens.TokenPair, error) {
+					return nil, tt.err
+				}
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			w := httptest.NewRecorder()
+			handler.WebAuthnLoginFinish(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/login/webauthn/finish", strings.NewReader(`{"session_id":"session-1","credential":{}}`)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+			if tt.err == nil && len(w.Result().Cookies()) == 0 {
+				t.Error("ожидалась cookie с refresh token")
+			}
+		})
+	}
+
+	mockService := &MockService{
+		BeginWebAuthnMFAFunc: func(req *WebAuthnMFABeginRequest) (*WebAuthnLoginOptions, error) {
+			return nil, ErrInvalidMFAToken
+		},
+	}
+	handler := NewHandler(mockService, 5*time.Minute)
+	w := httptest.NewRecorder()
+	handler.WebAuthnMFABegin(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/login/2fa/webauthn/begin", strings.NewReader(`{"mfa_token":"expired"}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("ожидался статус 401, получен %d", w.Code)
+	}
+}
+
+func TestHandler_ForgotPassword(t *testing.T) {
+	var got *ForgotPasswordRequest
+	mockService := &MockService{
+		ForgotPasswordFunc: func(req *ForgotPasswordRequest) error {
+			got = req
+			return nil
+		},
+	}
+	handler := NewHandler(mockService, 5*time.Minute)
+
+	w := httptest.NewRecorder()
+	handler.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/password/forgot", strings.NewReader(`{"email":"test@example.com"}`)))
+	if w.Code != http.StatusOK {
+		t.Errorf("ожидался статус 200, получен %d", w.Code)
+	}
+	if got == nil || got.Email != "test@example.com" {
+		t.Errorf("ожидался запрос для test@example.com, получен %+v", got)
+	}
+
+	mockService.ForgotPasswordFunc = func(req *ForgotPasswordRequest) error { return ErrEmailRequired }
+	w = httptest.NewRecorder()
+	handler.ForgotPassword(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/password/forgot", strings.NewReader(`{}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("ожидался статус 400, получен %d", w.Code)
+	}
+}
+
+func TestHandler_ResetPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusNoContent},
+		{"invalid code", ErrInvalidResetCode, http.StatusBadRequest},
+		{"short password", ErrPasswordTooShort, http.StatusBadRequest},
+		{"internal", errors.New("database error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{
+				ResetPasswordFunc: func(req *ResetPasswordRequest) error { return tt.err },
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			w := httptest.NewRecorder()
+			handler.ResetPassword(w, httptest.NewRequest(http.MethodPost, "/api/v1/user/password/reset", strings.NewReader(`{"email":"test@example.com","code":"123456","password":"newpassword"}`)))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_ChangePassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"wrong current password", ErrInvalidCredentials, http.StatusBadRequest},
+		{"short password", ErrPasswordTooShort, http.StatusBadRequest},
+		{"user deleted", ErrUserNotFound, http.StatusUnauthorized},
+		{"internal", errors.New("database error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{}
+			if tt.err != nil {
+				mockService.ChangePasswordFunc = func(userID int, req *ChangePasswordRequest) (*tokens.TokenPair, error) {
+					return nil, tt.err
+				}
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/user/password", strings.NewReader(`{"current_password":"password123","new_password":"newpassword"}`))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			w := httptest.NewRecorder()
+			handler.ChangePassword(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+			if tt.err == nil && len(w.Result().Cookies()) == 0 {
+				t.Error("ожидалась cookie с новым refresh token")
+			}
+		})
+	}
+
+	handler := NewHandler(&MockService{}, 5*time.Minute)
+	w := httptest.NewRecorder()
+	handler.ChangePassword(w, httptest.NewRequest(http.MethodPut, "/api/v1/user/password", strings.NewReader(`{}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("ожидался статус 401, получен %d", w.Code)
+	}
+}
+
+func TestHandler_ChangeEmail(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"wrong password", ErrInvalidCredentials, http.StatusBadRequest},
+		{"same email", ErrEmailUnchanged, http.StatusBadRequest},
+		{"taken email", ErrUserAlreadyExists, http.StatusConflict},
+		{"internal", errors.New("database error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{
+				ChangeEmailFunc: func(userID int, req *ChangeEmailRequest) error { return tt.err },
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/user/email", strings.NewReader(`{"email":"new@example.com","password":"password123"}`))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			w := httptest.NewRecorder()
+			handler.ChangeEmail(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_ConfirmEmailChange(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusNoContent},
+		{"invalid code", verification.ErrInvalidCode, http.StatusBadRequest},
+		{"expired code", verification.ErrCodeExpired, http.StatusBadRequest},
+		{"taken email", ErrUserAlreadyExists, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockService{
+				ConfirmEmailFunc: func(userID int, req *ConfirmEmailChangeRequest) error { return tt.err },
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/user/email/confirm", strings.NewReader(`{"code":"123456"}`))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			w := httptest.NewRecorder()
+			handler.ConfirmEmailChange(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_RequestAccountDeletion(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"success", nil, http.StatusOK},
+		{"wrong password", ErrInvalidCredentials, http.StatusBadRequest},
+		{"user not found", ErrUserNotFound, http.StatusUnauthorized},
+		{"internal error", errors.New("db down"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID int
+			mockService := &MockService{
+				RequestDeletionFunc: func(userID int, req *AccountDeletionRequest) error {
+					gotUserID = userID
+					return tt.err
+				},
+			}
+			handler := NewHandler(mockService, 5*time.Minute)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/user/delete/code", strings.NewReader(`{"password":"password123"}`))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+			w := httptest.NewRecorder()
+			handler.RequestAccountDeletion(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("ожидался статус %d, получен %d", tt.wantStatus, w.Code)
+			}
+			if gotUserID != 1 {
+				t.Errorf("ожидался пользователь 1, получен %d", gotUserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/utils"
+)
+
+// TOTPSetup godoc
+// @Summary Подключение TOTP
+// @Description Создает секрет для приложения-аутентификатора. Второй фактор включится после подтверждения кодом
+// @Tags auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} TOTPSetupResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 409 {object} map[string]string "Второй фактор уже включен"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/2fa/totp/setup [post]
+func (h *Handler) TOTPSetup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	setup, err := h.service.SetupTOTP(userID)
+	if err != nil {
+		writeMFAError(w, r, userID, err, "[User] Ошибка подключения второго фактора")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(setup); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// TOTPConfirm godoc
+// @Summary Подтверждение TOTP
+// @Description Включает второй фактор по коду из приложения и возвращает одноразовые коды восстановления
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body TOTPConfirmRequest true "Код из приложения"
+// @Success 200 {object} RecoveryCodesResponse
+// @Failure 400 {object} map[string]string "Неверный код"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Подключение не начато"
+// @Failure 409 {object} map[string]string "Второй фактор уже включен"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/2fa/totp/confirm [post]
+func (h *Handler) TOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req TOTPConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(userID, &req)
+	if err != nil {
+		writeMFAError(w, r, userID, err, "[User] Ошибка подтверждения второго фактора")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(RecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// TOTPDisable godoc
+// @Summary Отключение TOTP
+// @Description Отключает второй фактор. Нужны пароль и код из приложения или код восстановления
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Param request body TOTPDisableRequest true "Пароль и код"
+// @Success 204 "Второй фактор отключен"
+// @Failure 400 {object} map[string]string "Неверный пароль или код"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Второй фактор не включен"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/2fa/totp/disable [post]
+func (h *Handler) TOTPDisable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req TOTPDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.DisableTOTP(userID, &req); err != nil {
+		writeMFAError(w, r, userID, err, "[User] Ошибка отключения второго фактора")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Login2FA godoc
+// @Summary Второй шаг входа
+// @Description Обменивает mfa_token из /user/login и код из приложения или код восстановления на access token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body Login2FARequest true "Токен первого шага и код"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} map[string]string "Код не указан или неверен"
+// @Failure 401 {object} map[string]string "Токен первого шага истек или недействителен"
+// @Failure 429 {object} map[string]string "Слишком много неверных кодов"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/login/2fa [post]
+func (h *Handler) Login2FA(w http.ResponseWriter, r *http.Request) {
+	var req Login2FARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	tokenPair, err := h.service.CompleteLogin2FA(&req)
+	if errors.Is(err, ErrInvalidMFAToken) {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, err.Error(), nil)
+		return
+	}
+	// Неверный код - 400: токен первого шага еще действует и код можно ввести снова
+	if err != nil {
+		writeMFAError(w, r, 0, err, "[User] Ошибка входа со вторым фактором")
+		return
+	}
+
+	utils.SetRefreshTokenCookie(w, tokenPair.RefreshToken, h.refreshTokenTTL)
+
+	h.sendTokenResponse(w, tokenPair.AccessToken)
+}
+
+// writeMFAError отвечает на ошибку операций со вторым фактором. Неожиданные ошибки пишутся в лог с logMessage.
+func writeMFAError(w http.ResponseWriter, r *http.Request, userID int, err error, logMessage string) {
+	switch {
+	case errors.Is(err, ErrRequestRequired),
+		errors.Is(err, ErrPasswordRequired),
+		errors.Is(err, ErrInvalidCredentials),
+		errors.Is(err, ErrMFACodeRequired),
+		errors.Is(err, ErrInvalidMFACode):
+		localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, ErrTOTPNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrTOTPAlreadyEnabled):
+		localization.LocalizedError(w, r, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrMFATooManyAttempts):
+		localization.LocalizedError(w, r, http.StatusTooManyRequests, err.Error(), nil)
+	case errors.Is(err, ErrUserNotFound):
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
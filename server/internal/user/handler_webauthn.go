@@ -0,0 +1,333 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Adigezalov/goph-keeper/internal/localization"
+	"github.com/Adigezalov/goph-keeper/internal/logger"
+	"github.com/Adigezalov/goph-keeper/internal/middleware"
+	"github.com/Adigezalov/goph-keeper/internal/utils"
+	"github.com/gorilla/mux"
+)
+
+// WebAuthnRegisterBegin godoc
+// @Summary Начало регистрации ключа WebAuthn
+// @Description Возвращает параметры для navigator.credentials.create и session_id для завершения регистрации
+// @Tags webauthn
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} WebAuthnRegistrationOptions
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/webauthn/register/begin [post]
+func (h *Handler) WebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	options, err := h.service.BeginWebAuthnRegistration(userID)
+	if err != nil {
+		writeWebAuthnError(w, r, userID, err, "[User] Ошибка начала регистрации ключа WebAuthn")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(options); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// WebAuthnRegisterFinish godoc
+// @Summary Завершение регистрации ключа WebAuthn
+// @Description Проверяет ответ аутентификатора и сохраняет ключ. Ключ можно использовать для входа без пароля и как второй фактор
+// @Tags webauthn
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnRegisterFinishRequest true "session_id, название и ответ navigator.credentials.create"
+// @Success 201 {object} WebAuthnCredentialResponse
+// @Failure 400 {object} map[string]string "Ответ аутентификатора не прошел проверку"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 409 {object} map[string]string "Ключ уже зарегистрирован"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/webauthn/register/finish [post]
+func (h *Handler) WebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req WebAuthnRegisterFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	cred, err := h.service.FinishWebAuthnRegistration(userID, &req)
+	if err != nil {
+		writeWebAuthnError(w, r, userID, err, "[User] Ошибка регистрации ключа WebAuthn")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(cred.ToResponse()); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// WebAuthnCredentials godoc
+// @Summary Ключи WebAuthn пользователя
+// @Tags webauthn
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} WebAuthnCredentialResponse
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/webauthn/credentials [get]
+func (h *Handler) WebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	creds, err := h.service.ListWebAuthnCredentials(userID)
+	if err != nil {
+		writeWebAuthnError(w, r, userID, err, "[User] Ошибка получения ключей WebAuthn")
+		return
+	}
+
+	response := make([]*WebAuthnCredentialResponse, 0, len(creds))
+	for _, cred := range creds {
+		response = append(response, cred.ToResponse())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// WebAuthnConfirmBegin godoc
+// @Summary Начало подтверждения действия ключом WebAuthn
+// @Description Возвращает параметры для navigator.credentials.get. Подпись передается вместе с действием, которое нужно подтвердить, например удалением последнего второго фактора
+// @Tags webauthn
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} WebAuthnLoginOptions
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "У пользователя нет ключей WebAuthn"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/webauthn/confirm/begin [post]
+func (h *Handler) WebAuthnConfirmBegin(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	options, err := h.service.BeginWebAuthnConfirmation(userID)
+	if err != nil {
+		writeWebAuthnError(w, r, userID, err, "[User] Ошибка начала подтверждения ключом WebAuthn")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(options); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// WebAuthnDeleteCredential godoc
+// @Summary Удаление ключа WebAuthn
+// @Description Удаляет ключ после проверки пароля. Последний второй фактор (других ключей нет и TOTP не подключен) удаляется только с подписью этого ключа из POST /user/webauthn/confirm/begin
+// @Tags webauthn
+// @Security BearerAuth
+// @Accept json
+// @Param id path string true "ID ключа"
+// @Param request body WebAuthnDeleteRequest true "Пароль и, для последнего второго фактора, подпись ключа"
+// @Success 204 "Ключ удален"
+// @Failure 400 {object} map[string]string "Неверный пароль, нужна или не прошла проверку подпись ключа"
+// @Failure 401 {object} map[string]string "Ошибка авторизации"
+// @Failure 404 {object} map[string]string "Ключ не найден"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/webauthn/credentials/{id} [delete]
+func (h *Handler) WebAuthnDeleteCredential(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+		return
+	}
+
+	var req WebAuthnDeleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	if err := h.service.DeleteWebAuthnCredential(userID, mux.Vars(r)["id"], &req); err != nil {
+		writeWebAuthnError(w, r, userID, err, "[User] Ошибка удаления ключа WebAuthn")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebAuthnLoginBegin godoc
+// @Summary Начало входа по ключу WebAuthn
+// @Description Вход без пароля. С email браузеру передаются ключи этого пользователя, без него браузер предложит сохраненные passkey
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnLoginBeginRequest false "Email (необязательно)"
+// @Success 200 {object} WebAuthnLoginOptions
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/login/webauthn/begin [post]
+func (h *Handler) WebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	var req WebAuthnLoginBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	options, err := h.service.BeginWebAuthnLogin(&req)
+	if err != nil {
+		writeWebAuthnError(w, r, 0, err, "[User] Ошибка начала входа по ключу WebAuthn")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(options); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// WebAuthnLoginFinish godoc
+// @Summary Завершение входа по ключу WebAuthn
+// @Description Проверяет подпись ключа и возвращает access token. Второй фактор не запрашивается: ключ сам проверяет пользователя
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnLoginFinishRequest true "session_id и ответ navigator.credentials.get"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} map[string]string "Подпись не прошла проверку или церемония истекла"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/login/webauthn/finish [post]
+func (h *Handler) WebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	var req WebAuthnLoginFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	tokenPair, err := h.service.FinishWebAuthnLogin(&req)
+	if err != nil {
+		writeWebAuthnError(w, r, 0, err, "[User] Ошибка входа по ключу WebAuthn")
+		return
+	}
+
+	utils.SetRefreshTokenCookie(w, tokenPair.RefreshToken, h.refreshTokenTTL)
+
+	h.sendTokenResponse(w, tokenPair.AccessToken)
+}
+
+// WebAuthnMFABegin godoc
+// @Summary Начало подтверждения входа ключом WebAuthn
+// @Description Второй шаг входа после пароля: возвращает параметры для navigator.credentials.get
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnMFABeginRequest true "Токен первого шага"
+// @Success 200 {object} WebAuthnLoginOptions
+// @Failure 401 {object} map[string]string "Токен первого шага истек или недействителен"
+// @Failure 404 {object} map[string]string "У пользователя нет ключей WebAuthn"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/login/2fa/webauthn/begin [post]
+func (h *Handler) WebAuthnMFABegin(w http.ResponseWriter, r *http.Request) {
+	var req WebAuthnMFABeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	options, err := h.service.BeginWebAuthnMFA(&req)
+	if err != nil {
+		writeWebAuthnError(w, r, 0, err, "[User] Ошибка начала подтверждения входа ключом WebAuthn")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(options); err != nil {
+		logger.Errorf("[User] Ошибка отправки JSON ответа: %v", err)
+	}
+}
+
+// WebAuthnMFAFinish godoc
+// @Summary Завершение входа с ключом WebAuthn как вторым фактором
+// @Tags webauthn
+// @Accept json
+// @Produce json
+// @Param request body WebAuthnMFAFinishRequest true "Токен первого шага, session_id и ответ navigator.credentials.get"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} map[string]string "Подпись не прошла проверку или церемония истекла"
+// @Failure 401 {object} map[string]string "Токен первого шага истек или недействителен"
+// @Failure 500 {object} map[string]string "Внутренняя ошибка сервера"
+// @Router /user/login/2fa/webauthn/finish [post]
+func (h *Handler) WebAuthnMFAFinish(w http.ResponseWriter, r *http.Request) {
+	var req WebAuthnMFAFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localization.LocalizedError(w, r, http.StatusBadRequest, "common.invalid_request_format", nil)
+		return
+	}
+
+	tokenPair, err := h.service.FinishWebAuthnMFA(&req)
+	if err != nil {
+		writeWebAuthnError(w, r, 0, err, "[User] Ошибка входа с ключом WebAuthn")
+		return
+	}
+
+	utils.SetRefreshTokenCookie(w, tokenPair.RefreshToken, h.refreshTokenTTL)
+
+	h.sendTokenResponse(w, tokenPair.AccessToken)
+}
+
+// writeWebAuthnError отвечает на ошибку церемоний WebAuthn. Неожиданные ошибки пишутся в лог с logMessage.
+func writeWebAuthnError(w http.ResponseWriter, r *http.Request, userID int, err error, logMessage string) {
+	switch {
+	case errors.Is(err, ErrRequestRequired),
+		errors.Is(err, ErrPasswordRequired),
+		errors.Is(err, ErrInvalidCredentials),
+		errors.Is(err, ErrEmailNotVerified),
+		errors.Is(err, ErrWebAuthnSessionNotFound),
+		errors.Is(err, ErrWebAuthnVerificationFailed),
+		errors.Is(err, ErrWebAuthnAlgorithmUnsupported),
+		errors.Is(err, ErrWebAuthnCredentialNameTooLong),
+		errors.Is(err, ErrWebAuthnConfirmationRequired):
+		localization.LocalizedError(w, r, http.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, ErrWebAuthnCredentialNotFound):
+		localization.LocalizedError(w, r, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, ErrWebAuthnCredentialExists):
+		localization.LocalizedError(w, r, http.StatusConflict, err.Error(), nil)
+	case errors.Is(err, ErrInvalidMFAToken):
+		localization.LocalizedError(w, r, http.StatusUnauthorized, err.Error(), nil)
+	case errors.Is(err, ErrUserNotFound):
+		localization.LocalizedError(w, r, http.StatusUnauthorized, "common.authorization_error", nil)
+	default:
+		logger.Log.WithFields(map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		}).Error(logMessage)
+		localization.LocalizedError(w, r, http.StatusInternalServerError, "common.internal_error", nil)
+	}
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"time"
+)
+
+// KeyAlgorithm - алгоритм ключевой пары пользователя
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmX25519  KeyAlgorithm = "x25519"
+	KeyAlgorithmRSAOAEP KeyAlgorithm = "rsa-oaep"
+)
+
+const (
+	// MinRSAKeyBits - наименьший допустимый размер ключа RSA-OAEP
+	MinRSAKeyBits = 2048
+	// MaxEncryptedPrivateKeyLength - наибольший размер зашифрованного закрытого ключа (base64)
+	MaxEncryptedPrivateKeyLength = 16384
+)
+
+// ValidatePublicKey проверяет открытый ключ в base64: для x25519 - 32 байта,
+// для rsa-oaep - SubjectPublicKeyInfo (DER) не короче MinRSAKeyBits
+func (a KeyAlgorithm) ValidatePublicKey(publicKey string) error {
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(raw) == 0 {
+		return ErrPublicKeyInvalid
+	}
+
+	switch a {
+	case KeyAlgorithmX25519:
+		if len(raw) != 32 {
+			return ErrPublicKeyInvalid
+		}
+	case KeyAlgorithmRSAOAEP:
+		parsed, err := x509.ParsePKIXPublicKey(raw)
+		if err != nil {
+			return ErrPublicKeyInvalid
+		}
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok || rsaKey.N.BitLen() < MinRSAKeyBits {
+			return ErrPublicKeyInvalid
+		}
+	default:
+		return ErrKeyAlgorithmInvalid
+	}
+
+	return nil
+}
+
+// UserKey - ключевая пара пользователя. Действующий ключ один, у прежних заполнен RotatedAt.
+type UserKey struct {
+	ID        string
+	UserID    int
+	Email     string
+	Algorithm KeyAlgorithm
+	PublicKey string
+	// EncryptedPrivateKey - закрытый ключ, зашифрованный на клиенте. Сервер его не читает.
+	EncryptedPrivateKey string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	RotatedAt           *time.Time
+}
+
+// PutKeyRequest задает действующий ключ пользователя. Тот же открытый ключ заменяет только
+// зашифрованный закрытый (например, после смены пароля), новый - выводит прежний из работы.
+type PutKeyRequest struct {
+	Algorithm           KeyAlgorithm `json:"algorithm"`
+	PublicKey           string       `json:"public_key"`
+	EncryptedPrivateKey string       `json:"encrypted_private_key"`
+}
+
+// PublicKeyResponse - открытый ключ, которым другие пользователи оборачивают ключи секретов
+type PublicKeyResponse struct {
+	KeyID     string       `json:"key_id"`
+	Email     string       `json:"email"`
+	Algorithm KeyAlgorithm `json:"algorithm"`
+	PublicKey string       `json:"public_key"`
+	CreatedAt time.Time    `json:"created_at"`
+	RotatedAt *time.Time   `json:"rotated_at,omitempty"`
+}
+
+// UserKeyResponse - ключевая пара владельца вместе с зашифрованным закрытым ключом
+type UserKeyResponse struct {
+	KeyID               string       `json:"key_id"`
+	Algorithm           KeyAlgorithm `json:"algorithm"`
+	PublicKey           string       `json:"public_key"`
+	EncryptedPrivateKey string       `json:"encrypted_private_key"`
+	Current             bool         `json:"current"`
+	CreatedAt           time.Time    `json:"created_at"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+	RotatedAt           *time.Time   `json:"rotated_at,omitempty"`
+}
+
+func (k *UserKey) ToResponse() UserKeyResponse {
+	return UserKeyResponse{
+		KeyID:               k.ID,
+		Algorithm:           k.Algorithm,
+		PublicKey:           k.PublicKey,
+		EncryptedPrivateKey: k.EncryptedPrivateKey,
+		Current:             k.RotatedAt == nil,
+		CreatedAt:           k.CreatedAt,
+		UpdatedAt:           k.UpdatedAt,
+		RotatedAt:           k.RotatedAt,
+	}
+}
+
+func (k *UserKey) ToPublicResponse() PublicKeyResponse {
+	return PublicKeyResponse{
+		KeyID:     k.ID,
+		Email:     k.Email,
+		Algorithm: k.Algorithm,
+		PublicKey: k.PublicKey,
+		CreatedAt: k.CreatedAt,
+		RotatedAt: k.RotatedAt,
+	}
+}
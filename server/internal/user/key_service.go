@@ -0,0 +1,59 @@
+package user
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// PutUserKey делает ключ из запроса действующим ключом пользователя
+func (s *Service) PutUserKey(userID int, req *PutKeyRequest) (*UserKey, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	algorithm := KeyAlgorithm(strings.ToLower(strings.TrimSpace(string(req.Algorithm))))
+	if err := algorithm.ValidatePublicKey(req.PublicKey); err != nil {
+		return nil, err
+	}
+	if req.EncryptedPrivateKey == "" || len(req.EncryptedPrivateKey) > MaxEncryptedPrivateKeyLength {
+		return nil, ErrEncryptedPrivateKeyInvalid
+	}
+	if _, err := base64.StdEncoding.DecodeString(req.EncryptedPrivateKey); err != nil {
+		return nil, ErrEncryptedPrivateKeyInvalid
+	}
+
+	key := &UserKey{
+		UserID:              userID,
+		Algorithm:           algorithm,
+		PublicKey:           req.PublicKey,
+		EncryptedPrivateKey: req.EncryptedPrivateKey,
+	}
+
+	if err := s.repo.PutUserKey(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ListUserKeys возвращает действующий и прежние ключи пользователя
+func (s *Service) ListUserKeys(userID int) ([]*UserKey, error) {
+	return s.repo.ListUserKeys(userID)
+}
+
+// GetPublicKey возвращает открытый ключ пользователя с адресом email. Пустой keyID - действующий ключ.
+func (s *Service) GetPublicKey(email string, keyID string) (*UserKey, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, ErrEmailRequired
+	}
+	if keyID != "" {
+		if _, err := uuid.Parse(keyID); err != nil {
+			return nil, ErrPublicKeyNotFound
+		}
+	}
+
+	return s.repo.GetPublicKey(email, keyID)
+}
@@ -22,3 +22,14 @@ type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
+
+// ChangeEmailRequest начинает смену email. Адрес изменится после подтверждения кодом,
+// отправленным на новый адрес.
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Code string `json:"code"`
+}
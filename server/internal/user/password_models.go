@@ -0,0 +1,31 @@
+package user
+
+import "time"
+
+// PasswordResetCode - одноразовый код сброса пароля из письма
+type PasswordResetCode struct {
+	ID        int
+	UserID    int
+	Code      string
+	Attempts  int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// ChangePasswordRequest меняет пароль авторизованного пользователя
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// ResetPasswordRequest задает новый пароль по коду из письма
+type ResetPasswordRequest struct {
+	Email    string `json:"email"`
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,205 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/tokens"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinPasswordLength = 6
+	// MaxPasswordResetAttempts - неверных вводов кода сброса, после которых код перестает действовать
+	MaxPasswordResetAttempts = 5
+	// MaxPasswordResetCodes - кодов сброса, которые аккаунт может получить за PasswordResetWindow.
+	// Каждый новый код дает новые попытки, поэтому без лимита код можно было бы подбирать
+	// бесконечно, запрашивая письма заново.
+	MaxPasswordResetCodes = 3
+	PasswordResetWindow   = time.Hour
+)
+
+// ChangePassword меняет пароль по текущему паролю. Все сессии пользователя завершаются,
+// текущая продолжается с возвращенной парой токенов.
+func (s *Service) ChangePassword(userID int, req *ChangePasswordRequest) (*tokens.TokenPair, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	if req.CurrentPassword == "" {
+		return nil, ErrPasswordRequired
+	}
+	if req.NewPassword == "" {
+		return nil, ErrNewPasswordRequired
+	}
+	if len(req.NewPassword) < MinPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, WrapError(err, "не удалось захешировать пароль")
+	}
+	if err := s.repo.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		return nil, err
+	}
+
+	// Неиспользованный код сброса больше не нужен
+	if err := s.repo.DeletePasswordResetCodes(user.ID); err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenService.LogoutAll(user.ID); err != nil {
+		return nil, WrapError(err, "не удалось завершить сессии пользователя")
+	}
+
+	tokenPair, err := s.tokenService.GenerateTokenPair(user.ID, user.Email)
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать токены")
+	}
+
+	return tokenPair, nil
+}
+
+// ForgotPassword отправляет на email одноразовый код сброса пароля. Как и
+// ResendVerificationCode, не раскрывает, существует ли пользователь. Сверх
+// MaxPasswordResetCodes за PasswordResetWindow письма не отправляются.
+func (s *Service) ForgotPassword(req *ForgotPasswordRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Email == "" {
+		return ErrEmailRequired
+	}
+
+	user, err := s.repo.GetUserByEmail(req.Email)
+	if err != nil {
+		// Не раскрываем, существует ли пользователь
+		return nil
+	}
+
+	code, err := generateEmailCode()
+	if err != nil {
+		return WrapError(err, "не удалось сгенерировать код сброса пароля")
+	}
+	resetCode := &PasswordResetCode{
+		UserID:    user.ID,
+		Code:      code,
+		ExpiresAt: time.Now().Add(s.verificationCodeTTL),
+	}
+	// Действует только последний отправленный код
+	created, err := s.repo.ReplacePasswordResetCode(resetCode, PasswordResetWindow, MaxPasswordResetCodes)
+	if err != nil {
+		return err
+	}
+	if !created {
+		// Лимит исчерпан: отвечаем как обычно, чтобы не раскрывать существование аккаунта
+		return nil
+	}
+
+	// Асинхронная отправка через worker
+	s.emailService.SendPasswordResetEmail(user.Email, code)
+
+	return nil
+}
+
+// ResetPassword задает новый пароль по коду из письма и завершает все сессии пользователя.
+// Неизвестный email, неверный, истекший или использованный код дают одну и ту же ошибку.
+func (s *Service) ResetPassword(req *ResetPasswordRequest) error {
+	if err := validateResetPasswordRequest(req); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByEmail(req.Email)
+	if err != nil {
+		return ErrInvalidResetCode
+	}
+
+	resetCode, err := s.repo.GetActivePasswordResetCode(user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Попытка засчитывается до сравнения, иначе параллельные запросы обойдут лимит
+	reserved, err := s.repo.ReservePasswordResetAttempt(resetCode.ID, MaxPasswordResetAttempts)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrInvalidResetCode
+	}
+
+	if subtle.ConstantTimeCompare([]byte(resetCode.Code), []byte(req.Code)) != 1 {
+		return ErrInvalidResetCode
+	}
+
+	used, err := s.repo.UsePasswordResetCode(resetCode.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetCode
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return WrapError(err, "не удалось захешировать пароль")
+	}
+	if err := s.repo.UpdatePassword(user.ID, string(hashedPassword)); err != nil {
+		return err
+	}
+
+	// Код из письма подтверждает владение адресом
+	if !user.EmailVerified {
+		if err := s.repo.VerifyUserEmail(user.ID); err != nil {
+			return err
+		}
+	}
+
+	// Старый пароль мог быть скомпрометирован: отзываем все refresh токены
+	if err := s.tokenService.LogoutAll(user.ID); err != nil {
+		return WrapError(err, "не удалось завершить сессии пользователя")
+	}
+
+	return nil
+}
+
+func validateResetPasswordRequest(req *ResetPasswordRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Email == "" {
+		return ErrEmailRequired
+	}
+	if req.Code == "" {
+		return ErrResetCodeRequired
+	}
+	if req.Password == "" {
+		return ErrPasswordRequired
+	}
+	if len(req.Password) < MinPasswordLength {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// generateEmailCode возвращает шестизначный код для письма из криптографически стойкого
+// источника: код сам по себе подтверждает действие с аккаунтом
+func generateEmailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
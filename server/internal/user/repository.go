@@ -3,6 +3,7 @@ package user
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 )
@@ -12,6 +13,40 @@ type Repository interface {
 	GetUserByEmail(email string) (*User, error)
 	GetUserByID(id int) (*User, error)
 	VerifyUserEmail(userID int) error
+	UpdatePassword(userID int, passwordHash string) error
+	UpdateEmail(userID int, email string) error
+
+	ReplacePasswordResetCode(code *PasswordResetCode, window time.Duration, maxCodes int) (bool, error)
+	GetActivePasswordResetCode(userID int) (*PasswordResetCode, error)
+	ReservePasswordResetAttempt(id int, maxAttempts int) (bool, error)
+	UsePasswordResetCode(id int) (bool, error)
+	DeletePasswordResetCodes(userID int) error
+
+	CreateAccountDeletionCode(code *AccountDeletionCode) error
+	GetActiveAccountDeletionCode(userID int) (*AccountDeletionCode, error)
+	ReserveAccountDeletionAttempt(id int, maxAttempts int) (bool, error)
+	UseAccountDeletionCode(id int) (bool, error)
+	DeleteAccountDeletionCodes(userID int) error
+
+	PutUserKey(key *UserKey) error
+	ListUserKeys(userID int) ([]*UserKey, error)
+	GetPublicKey(email string, keyID string) (*UserKey, error)
+
+	GetTOTP(userID int) (*TOTP, error)
+	SaveTOTPSecret(userID int, encryptedSecret string) error
+	ConfirmTOTP(userID int, step int64, codeHashes []string) error
+	UseTOTPStep(userID int, step int64) (bool, error)
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+	ReserveMFAAttempt(userID int) (bool, error)
+	DeleteTOTP(userID int) error
+
+	CreateWebAuthnSession(session *WebAuthnSession) error
+	ConsumeWebAuthnSession(id string, ceremony string) (*WebAuthnSession, error)
+	CreateWebAuthnCredential(cred *WebAuthnCredential) error
+	ListWebAuthnCredentials(userID int) ([]*WebAuthnCredential, error)
+	GetWebAuthnCredential(credentialID []byte) (*WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(id string, signCount uint32) (bool, error)
+	DeleteWebAuthnCredential(userID int, id string) error
 }
 
 type DatabaseRepository struct {
@@ -82,6 +117,28 @@ func (r *DatabaseRepository) GetUserByID(id int) (*User, error) {
 	return user, nil
 }
 
+// UpdateEmail меняет адрес пользователя. Занятый адрес дает ErrUserAlreadyExists.
+func (r *DatabaseRepository) UpdateEmail(userID int, email string) error {
+	result, err := r.db.Exec(`UPDATE users SET email = $2 WHERE id = $1`, userID, email)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrUserAlreadyExists
+		}
+		return WrapError(err, "не удалось изменить email")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return WrapError(err, "не удалось изменить email")
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
 func (r *DatabaseRepository) VerifyUserEmail(userID int) error {
 	query := `UPDATE users SET email_verified = true WHERE id = $1`
 	_, err := r.db.Exec(query, userID)
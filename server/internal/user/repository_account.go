@@ -0,0 +1,86 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+)
+
+func (r *DatabaseRepository) CreateAccountDeletionCode(code *AccountDeletionCode) error {
+	err := r.db.QueryRow(`
+		INSERT INTO account_deletion_codes (user_id, code, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, code.UserID, code.Code, code.ExpiresAt).Scan(&code.ID, &code.CreatedAt)
+	if err != nil {
+		return WrapError(err, "не удалось сохранить код удаления аккаунта")
+	}
+
+	return nil
+}
+
+// GetActiveAccountDeletionCode возвращает последний неиспользованный и неистекший код пользователя
+func (r *DatabaseRepository) GetActiveAccountDeletionCode(userID int) (*AccountDeletionCode, error) {
+	var code AccountDeletionCode
+
+	err := r.db.QueryRow(`
+		SELECT id, user_id, code, attempts, created_at, expires_at, used
+		FROM account_deletion_codes
+		WHERE user_id = $1 AND used = false AND expires_at > NOW()
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, userID).Scan(&code.ID, &code.UserID, &code.Code, &code.Attempts, &code.CreatedAt, &code.ExpiresAt, &code.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidDeletionCode
+		}
+		return nil, WrapError(err, "не удалось получить код удаления аккаунта")
+	}
+
+	return &code, nil
+}
+
+// ReserveAccountDeletionAttempt засчитывает попытку ввода кода до его проверки одним UPDATE.
+// Возвращает false, если код использован, истек или попытки исчерпаны.
+func (r *DatabaseRepository) ReserveAccountDeletionAttempt(id int, maxAttempts int) (bool, error) {
+	var reservedID int
+	err := r.db.QueryRow(`
+		UPDATE account_deletion_codes
+		SET attempts = attempts + 1
+		WHERE id = $1 AND used = false AND expires_at > NOW() AND attempts < $2
+		RETURNING id
+	`, id, maxAttempts).Scan(&reservedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, WrapError(err, "не удалось учесть попытку удаления аккаунта")
+	}
+	return true, nil
+}
+
+// UseAccountDeletionCode погашает код после верной попытки. Возвращает false, если код уже
+// использован или истек.
+func (r *DatabaseRepository) UseAccountDeletionCode(id int) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE account_deletion_codes
+		SET used = true
+		WHERE id = $1 AND used = false AND expires_at > NOW()
+	`, id)
+	if err != nil {
+		return false, WrapError(err, "не удалось погасить код удаления аккаунта")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, WrapError(err, "не удалось погасить код удаления аккаунта")
+	}
+
+	return rows > 0, nil
+}
+
+func (r *DatabaseRepository) DeleteAccountDeletionCodes(userID int) error {
+	if _, err := r.db.Exec(`DELETE FROM account_deletion_codes WHERE user_id = $1`, userID); err != nil {
+		return WrapError(err, "не удалось удалить коды удаления аккаунта")
+	}
+	return nil
+}
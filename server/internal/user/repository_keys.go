@@ -0,0 +1,150 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const keySelect = `
+		SELECT k.id, k.user_id, u.email, k.algorithm, k.public_key, k.encrypted_private_key,
+		       k.created_at, k.updated_at, k.rotated_at
+		FROM user_keys k
+		JOIN users u ON u.id = k.user_id`
+
+// PutUserKey делает key действующим ключом пользователя key.UserID. Если открытый ключ совпадает
+// с действующим, меняется только зашифрованный закрытый ключ, иначе прежний ключ выводится из работы
+// и остается доступным по своему ID. Заполняет ID и даты.
+func (r *DatabaseRepository) PutUserKey(key *UserKey) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	// Блокировка пользователя упорядочивает одновременную смену ключа
+	err = tx.QueryRow(`SELECT email FROM users WHERE id = $1 FOR UPDATE`, key.UserID).Scan(&key.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return WrapError(err, "не удалось получить пользователя")
+	}
+
+	err = tx.QueryRow(`
+		UPDATE user_keys
+		SET encrypted_private_key = $4
+		WHERE user_id = $1 AND rotated_at IS NULL AND algorithm = $2 AND public_key = $3
+		RETURNING id, created_at, updated_at
+	`, key.UserID, key.Algorithm, key.PublicKey, key.EncryptedPrivateKey).Scan(
+		&key.ID, &key.CreatedAt, &key.UpdatedAt,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return WrapError(err, "не удалось обновить ключ")
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.Exec(`
+			UPDATE user_keys SET rotated_at = NOW()
+			WHERE user_id = $1 AND rotated_at IS NULL
+		`, key.UserID)
+		if err != nil {
+			return WrapError(err, "не удалось вывести из работы прежний ключ")
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO user_keys (user_id, algorithm, public_key, encrypted_private_key)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, created_at, updated_at
+		`, key.UserID, key.Algorithm, key.PublicKey, key.EncryptedPrivateKey).Scan(
+			&key.ID, &key.CreatedAt, &key.UpdatedAt,
+		)
+		if err != nil {
+			return WrapError(err, "не удалось сохранить ключ")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	key.RotatedAt = nil
+	return nil
+}
+
+// ListUserKeys возвращает все ключи пользователя, начиная с действующего
+func (r *DatabaseRepository) ListUserKeys(userID int) ([]*UserKey, error) {
+	rows, err := r.db.Query(keySelect+`
+		WHERE k.user_id = $1
+		ORDER BY k.rotated_at IS NOT NULL, k.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить ключи пользователя")
+	}
+	defer rows.Close()
+
+	keys := []*UserKey{}
+	for rows.Next() {
+		key, err := scanUserKey(rows)
+		if err != nil {
+			return nil, WrapError(err, "не удалось прочитать ключ пользователя")
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, WrapError(err, "ошибка при чтении ключей пользователя")
+	}
+
+	return keys, nil
+}
+
+// GetPublicKey возвращает ключ пользователя с адресом email: действующий, если keyID пуст,
+// иначе ключ с этим ID, в том числе выведенный из работы
+func (r *DatabaseRepository) GetPublicKey(email string, keyID string) (*UserKey, error) {
+	query := keySelect + ` WHERE u.email = $1 AND k.rotated_at IS NULL`
+	args := []interface{}{email}
+	if keyID != "" {
+		query = keySelect + ` WHERE u.email = $1 AND k.id = $2`
+		args = append(args, keyID)
+	}
+
+	key, err := scanUserKey(r.db.QueryRow(query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPublicKeyNotFound
+		}
+		return nil, WrapError(err, "не удалось получить открытый ключ")
+	}
+
+	return key, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUserKey(row rowScanner) (*UserKey, error) {
+	var key UserKey
+	var rotatedAt sql.NullTime
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Email,
+		&key.Algorithm,
+		&key.PublicKey,
+		&key.EncryptedPrivateKey,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+		&rotatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if rotatedAt.Valid {
+		key.RotatedAt = &rotatedAt.Time
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,146 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ReplacePasswordResetCode сохраняет новый код и гасит прежние коды пользователя. Погашенные
+// коды хранятся window, чтобы их можно было посчитать: если за window выдано уже maxCodes кодов,
+// новый не сохраняется и возвращается false. Строка пользователя блокируется, поэтому
+// параллельные запросы не обойдут лимит.
+func (r *DatabaseRepository) ReplacePasswordResetCode(code *PasswordResetCode, window time.Duration, maxCodes int) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.QueryRow(`SELECT id FROM users WHERE id = $1 FOR UPDATE`, code.UserID).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrUserNotFound
+		}
+		return false, WrapError(err, "не удалось заблокировать пользователя")
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM password_reset_codes
+		WHERE user_id = $1 AND created_at < NOW() - make_interval(secs => $2)
+	`, code.UserID, window.Seconds()); err != nil {
+		return false, WrapError(err, "не удалось удалить старые коды сброса пароля")
+	}
+
+	var issued int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM password_reset_codes WHERE user_id = $1`, code.UserID).Scan(&issued); err != nil {
+		return false, WrapError(err, "не удалось посчитать коды сброса пароля")
+	}
+	if issued >= maxCodes {
+		return false, nil
+	}
+
+	if _, err := tx.Exec(`UPDATE password_reset_codes SET used = true WHERE user_id = $1 AND used = false`, code.UserID); err != nil {
+		return false, WrapError(err, "не удалось погасить прежние коды сброса пароля")
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO password_reset_codes (user_id, code, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`, code.UserID, code.Code, code.ExpiresAt).Scan(&code.ID, &code.CreatedAt)
+	if err != nil {
+		return false, WrapError(err, "не удалось сохранить код сброса пароля")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return true, nil
+}
+
+// GetActivePasswordResetCode возвращает последний неиспользованный и неистекший код пользователя
+func (r *DatabaseRepository) GetActivePasswordResetCode(userID int) (*PasswordResetCode, error) {
+	var code PasswordResetCode
+
+	err := r.db.QueryRow(`
+		SELECT id, user_id, code, attempts, created_at, expires_at, used
+		FROM password_reset_codes
+		WHERE user_id = $1 AND used = false AND expires_at > NOW()
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`, userID).Scan(&code.ID, &code.UserID, &code.Code, &code.Attempts, &code.CreatedAt, &code.ExpiresAt, &code.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidResetCode
+		}
+		return nil, WrapError(err, "не удалось получить код сброса пароля")
+	}
+
+	return &code, nil
+}
+
+// ReservePasswordResetAttempt засчитывает попытку ввода кода до его проверки. Проверка лимита
+// и учет попытки - один UPDATE, поэтому параллельные запросы не сравнят больше maxAttempts кодов.
+// Возвращает false, если код использован, истек или попытки исчерпаны.
+func (r *DatabaseRepository) ReservePasswordResetAttempt(id int, maxAttempts int) (bool, error) {
+	var reservedID int
+	err := r.db.QueryRow(`
+		UPDATE password_reset_codes
+		SET attempts = attempts + 1
+		WHERE id = $1 AND used = false AND expires_at > NOW() AND attempts < $2
+		RETURNING id
+	`, id, maxAttempts).Scan(&reservedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, WrapError(err, "не удалось учесть попытку сброса пароля")
+	}
+	return true, nil
+}
+
+// UsePasswordResetCode погашает код после верной попытки. Возвращает false, если код уже
+// использован или истек, в том числе при параллельном сбросе.
+func (r *DatabaseRepository) UsePasswordResetCode(id int) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE password_reset_codes
+		SET used = true
+		WHERE id = $1 AND used = false AND expires_at > NOW()
+	`, id)
+	if err != nil {
+		return false, WrapError(err, "не удалось погасить код сброса пароля")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, WrapError(err, "не удалось погасить код сброса пароля")
+	}
+
+	return rows > 0, nil
+}
+
+func (r *DatabaseRepository) DeletePasswordResetCodes(userID int) error {
+	if _, err := r.db.Exec(`DELETE FROM password_reset_codes WHERE user_id = $1`, userID); err != nil {
+		return WrapError(err, "не удалось удалить коды сброса пароля")
+	}
+	return nil
+}
+
+func (r *DatabaseRepository) UpdatePassword(userID int, passwordHash string) error {
+	result, err := r.db.Exec(`UPDATE users SET password_hash = $2 WHERE id = $1`, userID, passwordHash)
+	if err != nil {
+		return WrapError(err, "не удалось обновить пароль")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return WrapError(err, "не удалось обновить пароль")
+	}
+	if rows == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
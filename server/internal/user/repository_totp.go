@@ -0,0 +1,207 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetTOTP возвращает второй фактор пользователя, в том числе неподтвержденный
+func (r *DatabaseRepository) GetTOTP(userID int) (*TOTP, error) {
+	var totp TOTP
+	var confirmedAt, lastFailedAt sql.NullTime
+
+	err := r.db.QueryRow(`
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step, failed_attempts, last_failed_at
+		FROM user_totp
+		WHERE user_id = $1
+	`, userID).Scan(
+		&totp.UserID, &totp.EncryptedSecret, &confirmedAt, &totp.LastUsedStep, &totp.FailedAttempts, &lastFailedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTOTPNotFound
+		}
+		return nil, WrapError(err, "не удалось получить второй фактор")
+	}
+
+	if confirmedAt.Valid {
+		totp.ConfirmedAt = &confirmedAt.Time
+	}
+	if lastFailedAt.Valid {
+		totp.LastFailedAt = &lastFailedAt.Time
+	}
+
+	return &totp, nil
+}
+
+// SaveTOTPSecret сохраняет секрет неподтвержденного второго фактора, заменяя прежний
+// неподтвержденный. Подключенный второй фактор не меняется.
+func (r *DatabaseRepository) SaveTOTPSecret(userID int, encryptedSecret string) error {
+	var savedID int
+	err := r.db.QueryRow(`
+		INSERT INTO user_totp (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted,
+		    last_used_step = 0,
+		    created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL
+		RETURNING user_id
+	`, userID, encryptedSecret).Scan(&savedID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTOTPAlreadyEnabled
+		}
+		return WrapError(err, "не удалось сохранить секрет второго фактора")
+	}
+
+	return nil
+}
+
+// ConfirmTOTP включает второй фактор, отмечает код интервала step использованным
+// и заменяет коды восстановления хешами codeHashes
+func (r *DatabaseRepository) ConfirmTOTP(userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_totp
+		SET confirmed_at = NOW(), last_used_step = $2, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = $1 AND confirmed_at IS NULL AND last_used_step < $2
+	`, userID, step)
+	if err != nil {
+		return WrapError(err, "не удалось включить второй фактор")
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return WrapError(err, "не удалось включить второй фактор")
+	} else if rows == 0 {
+		return ErrTOTPNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return WrapError(err, "не удалось удалить старые коды восстановления")
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_recovery_codes (user_id, code_hash)
+		SELECT $1, UNNEST($2::text[])
+	`, userID, codeHashes)
+	if err != nil {
+		return WrapError(err, "не удалось сохранить коды восстановления")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return nil
+}
+
+// UseTOTPStep отмечает код интервала step использованным и сбрасывает счетчик неудачных попыток.
+// Возвращает false, если код этого или более позднего интервала уже был использован.
+func (r *DatabaseRepository) UseTOTPStep(userID int, step int64) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE user_totp
+		SET last_used_step = $2, failed_attempts = 0, last_failed_at = NULL
+		WHERE user_id = $1 AND last_used_step < $2
+	`, userID, step)
+	if err != nil {
+		return false, WrapError(err, "не удалось отметить код использованным")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, WrapError(err, "не удалось отметить код использованным")
+	}
+
+	return rows > 0, nil
+}
+
+// UseRecoveryCode погашает код восстановления с хешем codeHash. Возвращает false,
+// если такого неиспользованного кода нет.
+func (r *DatabaseRepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, WrapError(err, "не удалось погасить код восстановления")
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, WrapError(err, "не удалось погасить код восстановления")
+	}
+	if rows == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE user_totp SET failed_attempts = 0, last_failed_at = NULL WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return false, WrapError(err, "не удалось сбросить неудачные попытки")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return true, nil
+}
+
+// ReserveMFAAttempt засчитывает попытку ввода кода до его проверки: верный код затем сбрасывает
+// счетчик. Проверка блокировки и учет попытки - один UPDATE, поэтому параллельные запросы
+// не проверят больше MaxMFAAttempts кодов. Попытки старше MFALockout не учитываются.
+// Возвращает false, если попытки исчерпаны.
+func (r *DatabaseRepository) ReserveMFAAttempt(userID int) (bool, error) {
+	var reservedID int
+	err := r.db.QueryRow(`
+		UPDATE user_totp
+		SET failed_attempts = CASE
+		        WHEN last_failed_at IS NULL OR last_failed_at < NOW() - make_interval(secs => $2) THEN 1
+		        ELSE failed_attempts + 1
+		    END,
+		    last_failed_at = NOW()
+		WHERE user_id = $1
+		  AND (failed_attempts < $3 OR last_failed_at IS NULL OR last_failed_at < NOW() - make_interval(secs => $2))
+		RETURNING user_id
+	`, userID, MFALockout.Seconds(), MaxMFAAttempts).Scan(&reservedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, WrapError(err, "не удалось учесть попытку ввода кода")
+	}
+	return true, nil
+}
+
+// DeleteTOTP отключает второй фактор и удаляет коды восстановления
+func (r *DatabaseRepository) DeleteTOTP(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return WrapError(err, "не удалось начать транзакцию")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return WrapError(err, "не удалось удалить коды восстановления")
+	}
+	if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return WrapError(err, "не удалось отключить второй фактор")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return WrapError(err, "не удалось зафиксировать транзакцию")
+	}
+
+	return nil
+}
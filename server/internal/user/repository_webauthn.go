@@ -0,0 +1,183 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreateWebAuthnSession сохраняет challenge начатой церемонии и заодно удаляет истекшие
+func (r *DatabaseRepository) CreateWebAuthnSession(session *WebAuthnSession) error {
+	if _, err := r.db.Exec(`DELETE FROM webauthn_challenges WHERE expires_at < NOW()`); err != nil {
+		return WrapError(err, "не удалось удалить истекшие церемонии WebAuthn")
+	}
+
+	var userID sql.NullInt64
+	if session.UserID != 0 {
+		userID = sql.NullInt64{Int64: int64(session.UserID), Valid: true}
+	}
+
+	err := r.db.QueryRow(`
+		INSERT INTO webauthn_challenges (user_id, ceremony, challenge, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, userID, session.Ceremony, session.Challenge, session.ExpiresAt).Scan(&session.ID)
+	if err != nil {
+		return WrapError(err, "не удалось сохранить церемонию WebAuthn")
+	}
+
+	return nil
+}
+
+// ConsumeWebAuthnSession забирает действующую церемонию ceremony. Challenge одноразовый:
+// повторный вызов с тем же id вернет ErrWebAuthnSessionNotFound.
+func (r *DatabaseRepository) ConsumeWebAuthnSession(id string, ceremony string) (*WebAuthnSession, error) {
+	var session WebAuthnSession
+	var userID sql.NullInt64
+
+	err := r.db.QueryRow(`
+		DELETE FROM webauthn_challenges
+		WHERE id = $1 AND ceremony = $2
+		RETURNING id, user_id, ceremony, challenge, expires_at
+	`, id, ceremony).Scan(&session.ID, &userID, &session.Ceremony, &session.Challenge, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebAuthnSessionNotFound
+		}
+		return nil, WrapError(err, "не удалось получить церемонию WebAuthn")
+	}
+	session.UserID = int(userID.Int64)
+
+	return &session, nil
+}
+
+func (r *DatabaseRepository) CreateWebAuthnCredential(cred *WebAuthnCredential) error {
+	err := r.db.QueryRow(`
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, algorithm, sign_count, aaguid, transports, name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::text[], $8)
+		RETURNING id, created_at
+	`, cred.UserID, cred.CredentialID, cred.PublicKey, cred.Algorithm, int64(cred.SignCount), cred.AAGUID,
+		cred.Transports, cred.Name,
+	).Scan(&cred.ID, &cred.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrWebAuthnCredentialExists
+		}
+		return WrapError(err, "не удалось сохранить ключ WebAuthn")
+	}
+
+	return nil
+}
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, algorithm, sign_count, aaguid,
+	array_to_string(transports, ','), name, created_at, last_used_at`
+
+// ListWebAuthnCredentials возвращает ключи пользователя в порядке регистрации
+func (r *DatabaseRepository) ListWebAuthnCredentials(userID int) ([]*WebAuthnCredential, error) {
+	rows, err := r.db.Query(`
+		SELECT `+webAuthnCredentialColumns+`
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось получить ключи WebAuthn")
+	}
+	defer rows.Close()
+
+	creds := []*WebAuthnCredential{}
+	for rows.Next() {
+		cred, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, WrapError(err, "не удалось прочитать ключ WebAuthn")
+		}
+		creds = append(creds, cred)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, WrapError(err, "не удалось получить ключи WebAuthn")
+	}
+
+	return creds, nil
+}
+
+// GetWebAuthnCredential ищет ключ по credential id, который прислал аутентификатор
+func (r *DatabaseRepository) GetWebAuthnCredential(credentialID []byte) (*WebAuthnCredential, error) {
+	cred, err := scanWebAuthnCredential(r.db.QueryRow(`
+		SELECT `+webAuthnCredentialColumns+`
+		FROM webauthn_credentials
+		WHERE credential_id = $1
+	`, credentialID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrWebAuthnCredentialNotFound
+		}
+		return nil, WrapError(err, "не удалось получить ключ WebAuthn")
+	}
+
+	return cred, nil
+}
+
+// UpdateWebAuthnSignCount сохраняет счетчик подписей после входа. Возвращает false, если
+// за это время другой вход уже сохранил такой же или больший счетчик.
+func (r *DatabaseRepository) UpdateWebAuthnSignCount(id string, signCount uint32) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE webauthn_credentials
+		SET sign_count = $2, last_used_at = NOW()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))
+	`, id, int64(signCount))
+	if err != nil {
+		return false, WrapError(err, "не удалось обновить счетчик ключа WebAuthn")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, WrapError(err, "не удалось обновить счетчик ключа WebAuthn")
+	}
+
+	return rows > 0, nil
+}
+
+func (r *DatabaseRepository) DeleteWebAuthnCredential(userID int, id string) error {
+	result, err := r.db.Exec(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return WrapError(err, "не удалось удалить ключ WebAuthn")
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return WrapError(err, "не удалось удалить ключ WebAuthn")
+	}
+	if rows == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+func scanWebAuthnCredential(row rowScanner) (*WebAuthnCredential, error) {
+	var cred WebAuthnCredential
+	var signCount int64
+	var transports string
+	var lastUsedAt sql.NullTime
+
+	err := row.Scan(
+		&cred.ID, &cred.UserID, &cred.CredentialID, &cred.PublicKey, &cred.Algorithm, &signCount, &cred.AAGUID,
+		&transports, &cred.Name, &cred.CreatedAt, &lastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cred.SignCount = uint32(signCount)
+	if transports != "" {
+		cred.Transports = strings.Split(transports, ",")
+	}
+	if lastUsedAt.Valid {
+		cred.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &cred, nil
+}
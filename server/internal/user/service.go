@@ -16,11 +16,16 @@ type TokenService interface {
 	RefreshTokenPair(refreshTokenString string, userID int, email string) (*tokens.TokenPair, error)
 	Logout(refreshTokenString string) error
 	LogoutAll(userID int) error
+	GenerateMFAToken(userID int, email string) (string, error)
+	ValidateMFAToken(tokenString string) (*tokens.Claims, error)
 }
 
 type EmailService interface {
 	GenerateVerificationCode() string
 	SendEmail(toEmail, code string)
+	SendPasswordResetEmail(toEmail, code string)
+	SendEmailChangedNotice(oldEmail, newEmail string)
+	SendAccountDeletionEmail(toEmail, code string)
 }
 
 type VerificationRepository interface {
@@ -28,6 +33,9 @@ type VerificationRepository interface {
 	GetActiveVerificationCode(userID int, code string) (*verification.VerificationCode, error)
 	MarkCodeAsUsed(id int) error
 	DeleteUserCodes(userID int) error
+	GetActiveEmailChangeCode(userID int) (*verification.VerificationCode, error)
+	ReserveEmailChangeAttempt(codeID int, maxAttempts int) (bool, error)
+	DeleteEmailChangeCodes(userID int) error
 }
 
 type Service struct {
@@ -36,6 +44,8 @@ type Service struct {
 	emailService        EmailService
 	verificationRepo    VerificationRepository
 	verificationCodeTTL time.Duration
+	totpCipher          *secretCipher
+	webAuthn            *webAuthnRP
 }
 
 func NewService(
@@ -117,7 +127,7 @@ func (s *Service) validateRegisterRequest(req *RegisterRequest) error {
 		return ErrInvalidEmail
 	}
 
-	if len(req.Password) < 6 {
+	if len(req.Password) < MinPasswordLength {
 		return ErrPasswordTooShort
 	}
 
@@ -226,7 +236,9 @@ func (s *Service) ResendVerificationCode(req *verification.ResendCodeRequest) er
 	return nil
 }
 
-func (s *Service) LoginUser(req *LoginRequest) (*tokens.TokenPair, error) {
+// LoginUser проверяет пароль. Если у пользователя включен второй фактор, вместо пары
+// токенов возвращается токен для завершения входа через CompleteLogin2FA или FinishWebAuthnMFA.
+func (s *Service) LoginUser(req *LoginRequest) (*LoginResult, error) {
 	if err := s.validateLoginRequest(req); err != nil {
 		return nil, err
 	}
@@ -244,12 +256,59 @@ func (s *Service) LoginUser(req *LoginRequest) (*tokens.TokenPair, error) {
 		return nil, ErrEmailNotVerified
 	}
 
+	methods, err := s.mfaMethods(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) > 0 {
+		mfaToken, err := s.tokenService.GenerateMFAToken(user.ID, user.Email)
+		if err != nil {
+			return nil, WrapError(err, "не удалось создать токен второго фактора")
+		}
+		return &LoginResult{MFAToken: mfaToken, MFAMethods: methods}, nil
+	}
+
 	tokenPair, err := s.tokenService.GenerateTokenPair(user.ID, user.Email)
 	if err != nil {
 		return nil, WrapError(err, "не удалось создать токены")
 	}
 
-	return tokenPair, nil
+	return &LoginResult{Tokens: tokenPair}, nil
+}
+
+// mfaMethods возвращает вторые факторы, подключенные пользователем
+func (s *Service) mfaMethods(userID int) ([]string, error) {
+	var methods []string
+
+	totp, err := s.repo.GetTOTP(userID)
+	if err != nil && !errors.Is(err, ErrTOTPNotFound) {
+		return nil, err
+	}
+	if totp.Enabled() {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	creds, err := s.repo.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) > 0 {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+// validateMFAToken проверяет токен, выданный LoginUser для второго шага входа
+func (s *Service) validateMFAToken(mfaToken string) (*tokens.Claims, error) {
+	if mfaToken == "" {
+		return nil, ErrInvalidMFAToken
+	}
+	claims, err := s.tokenService.ValidateMFAToken(mfaToken)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
 }
 
 func (s *Service) validateLoginRequest(req *LoginRequest) error {
@@ -1,10 +1,25 @@
 package user
 
 import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Adigezalov/goph-keeper/internal/tokens"
+	"github.com/Adigezalov/goph-keeper/internal/verification"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -12,6 +27,24 @@ type MockRepository struct {
 	GetUserByEmailFunc func(email string) (*User, error)
 	CreateUserFunc     func(user *User) error
 	GetUserByIDFunc    func(id int) (*User, error)
+	UpdateEmailFunc    func(userID int, email string) error
+
+	// keys - реестр ключей в памяти: действующий ключ пользователя последний среди его ключей
+	keys []*UserKey
+	// totp и recoveryCodes - второй фактор в памяти, recoveryCodes[userID][hash] - код погашен
+	totp          map[int]*TOTP
+	recoveryCodes map[int]map[string]bool
+	// webAuthnSessions и webAuthnCreds - церемонии и ключи WebAuthn в памяти
+	webAuthnSessions map[string]*WebAuthnSession
+	webAuthnCreds    []*WebAuthnCredential
+	// resetCodes и passwordHashes - коды сброса и новые хеши паролей в памяти
+	resetCodes     []*PasswordResetCode
+	passwordHashes map[int]string
+	verifiedUsers  []int
+	// emails - новые адреса пользователей после смены email
+	emails map[int]string
+	// deletionCodes - коды удаления аккаунта
+	deletionCodes []*AccountDeletionCode
 }
 
 func (m *MockRepository) GetUserByEmail(email string) (*User, error) {
@@ -36,6 +69,463 @@ func (m *MockRepository) GetUserByID(id int) (*User, error) {
 	return nil, ErrUserNotFound
 }
 
+func (m *MockRepository) VerifyUserEmail(userID int) error {
+	m.verifiedUsers = append(m.verifiedUsers, userID)
+	return nil
+}
+
+func (m *MockRepository) UpdatePassword(userID int, passwordHash string) error {
+	if m.passwordHashes == nil {
+		m.passwordHashes = map[int]string{}
+	}
+	m.passwordHashes[userID] = passwordHash
+	return nil
+}
+
+func (m *MockRepository) UpdateEmail(userID int, email string) error {
+	if m.UpdateEmailFunc != nil {
+		return m.UpdateEmailFunc(userID, email)
+	}
+	if m.emails == nil {
+		m.emails = map[int]string{}
+	}
+	m.emails[userID] = email
+	return nil
+}
+
+func (m *MockRepository) ReplacePasswordResetCode(code *PasswordResetCode, window time.Duration, maxCodes int) (bool, error) {
+	issued := 0
+	for _, c := range m.resetCodes {
+		if c.UserID == code.UserID && c.CreatedAt.After(time.Now().Add(-window)) {
+			issued++
+		}
+	}
+	if issued >= maxCodes {
+		return false, nil
+	}
+	for _, c := range m.resetCodes {
+		if c.UserID == code.UserID {
+			c.Used = true
+		}
+	}
+
+	code.ID = 1
+	if n := len(m.resetCodes); n > 0 {
+		code.ID = m.resetCodes[n-1].ID + 1
+	}
+	code.CreatedAt = time.Now()
+	m.resetCodes = append(m.resetCodes, code)
+	return true, nil
+}
+
+func (m *MockRepository) GetActivePasswordResetCode(userID int) (*PasswordResetCode, error) {
+	for i := len(m.resetCodes) - 1; i >= 0; i-- {
+		code := m.resetCodes[i]
+		if code.UserID == userID && !code.Used && code.ExpiresAt.After(time.Now()) {
+			found := *code
+			return &found, nil
+		}
+	}
+	return nil, ErrInvalidResetCode
+}
+
+func (m *MockRepository) ReservePasswordResetAttempt(id int, maxAttempts int) (bool, error) {
+	for _, code := range m.resetCodes {
+		if code.ID == id && !code.Used && code.ExpiresAt.After(time.Now()) && code.Attempts < maxAttempts {
+			code.Attempts++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockRepository) UsePasswordResetCode(id int) (bool, error) {
+	for _, code := range m.resetCodes {
+		if code.ID == id && !code.Used && code.ExpiresAt.After(time.Now()) {
+			code.Used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockRepository) DeletePasswordResetCodes(userID int) error {
+	codes := m.resetCodes[:0]
+	for _, code := range m.resetCodes {
+		if code.UserID != userID {
+			codes = append(codes, code)
+		}
+	}
+	m.resetCodes = codes
+	return nil
+}
+
+func (m *MockRepository) CreateAccountDeletionCode(code *AccountDeletionCode) error {
+	code.ID = len(m.deletionCodes) + 1
+	code.CreatedAt = time.Now()
+	m.deletionCodes = append(m.deletionCodes, code)
+	return nil
+}
+
+func (m *MockRepository) GetActiveAccountDeletionCode(userID int) (*AccountDeletionCode, error) {
+	for i := len(m.deletionCodes) - 1; i >= 0; i-- {
+		code := m.deletionCodes[i]
+		if code.UserID == userID && !code.Used && code.ExpiresAt.After(time.Now()) {
+			found := *code
+			return &found, nil
+		}
+	}
+	return nil, ErrInvalidDeletionCode
+}
+
+func (m *MockRepository) ReserveAccountDeletionAttempt(id int, maxAttempts int) (bool, error) {
+	for _, code := range m.deletionCodes {
+		if code.ID == id && !code.Used && code.ExpiresAt.After(time.Now()) && code.Attempts < maxAttempts {
+			code.Attempts++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockRepository) UseAccountDeletionCode(id int) (bool, error) {
+	for _, code := range m.deletionCodes {
+		if code.ID == id && !code.Used && code.ExpiresAt.After(time.Now()) {
+			code.Used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockRepository) DeleteAccountDeletionCodes(userID int) error {
+	codes := []*AccountDeletionCode{}
+	for _, code := range m.deletionCodes {
+		if code.UserID != userID {
+			codes = append(codes, code)
+		}
+	}
+	m.deletionCodes = codes
+	return nil
+}
+
+func (m *MockRepository) PutUserKey(key *UserKey) error {
+	now := time.Now()
+	key.Email = fmt.Sprintf("user%d@example.com", key.UserID)
+	for _, existing := range m.keys {
+		if existing.UserID != key.UserID || existing.RotatedAt != nil {
+			continue
+		}
+		if existing.Algorithm == key.Algorithm && existing.PublicKey == key.PublicKey {
+			existing.EncryptedPrivateKey = key.EncryptedPrivateKey
+			existing.UpdatedAt = now
+			*key = *existing
+			return nil
+		}
+		existing.RotatedAt = &now
+	}
+
+	key.ID = uuid.NewString()
+	key.CreatedAt = now
+	key.UpdatedAt = now
+	stored := *key
+	m.keys = append(m.keys, &stored)
+	return nil
+}
+
+func (m *MockRepository) ListUserKeys(userID int) ([]*UserKey, error) {
+	keys := []*UserKey{}
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if m.keys[i].UserID == userID {
+			key := *m.keys[i]
+			keys = append(keys, &key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *MockRepository) GetPublicKey(email string, keyID string) (*UserKey, error) {
+	for _, existing := range m.keys {
+		if existing.Email != email {
+			continue
+		}
+		if (keyID == "" && existing.RotatedAt == nil) || existing.ID == keyID {
+			key := *existing
+			return &key, nil
+		}
+	}
+	return nil, ErrPublicKeyNotFound
+}
+
+func (m *MockRepository) GetTOTP(userID int) (*TOTP, error) {
+	if totp, ok := m.totp[userID]; ok {
+		copied := *totp
+		return &copied, nil
+	}
+	return nil, ErrTOTPNotFound
+}
+
+func (m *MockRepository) SaveTOTPSecret(userID int, encryptedSecret string) error {
+	if m.totp == nil {
+		m.totp = map[int]*TOTP{}
+	}
+	if m.totp[userID].Enabled() {
+		return ErrTOTPAlreadyEnabled
+	}
+	m.totp[userID] = &TOTP{UserID: userID, EncryptedSecret: encryptedSecret}
+	return nil
+}
+
+func (m *MockRepository) ConfirmTOTP(userID int, step int64, codeHashes []string) error {
+	totp, ok := m.totp[userID]
+	if !ok || totp.Enabled() || totp.LastUsedStep >= step {
+		return ErrTOTPNotFound
+	}
+	now := time.Now()
+	totp.ConfirmedAt = &now
+	totp.LastUsedStep = step
+	totp.FailedAttempts = 0
+
+	if m.recoveryCodes == nil {
+		m.recoveryCodes = map[int]map[string]bool{}
+	}
+	m.recoveryCodes[userID] = map[string]bool{}
+	for _, hash := range codeHashes {
+		m.recoveryCodes[userID][hash] = false
+	}
+	return nil
+}
+
+func (m *MockRepository) UseTOTPStep(userID int, step int64) (bool, error) {
+	totp := m.totp[userID]
+	if totp.LastUsedStep >= step {
+		return false, nil
+	}
+	totp.LastUsedStep = step
+	totp.FailedAttempts = 0
+	return true, nil
+}
+
+func (m *MockRepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	m.totp[userID].FailedAttempts = 0
+	return true, nil
+}
+
+func (m *MockRepository) ReserveMFAAttempt(userID int) (bool, error) {
+	totp := m.totp[userID]
+	now := time.Now()
+	if totp.LastFailedAt == nil || now.Sub(*totp.LastFailedAt) >= MFALockout {
+		totp.FailedAttempts = 0
+	}
+	if totp.FailedAttempts >= MaxMFAAttempts {
+		return false, nil
+	}
+	totp.FailedAttempts++
+	totp.LastFailedAt = &now
+	return true, nil
+}
+
+func (m *MockRepository) DeleteTOTP(userID int) error {
+	delete(m.totp, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *MockRepository) CreateWebAuthnSession(session *WebAuthnSession) error {
+	if m.webAuthnSessions == nil {
+		m.webAuthnSessions = map[string]*WebAuthnSession{}
+	}
+	session.ID = uuid.NewString()
+	copied := *session
+	m.webAuthnSessions[session.ID] = &copied
+	return nil
+}
+
+func (m *MockRepository) ConsumeWebAuthnSession(id string, ceremony string) (*WebAuthnSession, error) {
+	session, ok := m.webAuthnSessions[id]
+	if !ok || session.Ceremony != ceremony {
+		return nil, ErrWebAuthnSessionNotFound
+	}
+	delete(m.webAuthnSessions, id)
+	return session, nil
+}
+
+func (m *MockRepository) CreateWebAuthnCredential(cred *WebAuthnCredential) error {
+	for _, existing := range m.webAuthnCreds {
+		if string(existing.CredentialID) == string(cred.CredentialID) {
+			return ErrWebAuthnCredentialExists
+		}
+	}
+	cred.ID = uuid.NewString()
+	cred.CreatedAt = time.Now()
+	copied := *cred
+	m.webAuthnCreds = append(m.webAuthnCreds, &copied)
+	return nil
+}
+
+func (m *MockRepository) ListWebAuthnCredentials(userID int) ([]*WebAuthnCredential, error) {
+	creds := []*WebAuthnCredential{}
+	for _, cred := range m.webAuthnCreds {
+		if cred.UserID == userID {
+			copied := *cred
+			creds = append(creds, &copied)
+		}
+	}
+	return creds, nil
+}
+
+func (m *MockRepository) GetWebAuthnCredential(credentialID []byte) (*WebAuthnCredential, error) {
+	for _, cred := range m.webAuthnCreds {
+		if string(cred.CredentialID) == string(credentialID) {
+			copied := *cred
+			return &copied, nil
+		}
+	}
+	return nil, ErrWebAuthnCredentialNotFound
+}
+
+func (m *MockRepository) UpdateWebAuthnSignCount(id string, signCount uint32) (bool, error) {
+	for _, cred := range m.webAuthnCreds {
+		if cred.ID == id {
+			if cred.SignCount >= signCount && !(cred.SignCount == 0 && signCount == 0) {
+				return false, nil
+			}
+			now := time.Now()
+			cred.SignCount = signCount
+			cred.LastUsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockRepository) DeleteWebAuthnCredential(userID int, id string) error {
+	for i, cred := range m.webAuthnCreds {
+		if cred.ID == id && cred.UserID == userID {
+			m.webAuthnCreds = append(m.webAuthnCreds[:i], m.webAuthnCreds[i+1:]...)
+			return nil
+		}
+	}
+	return ErrWebAuthnCredentialNotFound
+}
+
+type MockEmailService struct {
+	Sent      []string
+	ResetSent []string
+	// Notices - уведомления о смене email в виде "старый -> новый"
+	Notices      []string
+	DeletionSent []string
+}
+
+func (m *MockEmailService) GenerateVerificationCode() string {
+	return "123456"
+}
+
+func (m *MockEmailService) SendEmail(toEmail, code string) {
+	m.Sent = append(m.Sent, toEmail)
+}
+
+func (m *MockEmailService) SendPasswordResetEmail(toEmail, code string) {
+	m.ResetSent = append(m.ResetSent, toEmail)
+}
+
+func (m *MockEmailService) SendEmailChangedNotice(oldEmail, newEmail string) {
+	m.Notices = append(m.Notices, oldEmail+" -> "+newEmail)
+}
+
+func (m *MockEmailService) SendAccountDeletionEmail(toEmail, code string) {
+	m.DeletionSent = append(m.DeletionSent, toEmail)
+}
+
+// MockVerificationRepository хранит коды в памяти
+type MockVerificationRepository struct {
+	codes  []*verification.VerificationCode
+	nextID int
+}
+
+func (m *MockVerificationRepository) CreateVerificationCode(code *verification.VerificationCode) error {
+	m.nextID++
+	code.ID = m.nextID
+	code.CreatedAt = time.Now()
+	m.codes = append(m.codes, code)
+	return nil
+}
+
+func (m *MockVerificationRepository) GetActiveVerificationCode(userID int, code string) (*verification.VerificationCode, error) {
+	for i := len(m.codes) - 1; i >= 0; i-- {
+		vc := m.codes[i]
+		if vc.UserID == userID && vc.Code == code && !vc.Used && vc.NewEmail == "" {
+			return vc, nil
+		}
+	}
+	return nil, verification.ErrCodeNotFound
+}
+
+func (m *MockVerificationRepository) GetActiveEmailChangeCode(userID int) (*verification.VerificationCode, error) {
+	for i := len(m.codes) - 1; i >= 0; i-- {
+		vc := m.codes[i]
+		if vc.UserID == userID && !vc.Used && vc.NewEmail != "" {
+			return vc, nil
+		}
+	}
+	return nil, verification.ErrCodeNotFound
+}
+
+func (m *MockVerificationRepository) ReserveEmailChangeAttempt(codeID int, maxAttempts int) (bool, error) {
+	for _, vc := range m.codes {
+		if vc.ID == codeID && !vc.Used && vc.Attempts < maxAttempts {
+			vc.Attempts++
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockVerificationRepository) MarkCodeAsUsed(id int) error {
+	for _, vc := range m.codes {
+		if vc.ID == id {
+			vc.Used = true
+		}
+	}
+	return nil
+}
+
+func (m *MockVerificationRepository) DeleteUserCodes(userID int) error {
+	m.deleteCodes(func(vc *verification.VerificationCode) bool { return vc.UserID == userID })
+	return nil
+}
+
+func (m *MockVerificationRepository) DeleteEmailChangeCodes(userID int) error {
+	m.deleteCodes(func(vc *verification.VerificationCode) bool { return vc.UserID == userID && vc.NewEmail != "" })
+	return nil
+}
+
+func (m *MockVerificationRepository) deleteCodes(match func(vc *verification.VerificationCode) bool) {
+	codes := []*verification.VerificationCode{}
+	for _, vc := range m.codes {
+		if !match(vc) {
+			codes = append(codes, vc)
+		}
+	}
+	m.codes = codes
+}
+
+func newTestService(repo Repository, tokenService TokenService) *Service {
+	service := NewService(repo, tokenService, &MockEmailService{}, &MockVerificationRepository{}, 15*time.Minute)
+	if err := service.SetTOTPKey("test-totp-key"); err != nil {
+		panic(err)
+	}
+	if err := service.SetWebAuthn(WebAuthnConfig{RPID: testWebAuthnRPID, Origins: []string{testWebAuthnOrigin}}); err != nil {
+		panic(err)
+	}
+	return service
+}
+
 type MockTokenService struct {
 	GenerateTokenPairFunc func(userID int, email string) (*tokens.TokenPair, error)
 	GetRefreshTokenFunc   func(tokenString string) (*tokens.RefreshToken, error)
@@ -92,46 +582,51 @@ func (m *MockTokenService) ValidateAccessToken() (*tokens.Claims, error) {
 	return nil, nil
 }
 
+func (m *MockTokenService) GenerateMFAToken(userID int, email string) (string, error) {
+	return fmt.Sprintf("mfa:%d:%s", userID, email), nil
+}
+
+func (m *MockTokenService) ValidateMFAToken(tokenString string) (*tokens.Claims, error) {
+	var userID int
+	if _, err := fmt.Sscanf(tokenString, "mfa:%d:", &userID); err != nil {
+		return nil, errors.New("invalid mfa token")
+	}
+	return &tokens.Claims{UserID: userID, Type: "mfa"}, nil
+}
+
 func TestService_RegisterUser_Success(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &RegisterRequest{
 		Email:    "test@example.com",
 		Password: "password123",
 	}
 
-	tokenPair, err := service.RegisterUser(req)
+	err := service.RegisterUser(req)
 
 	if err != nil {
 		t.Fatalf("ожидался успех, получена ошибка: %v", err)
 	}
 
-	if tokenPair == nil {
-		t.Fatal("tokenPair не должен быть nil")
-	}
-
-	if tokenPair.AccessToken == "" {
-		t.Error("AccessToken не должен быть пустым")
-	}
-
-	if tokenPair.RefreshToken == "" {
-		t.Error("RefreshToken не должен быть пустым")
+	emailService := service.emailService.(*MockEmailService)
+	if len(emailService.Sent) != 1 || emailService.Sent[0] != req.Email {
+		t.Errorf("ожидалась отправка кода на %s, отправлено: %v", req.Email, emailService.Sent)
 	}
 }
 
 func TestService_RegisterUser_EmailRequired(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &RegisterRequest{
 		Email:    "",
 		Password: "password123",
 	}
 
-	_, err := service.RegisterUser(req)
+	err := service.RegisterUser(req)
 
 	if !errors.Is(err, ErrEmailRequired) {
 		t.Errorf("ожидалась ошибка ErrEmailRequired, получена: %v", err)
@@ -141,14 +636,14 @@ func TestService_RegisterUser_EmailRequired(t *testing.T) {
 func TestService_RegisterUser_PasswordRequired(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &RegisterRequest{
 		Email:    "test@example.com",
 		Password: "",
 	}
 
-	_, err := service.RegisterUser(req)
+	err := service.RegisterUser(req)
 
 	if !errors.Is(err, ErrPasswordRequired) {
 		t.Errorf("ожидалась ошибка ErrPasswordRequired, получена: %v", err)
@@ -158,14 +653,14 @@ func TestService_RegisterUser_PasswordRequired(t *testing.T) {
 func TestService_RegisterUser_InvalidEmail(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &RegisterRequest{
 		Email:    "invalid-email",
 		Password: "password123",
 	}
 
-	_, err := service.RegisterUser(req)
+	err := service.RegisterUser(req)
 
 	if !errors.Is(err, ErrInvalidEmail) {
 		t.Errorf("ожидалась ошибка ErrInvalidEmail, получена: %v", err)
@@ -175,14 +670,14 @@ func TestService_RegisterUser_InvalidEmail(t *testing.T) {
 func TestService_RegisterUser_PasswordTooShort(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &RegisterRequest{
 		Email:    "test@example.com",
 		Password: "123",
 	}
 
-	_, err := service.RegisterUser(req)
+	err := service.RegisterUser(req)
 
 	if !errors.Is(err, ErrPasswordTooShort) {
 		t.Errorf("ожидалась ошибка ErrPasswordTooShort, получена: %v", err)
@@ -199,14 +694,14 @@ func TestService_RegisterUser_UserAlreadyExists(t *testing.T) {
 		},
 	}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &RegisterRequest{
 		Email:    "existing@example.com",
 		Password: "password123",
 	}
 
-	_, err := service.RegisterUser(req)
+	err := service.RegisterUser(req)
 
 	if !errors.Is(err, ErrUserAlreadyExists) {
 		t.Errorf("ожидалась ошибка ErrUserAlreadyExists, получена: %v", err)
@@ -216,9 +711,9 @@ func TestService_RegisterUser_UserAlreadyExists(t *testing.T) {
 func TestService_RegisterUser_NilRequest(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
-	_, err := service.RegisterUser(nil)
+	err := service.RegisterUser(nil)
 
 	if !errors.Is(err, ErrRequestRequired) {
 		t.Errorf("ожидалась ошибка ErrRequestRequired, получена: %v", err)
@@ -232,28 +727,29 @@ func TestService_LoginUser_Success(t *testing.T) {
 	mockRepo := &MockRepository{
 		GetUserByEmailFunc: func(email string) (*User, error) {
 			return &User{
-				ID:           1,
-				Email:        email,
-				PasswordHash: string(hashedPassword),
+				ID:            1,
+				Email:         email,
+				PasswordHash:  string(hashedPassword),
+				EmailVerified: true,
 			}, nil
 		},
 	}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &LoginRequest{
 		Email:    "test@example.com",
 		Password: password,
 	}
 
-	tokenPair, err := service.LoginUser(req)
+	result, err := service.LoginUser(req)
 
 	if err != nil {
 		t.Fatalf("ожидался успех, получена ошибка: %v", err)
 	}
 
-	if tokenPair == nil {
-		t.Fatal("tokenPair не должен быть nil")
+	if result == nil || result.Tokens == nil {
+		t.Fatal("без второго фактора должна выдаваться пара токенов")
 	}
 }
 
@@ -270,7 +766,7 @@ func TestService_LoginUser_InvalidCredentials_WrongPassword(t *testing.T) {
 		},
 	}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &LoginRequest{
 		Email:    "test@example.com",
@@ -291,7 +787,7 @@ func TestService_LoginUser_InvalidCredentials_UserNotFound(t *testing.T) {
 		},
 	}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &LoginRequest{
 		Email:    "nonexistent@example.com",
@@ -308,7 +804,7 @@ func TestService_LoginUser_InvalidCredentials_UserNotFound(t *testing.T) {
 func TestService_LoginUser_EmailRequired(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &LoginRequest{
 		Email:    "",
@@ -325,7 +821,7 @@ func TestService_LoginUser_EmailRequired(t *testing.T) {
 func TestService_LoginUser_PasswordRequired(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	req := &LoginRequest{
 		Email:    "test@example.com",
@@ -342,7 +838,7 @@ func TestService_LoginUser_PasswordRequired(t *testing.T) {
 func TestService_LoginUser_NilRequest(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	_, err := service.LoginUser(nil)
 
@@ -361,7 +857,7 @@ func TestService_RefreshTokens_Success(t *testing.T) {
 		},
 	}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	tokenPair, err := service.RefreshTokens("valid-refresh-token")
 
@@ -377,7 +873,7 @@ func TestService_RefreshTokens_Success(t *testing.T) {
 func TestService_RefreshTokens_MissingToken(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	_, err := service.RefreshTokens("")
 
@@ -393,7 +889,7 @@ func TestService_RefreshTokens_InvalidToken(t *testing.T) {
 			return nil, errors.New("token not found")
 		},
 	}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	_, err := service.RefreshTokens("invalid-token")
 
@@ -409,7 +905,7 @@ func TestService_RefreshTokens_UserNotFound(t *testing.T) {
 		},
 	}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	_, err := service.RefreshTokens("valid-refresh-token")
 
@@ -421,7 +917,7 @@ func TestService_RefreshTokens_UserNotFound(t *testing.T) {
 func TestService_Logout_Success(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	err := service.Logout("valid-refresh-token")
 
@@ -438,7 +934,7 @@ func TestService_Logout_Error(t *testing.T) {
 			return expectedErr
 		},
 	}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	err := service.Logout("some-token")
 
@@ -450,7 +946,7 @@ func TestService_Logout_Error(t *testing.T) {
 func TestService_LogoutAll_Success(t *testing.T) {
 	mockRepo := &MockRepository{}
 	mockTokenService := &MockTokenService{}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	err := service.LogoutAll(1)
 
@@ -467,7 +963,7 @@ func TestService_LogoutAll_Error(t *testing.T) {
 			return expectedErr
 		},
 	}
-	service := NewService(mockRepo, mockTokenService)
+	service := newTestService(mockRepo, mockTokenService)
 
 	err := service.LogoutAll(1)
 
@@ -475,3 +971,1255 @@ func TestService_LogoutAll_Error(t *testing.T) {
 		t.Errorf("ожидалась ошибка %v, получена: %v", expectedErr, err)
 	}
 }
+
+func x25519PublicKey(t *testing.T) string {
+	t.Helper()
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ x25519: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(key.PublicKey().Bytes())
+}
+
+func pkixPublicKey(t *testing.T, public interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("не удалось закодировать открытый ключ: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func TestService_PutUserKey_Validation(t *testing.T) {
+	service := newTestService(&MockRepository{}, &MockTokenService{})
+
+	smallRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ RSA: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ ECDSA: %v", err)
+	}
+	privateKey := base64.StdEncoding.EncodeToString([]byte("encrypted-private-key"))
+
+	tests := []struct {
+		name string
+		req  *PutKeyRequest
+		want error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"unknown algorithm", &PutKeyRequest{Algorithm: "ed25519", PublicKey: x25519PublicKey(t), EncryptedPrivateKey: privateKey}, ErrKeyAlgorithmInvalid},
+		{"not base64", &PutKeyRequest{Algorithm: KeyAlgorithmX25519, PublicKey: "not base64!", EncryptedPrivateKey: privateKey}, ErrPublicKeyInvalid},
+		{"short x25519", &PutKeyRequest{Algorithm: KeyAlgorithmX25519, PublicKey: base64.StdEncoding.EncodeToString(make([]byte, 16)), EncryptedPrivateKey: privateKey}, ErrPublicKeyInvalid},
+		{"small rsa", &PutKeyRequest{Algorithm: KeyAlgorithmRSAOAEP, PublicKey: pkixPublicKey(t, &smallRSA.PublicKey), EncryptedPrivateKey: privateKey}, ErrPublicKeyInvalid},
+		{"not rsa", &PutKeyRequest{Algorithm: KeyAlgorithmRSAOAEP, PublicKey: pkixPublicKey(t, &ecKey.PublicKey), EncryptedPrivateKey: privateKey}, ErrPublicKeyInvalid},
+		{"missing private key", &PutKeyRequest{Algorithm: KeyAlgorithmX25519, PublicKey: x25519PublicKey(t)}, ErrEncryptedPrivateKeyInvalid},
+		{"private key not base64", &PutKeyRequest{Algorithm: KeyAlgorithmX25519, PublicKey: x25519PublicKey(t), EncryptedPrivateKey: "not base64!"}, ErrEncryptedPrivateKeyInvalid},
+		{"private key too long", &PutKeyRequest{Algorithm: KeyAlgorithmX25519, PublicKey: x25519PublicKey(t), EncryptedPrivateKey: strings.Repeat("A", MaxEncryptedPrivateKeyLength+4)}, ErrEncryptedPrivateKeyInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.PutUserKey(1, tt.req)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ожидалась ошибка %v, получена: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestService_PutUserKey_Rotation(t *testing.T) {
+	repo := &MockRepository{}
+	service := newTestService(repo, &MockTokenService{})
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, MinRSAKeyBits)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ RSA: %v", err)
+	}
+	firstPublic := pkixPublicKey(t, &rsaKey.PublicKey)
+
+	first, err := service.PutUserKey(1, &PutKeyRequest{
+		Algorithm:           "RSA-OAEP",
+		PublicKey:           firstPublic,
+		EncryptedPrivateKey: base64.StdEncoding.EncodeToString([]byte("wrapped-1")),
+	})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if first.Algorithm != KeyAlgorithmRSAOAEP {
+		t.Errorf("ожидался алгоритм rsa-oaep, получен %q", first.Algorithm)
+	}
+
+	// Тот же открытый ключ меняет только зашифрованный закрытый
+	rewrapped, err := service.PutUserKey(1, &PutKeyRequest{
+		Algorithm:           KeyAlgorithmRSAOAEP,
+		PublicKey:           firstPublic,
+		EncryptedPrivateKey: base64.StdEncoding.EncodeToString([]byte("wrapped-2")),
+	})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if rewrapped.ID != first.ID {
+		t.Errorf("перешифровка закрытого ключа не должна менять key_id: %s != %s", rewrapped.ID, first.ID)
+	}
+
+	second, err := service.PutUserKey(1, &PutKeyRequest{
+		Algorithm:           KeyAlgorithmX25519,
+		PublicKey:           x25519PublicKey(t),
+		EncryptedPrivateKey: base64.StdEncoding.EncodeToString([]byte("wrapped-3")),
+	})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if second.ID == first.ID {
+		t.Fatal("новый открытый ключ должен получить новый key_id")
+	}
+
+	keys, err := service.ListUserKeys(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if len(keys) != 2 || keys[0].ID != second.ID || keys[0].RotatedAt != nil || keys[1].RotatedAt == nil {
+		t.Fatalf("ожидались действующий новый ключ и выведенный из работы прежний, получено %+v", keys)
+	}
+	if keys[1].EncryptedPrivateKey != base64.StdEncoding.EncodeToString([]byte("wrapped-2")) {
+		t.Errorf("прежний ключ должен хранить последний зашифрованный закрытый ключ")
+	}
+
+	current, err := service.GetPublicKey(" user1@example.com ", "")
+	if err != nil || current.ID != second.ID {
+		t.Errorf("ожидался действующий ключ %s, получено %+v, %v", second.ID, current, err)
+	}
+
+	old, err := service.GetPublicKey("user1@example.com", first.ID)
+	if err != nil || old.PublicKey != firstPublic || old.RotatedAt == nil {
+		t.Errorf("прежний ключ должен находиться по key_id, получено %+v, %v", old, err)
+	}
+}
+
+func TestService_GetPublicKey_NotFound(t *testing.T) {
+	service := newTestService(&MockRepository{}, &MockTokenService{})
+
+	if _, err := service.GetPublicKey("", ""); !errors.Is(err, ErrEmailRequired) {
+		t.Errorf("ожидалась ошибка ErrEmailRequired, получена: %v", err)
+	}
+	if _, err := service.GetPublicKey("user1@example.com", "not-a-uuid"); !errors.Is(err, ErrPublicKeyNotFound) {
+		t.Errorf("ожидалась ошибка ErrPublicKeyNotFound, получена: %v", err)
+	}
+	if _, err := service.GetPublicKey("user1@example.com", ""); !errors.Is(err, ErrPublicKeyNotFound) {
+		t.Errorf("ожидалась ошибка ErrPublicKeyNotFound, получена: %v", err)
+	}
+}
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("код для %d: ожидался %s, получен %s", tt.unix, tt.want, got)
+		}
+	}
+}
+
+// newTOTPUser возвращает сервис и репозиторий с подтвержденным пользователем 1 и его паролем
+func newTOTPUser(t *testing.T) (*Service, *MockRepository, string) {
+	t.Helper()
+	password := "password123"
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	user := &User{ID: 1, Email: "test@example.com", PasswordHash: string(hashedPassword), EmailVerified: true}
+
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) { return user, nil },
+		GetUserByIDFunc:    func(id int) (*User, error) { return user, nil },
+	}
+	return newTestService(repo, &MockTokenService{}), repo, password
+}
+
+// enableTOTP подключает второй фактор и возвращает секрет и коды восстановления
+func enableTOTP(t *testing.T, service *Service) ([]byte, []string) {
+	t.Helper()
+	setup, err := service.SetupTOTP(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(setup.Secret)
+	if err != nil {
+		t.Fatalf("секрет должен быть в base32: %v", err)
+	}
+
+	codes, err := service.ConfirmTOTP(1, &TOTPConfirmRequest{Code: totpCode(secret, totpStep(time.Now())-1)})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	return secret, codes
+}
+
+func TestService_TOTP_Setup(t *testing.T) {
+	service, repo, _ := newTOTPUser(t)
+
+	setup, err := service.SetupTOTP(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if !strings.HasPrefix(setup.OtpauthURI, "otpauth://totp/GophKeeper:test@example.com?") || !strings.Contains(setup.OtpauthURI, "secret="+setup.Secret) {
+		t.Errorf("неожиданная otpauth-ссылка: %s", setup.OtpauthURI)
+	}
+	if strings.Contains(repo.totp[1].EncryptedSecret, setup.Secret) {
+		t.Error("секрет не должен храниться открытым")
+	}
+
+	// До подтверждения вход не требует второго фактора
+	result, err := service.LoginUser(&LoginRequest{Email: "test@example.com", Password: "password123"})
+	if err != nil || result.Tokens == nil {
+		t.Fatalf("ожидалась пара токенов, получено %+v, %v", result, err)
+	}
+
+	if _, err := service.ConfirmTOTP(1, &TOTPConfirmRequest{Code: "wrong-code"}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("ожидалась ошибка ErrInvalidMFACode, получена: %v", err)
+	}
+
+	_, codes := enableTOTP(t, service)
+	if len(codes) != RecoveryCodesCount {
+		t.Errorf("ожидалось %d кодов восстановления, получено %d", RecoveryCodesCount, len(codes))
+	}
+
+	if _, err := service.SetupTOTP(1); !errors.Is(err, ErrTOTPAlreadyEnabled) {
+		t.Errorf("ожидалась ошибка ErrTOTPAlreadyEnabled, получена: %v", err)
+	}
+}
+
+func TestService_TOTP_Login(t *testing.T) {
+	service, _, password := newTOTPUser(t)
+	secret, codes := enableTOTP(t, service)
+
+	result, err := service.LoginUser(&LoginRequest{Email: "test@example.com", Password: password})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if result.Tokens != nil || result.MFAToken == "" || result.MFAMethods[0] != MFAMethodTOTP {
+		t.Fatalf("ожидался токен второго фактора вместо пары токенов, получено %+v", result)
+	}
+
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: "forged", Code: "123456"}); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("ожидалась ошибка ErrInvalidMFAToken, получена: %v", err)
+	}
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken}); !errors.Is(err, ErrMFACodeRequired) {
+		t.Errorf("ожидалась ошибка ErrMFACodeRequired, получена: %v", err)
+	}
+
+	// Код, которым подтверждали подключение, повторно не принимается
+	replayed := totpCode(secret, totpStep(time.Now())-1)
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: replayed}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("повторный код: ожидалась ошибка ErrInvalidMFACode, получена: %v", err)
+	}
+
+	code := totpCode(secret, totpStep(time.Now()))
+	pair, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: code[:3] + " " + code[3:]})
+	if err != nil || pair == nil {
+		t.Fatalf("ожидалась пара токенов, получено %+v, %v", pair, err)
+	}
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: code}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("повторный код: ожидалась ошибка ErrInvalidMFACode, получена: %v", err)
+	}
+
+	// Код восстановления одноразовый и принимается без учета регистра
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: strings.ToUpper(codes[0])}); err != nil {
+		t.Errorf("код восстановления: ожидался успех, получена ошибка: %v", err)
+	}
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: codes[0]}); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("погашенный код восстановления: ожидалась ошибка ErrInvalidMFACode, получена: %v", err)
+	}
+}
+
+func TestService_TOTP_Lockout(t *testing.T) {
+	service, _, password := newTOTPUser(t)
+	secret, _ := enableTOTP(t, service)
+
+	result, err := service.LoginUser(&LoginRequest{Email: "test@example.com", Password: password})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	for i := 0; i < MaxMFAAttempts; i++ {
+		if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: "wrong-code"}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("попытка %d: ожидалась ошибка ErrInvalidMFACode, получена: %v", i+1, err)
+		}
+	}
+
+	code := totpCode(secret, totpStep(time.Now()))
+	if _, err := service.CompleteLogin2FA(&Login2FARequest{MFAToken: result.MFAToken, Code: code}); !errors.Is(err, ErrMFATooManyAttempts) {
+		t.Errorf("ожидалась ошибка ErrMFATooManyAttempts, получена: %v", err)
+	}
+}
+
+func TestService_TOTP_ConfirmLockout(t *testing.T) {
+	service, repo, _ := newTOTPUser(t)
+	setup, err := service.SetupTOTP(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	secret, _ := totpEncoding.DecodeString(setup.Secret)
+
+	for i := 0; i < MaxMFAAttempts; i++ {
+		if _, err := service.ConfirmTOTP(1, &TOTPConfirmRequest{Code: "wrong-code"}); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("попытка %d: ожидалась ошибка ErrInvalidMFACode, получена: %v", i+1, err)
+		}
+	}
+	if repo.totp[1].FailedAttempts != MaxMFAAttempts {
+		t.Errorf("ожидалось %d учтенных попыток, получено %d", MaxMFAAttempts, repo.totp[1].FailedAttempts)
+	}
+
+	code := totpCode(secret, totpStep(time.Now()))
+	if _, err := service.ConfirmTOTP(1, &TOTPConfirmRequest{Code: code}); !errors.Is(err, ErrMFATooManyAttempts) {
+		t.Errorf("ожидалась ошибка ErrMFATooManyAttempts, получена: %v", err)
+	}
+	if repo.totp[1].Enabled() {
+		t.Error("второй фактор не должен включаться после исчерпания попыток")
+	}
+}
+
+func TestService_TOTP_Disable(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+
+	if err := service.DisableTOTP(1, &TOTPDisableRequest{Password: password, Code: "123456"}); !errors.Is(err, ErrTOTPNotFound) {
+		t.Errorf("ожидалась ошибка ErrTOTPNotFound, получена: %v", err)
+	}
+
+	_, codes := enableTOTP(t, service)
+
+	if err := service.DisableTOTP(1, &TOTPDisableRequest{Password: "wrong-password", Code: codes[0]}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ожидалась ошибка ErrInvalidCredentials, получена: %v", err)
+	}
+	if err := service.DisableTOTP(1, &TOTPDisableRequest{Password: password}); !errors.Is(err, ErrMFACodeRequired) {
+		t.Errorf("ожидалась ошибка ErrMFACodeRequired, получена: %v", err)
+	}
+	if err := service.DisableTOTP(1, &TOTPDisableRequest{Password: password, Code: codes[1]}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if _, ok := repo.totp[1]; ok {
+		t.Error("второй фактор должен быть удален")
+	}
+
+	result, err := service.LoginUser(&LoginRequest{Email: "test@example.com", Password: password})
+	if err != nil || result.Tokens == nil {
+		t.Errorf("после отключения вход должен выдавать пару токенов, получено %+v, %v", result, err)
+	}
+}
+
+const (
+	testWebAuthnRPID   = "localhost"
+	testWebAuthnOrigin = "http://localhost:3000"
+)
+
+// cborMap - словарь CBOR с порядком ключей, как его кодирует аутентификатор
+type cborMap []cborEntry
+
+type cborEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func encodeCBOR(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v >= 0 {
+			return cborHead(0, uint64(v))
+		}
+		return cborHead(1, uint64(-1-v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case cborMap:
+		out := cborHead(5, uint64(len(v)))
+		for _, entry := range v {
+			out = append(out, encodeCBOR(entry.key)...)
+			out = append(out, encodeCBOR(entry.value)...)
+		}
+		return out
+	default:
+		panic(fmt.Sprintf("неподдерживаемый тип CBOR: %T", v))
+	}
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	default:
+		return []byte{major<<5 | 26, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+}
+
+// softAuthenticator - программный аутентификатор WebAuthn с ключом ES256
+type softAuthenticator struct {
+	t            *testing.T
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	origin       string
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("не удалось создать ключ: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("не удалось создать credential id: %v", err)
+	}
+	return &softAuthenticator{t: t, key: key, credentialID: credentialID, origin: testWebAuthnOrigin}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	public, err := a.key.PublicKey.Bytes()
+	if err != nil {
+		a.t.Fatalf("не удалось получить открытый ключ: %v", err)
+	}
+	return encodeCBOR(cborMap{
+		{coseKeyKty, coseKtyEC2},
+		{coseKeyAlg, coseAlgES256},
+		{-1, coseCrvP256},
+		{-2, public[1:33]},
+		{-3, public[33:]},
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(testWebAuthnRPID))
+	data := append(rpIDHash[:], flags, byte(a.signCount>>24), byte(a.signCount>>16), byte(a.signCount>>8), byte(a.signCount))
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = append(data, byte(len(a.credentialID)>>8), byte(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) clientData(ceremonyType string, challenge []byte) []byte {
+	data, _ := json.Marshal(collectedClientData{
+		Type:      ceremonyType,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.origin,
+	})
+	return data
+}
+
+// create отвечает на navigator.credentials.create
+func (a *softAuthenticator) create(options *PublicKeyCredentialCreationOptions) AttestationCredential {
+	a.userHandle = options.User.ID
+
+	var cred AttestationCredential
+	cred.ID = base64.RawURLEncoding.EncodeToString(a.credentialID)
+	cred.RawID = a.credentialID
+	cred.Type = "public-key"
+	cred.Response.ClientDataJSON = a.clientData("webauthn.create", options.Challenge)
+	cred.Response.AttestationObject = encodeCBOR(cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", a.authData(authDataFlagUP|authDataFlagUV|authDataFlagAT, true)},
+	})
+	cred.Response.Transports = []string{"internal"}
+	return cred
+}
+
+// get отвечает на navigator.credentials.get. verified - проверил ли аутентификатор пользователя.
+func (a *softAuthenticator) get(options *PublicKeyCredentialRequestOptions, verified bool) AssertionCredential {
+	a.signCount++
+	flags := byte(authDataFlagUP)
+	if verified {
+		flags |= authDataFlagUV
+	}
+
+	var cred AssertionCredential
+	cred.ID = base64.RawURLEncoding.EncodeToString(a.credentialID)
+	cred.RawID = a.credentialID
+	cred.Type = "public-key"
+	cred.Response.ClientDataJSON = a.clientData("webauthn.get", options.Challenge)
+	cred.Response.AuthenticatorData = a.authData(flags, false)
+	cred.Response.UserHandle = a.userHandle
+
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), cred.Response.AuthenticatorData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatalf("не удалось подписать: %v", err)
+	}
+	cred.Response.Signature = signature
+	return cred
+}
+
+// registerWebAuthn регистрирует ключ программного аутентификатора для пользователя 1
+func registerWebAuthn(t *testing.T, service *Service, authenticator *softAuthenticator) *WebAuthnCredential {
+	t.Helper()
+	options, err := service.BeginWebAuthnRegistration(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	cred, err := service.FinishWebAuthnRegistration(1, &WebAuthnRegisterFinishRequest{
+		SessionID:  options.SessionID,
+		Credential: authenticator.create(options.Options),
+	})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	return cred
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data := encodeCBOR(cborMap{{"fmt", "none"}, {1, -7}, {-2, []byte{1, 2, 3}}, {"big", 70000}})
+	value, n, err := decodeCBOR(append(data, 0xff))
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if n != len(data) {
+		t.Errorf("ожидалось прочитать %d байт, прочитано %d", len(data), n)
+	}
+	m := value.(map[interface{}]interface{})
+	if m["fmt"] != "none" || m[int64(1)] != int64(-7) || string(m[int64(-2)].([]byte)) != "\x01\x02\x03" || m["big"] != int64(70000) {
+		t.Errorf("неожиданный результат: %#v", m)
+	}
+
+	for _, broken := range [][]byte{data[:len(data)-1], {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, {0x5f}, {0xa2, 0x01, 0x01, 0x01, 0x02}} {
+		if _, _, err := decodeCBOR(broken); err == nil {
+			t.Errorf("ожидалась ошибка для % x", broken)
+		}
+	}
+}
+
+func TestService_WebAuthn_Register(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	authenticator := newSoftAuthenticator(t)
+
+	options, err := service.BeginWebAuthnRegistration(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if options.Options.RP.ID != testWebAuthnRPID || len(options.Options.Challenge) != webAuthnChallengeSize {
+		t.Errorf("неожиданные параметры регистрации: %+v", options.Options)
+	}
+
+	// Ответ на другой challenge не принимается, а церемония после попытки закрывается
+	attestation := authenticator.create(&PublicKeyCredentialCreationOptions{Challenge: []byte("other"), User: options.Options.User})
+	if _, err := service.FinishWebAuthnRegistration(1, &WebAuthnRegisterFinishRequest{SessionID: options.SessionID, Credential: attestation}); !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Errorf("чужой challenge: ожидалась ошибка ErrWebAuthnVerificationFailed, получена: %v", err)
+	}
+	attestation = authenticator.create(options.Options)
+	if _, err := service.FinishWebAuthnRegistration(1, &WebAuthnRegisterFinishRequest{SessionID: options.SessionID, Credential: attestation}); !errors.Is(err, ErrWebAuthnSessionNotFound) {
+		t.Errorf("повтор церемонии: ожидалась ошибка ErrWebAuthnSessionNotFound, получена: %v", err)
+	}
+
+	options, _ = service.BeginWebAuthnRegistration(1)
+	if _, err := service.FinishWebAuthnRegistration(1, &WebAuthnRegisterFinishRequest{SessionID: options.SessionID, Name: strings.Repeat("к", MaxWebAuthnCredentialNameLength+1)}); !errors.Is(err, ErrWebAuthnCredentialNameTooLong) {
+		t.Errorf("ожидалась ошибка ErrWebAuthnCredentialNameTooLong, получена: %v", err)
+	}
+
+	cred := registerWebAuthn(t, service, authenticator)
+	if cred.Name != DefaultWebAuthnCredentialName || cred.Algorithm != coseAlgES256 || cred.Transports[0] != "internal" {
+		t.Errorf("неожиданный ключ: %+v", cred)
+	}
+
+	options, _ = service.BeginWebAuthnRegistration(1)
+	if len(options.Options.ExcludeCredentials) != 1 || string(options.Options.ExcludeCredentials[0].ID) != string(authenticator.credentialID) {
+		t.Errorf("зарегистрированный ключ должен попасть в excludeCredentials: %+v", options.Options.ExcludeCredentials)
+	}
+	if _, err := service.FinishWebAuthnRegistration(1, &WebAuthnRegisterFinishRequest{SessionID: options.SessionID, Credential: authenticator.create(options.Options)}); !errors.Is(err, ErrWebAuthnCredentialExists) {
+		t.Errorf("ожидалась ошибка ErrWebAuthnCredentialExists, получена: %v", err)
+	}
+
+	if err := service.DeleteWebAuthnCredential(1, cred.ID, &WebAuthnDeleteRequest{Password: "wrong"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ожидалась ошибка ErrInvalidCredentials, получена: %v", err)
+	}
+
+	// Последний второй фактор одним паролем не удаляется
+	if err := service.DeleteWebAuthnCredential(1, cred.ID, &WebAuthnDeleteRequest{Password: password}); !errors.Is(err, ErrWebAuthnConfirmationRequired) {
+		t.Errorf("ожидалась ошибка ErrWebAuthnConfirmationRequired, получена: %v", err)
+	}
+	confirm, err := service.BeginWebAuthnConfirmation(1)
+	if err != nil || len(confirm.Options.AllowCredentials) != 1 {
+		t.Fatalf("ожидались параметры подтверждения с ключом пользователя, получено %+v, %v", confirm, err)
+	}
+	assertion := authenticator.get(confirm.Options, false)
+	if err := service.DeleteWebAuthnCredential(1, cred.ID, &WebAuthnDeleteRequest{Password: password, SessionID: confirm.SessionID, Credential: &assertion}); err != nil {
+		t.Errorf("ожидался успех, получена ошибка: %v", err)
+	}
+	if len(repo.webAuthnCreds) != 0 {
+		t.Errorf("ключ должен быть удален, осталось %d", len(repo.webAuthnCreds))
+	}
+}
+
+func TestService_WebAuthn_DeleteWithOtherFactor(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	cred := registerWebAuthn(t, service, newSoftAuthenticator(t))
+
+	// Подпись из церемонии входа не подтверждает удаление
+	login, _ := service.BeginWebAuthnLogin(&WebAuthnLoginBeginRequest{Email: "test@example.com"})
+	assertion := AssertionCredential{}
+	if err := service.DeleteWebAuthnCredential(1, cred.ID, &WebAuthnDeleteRequest{Password: password, SessionID: login.SessionID, Credential: &assertion}); !errors.Is(err, ErrWebAuthnSessionNotFound) {
+		t.Errorf("ожидалась ошибка ErrWebAuthnSessionNotFound, получена: %v", err)
+	}
+
+	// С подключенным TOTP второй фактор остается, достаточно пароля
+	enableTOTP(t, service)
+	if err := service.DeleteWebAuthnCredential(1, cred.ID, &WebAuthnDeleteRequest{Password: password}); err != nil {
+		t.Errorf("ожидался успех, получена ошибка: %v", err)
+	}
+	if len(repo.webAuthnCreds) != 0 {
+		t.Errorf("ключ должен быть удален, осталось %d", len(repo.webAuthnCreds))
+	}
+}
+
+func TestService_WebAuthn_PasswordlessLogin(t *testing.T) {
+	service, _, _ := newTOTPUser(t)
+	authenticator := newSoftAuthenticator(t)
+	registerWebAuthn(t, service, authenticator)
+
+	// Неизвестный email не отличается от известного: параметры выдаются в любом случае
+	options, err := service.BeginWebAuthnLogin(&WebAuthnLoginBeginRequest{Email: "test@example.com"})
+	if err != nil || len(options.Options.AllowCredentials) != 1 || options.Options.UserVerification != "required" {
+		t.Fatalf("ожидались параметры входа с ключом пользователя, получено %+v, %v", options, err)
+	}
+
+	// Без проверки пользователя (PIN, биометрия) ключ не заменяет пароль
+	if _, err := service.FinishWebAuthnLogin(&WebAuthnLoginFinishRequest{SessionID: options.SessionID, Credential: authenticator.get(options.Options, false)}); !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Errorf("без UV: ожидалась ошибка ErrWebAuthnVerificationFailed, получена: %v", err)
+	}
+
+	// Discoverable-вход без email
+	options, err = service.BeginWebAuthnLogin(&WebAuthnLoginBeginRequest{})
+	if err != nil || len(options.Options.AllowCredentials) != 0 {
+		t.Fatalf("ожидались параметры без allowCredentials, получено %+v, %v", options, err)
+	}
+	assertion := authenticator.get(options.Options, true)
+	pair, err := service.FinishWebAuthnLogin(&WebAuthnLoginFinishRequest{SessionID: options.SessionID, Credential: assertion})
+	if err != nil || pair == nil {
+		t.Fatalf("ожидалась пара токенов, получено %+v, %v", pair, err)
+	}
+	if _, err := service.FinishWebAuthnLogin(&WebAuthnLoginFinishRequest{SessionID: options.SessionID, Credential: assertion}); !errors.Is(err, ErrWebAuthnSessionNotFound) {
+		t.Errorf("повтор подписи: ожидалась ошибка ErrWebAuthnSessionNotFound, получена: %v", err)
+	}
+
+	// Подпись со страницы другого сайта
+	authenticator.origin = "https://evil.example.com"
+	options, _ = service.BeginWebAuthnLogin(&WebAuthnLoginBeginRequest{})
+	if _, err := service.FinishWebAuthnLogin(&WebAuthnLoginFinishRequest{SessionID: options.SessionID, Credential: authenticator.get(options.Options, true)}); !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Errorf("чужой origin: ожидалась ошибка ErrWebAuthnVerificationFailed, получена: %v", err)
+	}
+	authenticator.origin = testWebAuthnOrigin
+
+	// Копия ключа со старым счетчиком подписей
+	authenticator.signCount = 0
+	options, _ = service.BeginWebAuthnLogin(&WebAuthnLoginBeginRequest{})
+	if _, err := service.FinishWebAuthnLogin(&WebAuthnLoginFinishRequest{SessionID: options.SessionID, Credential: authenticator.get(options.Options, true)}); !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Errorf("старый счетчик: ожидалась ошибка ErrWebAuthnVerificationFailed, получена: %v", err)
+	}
+
+	// Подпись чужим ключом с тем же credential id
+	forged := newSoftAuthenticator(t)
+	forged.credentialID = authenticator.credentialID
+	forged.signCount = 100
+	options, _ = service.BeginWebAuthnLogin(&WebAuthnLoginBeginRequest{})
+	if _, err := service.FinishWebAuthnLogin(&WebAuthnLoginFinishRequest{SessionID: options.SessionID, Credential: forged.get(options.Options, true)}); !errors.Is(err, ErrWebAuthnVerificationFailed) {
+		t.Errorf("чужой ключ: ожидалась ошибка ErrWebAuthnVerificationFailed, получена: %v", err)
+	}
+}
+
+func TestService_WebAuthn_SecondFactor(t *testing.T) {
+	service, _, password := newTOTPUser(t)
+	authenticator := newSoftAuthenticator(t)
+	registerWebAuthn(t, service, authenticator)
+
+	result, err := service.LoginUser(&LoginRequest{Email: "test@example.com", Password: password})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if result.Tokens != nil || len(result.MFAMethods) != 1 || result.MFAMethods[0] != MFAMethodWebAuthn {
+		t.Fatalf("ожидался второй шаг с webauthn, получено %+v", result)
+	}
+
+	if _, err := service.BeginWebAuthnMFA(&WebAuthnMFABeginRequest{MFAToken: "forged"}); !errors.Is(err, ErrInvalidMFAToken) {
+		t.Errorf("ожидалась ошибка ErrInvalidMFAToken, получена: %v", err)
+	}
+
+	options, err := service.BeginWebAuthnMFA(&WebAuthnMFABeginRequest{MFAToken: result.MFAToken})
+	if err != nil || len(options.Options.AllowCredentials) != 1 {
+		t.Fatalf("ожидались параметры с ключом пользователя, получено %+v, %v", options, err)
+	}
+
+	// Церемония привязана к пользователю из mfa_token
+	otherToken, _ := (&MockTokenService{}).GenerateMFAToken(2, "other@example.com")
+	if _, err := service.FinishWebAuthnMFA(&WebAuthnMFAFinishRequest{MFAToken: otherToken, SessionID: options.SessionID, Credential: authenticator.get(options.Options, false)}); !errors.Is(err, ErrWebAuthnSessionNotFound) {
+		t.Errorf("чужой mfa_token: ожидалась ошибка ErrWebAuthnSessionNotFound, получена: %v", err)
+	}
+
+	// Для второго фактора после пароля достаточно касания ключа
+	options, _ = service.BeginWebAuthnMFA(&WebAuthnMFABeginRequest{MFAToken: result.MFAToken})
+	pair, err := service.FinishWebAuthnMFA(&WebAuthnMFAFinishRequest{MFAToken: result.MFAToken, SessionID: options.SessionID, Credential: authenticator.get(options.Options, false)})
+	if err != nil || pair == nil {
+		t.Fatalf("ожидалась пара токенов, получено %+v, %v", pair, err)
+	}
+
+	// Вместе с TOTP доступны оба способа
+	enableTOTP(t, service)
+	result, _ = service.LoginUser(&LoginRequest{Email: "test@example.com", Password: password})
+	if strings.Join(result.MFAMethods, ",") != "totp,webauthn" {
+		t.Errorf("ожидались методы totp и webauthn, получено %v", result.MFAMethods)
+	}
+}
+
+func TestService_ForgotPassword(t *testing.T) {
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) {
+			if email == "test@example.com" {
+				return &User{ID: 1, Email: email, EmailVerified: true}, nil
+			}
+			return nil, ErrUserNotFound
+		},
+	}
+	emailService := &MockEmailService{}
+	service := NewService(repo, &MockTokenService{}, emailService, &MockVerificationRepository{}, 15*time.Minute)
+
+	if err := service.ForgotPassword(nil); !errors.Is(err, ErrRequestRequired) {
+		t.Errorf("ожидалась ошибка ErrRequestRequired, получена: %v", err)
+	}
+	if err := service.ForgotPassword(&ForgotPasswordRequest{}); !errors.Is(err, ErrEmailRequired) {
+		t.Errorf("ожидалась ошибка ErrEmailRequired, получена: %v", err)
+	}
+
+	// Неизвестный email не раскрывается
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: "unknown@example.com"}); err != nil {
+		t.Errorf("ожидался успех для неизвестного email, получена ошибка: %v", err)
+	}
+	if len(emailService.ResetSent) != 0 {
+		t.Errorf("письмо не должно отправляться на неизвестный email, отправлено: %v", emailService.ResetSent)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := service.ForgotPassword(&ForgotPasswordRequest{Email: "test@example.com"}); err != nil {
+			t.Fatalf("ожидался успех, получена ошибка: %v", err)
+		}
+	}
+	if len(emailService.ResetSent) != 2 || emailService.ResetSent[0] != "test@example.com" {
+		t.Errorf("ожидалось два письма на test@example.com, отправлено: %v", emailService.ResetSent)
+	}
+	if len(emailService.Sent) != 0 {
+		t.Errorf("код подтверждения email не должен отправляться, отправлено: %v", emailService.Sent)
+	}
+	// Повторный запрос гасит прежний код
+	active, err := repo.GetActivePasswordResetCode(1)
+	if err != nil || active.ID != repo.resetCodes[1].ID || !repo.resetCodes[0].Used {
+		t.Errorf("ожидался один действующий код, получен: %v, %v", active, err)
+	}
+	if _, err := strconv.Atoi(active.Code); err != nil || len(active.Code) != 6 {
+		t.Errorf("ожидался шестизначный код, получен %q", active.Code)
+	}
+}
+
+func TestService_ForgotPassword_Limit(t *testing.T) {
+	user := &User{ID: 1, Email: "test@example.com"}
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) { return user, nil },
+	}
+	emailService := &MockEmailService{}
+	service := NewService(repo, &MockTokenService{}, emailService, &MockVerificationRepository{}, 15*time.Minute)
+
+	for i := 0; i < MaxPasswordResetCodes+1; i++ {
+		if err := service.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+			t.Fatalf("ожидался успех, получена ошибка: %v", err)
+		}
+	}
+	if len(emailService.ResetSent) != MaxPasswordResetCodes {
+		t.Errorf("сверх лимита письма не должны отправляться, отправлено %d", len(emailService.ResetSent))
+	}
+
+	// Новые попытки не выдаются: действует последний код из лимита
+	active, err := repo.GetActivePasswordResetCode(user.ID)
+	if err != nil || active.ID != MaxPasswordResetCodes {
+		t.Errorf("ожидался код %d, получен: %v, %v", MaxPasswordResetCodes, active, err)
+	}
+
+	// Коды старше окна не учитываются
+	for _, code := range repo.resetCodes {
+		code.CreatedAt = code.CreatedAt.Add(-PasswordResetWindow)
+	}
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if len(emailService.ResetSent) != MaxPasswordResetCodes+1 {
+		t.Errorf("после окна код должен отправляться, отправлено %d", len(emailService.ResetSent))
+	}
+}
+
+func TestService_ResetPassword(t *testing.T) {
+	user := &User{ID: 1, Email: "test@example.com", EmailVerified: true}
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) {
+			if email == user.Email {
+				return user, nil
+			}
+			return nil, ErrUserNotFound
+		},
+	}
+	loggedOut := 0
+	tokenService := &MockTokenService{
+		LogoutAllFunc: func(userID int) error {
+			loggedOut = userID
+			return nil
+		},
+	}
+	service := NewService(repo, tokenService, &MockEmailService{}, &MockVerificationRepository{}, 15*time.Minute)
+
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	validationTests := []struct {
+		name string
+		req  *ResetPasswordRequest
+		want error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"no email", &ResetPasswordRequest{Code: "123456", Password: "newpassword"}, ErrEmailRequired},
+		{"no code", &ResetPasswordRequest{Email: user.Email, Password: "newpassword"}, ErrResetCodeRequired},
+		{"no password", &ResetPasswordRequest{Email: user.Email, Code: "123456"}, ErrPasswordRequired},
+		{"short password", &ResetPasswordRequest{Email: user.Email, Code: "123456", Password: "short"}, ErrPasswordTooShort},
+		{"unknown email", &ResetPasswordRequest{Email: "unknown@example.com", Code: "123456", Password: "newpassword"}, ErrInvalidResetCode},
+		{"wrong code", &ResetPasswordRequest{Email: user.Email, Code: "000000", Password: "newpassword"}, ErrInvalidResetCode},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.ResetPassword(tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("ожидалась ошибка %v, получена: %v", tt.want, err)
+			}
+		})
+	}
+	if loggedOut != 0 || len(repo.passwordHashes) != 0 {
+		t.Fatal("пароль не должен меняться при неверном запросе")
+	}
+
+	req := &ResetPasswordRequest{Email: user.Email, Code: repo.resetCodes[0].Code, Password: "newpassword"}
+	if err := service.ResetPassword(req); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(repo.passwordHashes[1]), []byte("newpassword")); err != nil {
+		t.Errorf("ожидался bcrypt хеш нового пароля: %v", err)
+	}
+	if loggedOut != 1 {
+		t.Errorf("ожидался отзыв всех refresh токенов пользователя 1, получен %d", loggedOut)
+	}
+
+	// Код одноразовый
+	if err := service.ResetPassword(req); !errors.Is(err, ErrInvalidResetCode) {
+		t.Errorf("ожидалась ошибка ErrInvalidResetCode при повторном использовании, получена: %v", err)
+	}
+}
+
+func TestService_ResetPassword_AttemptsLimit(t *testing.T) {
+	user := &User{ID: 1, Email: "test@example.com"}
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) { return user, nil },
+	}
+	service := NewService(repo, &MockTokenService{}, &MockEmailService{}, &MockVerificationRepository{}, 15*time.Minute)
+
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	for i := 0; i < MaxPasswordResetAttempts; i++ {
+		err := service.ResetPassword(&ResetPasswordRequest{Email: user.Email, Code: "000000", Password: "newpassword"})
+		if !errors.Is(err, ErrInvalidResetCode) {
+			t.Fatalf("ожидалась ошибка ErrInvalidResetCode, получена: %v", err)
+		}
+	}
+
+	// После исчерпания попыток не подходит и верный код
+	err := service.ResetPassword(&ResetPasswordRequest{Email: user.Email, Code: repo.resetCodes[0].Code, Password: "newpassword"})
+	if !errors.Is(err, ErrInvalidResetCode) {
+		t.Errorf("ожидалась ошибка ErrInvalidResetCode, получена: %v", err)
+	}
+	if len(repo.passwordHashes) != 0 {
+		t.Error("пароль не должен меняться после исчерпания попыток")
+	}
+}
+
+func TestService_ResetPassword_LastAttempt(t *testing.T) {
+	user := &User{ID: 1, Email: "test@example.com"}
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) { return user, nil },
+	}
+	service := NewService(repo, &MockTokenService{}, &MockEmailService{}, &MockVerificationRepository{}, 15*time.Minute)
+
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	for i := 0; i < MaxPasswordResetAttempts-1; i++ {
+		err := service.ResetPassword(&ResetPasswordRequest{Email: user.Email, Code: "000000", Password: "newpassword"})
+		if !errors.Is(err, ErrInvalidResetCode) {
+			t.Fatalf("ожидалась ошибка ErrInvalidResetCode, получена: %v", err)
+		}
+	}
+
+	// Последняя попытка засчитывается до сравнения, но верный код в ней принимается
+	if err := service.ResetPassword(&ResetPasswordRequest{Email: user.Email, Code: repo.resetCodes[0].Code, Password: "newpassword"}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if repo.resetCodes[0].Attempts != MaxPasswordResetAttempts || !repo.resetCodes[0].Used {
+		t.Errorf("ожидался погашенный код с %d попытками, получено %+v", MaxPasswordResetAttempts, repo.resetCodes[0])
+	}
+}
+
+func TestService_ResetPassword_VerifiesEmail(t *testing.T) {
+	user := &User{ID: 1, Email: "test@example.com", EmailVerified: false}
+	repo := &MockRepository{
+		GetUserByEmailFunc: func(email string) (*User, error) { return user, nil },
+	}
+	service := NewService(repo, &MockTokenService{}, &MockEmailService{}, &MockVerificationRepository{}, 15*time.Minute)
+
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: user.Email}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if err := service.ResetPassword(&ResetPasswordRequest{Email: user.Email, Code: repo.resetCodes[0].Code, Password: "newpassword"}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if len(repo.verifiedUsers) != 1 || repo.verifiedUsers[0] != 1 {
+		t.Errorf("код из письма должен подтверждать email, подтверждены: %v", repo.verifiedUsers)
+	}
+}
+
+func TestService_ChangePassword(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	loggedOut := 0
+	service.tokenService = &MockTokenService{
+		LogoutAllFunc: func(userID int) error {
+			loggedOut = userID
+			return nil
+		},
+	}
+	if err := service.ForgotPassword(&ForgotPasswordRequest{Email: "test@example.com"}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	validationTests := []struct {
+		name string
+		req  *ChangePasswordRequest
+		want error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"no current password", &ChangePasswordRequest{NewPassword: "newpassword"}, ErrPasswordRequired},
+		{"no new password", &ChangePasswordRequest{CurrentPassword: password}, ErrNewPasswordRequired},
+		{"short password", &ChangePasswordRequest{CurrentPassword: password, NewPassword: "short"}, ErrPasswordTooShort},
+		{"wrong current password", &ChangePasswordRequest{CurrentPassword: "wrong-password", NewPassword: "newpassword"}, ErrInvalidCredentials},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.ChangePassword(1, tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("ожидалась ошибка %v, получена: %v", tt.want, err)
+			}
+		})
+	}
+	if loggedOut != 0 || len(repo.passwordHashes) != 0 {
+		t.Fatal("пароль не должен меняться при неверном запросе")
+	}
+
+	tokenPair, err := service.ChangePassword(1, &ChangePasswordRequest{CurrentPassword: password, NewPassword: "newpassword"})
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if tokenPair == nil || tokenPair.RefreshToken == "" {
+		t.Error("текущая сессия должна получить новую пару токенов")
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(repo.passwordHashes[1]), []byte("newpassword")); err != nil {
+		t.Errorf("ожидался bcrypt хеш нового пароля: %v", err)
+	}
+	if loggedOut != 1 {
+		t.Errorf("ожидался отзыв refresh токенов пользователя 1, получен %d", loggedOut)
+	}
+	if len(repo.resetCodes) != 0 {
+		t.Error("неиспользованный код сброса пароля должен удаляться при смене пароля")
+	}
+}
+
+func TestService_ChangeEmail(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	emailService := &MockEmailService{}
+	verificationRepo := &MockVerificationRepository{}
+	service.emailService = emailService
+	service.verificationRepo = verificationRepo
+	repo.GetUserByEmailFunc = func(email string) (*User, error) {
+		if email == "taken@example.com" {
+			return &User{ID: 2, Email: email}, nil
+		}
+		return nil, ErrUserNotFound
+	}
+
+	validationTests := []struct {
+		name string
+		req  *ChangeEmailRequest
+		want error
+	}{
+		{"nil request", nil, ErrRequestRequired},
+		{"no email", &ChangeEmailRequest{Password: password}, ErrEmailRequired},
+		{"no password", &ChangeEmailRequest{Email: "new@example.com"}, ErrPasswordRequired},
+		{"invalid email", &ChangeEmailRequest{Email: "not-an-email", Password: password}, ErrInvalidEmail},
+		{"wrong password", &ChangeEmailRequest{Email: "new@example.com", Password: "wrong-password"}, ErrInvalidCredentials},
+		{"same email", &ChangeEmailRequest{Email: "test@example.com", Password: password}, ErrEmailUnchanged},
+		{"taken email", &ChangeEmailRequest{Email: "taken@example.com", Password: password}, ErrUserAlreadyExists},
+	}
+	for _, tt := range validationTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.ChangeEmail(1, tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("ожидалась ошибка %v, получена: %v", tt.want, err)
+			}
+		})
+	}
+
+	if err := service.ChangeEmail(1, &ChangeEmailRequest{Email: "new@example.com", Password: password}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if len(emailService.Sent) != 1 || emailService.Sent[0] != "new@example.com" {
+		t.Errorf("код должен отправляться на новый адрес, отправлено: %v", emailService.Sent)
+	}
+	if len(repo.emails) != 0 {
+		t.Fatal("email не должен меняться до подтверждения")
+	}
+	code := verificationRepo.codes[0].Code
+
+	// Код смены email не подтверждает регистрацию
+	if _, err := verificationRepo.GetActiveVerificationCode(1, code); !errors.Is(err, verification.ErrCodeNotFound) {
+		t.Errorf("ожидалась ошибка ErrCodeNotFound, получена: %v", err)
+	}
+
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{}); !errors.Is(err, verification.ErrCodeRequired) {
+		t.Errorf("ожидалась ошибка ErrCodeRequired, получена: %v", err)
+	}
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: "000000"}); !errors.Is(err, verification.ErrInvalidCode) {
+		t.Errorf("ожидалась ошибка ErrInvalidCode, получена: %v", err)
+	}
+	if err := service.ConfirmEmailChange(2, &ConfirmEmailChangeRequest{Code: code}); !errors.Is(err, verification.ErrInvalidCode) {
+		t.Errorf("код другого пользователя не должен подходить, получена: %v", err)
+	}
+
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: code}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if repo.emails[1] != "new@example.com" {
+		t.Errorf("ожидался email new@example.com, получен %q", repo.emails[1])
+	}
+	if len(emailService.Notices) != 1 || emailService.Notices[0] != "test@example.com -> new@example.com" {
+		t.Errorf("прежний адрес должен получить уведомление, отправлено: %v", emailService.Notices)
+	}
+
+	// Код одноразовый
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: code}); !errors.Is(err, verification.ErrInvalidCode) {
+		t.Errorf("ожидалась ошибка ErrInvalidCode при повторном использовании, получена: %v", err)
+	}
+}
+
+func TestService_ConfirmEmailChange_Expired(t *testing.T) {
+	service, repo, _ := newTOTPUser(t)
+	verificationRepo := &MockVerificationRepository{}
+	service.verificationRepo = verificationRepo
+	verificationRepo.CreateVerificationCode(&verification.VerificationCode{
+		UserID:    1,
+		Code:      "123456",
+		ExpiresAt: time.Now().Add(-time.Minute),
+		NewEmail:  "new@example.com",
+	})
+
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: "123456"}); !errors.Is(err, verification.ErrCodeExpired) {
+		t.Errorf("ожидалась ошибка ErrCodeExpired, получена: %v", err)
+	}
+	if len(repo.emails) != 0 {
+		t.Error("email не должен меняться по истекшему коду")
+	}
+}
+
+func TestService_ConfirmEmailChange_AttemptsLimit(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	verificationRepo := &MockVerificationRepository{}
+	service.verificationRepo = verificationRepo
+	repo.GetUserByEmailFunc = func(email string) (*User, error) { return nil, ErrUserNotFound }
+
+	if err := service.ChangeEmail(1, &ChangeEmailRequest{Email: "new@example.com", Password: password}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	code := verificationRepo.codes[0].Code
+
+	for i := 0; i < MaxEmailChangeAttempts; i++ {
+		if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: "000000"}); !errors.Is(err, verification.ErrInvalidCode) {
+			t.Fatalf("ожидалась ошибка ErrInvalidCode, получена: %v", err)
+		}
+	}
+
+	// После исчерпания попыток не подходит и верный код
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: code}); !errors.Is(err, verification.ErrInvalidCode) {
+		t.Errorf("ожидалась ошибка ErrInvalidCode, получена: %v", err)
+	}
+	if len(repo.emails) != 0 {
+		t.Error("email не должен меняться после исчерпания попыток")
+	}
+}
+
+func TestService_ConfirmEmailChange_UpdateFails(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	verificationRepo := &MockVerificationRepository{}
+	service.verificationRepo = verificationRepo
+	repo.GetUserByEmailFunc = func(email string) (*User, error) { return nil, ErrUserNotFound }
+
+	if err := service.ChangeEmail(1, &ChangeEmailRequest{Email: "new@example.com", Password: password}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	code := verificationRepo.codes[0].Code
+
+	repo.UpdateEmailFunc = func(userID int, email string) error { return ErrUserAlreadyExists }
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: code}); !errors.Is(err, ErrUserAlreadyExists) {
+		t.Fatalf("ожидалась ошибка ErrUserAlreadyExists, получена: %v", err)
+	}
+
+	// Код не погашен: после освобождения адреса его можно ввести снова
+	repo.UpdateEmailFunc = nil
+	if err := service.ConfirmEmailChange(1, &ConfirmEmailChangeRequest{Code: code}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	if repo.emails[1] != "new@example.com" {
+		t.Errorf("ожидался email new@example.com, получен %q", repo.emails[1])
+	}
+}
+
+func TestService_RequestAccountDeletion(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	emailService := &MockEmailService{}
+	service.emailService = emailService
+
+	if err := service.RequestAccountDeletion(1, &AccountDeletionRequest{}); !errors.Is(err, ErrPasswordRequired) {
+		t.Errorf("ожидалась ошибка ErrPasswordRequired, получена: %v", err)
+	}
+	if err := service.RequestAccountDeletion(1, &AccountDeletionRequest{Password: "wrong"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("ожидалась ошибка ErrInvalidCredentials, получена: %v", err)
+	}
+	if len(emailService.DeletionSent) != 0 {
+		t.Error("без верного пароля код не должен отправляться")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := service.RequestAccountDeletion(1, &AccountDeletionRequest{Password: password}); err != nil {
+			t.Fatalf("ожидался успех, получена ошибка: %v", err)
+		}
+	}
+
+	if len(repo.deletionCodes) != 1 {
+		t.Errorf("ожидался один действующий код, получено %d", len(repo.deletionCodes))
+	}
+	if len(emailService.DeletionSent) != 2 || emailService.DeletionSent[0] != "test@example.com" {
+		t.Errorf("код должен уйти на адрес пользователя, отправлено: %v", emailService.DeletionSent)
+	}
+}
+
+func TestService_ConfirmAccountDeletion(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	if err := service.RequestAccountDeletion(1, &AccountDeletionRequest{Password: password}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	code := repo.deletionCodes[0].Code
+
+	tests := []struct {
+		name    string
+		req     *DeleteAccountRequest
+		wantErr error
+	}{
+		{"без кода", &DeleteAccountRequest{Password: password}, ErrDeletionCodeRequired},
+		{"неверный пароль", &DeleteAccountRequest{Password: "wrong", Code: code}, ErrInvalidCredentials},
+		{"неверный код", &DeleteAccountRequest{Password: password, Code: "000000"}, ErrInvalidDeletionCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.ConfirmAccountDeletion(1, tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ожидалась ошибка %v, получена: %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if err := service.ConfirmAccountDeletion(1, &DeleteAccountRequest{Password: password, Code: code}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	// Код одноразовый
+	if err := service.ConfirmAccountDeletion(1, &DeleteAccountRequest{Password: password, Code: code}); !errors.Is(err, ErrInvalidDeletionCode) {
+		t.Errorf("ожидалась ошибка ErrInvalidDeletionCode при повторном использовании, получена: %v", err)
+	}
+}
+
+func TestService_ConfirmAccountDeletion_AttemptsLimit(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	if err := service.RequestAccountDeletion(1, &AccountDeletionRequest{Password: password}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	code := repo.deletionCodes[0].Code
+
+	for i := 0; i < MaxAccountDeletionAttempts; i++ {
+		service.ConfirmAccountDeletion(1, &DeleteAccountRequest{Password: password, Code: "000000"})
+	}
+
+	if err := service.ConfirmAccountDeletion(1, &DeleteAccountRequest{Password: password, Code: code}); !errors.Is(err, ErrInvalidDeletionCode) {
+		t.Errorf("после исчерпания попыток код не должен действовать, получено: %v", err)
+	}
+}
+
+func TestService_ConfirmAccountDeletion_LastAttempt(t *testing.T) {
+	service, repo, password := newTOTPUser(t)
+	if err := service.RequestAccountDeletion(1, &AccountDeletionRequest{Password: password}); err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+	code := repo.deletionCodes[0].Code
+
+	for i := 0; i < MaxAccountDeletionAttempts-1; i++ {
+		service.ConfirmAccountDeletion(1, &DeleteAccountRequest{Password: password, Code: "000000"})
+	}
+
+	if err := service.ConfirmAccountDeletion(1, &DeleteAccountRequest{Password: password, Code: code}); err != nil {
+		t.Fatalf("верный код в последней попытке должен действовать, получена ошибка: %v", err)
+	}
+	if repo.deletionCodes[0].Attempts != MaxAccountDeletionAttempts {
+		t.Errorf("ожидалось %d попыток, получено %d", MaxAccountDeletionAttempts, repo.deletionCodes[0].Attempts)
+	}
+}
+
+func TestService_GetAccountProfile(t *testing.T) {
+	service, _, _ := newTOTPUser(t)
+	enableTOTP(t, service)
+
+	profile, err := service.GetAccountProfile(1)
+	if err != nil {
+		t.Fatalf("ожидался успех, получена ошибка: %v", err)
+	}
+
+	if profile.Email != "test@example.com" || !profile.EmailVerified {
+		t.Errorf("неверный профиль: %+v", profile)
+	}
+	if !profile.TOTPEnabled {
+		t.Error("второй фактор должен быть отмечен подключенным")
+	}
+	if profile.Keys == nil || profile.WebAuthnCredentials == nil {
+		t.Error("пустые списки должны выгружаться как [], а не null")
+	}
+}
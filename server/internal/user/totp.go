@@ -0,0 +1,197 @@
+package user
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP по RFC 6238, которые понимают распространенные приложения-аутентификаторы
+const (
+	TOTPIssuer     = "GophKeeper"
+	TOTPDigits     = 6
+	TOTPPeriod     = 30 * time.Second
+	totpSecretSize = 20
+	// totpSkew - сколько соседних интервалов принимается из-за расхождения часов
+	totpSkew = 1
+)
+
+// Коды восстановления и ограничение перебора кодов
+const (
+	RecoveryCodesCount = 10
+	recoveryCodeLength = 10
+	MaxMFAAttempts     = 5
+	MFALockout         = 5 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// totpURI возвращает otpauth-ссылку для QR-кода приложения-аутентификатора
+func totpURI(email string, secret []byte) string {
+	params := url.Values{}
+	params.Set("secret", totpEncoding.EncodeToString(secret))
+	params.Set("issuer", TOTPIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+
+	return (&url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + TOTPIssuer + ":" + email,
+		RawQuery: params.Encode(),
+	}).String()
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// totpCode вычисляет код интервала step (HOTP по RFC 4226)
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod)
+}
+
+// matchTOTP ищет интервал рядом с now, код которого совпадает с code. Интервалы не позже
+// afterStep не принимаются, чтобы один код нельзя было использовать дважды.
+func matchTOTP(secret []byte, code string, now time.Time, afterStep int64) (int64, bool) {
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= afterStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// isTOTPCode отличает код аутентификатора от кода восстановления
+func isTOTPCode(code string) bool {
+	if len(code) != TOTPDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// generateRecoveryCodes возвращает коды восстановления вида xxxxx-xxxxx и их хеши
+func generateRecoveryCodes() ([]string, []string, error) {
+	// 32 символа без похожих друг на друга i, l, o и 1
+	const alphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+	codes := make([]string, 0, RecoveryCodesCount)
+	hashes := make([]string, 0, RecoveryCodesCount)
+	raw := make([]byte, recoveryCodeLength)
+	for len(codes) < RecoveryCodesCount {
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		var b strings.Builder
+		for i, v := range raw {
+			if i == recoveryCodeLength/2 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(alphabet[int(v)%len(alphabet)])
+		}
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode хеширует код восстановления без учета регистра, пробелов и дефисов
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretCipher шифрует секреты TOTP перед сохранением в базу (AES-256-GCM). Шифртекст
+// привязан к пользователю через additional data: чужую строку подставить не получится.
+type secretCipher struct {
+	aead cipher.AEAD
+}
+
+// newSecretCipher создает шифр с ключом, выведенным из key
+func newSecretCipher(key string) (*secretCipher, error) {
+	if key == "" {
+		return nil, errors.New("ключ шифрования секретов TOTP не задан")
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &secretCipher{aead: aead}, nil
+}
+
+func (c *secretCipher) encrypt(plaintext []byte, userID int) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, plaintext, cipherAAD(userID))), nil
+}
+
+func (c *secretCipher) decrypt(encoded string, userID int) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("шифртекст короче nonce")
+	}
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, ciphertext, cipherAAD(userID))
+}
+
+func cipherAAD(userID int) []byte {
+	return []byte("user_totp:" + strconv.Itoa(userID))
+}
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/tokens"
+)
+
+// MFAMethodTOTP - второй фактор кодом из приложения-аутентификатора
+const MFAMethodTOTP = "totp"
+
+// TOTP - подключенный или подключаемый второй фактор пользователя
+type TOTP struct {
+	UserID          int
+	EncryptedSecret string
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
+	FailedAttempts  int
+	LastFailedAt    *time.Time
+}
+
+// Enabled сообщает, завершено ли подключение второго фактора
+func (t *TOTP) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
+
+// LoginResult - итог проверки пароля: пара токенов или, если включен второй фактор,
+// токен для POST /user/login/2fa
+type LoginResult struct {
+	Tokens     *tokens.TokenPair
+	MFAToken   string
+	MFAMethods []string
+}
+
+type TOTPSetupResponse struct {
+	// Secret - секрет в base32 для ручного ввода в приложение
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TOTPDisableRequest отключает второй фактор. Code - код аутентификатора или код восстановления.
+type TOTPDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// MFAChallengeResponse - ответ на вход с включенным вторым фактором
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	Methods     []string `json:"methods"`
+}
+
+// Login2FARequest завершает вход кодом аутентификатора или кодом восстановления
+type Login2FARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
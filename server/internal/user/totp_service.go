@@ -0,0 +1,231 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Adigezalov/goph-keeper/internal/tokens"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SetTOTPKey задает ключ, которым секреты TOTP шифруются в базе
+func (s *Service) SetTOTPKey(key string) error {
+	totpCipher, err := newSecretCipher(key)
+	if err != nil {
+		return err
+	}
+	s.totpCipher = totpCipher
+	return nil
+}
+
+// SetupTOTP создает новый секрет TOTP. Второй фактор включается только после ConfirmTOTP,
+// до этого повторный вызов заменяет секрет.
+func (s *Service) SetupTOTP(userID int) (*TOTPSetupResponse, error) {
+	if s.totpCipher == nil {
+		return nil, errors.New("ключ шифрования секретов TOTP не задан")
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать секрет второго фактора")
+	}
+
+	encrypted, err := s.totpCipher.encrypt(secret, userID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось зашифровать секрет второго фактора")
+	}
+
+	if err := s.repo.SaveTOTPSecret(userID, encrypted); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetupResponse{
+		Secret:     totpEncoding.EncodeToString(secret),
+		OtpauthURI: totpURI(user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP включает второй фактор по первому коду из приложения и возвращает коды восстановления.
+// Коды показываются один раз: сервер хранит только их хеши.
+func (s *Service) ConfirmTOTP(userID int, req *TOTPConfirmRequest) ([]string, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	code := normalizeMFACode(req.Code)
+	if code == "" {
+		return nil, ErrMFACodeRequired
+	}
+
+	totp, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled() {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if err := s.reserveMFAAttempt(userID); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.decryptTOTPSecret(totp)
+	if err != nil {
+		return nil, err
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now(), totp.LastUsedStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать коды восстановления")
+	}
+
+	if err := s.repo.ConfirmTOTP(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP отключает второй фактор. Нужны пароль и действующий код или код восстановления.
+func (s *Service) DisableTOTP(userID int, req *TOTPDisableRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Password == "" {
+		return ErrPasswordRequired
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	totp, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled() {
+		return ErrTOTPNotFound
+	}
+
+	if err := s.verifyMFACode(totp, req.Code); err != nil {
+		return err
+	}
+
+	return s.repo.DeleteTOTP(userID)
+}
+
+// CompleteLogin2FA обменивает токен из LoginUser и код второго фактора на пару токенов
+func (s *Service) CompleteLogin2FA(req *Login2FARequest) (*tokens.TokenPair, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	claims, err := s.validateMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	totp, err := s.repo.GetTOTP(claims.UserID)
+	if err != nil && !errors.Is(err, ErrTOTPNotFound) {
+		return nil, err
+	}
+	// Второй фактор отключили, пока шел вход: токен больше ничего не подтверждает
+	if !totp.Enabled() {
+		return nil, ErrInvalidMFAToken
+	}
+
+	user, err := s.repo.GetUserByID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	if err := s.verifyMFACode(totp, req.Code); err != nil {
+		return nil, err
+	}
+
+	tokenPair, err := s.tokenService.GenerateTokenPair(user.ID, user.Email)
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать токены")
+	}
+
+	return tokenPair, nil
+}
+
+// verifyMFACode принимает код аутентификатора или неиспользованный код восстановления.
+// Каждая проверка сначала занимает попытку, верный код сбрасывает счетчик; после
+// MaxMFAAttempts неверных кодов проверка блокируется на MFALockout.
+func (s *Service) verifyMFACode(totp *TOTP, rawCode string) error {
+	code := normalizeMFACode(rawCode)
+	if code == "" {
+		return ErrMFACodeRequired
+	}
+	if err := s.reserveMFAAttempt(totp.UserID); err != nil {
+		return err
+	}
+
+	var used bool
+	if isTOTPCode(code) {
+		secret, err := s.decryptTOTPSecret(totp)
+		if err != nil {
+			return err
+		}
+		if step, ok := matchTOTP(secret, code, time.Now(), totp.LastUsedStep); ok {
+			if used, err = s.repo.UseTOTPStep(totp.UserID, step); err != nil {
+				return err
+			}
+		}
+	} else {
+		var err error
+		if used, err = s.repo.UseRecoveryCode(totp.UserID, hashRecoveryCode(code)); err != nil {
+			return err
+		}
+	}
+
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// reserveMFAAttempt занимает попытку ввода кода или возвращает ErrMFATooManyAttempts
+func (s *Service) reserveMFAAttempt(userID int) error {
+	reserved, err := s.repo.ReserveMFAAttempt(userID)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrMFATooManyAttempts
+	}
+	return nil
+}
+
+func (s *Service) decryptTOTPSecret(totp *TOTP) ([]byte, error) {
+	if s.totpCipher == nil {
+		return nil, errors.New("ключ шифрования секретов TOTP не задан")
+	}
+	secret, err := s.totpCipher.decrypt(totp.EncryptedSecret, totp.UserID)
+	if err != nil {
+		return nil, WrapError(err, "не удалось расшифровать секрет второго фактора")
+	}
+	return secret, nil
+}
+
+func normalizeMFACode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
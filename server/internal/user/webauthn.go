@@ -0,0 +1,393 @@
+package user
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Параметры церемоний WebAuthn
+const (
+	WebAuthnRPName  = "GophKeeper"
+	WebAuthnTimeout = 5 * time.Minute
+	// MaxWebAuthnCredentialIDLength - предел длины credential id по спецификации WebAuthn
+	MaxWebAuthnCredentialIDLength   = 1023
+	MaxWebAuthnCredentialNameLength = 100
+	webAuthnChallengeSize           = 32
+)
+
+// Церемонии WebAuthn: регистрация ключа, вход по ключу без пароля, ключ как второй фактор
+// и подтверждение ключом действия вошедшего пользователя
+const (
+	webAuthnCeremonyRegister = "register"
+	webAuthnCeremonyLogin    = "login"
+	webAuthnCeremonyMFA      = "mfa"
+	webAuthnCeremonyConfirm  = "confirm"
+)
+
+// Алгоритмы COSE, которые принимает сервер
+const (
+	coseAlgES256 = -7
+	coseAlgEdDSA = -8
+	coseAlgRS256 = -257
+)
+
+// Флаги authenticatorData
+const (
+	authDataFlagUP = 0x01
+	authDataFlagUV = 0x04
+	authDataFlagAT = 0x40
+	authDataFlagED = 0x80
+)
+
+// Base64URL - байты, которые в JSON передаются в base64url без дополнения, как в WebAuthn
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// WebAuthnConfig - проверяющая сторона (relying party): домен, к которому привязаны ключи,
+// и адреса клиента, с которых разрешены церемонии
+type WebAuthnConfig struct {
+	RPID    string
+	Origins []string
+}
+
+type webAuthnRP struct {
+	id       string
+	origins  []string
+	rpIDHash [32]byte
+}
+
+func newWebAuthnRP(cfg WebAuthnConfig) (*webAuthnRP, error) {
+	if cfg.RPID == "" {
+		return nil, errors.New("не задан идентификатор проверяющей стороны WebAuthn")
+	}
+	if len(cfg.Origins) == 0 {
+		return nil, errors.New("не заданы разрешенные адреса клиента WebAuthn")
+	}
+	return &webAuthnRP{
+		id:       cfg.RPID,
+		origins:  cfg.Origins,
+		rpIDHash: sha256.Sum256([]byte(cfg.RPID)),
+	}, nil
+}
+
+func generateWebAuthnChallenge() ([]byte, error) {
+	challenge := make([]byte, webAuthnChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// webAuthnUserHandle - идентификатор пользователя, который аутентификатор хранит вместе с passkey
+func webAuthnUserHandle(userID int) []byte {
+	return []byte(strconv.Itoa(userID))
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData проверяет тип церемонии, challenge и адрес страницы, подписанные браузером
+func (rp *webAuthnRP) verifyClientData(raw []byte, ceremonyType string, challenge []byte) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return ErrWebAuthnVerificationFailed
+	}
+	if clientData.Type != ceremonyType || clientData.CrossOrigin {
+		return ErrWebAuthnVerificationFailed
+	}
+
+	received, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(clientData.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return ErrWebAuthnVerificationFailed
+	}
+
+	for _, origin := range rp.origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return ErrWebAuthnVerificationFailed
+}
+
+type authenticatorData struct {
+	RPIDHash  []byte
+	Flags     byte
+	SignCount uint32
+	// Заполняются при регистрации (флаг AT)
+	AAGUID              []byte
+	CredentialID        []byte
+	CredentialPublicKey []byte
+}
+
+// parseAuthenticatorData разбирает authenticatorData (WebAuthn §6.1)
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	authData := &authenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.Flags&authDataFlagAT != 0 {
+		if len(rest) < 18 {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		authData.AAGUID = rest[:16]
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > MaxWebAuthnCredentialIDLength || len(rest) < idLength {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		authData.CredentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		authData.CredentialPublicKey = rest[:n]
+		rest = rest[n:]
+	}
+
+	if authData.Flags&authDataFlagED != 0 {
+		// Расширения не запрашиваются, их содержимое не используется
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	return authData, nil
+}
+
+// verifyAuthData проверяет привязку к домену и присутствие пользователя, а при requireUV - и его проверку (PIN, биометрия)
+func (rp *webAuthnRP) verifyAuthData(authData *authenticatorData, requireUV bool) error {
+	if subtle.ConstantTimeCompare(authData.RPIDHash, rp.rpIDHash[:]) != 1 {
+		return ErrWebAuthnVerificationFailed
+	}
+	if authData.Flags&authDataFlagUP == 0 {
+		return ErrWebAuthnVerificationFailed
+	}
+	if requireUV && authData.Flags&authDataFlagUV == 0 {
+		return ErrWebAuthnVerificationFailed
+	}
+	return nil
+}
+
+// verifyAttestation проверяет ответ navigator.credentials.create и возвращает новый ключ.
+// Сервер запрашивает attestation "none": заявление об аттестации не проверяется,
+// ключу доверяем, потому что его регистрирует уже вошедший пользователь.
+func (rp *webAuthnRP) verifyAttestation(cred *AttestationCredential, challenge []byte) (*WebAuthnCredential, error) {
+	if cred.Type != "public-key" || len(cred.RawID) == 0 {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(cred.Response.AttestationObject)
+	if err != nil {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	if _, ok := attestation["fmt"].(string); !ok {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthData(authData, false); err != nil {
+		return nil, err
+	}
+	if authData.CredentialID == nil || !bytes.Equal(authData.CredentialID, cred.RawID) {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+
+	key, err := parseCOSEKey(authData.CredentialPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnCredential{
+		CredentialID: append([]byte(nil), authData.CredentialID...),
+		PublicKey:    append([]byte(nil), authData.CredentialPublicKey...),
+		Algorithm:    key.alg,
+		SignCount:    authData.SignCount,
+		AAGUID:       append([]byte(nil), authData.AAGUID...),
+		Transports:   cred.Response.Transports,
+	}, nil
+}
+
+// verifyAssertion проверяет ответ navigator.credentials.get для сохраненного ключа stored
+// и возвращает новое значение счетчика подписей
+func (rp *webAuthnRP) verifyAssertion(cred *AssertionCredential, challenge []byte, stored *WebAuthnCredential, requireUV bool) (uint32, error) {
+	if cred.Type != "public-key" || !bytes.Equal(cred.RawID, stored.CredentialID) {
+		return 0, ErrWebAuthnVerificationFailed
+	}
+	// userHandle приходит для passkey: он должен указывать на владельца ключа
+	if len(cred.Response.UserHandle) > 0 && !bytes.Equal(cred.Response.UserHandle, webAuthnUserHandle(stored.UserID)) {
+		return 0, ErrWebAuthnVerificationFailed
+	}
+	if err := rp.verifyClientData(cred.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(cred.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	if err := rp.verifyAuthData(authData, requireUV); err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(stored.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(cred.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), cred.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := key.verify(signed, cred.Response.Signature); err != nil {
+		return 0, err
+	}
+
+	// Аутентификаторы без счетчика всегда присылают 0. Иначе счетчик обязан расти:
+	// меньшее или то же значение означает копию ключа
+	if (authData.SignCount != 0 || stored.SignCount != 0) && authData.SignCount <= stored.SignCount {
+		return 0, ErrWebAuthnVerificationFailed
+	}
+	return authData.SignCount, nil
+}
+
+// coseKey - открытый ключ из формата COSE (RFC 9052)
+type coseKey struct {
+	alg    int64
+	public crypto.PublicKey
+}
+
+// Параметры ключей COSE
+const (
+	coseKeyKty     = 1
+	coseKeyAlg     = 3
+	coseKtyOKP     = 1
+	coseKtyEC2     = 2
+	coseKtyRSA     = 3
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+)
+
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	decoded, n, err := decodeCBOR(data)
+	if err != nil || n != len(data) {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	m, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+	kty, _ := m[int64(coseKeyKty)].(int64)
+	alg, _ := m[int64(coseKeyAlg)].(int64)
+	crv, _ := m[int64(-1)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == coseAlgES256 && crv == coseCrvP256:
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		public, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{0x04}, x...), y...))
+		if err != nil {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		return &coseKey{alg: alg, public: public}, nil
+	case kty == coseKtyOKP && alg == coseAlgEdDSA && crv == coseCrvEd25519:
+		x, _ := m[int64(-2)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		return &coseKey{alg: alg, public: ed25519.PublicKey(x)}, nil
+	case kty == coseKtyRSA && alg == coseAlgRS256:
+		// Для RSA параметр -1 - модуль, а не кривая
+		modulus, _ := m[int64(-1)].([]byte)
+		exponent, _ := m[int64(-2)].([]byte)
+		if len(exponent) == 0 || len(exponent) > 4 {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}
+		if public.N.BitLen() < MinRSAKeyBits || public.E < 3 {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		return &coseKey{alg: alg, public: public}, nil
+	default:
+		return nil, ErrWebAuthnAlgorithmUnsupported
+	}
+}
+
+func (k *coseKey) verify(signed, signature []byte) error {
+	var ok bool
+	switch public := k.public.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		ok = ecdsa.VerifyASN1(public, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(public, signed, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		ok = rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return ErrWebAuthnVerificationFailed
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package user
+
+import "time"
+
+// MFAMethodWebAuthn - второй фактор ключом WebAuthn (passkey или аппаратный ключ)
+const MFAMethodWebAuthn = "webauthn"
+
+// WebAuthnCredential - зарегистрированный ключ WebAuthn пользователя
+type WebAuthnCredential struct {
+	ID           string
+	UserID       int
+	CredentialID []byte
+	// PublicKey - открытый ключ в формате COSE, как его прислал аутентификатор
+	PublicKey  []byte
+	Algorithm  int64
+	SignCount  uint32
+	AAGUID     []byte
+	Transports []string
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// WebAuthnSession - начатая церемония WebAuthn. UserID равен 0 при входе по passkey без email.
+type WebAuthnSession struct {
+	ID        string
+	UserID    int
+	Ceremony  string
+	Challenge []byte
+	ExpiresAt time.Time
+}
+
+type WebAuthnCredentialResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (c *WebAuthnCredential) ToResponse() *WebAuthnCredentialResponse {
+	return &WebAuthnCredentialResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+// Параметры для navigator.credentials.create и navigator.credentials.get. Имена полей
+// совпадают со спецификацией WebAuthn, чтобы клиент передал их в браузер без преобразований.
+
+type WebAuthnRelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type WebAuthnUserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type WebAuthnCredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type WebAuthnCredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type WebAuthnAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type PublicKeyCredentialCreationOptions struct {
+	RP                     WebAuthnRelyingParty           `json:"rp"`
+	User                   WebAuthnUserEntity             `json:"user"`
+	Challenge              Base64URL                      `json:"challenge"`
+	PubKeyCredParams       []WebAuthnCredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"`
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection WebAuthnAuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                         `json:"attestation"`
+}
+
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        Base64URL                      `json:"challenge"`
+	Timeout          int64                          `json:"timeout"`
+	RPID             string                         `json:"rpId"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnRegistrationOptions - ответ на начало регистрации ключа. session_id передается в finish.
+type WebAuthnRegistrationOptions struct {
+	SessionID string                              `json:"session_id"`
+	Options   *PublicKeyCredentialCreationOptions `json:"options"`
+}
+
+// WebAuthnLoginOptions - ответ на начало входа по ключу
+type WebAuthnLoginOptions struct {
+	SessionID string                             `json:"session_id"`
+	Options   *PublicKeyCredentialRequestOptions `json:"options"`
+}
+
+// AttestationCredential - результат navigator.credentials.create в виде PublicKeyCredential.toJSON()
+type AttestationCredential struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionCredential - результат navigator.credentials.get в виде PublicKeyCredential.toJSON()
+type AssertionCredential struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+type WebAuthnRegisterFinishRequest struct {
+	SessionID  string                `json:"session_id"`
+	Name       string                `json:"name"`
+	Credential AttestationCredential `json:"credential"`
+}
+
+// WebAuthnLoginBeginRequest начинает вход по ключу без пароля. Без email браузер
+// предложит любой passkey этого сайта.
+type WebAuthnLoginBeginRequest struct {
+	Email string `json:"email"`
+}
+
+type WebAuthnLoginFinishRequest struct {
+	SessionID  string              `json:"session_id"`
+	Credential AssertionCredential `json:"credential"`
+}
+
+// WebAuthnMFABeginRequest начинает подтверждение входа ключом после пароля
+type WebAuthnMFABeginRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type WebAuthnMFAFinishRequest struct {
+	MFAToken   string              `json:"mfa_token"`
+	SessionID  string              `json:"session_id"`
+	Credential AssertionCredential `json:"credential"`
+}
+
+// WebAuthnDeleteRequest удаляет ключ. Пароль нужен, как и при отключении TOTP. Последний второй
+// фактор дополнительно подтверждается подписью ключа: session_id из POST /user/webauthn/confirm/begin
+// и ответ navigator.credentials.get.
+type WebAuthnDeleteRequest struct {
+	Password   string               `json:"password"`
+	SessionID  string               `json:"session_id,omitempty"`
+	Credential *AssertionCredential `json:"credential,omitempty"`
+}
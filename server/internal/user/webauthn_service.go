@@ -0,0 +1,477 @@
+package user
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Adigezalov/goph-keeper/internal/tokens"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultWebAuthnCredentialName - название ключа, если пользователь его не указал
+const DefaultWebAuthnCredentialName = "Passkey"
+
+// SetWebAuthn задает проверяющую сторону WebAuthn. Без нее церемонии WebAuthn недоступны.
+func (s *Service) SetWebAuthn(cfg WebAuthnConfig) error {
+	rp, err := newWebAuthnRP(cfg)
+	if err != nil {
+		return err
+	}
+	s.webAuthn = rp
+	return nil
+}
+
+// BeginWebAuthnRegistration начинает регистрацию ключа вошедшим пользователем
+func (s *Service) BeginWebAuthnRegistration(userID int) (*WebAuthnRegistrationOptions, error) {
+	rp, err := s.webAuthnRP()
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.repo.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.startWebAuthnSession(userID, webAuthnCeremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnRegistrationOptions{
+		SessionID: session.ID,
+		Options: &PublicKeyCredentialCreationOptions{
+			RP: WebAuthnRelyingParty{ID: rp.id, Name: WebAuthnRPName},
+			User: WebAuthnUserEntity{
+				ID:          webAuthnUserHandle(user.ID),
+				Name:        user.Email,
+				DisplayName: user.Email,
+			},
+			Challenge: session.Challenge,
+			PubKeyCredParams: []WebAuthnCredentialParameter{
+				{Type: "public-key", Alg: coseAlgES256},
+				{Type: "public-key", Alg: coseAlgEdDSA},
+				{Type: "public-key", Alg: coseAlgRS256},
+			},
+			Timeout: WebAuthnTimeout.Milliseconds(),
+			// Не даем зарегистрировать один аутентификатор дважды
+			ExcludeCredentials: webAuthnDescriptors(creds),
+			AuthenticatorSelection: WebAuthnAuthenticatorSelection{
+				ResidentKey:      "preferred",
+				UserVerification: "preferred",
+			},
+			Attestation: "none",
+		},
+	}, nil
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет новый ключ
+func (s *Service) FinishWebAuthnRegistration(userID int, req *WebAuthnRegisterFinishRequest) (*WebAuthnCredential, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	rp, err := s.webAuthnRP()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = DefaultWebAuthnCredentialName
+	}
+	if utf8.RuneCountInString(name) > MaxWebAuthnCredentialNameLength {
+		return nil, ErrWebAuthnCredentialNameTooLong
+	}
+
+	session, err := s.consumeWebAuthnSession(req.SessionID, webAuthnCeremonyRegister)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, ErrWebAuthnSessionNotFound
+	}
+
+	cred, err := rp.verifyAttestation(&req.Credential, session.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	cred.UserID = userID
+	cred.Name = name
+
+	if err := s.repo.CreateWebAuthnCredential(cred); err != nil {
+		return nil, err
+	}
+
+	return cred, nil
+}
+
+func (s *Service) ListWebAuthnCredentials(userID int) ([]*WebAuthnCredential, error) {
+	return s.repo.ListWebAuthnCredentials(userID)
+}
+
+// BeginWebAuthnConfirmation начинает подтверждение ключом действия вошедшего пользователя,
+// например удаления последнего второго фактора
+func (s *Service) BeginWebAuthnConfirmation(userID int) (*WebAuthnLoginOptions, error) {
+	rp, err := s.webAuthnRP()
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.repo.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	session, err := s.startWebAuthnSession(userID, webAuthnCeremonyConfirm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnLoginOptions{
+		SessionID: session.ID,
+		Options: &PublicKeyCredentialRequestOptions{
+			Challenge:        session.Challenge,
+			Timeout:          WebAuthnTimeout.Milliseconds(),
+			RPID:             rp.id,
+			AllowCredentials: webAuthnDescriptors(creds),
+			// Пароль проверяется вместе с действием: достаточно касания ключа
+			UserVerification: "discouraged",
+		},
+	}, nil
+}
+
+// DeleteWebAuthnCredential удаляет ключ пользователя после проверки пароля. Если это последний
+// второй фактор (других ключей нет и TOTP не подключен), удаление нужно подтвердить подписью
+// этого ключа: иначе одного пароля хватило бы, чтобы отключить второй фактор.
+func (s *Service) DeleteWebAuthnCredential(userID int, id string, req *WebAuthnDeleteRequest) error {
+	if req == nil {
+		return ErrRequestRequired
+	}
+	if req.Password == "" {
+		return ErrPasswordRequired
+	}
+
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	last, err := s.isLastMFAMethod(userID, id)
+	if err != nil {
+		return err
+	}
+	if last {
+		if err := s.confirmWithWebAuthn(userID, req); err != nil {
+			return err
+		}
+	}
+
+	return s.repo.DeleteWebAuthnCredential(userID, id)
+}
+
+// isLastMFAMethod сообщает, останется ли пользователь без второго фактора после удаления ключа id
+func (s *Service) isLastMFAMethod(userID int, id string) (bool, error) {
+	creds, err := s.repo.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for _, cred := range creds {
+		if cred.ID == id {
+			found = true
+		}
+	}
+	if !found {
+		return false, ErrWebAuthnCredentialNotFound
+	}
+	if len(creds) > 1 {
+		return false, nil
+	}
+
+	totp, err := s.repo.GetTOTP(userID)
+	if err != nil && !errors.Is(err, ErrTOTPNotFound) {
+		return false, err
+	}
+	return !totp.Enabled(), nil
+}
+
+// confirmWithWebAuthn проверяет подпись ключа пользователя из церемонии confirm
+func (s *Service) confirmWithWebAuthn(userID int, req *WebAuthnDeleteRequest) error {
+	if req.SessionID == "" || req.Credential == nil {
+		return ErrWebAuthnConfirmationRequired
+	}
+
+	session, err := s.consumeWebAuthnSession(req.SessionID, webAuthnCeremonyConfirm)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrWebAuthnSessionNotFound
+	}
+
+	_, err = s.verifyWebAuthnAssertion(session, req.Credential, false)
+	return err
+}
+
+// BeginWebAuthnLogin начинает вход по ключу без пароля. С email браузеру передаются ключи
+// этого пользователя, без него браузер предложит сохраненные passkey. Неизвестный email
+// не отличается от пользователя без ключей: подходящего ключа просто не найдется.
+func (s *Service) BeginWebAuthnLogin(req *WebAuthnLoginBeginRequest) (*WebAuthnLoginOptions, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	rp, err := s.webAuthnRP()
+	if err != nil {
+		return nil, err
+	}
+
+	userID := 0
+	allowed := []WebAuthnCredentialDescriptor{}
+	if email := strings.TrimSpace(req.Email); email != "" {
+		user, err := s.repo.GetUserByEmail(email)
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			return nil, err
+		}
+		if user != nil {
+			creds, err := s.repo.ListWebAuthnCredentials(user.ID)
+			if err != nil {
+				return nil, err
+			}
+			if len(creds) > 0 {
+				userID = user.ID
+				allowed = webAuthnDescriptors(creds)
+			}
+		}
+	}
+
+	session, err := s.startWebAuthnSession(userID, webAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnLoginOptions{
+		SessionID: session.ID,
+		Options: &PublicKeyCredentialRequestOptions{
+			Challenge:        session.Challenge,
+			Timeout:          WebAuthnTimeout.Milliseconds(),
+			RPID:             rp.id,
+			AllowCredentials: allowed,
+			// Ключ заменяет и пароль, и второй фактор, поэтому аутентификатор обязан проверить пользователя
+			UserVerification: "required",
+		},
+	}, nil
+}
+
+// FinishWebAuthnLogin завершает вход по ключу без пароля и выдает пару токенов
+func (s *Service) FinishWebAuthnLogin(req *WebAuthnLoginFinishRequest) (*tokens.TokenPair, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	session, err := s.consumeWebAuthnSession(req.SessionID, webAuthnCeremonyLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.verifyWebAuthnAssertion(session, &req.Credential, true)
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	tokenPair, err := s.tokenService.GenerateTokenPair(user.ID, user.Email)
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать токены")
+	}
+
+	return tokenPair, nil
+}
+
+// BeginWebAuthnMFA начинает подтверждение входа ключом после проверки пароля
+func (s *Service) BeginWebAuthnMFA(req *WebAuthnMFABeginRequest) (*WebAuthnLoginOptions, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+	rp, err := s.webAuthnRP()
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := s.validateMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.repo.ListWebAuthnCredentials(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(creds) == 0 {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	session, err := s.startWebAuthnSession(claims.UserID, webAuthnCeremonyMFA)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnLoginOptions{
+		SessionID: session.ID,
+		Options: &PublicKeyCredentialRequestOptions{
+			Challenge:        session.Challenge,
+			Timeout:          WebAuthnTimeout.Milliseconds(),
+			RPID:             rp.id,
+			AllowCredentials: webAuthnDescriptors(creds),
+			// Пароль уже проверен: достаточно касания ключа
+			UserVerification: "discouraged",
+		},
+	}, nil
+}
+
+// FinishWebAuthnMFA обменивает токен из LoginUser и подпись ключа на пару токенов
+func (s *Service) FinishWebAuthnMFA(req *WebAuthnMFAFinishRequest) (*tokens.TokenPair, error) {
+	if req == nil {
+		return nil, ErrRequestRequired
+	}
+
+	claims, err := s.validateMFAToken(req.MFAToken)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.consumeWebAuthnSession(req.SessionID, webAuthnCeremonyMFA)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != claims.UserID {
+		return nil, ErrWebAuthnSessionNotFound
+	}
+
+	user, err := s.verifyWebAuthnAssertion(session, &req.Credential, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenPair, err := s.tokenService.GenerateTokenPair(user.ID, user.Email)
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать токены")
+	}
+
+	return tokenPair, nil
+}
+
+// verifyWebAuthnAssertion проверяет подпись ключа для церемонии session и возвращает владельца ключа
+func (s *Service) verifyWebAuthnAssertion(session *WebAuthnSession, assertion *AssertionCredential, requireUV bool) (*User, error) {
+	rp, err := s.webAuthnRP()
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := s.repo.GetWebAuthnCredential(assertion.RawID)
+	if err != nil {
+		if errors.Is(err, ErrWebAuthnCredentialNotFound) {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		return nil, err
+	}
+	if session.UserID != 0 && stored.UserID != session.UserID {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+
+	signCount, err := rp.verifyAssertion(assertion, session.Challenge, stored, requireUV)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.UpdateWebAuthnSignCount(stored.ID, signCount)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrWebAuthnVerificationFailed
+	}
+
+	user, err := s.repo.GetUserByID(stored.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrWebAuthnVerificationFailed
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *Service) startWebAuthnSession(userID int, ceremony string) (*WebAuthnSession, error) {
+	challenge, err := generateWebAuthnChallenge()
+	if err != nil {
+		return nil, WrapError(err, "не удалось создать challenge WebAuthn")
+	}
+
+	session := &WebAuthnSession{
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(WebAuthnTimeout),
+	}
+	if err := s.repo.CreateWebAuthnSession(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *Service) consumeWebAuthnSession(id string, ceremony string) (*WebAuthnSession, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrWebAuthnSessionNotFound
+	}
+
+	session, err := s.repo.ConsumeWebAuthnSession(id, ceremony)
+	if err != nil {
+		return nil, err
+	}
+	if session.ExpiresAt.Before(time.Now()) {
+		return nil, ErrWebAuthnSessionNotFound
+	}
+
+	return session, nil
+}
+
+func (s *Service) webAuthnRP() (*webAuthnRP, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("проверяющая сторона WebAuthn не задана")
+	}
+	return s.webAuthn, nil
+}
+
+func webAuthnDescriptors(creds []*WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	descriptors := make([]WebAuthnCredentialDescriptor, 0, len(creds))
+	for _, cred := range creds {
+		descriptors = append(descriptors, WebAuthnCredentialDescriptor{
+			Type:       "public-key",
+			ID:         cred.CredentialID,
+			Transports: cred.Transports,
+		})
+	}
+	return descriptors
+}
@@ -9,6 +9,10 @@ type VerificationCode struct {
 	CreatedAt time.Time `db:"created_at"`
 	ExpiresAt time.Time `db:"expires_at"`
 	Used      bool      `db:"used"`
+	// Attempts - неверные вводы кода смены email
+	Attempts int `db:"attempts"`
+	// NewEmail - адрес, на который меняется email. Пустой у кодов подтверждения регистрации.
+	NewEmail string `db:"new_email"`
 }
 
 type VerifyEmailRequest struct {
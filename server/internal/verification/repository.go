@@ -17,20 +17,20 @@ func NewRepository(db *sqlx.DB) *Repository {
 
 func (r *Repository) CreateVerificationCode(code *VerificationCode) error {
 	query := `
-		INSERT INTO email_verification_codes (user_id, code, expires_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO email_verification_codes (user_id, code, expires_at, new_email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(query, code.UserID, code.Code, code.ExpiresAt).Scan(&code.ID, &code.CreatedAt)
+	err := r.db.QueryRow(query, code.UserID, code.Code, code.ExpiresAt, code.NewEmail).Scan(&code.ID, &code.CreatedAt)
 	return err
 }
 
 func (r *Repository) GetActiveVerificationCode(userID int, code string) (*VerificationCode, error) {
 	var vc VerificationCode
 	query := `
-		SELECT id, user_id, code, created_at, expires_at, used
+		SELECT id, user_id, code, created_at, expires_at, used, COALESCE(new_email, '') AS new_email
 		FROM email_verification_codes
-		WHERE user_id = $1 AND code = $2 AND used = false
+		WHERE user_id = $1 AND code = $2 AND used = false AND new_email IS NULL
 		ORDER BY created_at DESC
 		LIMIT 1
 	`
@@ -44,6 +44,47 @@ func (r *Repository) GetActiveVerificationCode(userID int, code string) (*Verifi
 	return &vc, nil
 }
 
+// GetActiveEmailChangeCode возвращает последний неиспользованный код смены email. Код ищется
+// по пользователю, а не по значению, чтобы неверные вводы засчитывались этому коду.
+func (r *Repository) GetActiveEmailChangeCode(userID int) (*VerificationCode, error) {
+	var vc VerificationCode
+	query := `
+		SELECT id, user_id, code, created_at, expires_at, used, attempts, new_email
+		FROM email_verification_codes
+		WHERE user_id = $1 AND used = false AND new_email IS NOT NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+	`
+	err := r.db.Get(&vc, query, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCodeNotFound
+		}
+		return nil, err
+	}
+	return &vc, nil
+}
+
+// ReserveEmailChangeAttempt засчитывает попытку ввода кода до его проверки одним UPDATE.
+// Возвращает false, если код использован или попытки исчерпаны.
+func (r *Repository) ReserveEmailChangeAttempt(codeID int, maxAttempts int) (bool, error) {
+	var reservedID int
+	query := `
+		UPDATE email_verification_codes
+		SET attempts = attempts + 1
+		WHERE id = $1 AND used = false AND attempts < $2
+		RETURNING id
+	`
+	err := r.db.QueryRow(query, codeID, maxAttempts).Scan(&reservedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (r *Repository) MarkCodeAsUsed(codeID int) error {
 	query := `
 		UPDATE email_verification_codes
@@ -62,3 +103,12 @@ func (r *Repository) DeleteUserCodes(userID int) error {
 	_, err := r.db.Exec(query, userID)
 	return err
 }
+
+func (r *Repository) DeleteEmailChangeCodes(userID int) error {
+	query := `
+		DELETE FROM email_verification_codes
+		WHERE user_id = $1 AND new_email IS NOT NULL
+	`
+	_, err := r.db.Exec(query, userID)
+	return err
+}
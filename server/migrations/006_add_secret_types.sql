@@ -0,0 +1,13 @@
+-- Тип секрета: login (логин/пароль), text (заметка), card (банковская карта), file (файл)
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT 'login';
+
+ALTER TABLE secrets DROP CONSTRAINT IF EXISTS secrets_type_check;
+ALTER TABLE secrets ADD CONSTRAINT secrets_type_check
+    CHECK (type IN ('login', 'text', 'card', 'file'));
+
+-- Типизированные данные (шифруются на клиенте)
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS text_data TEXT NOT NULL DEFAULT '';   -- Текст заметки (base64)
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS card_data JSONB;                      -- Данные карты: number, expiry, holder, cvv (base64)
+
+-- Индекс для фильтрации активных секретов по типу
+CREATE INDEX IF NOT EXISTS idx_secrets_user_id_type ON secrets(user_id, type) WHERE deleted_at IS NULL;
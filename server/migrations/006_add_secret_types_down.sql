@@ -0,0 +1,6 @@
+-- Откат миграции: удаление типов секретов
+DROP INDEX IF EXISTS idx_secrets_user_id_type;
+ALTER TABLE secrets DROP COLUMN IF EXISTS card_data;
+ALTER TABLE secrets DROP COLUMN IF EXISTS text_data;
+ALTER TABLE secrets DROP CONSTRAINT IF EXISTS secrets_type_check;
+ALTER TABLE secrets DROP COLUMN IF EXISTS type;
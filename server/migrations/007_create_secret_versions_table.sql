@@ -0,0 +1,45 @@
+-- История версий секретов: снимок сохраняется при создании секрета и при каждом изменении версии
+CREATE TABLE IF NOT EXISTS secret_versions (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    secret_id UUID NOT NULL REFERENCES secrets(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    login TEXT NOT NULL,
+    password TEXT NOT NULL,
+    text_data TEXT NOT NULL DEFAULT '',
+    card_data JSONB,
+    metadata JSONB,
+    binary_data BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (secret_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_secret_versions_secret_id ON secret_versions(secret_id, version DESC);
+
+-- Снимок пишется триггером, чтобы история не зависела от того, каким путем изменен секрет
+CREATE OR REPLACE FUNCTION record_secret_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.version = OLD.version THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO secret_versions (secret_id, user_id, version, type, login, password, text_data, card_data, metadata, binary_data)
+    VALUES (NEW.id, NEW.user_id, NEW.version, NEW.type, NEW.login, NEW.password, NEW.text_data, NEW.card_data, NEW.metadata, NEW.binary_data)
+    ON CONFLICT (secret_id, version) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER record_secret_version_trigger
+    AFTER INSERT OR UPDATE ON secrets
+    FOR EACH ROW
+    EXECUTE FUNCTION record_secret_version();
+
+-- Текущее состояние существующих секретов становится первой записью истории
+INSERT INTO secret_versions (secret_id, user_id, version, type, login, password, text_data, card_data, metadata, binary_data, created_at)
+SELECT id, user_id, version, type, login, password, text_data, card_data, metadata, binary_data, updated_at
+FROM secrets
+ON CONFLICT (secret_id, version) DO NOTHING;
@@ -0,0 +1,5 @@
+-- Откат миграции: удаление истории версий секретов
+DROP TRIGGER IF EXISTS record_secret_version_trigger ON secrets;
+DROP FUNCTION IF EXISTS record_secret_version();
+DROP INDEX IF EXISTS idx_secret_versions_secret_id;
+DROP TABLE IF EXISTS secret_versions;
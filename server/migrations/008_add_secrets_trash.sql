@@ -0,0 +1,18 @@
+-- Окончательное удаление: данные секрета стираются сразу, а строка остается
+-- надгробием для синхронизации, пока ее не удалит фоновая очистка
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP WITH TIME ZONE;
+
+-- Позиция синхронизации каждого устройства (X-Session-ID). Надгробие удаляется
+-- только когда все устройства пользователя синхронизировались после deleted_at
+CREATE TABLE IF NOT EXISTS sync_devices (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id VARCHAR(255) NOT NULL,
+    last_synced_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sync_devices_updated_at ON sync_devices(updated_at);
+
+-- Индекс для поиска надгробий фоновой очисткой
+CREATE INDEX IF NOT EXISTS idx_secrets_tombstones ON secrets(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Откат миграции: удаление корзины
+DROP INDEX IF EXISTS idx_secrets_tombstones;
+DROP INDEX IF EXISTS idx_sync_devices_updated_at;
+DROP TABLE IF EXISTS sync_devices;
+ALTER TABLE secrets DROP COLUMN IF EXISTS purged_at;
@@ -0,0 +1,20 @@
+-- Незавершенные загрузки по частям. Хранятся в базе, чтобы переживать перезапуск
+-- сервера и быть видимыми всем репликам
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    upload_id UUID PRIMARY KEY,
+    secret_id UUID NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    total_chunks INTEGER NOT NULL,
+    total_size BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions(expires_at);
+
+CREATE TABLE IF NOT EXISTS upload_chunks (
+    upload_id UUID NOT NULL REFERENCES upload_sessions(upload_id) ON DELETE CASCADE,
+    chunk_index INTEGER NOT NULL,
+    data BYTEA NOT NULL,
+    PRIMARY KEY (upload_id, chunk_index)
+);
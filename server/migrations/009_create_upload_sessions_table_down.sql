@@ -0,0 +1,3 @@
+-- Откат миграции: удаление сессий загрузки по частям
+DROP TABLE IF EXISTS upload_chunks;
+DROP TABLE IF EXISTS upload_sessions;
@@ -0,0 +1,36 @@
+-- Бинарные данные хранятся во внешнем хранилище (BLOB_STORE: fs или s3),
+-- в базе остаются только ссылка на объект, размер и SHA-256 содержимого
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS blob_ref TEXT;
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS blob_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS blob_checksum VARCHAR(64);
+
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS blob_ref TEXT;
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS blob_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE secret_versions ADD COLUMN IF NOT EXISTS blob_checksum VARCHAR(64);
+
+-- Размер известен сразу. Сами данные из binary_data переносит сервер при запуске
+-- (DatabaseRepository.MigrateBinaryData), после чего колонка обнуляется
+UPDATE secrets SET blob_size = octet_length(binary_data) WHERE binary_data IS NOT NULL;
+UPDATE secret_versions SET blob_size = octet_length(binary_data) WHERE binary_data IS NOT NULL;
+
+-- Поиск ссылок при освобождении объектов
+CREATE INDEX IF NOT EXISTS idx_secrets_blob_ref ON secrets(blob_ref) WHERE blob_ref IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_secret_versions_blob_ref ON secret_versions(blob_ref) WHERE blob_ref IS NOT NULL;
+
+-- Снимок версии ссылается на тот же объект, что и секрет: неизменившийся файл не копируется
+CREATE OR REPLACE FUNCTION record_secret_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.version = OLD.version THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO secret_versions (secret_id, user_id, version, type, login, password, text_data, card_data, metadata,
+                                 binary_data, blob_ref, blob_size, blob_checksum)
+    VALUES (NEW.id, NEW.user_id, NEW.version, NEW.type, NEW.login, NEW.password, NEW.text_data, NEW.card_data, NEW.metadata,
+            NEW.binary_data, NEW.blob_ref, NEW.blob_size, NEW.blob_checksum)
+    ON CONFLICT (secret_id, version) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
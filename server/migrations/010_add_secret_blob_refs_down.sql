@@ -0,0 +1,27 @@
+-- Откат миграции: удаление ссылок на внешнее хранилище.
+-- Данные, уже перенесенные в хранилище, в binary_data не возвращаются
+CREATE OR REPLACE FUNCTION record_secret_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.version = OLD.version THEN
+        RETURN NEW;
+    END IF;
+
+    INSERT INTO secret_versions (secret_id, user_id, version, type, login, password, text_data, card_data, metadata, binary_data)
+    VALUES (NEW.id, NEW.user_id, NEW.version, NEW.type, NEW.login, NEW.password, NEW.text_data, NEW.card_data, NEW.metadata, NEW.binary_data)
+    ON CONFLICT (secret_id, version) DO NOTHING;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_secret_versions_blob_ref;
+DROP INDEX IF EXISTS idx_secrets_blob_ref;
+
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS blob_checksum;
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS blob_size;
+ALTER TABLE secret_versions DROP COLUMN IF EXISTS blob_ref;
+
+ALTER TABLE secrets DROP COLUMN IF EXISTS blob_checksum;
+ALTER TABLE secrets DROP COLUMN IF EXISTS blob_size;
+ALTER TABLE secrets DROP COLUMN IF EXISTS blob_ref;
@@ -0,0 +1,62 @@
+-- Порядковый номер изменения для инкрементальной синхронизации. Номера выдаются
+-- из счетчика пользователя: строка счетчика блокируется до конца транзакции, поэтому
+-- изменения одного пользователя фиксируются строго в порядке номеров и клиент,
+-- получивший номер N, не пропустит изменение с меньшим номером
+CREATE TABLE IF NOT EXISTS sync_counters (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    last_seq BIGINT NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION next_change_seq(p_user_id INTEGER)
+RETURNS BIGINT AS $$
+DECLARE
+    seq BIGINT;
+BEGIN
+    INSERT INTO sync_counters (user_id, last_seq)
+    VALUES (p_user_id, 1)
+    ON CONFLICT (user_id) DO UPDATE SET last_seq = sync_counters.last_seq + 1
+    RETURNING last_seq INTO seq;
+
+    RETURN seq;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS change_seq BIGINT;
+
+-- Существующие секреты нумеруются в порядке последнего изменения
+UPDATE secrets s
+SET change_seq = numbered.seq
+FROM (
+    SELECT id, ROW_NUMBER() OVER (
+        PARTITION BY user_id
+        ORDER BY GREATEST(updated_at, COALESCE(deleted_at, updated_at)), id
+    ) AS seq
+    FROM secrets
+) numbered
+WHERE s.id = numbered.id;
+
+INSERT INTO sync_counters (user_id, last_seq)
+SELECT user_id, MAX(change_seq) FROM secrets GROUP BY user_id
+ON CONFLICT (user_id) DO UPDATE SET last_seq = GREATEST(sync_counters.last_seq, EXCLUDED.last_seq);
+
+ALTER TABLE secrets ALTER COLUMN change_seq SET NOT NULL;
+
+-- Номер выдается при каждой записи строки, каким бы путем она ни была изменена
+CREATE OR REPLACE FUNCTION set_secret_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.change_seq := next_change_seq(NEW.user_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_secret_change_seq_trigger
+    BEFORE INSERT OR UPDATE ON secrets
+    FOR EACH ROW
+    EXECUTE FUNCTION set_secret_change_seq();
+
+CREATE INDEX IF NOT EXISTS idx_secrets_user_change_seq ON secrets(user_id, change_seq);
+
+-- Позиция устройства теперь - номер изменения, до которого оно получило данные.
+-- Существующие устройства начинают с нуля и удерживают надгробия до следующей синхронизации
+ALTER TABLE sync_devices ADD COLUMN IF NOT EXISTS last_synced_seq BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Откат миграции: удаление номеров изменений
+ALTER TABLE sync_devices DROP COLUMN IF EXISTS last_synced_seq;
+DROP INDEX IF EXISTS idx_secrets_user_change_seq;
+DROP TRIGGER IF EXISTS set_secret_change_seq_trigger ON secrets;
+DROP FUNCTION IF EXISTS set_secret_change_seq();
+ALTER TABLE secrets DROP COLUMN IF EXISTS change_seq;
+DROP FUNCTION IF EXISTS next_change_seq(INTEGER);
+DROP TABLE IF EXISTS sync_counters;
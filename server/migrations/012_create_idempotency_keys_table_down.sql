@@ -0,0 +1,2 @@
+-- Откат миграции: удаление ключей идемпотентности
+DROP TABLE IF EXISTS idempotency_keys;
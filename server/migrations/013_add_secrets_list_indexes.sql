@@ -0,0 +1,5 @@
+-- Индексы для постраничного списка секретов: порядок (поле сортировки, id) совпадает
+-- с ORDER BY, поэтому страница после курсора читается без сортировки всех секретов
+CREATE INDEX IF NOT EXISTS idx_secrets_list_created ON secrets(user_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_secrets_list_updated ON secrets(user_id, updated_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_secrets_list_login ON secrets(user_id, login, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,4 @@
+-- Откат миграции: удаление индексов постраничного списка секретов
+DROP INDEX IF EXISTS idx_secrets_list_login;
+DROP INDEX IF EXISTS idx_secrets_list_updated;
+DROP INDEX IF EXISTS idx_secrets_list_created;
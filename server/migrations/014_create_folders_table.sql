@@ -0,0 +1,31 @@
+-- Папки для группировки секретов. Название приходит от клиента как есть (может быть зашифровано).
+-- Удаленная папка остается надгробием, пока о ней не узнают все устройства
+CREATE TABLE IF NOT EXISTS folders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES folders(id) ON DELETE SET NULL,  -- NULL = корень
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    change_seq BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_folders_user_change_seq ON folders(user_id, change_seq);
+CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders(parent_id) WHERE parent_id IS NOT NULL;
+
+CREATE TRIGGER update_folders_updated_at
+    BEFORE UPDATE ON folders
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Папки нумеруются тем же счетчиком, что и секреты: одна лента синхронизации для обоих
+CREATE TRIGGER set_folder_change_seq_trigger
+    BEFORE INSERT OR UPDATE ON folders
+    FOR EACH ROW
+    EXECUTE FUNCTION set_secret_change_seq();
+
+ALTER TABLE secrets ADD COLUMN IF NOT EXISTS folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_secrets_folder_id ON secrets(folder_id) WHERE folder_id IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Откат миграции: удаление папок
+DROP INDEX IF EXISTS idx_secrets_folder_id;
+ALTER TABLE secrets DROP COLUMN IF EXISTS folder_id;
+
+DROP TRIGGER IF EXISTS set_folder_change_seq_trigger ON folders;
+DROP TRIGGER IF EXISTS update_folders_updated_at ON folders;
+DROP TABLE IF EXISTS folders;
@@ -0,0 +1,35 @@
+-- Метки секретов. Название уникально среди неудаленных меток пользователя.
+-- Удаленная метка остается надгробием, пока о ней не узнают все устройства
+CREATE TABLE IF NOT EXISTS tags (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    change_seq BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name ON tags(user_id, name) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_tags_user_change_seq ON tags(user_id, change_seq);
+
+CREATE TRIGGER update_tags_updated_at
+    BEFORE UPDATE ON tags
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Метки идут в общей ленте синхронизации вместе с секретами и папками
+CREATE TRIGGER set_tag_change_seq_trigger
+    BEFORE INSERT OR UPDATE ON tags
+    FOR EACH ROW
+    EXECUTE FUNCTION set_secret_change_seq();
+
+CREATE TABLE IF NOT EXISTS secret_tags (
+    secret_id UUID NOT NULL REFERENCES secrets(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (secret_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_secret_tags_tag_id ON secret_tags(tag_id);
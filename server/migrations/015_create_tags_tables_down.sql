@@ -0,0 +1,6 @@
+-- Откат миграции: удаление меток
+DROP TABLE IF EXISTS secret_tags;
+
+DROP TRIGGER IF EXISTS set_tag_change_seq_trigger ON tags;
+DROP TRIGGER IF EXISTS update_tags_updated_at ON tags;
+DROP TABLE IF EXISTS tags;
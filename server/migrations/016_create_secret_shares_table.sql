@@ -0,0 +1,52 @@
+-- Доступ к секрету для других пользователей. wrapped_key - ключ секрета, зашифрованный
+-- на клиенте для получателя; сервер его не разбирает. Отозванный доступ остается
+-- надгробием, пока об отзыве не узнают все устройства получателя
+CREATE TABLE IF NOT EXISTS secret_shares (
+    secret_id UUID NOT NULL REFERENCES secrets(id) ON DELETE CASCADE,
+    grantee_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission VARCHAR(10) NOT NULL CHECK (permission IN ('read', 'write')),
+    wrapped_key TEXT NOT NULL,
+    change_seq BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (secret_id, grantee_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_secret_shares_grantee_change_seq ON secret_shares(grantee_user_id, change_seq);
+
+CREATE TRIGGER update_secret_shares_updated_at
+    BEFORE UPDATE OF permission, wrapped_key, revoked_at ON secret_shares
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Номер изменения доступа выдается счетчиком получателя: чужой секрет идет в его ленте
+-- синхронизации под этим номером
+CREATE OR REPLACE FUNCTION set_share_change_seq()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.change_seq := next_change_seq(NEW.grantee_user_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER set_share_change_seq_trigger
+    BEFORE INSERT OR UPDATE OF permission, wrapped_key, revoked_at ON secret_shares
+    FOR EACH ROW
+    EXECUTE FUNCTION set_share_change_seq();
+
+-- Любое изменение секрета получает новый номер и у каждого получателя
+CREATE OR REPLACE FUNCTION touch_secret_shares()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE secret_shares
+    SET change_seq = next_change_seq(grantee_user_id)
+    WHERE secret_id = NEW.id AND revoked_at IS NULL;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER touch_secret_shares_trigger
+    AFTER UPDATE ON secrets
+    FOR EACH ROW
+    EXECUTE FUNCTION touch_secret_shares();
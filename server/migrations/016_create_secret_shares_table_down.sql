@@ -0,0 +1,8 @@
+-- Откат миграции: удаление доступа к секретам
+DROP TRIGGER IF EXISTS touch_secret_shares_trigger ON secrets;
+DROP FUNCTION IF EXISTS touch_secret_shares();
+
+DROP TRIGGER IF EXISTS set_share_change_seq_trigger ON secret_shares;
+DROP TRIGGER IF EXISTS update_secret_shares_updated_at ON secret_shares;
+DROP FUNCTION IF EXISTS set_share_change_seq();
+DROP TABLE IF EXISTS secret_shares;
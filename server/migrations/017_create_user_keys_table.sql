@@ -0,0 +1,23 @@
+-- Открытые ключи пользователей для сквозного шифрования доступа к секретам.
+-- encrypted_private_key - закрытый ключ, зашифрованный на клиенте; сервер его не разбирает.
+-- При смене ключа старый остается с отметкой rotated_at: ключи секретов, обернутые им,
+-- по-прежнему можно расшифровать по key_id
+CREATE TABLE IF NOT EXISTS user_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    algorithm VARCHAR(20) NOT NULL CHECK (algorithm IN ('x25519', 'rsa-oaep')),
+    public_key TEXT NOT NULL,
+    encrypted_private_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    rotated_at TIMESTAMP WITH TIME ZONE
+);
+
+-- У пользователя один действующий ключ
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_keys_current ON user_keys(user_id) WHERE rotated_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_user_keys_user_id ON user_keys(user_id, created_at);
+
+CREATE TRIGGER update_user_keys_updated_at
+    BEFORE UPDATE ON user_keys
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,3 @@
+-- Откат миграции: удаление ключей пользователей
+DROP TRIGGER IF EXISTS update_user_keys_updated_at ON user_keys;
+DROP TABLE IF EXISTS user_keys;
@@ -0,0 +1,4 @@
+-- Откат миграции: удаление второго фактора TOTP
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TRIGGER IF EXISTS update_user_totp_updated_at ON user_totp;
+DROP TABLE IF EXISTS user_totp;
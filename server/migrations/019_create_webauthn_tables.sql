@@ -0,0 +1,31 @@
+-- Ключи WebAuthn (passkey и аппаратные ключи). credential_id выдает аутентификатор и он
+-- уникален глобально, public_key - открытый ключ в формате COSE. sign_count растет с каждым
+-- входом: если аутентификатор прислал счетчик не больше сохраненного, ключ мог быть скопирован
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    algorithm INTEGER NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    aaguid BYTEA,
+    transports TEXT[] NOT NULL DEFAULT '{}',
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Незавершенные церемонии WebAuthn. Challenge одноразовый: finish удаляет строку.
+-- user_id пуст при входе по passkey без email - пользователя определяет сам ключ
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    ceremony VARCHAR(20) NOT NULL CHECK (ceremony IN ('register', 'login', 'mfa')),
+    challenge BYTEA NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
@@ -0,0 +1,3 @@
+-- Откат миграции: удаление ключей и церемоний WebAuthn
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS webauthn_credentials;
@@ -0,0 +1,14 @@
+-- Создание таблицы одноразовых кодов сброса пароля
+CREATE TABLE IF NOT EXISTS password_reset_codes (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(6) NOT NULL,
+    -- Неверные попытки ввода: после лимита код перестает действовать
+    attempts INTEGER DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used BOOLEAN DEFAULT FALSE NOT NULL
+);
+
+-- Создание индекса для быстрого поиска активных кодов
+CREATE INDEX IF NOT EXISTS idx_password_reset_codes_active ON password_reset_codes(user_id, used, expires_at);
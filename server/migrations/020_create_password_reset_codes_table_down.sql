@@ -0,0 +1,2 @@
+-- Откат миграции: удаление кодов сброса пароля
+DROP TABLE IF EXISTS password_reset_codes;
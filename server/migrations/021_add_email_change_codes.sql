@@ -0,0 +1,3 @@
+-- Добавление нового адреса в коды подтверждения: код с new_email подтверждает смену email,
+-- код без него - регистрацию
+ALTER TABLE email_verification_codes ADD COLUMN IF NOT EXISTS new_email VARCHAR(255);
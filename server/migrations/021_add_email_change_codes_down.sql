@@ -0,0 +1,3 @@
+-- Откат миграции: удаление кодов смены email и поля new_email
+DELETE FROM email_verification_codes WHERE new_email IS NOT NULL;
+ALTER TABLE email_verification_codes DROP COLUMN IF EXISTS new_email;
@@ -0,0 +1,14 @@
+-- Создание таблицы кодов подтверждения удаления аккаунта
+CREATE TABLE IF NOT EXISTS account_deletion_codes (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(6) NOT NULL,
+    -- Неверные попытки ввода: после лимита код перестает действовать
+    attempts INTEGER DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used BOOLEAN DEFAULT FALSE NOT NULL
+);
+
+-- Создание индекса для быстрого поиска активных кодов
+CREATE INDEX IF NOT EXISTS idx_account_deletion_codes_active ON account_deletion_codes(user_id, used, expires_at);
@@ -0,0 +1,2 @@
+-- Откат миграции: удаление кодов подтверждения удаления аккаунта
+DROP TABLE IF EXISTS account_deletion_codes;
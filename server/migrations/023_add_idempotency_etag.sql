@@ -0,0 +1,2 @@
+-- ETag ответа повторяется вместе с телом: клиент сверяет по нему версию и контрольную сумму
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS etag VARCHAR(255) NOT NULL DEFAULT '';
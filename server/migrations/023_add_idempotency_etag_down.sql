@@ -0,0 +1,2 @@
+-- Откат миграции: удаление ETag сохраненных ответов
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS etag;
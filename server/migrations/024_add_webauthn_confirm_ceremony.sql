@@ -0,0 +1,4 @@
+-- Церемония confirm: вошедший пользователь подтверждает ключом удаление последнего второго фактора
+ALTER TABLE webauthn_challenges DROP CONSTRAINT IF EXISTS webauthn_challenges_ceremony_check;
+ALTER TABLE webauthn_challenges ADD CONSTRAINT webauthn_challenges_ceremony_check
+    CHECK (ceremony IN ('register', 'login', 'mfa', 'confirm'));
@@ -0,0 +1,5 @@
+-- Откат миграции: удаление церемонии confirm
+DELETE FROM webauthn_challenges WHERE ceremony = 'confirm';
+ALTER TABLE webauthn_challenges DROP CONSTRAINT IF EXISTS webauthn_challenges_ceremony_check;
+ALTER TABLE webauthn_challenges ADD CONSTRAINT webauthn_challenges_ceremony_check
+    CHECK (ceremony IN ('register', 'login', 'mfa'));
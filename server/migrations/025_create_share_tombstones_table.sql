@@ -0,0 +1,17 @@
+-- Надгробия доступов к секретам удаленных аккаунтов. Секреты уходят вместе с владельцем,
+-- а с ними каскадом и строки secret_shares, поэтому перед удалением аккаунта отозванные
+-- доступы переносятся сюда: получатели узнают об исчезновении секрета при синхронизации.
+-- Владельца уже нет, поэтому owner_user_id и secret_id без внешних ключей
+CREATE TABLE IF NOT EXISTS share_tombstones (
+    secret_id UUID NOT NULL,
+    grantee_user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    owner_user_id INTEGER NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    version INTEGER NOT NULL,
+    change_seq BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (secret_id, grantee_user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_tombstones_grantee_change_seq ON share_tombstones(grantee_user_id, change_seq);
@@ -0,0 +1,2 @@
+-- Откат миграции: удаление надгробий доступов к секретам удаленных аккаунтов
+DROP TABLE IF EXISTS share_tombstones;
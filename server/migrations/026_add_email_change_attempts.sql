@@ -0,0 +1,2 @@
+-- Неверные попытки ввода кода смены email: после лимита код перестает действовать
+ALTER TABLE email_verification_codes ADD COLUMN IF NOT EXISTS attempts INTEGER DEFAULT 0 NOT NULL;
@@ -0,0 +1,2 @@
+-- Откат миграции: удаление счетчика попыток из кодов верификации
+ALTER TABLE email_verification_codes DROP COLUMN IF EXISTS attempts;